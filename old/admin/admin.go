@@ -0,0 +1,83 @@
+// Package admin is the operator's API for what the garden API can't do, such
+// as checkpointing, cloning or capturing the packets of a container. It is
+// served on a listener of its own, which is only opened if asked for, rather
+// than to every garden client or alongside the health report.
+package admin
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+)
+
+// Wrapper is a container wrapped by the garden backend, e.g. to code or
+// audit its errors, which admin handlers may need to see through.
+type Wrapper interface {
+	Unwrap() api.Container
+}
+
+type Drainer interface {
+	Draining() bool
+}
+
+// New serves handler, refusing any request that would change something
+// while the backend drains, as the garden API does creates.
+func New(handler http.Handler, backend Drainer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && backend.Draining() {
+			http.Error(w, "backend is draining", http.StatusServiceUnavailable)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// LookupContainer looks up the container named by the request's ?handle=
+// and stores it in target, a pointer to the interface the handler needs of
+// it. If the request's method isn't method, there is no such container, or
+// the container doesn't implement the interface, it responds with 405, 404
+// or 501 itself and returns false.
+func LookupContainer(w http.ResponseWriter, r *http.Request, backend api.Client, method string, target interface{}) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	container, err := backend.Lookup(r.URL.Query().Get("handle"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return false
+	}
+
+	if !As(container, target) {
+		http.Error(w, "not supported by the container: "+r.URL.Path, http.StatusNotImplemented)
+		return false
+	}
+
+	return true
+}
+
+// As stores container in target, a pointer to an interface, unwrapping it
+// until it implements the interface. It returns false if it never does.
+func As(container api.Container, target interface{}) bool {
+	targetValue := reflect.ValueOf(target).Elem()
+
+	for container != nil {
+		if reflect.TypeOf(container).Implements(targetValue.Type()) {
+			targetValue.Set(reflect.ValueOf(container))
+			return true
+		}
+
+		wrapper, ok := container.(Wrapper)
+		if !ok {
+			return false
+		}
+
+		container = wrapper.Unwrap()
+	}
+
+	return false
+}
@@ -0,0 +1,148 @@
+package admin_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/admin"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+type Repairer interface {
+	Repair() error
+}
+
+type repairableContainer struct {
+	*fakes.FakeContainer
+}
+
+func (c *repairableContainer) Repair() error {
+	return nil
+}
+
+type wrappedContainer struct {
+	api.Container
+}
+
+func (c *wrappedContainer) Unwrap() api.Container {
+	return c.Container
+}
+
+type fakeDrainer bool
+
+func (d fakeDrainer) Draining() bool {
+	return bool(d)
+}
+
+var _ = Describe("Admin", func() {
+	Describe("looking up a container", func() {
+		var fakeBackend *fakes.FakeBackend
+		var repairable *repairableContainer
+
+		BeforeEach(func() {
+			repairable = &repairableContainer{new(fakes.FakeContainer)}
+
+			fakeBackend = new(fakes.FakeBackend)
+			fakeBackend.LookupReturns(repairable, nil)
+		})
+
+		lookup := func(method string) (*httptest.ResponseRecorder, Repairer, bool) {
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(method, "/repair?handle=some-handle", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var repairer Repairer
+			found := admin.LookupContainer(recorder, request, fakeBackend, "POST", &repairer)
+
+			return recorder, repairer, found
+		}
+
+		It("stores the container named by the handle in the target", func() {
+			_, repairer, found := lookup("POST")
+			Ω(found).Should(BeTrue())
+			Ω(repairer).Should(Equal(repairable))
+
+			Ω(fakeBackend.LookupArgsForCall(0)).Should(Equal("some-handle"))
+		})
+
+		It("sees through containers the backend wraps", func() {
+			fakeBackend.LookupReturns(&wrappedContainer{&wrappedContainer{repairable}}, nil)
+
+			_, repairer, found := lookup("POST")
+			Ω(found).Should(BeTrue())
+			Ω(repairer).Should(Equal(repairable))
+		})
+
+		It("responds 405 for other methods", func() {
+			response, _, found := lookup("GET")
+			Ω(found).Should(BeFalse())
+			Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+			Ω(response.Header().Get("Allow")).Should(Equal("POST"))
+
+			Ω(fakeBackend.LookupCallCount()).Should(Equal(0))
+		})
+
+		It("responds 404 if there is no such container", func() {
+			fakeBackend.LookupReturns(nil, errors.New("oh no!"))
+
+			response, _, found := lookup("POST")
+			Ω(found).Should(BeFalse())
+			Ω(response.Code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("responds 501 if the container doesn't implement the interface", func() {
+			fakeBackend.LookupReturns(&wrappedContainer{new(fakes.FakeContainer)}, nil)
+
+			response, _, found := lookup("POST")
+			Ω(found).Should(BeFalse())
+			Ω(response.Code).Should(Equal(http.StatusNotImplemented))
+		})
+	})
+
+	Describe("serving", func() {
+		var served bool
+
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served = true
+		})
+
+		BeforeEach(func() {
+			served = false
+		})
+
+		serve := func(draining bool, method string) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(method, "/repair", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			admin.New(handler, fakeDrainer(draining)).ServeHTTP(recorder, request)
+
+			return recorder
+		}
+
+		It("serves every request while not draining", func() {
+			serve(false, "POST")
+			Ω(served).Should(BeTrue())
+		})
+
+		Context("while draining", func() {
+			It("refuses requests that would change anything", func() {
+				response := serve(true, "POST")
+				Ω(response.Code).Should(Equal(http.StatusServiceUnavailable))
+				Ω(served).Should(BeFalse())
+			})
+
+			It("still serves GETs", func() {
+				serve(true, "GET")
+				Ω(served).Should(BeTrue())
+			})
+		})
+	})
+})
@@ -0,0 +1,253 @@
+package audit
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+// NewLogger returns a logger which appends to the audit log at path.
+func NewLogger(path string) (lager.Logger, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := lager.NewLogger("garden-linux-audit")
+	logger.RegisterSink(lager.NewWriterSink(file, lager.INFO))
+
+	return logger, nil
+}
+
+// NewBackend records every Create and Destroy on the backend, and every
+// NetIn, NetOut and privileged Run on its containers, with its outcome.
+//
+// The garden server does not pass who made a request on to the backend, so
+// only the operation itself can be recorded.
+func NewBackend(backend api.Backend, logger lager.Logger) api.Backend {
+	return &auditedBackend{
+		Backend: backend,
+		logger:  logger,
+	}
+}
+
+type auditedBackend struct {
+	api.Backend
+
+	logger lager.Logger
+}
+
+func (b *auditedBackend) Create(spec api.ContainerSpec) (api.Container, error) {
+	bindMounts := []string{}
+	for _, bm := range spec.BindMounts {
+		bindMounts = append(bindMounts, bm.SrcPath+":"+bm.DstPath)
+	}
+
+	data := lager.Data{
+		"handle":      spec.Handle,
+		"rootfs":      spec.RootFSPath,
+		"bind-mounts": bindMounts,
+		"properties":  spec.Properties,
+	}
+
+	container, err := b.Backend.Create(spec)
+	if err != nil {
+		b.logger.Error("create", err, data)
+		return nil, err
+	}
+
+	data["handle"] = container.Handle()
+	b.logger.Info("create", data)
+
+	return b.wrap(container), nil
+}
+
+// preStopper is a container with a pre-stop command, whose outcome is
+// recorded with its destroy
+type preStopper interface {
+	PreStopResult() linux_backend.PreStopResult
+}
+
+func (b *auditedBackend) Destroy(handle string) error {
+	data := lager.Data{
+		"handle": handle,
+	}
+
+	// the container is gone once destroyed, so is looked up beforehand
+	container, lookupErr := b.Backend.Lookup(handle)
+
+	err := b.Backend.Destroy(handle)
+	if err != nil {
+		b.logger.Error("destroy", err, data)
+		return err
+	}
+
+	if lookupErr == nil {
+		if stopper, ok := container.(preStopper); ok && stopper.PreStopResult() != linux_backend.PreStopNotRun {
+			data["pre-stop"] = stopper.PreStopResult()
+		}
+	}
+
+	b.logger.Info("destroy", data)
+
+	return nil
+}
+
+func (b *auditedBackend) Containers(filter api.Properties) ([]api.Container, error) {
+	containers, err := b.Backend.Containers(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped := []api.Container{}
+	for _, container := range containers {
+		wrapped = append(wrapped, b.wrap(container))
+	}
+
+	return wrapped, nil
+}
+
+func (b *auditedBackend) Lookup(handle string) (api.Container, error) {
+	container, err := b.Backend.Lookup(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.wrap(container), nil
+}
+
+// the backend only knows the grace time of its own containers
+func (b *auditedBackend) GraceTime(container api.Container) time.Duration {
+	if audited, ok := container.(*auditedContainer); ok {
+		container = audited.Container
+	}
+
+	return b.Backend.GraceTime(container)
+}
+
+func (b *auditedBackend) wrap(container api.Container) api.Container {
+	return &auditedContainer{
+		Container: container,
+		logger:    b.logger,
+	}
+}
+
+type auditedContainer struct {
+	api.Container
+
+	logger lager.Logger
+}
+
+func (c *auditedContainer) Unwrap() api.Container {
+	return c.Container
+}
+
+func (c *auditedContainer) NetIn(hostPort, containerPort uint32) (uint32, uint32, error) {
+	data := lager.Data{
+		"handle":         c.Handle(),
+		"host-port":      hostPort,
+		"container-port": containerPort,
+	}
+
+	hostPort, containerPort, err := c.Container.NetIn(hostPort, containerPort)
+	if err != nil {
+		c.logger.Error("net-in", err, data)
+		return 0, 0, err
+	}
+
+	data["host-port"] = hostPort
+	data["container-port"] = containerPort
+	c.logger.Info("net-in", data)
+
+	return hostPort, containerPort, nil
+}
+
+func (c *auditedContainer) NetOut(network string, port uint32) error {
+	data := lager.Data{
+		"handle":  c.Handle(),
+		"network": network,
+		"port":    port,
+	}
+
+	err := c.Container.NetOut(network, port)
+	if err != nil {
+		c.logger.Error("net-out", err, data)
+		return err
+	}
+
+	c.logger.Info("net-out", data)
+
+	return nil
+}
+
+// Run records privileged processes only; neither their arguments nor their
+// environment are recorded, as they may carry credentials.
+func (c *auditedContainer) Run(spec api.ProcessSpec, io api.ProcessIO) (api.Process, error) {
+	if !spec.Privileged {
+		return c.Container.Run(spec, io)
+	}
+
+	data := lager.Data{
+		"handle": c.Handle(),
+		"path":   spec.Path,
+		"dir":    spec.Dir,
+	}
+
+	process, err := c.Container.Run(spec, io)
+	if err != nil {
+		c.logger.Error("run-privileged", err, data)
+		return nil, err
+	}
+
+	data["process"] = process.ID()
+	c.logger.Info("run-privileged", data)
+
+	return process, nil
+}
+
+// NewHandler records every request to handler that would change something,
+// i.e. that isn't a GET, with its query and the status it was answered with.
+// Request bodies are not recorded.
+func NewHandler(handler http.Handler, logger lager.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		handler.ServeHTTP(recorder, r)
+
+		data := lager.Data{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"query":  r.URL.RawQuery,
+			"status": recorder.status,
+		}
+
+		if recorder.status >= http.StatusBadRequest {
+			logger.Error("admin", errors.New(http.StatusText(recorder.status)), data)
+			return
+		}
+
+		logger.Info("admin", data)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,256 @@
+package audit_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/audit"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+type preStoppedContainer struct {
+	*fakes.FakeContainer
+
+	result linux_backend.PreStopResult
+}
+
+func (c *preStoppedContainer) PreStopResult() linux_backend.PreStopResult {
+	return c.result
+}
+
+var _ = Describe("Auditing", func() {
+	var fakeBackend *fakes.FakeBackend
+	var fakeContainer *fakes.FakeContainer
+	var logger *lagertest.TestLogger
+	var backend api.Backend
+
+	BeforeEach(func() {
+		fakeBackend = new(fakes.FakeBackend)
+		fakeContainer = new(fakes.FakeContainer)
+		fakeContainer.HandleReturns("some-handle")
+
+		fakeBackend.CreateReturns(fakeContainer, nil)
+		fakeBackend.LookupReturns(fakeContainer, nil)
+
+		logger = lagertest.NewTestLogger("audit")
+		backend = audit.NewBackend(fakeBackend, logger)
+	})
+
+	Describe("creating a container", func() {
+		It("records the container's spec", func() {
+			_, err := backend.Create(api.ContainerSpec{
+				RootFSPath: "docker:///busybox",
+				BindMounts: []api.BindMount{
+					{SrcPath: "/src", DstPath: "/dst"},
+				},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(logger.Logs()).Should(HaveLen(1))
+
+			log := logger.Logs()[0]
+			Ω(log.Message).Should(Equal("audit.create"))
+			Ω(log.LogLevel).Should(Equal(lager.INFO))
+			Ω(log.Data).Should(HaveKeyWithValue("handle", "some-handle"))
+			Ω(log.Data).Should(HaveKeyWithValue("rootfs", "docker:///busybox"))
+			Ω(log.Data).Should(HaveKeyWithValue("bind-mounts", []interface{}{"/src:/dst"}))
+		})
+
+		Context("when creating fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeBackend.CreateReturns(nil, disaster)
+			})
+
+			It("records the failure", func() {
+				_, err := backend.Create(api.ContainerSpec{Handle: "some-handle"})
+				Ω(err).Should(Equal(disaster))
+
+				log := logger.Logs()[0]
+				Ω(log.Message).Should(Equal("audit.create"))
+				Ω(log.LogLevel).Should(Equal(lager.ERROR))
+				Ω(log.Data).Should(HaveKeyWithValue("error", "oh no!"))
+			})
+		})
+	})
+
+	It("records destroying a container", func() {
+		err := backend.Destroy("some-handle")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(fakeBackend.DestroyArgsForCall(0)).Should(Equal("some-handle"))
+
+		log := logger.Logs()[0]
+		Ω(log.Message).Should(Equal("audit.destroy"))
+		Ω(log.Data).Should(HaveKeyWithValue("handle", "some-handle"))
+		Ω(log.Data).ShouldNot(HaveKey("pre-stop"))
+	})
+
+	Context("when the destroyed container ran a pre-stop command", func() {
+		BeforeEach(func() {
+			fakeBackend.LookupReturns(&preStoppedContainer{
+				FakeContainer: fakeContainer,
+				result:        linux_backend.PreStopTimedOut,
+			}, nil)
+		})
+
+		It("records its outcome", func() {
+			err := backend.Destroy("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			log := logger.Logs()[0]
+			Ω(log.Message).Should(Equal("audit.destroy"))
+			Ω(log.Data).Should(HaveKeyWithValue("pre-stop", "timed-out"))
+		})
+	})
+
+	Describe("a container's operations", func() {
+		var container api.Container
+
+		BeforeEach(func() {
+			var err error
+
+			container, err = backend.Lookup("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("records mapping ports in, with the ports mapped", func() {
+			fakeContainer.NetInReturns(1234, 5678, nil)
+
+			hostPort, containerPort, err := container.NetIn(0, 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(hostPort).Should(Equal(uint32(1234)))
+			Ω(containerPort).Should(Equal(uint32(5678)))
+
+			log := logger.Logs()[0]
+			Ω(log.Message).Should(Equal("audit.net-in"))
+			Ω(log.Data).Should(HaveKeyWithValue("host-port", float64(1234)))
+			Ω(log.Data).Should(HaveKeyWithValue("container-port", float64(5678)))
+		})
+
+		It("records allowing traffic out", func() {
+			err := container.NetOut("1.2.3.4/32", 80)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			log := logger.Logs()[0]
+			Ω(log.Message).Should(Equal("audit.net-out"))
+			Ω(log.Data).Should(HaveKeyWithValue("network", "1.2.3.4/32"))
+		})
+
+		It("records privileged processes, without their arguments or environment", func() {
+			fakeProcess := new(fakes.FakeProcess)
+			fakeProcess.IDReturns(42)
+			fakeContainer.RunReturns(fakeProcess, nil)
+
+			_, err := container.Run(api.ProcessSpec{
+				Path:       "/bin/sh",
+				Args:       []string{"-c", "echo secret"},
+				Env:        []string{"PASSWORD=secret"},
+				Privileged: true,
+			}, api.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			log := logger.Logs()[0]
+			Ω(log.Message).Should(Equal("audit.run-privileged"))
+			Ω(log.Data).Should(HaveKeyWithValue("path", "/bin/sh"))
+			Ω(log.Data).Should(HaveKeyWithValue("process", float64(42)))
+			Ω(string(logger.Buffer.Contents())).ShouldNot(ContainSubstring("secret"))
+		})
+
+		It("does not record unprivileged processes", func() {
+			_, err := container.Run(api.ProcessSpec{Path: "/bin/sh"}, api.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(logger.Logs()).Should(BeEmpty())
+		})
+
+		It("can have its grace time looked up", func() {
+			fakeBackend.GraceTimeReturns(time.Minute)
+
+			Ω(backend.GraceTime(container)).Should(Equal(time.Minute))
+			Ω(fakeBackend.GraceTimeArgsForCall(0)).Should(Equal(fakeContainer))
+		})
+	})
+
+	Describe("admin requests", func() {
+		var handler http.Handler
+
+		BeforeEach(func() {
+			handler = audit.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("handle") == "bogus" {
+					http.Error(w, "no such container", http.StatusNotFound)
+				}
+			}), logger)
+		})
+
+		serve := func(method, url string) {
+			request, err := http.NewRequest(method, url, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+		}
+
+		It("records those that would change something, with their outcome", func() {
+			serve("POST", "/checkpoint?handle=some-handle&action=dump")
+
+			log := logger.Logs()[0]
+			Ω(log.Message).Should(Equal("audit.admin"))
+			Ω(log.LogLevel).Should(Equal(lager.INFO))
+			Ω(log.Data).Should(HaveKeyWithValue("method", "POST"))
+			Ω(log.Data).Should(HaveKeyWithValue("path", "/checkpoint"))
+			Ω(log.Data).Should(HaveKeyWithValue("query", "handle=some-handle&action=dump"))
+			Ω(log.Data).Should(HaveKeyWithValue("status", float64(200)))
+		})
+
+		It("records failures", func() {
+			serve("DELETE", "/net-in?handle=bogus")
+
+			log := logger.Logs()[0]
+			Ω(log.LogLevel).Should(Equal(lager.ERROR))
+			Ω(log.Data).Should(HaveKeyWithValue("status", float64(404)))
+		})
+
+		It("does not record GETs", func() {
+			serve("GET", "/operations")
+
+			Ω(logger.Logs()).Should(BeEmpty())
+		})
+	})
+
+	Describe("the audit log", func() {
+		It("is appended to", func() {
+			tmpdir, err := ioutil.TempDir("", "audit")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir)
+
+			logPath := path.Join(tmpdir, "audit.log")
+
+			err = ioutil.WriteFile(logPath, []byte("previous\n"), 0600)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			auditLogger, err := audit.NewLogger(logPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = audit.NewBackend(fakeBackend, auditLogger).Destroy("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(logPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(contents)).Should(HavePrefix("previous\n"))
+			Ω(string(contents)).Should(ContainSubstring(`"message":"garden-linux-audit.destroy"`))
+		})
+	})
+})
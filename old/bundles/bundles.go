@@ -0,0 +1,52 @@
+package bundles
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/admin"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+type Container interface {
+	Bundle() (linux_backend.Bundle, error)
+}
+
+// Handler renders a container's configuration as an OCI-style bundle on
+// GET ?handle=..., for which the garden API has no room. The bundle
+// includes the container's environment.
+type Handler struct {
+	logger  lager.Logger
+	backend api.Client
+}
+
+func New(logger lager.Logger, backend api.Client) *Handler {
+	return &Handler{
+		logger:  logger.Session("bundles"),
+		backend: backend,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var bundler Container
+	if !admin.LookupContainer(w, r, h.backend, "GET", &bundler) {
+		return
+	}
+
+	bundle, err := bundler.Bundle()
+	if err != nil {
+		h.logger.Error("failed", err, lager.Data{
+			"handle": r.URL.Query().Get("handle"),
+		})
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(bundle)
+}
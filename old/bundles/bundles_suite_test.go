@@ -0,0 +1,13 @@
+package bundles_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestBundles(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Bundles Suite")
+}
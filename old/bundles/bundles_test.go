@@ -0,0 +1,114 @@
+package bundles_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/bundles"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+type bundledContainer struct {
+	*fakes.FakeContainer
+
+	bundle linux_backend.Bundle
+	err    error
+}
+
+func (c *bundledContainer) Bundle() (linux_backend.Bundle, error) {
+	return c.bundle, c.err
+}
+
+var _ = Describe("Bundles", func() {
+	var fakeBackend *fakes.FakeBackend
+	var container *bundledContainer
+	var handler *bundles.Handler
+
+	BeforeEach(func() {
+		container = &bundledContainer{
+			FakeContainer: new(fakes.FakeContainer),
+
+			bundle: linux_backend.Bundle{
+				OCIVersion: linux_backend.BundleOCIVersion,
+				Root:       linux_backend.BundleRoot{Path: "/some/rootfs"},
+				Hostname:   "some-id",
+			},
+		}
+
+		fakeBackend = new(fakes.FakeBackend)
+		fakeBackend.LookupReturns(container, nil)
+
+		handler = bundles.New(lagertest.NewTestLogger("test"), fakeBackend)
+	})
+
+	request := func(method, query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+
+		request, err := http.NewRequest(method, "/bundle?"+query, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	It("responds with the container's bundle as JSON", func() {
+		response := request("GET", "handle=some-handle")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+		Ω(fakeBackend.LookupArgsForCall(0)).Should(Equal("some-handle"))
+
+		var bundle linux_backend.Bundle
+		err := json.NewDecoder(response.Body).Decode(&bundle)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(bundle).Should(Equal(container.bundle))
+	})
+
+	It("only allows GET", func() {
+		response := request("POST", "handle=some-handle")
+		Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+	})
+
+	Context("when the container does not exist", func() {
+		BeforeEach(func() {
+			fakeBackend.LookupReturns(nil, linux_backend.UnknownHandleError{Handle: "some-handle"})
+		})
+
+		It("responds with 404", func() {
+			response := request("GET", "handle=some-handle")
+			Ω(response.Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("when rendering the bundle fails", func() {
+		BeforeEach(func() {
+			container.err = errors.New("oh no!")
+		})
+
+		It("responds with 500 and the error", func() {
+			response := request("GET", "handle=some-handle")
+			Ω(response.Code).Should(Equal(http.StatusInternalServerError))
+			Ω(response.Body.String()).Should(ContainSubstring("oh no!"))
+		})
+	})
+
+	Context("when the container cannot be exported", func() {
+		BeforeEach(func() {
+			fakeBackend.LookupReturns(new(fakes.FakeContainer), nil)
+		})
+
+		It("responds with 501", func() {
+			response := request("GET", "handle=some-handle")
+			Ω(response.Code).Should(Equal(http.StatusNotImplemented))
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package checkpoints
+
+import (
+	"net/http"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/admin"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+type Container interface {
+	Checkpoint() error
+	RestoreCheckpoint() error
+}
+
+// Handler checkpoints a container on POST ?handle=...&action=dump, and
+// restores it on POST ?handle=...&action=restore. Checkpointing is
+// experimental, and has no place in the garden API.
+type Handler struct {
+	logger  lager.Logger
+	backend api.Client
+}
+
+func New(logger lager.Logger, backend api.Client) *Handler {
+	return &Handler{
+		logger:  logger.Session("checkpoints"),
+		backend: backend,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var checkpointer Container
+	if !admin.LookupContainer(w, r, h.backend, "POST", &checkpointer) {
+		return
+	}
+
+	action := r.URL.Query().Get("action")
+
+	if action != "dump" && action != "restore" {
+		http.Error(w, "action must be dump or restore", http.StatusBadRequest)
+		return
+	}
+
+	rLog := h.logger.Session(action, lager.Data{
+		"handle": r.URL.Query().Get("handle"),
+	})
+
+	var err error
+	if action == "dump" {
+		err = checkpointer.Checkpoint()
+	} else {
+		err = checkpointer.RestoreCheckpoint()
+	}
+
+	switch err.(type) {
+	case nil:
+	case linux_backend.InvalidStateError:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		rLog.Error("failed", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rLog.Info("done")
+
+	w.WriteHeader(http.StatusNoContent)
+}
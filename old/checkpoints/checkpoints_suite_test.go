@@ -0,0 +1,13 @@
+package checkpoints_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCheckpoints(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Checkpoints Suite")
+}
@@ -0,0 +1,136 @@
+package checkpoints_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/checkpoints"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+type checkpointedContainer struct {
+	*fakes.FakeContainer
+
+	dumped   int
+	restored int
+	err      error
+}
+
+func (c *checkpointedContainer) Checkpoint() error {
+	c.dumped++
+	return c.err
+}
+
+func (c *checkpointedContainer) RestoreCheckpoint() error {
+	c.restored++
+	return c.err
+}
+
+var _ = Describe("Checkpoints", func() {
+	var fakeBackend *fakes.FakeBackend
+	var container *checkpointedContainer
+	var handler *checkpoints.Handler
+
+	BeforeEach(func() {
+		container = &checkpointedContainer{FakeContainer: new(fakes.FakeContainer)}
+
+		fakeBackend = new(fakes.FakeBackend)
+		fakeBackend.LookupReturns(container, nil)
+
+		handler = checkpoints.New(lagertest.NewTestLogger("test"), fakeBackend)
+	})
+
+	request := func(method, query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+
+		request, err := http.NewRequest(method, "/checkpoint?"+query, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	It("checkpoints the container", func() {
+		response := request("POST", "handle=some-handle&action=dump")
+		Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+		Ω(fakeBackend.LookupArgsForCall(0)).Should(Equal("some-handle"))
+		Ω(container.dumped).Should(Equal(1))
+		Ω(container.restored).Should(BeZero())
+	})
+
+	It("restores the container", func() {
+		response := request("POST", "handle=some-handle&action=restore")
+		Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+		Ω(container.restored).Should(Equal(1))
+		Ω(container.dumped).Should(BeZero())
+	})
+
+	It("only allows POST", func() {
+		response := request("GET", "handle=some-handle&action=dump")
+		Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+
+		Ω(container.dumped).Should(BeZero())
+	})
+
+	It("rejects unknown actions", func() {
+		Ω(request("POST", "handle=some-handle&action=freeze").Code).Should(Equal(http.StatusBadRequest))
+		Ω(request("POST", "handle=some-handle").Code).Should(Equal(http.StatusBadRequest))
+
+		Ω(container.dumped).Should(BeZero())
+		Ω(container.restored).Should(BeZero())
+	})
+
+	Context("when the container does not exist", func() {
+		BeforeEach(func() {
+			fakeBackend.LookupReturns(nil, linux_backend.UnknownHandleError{Handle: "some-handle"})
+		})
+
+		It("responds with 404", func() {
+			response := request("POST", "handle=some-handle&action=dump")
+			Ω(response.Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("when the container is in the wrong state", func() {
+		BeforeEach(func() {
+			container.err = linux_backend.InvalidStateError{State: linux_backend.StateStopped}
+		})
+
+		It("responds with 409", func() {
+			response := request("POST", "handle=some-handle&action=restore")
+			Ω(response.Code).Should(Equal(http.StatusConflict))
+		})
+	})
+
+	Context("when checkpointing fails", func() {
+		BeforeEach(func() {
+			container.err = errors.New("oh no!")
+		})
+
+		It("responds with 500 and the error", func() {
+			response := request("POST", "handle=some-handle&action=dump")
+			Ω(response.Code).Should(Equal(http.StatusInternalServerError))
+			Ω(response.Body.String()).Should(ContainSubstring("oh no!"))
+		})
+	})
+
+	Context("when the container cannot be checkpointed", func() {
+		BeforeEach(func() {
+			fakeBackend.LookupReturns(new(fakes.FakeContainer), nil)
+		})
+
+		It("responds with 501", func() {
+			response := request("POST", "handle=some-handle&action=dump")
+			Ω(response.Code).Should(Equal(http.StatusNotImplemented))
+		})
+	})
+})
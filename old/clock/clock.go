@@ -0,0 +1,30 @@
+package clock
+
+import "time"
+
+// Clock is the source of time for anything whose behaviour depends on it,
+// so that it can be driven by a fake in tests rather than with sleeps.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+// New returns a Clock backed by the system time.
+func New() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
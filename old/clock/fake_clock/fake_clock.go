@@ -0,0 +1,87 @@
+package fake_clock
+
+import (
+	"sync"
+	"time"
+)
+
+type FakeClock struct {
+	now time.Time
+
+	waiters []waiter
+
+	mutex *sync.Mutex
+}
+
+type waiter struct {
+	until time.Time
+	fire  chan time.Time
+}
+
+func New(now time.Time) *FakeClock {
+	return &FakeClock{
+		now: now,
+
+		mutex: new(sync.Mutex),
+	}
+}
+
+func (clock *FakeClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	return clock.now
+}
+
+func (clock *FakeClock) Sleep(d time.Duration) {
+	<-clock.After(d)
+}
+
+func (clock *FakeClock) After(d time.Duration) <-chan time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	fire := make(chan time.Time, 1)
+
+	if d <= 0 {
+		fire <- clock.now
+		return fire
+	}
+
+	clock.waiters = append(clock.waiters, waiter{
+		until: clock.now.Add(d),
+		fire:  fire,
+	})
+
+	return fire
+}
+
+// Increment moves the clock forward, waking any sleepers whose time has
+// come.
+func (clock *FakeClock) Increment(d time.Duration) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	clock.now = clock.now.Add(d)
+
+	remaining := []waiter{}
+	for _, w := range clock.waiters {
+		if w.until.After(clock.now) {
+			remaining = append(remaining, w)
+			continue
+		}
+
+		w.fire <- clock.now
+	}
+
+	clock.waiters = remaining
+}
+
+// WatcherCount returns how many callers are sleeping on the clock, so that
+// tests can wait for a loop to block before moving time forward.
+func (clock *FakeClock) WatcherCount() int {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	return len(clock.waiters)
+}
@@ -0,0 +1,90 @@
+package clones
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/admin"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider"
+)
+
+type Cloner interface {
+	CreateWithRootFS(spec api.ContainerSpec, provider rootfs_provider.RootFSProvider) (api.Container, error)
+}
+
+type Container interface {
+	ID() string
+	Properties() api.Properties
+	CurrentEnvVars() []string
+}
+
+// Clone is the container created by a clone.
+type Clone struct {
+	Handle string `json:"handle"`
+}
+
+// Handler creates a container from another's current rootfs on
+// POST ?handle=...[&newHandle=...]
+//
+// The clone is given its own network and the source's properties and
+// environment. Its rootfs is a copy of the changes the source has made
+// layered over the source's base, so only containers whose rootfs was
+// provided by an overlay can be cloned. Limits, bind mounts and port
+// mappings are not carried over.
+//
+// The clone's rootfs is provided by the handler's provider, which is only
+// ever given to the cloner explicitly; garden clients can't name it in a
+// spec, so can't copy another's rootfs.
+type Handler struct {
+	logger   lager.Logger
+	backend  api.Client
+	cloner   Cloner
+	provider rootfs_provider.RootFSProvider
+}
+
+func New(logger lager.Logger, backend api.Client, cloner Cloner, provider rootfs_provider.RootFSProvider) *Handler {
+	return &Handler{
+		logger:   logger.Session("clones"),
+		backend:  backend,
+		cloner:   cloner,
+		provider: provider,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var source Container
+	if !admin.LookupContainer(w, r, h.backend, "POST", &source) {
+		return
+	}
+
+	rLog := h.logger.Session("clone", lager.Data{
+		"handle":     r.URL.Query().Get("handle"),
+		"new-handle": r.URL.Query().Get("newHandle"),
+	})
+
+	// the properties Info reports include ones describing the source itself,
+	// such as its network namespace, so only its own are carried over
+	clone, err := h.cloner.CreateWithRootFS(api.ContainerSpec{
+		Handle:     r.URL.Query().Get("newHandle"),
+		RootFSPath: "clone:///" + source.ID(),
+		Properties: source.Properties(),
+		Env:        source.CurrentEnvVars(),
+	}, h.provider)
+	if err != nil {
+		rLog.Error("failed", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rLog.Info("cloned", lager.Data{
+		"clone": clone.Handle(),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	json.NewEncoder(w).Encode(Clone{Handle: clone.Handle()})
+}
@@ -0,0 +1,13 @@
+package clones_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestClones(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Clones Suite")
+}
@@ -0,0 +1,154 @@
+package clones_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/clones"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider/fake_rootfs_provider"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+type cloneableContainer struct {
+	*fakes.FakeContainer
+
+	id         string
+	properties api.Properties
+	env        []string
+}
+
+func (c *cloneableContainer) ID() string {
+	return c.id
+}
+
+func (c *cloneableContainer) Properties() api.Properties {
+	return c.properties
+}
+
+func (c *cloneableContainer) CurrentEnvVars() []string {
+	return c.env
+}
+
+type fakeCloner struct {
+	specs     []api.ContainerSpec
+	providers []rootfs_provider.RootFSProvider
+
+	clone api.Container
+	err   error
+}
+
+func (c *fakeCloner) CreateWithRootFS(spec api.ContainerSpec, provider rootfs_provider.RootFSProvider) (api.Container, error) {
+	c.specs = append(c.specs, spec)
+	c.providers = append(c.providers, provider)
+
+	return c.clone, c.err
+}
+
+var _ = Describe("Clones", func() {
+	var fakeBackend *fakes.FakeBackend
+	var cloner *fakeCloner
+	var provider *fake_rootfs_provider.FakeRootFSProvider
+	var container *cloneableContainer
+	var handler *clones.Handler
+
+	BeforeEach(func() {
+		container = &cloneableContainer{
+			FakeContainer: new(fakes.FakeContainer),
+
+			id:         "some-id",
+			properties: api.Properties{"some-property": "some-value"},
+			env:        []string{"A=1"},
+		}
+
+		clone := new(fakes.FakeContainer)
+		clone.HandleReturns("new-handle")
+
+		fakeBackend = new(fakes.FakeBackend)
+		fakeBackend.LookupReturns(container, nil)
+
+		cloner = &fakeCloner{clone: clone}
+		provider = new(fake_rootfs_provider.FakeRootFSProvider)
+
+		handler = clones.New(lagertest.NewTestLogger("test"), fakeBackend, cloner, provider)
+	})
+
+	request := func(method, query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+
+		request, err := http.NewRequest(method, "/clone?"+query, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	It("creates a container from the source's rootfs, properties and environment", func() {
+		response := request("POST", "handle=some-handle&newHandle=new-handle")
+		Ω(response.Code).Should(Equal(http.StatusCreated))
+		Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+		Ω(fakeBackend.LookupArgsForCall(0)).Should(Equal("some-handle"))
+
+		Ω(cloner.specs).Should(Equal([]api.ContainerSpec{
+			{
+				Handle:     "new-handle",
+				RootFSPath: "clone:///some-id",
+				Properties: api.Properties{"some-property": "some-value"},
+				Env:        []string{"A=1"},
+			},
+		}))
+
+		Ω(cloner.providers).Should(Equal([]rootfs_provider.RootFSProvider{provider}))
+
+		var clone clones.Clone
+		err := json.NewDecoder(response.Body).Decode(&clone)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(clone.Handle).Should(Equal("new-handle"))
+	})
+
+	It("only allows POST", func() {
+		response := request("GET", "handle=some-handle")
+		Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+		Ω(cloner.specs).Should(BeEmpty())
+	})
+
+	Context("when the container does not exist", func() {
+		BeforeEach(func() {
+			fakeBackend.LookupReturns(nil, errors.New("not found"))
+		})
+
+		It("responds with 404", func() {
+			Ω(request("POST", "handle=some-handle").Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("when the container cannot be cloned", func() {
+		BeforeEach(func() {
+			fakeBackend.LookupReturns(new(fakes.FakeContainer), nil)
+		})
+
+		It("responds with 501", func() {
+			Ω(request("POST", "handle=some-handle").Code).Should(Equal(http.StatusNotImplemented))
+		})
+	})
+
+	Context("when creating the clone fails", func() {
+		BeforeEach(func() {
+			cloner.err = errors.New("oh no!")
+		})
+
+		It("responds with 500", func() {
+			Ω(request("POST", "handle=some-handle").Code).Should(Equal(http.StatusInternalServerError))
+		})
+	})
+})
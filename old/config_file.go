@@ -0,0 +1,116 @@
+package old
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var configFile = flag.String(
+	"config",
+	"",
+	`JSON file of flag values, e.g. {"networkPool": "10.254.0.0/22", "denyNetworks": ["0.0.0.0/0"]}; flags given on the command line take precedence`,
+)
+
+type UnknownConfigOptionError struct {
+	Name string
+}
+
+func (e UnknownConfigOptionError) Error() string {
+	return fmt.Sprintf("unknown option in config file: %s", e.Name)
+}
+
+type InvalidConfigValueError struct {
+	Name  string
+	Value interface{}
+}
+
+func (e InvalidConfigValueError) Error() string {
+	return fmt.Sprintf("invalid value for %s in config file: %v", e.Name, e.Value)
+}
+
+// loadConfigFile sets each flag named in the config file to its value, unless
+// the flag was given on the command line. Lists are joined with commas, as
+// the comma-separated flags expect.
+func loadConfigFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+
+	var values map[string]interface{}
+
+	err = decoder.Decode(&values)
+	if err != nil {
+		return err
+	}
+
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if flag.Lookup(name) == nil {
+			return UnknownConfigOptionError{name}
+		}
+
+		if given[name] {
+			continue
+		}
+
+		value, ok := configValue(values[name])
+		if !ok {
+			return InvalidConfigValueError{name, values[name]}
+		}
+
+		err := flag.Set(name, value)
+		if err != nil {
+			return InvalidConfigValueError{name, values[name]}
+		}
+	}
+
+	return nil
+}
+
+func configValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case []interface{}:
+		elems := []string{}
+
+		for _, elem := range v {
+			str, ok := configValue(elem)
+			if !ok {
+				return "", false
+			}
+
+			elems = append(elems, str)
+		}
+
+		return strings.Join(elems, ","), true
+	default:
+		return "", false
+	}
+}
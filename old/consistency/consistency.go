@@ -0,0 +1,477 @@
+package consistency
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+type Backend interface {
+	Containers(api.Properties) ([]api.Container, error)
+	Operations() []linux_backend.Operation
+}
+
+type Container interface {
+	ID() string
+	Resources() *linux_backend.Resources
+	NetworkInterfaces() (linux_backend.ContainerNetworkInterfaces, error)
+}
+
+type ContainerPool interface {
+	DepotIDs() ([]string, error)
+	RuleIDs() ([]string, error)
+}
+
+type ResourcePool interface {
+	InitialSize() int
+	Available() int
+}
+
+// Interfaces lists the names of the host's network interfaces.
+type Interfaces func() ([]string, error)
+
+// HostInterfaces lists the host's network interfaces with net.Interfaces.
+func HostInterfaces() ([]string, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, iface := range interfaces {
+		names = append(names, iface.Name)
+	}
+
+	return names, nil
+}
+
+const (
+	OrphanedDepotDirectory = "orphaned-depot-directory"
+	OrphanedRules          = "orphaned-rules"
+	OrphanedInterface      = "orphaned-interface"
+
+	MissingDepotDirectory = "missing-depot-directory"
+	MissingRules          = "missing-rules"
+	MissingInterface      = "missing-interface"
+
+	DoubleAllocation = "double-allocation"
+	PoolLeak         = "pool-leak"
+	PoolOvercommit   = "pool-overcommit"
+)
+
+// Report is the outcome of a check. The check is a snapshot of a live cell,
+// so containers being created or destroyed while it ran may show up as
+// orphans; if operations were in flight, check again to tell.
+type Report struct {
+	Containers         int             `json:"containers"`
+	OperationsInFlight int             `json:"operations_in_flight"`
+	Inconsistencies    []Inconsistency `json:"inconsistencies"`
+}
+
+// Inconsistency is a disagreement between the backend's containers and the
+// state of the cell, and what can be done about it. ID is a container id
+// that no container has; Resource is a network, port, uid, or interface.
+type Inconsistency struct {
+	Kind        string   `json:"kind"`
+	Handles     []string `json:"handles,omitempty"`
+	ID          string   `json:"id,omitempty"`
+	Resource    string   `json:"resource,omitempty"`
+	Count       int      `json:"count,omitempty"`
+	Remediation string   `json:"remediation"`
+}
+
+// Pools are the pools containers' resources are allocated from.
+type Pools struct {
+	Network ResourcePool
+	Port    ResourcePool
+	UID     ResourcePool
+}
+
+// Checker cross-checks the backend's containers against the depot, the
+// iptables rules, the host's interfaces, and the resource pools.
+type Checker struct {
+	logger lager.Logger
+
+	backend         Backend
+	containerPool   ContainerPool
+	pools           Pools
+	interfaces      Interfaces
+	interfacePrefix string
+}
+
+func NewChecker(
+	logger lager.Logger,
+	backend Backend,
+	containerPool ContainerPool,
+	pools Pools,
+	interfaces Interfaces,
+	interfacePrefix string,
+) *Checker {
+	return &Checker{
+		logger: logger.Session("consistency"),
+
+		backend:         backend,
+		containerPool:   containerPool,
+		pools:           pools,
+		interfaces:      interfaces,
+		interfacePrefix: interfacePrefix,
+	}
+}
+
+type checkedContainer struct {
+	handle    string
+	id        string
+	resources *linux_backend.Resources
+	hostIface string
+}
+
+func (c *Checker) Check() (Report, error) {
+	operations := c.backend.Operations()
+
+	apiContainers, err := c.backend.Containers(nil)
+	if err != nil {
+		return Report{}, err
+	}
+
+	containers := []checkedContainer{}
+	for _, apiContainer := range apiContainers {
+		container, ok := apiContainer.(Container)
+		if !ok {
+			continue
+		}
+
+		checked := checkedContainer{
+			handle:    apiContainer.Handle(),
+			id:        container.ID(),
+			resources: container.Resources(),
+		}
+
+		// the container may have been destroyed since it was listed
+		interfaces, err := container.NetworkInterfaces()
+		if err != nil {
+			c.logger.Error("failed-to-get-interfaces", err, lager.Data{
+				"handle": checked.handle,
+			})
+		} else {
+			checked.hostIface = interfaces.HostIface
+		}
+
+		containers = append(containers, checked)
+	}
+
+	depotIDs, err := c.containerPool.DepotIDs()
+	if err != nil {
+		return Report{}, err
+	}
+
+	ruleIDs, err := c.containerPool.RuleIDs()
+	if err != nil {
+		return Report{}, err
+	}
+
+	hostInterfaces, err := c.interfaces()
+	if err != nil {
+		return Report{}, err
+	}
+
+	inconsistencies := []Inconsistency{}
+	inconsistencies = append(inconsistencies, checkDepot(containers, depotIDs)...)
+	inconsistencies = append(inconsistencies, checkRules(containers, ruleIDs, depotIDs)...)
+	inconsistencies = append(inconsistencies, c.checkInterfaces(containers, hostInterfaces)...)
+	inconsistencies = append(inconsistencies, c.checkPools(containers)...)
+
+	return Report{
+		Containers:         len(containers),
+		OperationsInFlight: len(operations),
+		Inconsistencies:    inconsistencies,
+	}, nil
+}
+
+func checkDepot(containers []checkedContainer, depotIDs []string) []Inconsistency {
+	inconsistencies := []Inconsistency{}
+
+	depot := toSet(depotIDs)
+	known := map[string]bool{}
+
+	for _, container := range containers {
+		known[container.id] = true
+
+		if !depot[container.id] {
+			inconsistencies = append(inconsistencies, Inconsistency{
+				Kind:        MissingDepotDirectory,
+				Handles:     []string{container.handle},
+				ID:          container.id,
+				Remediation: "destroy the container; it can no longer be run",
+			})
+		}
+	}
+
+	for _, id := range sortedSet(depot) {
+		if !known[id] {
+			inconsistencies = append(inconsistencies, Inconsistency{
+				Kind:        OrphanedDepotDirectory,
+				ID:          id,
+				Remediation: "restart the server, which prunes depot directories that no container has",
+			})
+		}
+	}
+
+	return inconsistencies
+}
+
+func checkRules(containers []checkedContainer, ruleIDs []string, depotIDs []string) []Inconsistency {
+	inconsistencies := []Inconsistency{}
+
+	rules := toSet(ruleIDs)
+	depot := toSet(depotIDs)
+	known := map[string]bool{}
+
+	for _, container := range containers {
+		known[container.id] = true
+
+		if !rules[container.id] {
+			inconsistencies = append(inconsistencies, Inconsistency{
+				Kind:        MissingRules,
+				Handles:     []string{container.handle},
+				ID:          container.id,
+				Remediation: "restart the server, which sets up restored containers' rules again, or destroy the container",
+			})
+		}
+	}
+
+	for _, id := range sortedSet(rules) {
+		if known[id] {
+			continue
+		}
+
+		remediation := "the rule sweeper removes them"
+		if depot[id] {
+			remediation = "restart the server to prune the depot directory, after which the rule sweeper removes them"
+		}
+
+		inconsistencies = append(inconsistencies, Inconsistency{
+			Kind:        OrphanedRules,
+			ID:          id,
+			Remediation: remediation,
+		})
+	}
+
+	return inconsistencies
+}
+
+func (c *Checker) checkInterfaces(containers []checkedContainer, hostInterfaces []string) []Inconsistency {
+	inconsistencies := []Inconsistency{}
+
+	host := toSet(hostInterfaces)
+	known := map[string]bool{}
+
+	for _, container := range containers {
+		if container.hostIface == "" {
+			continue
+		}
+
+		known[container.hostIface] = true
+
+		if !host[container.hostIface] {
+			inconsistencies = append(inconsistencies, Inconsistency{
+				Kind:        MissingInterface,
+				Handles:     []string{container.handle},
+				Resource:    container.hostIface,
+				Remediation: "POST /repair-network?handle=" + container.handle + " to rewire the container",
+			})
+		}
+	}
+
+	for _, name := range sortedSet(host) {
+		// only the host's end of a container's veth pair is ours
+		if !strings.HasPrefix(name, c.interfacePrefix) || !strings.HasSuffix(name, "-0") {
+			continue
+		}
+
+		if !known[name] {
+			inconsistencies = append(inconsistencies, Inconsistency{
+				Kind:        OrphanedInterface,
+				Resource:    name,
+				Remediation: "ip link delete " + name,
+			})
+		}
+	}
+
+	return inconsistencies
+}
+
+func (c *Checker) checkPools(containers []checkedContainer) []Inconsistency {
+	networks := map[string][]string{}
+	ports := map[string][]string{}
+	uids := map[string][]string{}
+
+	for _, container := range containers {
+		if container.resources == nil {
+			continue
+		}
+
+		if container.resources.Network != nil {
+			network := container.resources.Network.String()
+			networks[network] = append(networks[network], container.handle)
+		}
+
+		for _, port := range container.resources.Ports {
+			port := fmt.Sprintf("%d", port)
+			ports[port] = append(ports[port], container.handle)
+		}
+
+		uid := fmt.Sprintf("%d", container.resources.UID)
+		uids[uid] = append(uids[uid], container.handle)
+	}
+
+	inconsistencies := []Inconsistency{}
+
+	for _, resource := range []struct {
+		name      string
+		allocated map[string][]string
+		pool      ResourcePool
+	}{
+		{"network", networks, c.pools.Network},
+		{"port", ports, c.pools.Port},
+		{"uid", uids, c.pools.UID},
+	} {
+		inconsistencies = append(inconsistencies, checkDoubleAllocations(resource.name, resource.allocated)...)
+
+		if resource.pool != nil {
+			inconsistencies = append(inconsistencies, checkPool(resource.name, resource.allocated, resource.pool)...)
+		}
+	}
+
+	return inconsistencies
+}
+
+func checkDoubleAllocations(name string, allocated map[string][]string) []Inconsistency {
+	inconsistencies := []Inconsistency{}
+
+	for _, resource := range sortedKeys(allocated) {
+		handles := allocated[resource]
+		if len(handles) < 2 {
+			continue
+		}
+
+		sort.Strings(handles)
+
+		inconsistencies = append(inconsistencies, Inconsistency{
+			Kind:        DoubleAllocation,
+			Handles:     handles,
+			Resource:    name + " " + resource,
+			Remediation: "destroy all but one of the containers",
+		})
+	}
+
+	return inconsistencies
+}
+
+// checkPool compares how much of the pool is in use with what the
+// containers hold. The pools don't say which of their resources are in use,
+// only how many.
+func checkPool(name string, allocated map[string][]string, pool ResourcePool) []Inconsistency {
+	held := 0
+	for _, handles := range allocated {
+		held += len(handles)
+	}
+
+	inUse := pool.InitialSize() - pool.Available()
+
+	switch {
+	case inUse > held:
+		return []Inconsistency{{
+			Kind:        PoolLeak,
+			Resource:    name,
+			Count:       inUse - held,
+			Remediation: "restart the server, which rebuilds the pools from the containers it restores",
+		}}
+
+	case inUse < held:
+		return []Inconsistency{{
+			Kind:        PoolOvercommit,
+			Resource:    name,
+			Count:       held - inUse,
+			Remediation: "restart the server before the pool hands out what containers still hold",
+		}}
+	}
+
+	return nil
+}
+
+func toSet(list []string) map[string]bool {
+	set := map[string]bool{}
+	for _, item := range list {
+		set[item] = true
+	}
+
+	return set
+}
+
+func sortedSet(set map[string]bool) []string {
+	list := []string{}
+	for item := range set {
+		list = append(list, item)
+	}
+
+	sort.Strings(list)
+
+	return list
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Handler serves a consistency check of the cell as JSON on GET.
+type Handler struct {
+	logger  lager.Logger
+	checker *Checker
+}
+
+func New(logger lager.Logger, checker *Checker) *Handler {
+	return &Handler{
+		logger:  logger.Session("consistency"),
+		checker: checker,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, err := h.checker.Check()
+	if err != nil {
+		h.logger.Error("failed-to-check", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(report.Inconsistencies) > 0 {
+		h.logger.Info("found-inconsistencies", lager.Data{
+			"count": len(report.Inconsistencies),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,369 @@
+package consistency_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/consistency"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+type fakeBackend struct {
+	*fakes.FakeBackend
+
+	operations []linux_backend.Operation
+}
+
+func (b *fakeBackend) Operations() []linux_backend.Operation {
+	return b.operations
+}
+
+type checkedContainer struct {
+	*fakes.FakeContainer
+
+	id        string
+	resources *linux_backend.Resources
+
+	interfaces    linux_backend.ContainerNetworkInterfaces
+	interfacesErr error
+}
+
+func (c *checkedContainer) ID() string {
+	return c.id
+}
+
+func (c *checkedContainer) Resources() *linux_backend.Resources {
+	return c.resources
+}
+
+func (c *checkedContainer) NetworkInterfaces() (linux_backend.ContainerNetworkInterfaces, error) {
+	return c.interfaces, c.interfacesErr
+}
+
+type fakeContainerPool struct {
+	depotIDs []string
+	depotErr error
+
+	ruleIDs  []string
+	rulesErr error
+}
+
+func (p *fakeContainerPool) DepotIDs() ([]string, error) {
+	return p.depotIDs, p.depotErr
+}
+
+func (p *fakeContainerPool) RuleIDs() ([]string, error) {
+	return p.ruleIDs, p.rulesErr
+}
+
+type fakeResourcePool struct {
+	initialSize int
+	available   int
+}
+
+func (p *fakeResourcePool) InitialSize() int {
+	return p.initialSize
+}
+
+func (p *fakeResourcePool) Available() int {
+	return p.available
+}
+
+var _ = Describe("Consistency", func() {
+	var backend *fakeBackend
+	var containerPool *fakeContainerPool
+	var networkPool, portPool, uidPool *fakeResourcePool
+	var hostInterfaces []string
+	var interfacesErr error
+	var handler *consistency.Handler
+
+	newContainer := func(handle, id string, uid uint32, subnet string, ports []uint32) *checkedContainer {
+		fakeContainer := new(fakes.FakeContainer)
+		fakeContainer.HandleReturns(handle)
+
+		_, ipNet, err := net.ParseCIDR(subnet)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return &checkedContainer{
+			FakeContainer: fakeContainer,
+
+			id:        id,
+			resources: linux_backend.NewResources(uid, network.New(ipNet), ports),
+
+			interfaces: linux_backend.ContainerNetworkInterfaces{
+				HostIface: "w" + id + "-0",
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		backend = &fakeBackend{FakeBackend: new(fakes.FakeBackend)}
+
+		backend.ContainersReturns([]api.Container{
+			newContainer("handle-a", "id-a", 10000, "10.254.0.0/30", []uint32{61001}),
+			newContainer("handle-b", "id-b", 10001, "10.254.0.4/30", []uint32{61002, 61003}),
+		}, nil)
+
+		containerPool = &fakeContainerPool{
+			depotIDs: []string{"id-a", "id-b"},
+			ruleIDs:  []string{"id-a", "id-b"},
+		}
+
+		networkPool = &fakeResourcePool{initialSize: 64, available: 62}
+		portPool = &fakeResourcePool{initialSize: 100, available: 97}
+		uidPool = &fakeResourcePool{initialSize: 256, available: 254}
+
+		hostInterfaces = []string{"lo", "eth0", "wid-a-0", "wid-b-0"}
+		interfacesErr = nil
+
+		handler = consistency.New(
+			lagertest.NewTestLogger("test"),
+			consistency.NewChecker(
+				lagertest.NewTestLogger("test"),
+				backend,
+				containerPool,
+				consistency.Pools{
+					Network: networkPool,
+					Port:    portPool,
+					UID:     uidPool,
+				},
+				func() ([]string, error) {
+					return hostInterfaces, interfacesErr
+				},
+				"w",
+			),
+		)
+	})
+
+	request := func(method string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+
+		request, err := http.NewRequest(method, "/consistency", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	report := func() consistency.Report {
+		response := request("GET")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+		var report consistency.Report
+		err := json.NewDecoder(response.Body).Decode(&report)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return report
+	}
+
+	Context("when everything agrees", func() {
+		It("reports no inconsistencies", func() {
+			Ω(report()).Should(Equal(consistency.Report{
+				Containers:      2,
+				Inconsistencies: []consistency.Inconsistency{},
+			}))
+		})
+	})
+
+	It("reports the operations in flight", func() {
+		backend.operations = []linux_backend.Operation{{ID: "create-1", Kind: "create"}}
+
+		Ω(report().OperationsInFlight).Should(Equal(1))
+	})
+
+	It("reports depot directories that no container has", func() {
+		containerPool.depotIDs = append(containerPool.depotIDs, "id-c")
+
+		Ω(report().Inconsistencies).Should(Equal([]consistency.Inconsistency{
+			{
+				Kind:        consistency.OrphanedDepotDirectory,
+				ID:          "id-c",
+				Remediation: "restart the server, which prunes depot directories that no container has",
+			},
+		}))
+	})
+
+	It("reports containers whose depot directories are gone", func() {
+		containerPool.depotIDs = []string{"id-a"}
+
+		Ω(report().Inconsistencies).Should(Equal([]consistency.Inconsistency{
+			{
+				Kind:        consistency.MissingDepotDirectory,
+				Handles:     []string{"handle-b"},
+				ID:          "id-b",
+				Remediation: "destroy the container; it can no longer be run",
+			},
+		}))
+	})
+
+	It("reports rules that no container has, and whether the sweeper will get them", func() {
+		containerPool.ruleIDs = append(containerPool.ruleIDs, "id-c", "id-d")
+		containerPool.depotIDs = append(containerPool.depotIDs, "id-d")
+
+		inconsistencies := report().Inconsistencies
+
+		Ω(inconsistencies).Should(ContainElement(consistency.Inconsistency{
+			Kind:        consistency.OrphanedRules,
+			ID:          "id-c",
+			Remediation: "the rule sweeper removes them",
+		}))
+
+		Ω(inconsistencies).Should(ContainElement(consistency.Inconsistency{
+			Kind:        consistency.OrphanedRules,
+			ID:          "id-d",
+			Remediation: "restart the server to prune the depot directory, after which the rule sweeper removes them",
+		}))
+	})
+
+	It("reports containers without rules", func() {
+		containerPool.ruleIDs = []string{"id-b"}
+
+		Ω(report().Inconsistencies).Should(Equal([]consistency.Inconsistency{
+			{
+				Kind:        consistency.MissingRules,
+				Handles:     []string{"handle-a"},
+				ID:          "id-a",
+				Remediation: "restart the server, which sets up restored containers' rules again, or destroy the container",
+			},
+		}))
+	})
+
+	It("reports containers' host interfaces that no container has", func() {
+		hostInterfaces = append(hostInterfaces, "wid-c-0", "wid-c-1", "docker0")
+
+		Ω(report().Inconsistencies).Should(Equal([]consistency.Inconsistency{
+			{
+				Kind:        consistency.OrphanedInterface,
+				Resource:    "wid-c-0",
+				Remediation: "ip link delete wid-c-0",
+			},
+		}))
+	})
+
+	It("reports containers whose host interfaces are gone", func() {
+		hostInterfaces = []string{"lo", "wid-a-0"}
+
+		Ω(report().Inconsistencies).Should(Equal([]consistency.Inconsistency{
+			{
+				Kind:        consistency.MissingInterface,
+				Handles:     []string{"handle-b"},
+				Resource:    "wid-b-0",
+				Remediation: "POST /repair-network?handle=handle-b to rewire the container",
+			},
+		}))
+	})
+
+	It("reports resources held by more than one container", func() {
+		containers, _ := backend.Containers(nil)
+		backend.ContainersReturns(append(
+			containers,
+			newContainer("handle-c", "id-c", 10000, "10.254.0.4/30", []uint32{61003}),
+		), nil)
+
+		containerPool.depotIDs = append(containerPool.depotIDs, "id-c")
+		containerPool.ruleIDs = append(containerPool.ruleIDs, "id-c")
+		hostInterfaces = append(hostInterfaces, "wid-c-0")
+
+		networkPool.available = 61
+		portPool.available = 96
+		uidPool.available = 253
+
+		Ω(report().Inconsistencies).Should(Equal([]consistency.Inconsistency{
+			{
+				Kind:        consistency.DoubleAllocation,
+				Handles:     []string{"handle-b", "handle-c"},
+				Resource:    "network 10.254.0.4/30",
+				Remediation: "destroy all but one of the containers",
+			},
+			{
+				Kind:        consistency.DoubleAllocation,
+				Handles:     []string{"handle-b", "handle-c"},
+				Resource:    "port 61003",
+				Remediation: "destroy all but one of the containers",
+			},
+			{
+				Kind:        consistency.DoubleAllocation,
+				Handles:     []string{"handle-a", "handle-c"},
+				Resource:    "uid 10000",
+				Remediation: "destroy all but one of the containers",
+			},
+		}))
+	})
+
+	It("reports pools with more in use than containers hold", func() {
+		portPool.available = 90
+
+		Ω(report().Inconsistencies).Should(Equal([]consistency.Inconsistency{
+			{
+				Kind:        consistency.PoolLeak,
+				Resource:    "port",
+				Count:       7,
+				Remediation: "restart the server, which rebuilds the pools from the containers it restores",
+			},
+		}))
+	})
+
+	It("reports pools with less in use than containers hold", func() {
+		uidPool.available = 255
+
+		Ω(report().Inconsistencies).Should(Equal([]consistency.Inconsistency{
+			{
+				Kind:        consistency.PoolOvercommit,
+				Resource:    "uid",
+				Count:       1,
+				Remediation: "restart the server before the pool hands out what containers still hold",
+			},
+		}))
+	})
+
+	Context("when a container's interfaces can't be read", func() {
+		BeforeEach(func() {
+			containers, _ := backend.Containers(nil)
+			containers[1].(*checkedContainer).interfacesErr = errors.New("oh no!")
+
+			hostInterfaces = []string{"wid-a-0"}
+		})
+
+		It("skips checking its host interface", func() {
+			Ω(report().Inconsistencies).Should(BeEmpty())
+		})
+	})
+
+	Context("when listing the rules fails", func() {
+		BeforeEach(func() {
+			containerPool.rulesErr = errors.New("oh no!")
+		})
+
+		It("responds with 500", func() {
+			Ω(request("GET").Code).Should(Equal(http.StatusInternalServerError))
+		})
+	})
+
+	Context("when listing the host's interfaces fails", func() {
+		BeforeEach(func() {
+			interfacesErr = errors.New("oh no!")
+		})
+
+		It("responds with 500", func() {
+			Ω(request("GET").Code).Should(Equal(http.StatusInternalServerError))
+		})
+	})
+
+	It("only allows GET", func() {
+		response := request("POST")
+		Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+		Ω(response.Header().Get("Allow")).Should(Equal("GET"))
+	})
+})
@@ -0,0 +1,179 @@
+package egress_rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/pivotal-golang/lager"
+)
+
+// Rule allows traffic from every container to Network (a CIDR block or a
+// single address; anywhere if empty) over Protocol ("tcp", "udp", "icmp" or
+// "all"; "all" if empty), optionally limited to Ports ("443" or "8000-8080";
+// tcp and udp only). Matching packets are logged first if Log is set.
+type Rule struct {
+	Network  string `json:"network"`
+	Ports    string `json:"ports"`
+	Protocol string `json:"protocol"`
+	Log      bool   `json:"log"`
+}
+
+type InvalidRuleError struct {
+	Index  int
+	Reason string
+}
+
+func (e InvalidRuleError) Error() string {
+	return fmt.Sprintf("invalid egress rule %d: %s", e.Index, e.Reason)
+}
+
+// Load reads a JSON array of rules from path, validating every one of them.
+func Load(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var rules []Rule
+
+	err = json.NewDecoder(file).Decode(&rules)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, rule := range rules {
+		err := rule.validate()
+		if err != nil {
+			return nil, InvalidRuleError{Index: i, Reason: err.Error()}
+		}
+	}
+
+	return rules, nil
+}
+
+func (rule Rule) validate() error {
+	if rule.Network != "" && net.ParseIP(rule.Network) == nil {
+		_, _, err := net.ParseCIDR(rule.Network)
+		if err != nil {
+			return fmt.Errorf("network %q is not an address or CIDR block", rule.Network)
+		}
+	}
+
+	switch rule.Protocol {
+	case "", "all", "icmp":
+		if rule.Ports != "" {
+			return fmt.Errorf("ports require protocol tcp or udp")
+		}
+	case "tcp", "udp":
+	default:
+		return fmt.Errorf("unknown protocol %q", rule.Protocol)
+	}
+
+	if rule.Ports == "" {
+		return nil
+	}
+
+	bounds := strings.SplitN(rule.Ports, "-", 2)
+	for _, bound := range bounds {
+		port, err := strconv.ParseUint(bound, 10, 16)
+		if err != nil || port == 0 {
+			return fmt.Errorf("invalid ports %q", rule.Ports)
+		}
+	}
+
+	return nil
+}
+
+func (rule Rule) matchers() []string {
+	var args []string
+
+	if rule.Network != "" {
+		args = append(args, "--destination", rule.Network)
+	}
+
+	if rule.Protocol != "" && rule.Protocol != "all" {
+		args = append(args, "--protocol", rule.Protocol)
+	}
+
+	if rule.Ports != "" {
+		args = append(args, "--destination-port", strings.Replace(rule.Ports, "-", ":", 1))
+	}
+
+	return args
+}
+
+// Loader keeps an iptables chain, jumped to from the filter chain shared by
+// every container, in sync with the rules in a file. Traffic matching a rule
+// is accepted; anything else carries on to the allowed and denied networks.
+type Loader struct {
+	logger lager.Logger
+	path   string
+	chain  string
+	runner command_runner.CommandRunner
+}
+
+func New(logger lager.Logger, path string, chain string, runner command_runner.CommandRunner) *Loader {
+	return &Loader{
+		logger: logger.Session("egress-rules"),
+		path:   path,
+		chain:  chain,
+		runner: runner,
+	}
+}
+
+// Reload reads the rules file and replaces the chain's rules with its
+// contents. The chain is replaced in one iptables-restore, so containers
+// never see it partly filled. If the file cannot be read or contains an
+// invalid rule, the chain is left as it was.
+func (l *Loader) Reload() error {
+	rLog := l.logger.Session("reload", lager.Data{
+		"path": l.path,
+	})
+
+	rules, err := Load(l.path)
+	if err != nil {
+		rLog.Error("failed-to-load", err)
+		return err
+	}
+
+	// declaring the chain flushes it; --noflush leaves the table's other
+	// chains alone
+	restore := new(bytes.Buffer)
+	fmt.Fprintf(restore, "*filter\n:%s - [0:0]\n", l.chain)
+
+	for _, rule := range rules {
+		appendRule := append([]string{"-A", l.chain}, rule.matchers()...)
+
+		if rule.Log {
+			fmt.Fprintln(restore, strings.Join(append(appendRule, "--jump", "LOG", "--log-prefix", `"`+l.chain+` "`), " "))
+		}
+
+		fmt.Fprintln(restore, strings.Join(append(appendRule, "--jump", "ACCEPT"), " "))
+	}
+
+	fmt.Fprintln(restore, "COMMIT")
+
+	iptablesRestore := exec.Command("iptables-restore", "--noflush")
+	iptablesRestore.Stdin = restore
+
+	err = l.runner.Run(iptablesRestore)
+	if err != nil {
+		rLog.Error("failed-to-restore", err)
+		return err
+	}
+
+	rLog.Info("reloaded", lager.Data{
+		"rules": len(rules),
+	})
+
+	return nil
+}
@@ -0,0 +1,13 @@
+package egress_rules_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestEgressRules(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Egress Rules Suite")
+}
@@ -0,0 +1,177 @@
+package egress_rules_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/egress_rules"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Egress rules", func() {
+	var rulesFile string
+
+	BeforeEach(func() {
+		file, err := ioutil.TempFile("", "egress-rules")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		rulesFile = file.Name()
+		file.Close()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(rulesFile)
+	})
+
+	writeRules := func(contents string) {
+		err := ioutil.WriteFile(rulesFile, []byte(contents), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	Describe("Load", func() {
+		It("reads every rule from the file", func() {
+			writeRules(`[
+				{"network": "10.0.0.0/8", "ports": "8000-8080", "protocol": "tcp", "log": true},
+				{"network": "8.8.8.8", "protocol": "udp"},
+				{"protocol": "icmp"}
+			]`)
+
+			rules, err := egress_rules.Load(rulesFile)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rules).Should(Equal([]egress_rules.Rule{
+				{Network: "10.0.0.0/8", Ports: "8000-8080", Protocol: "tcp", Log: true},
+				{Network: "8.8.8.8", Protocol: "udp"},
+				{Protocol: "icmp"},
+			}))
+		})
+
+		It("returns an error when the file is not valid JSON", func() {
+			writeRules(`[{`)
+
+			_, err := egress_rules.Load(rulesFile)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("returns an error when the file does not exist", func() {
+			_, err := egress_rules.Load("/does/not/exist")
+			Ω(err).Should(HaveOccurred())
+		})
+
+		for rule, reason := range map[string]string{
+			`{"network": "banana"}`:                   `network "banana" is not an address or CIDR block`,
+			`{"protocol": "sctp"}`:                    `unknown protocol "sctp"`,
+			`{"ports": "80"}`:                         "ports require protocol tcp or udp",
+			`{"protocol": "icmp", "ports": "80"}`:     "ports require protocol tcp or udp",
+			`{"protocol": "tcp", "ports": "0"}`:       `invalid ports "0"`,
+			`{"protocol": "tcp", "ports": "70000"}`:   `invalid ports "70000"`,
+			`{"protocol": "tcp", "ports": "80-http"}`: `invalid ports "80-http"`,
+			`{"protocol": "udp", "ports": "1-2-3"}`:   `invalid ports "1-2-3"`,
+		} {
+			invalidRule := rule
+			expectedReason := reason
+
+			It("rejects "+invalidRule, func() {
+				writeRules(`[{"protocol": "tcp"}, ` + invalidRule + `]`)
+
+				_, err := egress_rules.Load(rulesFile)
+				Ω(err).Should(Equal(egress_rules.InvalidRuleError{
+					Index:  1,
+					Reason: expectedReason,
+				}))
+			})
+		}
+	})
+
+	Describe("Reload", func() {
+		var fakeRunner *fake_command_runner.FakeCommandRunner
+		var loader *egress_rules.Loader
+
+		BeforeEach(func() {
+			fakeRunner = fake_command_runner.New()
+			loader = egress_rules.New(lagertest.NewTestLogger("test"), rulesFile, "w-0-egress", fakeRunner)
+		})
+
+		It("replaces the chain's rules with the file's in one iptables-restore", func() {
+			writeRules(`[
+				{"network": "10.0.0.0/8", "ports": "8000-8080", "protocol": "tcp", "log": true},
+				{"network": "8.8.8.8", "protocol": "udp", "ports": "53"},
+				{"protocol": "all"}
+			]`)
+
+			var restored string
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "iptables-restore",
+			}, func(cmd *exec.Cmd) error {
+				input, err := ioutil.ReadAll(cmd.Stdin)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				restored = string(input)
+
+				return nil
+			})
+
+			err := loader.Reload()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "iptables-restore",
+					Args: []string{"--noflush"},
+				},
+			))
+
+			Ω(fakeRunner.ExecutedCommands()).Should(HaveLen(1))
+
+			Ω(restored).Should(Equal(`*filter
+:w-0-egress - [0:0]
+-A w-0-egress --destination 10.0.0.0/8 --protocol tcp --destination-port 8000:8080 --jump LOG --log-prefix "w-0-egress "
+-A w-0-egress --destination 10.0.0.0/8 --protocol tcp --destination-port 8000:8080 --jump ACCEPT
+-A w-0-egress --destination 8.8.8.8 --protocol udp --destination-port 53 --jump ACCEPT
+-A w-0-egress --jump ACCEPT
+COMMIT
+`))
+		})
+
+		Context("when the file contains an invalid rule", func() {
+			BeforeEach(func() {
+				writeRules(`[{"protocol": "sctp"}]`)
+			})
+
+			It("returns the error and leaves the chain alone", func() {
+				err := loader.Reload()
+				Ω(err).Should(Equal(egress_rules.InvalidRuleError{
+					Index:  0,
+					Reason: `unknown protocol "sctp"`,
+				}))
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+		})
+
+		Context("when iptables-restore fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				writeRules(`[{"protocol": "all"}]`)
+
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: "iptables-restore",
+				}, func(*exec.Cmd) error {
+					return disaster
+				})
+			})
+
+			It("returns the error", func() {
+				err := loader.Reload()
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+})
@@ -0,0 +1,53 @@
+package old
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var defaultContainerEnvFile = flag.String(
+	"defaultContainerEnvFile",
+	"",
+	"file of KEY=VALUE lines, e.g. proxy settings, given to every container's processes beneath the container's, rootfs's and process's own environment; blank lines and lines starting with # are ignored",
+)
+
+type InvalidEnvLineError struct {
+	Path string
+	Line int
+}
+
+func (e InvalidEnvLineError) Error() string {
+	return fmt.Sprintf("invalid environment variable at %s:%d", e.Path, e.Line)
+}
+
+// loadEnvFile reads the KEY=VALUE lines of an environment file. Values are
+// taken as given, so may contain commas, spaces and further = signs.
+func loadEnvFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	env := []string{}
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		if strings.Index(entry, "=") < 1 {
+			return nil, InvalidEnvLineError{path, line}
+		}
+
+		env = append(env, entry)
+	}
+
+	return env, scanner.Err()
+}
@@ -0,0 +1,247 @@
+package error_codes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
+)
+
+type Code string
+
+const (
+	PoolExhausted     Code = "pool_exhausted"
+	HandleExists      Code = "handle_exists"
+	UnknownHandle     Code = "unknown_handle"
+	RootFSFetchFailed Code = "rootfs_fetch_failed"
+	RootFSNotAllowed  Code = "rootfs_not_allowed"
+	InvalidProperty   Code = "invalid_property"
+	Draining          Code = "draining"
+	LimitViolation    Code = "limit_violation"
+	NetworkError      Code = "network_error"
+
+	// SetupFailed is a create that failed after the container's resources
+	// were acquired; they are released again, so it can be retried
+	SetupFailed Code = "setup_failed"
+)
+
+// CodedError carries an error's code alongside it. Its message is the
+// error's own unless Prefixed, in which case it is prefixed with the code,
+// e.g. "[pool_exhausted] network pool is exhausted".
+//
+// The garden protocol carries only an error's message, so for a client to
+// see the code it has to travel in it; CodeOf recovers it on the other side.
+type CodedError struct {
+	Code     Code
+	Err      error
+	Prefixed bool
+}
+
+func (e CodedError) Error() string {
+	if !e.Prefixed {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("[%s] %s", e.Code, e.Err)
+}
+
+// RequestError appends the id of the request that failed to the error's
+// message, so that it can be found in the backend's logs.
+type RequestError struct {
+	RequestID string
+	Err       error
+}
+
+func (e RequestError) Error() string {
+	return fmt.Sprintf("%s (request %s)", e.Err, e.RequestID)
+}
+
+// CodeOf returns the code of an error coded by the backend, or the code an
+// error's message received over the wire was prefixed with, if any.
+func CodeOf(err error) (Code, bool) {
+	switch e := err.(type) {
+	case CodedError:
+		return e.Code, true
+	case RequestError:
+		return CodeOf(e.Err)
+	}
+
+	message := err.Error()
+
+	if !strings.HasPrefix(message, "[") {
+		return "", false
+	}
+
+	end := strings.Index(message, "] ")
+	if end == -1 {
+		return "", false
+	}
+
+	return Code(message[1:end]), true
+}
+
+// Classify returns the code of the backend's own errors.
+func Classify(err error) (Code, bool) {
+	switch err.(type) {
+	case network_pool.PoolExhaustedError, port_pool.PoolExhaustedError, uid_pool.PoolExhaustedError:
+		return PoolExhausted, true
+	case linux_backend.HandleExistsError:
+		return HandleExists, true
+	case linux_backend.UnknownHandleError:
+		return UnknownHandle, true
+	case container_pool.ProvideRootFSError:
+		return RootFSFetchFailed, true
+	case container_pool.RootFSNotAllowedError:
+		return RootFSNotAllowed, true
+	case container_pool.InvalidPropertyError:
+		return InvalidProperty, true
+	case container_pool.SetupFailedError, linux_backend.StartFailedError:
+		return SetupFailed, true
+	}
+
+	if err == linux_backend.ErrDraining {
+		return Draining, true
+	}
+
+	return "", false
+}
+
+// NewBackend codes the errors returned by the backend and its containers.
+// Errors from setting limits or mapping ports are coded as limit violations
+// or network errors, unless they are more specific.
+//
+// Only if prefix is set are the codes prefixed to the errors' messages,
+// which is how clients see them; otherwise messages are left as they were.
+// Errors without a code are returned as they are. A failed create's error
+// also names the request, if the spec gave its id.
+func NewBackend(backend api.Backend, prefix bool) api.Backend {
+	return &codedBackend{backend, prefix}
+}
+
+func withCode(err error, prefix bool) error {
+	return withDefaultCode(err, "", prefix)
+}
+
+func withDefaultCode(err error, code Code, prefix bool) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := err.(CodedError); ok {
+		return err
+	}
+
+	classified, ok := Classify(err)
+	if ok {
+		return CodedError{classified, err, prefix}
+	}
+
+	if code != "" {
+		return CodedError{code, err, prefix}
+	}
+
+	return err
+}
+
+type codedBackend struct {
+	api.Backend
+
+	prefix bool
+}
+
+func (b *codedBackend) Create(spec api.ContainerSpec) (api.Container, error) {
+	container, err := b.Backend.Create(spec)
+	if err != nil {
+		err = withCode(err, b.prefix)
+
+		if requestID := spec.Properties[linux_backend.RequestIDProperty]; requestID != "" {
+			err = RequestError{requestID, err}
+		}
+
+		return nil, err
+	}
+
+	return &codedContainer{container, b.prefix}, nil
+}
+
+func (b *codedBackend) Destroy(handle string) error {
+	return withCode(b.Backend.Destroy(handle), b.prefix)
+}
+
+func (b *codedBackend) Containers(filter api.Properties) ([]api.Container, error) {
+	containers, err := b.Backend.Containers(filter)
+	if err != nil {
+		return nil, withCode(err, b.prefix)
+	}
+
+	coded := []api.Container{}
+	for _, container := range containers {
+		coded = append(coded, &codedContainer{container, b.prefix})
+	}
+
+	return coded, nil
+}
+
+func (b *codedBackend) Lookup(handle string) (api.Container, error) {
+	container, err := b.Backend.Lookup(handle)
+	if err != nil {
+		return nil, withCode(err, b.prefix)
+	}
+
+	return &codedContainer{container, b.prefix}, nil
+}
+
+// the backend only knows the grace time of its own containers
+func (b *codedBackend) GraceTime(container api.Container) time.Duration {
+	if coded, ok := container.(*codedContainer); ok {
+		container = coded.Container
+	}
+
+	return b.Backend.GraceTime(container)
+}
+
+type codedContainer struct {
+	api.Container
+
+	prefix bool
+}
+
+func (c *codedContainer) Unwrap() api.Container {
+	return c.Container
+}
+
+func (c *codedContainer) LimitBandwidth(limits api.BandwidthLimits) error {
+	return withDefaultCode(c.Container.LimitBandwidth(limits), LimitViolation, c.prefix)
+}
+
+func (c *codedContainer) LimitCPU(limits api.CPULimits) error {
+	return withDefaultCode(c.Container.LimitCPU(limits), LimitViolation, c.prefix)
+}
+
+func (c *codedContainer) LimitDisk(limits api.DiskLimits) error {
+	return withDefaultCode(c.Container.LimitDisk(limits), LimitViolation, c.prefix)
+}
+
+func (c *codedContainer) LimitMemory(limits api.MemoryLimits) error {
+	return withDefaultCode(c.Container.LimitMemory(limits), LimitViolation, c.prefix)
+}
+
+func (c *codedContainer) NetIn(hostPort, containerPort uint32) (uint32, uint32, error) {
+	hostPort, containerPort, err := c.Container.NetIn(hostPort, containerPort)
+	if err != nil {
+		return 0, 0, withDefaultCode(err, NetworkError, c.prefix)
+	}
+
+	return hostPort, containerPort, nil
+}
+
+func (c *codedContainer) NetOut(network string, port uint32) error {
+	return withDefaultCode(c.Container.NetOut(network, port), NetworkError, c.prefix)
+}
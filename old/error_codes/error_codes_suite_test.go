@@ -0,0 +1,13 @@
+package error_codes_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestErrorCodes(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Error Codes Suite")
+}
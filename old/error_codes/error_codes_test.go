@@ -0,0 +1,194 @@
+package error_codes_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/error_codes"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+var _ = Describe("Error codes", func() {
+	var fakeBackend *fakes.FakeBackend
+	var fakeContainer *fakes.FakeContainer
+	var backend api.Backend
+
+	BeforeEach(func() {
+		fakeBackend = new(fakes.FakeBackend)
+		fakeContainer = new(fakes.FakeContainer)
+
+		fakeBackend.CreateReturns(fakeContainer, nil)
+		fakeBackend.LookupReturns(fakeContainer, nil)
+
+		backend = error_codes.NewBackend(fakeBackend, true)
+	})
+
+	itCodes := func(description string, err error, code error_codes.Code) {
+		It("codes "+description+" as "+string(code), func() {
+			classified, ok := error_codes.Classify(err)
+			Ω(ok).Should(BeTrue())
+			Ω(classified).Should(Equal(code))
+		})
+	}
+
+	itCodes("network pool exhaustion", network_pool.PoolExhaustedError{}, error_codes.PoolExhausted)
+	itCodes("port pool exhaustion", port_pool.PoolExhaustedError{}, error_codes.PoolExhausted)
+	itCodes("uid pool exhaustion", uid_pool.PoolExhaustedError{}, error_codes.PoolExhausted)
+	itCodes("a taken handle", linux_backend.HandleExistsError{Handle: "foo"}, error_codes.HandleExists)
+	itCodes("an unknown handle", linux_backend.UnknownHandleError{Handle: "foo"}, error_codes.UnknownHandle)
+	itCodes("failing to provide a rootfs", container_pool.ProvideRootFSError{Err: errors.New("oh no!")}, error_codes.RootFSFetchFailed)
+	itCodes("a disallowed rootfs", container_pool.RootFSNotAllowedError{RootFSPath: "/foo"}, error_codes.RootFSNotAllowed)
+	itCodes("an invalid property", container_pool.InvalidPropertyError{Property: "foo"}, error_codes.InvalidProperty)
+	itCodes("draining", linux_backend.ErrDraining, error_codes.Draining)
+	itCodes("failing to set up a container", container_pool.SetupFailedError{Err: errors.New("oh no!")}, error_codes.SetupFailed)
+	itCodes("failing to start a container", linux_backend.StartFailedError{Handle: "foo", Err: errors.New("oh no!")}, error_codes.SetupFailed)
+
+	It("does not code other errors", func() {
+		_, ok := error_codes.Classify(errors.New("oh no!"))
+		Ω(ok).Should(BeFalse())
+	})
+
+	Describe("the backend", func() {
+		It("prefixes its errors' messages with their code", func() {
+			fakeBackend.CreateReturns(nil, network_pool.PoolExhaustedError{})
+
+			_, err := backend.Create(api.ContainerSpec{})
+			Ω(err.Error()).Should(Equal("[pool_exhausted] network pool is exhausted"))
+		})
+
+		Context("when a create with a request id fails", func() {
+			It("includes the request id in the error", func() {
+				fakeBackend.CreateReturns(nil, network_pool.PoolExhaustedError{})
+
+				_, err := backend.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.RequestIDProperty: "some-request-id",
+					},
+				})
+				Ω(err.Error()).Should(Equal("[pool_exhausted] network pool is exhausted (request some-request-id)"))
+
+				code, ok := error_codes.CodeOf(err)
+				Ω(ok).Should(BeTrue())
+				Ω(code).Should(Equal(error_codes.PoolExhausted))
+			})
+		})
+
+		Context("when not asked to prefix codes", func() {
+			BeforeEach(func() {
+				backend = error_codes.NewBackend(fakeBackend, false)
+			})
+
+			It("leaves its errors' messages as they are, but still codes them", func() {
+				fakeBackend.LookupReturns(nil, linux_backend.UnknownHandleError{Handle: "some-handle"})
+
+				_, err := backend.Lookup("some-handle")
+				Ω(err.Error()).Should(Equal("unknown handle: some-handle"))
+
+				code, ok := error_codes.CodeOf(err)
+				Ω(ok).Should(BeTrue())
+				Ω(code).Should(Equal(error_codes.UnknownHandle))
+			})
+
+			It("leaves its containers' errors' messages as they are", func() {
+				fakeContainer.LimitMemoryReturns(errors.New("oh no!"))
+
+				container, err := backend.Lookup("some-handle")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.LimitMemory(api.MemoryLimits{LimitInBytes: 1})
+				Ω(err.Error()).Should(Equal("oh no!"))
+
+				code, ok := error_codes.CodeOf(err)
+				Ω(ok).Should(BeTrue())
+				Ω(code).Should(Equal(error_codes.LimitViolation))
+			})
+		})
+
+		It("leaves errors without a code as they are", func() {
+			disaster := errors.New("oh no!")
+			fakeBackend.DestroyReturns(disaster)
+
+			Ω(backend.Destroy("some-handle")).Should(Equal(disaster))
+		})
+
+		It("codes looking up an unknown handle", func() {
+			fakeBackend.LookupReturns(nil, linux_backend.UnknownHandleError{Handle: "some-handle"})
+
+			_, err := backend.Lookup("some-handle")
+
+			code, ok := error_codes.CodeOf(err)
+			Ω(ok).Should(BeTrue())
+			Ω(code).Should(Equal(error_codes.UnknownHandle))
+		})
+
+		It("can have its containers' grace time looked up", func() {
+			fakeBackend.GraceTimeReturns(time.Minute)
+
+			container, err := backend.Lookup("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(backend.GraceTime(container)).Should(Equal(time.Minute))
+			Ω(fakeBackend.GraceTimeArgsForCall(0)).Should(Equal(fakeContainer))
+		})
+	})
+
+	Describe("a container", func() {
+		var container api.Container
+
+		BeforeEach(func() {
+			var err error
+
+			container, err = backend.Lookup("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("codes failing to set a limit as a limit violation", func() {
+			fakeContainer.LimitMemoryReturns(errors.New("oh no!"))
+
+			err := container.LimitMemory(api.MemoryLimits{LimitInBytes: 1})
+			Ω(err.Error()).Should(Equal("[limit_violation] oh no!"))
+		})
+
+		It("codes failing to map a port as a network error", func() {
+			fakeContainer.NetInReturns(0, 0, errors.New("oh no!"))
+
+			_, _, err := container.NetIn(0, 0)
+			Ω(err.Error()).Should(Equal("[network_error] oh no!"))
+		})
+
+		It("keeps more specific codes", func() {
+			fakeContainer.NetInReturns(0, 0, port_pool.PoolExhaustedError{})
+
+			_, _, err := container.NetIn(0, 0)
+
+			code, _ := error_codes.CodeOf(err)
+			Ω(code).Should(Equal(error_codes.PoolExhausted))
+		})
+
+		It("returns nil when nothing fails", func() {
+			Ω(container.NetOut("1.2.3.4/32", 80)).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Describe("CodeOf", func() {
+		It("recovers the code from a message received over the wire", func() {
+			code, ok := error_codes.CodeOf(errors.New("[handle_exists] handle already exists: foo"))
+			Ω(ok).Should(BeTrue())
+			Ω(code).Should(Equal(error_codes.HandleExists))
+		})
+
+		It("reports messages without a code", func() {
+			_, ok := error_codes.CodeOf(errors.New("oh no!"))
+			Ω(ok).Should(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,182 @@
+package gateways
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+type Container interface {
+	NetworkInterfaces() (linux_backend.ContainerNetworkInterfaces, error)
+	NetworkStat() (linux_backend.ContainerNetworkStat, error)
+}
+
+type NetworkPool interface {
+	Network() *net.IPNet
+	InitialSize() int
+	Available() int
+}
+
+// Report is the utilisation of the network pool, and of each gateway that
+// containers reach the host through.
+type Report struct {
+	Network   string    `json:"network"`
+	Capacity  int       `json:"capacity"`
+	Available int       `json:"available"`
+	Gateways  []Gateway `json:"gateways"`
+}
+
+// Gateway is a shared bridge, or the host's end of a single container's veth
+// pair. Its stat is the total of its containers'.
+type Gateway struct {
+	Name       string                             `json:"name"`
+	IP         string                             `json:"ip"`
+	Subnet     string                             `json:"subnet"`
+	Containers []Attachment                       `json:"containers"`
+	Stat       linux_backend.ContainerNetworkStat `json:"stat"`
+}
+
+type Attachment struct {
+	Handle         string                             `json:"handle"`
+	IP             string                             `json:"ip"`
+	HostIface      string                             `json:"host_iface"`
+	ContainerIface string                             `json:"container_iface"`
+	Stat           linux_backend.ContainerNetworkStat `json:"stat"`
+}
+
+// Handler serves a report of the cell's gateways and the containers attached
+// to them as JSON.
+type Handler struct {
+	logger  lager.Logger
+	backend api.Client
+	pool    NetworkPool
+}
+
+func New(logger lager.Logger, backend api.Client, pool NetworkPool) *Handler {
+	return &Handler{
+		logger:  logger.Session("gateways"),
+		backend: backend,
+		pool:    pool,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	containers, err := h.backend.Containers(nil)
+	if err != nil {
+		h.logger.Error("failed-to-list-containers", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	gateways := map[string]*Gateway{}
+
+	for _, container := range containers {
+		attached, ok := container.(Container)
+		if !ok {
+			continue
+		}
+
+		// the container may have been destroyed since it was listed
+		interfaces, err := attached.NetworkInterfaces()
+		if err != nil {
+			h.logger.Error("failed-to-get-interfaces", err, lager.Data{
+				"handle": container.Handle(),
+			})
+
+			continue
+		}
+
+		stat, err := attached.NetworkStat()
+		if err != nil {
+			h.logger.Error("failed-to-get-stats", err, lager.Data{
+				"handle": container.Handle(),
+			})
+
+			continue
+		}
+
+		name := interfaces.Bridge
+		if name == "" {
+			name = interfaces.HostIface
+		}
+
+		gateway, found := gateways[name]
+		if !found {
+			gateway = &Gateway{
+				Name:       name,
+				IP:         interfaces.HostIP.String(),
+				Subnet:     interfaces.Subnet.String(),
+				Containers: []Attachment{},
+			}
+
+			gateways[name] = gateway
+		}
+
+		gateway.Containers = append(gateway.Containers, Attachment{
+			Handle:         container.Handle(),
+			IP:             interfaces.ContainerIP.String(),
+			HostIface:      interfaces.HostIface,
+			ContainerIface: interfaces.ContainerIface,
+			Stat:           stat,
+		})
+
+		gateway.Stat = add(gateway.Stat, stat)
+	}
+
+	report := Report{
+		Network:   h.pool.Network().String(),
+		Capacity:  h.pool.InitialSize(),
+		Available: h.pool.Available(),
+		Gateways:  []Gateway{},
+	}
+
+	for _, gateway := range gateways {
+		sort.Sort(byHandle(gateway.Containers))
+		report.Gateways = append(report.Gateways, *gateway)
+	}
+
+	sort.Sort(byName(report.Gateways))
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(report)
+}
+
+func add(a, b linux_backend.ContainerNetworkStat) linux_backend.ContainerNetworkStat {
+	return linux_backend.ContainerNetworkStat{
+		RxBytes:   a.RxBytes + b.RxBytes,
+		RxPackets: a.RxPackets + b.RxPackets,
+		RxDropped: a.RxDropped + b.RxDropped,
+
+		TxBytes:   a.TxBytes + b.TxBytes,
+		TxPackets: a.TxPackets + b.TxPackets,
+		TxDropped: a.TxDropped + b.TxDropped,
+
+		ForwardedBytes:   a.ForwardedBytes + b.ForwardedBytes,
+		ForwardedPackets: a.ForwardedPackets + b.ForwardedPackets,
+	}
+}
+
+type byName []Gateway
+
+func (g byName) Len() int           { return len(g) }
+func (g byName) Less(i, j int) bool { return g[i].Name < g[j].Name }
+func (g byName) Swap(i, j int)      { g[i], g[j] = g[j], g[i] }
+
+type byHandle []Attachment
+
+func (a byHandle) Len() int           { return len(a) }
+func (a byHandle) Less(i, j int) bool { return a[i].Handle < a[j].Handle }
+func (a byHandle) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
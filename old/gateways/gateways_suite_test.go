@@ -0,0 +1,13 @@
+package gateways_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestGateways(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Gateways Suite")
+}
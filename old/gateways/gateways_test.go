@@ -0,0 +1,202 @@
+package gateways_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/gateways"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+type attachedContainer struct {
+	*fakes.FakeContainer
+
+	interfaces    linux_backend.ContainerNetworkInterfaces
+	interfacesErr error
+
+	stat    linux_backend.ContainerNetworkStat
+	statErr error
+}
+
+func (c *attachedContainer) NetworkInterfaces() (linux_backend.ContainerNetworkInterfaces, error) {
+	return c.interfaces, c.interfacesErr
+}
+
+func (c *attachedContainer) NetworkStat() (linux_backend.ContainerNetworkStat, error) {
+	return c.stat, c.statErr
+}
+
+var _ = Describe("Gateways", func() {
+	var fakeBackend *fakes.FakeBackend
+	var pool *network_pool.RealNetworkPool
+	var handler *gateways.Handler
+
+	BeforeEach(func() {
+		_, ipNet, err := net.ParseCIDR("10.254.0.0/24")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		pool = network_pool.NewBridged(ipNet, net.ParseIP("10.254.0.1"))
+
+		_, err = pool.Acquire("some-handle")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fakeBackend = new(fakes.FakeBackend)
+		handler = gateways.New(lagertest.NewTestLogger("test"), fakeBackend, pool)
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+
+		request, err := http.NewRequest("GET", "/gateways", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	report := func() gateways.Report {
+		response := get()
+		Ω(response.Code).Should(Equal(http.StatusOK))
+
+		var report gateways.Report
+		err := json.NewDecoder(response.Body).Decode(&report)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return report
+	}
+
+	newContainer := func(handle string, bridge string, ip string, stat linux_backend.ContainerNetworkStat) *attachedContainer {
+		fakeContainer := new(fakes.FakeContainer)
+		fakeContainer.HandleReturns(handle)
+
+		_, subnet, err := net.ParseCIDR("10.254.0.0/24")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return &attachedContainer{
+			FakeContainer: fakeContainer,
+			interfaces: linux_backend.ContainerNetworkInterfaces{
+				HostIface:      handle + "-0",
+				ContainerIface: handle + "-1",
+				Bridge:         bridge,
+				HostIP:         net.ParseIP("10.254.0.1"),
+				ContainerIP:    net.ParseIP(ip),
+				Subnet:         subnet,
+			},
+			stat: stat,
+		}
+	}
+
+	It("reports the network pool's utilisation", func() {
+		r := report()
+
+		Ω(r.Network).Should(Equal("10.254.0.0/24"))
+		Ω(r.Capacity).Should(Equal(253))
+		Ω(r.Available).Should(Equal(252))
+		Ω(r.Gateways).Should(BeEmpty())
+	})
+
+	It("groups the containers by the bridge they are attached to, totalling their stats", func() {
+		fakeBackend.ContainersReturns([]api.Container{
+			newContainer("handle-b", "some-bridge", "10.254.0.3", linux_backend.ContainerNetworkStat{RxBytes: 1, TxBytes: 2}),
+			newContainer("handle-a", "some-bridge", "10.254.0.2", linux_backend.ContainerNetworkStat{RxBytes: 10, ForwardedPackets: 3}),
+		}, nil)
+
+		Ω(report().Gateways).Should(Equal([]gateways.Gateway{
+			{
+				Name:   "some-bridge",
+				IP:     "10.254.0.1",
+				Subnet: "10.254.0.0/24",
+				Containers: []gateways.Attachment{
+					{
+						Handle:         "handle-a",
+						IP:             "10.254.0.2",
+						HostIface:      "handle-a-0",
+						ContainerIface: "handle-a-1",
+						Stat:           linux_backend.ContainerNetworkStat{RxBytes: 10, ForwardedPackets: 3},
+					},
+					{
+						Handle:         "handle-b",
+						IP:             "10.254.0.3",
+						HostIface:      "handle-b-0",
+						ContainerIface: "handle-b-1",
+						Stat:           linux_backend.ContainerNetworkStat{RxBytes: 1, TxBytes: 2},
+					},
+				},
+				Stat: linux_backend.ContainerNetworkStat{RxBytes: 11, TxBytes: 2, ForwardedPackets: 3},
+			},
+		}))
+	})
+
+	Context("when the containers are not attached to a bridge", func() {
+		It("reports the host's end of each container's veth pair as its gateway", func() {
+			fakeBackend.ContainersReturns([]api.Container{
+				newContainer("handle-b", "", "10.254.0.6", linux_backend.ContainerNetworkStat{}),
+				newContainer("handle-a", "", "10.254.0.2", linux_backend.ContainerNetworkStat{}),
+			}, nil)
+
+			r := report()
+			Ω(r.Gateways).Should(HaveLen(2))
+
+			Ω(r.Gateways[0].Name).Should(Equal("handle-a-0"))
+			Ω(r.Gateways[0].Containers).Should(HaveLen(1))
+			Ω(r.Gateways[0].Containers[0].Handle).Should(Equal("handle-a"))
+
+			Ω(r.Gateways[1].Name).Should(Equal("handle-b-0"))
+			Ω(r.Gateways[1].Containers).Should(HaveLen(1))
+			Ω(r.Gateways[1].Containers[0].Handle).Should(Equal("handle-b"))
+		})
+	})
+
+	Context("when a container's interfaces or stats cannot be read", func() {
+		It("leaves it out", func() {
+			broken := newContainer("handle-a", "some-bridge", "10.254.0.2", linux_backend.ContainerNetworkStat{})
+			broken.interfacesErr = errors.New("oh no!")
+
+			unstattable := newContainer("handle-b", "some-bridge", "10.254.0.3", linux_backend.ContainerNetworkStat{})
+			unstattable.statErr = errors.New("oh no!")
+
+			fakeBackend.ContainersReturns([]api.Container{
+				broken,
+				unstattable,
+				newContainer("handle-c", "some-bridge", "10.254.0.4", linux_backend.ContainerNetworkStat{}),
+			}, nil)
+
+			r := report()
+			Ω(r.Gateways).Should(HaveLen(1))
+			Ω(r.Gateways[0].Containers).Should(HaveLen(1))
+			Ω(r.Gateways[0].Containers[0].Handle).Should(Equal("handle-c"))
+		})
+	})
+
+	Context("when the containers cannot be listed", func() {
+		It("fails", func() {
+			fakeBackend.ContainersReturns(nil, errors.New("oh no!"))
+
+			Ω(get().Code).Should(Equal(http.StatusInternalServerError))
+		})
+	})
+
+	Context("when the request is not a GET", func() {
+		It("is not allowed", func() {
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest("POST", "/gateways", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			handler.ServeHTTP(recorder, request)
+
+			Ω(recorder.Code).Should(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+})
@@ -0,0 +1,6 @@
+// +build btrfs
+
+package old
+
+// the btrfs graph driver needs the btrfs headers to build, so is opt-in
+import _ "github.com/docker/docker/daemon/graphdriver/btrfs"
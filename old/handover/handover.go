@@ -0,0 +1,200 @@
+package handover
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// ListenerFDEnv tells a re-executed server which of the file descriptors it
+// inherited is the API listener.
+const ListenerFDEnv = "GARDEN_LISTENER_FD"
+
+var ErrNotAFileListener = errors.New("listener has no file descriptor to hand over")
+
+// Listen listens on the address, unless the server was re-executed by Exec,
+// in which case it picks up the listener it was handed.
+func Listen(network, addr string) (net.Listener, error) {
+	if inherited := os.Getenv(ListenerFDEnv); inherited != "" {
+		os.Unsetenv(ListenerFDEnv)
+
+		fd, err := strconv.Atoi(inherited)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", ListenerFDEnv, inherited)
+		}
+
+		file := os.NewFile(uintptr(fd), "listener")
+		defer file.Close()
+
+		return net.FileListener(file)
+	}
+
+	if network == "unix" {
+		err := os.Remove(addr)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error deleting existing socket: %s", err)
+		}
+	}
+
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if network == "unix" {
+		os.Chmod(addr, 0777)
+	}
+
+	return listener, nil
+}
+
+// Exec re-executes the server's binary, which may have been replaced since
+// it was started, with the same arguments, handing it the listener. It only
+// returns if the exec fails.
+//
+// Connections made while the new binary starts up wait in the listener's
+// backlog rather than being refused.
+func Exec(listener net.Listener) error {
+	filer, ok := listener.(interface {
+		File() (*os.File, error)
+	})
+	if !ok {
+		return ErrNotAFileListener
+	}
+
+	file, err := filer.File()
+	if err != nil {
+		return err
+	}
+
+	fd := file.Fd()
+
+	// the duplicate is close-on-exec, like every other descriptor
+	_, _, errno := syscall.RawSyscall(syscall.SYS_FCNTL, fd, syscall.F_SETFD, 0)
+	if errno != 0 {
+		return errno
+	}
+
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return err
+	}
+
+	env := append(os.Environ(), fmt.Sprintf("%s=%d", ListenerFDEnv, fd))
+
+	return syscall.Exec(path, os.Args, env)
+}
+
+// Proxy passes connections accepted on the API listener through to the
+// garden server, which only serves on a listener of its own. Putting it in
+// front of the server lets the listener outlive the server for a handover.
+type Proxy struct {
+	logger lager.Logger
+
+	listener        net.Listener
+	upstreamNetwork string
+	upstreamAddr    string
+
+	paused  bool
+	serving chan struct{}
+	mutex   sync.Mutex
+}
+
+func NewProxy(logger lager.Logger, listener net.Listener, upstreamNetwork, upstreamAddr string) *Proxy {
+	return &Proxy{
+		logger: logger.Session("proxy"),
+
+		listener:        listener,
+		upstreamNetwork: upstreamNetwork,
+		upstreamAddr:    upstreamAddr,
+
+		serving: make(chan struct{}),
+	}
+}
+
+// Serve accepts connections until the proxy is paused.
+func (p *Proxy) Serve() error {
+	defer close(p.serving)
+
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			p.mutex.Lock()
+			paused := p.paused
+			p.mutex.Unlock()
+
+			if paused {
+				p.setDeadline(time.Time{})
+				return nil
+			}
+
+			p.logger.Error("failed-to-accept", err)
+			return err
+		}
+
+		// dial before accepting again, so that once paused every
+		// connection accepted has reached the server
+		upstream, err := net.Dial(p.upstreamNetwork, p.upstreamAddr)
+		if err != nil {
+			p.logger.Error("failed-to-dial-server", err)
+			conn.Close()
+			continue
+		}
+
+		go splice(conn, upstream)
+	}
+}
+
+// Pause stops accepting connections without closing the listener, and
+// returns once every connection accepted has reached the server. Those
+// made from then on wait in the listener's backlog.
+func (p *Proxy) Pause() {
+	p.mutex.Lock()
+	p.paused = true
+	p.mutex.Unlock()
+
+	p.setDeadline(time.Now())
+
+	<-p.serving
+
+	p.logger.Info("paused")
+}
+
+func (p *Proxy) setDeadline(deadline time.Time) {
+	if deadliner, ok := p.listener.(interface {
+		SetDeadline(time.Time) error
+	}); ok {
+		deadliner.SetDeadline(deadline)
+	}
+}
+
+func splice(conn, upstream net.Conn) {
+	go func() {
+		io.Copy(upstream, conn)
+		closeWrite(upstream)
+	}()
+
+	// the server closes its end once it is done with the connection, e.g.
+	// when the client has hung up or when it is stopping
+	io.Copy(conn, upstream)
+
+	conn.Close()
+	upstream.Close()
+}
+
+func closeWrite(conn net.Conn) {
+	if halfCloser, ok := conn.(interface {
+		CloseWrite() error
+	}); ok {
+		halfCloser.CloseWrite()
+	}
+}
@@ -0,0 +1,13 @@
+package handover_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestHandover(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Handover Suite")
+}
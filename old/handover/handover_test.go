@@ -0,0 +1,230 @@
+package handover_test
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/handover"
+)
+
+var _ = Describe("Handover", func() {
+	var tmpdir string
+
+	BeforeEach(func() {
+		var err error
+
+		tmpdir, err = ioutil.TempDir("", "handover")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	get := func(network, addr string) string {
+		conn, err := net.Dial(network, addr)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		defer conn.Close()
+
+		fmt.Fprintf(conn, "GET /ping HTTP/1.1\r\nHost: garden\r\nConnection: close\r\n\r\n")
+
+		response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		body, err := ioutil.ReadAll(response.Body)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return string(body)
+	}
+
+	Describe("Listen", func() {
+		It("listens on the address", func() {
+			addr := filepath.Join(tmpdir, "api.sock")
+
+			listener, err := handover.Listen("unix", addr)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			defer listener.Close()
+
+			_, err = net.Dial("unix", addr)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("replaces a stale socket", func() {
+			addr := filepath.Join(tmpdir, "api.sock")
+
+			err := ioutil.WriteFile(addr, []byte{}, 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			listener, err := handover.Listen("unix", addr)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			listener.Close()
+		})
+
+		Context("when a listener was handed over", func() {
+			var handedOver net.Listener
+
+			BeforeEach(func() {
+				var err error
+
+				handedOver, err = net.Listen("tcp", "127.0.0.1:0")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				file, err := handedOver.(*net.TCPListener).File()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				os.Setenv(handover.ListenerFDEnv, fmt.Sprintf("%d", file.Fd()))
+			})
+
+			AfterEach(func() {
+				handedOver.Close()
+				os.Unsetenv(handover.ListenerFDEnv)
+			})
+
+			It("picks it up instead of listening on the address", func() {
+				listener, err := handover.Listen("tcp", "this-is-not-an-address")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				defer listener.Close()
+
+				Ω(listener.Addr()).Should(Equal(handedOver.Addr()))
+			})
+
+			It("doesn't pass it on to the server's children", func() {
+				listener, err := handover.Listen("tcp", "this-is-not-an-address")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				listener.Close()
+
+				Ω(os.Getenv(handover.ListenerFDEnv)).Should(BeEmpty())
+			})
+		})
+
+		Context("when the handed over descriptor is invalid", func() {
+			BeforeEach(func() {
+				os.Setenv(handover.ListenerFDEnv, "three")
+			})
+
+			AfterEach(func() {
+				os.Unsetenv(handover.ListenerFDEnv)
+			})
+
+			It("returns an error", func() {
+				_, err := handover.Listen("tcp", "127.0.0.1:0")
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Proxy", func() {
+		var listener net.Listener
+		var upstreamAddr string
+		var upstream *http.Server
+		var upstreamListener net.Listener
+		var proxy *handover.Proxy
+
+		BeforeEach(func() {
+			var err error
+
+			upstreamAddr = filepath.Join(tmpdir, "server.sock")
+
+			upstreamListener, err = net.Listen("unix", upstreamAddr)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			upstream = &http.Server{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte("pong"))
+				}),
+			}
+
+			go upstream.Serve(upstreamListener)
+
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			proxy = handover.NewProxy(lagertest.NewTestLogger("test"), listener, "unix", upstreamAddr)
+
+			go proxy.Serve()
+		})
+
+		AfterEach(func() {
+			listener.Close()
+			upstreamListener.Close()
+		})
+
+		It("passes connections through to the server", func() {
+			Ω(get("tcp", listener.Addr().String())).Should(Equal("pong"))
+		})
+
+		Context("when paused", func() {
+			BeforeEach(func() {
+				proxy.Pause()
+			})
+
+			It("leaves connections waiting on the listener", func() {
+				conn, err := net.Dial("tcp", listener.Addr().String())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				conn.Close()
+
+				accepted, err := listener.Accept()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				accepted.Close()
+			})
+
+			It("can hand the listener to another proxy", func() {
+				file, err := listener.(*net.TCPListener).File()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				inherited, err := net.FileListener(file)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				defer inherited.Close()
+
+				go handover.NewProxy(lagertest.NewTestLogger("test"), inherited, "unix", upstreamAddr).Serve()
+
+				Ω(get("tcp", listener.Addr().String())).Should(Equal("pong"))
+			})
+		})
+
+		Context("when the server can't be reached", func() {
+			BeforeEach(func() {
+				upstreamListener.Close()
+			})
+
+			It("hangs up on the client", func() {
+				conn, err := net.Dial("tcp", listener.Addr().String())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = conn.Read(make([]byte, 1))
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Exec", func() {
+		It("fails for listeners without a file descriptor", func() {
+			err := handover.Exec(fakeListener{})
+			Ω(err).Should(Equal(handover.ErrNotAFileListener))
+		})
+	})
+})
+
+type fakeListener struct{}
+
+func (fakeListener) Accept() (net.Conn, error) { return nil, syscall.EINVAL }
+func (fakeListener) Close() error              { return nil }
+func (fakeListener) Addr() net.Addr            { return nil }
@@ -0,0 +1,157 @@
+package health
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
+)
+
+type Pool interface {
+	Available() int
+}
+
+// UsageReporter is a network pool that knows how its networks are laid
+// out, which an external IPAM's doesn't.
+type UsageReporter interface {
+	Usage() network_pool.Usage
+}
+
+type Report struct {
+	Started           bool `json:"started"`
+	GraphWritable     bool `json:"graph_writable"`
+	IPTablesReachable bool `json:"iptables_reachable"`
+
+	AvailableNetworks int `json:"available_networks"`
+	AvailableUIDs     int `json:"available_uids"`
+	AvailablePorts    int `json:"available_ports"`
+
+	NetworkUsage *network_pool.Usage `json:"network_usage,omitempty"`
+}
+
+// Healthy reports whether the daemon can serve requests; running out of
+// networks, uids or ports only limits how many more containers it can take,
+// so is left to the caller to judge from the report.
+func (r Report) Healthy() bool {
+	return r.Started && r.GraphWritable && r.IPTablesReachable
+}
+
+// Handler serves a Report as JSON, with status 200 if it is healthy and 503
+// otherwise.
+type Handler struct {
+	logger lager.Logger
+
+	graphRoot     string
+	iptablesChain string
+	runner        command_runner.CommandRunner
+
+	networkPool Pool
+	uidPool     Pool
+	portPool    Pool
+
+	started      bool
+	startedMutex *sync.RWMutex
+}
+
+func New(
+	logger lager.Logger,
+	graphRoot string,
+	iptablesChain string,
+	runner command_runner.CommandRunner,
+	networkPool Pool,
+	uidPool Pool,
+	portPool Pool,
+) *Handler {
+	return &Handler{
+		logger: logger.Session("health"),
+
+		graphRoot:     graphRoot,
+		iptablesChain: iptablesChain,
+		runner:        runner,
+
+		networkPool: networkPool,
+		uidPool:     uidPool,
+		portPool:    portPool,
+
+		startedMutex: new(sync.RWMutex),
+	}
+}
+
+// Started marks the backend as started, i.e. containers have been restored
+// and it is serving the API.
+func (h *Handler) Started() {
+	h.startedMutex.Lock()
+	h.started = true
+	h.startedMutex.Unlock()
+}
+
+func (h *Handler) Report() Report {
+	h.startedMutex.RLock()
+	started := h.started
+	h.startedMutex.RUnlock()
+
+	report := Report{
+		Started:           started,
+		GraphWritable:     h.graphWritable(),
+		IPTablesReachable: h.iptablesReachable(),
+
+		AvailableNetworks: h.networkPool.Available(),
+		AvailableUIDs:     h.uidPool.Available(),
+		AvailablePorts:    h.portPool.Available(),
+	}
+
+	if reporter, ok := h.networkPool.(UsageReporter); ok {
+		usage := reporter.Usage()
+		report.NetworkUsage = &usage
+	}
+
+	return report
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := h.Report()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if report.Healthy() {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		h.logger.Info("unhealthy", lager.Data{
+			"report": report,
+		})
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
+
+func (h *Handler) graphWritable() bool {
+	probe, err := ioutil.TempFile(h.graphRoot, ".health-")
+	if err != nil {
+		h.logger.Error("graph-not-writable", err)
+		return false
+	}
+
+	probe.Close()
+	os.Remove(probe.Name())
+
+	return true
+}
+
+func (h *Handler) iptablesReachable() bool {
+	err := h.runner.Run(exec.Command("iptables", "-w", "-n", "-L", h.iptablesChain))
+	if err != nil {
+		h.logger.Error("iptables-not-reachable", err)
+		return false
+	}
+
+	return true
+}
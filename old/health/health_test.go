@@ -0,0 +1,161 @@
+package health_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/health"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+)
+
+var _ = Describe("Health", func() {
+	var graphRoot string
+	var fakeRunner *fake_command_runner.FakeCommandRunner
+	var uidPool *uid_pool.UnixUIDPool
+	var handler *health.Handler
+
+	BeforeEach(func() {
+		var err error
+
+		graphRoot, err = ioutil.TempDir("", "health-graph")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fakeRunner = fake_command_runner.New()
+
+		_, ipNet, err := net.ParseCIDR("10.254.0.0/28")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		uidPool = uid_pool.New(10000, 10)
+
+		handler = health.New(
+			lagertest.NewTestLogger("test"),
+			graphRoot,
+			"w-0-default",
+			fakeRunner,
+			network_pool.New(ipNet),
+			uidPool,
+			port_pool.New(61000, 100),
+		)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(graphRoot)
+	})
+
+	get := func() (int, health.Report) {
+		recorder := httptest.NewRecorder()
+
+		request, err := http.NewRequest("GET", "/health", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler.ServeHTTP(recorder, request)
+
+		var report health.Report
+		err = json.NewDecoder(recorder.Body).Decode(&report)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return recorder.Code, report
+	}
+
+	Context("when the backend has started", func() {
+		BeforeEach(func() {
+			handler.Started()
+		})
+
+		It("reports healthy, with the headroom left in each pool", func() {
+			_, err := uidPool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			code, report := get()
+			Ω(code).Should(Equal(http.StatusOK))
+
+			Ω(report).Should(Equal(health.Report{
+				Started:           true,
+				GraphWritable:     true,
+				IPTablesReachable: true,
+
+				AvailableNetworks: 4,
+				AvailableUIDs:     9,
+				AvailablePorts:    100,
+
+				NetworkUsage: &network_pool.Usage{
+					Size:             4,
+					Available:        4,
+					FreeBlocks:       1,
+					LargestFreeBlock: 4,
+				},
+			}))
+		})
+
+		It("lists the containers' iptables chain", func() {
+			get()
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "iptables",
+					Args: []string{"-w", "-n", "-L", "w-0-default"},
+				},
+			))
+		})
+
+		It("leaves nothing in the graph", func() {
+			get()
+
+			entries, err := ioutil.ReadDir(graphRoot)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(BeEmpty())
+		})
+
+		Context("when the graph is not writable", func() {
+			BeforeEach(func() {
+				os.RemoveAll(graphRoot)
+			})
+
+			It("reports unhealthy", func() {
+				code, report := get()
+				Ω(code).Should(Equal(http.StatusServiceUnavailable))
+				Ω(report.GraphWritable).Should(BeFalse())
+			})
+		})
+
+		Context("when iptables cannot be reached", func() {
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "iptables",
+					}, func(*exec.Cmd) error {
+						return errors.New("oh no!")
+					},
+				)
+			})
+
+			It("reports unhealthy", func() {
+				code, report := get()
+				Ω(code).Should(Equal(http.StatusServiceUnavailable))
+				Ω(report.IPTablesReachable).Should(BeFalse())
+			})
+		})
+	})
+
+	Context("when the backend has not yet started", func() {
+		It("reports unhealthy", func() {
+			code, report := get()
+			Ω(code).Should(Equal(http.StatusServiceUnavailable))
+			Ω(report.Started).Should(BeFalse())
+		})
+	})
+})
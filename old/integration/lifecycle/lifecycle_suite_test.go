@@ -32,7 +32,7 @@ func startGarden(argv ...string) api.Client {
 
 	gardenRunner = Runner.New("unix", gardenAddr, gardenBin, binPath, rootFSPath, graphPath, argv...)
 
-	gardenProcess = ifrit.Envoke(gardenRunner)
+	gardenProcess = gardenRunner.Start()
 
 	return gardenRunner.NewClient()
 }
@@ -70,5 +70,16 @@ func TestLifecycle(t *testing.T) {
 	})
 
 	RegisterFailHandler(Fail)
-	RunSpecs(t, "Lifecycle Suite")
+
+	reporters := []Reporter{}
+	if artifactsDir := os.Getenv("GARDEN_TEST_ARTIFACTS"); artifactsDir != "" {
+		reporters = append(reporters, Runner.LogsReporter{
+			Dir: artifactsDir,
+			Runner: func() *Runner.Runner {
+				return gardenRunner
+			},
+		})
+	}
+
+	RunSpecsWithDefaultAndCustomReporters(t, "Lifecycle Suite", reporters)
 }
@@ -35,8 +35,9 @@ var _ = Describe("A container with properties", func() {
 
 			Ω(info.Properties["foo"]).Should(Equal("bar"))
 			Ω(info.Properties["a"]).Should(Equal("b"))
+			Ω(info.Properties["garden.network.namespace"]).Should(MatchRegexp(`^/proc/\d+/ns/net$`))
 
-			Ω(info.Properties).Should(HaveLen(2))
+			Ω(info.Properties).Should(HaveLen(3))
 		})
 	})
 
@@ -0,0 +1,61 @@
+package lifecycle_test
+
+import (
+	"github.com/cloudfoundry-incubator/garden/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Restarting", func() {
+	var container api.Container
+
+	BeforeEach(func() {
+		client = startGarden()
+
+		var err error
+
+		container, err = client.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	Context("preserving state", func() {
+		It("restores the containers", func() {
+			var err error
+
+			gardenProcess, err = gardenRunner.Restart(true)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = client.Lookup(container.Handle())
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("logs restoring them", func() {
+			var err error
+
+			gardenProcess, err = gardenRunner.Restart(true)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			restored := []string{}
+			for _, log := range gardenRunner.Logs() {
+				if log.Message == "garden-linux.pool.restore.restored" {
+					restored = append(restored, log.Data["handle"].(string))
+				}
+			}
+
+			Ω(restored).Should(Equal([]string{container.Handle()}))
+		})
+	})
+
+	Context("without preserving state", func() {
+		It("starts afresh", func() {
+			var err error
+
+			gardenProcess, err = gardenRunner.Restart(false)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			containers, err := client.Containers(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(containers).Should(BeEmpty())
+		})
+	})
+})
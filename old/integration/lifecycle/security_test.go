@@ -2,6 +2,7 @@ package lifecycle_test
 
 import (
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
@@ -118,3 +119,103 @@ var _ = Describe("Denying access to network ranges", func() {
 		Ω(process.Wait()).Should(Equal(0))
 	})
 })
+
+var _ = Describe("Denying access to the host", func() {
+	var container api.Container
+	var hostIP string
+	var listener net.Listener
+
+	startListener := func() string {
+		var err error
+		listener, err = net.Listen("tcp", hostIP+":0")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+
+				conn.Close()
+			}
+		}()
+
+		_, port, err := net.SplitHostPort(listener.Addr().String())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return port
+	}
+
+	connect := func(port string) int {
+		process, err := container.Run(api.ProcessSpec{
+			Path: "sh",
+			Args: []string{"-c", fmt.Sprintf("echo hello | nc -w 1 %s %s", hostIP, port)},
+		}, api.ProcessIO{
+			Stdout: GinkgoWriter,
+			Stderr: GinkgoWriter,
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		status, err := process.Wait()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return status
+	}
+
+	createContainer := func() {
+		var err error
+		container, err = client.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		info, err := container.Info()
+		Ω(err).ShouldNot(HaveOccurred())
+		hostIP = info.HostIP
+	}
+
+	AfterEach(func() {
+		listener.Close()
+
+		err := client.Destroy(container.Handle())
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	Context("by default", func() {
+		BeforeEach(func() {
+			client = startGarden()
+			createContainer()
+		})
+
+		It("makes the host's ports inaccessible to the container", func() {
+			Ω(connect(startListener())).Should(Equal(1))
+		})
+	})
+
+	Context("when the port is allowed", func() {
+		BeforeEach(func() {
+			client = startGarden()
+			createContainer()
+
+			port := startListener()
+			restartGarden("-hostAllowedPorts", "53,"+port)
+		})
+
+		It("makes it accessible to the container", func() {
+			_, port, err := net.SplitHostPort(listener.Addr().String())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(connect(port)).Should(Equal(0))
+		})
+	})
+
+	Context("when host access is allowed", func() {
+		BeforeEach(func() {
+			client = startGarden("-allowHostAccess")
+			createContainer()
+		})
+
+		It("makes the host's ports accessible to the container", func() {
+			Ω(connect(startListener())).Should(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,32 @@
+package lifecycle_test
+
+import (
+	"github.com/cloudfoundry-incubator/garden/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	Runner "github.com/cloudfoundry-incubator/garden-linux/old/integration/runner"
+)
+
+var _ = Describe("Listening on TCP", func() {
+	BeforeEach(func() {
+		var err error
+
+		gardenRunner, err = Runner.NewTCP(gardenBin, binPath, rootFSPath, graphPath)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		gardenProcess = gardenRunner.Start()
+
+		client = gardenRunner.NewClient()
+	})
+
+	It("serves the API on the chosen port", func() {
+		Ω(gardenRunner.Network()).Should(Equal("tcp"))
+		Ω(gardenRunner.Addr()).Should(HavePrefix("127.0.0.1:"))
+
+		container, err := client.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(client.Destroy(container.Handle())).ShouldNot(HaveOccurred())
+	})
+})
@@ -1 +1,90 @@
 package measurements
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/types"
+)
+
+// Measurement is the machine-readable form of a single Benchmarker value
+// recorded by a Measure block.
+type Measurement struct {
+	Spec    string    `json:"spec"`
+	Name    string    `json:"name"`
+	Units   string    `json:"units,omitempty"`
+	Results []float64 `json:"results"`
+
+	Smallest     float64 `json:"smallest"`
+	Largest      float64 `json:"largest"`
+	Average      float64 `json:"average"`
+	StdDeviation float64 `json:"std_deviation"`
+}
+
+// JSONReporter collects the measurements of every completed spec and writes
+// them to Path as a JSON array when the suite ends, so that they can be
+// compared across runs.
+type JSONReporter struct {
+	Path string
+
+	measurements []Measurement
+}
+
+func (r *JSONReporter) SpecDidComplete(summary *types.SpecSummary) {
+	if !summary.Passed() {
+		return
+	}
+
+	spec := strings.Join(summary.ComponentTexts[1:], " ")
+
+	for _, m := range summary.Measurements {
+		r.measurements = append(r.measurements, Measurement{
+			Spec:    spec,
+			Name:    m.Name,
+			Units:   m.Units,
+			Results: m.Results,
+
+			Smallest:     m.Smallest,
+			Largest:      m.Largest,
+			Average:      m.Average,
+			StdDeviation: m.StdDeviation,
+		})
+	}
+}
+
+func (r *JSONReporter) SpecSuiteDidEnd(*types.SuiteSummary) {
+	err := r.write()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write measurements: %s\n", err)
+	}
+}
+
+func (r *JSONReporter) write() error {
+	err := os.MkdirAll(filepath.Dir(r.Path), 0755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(r.Path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	measurements := r.measurements
+	if measurements == nil {
+		measurements = []Measurement{}
+	}
+
+	return json.NewEncoder(file).Encode(measurements)
+}
+
+func (r *JSONReporter) SpecSuiteWillBegin(config.GinkgoConfigType, *types.SuiteSummary) {}
+func (r *JSONReporter) BeforeSuiteDidRun(*types.SetupSummary)                           {}
+func (r *JSONReporter) SpecWillRun(*types.SpecSummary)                                  {}
+func (r *JSONReporter) AfterSuiteDidRun(*types.SetupSummary)                            {}
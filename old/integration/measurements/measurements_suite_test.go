@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/onsi/gomega/gexec"
 	"github.com/tedsuo/ifrit"
 
+	"github.com/cloudfoundry-incubator/garden-linux/old/integration/measurements"
 	Runner "github.com/cloudfoundry-incubator/garden-linux/old/integration/runner"
 )
 
@@ -70,5 +72,20 @@ func TestLifecycle(t *testing.T) {
 	})
 
 	RegisterFailHandler(Fail)
-	RunSpecs(t, "Measurements Suite")
+
+	reporters := []Reporter{}
+	if artifactsDir := os.Getenv("GARDEN_TEST_ARTIFACTS"); artifactsDir != "" {
+		reporters = append(reporters, Runner.LogsReporter{
+			Dir: artifactsDir,
+			Runner: func() *Runner.Runner {
+				return gardenRunner
+			},
+		})
+
+		reporters = append(reporters, &measurements.JSONReporter{
+			Path: filepath.Join(artifactsDir, fmt.Sprintf("measurements-node-%d.json", GinkgoParallelNode())),
+		})
+	}
+
+	RunSpecsWithDefaultAndCustomReporters(t, "Measurements Suite", reporters)
 }
@@ -0,0 +1,122 @@
+package measurements_test
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Container networking", func() {
+	var container api.Container
+
+	BeforeEach(func() {
+		client = startGarden("-allowHostAccess")
+
+		var err error
+		container, err = client.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	Describe("sending data from a container to the host", func() {
+		const megabytes = 100
+
+		var listener net.Listener
+		var received chan int64
+
+		BeforeEach(func() {
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			listener, err = net.Listen("tcp", info.HostIP+":0")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			received = make(chan int64, 1)
+
+			go func() {
+				defer GinkgoRecover()
+
+				conn, err := listener.Accept()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				defer conn.Close()
+
+				n, err := io.Copy(ioutil.Discard, conn)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				received <- n
+			}()
+		})
+
+		AfterEach(func() {
+			listener.Close()
+		})
+
+		Measure("has a reasonable throughput", func(b Benchmarker) {
+			host, port, err := net.SplitHostPort(listener.Addr().String())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var bytes int64
+
+			elapsed := b.Time("sending", func() {
+				process, err := container.Run(api.ProcessSpec{
+					Path: "sh",
+					Args: []string{
+						"-c",
+						fmt.Sprintf("dd if=/dev/zero bs=1048576 count=%d | nc -w 1 %s %s", megabytes, host, port),
+					},
+				}, api.ProcessIO{
+					Stdout: GinkgoWriter,
+					Stderr: GinkgoWriter,
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(process.Wait()).Should(Equal(0))
+
+				Eventually(received, 10).Should(Receive(&bytes))
+			})
+
+			Ω(bytes).Should(Equal(int64(megabytes * 1024 * 1024)))
+
+			b.RecordValue("throughput (MB/s)", float64(megabytes)/elapsed.Seconds())
+		}, 1)
+	})
+
+	Describe("mapping ports into a container", func() {
+		for _, rules := range []int{0, 100, 500} {
+			existingRules := rules
+
+			Context(fmt.Sprintf("with %d existing rules", existingRules), func() {
+				BeforeEach(func() {
+					for i := 0; i < existingRules; i++ {
+						_, _, err := container.NetIn(0, uint32(8000+i))
+						Ω(err).ShouldNot(HaveOccurred())
+					}
+				})
+
+				Measure("installs a new rule quickly", func(b Benchmarker) {
+					var latencies []time.Duration
+
+					for i := 0; i < 10; i++ {
+						latencies = append(latencies, b.Time("net in", func() {
+							_, _, err := container.NetIn(0, uint32(9000+i))
+							Ω(err).ShouldNot(HaveOccurred())
+						}))
+					}
+
+					var total time.Duration
+					for _, latency := range latencies {
+						total += latency
+					}
+
+					b.RecordValue("average latency (ms)", float64(total/time.Millisecond)/float64(len(latencies)))
+				}, 1)
+			})
+		}
+	})
+})
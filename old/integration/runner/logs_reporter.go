@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/types"
+)
+
+var unsafeNameChars = regexp.MustCompile(`[^a-zA-Z0-9-]+`)
+
+// LogsReporter saves the logs of the daemon under test when a spec fails,
+// named after the spec, so that they survive as build artifacts.
+type LogsReporter struct {
+	Dir string
+
+	// returns the runner the spec used, or nil if it did not start one
+	Runner func() *Runner
+}
+
+func (r LogsReporter) SpecDidComplete(summary *types.SpecSummary) {
+	if !summary.Failed() {
+		return
+	}
+
+	runner := r.Runner()
+	if runner == nil {
+		return
+	}
+
+	name := strings.Trim(unsafeNameChars.ReplaceAllString(strings.Join(summary.ComponentTexts, "-"), "-"), "-")
+	name = fmt.Sprintf("%s-node-%d", name, ginkgo.GinkgoParallelNode())
+
+	err := runner.SaveLogs(r.Dir, name)
+	if err != nil {
+		fmt.Fprintf(ginkgo.GinkgoWriter, "failed to save garden logs: %s\n", err)
+	}
+}
+
+func (r LogsReporter) SpecSuiteWillBegin(config.GinkgoConfigType, *types.SuiteSummary) {}
+func (r LogsReporter) BeforeSuiteDidRun(*types.SetupSummary)                           {}
+func (r LogsReporter) SpecWillRun(*types.SpecSummary)                                  {}
+func (r LogsReporter) AfterSuiteDidRun(*types.SetupSummary)                            {}
+func (r LogsReporter) SpecSuiteDidEnd(*types.SuiteSummary)                             {}
@@ -1,7 +1,11 @@
 package runner
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
@@ -13,14 +17,18 @@ import (
 	"github.com/cloudfoundry-incubator/garden/client"
 	"github.com/cloudfoundry-incubator/garden/client/connection"
 	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
 	"github.com/pivotal-golang/lager"
 	"github.com/tedsuo/ifrit"
-	"github.com/tedsuo/ifrit/ginkgomon"
 )
 
 type Runner struct {
 	Command *exec.Cmd
 
+	// extra environment for the daemon, on top of the test's own
+	Env []string
+
 	network string
 	addr    string
 
@@ -34,8 +42,19 @@ type Runner struct {
 	graphPath string
 
 	debugAddr string
+
+	logs *gbytes.Buffer
+
+	process ifrit.Process
 }
 
+// how long to wait for the daemon to log that it has started
+const startTimeout = 10 * time.Second
+
+// how long to wait for the daemon to exit, or to answer a ping, when
+// restarting it
+const restartTimeout = 10 * time.Second
+
 func New(network, addr string, bin, binPath, rootFSPath, graphPath string, argv ...string) *Runner {
 	if graphPath == "" {
 		graphPath = os.TempDir()
@@ -56,7 +75,50 @@ func New(network, addr string, bin, binPath, rootFSPath, graphPath string, argv
 			fmt.Sprintf("test-garden-%d", ginkgo.GinkgoParallelNode()),
 		),
 		debugAddr: fmt.Sprintf("0.0.0.0:%d", 15000+ginkgo.GinkgoParallelNode()),
+
+		logs: gbytes.NewBuffer(),
+	}
+}
+
+// NewTCP returns a runner for a daemon listening on a free TCP port on the
+// loopback interface, reported by Addr, with its debug server on another.
+func NewTCP(bin, binPath, rootFSPath, graphPath string, argv ...string) (*Runner, error) {
+	addr, err := freeTCPAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	debugAddr, err := freeTCPAddr()
+	if err != nil {
+		return nil, err
 	}
+
+	runner := New("tcp", addr, bin, binPath, rootFSPath, graphPath, argv...)
+	runner.debugAddr = debugAddr
+
+	return runner, nil
+}
+
+// freeTCPAddr asks the kernel for a free port. It is released before the
+// daemon listens on it, so something else could take it in between, but the
+// kernel does not hand the same port out again straight away.
+func freeTCPAddr() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	defer listener.Close()
+
+	return listener.Addr().String(), nil
+}
+
+func (r *Runner) Network() string {
+	return r.network
+}
+
+func (r *Runner) Addr() string {
+	return r.addr
 }
 
 func (r *Runner) DebugAddr() string {
@@ -84,8 +146,8 @@ func (r *Runner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 		return err
 	}
 
-	gardenArgs := append(
-		r.argv,
+	// the extra arguments come last, so that they override the defaults
+	gardenArgs := []string{
 		"--listenNetwork", r.network,
 		"--listenAddr", r.addr,
 		"--bin", r.binPath,
@@ -98,37 +160,42 @@ func (r *Runner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 		"--logLevel", "debug",
 		"--disableQuotas",
 		"--networkPool", fmt.Sprintf("10.250.%d.0/24", ginkgo.GinkgoParallelNode()),
-		"--portPoolStart", strconv.Itoa(51000+(1000*ginkgo.GinkgoParallelNode())),
+		"--portPoolStart", strconv.Itoa(51000 + (1000 * ginkgo.GinkgoParallelNode())),
 		"--portPoolSize", "1000",
-		"--uidPoolStart", strconv.Itoa(10000*ginkgo.GinkgoParallelNode()),
+		"--uidPoolStart", strconv.Itoa(10000 * ginkgo.GinkgoParallelNode()),
 		"--tag", strconv.Itoa(ginkgo.GinkgoParallelNode()),
-	)
+	}
 
-	var signal os.Signal
+	gardenArgs = append(gardenArgs, r.argv...)
 
 	r.Command = exec.Command(r.bin, gardenArgs...)
 
-	process := ifrit.Envoke(&ginkgomon.Runner{
-		Name:              "garden-linux",
-		Command:           r.Command,
-		AnsiColorCode:     "31m",
-		StartCheck:        "garden-linux.started",
-		StartCheckTimeout: 10 * time.Second,
-		Cleanup: func() {
-			if signal == syscall.SIGKILL {
-				logger.Info("removing-tmp-dirs")
-				if err := os.RemoveAll(r.tmpdir); err != nil {
-					logger.Error("cleanup-tempdirs-failed", err, lager.Data{"tmpdir": r.tmpdir})
-				} else {
-					logger.Info("tmp-dirs-removed")
-				}
-			}
-		},
-	})
+	if len(r.Env) > 0 {
+		r.Command.Env = append(os.Environ(), r.Env...)
+	}
+
+	// each stream goes to the test's output, prefixed, and to the logs kept
+	// across the runner's restarts
+	logsFrom := len(r.logs.Contents())
+
+	session, err := gexec.Start(
+		r.Command,
+		io.MultiWriter(r.logs, gexec.NewPrefixedWriter("\x1b[32m[o]\x1b[31m[garden-linux]\x1b[0m ", ginkgo.GinkgoWriter)),
+		io.MultiWriter(r.logs, gexec.NewPrefixedWriter("\x1b[91m[e]\x1b[31m[garden-linux]\x1b[0m ", ginkgo.GinkgoWriter)),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = r.waitForStart(session, logsFrom)
+	if err != nil {
+		session.Kill()
+		return err
+	}
 
 	close(ready)
 
-	var waitErr error
+	var signal os.Signal
 
 dance:
 	for {
@@ -143,15 +210,141 @@ dance:
 				logger.Info("destroyed-containers")
 			}
 
-			process.Signal(syscall.SIGTERM)
-		case waitErr = <-process.Wait():
+			session.Signal(syscall.SIGTERM)
+		case <-session.Exited:
 			break dance
 		}
 	}
 
+	if signal == syscall.SIGKILL {
+		logger.Info("removing-tmp-dirs")
+		if err := os.RemoveAll(r.tmpdir); err != nil {
+			logger.Error("cleanup-tempdirs-failed", err, lager.Data{"tmpdir": r.tmpdir})
+		} else {
+			logger.Info("tmp-dirs-removed")
+		}
+	}
+
 	logger.Info("process-exited")
 
-	return waitErr
+	if session.ExitCode() != 0 {
+		return fmt.Errorf("exit status %d", session.ExitCode())
+	}
+
+	return nil
+}
+
+// waitForStart waits for the daemon to log that it has started, looking
+// only at what it logged since from, so that the logs' read position is
+// left for the test's assertions.
+func (r *Runner) waitForStart(session *gexec.Session, from int) error {
+	timeout := time.After(startTimeout)
+
+	for {
+		if bytes.Contains(r.logs.Contents()[from:], []byte("garden-linux.started")) {
+			return nil
+		}
+
+		select {
+		case <-session.Exited:
+			return fmt.Errorf("garden exited before starting, with status %d", session.ExitCode())
+		case <-timeout:
+			return fmt.Errorf("garden did not start within %s", startTimeout)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// Start runs the daemon, keeping hold of it so that it can be restarted.
+func (r *Runner) Start() ifrit.Process {
+	r.process = ifrit.Envoke(r)
+	return r.process
+}
+
+// Restart stops the daemon started by Start and starts it again, returning
+// the new process once it is ready.
+//
+// If preserveState is set the daemon is stopped gracefully, so it snapshots
+// its containers and restores them from the same depot and snapshots when
+// it comes back; otherwise its containers and directories are removed, as
+// they are when it is killed.
+func (r *Runner) Restart(preserveState bool) (ifrit.Process, error) {
+	if preserveState {
+		r.process.Signal(syscall.SIGTERM)
+	} else {
+		r.process.Signal(syscall.SIGKILL)
+	}
+
+	select {
+	case <-r.process.Wait():
+	case <-time.After(restartTimeout):
+		return nil, fmt.Errorf("garden did not exit within %s", restartTimeout)
+	}
+
+	process := r.Start()
+
+	err := r.WaitForReady(restartTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return process, nil
+}
+
+// WaitForReady pings the daemon until it answers, or the timeout passes.
+func (r *Runner) WaitForReady(timeout time.Duration) error {
+	client := r.NewClient()
+	deadline := time.Now().Add(timeout)
+
+	for {
+		err := client.Ping()
+		if err == nil {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("garden not ready after %s: %s", timeout, err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Buffer holds everything the daemon has written to stdout and stderr,
+// across restarts, for asserting on with gbytes.Say.
+func (r *Runner) Buffer() *gbytes.Buffer {
+	return r.logs
+}
+
+// Logs returns the lines the daemon has logged, as lagertest.TestLogger
+// does.
+func (r *Runner) Logs() []lager.LogFormat {
+	logs := []lager.LogFormat{}
+
+	for _, line := range bytes.Split(r.logs.Contents(), []byte("\n")) {
+		var log lager.LogFormat
+
+		// stderr is interleaved with the log lines, and is not JSON
+		err := json.Unmarshal(line, &log)
+		if err != nil {
+			continue
+		}
+
+		logs = append(logs, log)
+	}
+
+	return logs
+}
+
+// SaveLogs writes everything the daemon has written to dir/name.log, e.g.
+// for keeping as a build artifact when a test fails.
+func (r *Runner) SaveLogs(dir, name string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, name+".log"), r.logs.Contents(), 0644)
 }
 
 func (r *Runner) TryDial() error {
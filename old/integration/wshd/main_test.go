@@ -11,6 +11,7 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"strings"
 	"syscall"
 
 	. "github.com/onsi/ginkgo"
@@ -474,6 +475,93 @@ setup_fs
 		})
 	})
 
+	It("does not leave spawned processes with signals blocked", func() {
+		sh := exec.Command(wsh, "--socket", socketPath, "/bin/sh", "-c", "grep SigBlk /proc/self/status")
+
+		shSession, err := Start(sh, GinkgoWriter, GinkgoWriter)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Eventually(shSession).Should(Say(`SigBlk:\s+0+\n`))
+		Eventually(shSession).Should(Exit(0))
+	})
+
+	It("reaps orphaned processes", func() {
+		sh := exec.Command(wsh, "--socket", socketPath, "/bin/sh", "-c", "sleep 0.1 & exit 0")
+
+		shSession, err := Start(sh, GinkgoWriter, GinkgoWriter)
+		Ω(err).ShouldNot(HaveOccurred())
+		Eventually(shSession).Should(Exit(0))
+
+		Eventually(func() *Buffer {
+			ps := exec.Command(wsh, "--socket", socketPath, "/bin/ps", "-o", "comm")
+
+			psSession, err := Start(ps, GinkgoWriter, GinkgoWriter)
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(psSession).Should(Exit(0))
+
+			return psSession.Out
+		}, 5).ShouldNot(Say("sleep"))
+	})
+
+	Context("when the daemon receives SIGTERM", func() {
+		It("forwards it to the running processes", func() {
+			sh := exec.Command(wsh, "--socket", socketPath, "/bin/sh", "-c", "echo ready; sleep 100")
+
+			shSession, err := Start(sh, GinkgoWriter, GinkgoWriter)
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(shSession).Should(Say("ready\n"))
+
+			wshdPid, err := ioutil.ReadFile(path.Join(containerPath, "run", "wshd.pid"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			kill := exec.Command("kill", "-TERM", strings.TrimSpace(string(wshdPid)))
+			killSession, err := Start(kill, GinkgoWriter, GinkgoWriter)
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(killSession).Should(Exit(0))
+
+			// a process killed by a signal has no exit status to report
+			Eventually(shSession, 5).Should(Exit(255))
+		})
+	})
+
+	Context("when running a command with rlimits", func() {
+		It("applies them to the process", func() {
+			sh := exec.Command(wsh, "--socket", socketPath, "--user", "vcap", "/bin/sh", "-c", "ulimit -n; ulimit -Hn")
+			sh.Env = append(os.Environ(), "RLIMIT_NOFILE=256 512")
+
+			shSession, err := Start(sh, GinkgoWriter, GinkgoWriter)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(shSession).Should(Say("^256\n"))
+			Eventually(shSession).Should(Say("^512\n"))
+			Eventually(shSession).Should(Exit(0))
+		})
+
+		It("uses the soft limit as the hard limit when only one is given", func() {
+			sh := exec.Command(wsh, "--socket", socketPath, "--user", "vcap", "/bin/sh", "-c", "ulimit -Hn")
+			sh.Env = append(os.Environ(), "RLIMIT_NOFILE=256")
+
+			shSession, err := Start(sh, GinkgoWriter, GinkgoWriter)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(shSession).Should(Say("^256\n"))
+			Eventually(shSession).Should(Exit(0))
+		})
+
+		Context("when the soft limit exceeds the hard limit", func() {
+			It("refuses to run the command", func() {
+				sh := exec.Command(wsh, "--socket", socketPath, "--user", "vcap", "/bin/true")
+				sh.Env = append(os.Environ(), "RLIMIT_NOFILE=512 256")
+
+				shSession, err := Start(sh, GinkgoWriter, GinkgoWriter)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Eventually(shSession.Err).Should(Say("RLIMIT_NOFILE: soft limit exceeds hard limit"))
+				Eventually(shSession).Should(Exit(255))
+			})
+		})
+	})
+
 	Context("when piping stdin", func() {
 		It("terminates when the input stream terminates", func() {
 			sh := exec.Command(wsh, "--socket", socketPath, "/bin/sh")
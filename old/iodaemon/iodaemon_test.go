@@ -1,8 +1,10 @@
 package main_test
 
 import (
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 
 	linkpkg "github.com/cloudfoundry-incubator/garden-linux/old/iodaemon/link"
 	. "github.com/onsi/ginkgo"
@@ -39,6 +41,38 @@ var _ = Describe("Iodaemon", func() {
 		Ω(link.Wait()).Should(Equal(42))
 	})
 
+	It("records the exit status, replacing one left by an earlier process", func() {
+		statusPath := socketPath + ".status"
+
+		err := ioutil.WriteFile(statusPath, []byte("42\n"), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		spawnS, err := gexec.Start(exec.Command(
+			iodaemon,
+			"spawn",
+			socketPath,
+			"bash", "-c", "exit 3",
+		), GinkgoWriter, GinkgoWriter)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		defer spawnS.Kill()
+
+		Eventually(spawnS).Should(gbytes.Say("ready\n"))
+
+		_, err = os.Stat(statusPath)
+		Ω(os.IsNotExist(err)).Should(BeTrue())
+
+		link, err := linkpkg.Create(socketPath, GinkgoWriter, GinkgoWriter)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(link.Wait()).Should(Equal(3))
+
+		Eventually(func() (string, error) {
+			status, err := ioutil.ReadFile(statusPath)
+			return string(status), err
+		}).Should(Equal("3\n"))
+	})
+
 	It("consistently executes a quickly-printing-and-exiting command", func() {
 		for i := 0; i < 100; i++ {
 			spawnS, err := gexec.Start(exec.Command(
@@ -67,4 +101,83 @@ var _ = Describe("Iodaemon", func() {
 			Ω(err).ShouldNot(HaveOccurred())
 		}
 	})
+
+	Context("with an output limit", func() {
+		var finishedPath string
+		var stdout *blockingWriter
+
+		BeforeEach(func() {
+			finishedPath = filepath.Join(tmpdir, "finished")
+			stdout = &blockingWriter{
+				unblock: make(chan struct{}),
+				Buffer:  gbytes.NewBuffer(),
+			}
+		})
+
+		spawn := func(flags ...string) *gexec.Session {
+			args := append(flags,
+				"spawn",
+				socketPath,
+				"bash", "-c", "head -c 1048576 /dev/zero | tr '\\0' a; touch "+finishedPath,
+			)
+
+			spawnS, err := gexec.Start(exec.Command(iodaemon, args...), GinkgoWriter, GinkgoWriter)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(spawnS).Should(gbytes.Say("ready\n"))
+
+			return spawnS
+		}
+
+		It("blocks the process until its output is read", func() {
+			spawnS := spawn("-outputLimit=1024")
+			defer spawnS.Kill()
+
+			link, err := linkpkg.Create(socketPath, stdout, GinkgoWriter)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(spawnS).Should(gbytes.Say("pid:"))
+			Consistently(func() error {
+				_, err := os.Stat(finishedPath)
+				return err
+			}).Should(HaveOccurred())
+
+			close(stdout.unblock)
+
+			Ω(link.Wait()).Should(Equal(0))
+			Ω(stdout.Contents()).Should(HaveLen(1048576))
+		})
+
+		Context("when told to drop output", func() {
+			It("lets the process run and marks the truncation", func() {
+				spawnS := spawn("-outputLimit=1024", "-dropOutput")
+				defer spawnS.Kill()
+
+				link, err := linkpkg.Create(socketPath, stdout, GinkgoWriter)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Eventually(spawnS).Should(gbytes.Say("pid:"))
+				Eventually(func() error {
+					_, err := os.Stat(finishedPath)
+					return err
+				}).ShouldNot(HaveOccurred())
+
+				close(stdout.unblock)
+
+				Ω(link.Wait()).Should(Equal(0))
+				Ω(string(stdout.Contents())).Should(ContainSubstring(linkpkg.TruncationMarker))
+				Ω(len(stdout.Contents())).Should(BeNumerically("<", 1048576))
+			})
+		})
+	})
 })
+
+type blockingWriter struct {
+	unblock chan struct{}
+	*gbytes.Buffer
+}
+
+func (w *blockingWriter) Write(data []byte) (int, error) {
+	<-w.unblock
+	return w.Buffer.Write(data)
+}
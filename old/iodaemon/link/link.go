@@ -9,6 +9,10 @@ import (
 	"syscall"
 )
 
+// written in place of output the i/o daemon had to drop because nothing was
+// reading it and its output limit was reached
+const TruncationMarker = "\n[iodaemon: output truncated]\n"
+
 type Link struct {
 	*Writer
 
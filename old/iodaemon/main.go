@@ -8,9 +8,9 @@ import (
 
 const USAGE = `usage:
 
-	iomux spawn [-timeout timeout] [-tty] <socket> <path> <args...>:
+	iomux spawn [-timeout timeout] [-tty] [-outputLimit bytes [-dropOutput]] <socket> <path> <args...>:
 		spawn a subprocess, making its stdio and exit status available via
-		the given socket
+		the given socket; the exit status is also written to <socket>.status
 
 	iomux link <socket>:
 		attach to a process via the given socket
@@ -41,6 +41,18 @@ var windowRows = flag.Int(
 	"initial window rows for the process's tty",
 )
 
+var outputLimit = flag.Int(
+	"outputLimit",
+	0,
+	"bytes of output to buffer per stream while no client is reading (0 = only the pipe's capacity)",
+)
+
+var dropOutput = flag.Bool(
+	"dropOutput",
+	false,
+	"drop output beyond -outputLimit, marking the truncation, instead of blocking the process",
+)
+
 var debug = flag.Bool(
 	"debug",
 	false,
@@ -58,7 +70,7 @@ func main() {
 			usage()
 		}
 
-		spawn(args[1], args[2:], *timeout, *tty, *windowColumns, *windowRows, *debug)
+		spawn(args[1], args[2:], *timeout, *tty, *windowColumns, *windowRows, *outputLimit, *dropOutput, *debug)
 
 	case "link":
 		if len(args) < 2 {
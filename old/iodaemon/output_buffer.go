@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	linkpkg "github.com/cloudfoundry-incubator/garden-linux/old/iodaemon/link"
+)
+
+// outputBuffer holds up to limit bytes of a process's output while nothing is
+// reading it. When full, writes either block until the reader catches up, or
+// are dropped and replaced with a single truncation marker.
+type outputBuffer struct {
+	limit int
+	drop  bool
+
+	data      []byte
+	truncated bool
+	closed    bool
+
+	cond *sync.Cond
+}
+
+func newOutputBuffer(limit int, drop bool) *outputBuffer {
+	return &outputBuffer{
+		limit: limit,
+		drop:  drop,
+
+		cond: sync.NewCond(&sync.Mutex{}),
+	}
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+
+	written := 0
+
+	for len(p) > 0 {
+		if b.closed {
+			return written, io.ErrClosedPipe
+		}
+
+		room := b.limit - len(b.data)
+		if room <= 0 {
+			if b.drop {
+				b.truncated = true
+				return written + len(p), nil
+			}
+
+			b.cond.Wait()
+			continue
+		}
+
+		if b.truncated {
+			b.appendTruncationMarker()
+			continue
+		}
+
+		n := len(p)
+		if n > room {
+			n = room
+		}
+
+		b.data = append(b.data, p[:n]...)
+		p = p[n:]
+		written += n
+
+		b.cond.Broadcast()
+	}
+
+	return written, nil
+}
+
+func (b *outputBuffer) Read(p []byte) (int, error) {
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+
+	for len(b.data) == 0 && !b.closed {
+		b.cond.Wait()
+	}
+
+	if len(b.data) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+
+	b.cond.Broadcast()
+
+	return n, nil
+}
+
+// Close marks the end of the output; remaining data can still be read.
+func (b *outputBuffer) Close() error {
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+
+	if b.truncated {
+		b.appendTruncationMarker()
+	}
+
+	b.closed = true
+	b.cond.Broadcast()
+
+	return nil
+}
+
+// the marker may exceed the limit, so that clients always see it
+func (b *outputBuffer) appendTruncationMarker() {
+	b.data = append(b.data, linkpkg.TruncationMarker...)
+	b.truncated = false
+	b.cond.Broadcast()
+}
+
+// bufferOutput interposes an outputBuffer between the given read end of a
+// process's output and a new pipe, whose read end is returned for clients.
+//
+// flushed is done once all of the output has been handed to the pipe.
+func bufferOutput(src *os.File, limit int, drop bool, flushed *sync.WaitGroup) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := newOutputBuffer(limit, drop)
+
+	go func() {
+		io.Copy(buffer, src)
+		buffer.Close()
+	}()
+
+	flushed.Add(1)
+	go func() {
+		io.Copy(w, buffer)
+		w.Close()
+		flushed.Done()
+	}()
+
+	return r, nil
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"encoding/gob"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
@@ -16,12 +18,21 @@ import (
 	"github.com/kr/pty"
 )
 
-func spawn(socketPath string, argv []string, timeout time.Duration, withTty bool, windowColumns int, windowRows int, debug bool) {
+func spawn(socketPath string, argv []string, timeout time.Duration, withTty bool, windowColumns int, windowRows int, outputLimit int, dropOutput bool, debug bool) {
 	err := os.MkdirAll(filepath.Dir(socketPath), 0755)
 	if err != nil {
 		fatal(err)
 	}
 
+	statusPath := socketPath + ".status"
+
+	// an earlier process with the same id may have left its exit status
+	// behind, which would be taken for this one's
+	err = os.Remove(statusPath)
+	if err != nil && !os.IsNotExist(err) {
+		fatal(err)
+	}
+
 	if debug {
 		ownPid := os.Getpid()
 
@@ -98,6 +109,22 @@ func spawn(socketPath string, argv []string, timeout time.Duration, withTty bool
 	cmd.Stdout = stdoutW
 	cmd.Stderr = stderrW
 
+	flushed := &sync.WaitGroup{}
+
+	if outputLimit > 0 {
+		stdoutR, err = bufferOutput(stdoutR, outputLimit, dropOutput, flushed)
+		if err != nil {
+			fatal(err)
+		}
+
+		if !withTty {
+			stderrR, err = bufferOutput(stderrR, outputLimit, dropOutput, flushed)
+			if err != nil {
+				fatal(err)
+			}
+		}
+	}
+
 	statusR, statusW, err := os.Pipe()
 	if err != nil {
 		fatal(err)
@@ -142,8 +169,22 @@ func spawn(socketPath string, argv []string, timeout time.Duration, withTty bool
 			go func() {
 				cmd.Wait()
 
+				// hand off any buffered output before reporting the exit status
+				flushed.Wait()
+
 				if cmd.ProcessState != nil {
-					fmt.Fprintf(statusW, "%d\n", cmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus())
+					exitStatus := cmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()
+
+					// persist the exit status for clients that link after we're gone
+					err := ioutil.WriteFile(statusPath, []byte(fmt.Sprintf("%d\n", exitStatus)), 0644)
+
+					fmt.Fprintf(statusW, "%d\n", exitStatus)
+
+					if err != nil {
+						// don't leave a partial status to be read
+						os.Remove(statusPath)
+						os.Exit(1)
+					}
 				}
 
 				os.Exit(0)
@@ -0,0 +1,277 @@
+package allocation_journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+)
+
+// Journal records which container holds each network and port as they are
+// acquired, so that when snapshots are saved while the server runs, the
+// allocations made between the last save and a crash are not lost.
+type Journal interface {
+	// Allocation returns what the container holds, per the journal.
+	Allocation(id string) Allocation
+
+	AcquireNetwork(id string, network *network.Network) error
+	AcquirePort(id string, port uint32) error
+
+	// ReleasePort records that the container no longer holds the port.
+	ReleasePort(id string, port uint32) error
+
+	// Release records that the container holds nothing any more.
+	Release(id string) error
+
+	// Compact drops every container not in keep, and rewrites the journal
+	// with only what is left.
+	Compact(keep map[string]bool) error
+}
+
+type Allocation struct {
+	Network *network.Network `json:"network,omitempty"`
+	Ports   []uint32         `json:"ports,omitempty"`
+}
+
+type entry struct {
+	ID      string           `json:"id"`
+	Release bool             `json:"release,omitempty"`
+	Network *network.Network `json:"network,omitempty"`
+	Port    uint32           `json:"port,omitempty"`
+}
+
+// Disabled journals nothing.
+type Disabled struct{}
+
+func (Disabled) Allocation(string) Allocation                  { return Allocation{} }
+func (Disabled) AcquireNetwork(string, *network.Network) error { return nil }
+func (Disabled) AcquirePort(string, uint32) error              { return nil }
+func (Disabled) ReleasePort(string, uint32) error              { return nil }
+func (Disabled) Release(string) error                          { return nil }
+func (Disabled) Compact(map[string]bool) error                 { return nil }
+
+type FileJournal struct {
+	path string
+	file *os.File
+
+	allocations map[string]*Allocation
+	mutex       *sync.Mutex
+}
+
+// Open replays the journal at path, creating it if it does not exist, and
+// appends to it from then on.
+func Open(path string) (*FileJournal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	journal := &FileJournal{
+		path: path,
+		file: file,
+
+		allocations: map[string]*Allocation{},
+		mutex:       new(sync.Mutex),
+	}
+
+	err = journal.replay()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return journal, nil
+}
+
+func (j *FileJournal) Allocation(id string) Allocation {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	allocation, found := j.allocations[id]
+	if !found {
+		return Allocation{}
+	}
+
+	return Allocation{
+		Network: allocation.Network,
+		Ports:   append([]uint32{}, allocation.Ports...),
+	}
+}
+
+func (j *FileJournal) AcquireNetwork(id string, network *network.Network) error {
+	return j.record(entry{ID: id, Network: network})
+}
+
+func (j *FileJournal) AcquirePort(id string, port uint32) error {
+	return j.record(entry{ID: id, Port: port})
+}
+
+func (j *FileJournal) ReleasePort(id string, port uint32) error {
+	return j.record(entry{ID: id, Port: port, Release: true})
+}
+
+func (j *FileJournal) Release(id string) error {
+	return j.record(entry{ID: id, Release: true})
+}
+
+func (j *FileJournal) Compact(keep map[string]bool) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for id := range j.allocations {
+		if !keep[id] {
+			delete(j.allocations, id)
+		}
+	}
+
+	tmpPath := j.path + ".tmp"
+
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(tmp)
+
+	for id, allocation := range j.allocations {
+		if allocation.Network != nil {
+			err = encoder.Encode(entry{ID: id, Network: allocation.Network})
+			if err != nil {
+				tmp.Close()
+				return err
+			}
+		}
+
+		for _, port := range allocation.Ports {
+			err = encoder.Encode(entry{ID: id, Port: port})
+			if err != nil {
+				tmp.Close()
+				return err
+			}
+		}
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpPath, j.path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	j.file.Close()
+	j.file = file
+
+	return nil
+}
+
+// record appends the entry and syncs it to disk before applying it, so
+// that it is never lost once acknowledged.
+func (j *FileJournal) record(e entry) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	err := json.NewEncoder(j.file).Encode(e)
+	if err != nil {
+		return err
+	}
+
+	err = j.file.Sync()
+	if err != nil {
+		return err
+	}
+
+	j.apply(e)
+
+	return nil
+}
+
+func (j *FileJournal) replay() error {
+	reader := bufio.NewReader(j.file)
+
+	var replayed int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// a crash mid-write leaves a torn last entry, which was never
+			// acknowledged; drop it so that new entries start on a line of
+			// their own
+			return j.file.Truncate(replayed)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var e entry
+
+		err = json.Unmarshal(line, &e)
+		if err != nil {
+			return err
+		}
+
+		j.apply(e)
+
+		replayed += int64(len(line))
+	}
+}
+
+func (j *FileJournal) apply(e entry) {
+	allocation, found := j.allocations[e.ID]
+
+	if e.Release && e.Port != 0 {
+		if !found {
+			return
+		}
+
+		for i, port := range allocation.Ports {
+			if port == e.Port {
+				allocation.Ports = append(allocation.Ports[:i], allocation.Ports[i+1:]...)
+				break
+			}
+		}
+
+		return
+	}
+
+	if e.Release {
+		delete(j.allocations, e.ID)
+		return
+	}
+
+	if !found {
+		allocation = &Allocation{}
+		j.allocations[e.ID] = allocation
+	}
+
+	if e.Network != nil {
+		allocation.Network = e.Network
+	}
+
+	if e.Port != 0 {
+		for _, port := range allocation.Ports {
+			if port == e.Port {
+				return
+			}
+		}
+
+		allocation.Ports = append(allocation.Ports, e.Port)
+	}
+}
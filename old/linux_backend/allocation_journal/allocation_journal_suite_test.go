@@ -0,0 +1,13 @@
+package allocation_journal_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAllocationJournal(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Allocation Journal Suite")
+}
@@ -0,0 +1,167 @@
+package allocation_journal_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/allocation_journal"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+)
+
+var _ = Describe("Allocation journal", func() {
+	var tmpdir string
+	var journalPath string
+	var journal *allocation_journal.FileJournal
+
+	var network1 *network.Network
+	var network2 *network.Network
+
+	BeforeEach(func() {
+		var err error
+
+		tmpdir, err = ioutil.TempDir("", "allocation-journal")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		journalPath = path.Join(tmpdir, "allocations.journal")
+
+		journal, err = allocation_journal.Open(journalPath)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, ipNet, err := net.ParseCIDR("10.254.0.0/30")
+		Ω(err).ShouldNot(HaveOccurred())
+		network1 = network.New(ipNet)
+
+		_, ipNet, err = net.ParseCIDR("10.254.0.4/30")
+		Ω(err).ShouldNot(HaveOccurred())
+		network2 = network.New(ipNet)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	reopen := func() *allocation_journal.FileJournal {
+		reopened, err := allocation_journal.Open(journalPath)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return reopened
+	}
+
+	It("replays acquisitions when reopened", func() {
+		Ω(journal.AcquireNetwork("container-1", network1)).ShouldNot(HaveOccurred())
+		Ω(journal.AcquirePort("container-1", 61001)).ShouldNot(HaveOccurred())
+		Ω(journal.AcquirePort("container-1", 61002)).ShouldNot(HaveOccurred())
+		Ω(journal.AcquireNetwork("container-2", network2)).ShouldNot(HaveOccurred())
+
+		reopened := reopen()
+
+		allocation := reopened.Allocation("container-1")
+		Ω(allocation.Network.String()).Should(Equal("10.254.0.0/30"))
+		Ω(allocation.Network.ContainerIP().String()).Should(Equal("10.254.0.2"))
+		Ω(allocation.Ports).Should(Equal([]uint32{61001, 61002}))
+
+		Ω(reopened.Allocation("container-2").Network.String()).Should(Equal("10.254.0.4/30"))
+	})
+
+	It("replays releases when reopened", func() {
+		Ω(journal.AcquireNetwork("container-1", network1)).ShouldNot(HaveOccurred())
+		Ω(journal.AcquirePort("container-1", 61001)).ShouldNot(HaveOccurred())
+		Ω(journal.Release("container-1")).ShouldNot(HaveOccurred())
+
+		Ω(reopen().Allocation("container-1")).Should(Equal(allocation_journal.Allocation{}))
+	})
+
+	It("replays port releases when reopened", func() {
+		Ω(journal.AcquireNetwork("container-1", network1)).ShouldNot(HaveOccurred())
+		Ω(journal.AcquirePort("container-1", 61001)).ShouldNot(HaveOccurred())
+		Ω(journal.AcquirePort("container-1", 61002)).ShouldNot(HaveOccurred())
+		Ω(journal.ReleasePort("container-1", 61001)).ShouldNot(HaveOccurred())
+
+		allocation := reopen().Allocation("container-1")
+		Ω(allocation.Network.String()).Should(Equal("10.254.0.0/30"))
+		Ω(allocation.Ports).Should(Equal([]uint32{61002}))
+	})
+
+	It("records each port once", func() {
+		Ω(journal.AcquirePort("container-1", 61001)).ShouldNot(HaveOccurred())
+		Ω(journal.AcquirePort("container-1", 61001)).ShouldNot(HaveOccurred())
+
+		Ω(journal.Allocation("container-1").Ports).Should(Equal([]uint32{61001}))
+	})
+
+	Context("when the last entry was torn by a crash", func() {
+		BeforeEach(func() {
+			Ω(journal.AcquirePort("container-1", 61001)).ShouldNot(HaveOccurred())
+
+			file, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_APPEND, 0600)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = file.Write([]byte(`{"id":"container-1","po`))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			file.Close()
+		})
+
+		It("replays the entries before it, and appends after them", func() {
+			reopened := reopen()
+			Ω(reopened.Allocation("container-1").Ports).Should(Equal([]uint32{61001}))
+
+			Ω(reopened.AcquirePort("container-1", 61002)).ShouldNot(HaveOccurred())
+
+			Ω(reopen().Allocation("container-1").Ports).Should(Equal([]uint32{61001, 61002}))
+		})
+	})
+
+	Context("when an entry in the middle is corrupt", func() {
+		BeforeEach(func() {
+			err := ioutil.WriteFile(journalPath, []byte("{]\n{}\n"), 0600)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("fails to open", func() {
+			_, err := allocation_journal.Open(journalPath)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("compacting", func() {
+		BeforeEach(func() {
+			Ω(journal.AcquireNetwork("container-1", network1)).ShouldNot(HaveOccurred())
+			Ω(journal.AcquirePort("container-1", 61001)).ShouldNot(HaveOccurred())
+			Ω(journal.AcquireNetwork("container-2", network2)).ShouldNot(HaveOccurred())
+			Ω(journal.AcquireNetwork("container-3", network2)).ShouldNot(HaveOccurred())
+			Ω(journal.Release("container-3")).ShouldNot(HaveOccurred())
+
+			Ω(journal.Compact(map[string]bool{"container-1": true})).ShouldNot(HaveOccurred())
+		})
+
+		It("drops containers not kept", func() {
+			Ω(journal.Allocation("container-2")).Should(Equal(allocation_journal.Allocation{}))
+			Ω(reopen().Allocation("container-2")).Should(Equal(allocation_journal.Allocation{}))
+		})
+
+		It("keeps what the kept containers hold", func() {
+			allocation := reopen().Allocation("container-1")
+			Ω(allocation.Network.String()).Should(Equal("10.254.0.0/30"))
+			Ω(allocation.Ports).Should(Equal([]uint32{61001}))
+		})
+
+		It("rewrites the journal with only what is left", func() {
+			contents, err := ioutil.ReadFile(journalPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(contents)).ShouldNot(ContainSubstring("container-3"))
+			Ω(string(contents)).ShouldNot(ContainSubstring("container-2"))
+		})
+
+		It("keeps appending to the rewritten journal", func() {
+			Ω(journal.AcquirePort("container-1", 61002)).ShouldNot(HaveOccurred())
+
+			Ω(reopen().Allocation("container-1").Ports).Should(Equal([]uint32{61001, 61002}))
+		})
+	})
+})
@@ -17,9 +17,32 @@ import (
 var IN_RATE_PATTERN = regexp.MustCompile(`qdisc tbf [0-9a-f]+: root refcnt \d+ rate (\d+)([KMG]?)bit burst (\d+)([KMG]?)b`)
 var OUT_RATE_PATTERN = regexp.MustCompile(`police 0x[0-9a-f]+ rate (\d+)([KMG]?)bit burst (\d+)([KMG]?)b`)
 
+var IN_USAGE_PATTERN = regexp.MustCompile(`qdisc tbf [0-9a-f]+: root .*\n\s*Sent (\d+) bytes (\d+) pkts? \(dropped (\d+), overlimits (\d+)[^\n]*\n\s*backlog (\d+)([KMG]?)b`)
+var OUT_USAGE_PATTERN = regexp.MustCompile(`police 0x[0-9a-f]+ rate .*\n(?:.*\n)*?\s*Sent (\d+) bytes (\d+) pkts? \(dropped (\d+), overlimits (\d+)`)
+
 type BandwidthManager interface {
 	SetLimits(lager.Logger, api.BandwidthLimits) error
 	GetLimits(lager.Logger) (api.ContainerBandwidthStat, error)
+	GetUsage(lager.Logger) (ContainerBandwidthUsage, error)
+}
+
+// ContainerBandwidthUsage is the traffic that has passed through the
+// container's rate limits since they were set, and how much of it they held
+// back. In is the traffic shaped on its way to the container, and Out is the
+// traffic policed on its way out of it.
+type ContainerBandwidthUsage struct {
+	InBytes      uint64 `json:"in_bytes"`
+	InPackets    uint64 `json:"in_packets"`
+	InDropped    uint64 `json:"in_dropped"`
+	InOverlimits uint64 `json:"in_overlimits"`
+
+	// queued for the container at the moment, waiting on the rate limit
+	InBacklogBytes uint64 `json:"in_backlog_bytes"`
+
+	OutBytes      uint64 `json:"out_bytes"`
+	OutPackets    uint64 `json:"out_packets"`
+	OutDropped    uint64 `json:"out_dropped"`
+	OutOverlimits uint64 `json:"out_overlimits"`
 }
 
 type ContainerBandwidthManager struct {
@@ -59,23 +82,12 @@ func (m *ContainerBandwidthManager) SetLimits(
 func (m *ContainerBandwidthManager) GetLimits(logger lager.Logger) (api.ContainerBandwidthStat, error) {
 	limits := api.ContainerBandwidthStat{}
 
-	runner := logging.Runner{
-		CommandRunner: m.runner,
-		Logger:        logger,
-	}
-
-	egressOut := new(bytes.Buffer)
-
-	egress := exec.Command(path.Join(m.containerPath, "net.sh"), "get_egress_info")
-	egress.Env = []string{"ID=" + m.containerID}
-	egress.Stdout = egressOut
-
-	err := runner.Run(egress)
+	egressOut, err := m.netInfo(logger, "get_egress_info")
 	if err != nil {
 		return limits, err
 	}
 
-	matches := IN_RATE_PATTERN.FindStringSubmatch(string(egressOut.Bytes()))
+	matches := IN_RATE_PATTERN.FindStringSubmatch(egressOut)
 	if matches != nil {
 		inRate, err := strconv.ParseUint(matches[1], 10, 0)
 		if err != nil {
@@ -90,22 +102,16 @@ func (m *ContainerBandwidthManager) GetLimits(logger lager.Logger) (api.Containe
 		inRateUnit := matches[2]
 		inBurstUnit := matches[4]
 
-		limits.InRate = convertUnits(inRate, inRateUnit) / 8
-		limits.InBurst = convertUnits(inBurst, inBurstUnit)
+		limits.InRate = convertRate(inRate, inRateUnit) / 8
+		limits.InBurst = convertSize(inBurst, inBurstUnit)
 	}
 
-	ingressOut := new(bytes.Buffer)
-
-	ingress := exec.Command(path.Join(m.containerPath, "net.sh"), "get_ingress_info")
-	ingress.Env = []string{"ID=" + m.containerID}
-	ingress.Stdout = ingressOut
-
-	err = runner.Run(ingress)
+	ingressOut, err := m.netInfo(logger, "get_ingress_info")
 	if err != nil {
 		return limits, err
 	}
 
-	matches = OUT_RATE_PATTERN.FindStringSubmatch(string(ingressOut.Bytes()))
+	matches = OUT_RATE_PATTERN.FindStringSubmatch(ingressOut)
 	if matches != nil {
 		outRate, err := strconv.ParseUint(matches[1], 10, 0)
 		if err != nil {
@@ -120,21 +126,105 @@ func (m *ContainerBandwidthManager) GetLimits(logger lager.Logger) (api.Containe
 		outRateUnit := matches[2]
 		outBurstUnit := matches[4]
 
-		limits.OutRate = convertUnits(outRate, outRateUnit) / 8
-		limits.OutBurst = convertUnits(outBurst, outBurstUnit)
+		limits.OutRate = convertRate(outRate, outRateUnit) / 8
+		limits.OutBurst = convertSize(outBurst, outBurstUnit)
 	}
 
 	return limits, err
 }
 
-func convertUnits(num uint64, unit string) uint64 {
+// GetUsage reads the statistics of the qdisc and the filter that enforce the
+// container's limits. They are zero if no limits have been set.
+func (m *ContainerBandwidthManager) GetUsage(logger lager.Logger) (ContainerBandwidthUsage, error) {
+	usage := ContainerBandwidthUsage{}
+
+	egressOut, err := m.netInfo(logger, "get_egress_info")
+	if err != nil {
+		return usage, err
+	}
+
+	matches := IN_USAGE_PATTERN.FindStringSubmatch(egressOut)
+	if matches != nil {
+		err := parseCounters(matches[1:6], &usage.InBytes, &usage.InPackets, &usage.InDropped, &usage.InOverlimits, &usage.InBacklogBytes)
+		if err != nil {
+			return usage, err
+		}
+
+		usage.InBacklogBytes = convertSize(usage.InBacklogBytes, matches[6])
+	}
+
+	ingressOut, err := m.netInfo(logger, "get_ingress_info")
+	if err != nil {
+		return usage, err
+	}
+
+	matches = OUT_USAGE_PATTERN.FindStringSubmatch(ingressOut)
+	if matches != nil {
+		err := parseCounters(matches[1:5], &usage.OutBytes, &usage.OutPackets, &usage.OutDropped, &usage.OutOverlimits)
+		if err != nil {
+			return usage, err
+		}
+	}
+
+	return usage, nil
+}
+
+func (m *ContainerBandwidthManager) netInfo(logger lager.Logger, command string) (string, error) {
+	runner := logging.Runner{
+		CommandRunner: m.runner,
+		Logger:        logger,
+	}
+
+	out := new(bytes.Buffer)
+
+	info := exec.Command(path.Join(m.containerPath, "net.sh"), command)
+	info.Env = []string{"ID=" + m.containerID}
+	info.Stdout = out
+
+	err := runner.Run(info)
+	if err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+func parseCounters(values []string, counters ...*uint64) error {
+	for i, value := range values {
+		counter, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		*counters[i] = counter
+	}
+
+	return nil
+}
+
+// tc prints rates in powers of 1000, e.g. 2Mbit, and sizes in powers of 1024,
+// e.g. 64Kb
+func convertRate(num uint64, unit string) uint64 {
+	switch unit {
+	case "K":
+		return num * 1000
+	case "M":
+		return num * 1000 * 1000
+	case "G":
+		return num * 1000 * 1000 * 1000
+	default:
+		return num
+	}
+}
+
+func convertSize(num uint64, unit string) uint64 {
 	switch unit {
 	case "K":
 		return num * 1024
 	case "M":
-		return num * (1024 ^ 2)
+		return num * 1024 * 1024
 	case "G":
-		return num * (1024 ^ 3)
+		return num * 1024 * 1024 * 1024
 	default:
 		return num
 	}
@@ -113,6 +113,37 @@ ref 1 bind 1
 		Ω(usage.OutBurst).Should(Equal(uint64(65536)))
 	})
 
+	It("converts rates in powers of 1000 and sizes in powers of 1024", func() {
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: "/depot/some-id/net.sh",
+			Args: []string{"get_egress_info"},
+			Env:  []string{"ID=some-id"},
+		}, func(cmd *exec.Cmd) error {
+			cmd.Stdout.Write([]byte(`qdisc tbf 8010: root refcnt 2 rate 8Mbit burst 2Mb lat 24.4ms
+`))
+			return nil
+		})
+
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: "/depot/some-id/net.sh",
+			Args: []string{"get_ingress_info"},
+			Env:  []string{"ID=some-id"},
+		}, func(cmd *exec.Cmd) error {
+			cmd.Stdout.Write([]byte(` police 0x10 rate 16Kbit burst 3Kb mtu 2Kb action drop overhead 0b
+`))
+			return nil
+		})
+
+		usage, err := bandwidthManager.GetLimits(logger)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(usage.InRate).Should(Equal(uint64(1000 * 1000)))
+		Ω(usage.InBurst).Should(Equal(uint64(2 * 1024 * 1024)))
+
+		Ω(usage.OutRate).Should(Equal(uint64(2000)))
+		Ω(usage.OutBurst).Should(Equal(uint64(3 * 1024)))
+	})
+
 	Context("when net.sh get_egress_info fails", func() {
 		disaster := errors.New("oh no!")
 
@@ -222,3 +253,119 @@ qdisc ingress ffff: parent ffff:fff1 ----------------
 		})
 	})
 })
+
+var _ = Describe("getting bandwidth usage", func() {
+	BeforeEach(func() {
+		fakeRunner = fake_command_runner.New()
+		logger = lagertest.NewTestLogger("test")
+		bandwidthManager = bandwidth_manager.New("/depot/some-id", "some-id", fakeRunner)
+	})
+
+	It("reads the statistics of the shaping qdisc and the policing filter", func() {
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: "/depot/some-id/net.sh",
+			Args: []string{"get_egress_info"},
+			Env:  []string{"ID=some-id"},
+		}, func(cmd *exec.Cmd) error {
+			cmd.Stdout.Write([]byte(`qdisc tbf 8010: root refcnt 2 rate 8192bit burst 64Kb lat 24.4ms
+ Sent 123456 bytes 789 pkt (dropped 12, overlimits 34 requeues 0)
+ backlog 3Kb 2p requeues 0
+qdisc ingress ffff: parent ffff:fff1 ----------------
+ Sent 999 bytes 9 pkt (dropped 0, overlimits 0 requeues 0)
+ backlog 0b 0p requeues 0
+`))
+			return nil
+		})
+
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: "/depot/some-id/net.sh",
+			Args: []string{"get_ingress_info"},
+			Env:  []string{"ID=some-id"},
+		}, func(cmd *exec.Cmd) error {
+			cmd.Stdout.Write([]byte(`filter protocol ip pref 1 u32
+filter protocol ip pref 1 u32 fh 800: ht divisor 1
+filter protocol ip pref 1 u32 fh 800::800 order 2048 key ht 800 bkt 0 flowid :1
+  match 00000000/00000000 at 12
+ police 0x10 rate 8192bit burst 64Kb mtu 2Kb action drop overhead 0b
+ref 1 bind 1
+ Sent 5678 bytes 56 pkts (dropped 7, overlimits 8)
+`))
+			return nil
+		})
+
+		usage, err := bandwidthManager.GetUsage(logger)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(usage).Should(Equal(bandwidth_manager.ContainerBandwidthUsage{
+			InBytes:        123456,
+			InPackets:      789,
+			InDropped:      12,
+			InOverlimits:   34,
+			InBacklogBytes: 3072,
+
+			OutBytes:      5678,
+			OutPackets:    56,
+			OutDropped:    7,
+			OutOverlimits: 8,
+		}))
+	})
+
+	Context("when no limits have been set", func() {
+		It("returns zero usage and does not error", func() {
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "/depot/some-id/net.sh",
+				Args: []string{"get_egress_info"},
+				Env:  []string{"ID=some-id"},
+			}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(`qdisc pfifo_fast 0: root refcnt 2 bands 3 priomap  1 2 2 2 1 2 0 0 1 1 1 1 1 1 1 1
+ Sent 123456 bytes 789 pkt (dropped 0, overlimits 0 requeues 0)
+ backlog 0b 0p requeues 0
+`))
+				return nil
+			})
+
+			usage, err := bandwidthManager.GetUsage(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(usage).Should(BeZero())
+		})
+	})
+
+	Context("when net.sh get_egress_info fails", func() {
+		disaster := errors.New("oh no!")
+
+		BeforeEach(func() {
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "/depot/some-id/net.sh",
+				Args: []string{"get_egress_info"},
+				Env:  []string{"ID=some-id"},
+			}, func(*exec.Cmd) error {
+				return disaster
+			})
+		})
+
+		It("returns the error", func() {
+			_, err := bandwidthManager.GetUsage(logger)
+			Ω(err).Should(Equal(disaster))
+		})
+	})
+
+	Context("when net.sh get_ingress_info fails", func() {
+		disaster := errors.New("oh no!")
+
+		BeforeEach(func() {
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "/depot/some-id/net.sh",
+				Args: []string{"get_ingress_info"},
+				Env:  []string{"ID=some-id"},
+			}, func(*exec.Cmd) error {
+				return disaster
+			})
+		})
+
+		It("returns the error", func() {
+			_, err := bandwidthManager.GetUsage(logger)
+			Ω(err).Should(Equal(disaster))
+		})
+	})
+})
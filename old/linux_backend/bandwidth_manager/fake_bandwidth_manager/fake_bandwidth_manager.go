@@ -1,6 +1,7 @@
 package fake_bandwidth_manager
 
 import (
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/bandwidth_manager"
 	"github.com/cloudfoundry-incubator/garden/api"
 	"github.com/pivotal-golang/lager"
 )
@@ -11,6 +12,9 @@ type FakeBandwidthManager struct {
 
 	GetLimitsError  error
 	GetLimitsResult api.ContainerBandwidthStat
+
+	GetUsageError  error
+	GetUsageResult bandwidth_manager.ContainerBandwidthUsage
 }
 
 func New() *FakeBandwidthManager {
@@ -34,3 +38,11 @@ func (m *FakeBandwidthManager) GetLimits(logger lager.Logger) (api.ContainerBand
 
 	return m.GetLimitsResult, nil
 }
+
+func (m *FakeBandwidthManager) GetUsage(logger lager.Logger) (bandwidth_manager.ContainerBandwidthUsage, error) {
+	if m.GetUsageError != nil {
+		return bandwidth_manager.ContainerBandwidthUsage{}, m.GetUsageError
+	}
+
+	return m.GetUsageResult, nil
+}
@@ -0,0 +1,55 @@
+#!/bin/bash
+
+# Run by the kernel for every core dump, with the core on stdin, once
+# setup.sh has made it the core_pattern. Applies the core dump policy of the
+# container the crashing process is in.
+
+[ -n "${DEBUG:-}" ] && set -o xtrace
+set -o nounset
+
+depot_path=$1
+collect_path=$2
+pid=$3
+core_limit=$4
+time=$5
+
+# the command name may contain spaces, so comes last
+exe=$(echo "${@:6}" | tr ' /' '__')
+
+core_name=core.$exe.$pid
+
+# the process asked not to dump core, e.g. with ulimit -c 0
+if [ "$core_limit" = "0" ]
+then
+  exit 0
+fi
+
+id=$(sed -n 's/^[0-9]*:[^:]*memory[^:]*:.*\/instance-\([^/]*\)$/\1/p' /proc/$pid/cgroup)
+
+if [ -z "$id" ] || [ ! -f $depot_path/$id/etc/config ]
+then
+  # not in a container; dump it where the kernel would by default
+  exec cat > /proc/$pid/cwd/$core_name
+fi
+
+source $depot_path/$id/etc/config
+
+case ${core_dumps:-quota} in
+  disabled)
+    exit 0
+    ;;
+
+  collect)
+    mkdir -p $collect_path/$id
+    exec cat > $collect_path/$id/$core_name.$time
+    ;;
+
+  *)
+    # the working directory as seen from within the container
+    cwd=$(readlink /proc/$pid/cwd)
+
+    # written as the container's user, so that it can't be written anywhere
+    # the container couldn't, and is cut short by the container's disk quota
+    exec chroot --userspec=$user_uid:$user_uid / dd of=$rootfs_path$cwd/$core_name 2> /dev/null
+    ;;
+esac
@@ -7,19 +7,26 @@ shopt -s nullglob
 
 filter_forward_chain="${GARDEN_IPTABLES_FILTER_FORWARD_CHAIN}"
 filter_default_chain="${GARDEN_IPTABLES_FILTER_DEFAULT_CHAIN}"
+filter_input_chain="${GARDEN_IPTABLES_FILTER_INPUT_CHAIN}"
+filter_egress_chain="${GARDEN_IPTABLES_FILTER_EGRESS_CHAIN}"
 filter_instance_prefix="${GARDEN_IPTABLES_FILTER_INSTANCE_PREFIX}"
 nat_prerouting_chain="${GARDEN_IPTABLES_NAT_PREROUTING_CHAIN}"
 nat_postrouting_chain="${GARDEN_IPTABLES_NAT_POSTROUTING_CHAIN}"
 nat_instance_prefix="${GARDEN_IPTABLES_NAT_INSTANCE_PREFIX}"
 interface_name_prefix="${GARDEN_NETWORK_INTERFACE_PREFIX}"
+network_bridge="${GARDEN_NETWORK_BRIDGE:-}"
+network_proxy_arp_interface="${GARDEN_NETWORK_PROXY_ARP_INTERFACE:-}"
 
 # Default ALLOW_NETWORKS/DENY_NETWORKS to empty
 ALLOW_NETWORKS=${ALLOW_NETWORKS:-}
 DENY_NETWORKS=${DENY_NETWORKS:-}
 
+allow_host_access="${GARDEN_ALLOW_HOST_ACCESS:-false}"
+host_allowed_ports="${GARDEN_HOST_ALLOWED_PORTS:-}"
+
 function external_ip() {
-  # The ';tx;d;:x' trick deletes non-matching lines
-  ip route get 8.8.8.8 | sed 's/.*src\s\(.*\)\s/\1/;tx;d;:x'
+  # Newer iproute2s follow the source address with more fields, e.g. uid
+  ip route get 8.8.8.8 | sed -n 's/.*\ssrc\s\+\([^ ]*\).*/\1/p' | head -n 1
 }
 
 function teardown_deprecated_rules() {
@@ -69,8 +76,16 @@ function teardown_filter() {
     sed -e "s/-A/-D/" -e "s/\s\+\$//" |
     xargs --no-run-if-empty --max-lines=1 iptables -w
 
+  # Remove jump to input chain from INPUT
+  iptables -w -S INPUT 2> /dev/null |
+    grep " -j ${filter_input_chain}\b" |
+    sed -e "s/-A/-D/" -e "s/\s\+\$//" |
+    xargs --no-run-if-empty --max-lines=1 iptables -w
+
   iptables -w -F ${filter_forward_chain} 2> /dev/null || true
   iptables -w -F ${filter_default_chain} 2> /dev/null || true
+  iptables -w -F ${filter_input_chain} 2> /dev/null || true
+  iptables -w -F ${filter_egress_chain} 2> /dev/null || true
 }
 
 function setup_filter() {
@@ -95,6 +110,13 @@ function setup_filter() {
     iptables -w -A ${filter_default_chain} --destination "$n" --jump RETURN
   done
 
+  # Block link-local addresses such as cloud metadata services, unless
+  # allowed above
+  if [ "$allow_host_access" != "true" ]
+  then
+    iptables -w -A ${filter_default_chain} --destination 169.254.0.0/16 --jump DROP
+  fi
+
   for n in ${DENY_NETWORKS}; do
     if [ "$n" == "" ]
     then
@@ -104,8 +126,45 @@ function setup_filter() {
     iptables -w -A ${filter_default_chain} --destination "$n" --jump DROP
   done
 
+  # Create or flush egress chain; it is filled from the daemon's egress rules
+  # file and applies to every container, though never to the networks
+  # dropped above
+  iptables -w -N ${filter_egress_chain} 2> /dev/null || iptables -w -F ${filter_egress_chain}
+  iptables -w -A ${filter_default_chain} --jump ${filter_egress_chain}
+
+  # Create or flush input chain, for traffic from containers to the host
+  iptables -w -N ${filter_input_chain} 2> /dev/null || iptables -w -F ${filter_input_chain}
+
+  if [ "$allow_host_access" != "true" ]
+  then
+    # Always allow replies to connections the host made to containers
+    iptables -w -A ${filter_input_chain} -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT
+
+    for port in ${host_allowed_ports//,/ }; do
+      iptables -w -A ${filter_input_chain} --protocol tcp --destination-port $port --jump ACCEPT
+      iptables -w -A ${filter_input_chain} --protocol udp --destination-port $port --jump ACCEPT
+    done
+
+    iptables -w -A ${filter_input_chain} --jump REJECT --reject-with icmp-host-prohibited
+  fi
+
+  # Filter traffic to the host via ${filter_input_chain}
+  iptables -w -A INPUT -i ${GARDEN_NETWORK_INTERFACE_PREFIX}+ --jump ${filter_input_chain}
+  if [ -n "${network_bridge}" ]
+  then
+    iptables -w -A INPUT -i ${network_bridge} --jump ${filter_input_chain}
+  fi
+
   # Forward outbound traffic via ${filter_forward_chain}
   iptables -w -A FORWARD -i ${GARDEN_NETWORK_INTERFACE_PREFIX}+ --jump ${filter_forward_chain}
+  if [ -n "${network_bridge}" ]
+  then
+    iptables -w -A FORWARD -i ${network_bridge} --jump ${filter_forward_chain}
+
+    # Have traffic between containers on the bridge filtered too
+    modprobe br_netfilter 2> /dev/null || true
+    echo 1 > /proc/sys/net/bridge/bridge-nf-call-iptables
+  fi
 
   # Forward inbound traffic immediately
   default_interface=$(ip route show | grep default | cut -d' ' -f5 | head -1)
@@ -171,6 +230,101 @@ function setup_nat() {
       --to $(external_ip)
 }
 
+# Rewrite the SNAT rule and containers' port mappings for the host's current
+# external address, printing the old and new addresses if it has changed
+function refresh_external_ip() {
+  local new_ip=$(external_ip)
+
+  # the pool-wide SNAT rule has the address the rules were last set up
+  # for; those marked as containers' have their own external IPs
+  local old_ip=$(iptables -w -t nat -S ${nat_postrouting_chain} |
+    grep -v "\-\-comment" |
+    sed -n 's/.*-j SNAT --to-source \([^ ]*\).*/\1/p' | head -n 1)
+
+  if [ -z "${new_ip}" ] || [ -z "${old_ip}" ] || [ "${new_ip}" == "${old_ip}" ]
+  then
+    return 0
+  fi
+
+  iptables -w -t nat -S ${nat_postrouting_chain} |
+    grep "\-j SNAT\b" |
+    grep -v "\-\-comment" |
+    sed -e "s/-A/-D/" -e "s/\s\+\$//" |
+    xargs --no-run-if-empty --max-lines=1 iptables -w -t nat
+
+  iptables -w -t nat -A ${nat_postrouting_chain} \
+    --source ${POOL_NETWORK} \
+    --jump SNAT \
+    --to ${new_ip}
+
+  # Port mappings are DNAT rules for the old address in instance chains
+  local mappings=$(iptables -w -t nat -S |
+    grep "^-A ${nat_instance_prefix}.* -d ${old_ip}/32 " |
+    sed -e "s/\s\+\$//")
+
+  if [ -n "${mappings}" ]
+  then
+    echo "${mappings}" |
+      sed -e "s/^-A/-D/" |
+      xargs --no-run-if-empty --max-lines=1 iptables -w -t nat
+
+    echo "${mappings}" |
+      sed -e "s| -d ${old_ip}/32 | -d ${new_ip}/32 |" |
+      xargs --no-run-if-empty --max-lines=1 iptables -w -t nat
+  fi
+
+  echo "${old_ip} ${new_ip}"
+}
+
+# Remove the chains and rules of a container, given its id, outside of its
+# own net.sh
+function teardown_instance() {
+  local filter_instance_chain=${filter_instance_prefix}${1}
+  local nat_instance_chain=${nat_instance_prefix}${1}
+
+  iptables -w -S ${filter_forward_chain} 2> /dev/null |
+    grep -e "\-g ${filter_instance_chain}\b" -e "\-\-comment ${filter_instance_chain}\b" |
+    sed -e "s/-A/-D/" -e "s/\s\+\$//" |
+    xargs --no-run-if-empty --max-lines=1 iptables -w
+
+  iptables -w -F ${filter_instance_chain} 2> /dev/null || true
+  iptables -w -X ${filter_instance_chain} 2> /dev/null || true
+
+  iptables -w -t nat -S ${nat_prerouting_chain} 2> /dev/null |
+    grep "\-j ${nat_instance_chain}\b" |
+    sed -e "s/-A/-D/" -e "s/\s\+\$//" |
+    xargs --no-run-if-empty --max-lines=1 iptables -w -t nat
+
+  iptables -w -t nat -S ${nat_postrouting_chain} 2> /dev/null |
+    grep "\-\-comment ${nat_instance_chain}\b" |
+    sed -e "s/-A/-D/" -e "s/\s\+\$//" |
+    xargs --no-run-if-empty --max-lines=1 iptables -w -t nat
+
+  iptables -w -t nat -F ${nat_instance_chain} 2> /dev/null || true
+  iptables -w -t nat -X ${nat_instance_chain} 2> /dev/null || true
+}
+
+# Print the ids of the containers that have chains of their own
+function chains() {
+  (iptables -w -S; iptables -w -t nat -S) 2> /dev/null |
+    sed -n -e "s/^-N ${filter_instance_prefix}//p" -e "s/^-N ${nat_instance_prefix}//p" |
+    sort -u
+}
+
+# Tear down the rules of containers whose depot directories are gone, as
+# after a failed destroy, printing their ids. A container's directory is
+# created before its rules and removed after them, so the rules of
+# containers being created or destroyed are left alone.
+function sweep() {
+  for id in $(chains); do
+    if [ ! -d ${CONTAINER_DEPOT_PATH}/${id} ]
+    then
+      teardown_instance ${id}
+      echo ${id}
+    fi
+  done
+}
+
 case "${1}" in
   setup)
     setup_filter
@@ -178,11 +332,26 @@ case "${1}" in
 
     # Enable forwarding
     echo 1 > /proc/sys/net/ipv4/ip_forward
+
+    # Answer ARP for routed containers' addresses on the uplink
+    if [ -n "${network_proxy_arp_interface}" ]
+    then
+      echo 1 > /proc/sys/net/ipv4/conf/${network_proxy_arp_interface}/proxy_arp
+    fi
     ;;
   teardown)
     teardown_filter
     teardown_nat
     ;;
+  refresh_external_ip)
+    refresh_external_ip
+    ;;
+  sweep)
+    sweep
+    ;;
+  chains)
+    chains
+    ;;
   *)
     echo "Unknown command: ${1}" 1>&2
     exit 1
@@ -5,9 +5,13 @@ set -e
 action=$1
 container_path=$2
 overlay_path=$2/overlay
+workdir_path=$2/workdir
 rootfs_path=$2/rootfs
 base_path=$3
 
+# one of auto, aufs, overlay, overlayfs, or bind
+overlay_backend=${OVERLAY_BACKEND:-auto}
+
 function overlay_directory_in_rootfs() {
   # Skip if exists
   if [ ! -d $overlay_path/$1 ]
@@ -62,53 +66,82 @@ function current_fs() {
   done < /proc/mounts
 }
 
-function should_use_overlayfs() {
-  # load it so it's in /proc/filesystems
-  modprobe -q overlayfs >/dev/null 2>&1 || true
+# whether the given copy-on-write filesystem can be mounted on top of $1
+function supports() {
+  local fs=$2
 
-  # cannot mount overlayfs in aufs
-  if [ "$(current_fs $overlay_path)" == "aufs" ]; then
-    return 1
-  fi
+  # load it so it's in /proc/filesystems
+  modprobe -q $fs >/dev/null 2>&1 || true
 
-  # cannot mount overlayfs in overlayfs; whiteout not supported
-  if [ "$(current_fs $overlay_path)" == "overlayfs" ]; then
-    return 1
-  fi
+  # cannot nest copy-on-write filesystems; whiteouts are not supported
+  case "$(current_fs $1)" in
+    aufs|overlay|overlayfs)
+      return 1
+      ;;
+  esac
 
   # check if it's a known filesystem
-  grep -q overlayfs /proc/filesystems
+  grep -qw $fs /proc/filesystems
 }
 
-function should_use_aufs() {
-  # load it so it's in /proc/filesystems
-  modprobe -q aufs >/dev/null 2>&1 || true
-
-  # cannot mount aufs in aufs
-  if [ "$(current_fs $overlay_path)" == "aufs" ]; then
-    return 1
-  fi
-
-  # cannot mount aufs in overlayfs
-  if [ "$(current_fs $overlay_path)" == "overlayfs" ]; then
-    return 1
-  fi
+# prints the backend to use for overlays under $1
+function detect_backend() {
+  case "$overlay_backend" in
+    auto)
+      # overlay is the upstream successor to overlayfs, found in kernels >= 3.18
+      for fs in aufs overlay overlayfs; do
+        if supports $1 $fs; then
+          echo $fs
+          return 0
+        fi
+      done
+
+      echo bind
+      ;;
+    aufs|overlay|overlayfs)
+      if ! supports $1 $overlay_backend; then
+        echo "overlay backend not supported: $overlay_backend" >&2
+        return 1
+      fi
 
-  # check if it's a known filesystem
-  grep -q aufs /proc/filesystems
+      echo $overlay_backend
+      ;;
+    bind)
+      echo bind
+      ;;
+    *)
+      echo "unknown overlay backend: $overlay_backend" >&2
+      return 1
+      ;;
+  esac
 }
 
 function setup_fs() {
   mkdir -p $overlay_path
   mkdir -p $rootfs_path
 
-  if should_use_aufs; then
-    mount -n -t aufs -o br:$overlay_path=rw:$base_path=ro+wh none $rootfs_path
-  elif should_use_overlayfs; then
-    mount -n -t overlayfs -o rw,upperdir=$overlay_path,lowerdir=$base_path none $rootfs_path
-  else
-    setup_fs_other
-  fi
+  # recorded so that the container can be cloned
+  echo $base_path > $container_path/base
+
+  local backend
+  backend=$(detect_backend $overlay_path)
+
+  case "$backend" in
+    aufs)
+      mount -n -t aufs -o br:$overlay_path=rw:$base_path=ro+wh none $rootfs_path
+      ;;
+    overlay)
+      # the work directory must be empty and on the same filesystem as the upper
+      mkdir -p $workdir_path
+      mount -n -t overlay -o rw,lowerdir=$base_path,upperdir=$overlay_path,workdir=$workdir_path none $rootfs_path
+      ;;
+    overlayfs)
+      mount -n -t overlayfs -o rw,upperdir=$overlay_path,lowerdir=$base_path none $rootfs_path
+      ;;
+    bind)
+      setup_fs_other
+      ;;
+  esac
 }
 
 function rootfs_mountpoints() {
@@ -130,8 +163,30 @@ function teardown_fs() {
   return 1
 }
 
+# Layer a copy of another container's changes over its base, as of now
+function clone_fs() {
+  local source_path=$1
+
+  if [ ! -f $source_path/base ]; then
+    echo "cannot clone $source_path: its base rootfs is unknown" >&2
+    return 1
+  fi
+
+  base_path=$(cat $source_path/base)
+
+  mkdir -p $container_path
+  cp -a $source_path/overlay $overlay_path
+
+  setup_fs
+}
+
 if [ "$action" = "create" ]; then
   setup_fs
+elif [ "$action" = "clone" ]; then
+  clone_fs $3
+elif [ "$action" = "detect" ]; then
+  mkdir -p $container_path
+  detect_backend $container_path
 else
   teardown_fs
 fi
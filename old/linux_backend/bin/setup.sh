@@ -47,26 +47,97 @@ function mount_nested_cgroup() {
   done
 }
 
+# Use the cgroups delegated to us when running in a nested container, so
+# that our containers' cgroups are created beneath its own
+function mount_delegated_cgroup() {
+  [ -f /sys/fs/cgroup/garden-delegated ] || return 1
+
+  mkdir -p $1
+
+  if ! mountpoint -q $1; then
+    mount -t tmpfs -o uid=0,gid=0,mode=0755 cgroup $1
+  fi
+
+  for delegated_path in /sys/fs/cgroup/*/; do
+    subsystem=$(basename $delegated_path)
+
+    mkdir -p ${1}/$subsystem
+
+    if ! mountpoint -q ${1}/$subsystem; then
+      mount --bind $delegated_path ${1}/$subsystem
+    fi
+  done
+}
+
 if [ ! -d $cgroup_path ]
 then
-  mount_nested_cgroup $cgroup_path || \
+  mount_delegated_cgroup $cgroup_path || \
+    mount_nested_cgroup $cgroup_path || \
     mount_flat_cgroup $cgroup_path
 fi
 
+# Create the parent of the containers' cgroups in each hierarchy, e.g. so
+# they are accounted to a systemd slice
+if [ -n "${GARDEN_CGROUP_PARENT:-}" ]
+then
+  for system_path in ${cgroup_path}/*
+  do
+    parent_path=$system_path
+
+    for component in ${GARDEN_CGROUP_PARENT//\// }
+    do
+      parent_path=$parent_path/$component
+
+      mkdir -p $parent_path
+
+      # new cpusets are empty, and tasks cannot join a cpuset until both its
+      # cpus and mems are assigned
+      if [ -f $parent_path/cpuset.cpus ] && [ -z "$(cat $parent_path/cpuset.cpus)" ]
+      then
+        cat $(dirname $parent_path)/cpuset.cpus > $parent_path/cpuset.cpus
+        cat $(dirname $parent_path)/cpuset.mems > $parent_path/cpuset.mems
+      fi
+    done
+  done
+fi
+
 ./net.sh setup
 
+# Pipe every core dump to core.sh, which applies the crashing container's
+# policy; otherwise leave the host's core_pattern alone
+if [ -n "${GARDEN_CORE_DUMPS_DIRECTORY:-}" ]
+then
+  mkdir -p $GARDEN_CORE_DUMPS_DIRECTORY
+
+  core_pattern="|$PWD/core.sh $CONTAINER_DEPOT_PATH $GARDEN_CORE_DUMPS_DIRECTORY %P %c %t %e"
+
+  # the kernel truncates longer patterns
+  if [ ${#core_pattern} -gt 127 ]
+  then
+    echo "core_pattern is too long: $core_pattern" >&2
+    exit 1
+  fi
+
+  echo "$core_pattern" > /proc/sys/kernel/core_pattern
+fi
+
 # Disable AppArmor if possible
 if [ -x /etc/init.d/apparmor ]; then
   /etc/init.d/apparmor teardown
 fi
 
-# quotaon(8) exits with non-zero status when quotas are ENABLED
-if [ "$DISK_QUOTA_ENABLED" = "true" ] && quotaon -p $CONTAINER_DEPOT_MOUNT_POINT_PATH > /dev/null 2>&1
-then
-  mount -o remount,usrjquota=aquota.user,grpjquota=aquota.group,jqfmt=vfsv0 $CONTAINER_DEPOT_MOUNT_POINT_PATH
-  quotacheck -ugmb -F vfsv0 $CONTAINER_DEPOT_MOUNT_POINT_PATH
-  quotaon $CONTAINER_DEPOT_MOUNT_POINT_PATH
-elif [ "$DISK_QUOTA_ENABLED" = "false" ] && ! quotaon -p $CONTAINER_DEPOT_MOUNT_POINT_PATH > /dev/null 2>&1
+# project quotas must be enabled when the filesystem is mounted, and btrfs
+# quotas are managed separately, so only user quotas are set up here
+if [ "${DISK_QUOTA_TYPE:-user}" = "user" ]
 then
-  quotaoff $CONTAINER_DEPOT_MOUNT_POINT_PATH
+  # quotaon(8) exits with non-zero status when quotas are ENABLED
+  if [ "$DISK_QUOTA_ENABLED" = "true" ] && quotaon -p $CONTAINER_DEPOT_MOUNT_POINT_PATH > /dev/null 2>&1
+  then
+    mount -o remount,usrjquota=aquota.user,grpjquota=aquota.group,jqfmt=vfsv0 $CONTAINER_DEPOT_MOUNT_POINT_PATH
+    quotacheck -ugmb -F vfsv0 $CONTAINER_DEPOT_MOUNT_POINT_PATH
+    quotaon $CONTAINER_DEPOT_MOUNT_POINT_PATH
+  elif [ "$DISK_QUOTA_ENABLED" = "false" ] && ! quotaon -p $CONTAINER_DEPOT_MOUNT_POINT_PATH > /dev/null 2>&1
+  then
+    quotaoff $CONTAINER_DEPOT_MOUNT_POINT_PATH
+  fi
 fi
@@ -0,0 +1,289 @@
+package linux_backend
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Bundle describes a container's configuration in the shape of an OCI
+// runtime bundle's config.json, so that it can be reproduced and debugged
+// with other runtimes and tooling. Settings without an OCI equivalent, such
+// as the container's network, are given as annotations.
+type Bundle struct {
+	OCIVersion  string            `json:"ociVersion"`
+	Root        BundleRoot        `json:"root"`
+	Hostname    string            `json:"hostname"`
+	Process     BundleProcess     `json:"process"`
+	Mounts      []BundleMount     `json:"mounts"`
+	Linux       BundleLinux       `json:"linux"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type BundleRoot struct {
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly"`
+}
+
+type BundleProcess struct {
+	User BundleUser `json:"user"`
+	Env  []string   `json:"env"`
+}
+
+type BundleUser struct {
+	UID uint32 `json:"uid"`
+}
+
+type BundleMount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Options     []string `json:"options"`
+}
+
+type BundleLinux struct {
+	Namespaces []BundleNamespace `json:"namespaces"`
+	Resources  BundleResources   `json:"resources"`
+}
+
+type BundleNamespace struct {
+	Type string `json:"type"`
+	Path string `json:"path,omitempty"`
+}
+
+type BundleResources struct {
+	Memory *BundleMemory `json:"memory,omitempty"`
+	CPU    *BundleCPU    `json:"cpu,omitempty"`
+	Pids   *BundlePids   `json:"pids,omitempty"`
+}
+
+type BundleMemory struct {
+	Limit uint64 `json:"limit"`
+	Swap  uint64 `json:"swap"`
+}
+
+type BundleCPU struct {
+	Shares uint64 `json:"shares,omitempty"`
+	Quota  int64  `json:"quota,omitempty"`
+	Period uint64 `json:"period,omitempty"`
+	Cpus   string `json:"cpus,omitempty"`
+}
+
+type BundlePids struct {
+	Limit int64 `json:"limit"`
+}
+
+// the OCI runtime spec version the bundle is shaped after
+const BundleOCIVersion = "1.0.0"
+
+// the namespaces wshd creates for every container, by their OCI names
+var bundleNamespaces = []struct {
+	oci  string
+	proc string
+}{
+	{"pid", "pid"},
+	{"network", "net"},
+	{"ipc", "ipc"},
+	{"uts", "uts"},
+	{"mount", "mnt"},
+}
+
+// Bundle renders the container's configuration as it was created and has
+// since been limited.
+func (c *LinuxContainer) Bundle() (Bundle, error) {
+	config, err := readConfig(path.Join(c.path, "etc", "config"))
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	mounts, err := readBindMounts(path.Join(c.path, "lib", "hook-child-before-pivot.sh"), config["rootfs_path"])
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	for _, mount := range strings.Split(config["tmpfs_mounts"], ",") {
+		if mount == "" {
+			continue
+		}
+
+		segs := strings.SplitN(mount, ":", 2)
+
+		options := []string{"mode=1777"}
+		if len(segs) == 2 {
+			options = append(options, "size="+segs[1])
+		}
+
+		mounts = append(mounts, BundleMount{
+			Destination: segs[0],
+			Type:        "tmpfs",
+			Source:      "tmpfs",
+			Options:     options,
+		})
+	}
+
+	pid, pidErr := c.wshdPID()
+
+	namespaces := []BundleNamespace{}
+	for _, ns := range bundleNamespaces {
+		namespace := BundleNamespace{Type: ns.oci}
+		if pidErr == nil {
+			namespace.Path = fmt.Sprintf("/proc/%d/ns/%s", pid, ns.proc)
+		}
+
+		namespaces = append(namespaces, namespace)
+	}
+
+	resources := BundleResources{}
+
+	c.memoryMutex.RLock()
+	if c.currentMemoryLimits != nil {
+		// validated when the container was created
+		swap, _ := strconv.ParseUint(c.properties[MemorySwapProperty], 10, 64)
+
+		resources.Memory = &BundleMemory{
+			Limit: c.currentMemoryLimits.LimitInBytes,
+			Swap:  c.currentMemoryLimits.LimitInBytes + swap,
+		}
+	}
+	c.memoryMutex.RUnlock()
+
+	cpu := &BundleCPU{Cpus: config["cpuset_cpus"]}
+	cpu.Quota, _ = strconv.ParseInt(config["cpu_quota_us"], 10, 64)
+	cpu.Period, _ = strconv.ParseUint(config["cpu_period_us"], 10, 64)
+
+	c.cpuMutex.RLock()
+	if c.currentCPULimits != nil {
+		cpu.Shares = c.currentCPULimits.LimitInShares
+	}
+	c.cpuMutex.RUnlock()
+
+	if *cpu != (BundleCPU{}) {
+		resources.CPU = cpu
+	}
+
+	if pidsMax, _ := strconv.ParseInt(config["pids_max"], 10, 64); pidsMax > 0 {
+		resources.Pids = &BundlePids{Limit: pidsMax}
+	}
+
+	annotations := map[string]string{
+		"garden.handle": c.handle,
+
+		"garden.network.host-ip":         c.resources.Network.HostIP().String(),
+		"garden.network.container-ip":    c.resources.Network.ContainerIP().String(),
+		"garden.network.prefix-length":   strconv.Itoa(c.resources.Network.PrefixLength()),
+		"garden.network.host-iface":      config["network_host_iface"],
+		"garden.network.container-iface": config["network_container_iface"],
+		"garden.network.disable-snat":    config["disable_snat"],
+		"garden.network.mtu":             config["container_iface_mtu"],
+	}
+
+	for _, key := range []string{"blkio_read_bps", "blkio_write_bps", "blkio_read_iops", "blkio_write_iops", "scratch_size", "shm_size", "core_dumps", "drop_capabilities"} {
+		if value := config[key]; value != "" && value != "0" {
+			annotations["garden."+strings.Replace(key, "_", "-", -1)] = value
+		}
+	}
+
+	c.diskMutex.RLock()
+	if c.currentDiskLimits != nil {
+		annotations["garden.disk.byte-hard"] = strconv.FormatUint(c.currentDiskLimits.ByteHard, 10)
+		annotations["garden.disk.inode-hard"] = strconv.FormatUint(c.currentDiskLimits.InodeHard, 10)
+	}
+	c.diskMutex.RUnlock()
+
+	c.bandwidthMutex.RLock()
+	if c.currentBandwidthLimits != nil {
+		annotations["garden.bandwidth.rate"] = strconv.FormatUint(c.currentBandwidthLimits.RateInBytesPerSecond, 10)
+		annotations["garden.bandwidth.burst-rate"] = strconv.FormatUint(c.currentBandwidthLimits.BurstRateInBytesPerSecond, 10)
+	}
+	c.bandwidthMutex.RUnlock()
+
+	c.netInsMutex.RLock()
+	for _, in := range c.netIns {
+		annotations[fmt.Sprintf("garden.net-in.%d", in.HostPort)] = strconv.FormatUint(uint64(in.ContainerPort), 10)
+	}
+	c.netInsMutex.RUnlock()
+
+	uid, _ := strconv.ParseUint(config["user_uid"], 10, 32)
+
+	return Bundle{
+		OCIVersion: BundleOCIVersion,
+		Root: BundleRoot{
+			Path:     config["rootfs_path"],
+			Readonly: config["read_only_rootfs"] == "true",
+		},
+		Hostname: c.id,
+		Process: BundleProcess{
+			User: BundleUser{UID: uint32(uid)},
+			Env:  c.CurrentEnvVars(),
+		},
+		Mounts: mounts,
+		Linux: BundleLinux{
+			Namespaces: namespaces,
+			Resources:  resources,
+		},
+		Annotations: annotations,
+	}, nil
+}
+
+// readConfig reads the key=value lines that setup.sh writes to etc/config
+func readConfig(configPath string) (map[string]string, error) {
+	file, err := os.Open(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	config := map[string]string{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		segs := strings.SplitN(scanner.Text(), "=", 2)
+		if len(segs) == 2 {
+			config[segs[0]] = segs[1]
+		}
+	}
+
+	return config, scanner.Err()
+}
+
+// readBindMounts recovers the bind mounts that the pool wrote into the
+// container's hook as mount commands
+func readBindMounts(hookPath string, rootfsPath string) ([]BundleMount, error) {
+	file, err := os.Open(hookPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	mounts := []BundleMount{}
+	indices := map[string]int{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		switch {
+		case len(fields) == 5 && fields[0] == "mount" && fields[2] == "--bind":
+			indices[fields[4]] = len(mounts)
+
+			mounts = append(mounts, BundleMount{
+				Destination: "/" + strings.TrimPrefix(strings.TrimPrefix(fields[4], rootfsPath), "/"),
+				Type:        "bind",
+				Source:      fields[3],
+				Options:     []string{"bind", "rw"},
+			})
+
+		case len(fields) == 5 && fields[0] == "mount" && fields[3] == "remount,bind,ro":
+			if i, found := indices[fields[4]]; found {
+				mounts[i].Options = []string{"bind", "ro"}
+			}
+		}
+	}
+
+	return mounts, scanner.Err()
+}
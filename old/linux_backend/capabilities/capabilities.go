@@ -0,0 +1,192 @@
+package capabilities
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type UnknownCapabilityError struct {
+	Name string
+}
+
+func (e UnknownCapabilityError) Error() string {
+	return fmt.Sprintf("unknown capability: %s", e.Name)
+}
+
+// capability numbers as defined in linux/capability.h
+var all = map[string]int{
+	"CAP_CHOWN":            0,
+	"CAP_DAC_OVERRIDE":     1,
+	"CAP_DAC_READ_SEARCH":  2,
+	"CAP_FOWNER":           3,
+	"CAP_FSETID":           4,
+	"CAP_KILL":             5,
+	"CAP_SETGID":           6,
+	"CAP_SETUID":           7,
+	"CAP_SETPCAP":          8,
+	"CAP_LINUX_IMMUTABLE":  9,
+	"CAP_NET_BIND_SERVICE": 10,
+	"CAP_NET_BROADCAST":    11,
+	"CAP_NET_ADMIN":        12,
+	"CAP_NET_RAW":          13,
+	"CAP_IPC_LOCK":         14,
+	"CAP_IPC_OWNER":        15,
+	"CAP_SYS_MODULE":       16,
+	"CAP_SYS_RAWIO":        17,
+	"CAP_SYS_CHROOT":       18,
+	"CAP_SYS_PTRACE":       19,
+	"CAP_SYS_PACCT":        20,
+	"CAP_SYS_ADMIN":        21,
+	"CAP_SYS_BOOT":         22,
+	"CAP_SYS_NICE":         23,
+	"CAP_SYS_RESOURCE":     24,
+	"CAP_SYS_TIME":         25,
+	"CAP_SYS_TTY_CONFIG":   26,
+	"CAP_MKNOD":            27,
+	"CAP_LEASE":            28,
+	"CAP_AUDIT_WRITE":      29,
+	"CAP_AUDIT_CONTROL":    30,
+	"CAP_SETFCAP":          31,
+	"CAP_MAC_OVERRIDE":     32,
+	"CAP_MAC_ADMIN":        33,
+	"CAP_SYSLOG":           34,
+	"CAP_WAKE_ALARM":       35,
+	"CAP_BLOCK_SUSPEND":    36,
+}
+
+// the capabilities retained by containers that do not ask for anything else;
+// notably excludes CAP_SYS_ADMIN, CAP_NET_ADMIN, CAP_SYS_MODULE, etc.
+var Default = []string{
+	"CAP_AUDIT_WRITE",
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_FOWNER",
+	"CAP_FSETID",
+	"CAP_KILL",
+	"CAP_MKNOD",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_NET_RAW",
+	"CAP_SETFCAP",
+	"CAP_SETGID",
+	"CAP_SETPCAP",
+	"CAP_SETUID",
+	"CAP_SYS_CHROOT",
+}
+
+// Parse turns a comma-separated list of capability names into the set to
+// retain. Names are case-insensitive and the CAP_ prefix is optional.
+//
+// An empty list yields the default set; "all" retains every capability.
+func Parse(list string) ([]string, error) {
+	list = strings.TrimSpace(list)
+
+	if list == "" {
+		return Default, nil
+	}
+
+	if strings.ToLower(list) == "all" {
+		return All(), nil
+	}
+
+	seen := map[string]bool{}
+	retained := []string{}
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(name, "CAP_") {
+			name = "CAP_" + name
+		}
+
+		if _, found := all[name]; !found {
+			return nil, UnknownCapabilityError{name}
+		}
+
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		retained = append(retained, name)
+	}
+
+	sort.Strings(retained)
+
+	return retained, nil
+}
+
+// All returns the name of every known capability, sorted.
+func All() []string {
+	names := make([]string, 0, len(all))
+
+	for name := range all {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Dropped returns the numbers of every known capability not in retained,
+// suitable for removal from the bounding set.
+func Dropped(retained []string) []int {
+	keep := map[string]bool{}
+	for _, name := range retained {
+		keep[name] = true
+	}
+
+	dropped := []int{}
+
+	for name, number := range all {
+		if !keep[name] {
+			dropped = append(dropped, number)
+		}
+	}
+
+	sort.Ints(dropped)
+
+	return dropped
+}
+
+// Privileged returns the capabilities in retained beyond the default set,
+// which only privileged containers may retain.
+func Privileged(retained []string) []string {
+	unprivileged := map[string]bool{}
+	for _, name := range Default {
+		unprivileged[name] = true
+	}
+
+	privileged := []string{}
+
+	for _, name := range retained {
+		if !unprivileged[name] {
+			privileged = append(privileged, name)
+		}
+	}
+
+	return privileged
+}
+
+// Names returns the names of the given capability numbers, in the same
+// order; unknown numbers are skipped.
+func Names(numbers []int) []string {
+	byNumber := map[int]string{}
+	for name, number := range all {
+		byNumber[number] = name
+	}
+
+	names := []string{}
+
+	for _, number := range numbers {
+		if name, found := byNumber[number]; found {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
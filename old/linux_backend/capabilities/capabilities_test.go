@@ -0,0 +1,68 @@
+package capabilities_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/capabilities"
+)
+
+var _ = Describe("Capabilities", func() {
+	Describe("parsing", func() {
+		It("returns the default set for an empty list", func() {
+			retained, err := capabilities.Parse("")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(retained).Should(Equal(capabilities.Default))
+		})
+
+		It("does not retain CAP_SYS_ADMIN or CAP_NET_ADMIN by default", func() {
+			Ω(capabilities.Default).ShouldNot(ContainElement("CAP_SYS_ADMIN"))
+			Ω(capabilities.Default).ShouldNot(ContainElement("CAP_NET_ADMIN"))
+		})
+
+		It("returns every capability for 'all'", func() {
+			retained, err := capabilities.Parse("all")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(retained).Should(Equal(capabilities.All()))
+		})
+
+		It("normalizes case and the CAP_ prefix, and removes duplicates", func() {
+			retained, err := capabilities.Parse("net_raw, CAP_CHOWN,chown")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(retained).Should(Equal([]string{"CAP_CHOWN", "CAP_NET_RAW"}))
+		})
+
+		Context("when a capability is unknown", func() {
+			It("returns UnknownCapabilityError", func() {
+				_, err := capabilities.Parse("chown,bogus")
+				Ω(err).Should(Equal(capabilities.UnknownCapabilityError{Name: "CAP_BOGUS"}))
+			})
+		})
+	})
+
+	Describe("determining the dropped set", func() {
+		It("returns the numbers of every capability not retained", func() {
+			dropped := capabilities.Dropped(capabilities.All())
+			Ω(dropped).Should(BeEmpty())
+
+			dropped = capabilities.Dropped([]string{"CAP_CHOWN"})
+			Ω(dropped).ShouldNot(ContainElement(0))
+			Ω(dropped).Should(ContainElement(21))
+			Ω(dropped).Should(HaveLen(len(capabilities.All()) - 1))
+		})
+	})
+
+	Describe("determining the privileged set", func() {
+		It("returns the capabilities retained beyond the default set", func() {
+			Ω(capabilities.Privileged(capabilities.Default)).Should(BeEmpty())
+			Ω(capabilities.Privileged([]string{"CAP_CHOWN", "CAP_SYS_ADMIN"})).Should(Equal([]string{"CAP_SYS_ADMIN"}))
+			Ω(capabilities.Privileged(capabilities.All())).Should(ContainElement("CAP_NET_ADMIN"))
+		})
+	})
+
+	Describe("naming", func() {
+		It("returns the name of each number, skipping unknown ones", func() {
+			Ω(capabilities.Names([]int{21, 0, 99})).Should(Equal([]string{"CAP_SYS_ADMIN", "CAP_CHOWN"}))
+		})
+	})
+})
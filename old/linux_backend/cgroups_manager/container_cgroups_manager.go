@@ -7,12 +7,16 @@ import (
 )
 
 type ContainerCgroupsManager struct {
-	cgroupsPath string
-	containerID string
+	cgroupsPath  string
+	cgroupParent string
+	containerID  string
 }
 
-func New(cgroupsPath, containerID string) *ContainerCgroupsManager {
-	return &ContainerCgroupsManager{cgroupsPath, containerID}
+// New returns a manager for the container's cgroups, which live under
+// cgroupParent (e.g. "system.slice/garden", or "" for the root) in each
+// subsystem's hierarchy.
+func New(cgroupsPath, cgroupParent, containerID string) *ContainerCgroupsManager {
+	return &ContainerCgroupsManager{cgroupsPath, cgroupParent, containerID}
 }
 
 func (m *ContainerCgroupsManager) Set(subsystem, name, value string) error {
@@ -29,5 +33,5 @@ func (m *ContainerCgroupsManager) Get(subsystem, name string) (string, error) {
 }
 
 func (m *ContainerCgroupsManager) SubsystemPath(subsystem string) string {
-	return path.Join(m.cgroupsPath, subsystem, "instance-"+m.containerID)
+	return path.Join(m.cgroupsPath, subsystem, m.cgroupParent, "instance-"+m.containerID)
 }
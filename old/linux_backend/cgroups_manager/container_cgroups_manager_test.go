@@ -21,7 +21,7 @@ var _ = Describe("Container cgroups", func() {
 
 		cgroupsPath = tmpdir
 
-		cgroupsManager = cgroups_manager.New(cgroupsPath, "some-container-id")
+		cgroupsManager = cgroups_manager.New(cgroupsPath, "", "some-container-id")
 	})
 
 	Describe("setting", func() {
@@ -74,5 +74,15 @@ var _ = Describe("Container cgroups", func() {
 			))
 
 		})
+
+		Context("when a cgroup parent is configured", func() {
+			It("returns <path>/<subsystem>/<parent>/instance-<container-id>", func() {
+				cgroupsManager = cgroups_manager.New(cgroupsPath, "system.slice/garden", "some-container-id")
+
+				Ω(cgroupsManager.SubsystemPath("memory")).Should(Equal(
+					path.Join(cgroupsPath, "memory", "system.slice", "garden", "instance-some-container-id"),
+				))
+			})
+		})
 	})
 })
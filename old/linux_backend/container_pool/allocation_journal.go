@@ -0,0 +1,100 @@
+package container_pool
+
+import (
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/allocation_journal"
+)
+
+// journaledPortPool journals each port a container acquires before handing
+// it out, as they are otherwise only recorded when the container is
+// snapshotted.
+type journaledPortPool struct {
+	linux_backend.PortPool
+
+	journal allocation_journal.Journal
+
+	id string
+}
+
+func (p *LinuxContainerPool) containerPortPool(id string) linux_backend.PortPool {
+	return &journaledPortPool{
+		PortPool: p.portPool,
+		journal:  p.journal,
+		id:       id,
+	}
+}
+
+func (p *journaledPortPool) Acquire() (uint32, error) {
+	port, err := p.PortPool.Acquire()
+	if err != nil {
+		return 0, err
+	}
+
+	err = p.journal.AcquirePort(p.id, port)
+	if err != nil {
+		p.PortPool.Release(port)
+		return 0, err
+	}
+
+	return port, nil
+}
+
+// Release journals the release before returning the port to the pool. If
+// it cannot be journaled the port is not returned, as after a restart the
+// journal would still give it to the container.
+func (p *journaledPortPool) Release(port uint32) {
+	err := p.journal.ReleasePort(p.id, port)
+	if err != nil {
+		return
+	}
+
+	p.PortPool.Release(port)
+}
+
+func (p *LinuxContainerPool) journalResources(id string, resources *linux_backend.Resources) error {
+	err := p.journal.AcquireNetwork(id, resources.Network)
+	if err != nil {
+		return err
+	}
+
+	for _, port := range resources.Ports {
+		err := p.journal.AcquirePort(id, port)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseJournal records the container's resources as released before they
+// are returned to the pools. Failing to is not fatal: anything the journal
+// still has for a container that is gone is dropped when pruning.
+func (p *LinuxContainerPool) releaseJournal(logger lager.Logger, id string) {
+	err := p.journal.Release(id)
+	if err != nil {
+		logger.Error("failed-to-journal-release", err)
+	}
+}
+
+func mergePorts(ports, more []uint32) []uint32 {
+	merged := append([]uint32{}, ports...)
+
+	for _, port := range more {
+		found := false
+		for _, existing := range merged {
+			if existing == port {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			merged = append(merged, port)
+		}
+	}
+
+	return merged
+}
@@ -1,17 +1,20 @@
 package container_pool
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/url"
 	"os"
 	"os/exec"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudfoundry-incubator/garden/api"
@@ -19,7 +22,9 @@ import (
 	"github.com/pivotal-golang/lager"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/allocation_journal"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/bandwidth_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/capabilities"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/cgroups_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
@@ -43,17 +48,43 @@ type LinuxContainerPool struct {
 	denyNetworks  []string
 	allowNetworks []string
 
+	allowedRootFSs []string
+
+	// environment given to every container, beneath its own
+	defaultEnv []string
+
 	rootfsProviders map[string]rootfs_provider.RootFSProvider
 
+	// providers that are only given explicitly to CreateWithRootFS, by the
+	// scheme they were given for, so that the rootfses they provided can be
+	// cleaned up; specs' RootFSPaths never resolve to them
+	explicitRootFSProviders map[string]rootfs_provider.RootFSProvider
+
 	uidPool     uid_pool.UIDPool
 	networkPool network_pool.NetworkPool
 	portPool    linux_backend.PortPool
 
-	runner command_runner.CommandRunner
+	journal allocation_journal.Journal
+
+	// resources set aside for containers yet to be created, by handle
+	reservations      map[string]*linux_backend.Resources
+	reservationsMutex *sync.Mutex
+
+	runner   command_runner.CommandRunner
+	resolver linux_backend.Resolver
 
 	quotaManager quota_manager.QuotaManager
 
+	processOutputLimit process_tracker.OutputLimit
+
+	hooks Hooks
+
 	containerIDs chan string
+
+	// the index of the external IP the next container is given, of those
+	// in sysconfig, unless it chooses its own
+	externalIPIndex int
+	externalIPMutex *sync.Mutex
 }
 
 func New(
@@ -64,9 +95,15 @@ func New(
 	uidPool uid_pool.UIDPool,
 	networkPool network_pool.NetworkPool,
 	portPool linux_backend.PortPool,
+	journal allocation_journal.Journal,
 	denyNetworks, allowNetworks []string,
+	allowedRootFSs []string,
+	defaultEnv []string,
 	runner command_runner.CommandRunner,
+	resolver linux_backend.Resolver,
 	quotaManager quota_manager.QuotaManager,
+	processOutputLimit process_tracker.OutputLimit,
+	hooks Hooks,
 ) *LinuxContainerPool {
 	pool := &LinuxContainerPool{
 		logger: logger.Session("pool"),
@@ -76,20 +113,37 @@ func New(
 
 		sysconfig: sysconfig,
 
-		rootfsProviders: rootfsProviders,
+		rootfsProviders:         rootfsProviders,
+		explicitRootFSProviders: map[string]rootfs_provider.RootFSProvider{},
 
 		allowNetworks: allowNetworks,
 		denyNetworks:  denyNetworks,
 
+		allowedRootFSs: allowedRootFSs,
+
+		defaultEnv: defaultEnv,
+
 		uidPool:     uidPool,
 		networkPool: networkPool,
 		portPool:    portPool,
 
-		runner: runner,
+		journal: journal,
+
+		reservations:      map[string]*linux_backend.Resources{},
+		reservationsMutex: new(sync.Mutex),
+
+		runner:   runner,
+		resolver: resolver,
 
 		quotaManager: quotaManager,
 
+		processOutputLimit: processOutputLimit,
+
+		hooks: hooks,
+
 		containerIDs: make(chan string),
+
+		externalIPMutex: new(sync.Mutex),
 	}
 
 	go pool.generateContainerIDs()
@@ -115,6 +169,7 @@ func (p *LinuxContainerPool) Setup() error {
 		"CONTAINER_DEPOT_PATH=" + p.depotPath,
 		"CONTAINER_DEPOT_MOUNT_POINT_PATH=" + p.quotaManager.MountPoint(),
 		fmt.Sprintf("DISK_QUOTA_ENABLED=%v", p.quotaManager.IsEnabled()),
+		"DISK_QUOTA_TYPE=" + string(p.quotaManager.Type()),
 		"PATH=" + os.Getenv("PATH"),
 	}
 
@@ -126,6 +181,135 @@ func (p *LinuxContainerPool) Setup() error {
 	return nil
 }
 
+// RefreshExternalIP points the SNAT rule for containers' traffic and their
+// port mappings at the host's current external address, if it has changed
+// since they were set up, as after a DHCP renewal.
+func (p *LinuxContainerPool) RefreshExternalIP() error {
+	refreshOut := new(bytes.Buffer)
+
+	refresh := exec.Command(path.Join(p.binPath, "net.sh"), "refresh_external_ip")
+	refresh.Env = []string{
+		"POOL_NETWORK=" + p.networkPool.Network().String(),
+		"PATH=" + os.Getenv("PATH"),
+	}
+	refresh.Stdout = refreshOut
+
+	err := p.runner.Run(refresh)
+	if err != nil {
+		return err
+	}
+
+	// net.sh prints the old and new addresses if they differed
+	changed := strings.Fields(refreshOut.String())
+	if len(changed) == 2 {
+		p.logger.Info("external-ip-changed", lager.Data{
+			"old": changed[0],
+			"new": changed[1],
+		})
+	}
+
+	return nil
+}
+
+// SweepRules removes the iptables chains and rules of containers that no
+// longer have a directory in the depot, such as those left behind when
+// destroying a container failed part way.
+func (p *LinuxContainerPool) SweepRules() error {
+	sweepOut := new(bytes.Buffer)
+
+	sweep := exec.Command(path.Join(p.binPath, "net.sh"), "sweep")
+	sweep.Env = []string{
+		"CONTAINER_DEPOT_PATH=" + p.depotPath,
+		"PATH=" + os.Getenv("PATH"),
+	}
+	sweep.Stdout = sweepOut
+
+	err := p.runner.Run(sweep)
+	if err != nil {
+		return err
+	}
+
+	// net.sh prints the id of each container it swept
+	swept := strings.Fields(sweepOut.String())
+	if len(swept) > 0 {
+		p.logger.Info("swept-orphaned-rules", lager.Data{
+			"ids": swept,
+		})
+	}
+
+	return nil
+}
+
+// RuleIDs returns the ids of the containers that have iptables chains of
+// their own.
+func (p *LinuxContainerPool) RuleIDs() ([]string, error) {
+	chainsOut := new(bytes.Buffer)
+
+	chains := exec.Command(path.Join(p.binPath, "net.sh"), "chains")
+	chains.Stdout = chainsOut
+
+	err := p.runner.Run(chains)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(chainsOut.String()), nil
+}
+
+// DepotIDs returns the ids of the containers that have depot directories.
+func (p *LinuxContainerPool) DepotIDs() ([]string, error) {
+	entries, err := ioutil.ReadDir(p.depotPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, entry := range entries {
+		if entry.Name() == "tmp" || !entry.IsDir() {
+			continue
+		}
+
+		ids = append(ids, entry.Name())
+	}
+
+	return ids, nil
+}
+
+// nextExternalIP returns each of the server's external IPs in turn, or ""
+// for the pool-wide SNAT rule if it has none
+func (p *LinuxContainerPool) nextExternalIP() string {
+	if len(p.sysconfig.ExternalIPs) == 0 {
+		return ""
+	}
+
+	p.externalIPMutex.Lock()
+	defer p.externalIPMutex.Unlock()
+
+	ip := p.sysconfig.ExternalIPs[p.externalIPIndex%len(p.sysconfig.ExternalIPs)]
+	p.externalIPIndex++
+
+	return ip
+}
+
+func (p *LinuxContainerPool) hasExternalIP(ip string) bool {
+	for _, externalIP := range p.sysconfig.ExternalIPs {
+		if net.ParseIP(externalIP).Equal(net.ParseIP(ip)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// the type of quotas containers' rootfses must be set up for, if any
+func (p *LinuxContainerPool) diskQuotaType() string {
+	if !p.quotaManager.IsEnabled() {
+		return ""
+	}
+
+	return string(p.quotaManager.Type())
+}
+
 func formatNetworks(networks []string) string {
 	return strings.Join(networks, " ")
 }
@@ -159,25 +343,222 @@ func (p *LinuxContainerPool) Prune(keep map[string]bool) error {
 		}
 	}
 
-	return nil
+	// everything not kept has been destroyed, or never got as far as the
+	// depot, so no longer holds anything
+	return p.journal.Compact(keep)
 }
 
-func (p *LinuxContainerPool) Create(spec api.ContainerSpec) (c linux_backend.Container, err error) {
+// RegisterExplicitRootFSProvider lets CreateWithRootFS be given provider
+// for rootfses with scheme, and the rootfses it provides be cleaned up, even
+// after a restart. It must be called before the pool is used.
+func (p *LinuxContainerPool) RegisterExplicitRootFSProvider(scheme string, provider rootfs_provider.RootFSProvider) {
+	p.explicitRootFSProviders[scheme] = provider
+}
+
+func (p *LinuxContainerPool) Create(spec api.ContainerSpec, cancelled <-chan struct{}) (linux_backend.Container, error) {
+	return p.CreateWithRootFS(spec, nil, cancelled)
+}
+
+// CreateWithRootFS creates a container whose rootfs is provided by provider,
+// which must have been registered with RegisterExplicitRootFSProvider for
+// spec.RootFSPath's scheme, rather than by the provider the scheme names. It
+// is for rootfses that clients mustn't be able to ask for, such as a copy of
+// another container's. A nil provider is the same as Create.
+func (p *LinuxContainerPool) CreateWithRootFS(spec api.ContainerSpec, provider rootfs_provider.RootFSProvider, cancelled <-chan struct{}) (c linux_backend.Container, err error) {
 	id := <-p.containerIDs
+	handle := getHandle(spec.Handle, id)
 	containerPath := path.Join(p.depotPath, id)
-	pLog := p.logger.Session(id)
+
+	// everything the container logs, from creation to destruction, is tagged
+	// with its handle
+	pLog := p.logger.Session(id, containerLogData(handle, spec.Properties))
 
 	pLog.Info("creating")
 
-	resources, err := p.aquirePoolResources()
+	if provider == nil && !rootFSAllowed(spec.RootFSPath, p.allowedRootFSs) {
+		err := RootFSNotAllowedError{spec.RootFSPath}
+		pLog.Error("rootfs-not-allowed", err)
+		return nil, err
+	}
+
+	config, err := containerConfig(spec.Properties)
+	if err != nil {
+		pLog.Error("invalid-properties", err)
+		return nil, err
+	}
+
+	// the properties are valid, so what remains is checking them against the
+	// server's configuration; parse errors can't happen from here on
+	nested, _ := boolProperty(spec.Properties, NestedProperty)
+	if nested && !p.sysconfig.AllowPrivilegedContainers {
+		err := PrivilegedContainersNotAllowedError{NestedProperty}
+		pLog.Error("privileged-container-not-allowed", err)
+		return nil, err
+	}
+
+	// retaining more than the default capabilities would defeat the
+	// bounding set as surely as nesting
+	retained, _ := capabilities.Parse(spec.Properties[CapabilitiesProperty])
+	if len(capabilities.Privileged(retained)) > 0 && !p.sysconfig.AllowPrivilegedContainers {
+		err := PrivilegedContainersNotAllowedError{CapabilitiesProperty}
+		pLog.Error("privileged-container-not-allowed", err)
+		return nil, err
+	}
+
+	// a policy that won't be applied would silently lose or keep cores
+	if policy := spec.Properties[CoreDumpsProperty]; policy != "" && p.sysconfig.CoreDumpsDirectory == "" {
+		err := CoreDumpsNotCapturedError{policy}
+		pLog.Error("core-dumps-not-captured", err)
+		return nil, err
+	}
+
+	// the path out of the host would drop the container's larger packets
+	mtu, _ := uintProperty(spec.Properties, MTUProperty)
+	if p.sysconfig.NetworkUplinkMTU != 0 && mtu > uint64(p.sysconfig.NetworkUplinkMTU) {
+		err := MTUExceedsUplinkError{mtu, p.sysconfig.NetworkUplinkMTU}
+		pLog.Error("mtu-exceeds-uplink", err)
+		return nil, err
+	}
+
+	oomScoreAdj := int64(p.sysconfig.ContainerOOMScoreAdj)
+	if _, found := spec.Properties[OOMScoreAdjProperty]; found {
+		requested, _ := intProperty(spec.Properties, OOMScoreAdjProperty)
+		if requested < oomScoreAdj && !p.sysconfig.AllowPrivilegedContainers {
+			err := PrivilegedContainersNotAllowedError{OOMScoreAdjProperty}
+			pLog.Error("privileged-container-not-allowed", err)
+			return nil, err
+		}
+
+		oomScoreAdj = requested
+	}
+
+	config = append(config, fmt.Sprintf("oom_score_adj=%d", oomScoreAdj))
+
+	// no limit is the highest of all
+	maxConntrackEntries := uint64(p.sysconfig.ContainerMaxConntrackEntries)
+	if _, found := spec.Properties[MaxConntrackEntriesProperty]; found {
+		requested, _ := uintProperty(spec.Properties, MaxConntrackEntriesProperty)
+		raised := maxConntrackEntries != 0 && (requested == 0 || requested > maxConntrackEntries)
+		if raised && !p.sysconfig.AllowPrivilegedContainers {
+			err := PrivilegedContainersNotAllowedError{MaxConntrackEntriesProperty}
+			pLog.Error("privileged-container-not-allowed", err)
+			return nil, err
+		}
+
+		maxConntrackEntries = requested
+	}
+
+	config = append(config, fmt.Sprintf("max_conntrack_entries=%d", maxConntrackEntries))
+
+	snatIP, found := spec.Properties[linux_backend.ExternalIPProperty]
+	if found && !p.hasExternalIP(snatIP) {
+		err := ExternalIPNotConfiguredError{snatIP}
+		pLog.Error("external-ip-not-configured", err)
+		return nil, err
+	}
+
+	if disableSNAT, _ := boolProperty(spec.Properties, DisableSNATProperty); !found && !disableSNAT {
+		snatIP = p.nextExternalIP()
+	}
+
+	config = append(config, "snat_ip="+snatIP)
+
+	dnsSearch, found := spec.Properties[DNSSearchProperty]
+	if !found {
+		dnsSearch = strings.Join(p.sysconfig.DNSSearchDomains, ",")
+	}
+
+	dnsOptions, found := spec.Properties[DNSOptionsProperty]
+	if !found {
+		dnsOptions = strings.Join(p.sysconfig.DNSOptions, ",")
+	}
+
+	config = append(config, "dns_search="+dnsSearch, "dns_options="+dnsOptions)
+
+	acquireStarted := time.Now()
+
+	resources, err := p.aquirePoolResources(handle, pLog)
 	if err != nil {
 		return nil, err
 	}
+
+	linux_backend.ReportDuration(pLog, linux_backend.CreateAcquireDuration, acquireStarted)
+
 	defer cleanup(&err, func() {
-		p.releasePoolResources(resources)
+		p.releasePoolResources(handle, resources)
 	})
 
-	rootFSEnvVars, err := p.aquireSystemResources(id, containerPath, spec.RootFSPath, resources, spec.BindMounts, pLog)
+	// reserved resources may include ports
+	err = p.journalResources(id, resources)
+	if err != nil {
+		pLog.Error("failed-to-journal-network", err)
+		return nil, err
+	}
+
+	defer cleanup(&err, func() {
+		p.releaseJournal(pLog, id)
+	})
+
+	containerIP := resources.Network.ContainerIP().String()
+
+	config = append(config, fmt.Sprintf("container_iface_mtu=%d", p.containerMTU(mtu, resources.Network.ContainerIP())))
+
+	rootfsURL, provider, err := p.rootFSProvider(spec.RootFSPath, provider, pLog)
+	if err != nil {
+		return nil, err
+	}
+
+	var rootfsPath string
+	var rootFSEnvVars []string
+
+	// the rootfs is often the slowest part of creating a container, and
+	// nothing before create.sh needs it
+	err = runConcurrently(
+		createStep{
+			run: func() error {
+				err := p.runHook(pLog, "pre-create", p.hooks.PreCreate, handle, containerIP, containerPath)
+				if err != nil {
+					pLog.Error("pre-create-hook-failed", err)
+				}
+
+				return err
+			},
+		},
+		createStep{
+			run: func() error {
+				var err error
+				rootfsPath, rootFSEnvVars, err = p.provideRootFS(id, rootfsURL, provider, pLog)
+				return err
+			},
+			undo: func() {
+				err := provider.CleanupRootFS(pLog, id)
+				if err != nil {
+					pLog.Error("cleanup-rootfs-failed", err)
+				}
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// the rootfs may have taken long enough that the create has been given up
+	// on, e.g. by destroying the handle
+	select {
+	case <-cancelled:
+		err = linux_backend.OperationCancelledError{Kind: "create", Handle: handle}
+		pLog.Info("cancelled")
+
+		cleanupErr := provider.CleanupRootFS(pLog, id)
+		if cleanupErr != nil {
+			pLog.Error("cleanup-rootfs-failed", cleanupErr)
+		}
+
+		return nil, err
+	default:
+	}
+
+	err = p.aquireSystemResources(id, containerPath, rootfsPath, rootfsURL, provider, resources, spec.BindMounts, spec.Properties[linux_backend.UserProperty], config, pLog)
 	if err != nil {
 		return nil, err
 	}
@@ -187,18 +568,21 @@ func (p *LinuxContainerPool) Create(spec api.ContainerSpec) (c linux_backend.Con
 	return linux_backend.NewLinuxContainer(
 		pLog,
 		id,
-		getHandle(spec.Handle, id),
+		handle,
 		containerPath,
 		spec.Properties,
 		spec.GraceTime,
 		resources,
-		p.portPool,
+		p.containerPortPool(id),
 		p.runner,
-		cgroups_manager.New(p.sysconfig.CgroupPath, id),
+		cgroups_manager.New(p.sysconfig.CgroupPath, p.sysconfig.CgroupParent, id),
 		p.quotaManager,
 		bandwidth_manager.New(containerPath, id, p.runner),
-		process_tracker.New(containerPath, p.runner),
-		mergeEnv(spec.Env, rootFSEnvVars),
+		process_tracker.New(containerPath, p.runner, p.processOutputLimit),
+		p.resolver,
+		containerEnv(p.defaultEnv, spec.Env, rootFSEnvVars),
+		processDefaults(provider, id, rootfsPath, pLog),
+		containerSecurity(spec.Properties),
 	), nil
 }
 
@@ -212,7 +596,7 @@ func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Containe
 
 	id := containerSnapshot.ID
 
-	rLog := p.logger.Session("restore", lager.Data{
+	rLog := p.logger.Session("restore", containerLogData(containerSnapshot.Handle, containerSnapshot.Properties), lager.Data{
 		"id": id,
 	})
 
@@ -220,12 +604,16 @@ func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Containe
 
 	resources := containerSnapshot.Resources
 
+	// with -snapshotInterval the snapshot may have been saved before a crash,
+	// so ports acquired since are only in the journal
+	resources.Ports = mergePorts(resources.Ports, p.journal.Allocation(id).Ports)
+
 	err = p.uidPool.Remove(resources.UID)
 	if err != nil {
 		return nil, err
 	}
 
-	err = p.networkPool.Remove(resources.Network)
+	err = p.networkPool.Remove(containerSnapshot.Handle, resources.Network)
 	if err != nil {
 		p.uidPool.Release(resources.UID)
 		return nil, err
@@ -235,7 +623,7 @@ func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Containe
 		err = p.portPool.Remove(port)
 		if err != nil {
 			p.uidPool.Release(resources.UID)
-			p.networkPool.Release(resources.Network)
+			p.networkPool.Release(containerSnapshot.Handle, resources.Network)
 
 			for _, port := range resources.Ports {
 				p.portPool.Release(port)
@@ -247,33 +635,46 @@ func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Containe
 
 	containerPath := path.Join(p.depotPath, id)
 
-	cgroupsManager := cgroups_manager.New(p.sysconfig.CgroupPath, id)
+	cgroupsManager := cgroups_manager.New(p.sysconfig.CgroupPath, p.sysconfig.CgroupParent, id)
 
 	bandwidthManager := bandwidth_manager.New(containerPath, id, p.runner)
 
+	containerResources := linux_backend.NewResources(
+		resources.UID,
+		resources.Network,
+		resources.Ports,
+	)
+
+	err = p.journalResources(id, containerResources)
+	if err != nil {
+		rLog.Error("failed-to-journal-resources", err)
+		p.releasePoolResources(containerSnapshot.Handle, containerResources)
+		return nil, err
+	}
+
 	container := linux_backend.NewLinuxContainer(
-		p.logger.Session(id),
+		p.logger.Session(id, containerLogData(containerSnapshot.Handle, containerSnapshot.Properties)),
 		id,
 		containerSnapshot.Handle,
 		containerPath,
 		containerSnapshot.Properties,
 		containerSnapshot.GraceTime,
-		linux_backend.NewResources(
-			resources.UID,
-			resources.Network,
-			resources.Ports,
-		),
-		p.portPool,
+		containerResources,
+		p.containerPortPool(id),
 		p.runner,
 		cgroupsManager,
 		p.quotaManager,
 		bandwidthManager,
-		process_tracker.New(containerPath, p.runner),
+		process_tracker.New(containerPath, p.runner, p.processOutputLimit),
+		p.resolver,
 		containerSnapshot.EnvVars,
+		containerSnapshot.ProcessDefaults,
+		containerSecurity(containerSnapshot.Properties),
 	)
 
 	err = container.Restore(containerSnapshot)
 	if err != nil {
+		p.releasePoolResources(containerSnapshot.Handle, containerResources)
 		return nil, err
 	}
 
@@ -282,22 +683,62 @@ func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Containe
 	return container, nil
 }
 
+// Started runs the post-create hook for a container the backend has
+// created and started, so that the hook sees it running.
+func (p *LinuxContainerPool) Started(container linux_backend.Container) {
+	pLog := p.logger.Session("started", containerLogData(container.Handle(), container.Properties()), lager.Data{
+		"id": container.ID(),
+	})
+
+	linuxContainer := container.(*linux_backend.LinuxContainer)
+
+	containerIP := linuxContainer.Resources().Network.ContainerIP().String()
+	containerPath := path.Join(p.depotPath, container.ID())
+
+	err := p.runHook(pLog, "post-create", p.hooks.PostCreate, container.Handle(), containerIP, containerPath)
+	if err != nil {
+		pLog.Error("post-create-hook-failed", err)
+	}
+}
+
 func (p *LinuxContainerPool) Destroy(container linux_backend.Container) error {
-	pLog := p.logger.Session("destroy", lager.Data{
+	pLog := p.logger.Session("destroy", containerLogData(container.Handle(), container.Properties()), lager.Data{
 		"id": container.ID(),
 	})
 
 	pLog.Info("destroying")
 
-	err := p.releaseSystemResources(pLog, container.ID())
+	linuxContainer := container.(*linux_backend.LinuxContainer)
+
+	containerIP := linuxContainer.Resources().Network.ContainerIP().String()
+	containerPath := path.Join(p.depotPath, container.ID())
+
+	err := p.runHook(pLog, "pre-destroy", p.hooks.PreDestroy, container.Handle(), containerIP, containerPath)
 	if err != nil {
+		pLog.Error("pre-destroy-hook-failed", err)
 		return err
 	}
 
-	linuxContainer := container.(*linux_backend.LinuxContainer)
-	p.releasePoolResources(linuxContainer.Resources())
+	// destroy.sh kills the container's processes outright, so give them the
+	// chance to flush first; the outcome doesn't stop the destroy
+	linuxContainer.RunPreStop()
+
+	err = p.releaseSystemResources(pLog, container.ID())
+	if err != nil {
+		return err
+	}
 
-	pLog.Info("destroyed")
+	p.releaseJournal(pLog, container.ID())
+	p.releasePoolResources(container.Handle(), linuxContainer.Resources())
+
+	pLog.Info("destroyed", lager.Data{
+		"pre-stop": linuxContainer.PreStopResult(),
+	})
+
+	err = p.runHook(pLog, "post-destroy", p.hooks.PostDestroy, container.Handle(), containerIP, containerPath)
+	if err != nil {
+		pLog.Error("post-destroy-hook-failed", err)
+	}
 
 	return nil
 }
@@ -307,7 +748,7 @@ func (p *LinuxContainerPool) generateContainerIDs() string {
 		containerID := []byte{}
 
 		var i uint
-		for i = 0; i < 11; i++ {
+		for i = 0; i < containerIDLength; i++ {
 			containerID = strconv.AppendInt(
 				containerID,
 				(containerNum>>(55-(i+1)*5))&31,
@@ -319,52 +760,158 @@ func (p *LinuxContainerPool) generateContainerIDs() string {
 	}
 }
 
+// ProvideRootFSError is returned when a rootfs cannot be fetched or
+// prepared; its message is the provider's.
+type ProvideRootFSError struct {
+	Err error
+}
+
+func (e ProvideRootFSError) Error() string {
+	return e.Err.Error()
+}
+
+// SetupFailedError is returned when create.sh fails. Everything acquired
+// for the container is released before it is returned, so creating the
+// container again may succeed.
+type SetupFailedError struct {
+	Err error
+}
+
+func (e SetupFailedError) Error() string {
+	return fmt.Sprintf("failed to set up container: %s", e.Err)
+}
+
+type BindMountSourceNotFoundError struct {
+	SrcPath string
+}
+
+func (e BindMountSourceNotFoundError) Error() string {
+	return fmt.Sprintf("bind mount source not found: %s", e.SrcPath)
+}
+
+type TooManySymlinksError struct {
+	Path string
+}
+
+func (e TooManySymlinksError) Error() string {
+	return fmt.Sprintf("too many levels of symbolic links in rootfs path: %s", e.Path)
+}
+
+// the symlinks resolveInRootFS follows before giving up, as the kernel does
+const maxSymlinks = 40
+
+// writeBindMounts appends the commands performing the bind mounts to
+// hook-child-before-pivot.sh.
+//
+// Destinations, and sources originating from the container, are resolved
+// within the rootfs as if it were the root directory, so they cannot escape
+// it through .. or its symlinks.
 func (p *LinuxContainerPool) writeBindMounts(containerPath string,
 	rootfsPath string,
 	bindMounts []api.BindMount) error {
 	hook := path.Join(containerPath, "lib", "hook-child-before-pivot.sh")
 
 	for _, bm := range bindMounts {
-		dstMount := path.Join(rootfsPath, bm.DstPath)
+		dstMount, err := resolveInRootFS(rootfsPath, bm.DstPath)
+		if err != nil {
+			return err
+		}
+
 		srcPath := bm.SrcPath
 
 		if bm.Origin == api.BindMountOriginContainer {
-			srcPath = path.Join(rootfsPath, srcPath)
+			srcPath, err = resolveInRootFS(rootfsPath, srcPath)
+			if err != nil {
+				return err
+			}
 		}
 
-		mode := "ro"
-		if bm.Mode == api.BindMountModeRW {
-			mode = "rw"
+		info, err := os.Stat(srcPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return BindMountSourceNotFoundError{bm.SrcPath}
+			}
+
+			return err
 		}
 
 		linebreak := exec.Command("bash", "-c", "echo >> "+hook)
-		err := p.runner.Run(linebreak)
+		err = p.runner.Run(linebreak)
 		if err != nil {
 			return err
 		}
 
-		mkdir := exec.Command("bash", "-c", "echo mkdir -p "+dstMount+" >> "+hook)
-		err = p.runner.Run(mkdir)
-		if err != nil {
-			return err
+		// a file can only be mounted onto a file
+		var commands []string
+		if info.IsDir() {
+			commands = append(commands, "mkdir -p "+dstMount)
+		} else {
+			commands = append(commands, "mkdir -p "+path.Dir(dstMount), "touch "+dstMount)
 		}
 
-		mount := exec.Command("bash", "-c", "echo mount -n --bind "+srcPath+" "+dstMount+" >> "+hook)
-		err = p.runner.Run(mount)
-		if err != nil {
-			return err
+		commands = append(commands, "mount -n --bind "+srcPath+" "+dstMount)
+
+		// a bind mount is initially as writable as its source; it can only be
+		// made read-only by remounting it
+		if bm.Mode != api.BindMountModeRW {
+			commands = append(commands, "mount -n -o remount,bind,ro "+dstMount)
 		}
 
-		remount := exec.Command("bash", "-c", "echo mount -n --bind -o remount,"+mode+" "+srcPath+" "+dstMount+" >> "+hook)
-		err = p.runner.Run(remount)
-		if err != nil {
-			return err
+		for _, command := range commands {
+			err := p.runner.Run(exec.Command("bash", "-c", "echo "+command+" >> "+hook))
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// resolveInRootFS gives where p is on the host, following the symlinks in
+// the rootfs as the container would, i.e. with absolute targets and .. kept
+// within the rootfs. Whatever doesn't exist yet is taken as it is.
+func resolveInRootFS(rootfsPath, p string) (string, error) {
+	resolved := "/"
+	remaining := strings.Split(p, "/")
+	links := 0
+
+	for len(remaining) > 0 {
+		component := remaining[0]
+		remaining = remaining[1:]
+
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, component)
+
+		target, err := os.Readlink(path.Join(rootfsPath, next))
+		if err != nil {
+			// not a symlink, or not there yet
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", TooManySymlinksError{p}
+		}
+
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+
+		remaining = append(strings.Split(target, "/"), remaining...)
+	}
+
+	return path.Join(rootfsPath, resolved), nil
+}
+
 func (p *LinuxContainerPool) saveRootFSProvider(id string, provider string) error {
 	providerFile := path.Join(p.depotPath, id, "rootfs-provider")
 
@@ -373,30 +920,51 @@ func (p *LinuxContainerPool) saveRootFSProvider(id string, provider string) erro
 		return err
 	}
 
-	return ioutil.WriteFile(providerFile, []byte(provider), 0644)
+	// destroying or pruning the container after a crash depends on it
+	file, err := os.Create(providerFile)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write([]byte(provider))
+	if err == nil {
+		err = file.Sync()
+	}
+
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+
+	return closeErr
 }
 
-func (p *LinuxContainerPool) aquirePoolResources() (*linux_backend.Resources, error) {
+func (p *LinuxContainerPool) aquirePoolResources(handle string, pLog lager.Logger) (*linux_backend.Resources, error) {
+	if reserved, found := p.takeReservation(handle); found {
+		pLog.Info("using-reserved-resources")
+		return reserved, nil
+	}
+
 	var err error
 	resources := linux_backend.NewResources(0, nil, nil)
 
 	resources.UID, err = p.uidPool.Acquire()
 	if err != nil {
-		p.logger.Error("uid-acquire-failed", err)
+		pLog.Error("uid-acquire-failed", err)
 		return nil, err
 	}
 
-	resources.Network, err = p.networkPool.Acquire()
+	resources.Network, err = p.networkPool.Acquire(handle)
 	if err != nil {
-		p.logger.Error("network-acquire-failed", err)
-		p.releasePoolResources(resources)
+		pLog.Error("network-acquire-failed", err)
+		p.releasePoolResources(handle, resources)
 		return nil, err
 	}
 
 	return resources, nil
 }
 
-func (p *LinuxContainerPool) releasePoolResources(resources *linux_backend.Resources) {
+func (p *LinuxContainerPool) releasePoolResources(handle string, resources *linux_backend.Resources) {
 	for _, port := range resources.Ports {
 		p.portPool.Release(port)
 	}
@@ -406,17 +974,29 @@ func (p *LinuxContainerPool) releasePoolResources(resources *linux_backend.Resou
 	}
 
 	if resources.Network != nil {
-		p.networkPool.Release(resources.Network)
+		p.networkPool.Release(handle, resources.Network)
 	}
 }
 
-func (p *LinuxContainerPool) aquireSystemResources(id, containerPath, rootFSPath string, resources *linux_backend.Resources, bindMounts []api.BindMount, pLog lager.Logger) ([]string, error) {
+func (p *LinuxContainerPool) rootFSProvider(rootFSPath string, explicit rootfs_provider.RootFSProvider, pLog lager.Logger) (*url.URL, rootfs_provider.RootFSProvider, error) {
 	rootfsURL, err := url.Parse(rootFSPath)
 	if err != nil {
 		pLog.Error("parse-rootfs-path-failed", err, lager.Data{
 			"RootFSPath": rootFSPath,
 		})
-		return nil, err
+		return nil, nil, err
+	}
+
+	if explicit != nil {
+		// otherwise what it provided couldn't be cleaned up
+		if _, found := p.explicitRootFSProviders[rootfsURL.Scheme]; !found {
+			pLog.Error("unregistered-rootfs-provider", nil, lager.Data{
+				"provider": rootfsURL.Scheme,
+			})
+			return nil, nil, ErrUnknownRootFSProvider
+		}
+
+		return rootfsURL, explicit, nil
 	}
 
 	provider, found := p.rootfsProviders[rootfsURL.Scheme]
@@ -424,64 +1004,118 @@ func (p *LinuxContainerPool) aquireSystemResources(id, containerPath, rootFSPath
 		pLog.Error("unknown-rootfs-provider", nil, lager.Data{
 			"provider": rootfsURL.Scheme,
 		})
-		return nil, ErrUnknownRootFSProvider
+		return nil, nil, ErrUnknownRootFSProvider
 	}
 
+	return rootfsURL, provider, nil
+}
+
+func (p *LinuxContainerPool) provideRootFS(id string, rootfsURL *url.URL, provider rootfs_provider.RootFSProvider, pLog lager.Logger) (string, []string, error) {
+	rootfsStarted := time.Now()
+
 	rootfsPath, rootFSEnvVars, err := provider.ProvideRootFS(pLog.Session("create-rootfs"), id, rootfsURL)
 	if err != nil {
 		pLog.Error("provide-rootfs-failed", err)
-		return nil, err
+		return "", nil, ProvideRootFSError{err}
+	}
+
+	linux_backend.ReportDuration(pLog, linux_backend.CreateRootFSDuration, rootfsStarted)
+
+	return rootfsPath, rootFSEnvVars, nil
+}
+
+// containerMTU is the MTU the container asked for, or else that of its
+// subnet or the server's default
+func (p *LinuxContainerPool) containerMTU(requested uint64, containerIP net.IP) int {
+	if requested != 0 {
+		return int(requested)
 	}
 
+	for _, subnet := range p.sysconfig.NetworkSubnetMTUs {
+		if subnet.Network.Contains(containerIP) {
+			return subnet.MTU
+		}
+	}
+
+	if p.sysconfig.NetworkMTU != 0 {
+		return p.sysconfig.NetworkMTU
+	}
+
+	return DefaultMTU
+}
+
+func (p *LinuxContainerPool) aquireSystemResources(id, containerPath, rootfsPath string, rootfsURL *url.URL, provider rootfs_provider.RootFSProvider, resources *linux_backend.Resources, bindMounts []api.BindMount, user string, config []string, pLog lager.Logger) error {
 	createCmd := path.Join(p.binPath, "create.sh")
 	create := exec.Command(createCmd, containerPath)
-	create.Env = []string{
+	create.Env = append([]string{
 		"id=" + id,
 		"rootfs_path=" + rootfsPath,
 		fmt.Sprintf("user_uid=%d", resources.UID),
 		fmt.Sprintf("network_host_ip=%s", resources.Network.HostIP()),
 		fmt.Sprintf("network_container_ip=%s", resources.Network.ContainerIP()),
-		"PATH=" + os.Getenv("PATH"),
-	}
+		fmt.Sprintf("network_prefix_length=%d", resources.Network.PrefixLength()),
+		"disk_quota_type=" + p.diskQuotaType(),
+	}, append(config, "PATH="+os.Getenv("PATH"))...)
 
 	pRunner := logging.Runner{
 		CommandRunner: p.runner,
-		Logger:        p.logger,
+		Logger:        pLog,
 	}
 
-	err = pRunner.Run(create)
+	setupStarted := time.Now()
+
+	err := pRunner.Run(create)
+
+	// the rootfs provider is only saved once create.sh succeeds, so isn't
+	// looked up to undo it
 	defer cleanup(&err, func() {
-		p.tryReleaseSystemResources(p.logger, id)
+		p.tryReleaseSystemResources(pLog, id, provider)
 	})
 
 	if err != nil {
-		p.logger.Error("create-command-failed", err, lager.Data{
+		pLog.Error("create-command-failed", err, lager.Data{
 			"CreateCmd": createCmd,
 			"Env":       create.Env,
 		})
-		return nil, err
+		return SetupFailedError{err}
 	}
 
+	linux_backend.ReportDuration(pLog, linux_backend.CreateSetupDuration, setupStarted)
+
 	err = p.saveRootFSProvider(id, rootfsURL.Scheme)
 	if err != nil {
-		p.logger.Error("save-rootfs-provider-failed", err, lager.Data{
+		pLog.Error("save-rootfs-provider-failed", err, lager.Data{
 			"Id":     id,
 			"rootfs": rootfsURL.String(),
 		})
-		return nil, err
+		return err
 	}
 
+	bindMountsStarted := time.Now()
+
 	err = p.writeBindMounts(containerPath, rootfsPath, bindMounts)
 	if err != nil {
-		p.logger.Error("bind-mounts-failed", err)
-		return nil, err
+		pLog.Error("bind-mounts-failed", err)
+		return err
+	}
+
+	linux_backend.ReportDuration(pLog, linux_backend.CreateBindMountsDuration, bindMountsStarted)
+
+	if user != "" {
+		err = lookupUser(rootfsPath, user)
+		if err != nil {
+			pLog.Error("lookup-user-failed", err, lager.Data{
+				"user": user,
+			})
+			return err
+		}
 	}
 
-	return rootFSEnvVars, nil
+	return nil
 }
 
-func (p *LinuxContainerPool) tryReleaseSystemResources(logger lager.Logger, id string) {
-	err := p.releaseSystemResources(logger, id)
+func (p *LinuxContainerPool) tryReleaseSystemResources(logger lager.Logger, id string, provider rootfs_provider.RootFSProvider) {
+	err := p.releaseSystemResourcesWith(logger, id, provider)
 	if err != nil {
 		logger.Error("failed-to-undo-failed-create", err)
 	}
@@ -493,19 +1127,38 @@ func (p *LinuxContainerPool) releaseSystemResources(logger lager.Logger, id stri
 		rootfsProvider = []byte("")
 	}
 
+	provider, found := p.rootfsProviders[string(rootfsProvider)]
+	if !found {
+		provider, found = p.explicitRootFSProviders[string(rootfsProvider)]
+	}
+
+	if !found {
+		return ErrUnknownRootFSProvider
+	}
+
+	return p.releaseSystemResourcesWith(logger, id, provider)
+}
+
+func (p *LinuxContainerPool) releaseSystemResourcesWith(logger lager.Logger, id string, provider rootfs_provider.RootFSProvider) error {
 	pRunner := logging.Runner{
 		CommandRunner: p.runner,
 		Logger:        logger,
 	}
 
-	provider, found := p.rootfsProviders[string(rootfsProvider)]
-	if !found {
-		return ErrUnknownRootFSProvider
+	// the rules go through the runner rather than destroy.sh so that they
+	// can be queued; the container may have failed to be created before its
+	// net.sh was
+	netSh := path.Join(p.depotPath, id, "net.sh")
+	if _, err := os.Stat(netSh); err == nil {
+		err := pRunner.Run(exec.Command(netSh, "teardown"))
+		if err != nil {
+			return err
+		}
 	}
 
 	destroy := exec.Command(path.Join(p.binPath, "destroy.sh"), path.Join(p.depotPath, id))
 
-	err = pRunner.Run(destroy)
+	err := pRunner.Run(destroy)
 	if err != nil {
 		return err
 	}
@@ -513,6 +1166,20 @@ func (p *LinuxContainerPool) releaseSystemResources(logger lager.Logger, id stri
 	return provider.CleanupRootFS(logger, id)
 }
 
+// containerLogData tags the container's logs with its handle, and the
+// request that created it if given
+func containerLogData(handle string, properties api.Properties) lager.Data {
+	data := lager.Data{
+		"handle": handle,
+	}
+
+	if requestID := properties[linux_backend.RequestIDProperty]; requestID != "" {
+		data["request-id"] = requestID
+	}
+
+	return data
+}
+
 func getHandle(handle, id string) string {
 	if handle != "" {
 		return handle
@@ -520,6 +1187,48 @@ func getHandle(handle, id string) string {
 	return id
 }
 
+// processDefaults gives how the container's image intended its processes to
+// be run, if the provider's rootfses come from images. wsh runs processes as
+// users by name, so the image's user is only kept if the rootfs defines it.
+func processDefaults(provider rootfs_provider.RootFSProvider, id, rootfsPath string, pLog lager.Logger) linux_backend.ProcessDefaults {
+	imageConfigProvider, ok := provider.(rootfs_provider.ImageConfigProvider)
+	if !ok {
+		return linux_backend.ProcessDefaults{}
+	}
+
+	config, found := imageConfigProvider.ImageConfig(id)
+	if !found {
+		return linux_backend.ProcessDefaults{}
+	}
+
+	user := config.User
+	if user != "" {
+		err := lookupUser(rootfsPath, user)
+		if err != nil {
+			pLog.Info("ignoring-image-user", lager.Data{
+				"user":  user,
+				"error": err.Error(),
+			})
+
+			user = ""
+		}
+	}
+
+	return linux_backend.ProcessDefaults{
+		User:       user,
+		Dir:        config.WorkingDir,
+		Entrypoint: config.Entrypoint,
+		Cmd:        config.Cmd,
+	}
+}
+
+// containerEnv gives the environment of a container's processes, lowest
+// precedence first: the server's defaults, the container spec's, and the
+// rootfs's. Each process's own environment takes precedence over all three.
+func containerEnv(defaultEnv, specEnv, rootFSEnv []string) []string {
+	return mergeEnv(mergeEnv(mergeEnv(nil, defaultEnv), specEnv), rootFSEnv)
+}
+
 func mergeEnv(env1, env2 []string) []string {
 	for _, entry := range env2 {
 		env1 = append(env1, entry)
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
@@ -16,23 +17,42 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager"
 	"github.com/pivotal-golang/lager/lagertest"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/allocation_journal"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/capabilities"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider/fake_rootfs_provider"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool/fake_network_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool/fake_port_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/process_tracker"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager/fake_quota_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/resolver/fake_resolver"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool/fake_uid_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/sysconfig"
 	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry/dropsonde/autowire/metrics"
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
 	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
 	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
 )
 
+type imageRootFSProvider struct {
+	*fake_rootfs_provider.FakeRootFSProvider
+
+	config repository_fetcher.ImageConfig
+}
+
+func (p *imageRootFSProvider) ImageConfig(id string) (repository_fetcher.ImageConfig, bool) {
+	return p.config, true
+}
+
 var _ = Describe("Container pool", func() {
 	var depotPath string
 	var fakeRunner *fake_command_runner.FakeCommandRunner
@@ -43,6 +63,7 @@ var _ = Describe("Container pool", func() {
 	var defaultFakeRootFSProvider *fake_rootfs_provider.FakeRootFSProvider
 	var fakeRootFSProvider *fake_rootfs_provider.FakeRootFSProvider
 	var pool *container_pool.LinuxContainerPool
+	var logger *lagertest.TestLogger
 
 	BeforeEach(func() {
 		_, ipNet, err := net.ParseCIDR("1.2.0.0/20")
@@ -61,8 +82,10 @@ var _ = Describe("Container pool", func() {
 		depotPath, err = ioutil.TempDir("", "depot-path")
 		Ω(err).ShouldNot(HaveOccurred())
 
+		logger = lagertest.NewTestLogger("test")
+
 		pool = container_pool.New(
-			lagertest.NewTestLogger("test"),
+			logger,
 			"/root/path",
 			depotPath,
 			sysconfig.NewConfig("0"),
@@ -73,10 +96,16 @@ var _ = Describe("Container pool", func() {
 			fakeUIDPool,
 			fakeNetworkPool,
 			fakePortPool,
+			allocation_journal.Disabled{},
 			[]string{"1.1.0.0/16", "2.2.0.0/16"},
 			[]string{"1.1.1.1/32", "2.2.2.2/32"},
+			nil,
+			nil,
 			fakeRunner,
+			fake_resolver.New(),
 			fakeQuotaManager,
+			process_tracker.OutputLimit{},
+			container_pool.Hooks{},
 		)
 	})
 
@@ -124,6 +153,7 @@ var _ = Describe("Container pool", func() {
 						"CONTAINER_DEPOT_PATH=" + depotPath,
 						"CONTAINER_DEPOT_MOUNT_POINT_PATH=/depot/mount/point",
 						"DISK_QUOTA_ENABLED=true",
+						"DISK_QUOTA_TYPE=user",
 
 						"PATH=" + os.Getenv("PATH"),
 					},
@@ -152,6 +182,136 @@ var _ = Describe("Container pool", func() {
 		})
 	})
 
+	Describe("refreshing the external IP", func() {
+		It("executes net.sh refresh_external_ip with the pool's network", func() {
+			err := pool.RefreshExternalIP()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/root/path/net.sh",
+					Args: []string{"refresh_external_ip"},
+					Env: []string{
+						"POOL_NETWORK=1.2.0.0/20",
+						"PATH=" + os.Getenv("PATH"),
+					},
+				},
+			))
+		})
+
+		Context("when net.sh fails", func() {
+			nastyError := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/net.sh",
+					}, func(*exec.Cmd) error {
+						return nastyError
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				err := pool.RefreshExternalIP()
+				Ω(err).Should(Equal(nastyError))
+			})
+		})
+	})
+
+	Describe("sweeping rules", func() {
+		It("executes net.sh sweep with the depot", func() {
+			err := pool.SweepRules()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/root/path/net.sh",
+					Args: []string{"sweep"},
+					Env: []string{
+						"CONTAINER_DEPOT_PATH=" + depotPath,
+						"PATH=" + os.Getenv("PATH"),
+					},
+				},
+			))
+		})
+
+		Context("when net.sh fails", func() {
+			nastyError := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/net.sh",
+					}, func(*exec.Cmd) error {
+						return nastyError
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				err := pool.SweepRules()
+				Ω(err).Should(Equal(nastyError))
+			})
+		})
+	})
+
+	Describe("listing the containers with rules", func() {
+		It("returns the ids printed by net.sh chains", func() {
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: "/root/path/net.sh",
+					Args: []string{"chains"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("some-id\nanother-id\n"))
+					return nil
+				},
+			)
+
+			ids, err := pool.RuleIDs()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ids).Should(Equal([]string{"some-id", "another-id"}))
+		})
+
+		Context("when net.sh fails", func() {
+			nastyError := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/net.sh",
+					}, func(*exec.Cmd) error {
+						return nastyError
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				_, err := pool.RuleIDs()
+				Ω(err).Should(Equal(nastyError))
+			})
+		})
+	})
+
+	Describe("listing the containers in the depot", func() {
+		BeforeEach(func() {
+			err := os.MkdirAll(path.Join(depotPath, "some-id"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = os.MkdirAll(path.Join(depotPath, "tmp"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = ioutil.WriteFile(path.Join(depotPath, "some-file"), []byte{}, 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("returns the ids of the directories, other than tmp", func() {
+			ids, err := pool.DepotIDs()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ids).Should(Equal([]string{"some-id"}))
+		})
+	})
+
 	Describe("creating", func() {
 		itReleasesTheUserID := func() {
 			It("returns the container's user ID to the pool", func() {
@@ -188,11 +348,86 @@ var _ = Describe("Container pool", func() {
 			})
 		}
 
+		It("reports how long each stage of creating the container took", func() {
+			fakeMetricSender := fake.NewFakeMetricSender()
+			metrics.Initialize(fakeMetricSender)
+
+			_, err := pool.Create(api.ContainerSpec{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			for _, metric := range []string{
+				linux_backend.CreateAcquireDuration,
+				linux_backend.CreateRootFSDuration,
+				linux_backend.CreateSetupDuration,
+				linux_backend.CreateBindMountsDuration,
+			} {
+				Ω(fakeMetricSender.GetValue(metric).Unit).Should(Equal("nanos"), metric)
+				Ω(fakeMetricSender.GetValue(metric).Value).Should(BeNumerically(">", 0), metric)
+			}
+		})
+
+		It("tags everything logged about the container with its handle", func() {
+			container, err := pool.Create(api.ContainerSpec{
+				Handle: "some-handle",
+			}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, err = container.NetIn(1234, 5678)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(logger.Logs()).ShouldNot(BeEmpty())
+
+			for _, log := range logger.Logs() {
+				Ω(log.Data).Should(HaveKeyWithValue("handle", "some-handle"), log.Message)
+			}
+		})
+
+		Context("when a request id is given", func() {
+			It("tags everything logged about the container with it too", func() {
+				container, err := pool.Create(api.ContainerSpec{
+					Handle: "some-handle",
+					Properties: api.Properties{
+						linux_backend.RequestIDProperty: "some-request-id",
+					},
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, _, err = container.NetIn(1234, 5678)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = pool.Destroy(container)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				for _, log := range logger.Logs() {
+					Ω(log.Data).Should(HaveKeyWithValue("request-id", "some-request-id"), log.Message)
+				}
+			})
+		})
+
+		It("does not tag the container's logs with a request id if none is given", func() {
+			_, err := pool.Create(api.ContainerSpec{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			for _, log := range logger.Logs() {
+				Ω(log.Data).ShouldNot(HaveKey("request-id"), log.Message)
+			}
+		})
+
+		It("acquires a network for the container", func() {
+			container, err := pool.Create(api.ContainerSpec{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeNetworkPool.Acquired).Should(Equal([]string{"1.2.0.0/30"}))
+
+			linuxContainer := container.(*linux_backend.LinuxContainer)
+			Ω(linuxContainer.Resources().Network.String()).Should(Equal("1.2.0.0/30"))
+		})
+
 		It("returns containers with unique IDs", func() {
-			container1, err := pool.Create(api.ContainerSpec{})
+			container1, err := pool.Create(api.ContainerSpec{}, nil)
 			Ω(err).ShouldNot(HaveOccurred())
 
-			container2, err := pool.Create(api.ContainerSpec{})
+			container2, err := pool.Create(api.ContainerSpec{}, nil)
 			Ω(err).ShouldNot(HaveOccurred())
 
 			Ω(container1.ID()).ShouldNot(Equal(container2.ID()))
@@ -201,7 +436,7 @@ var _ = Describe("Container pool", func() {
 		It("creates containers with the correct grace time", func() {
 			container, err := pool.Create(api.ContainerSpec{
 				GraceTime: 1 * time.Second,
-			})
+			}, nil)
 			Ω(err).ShouldNot(HaveOccurred())
 
 			Ω(container.GraceTime()).Should(Equal(1 * time.Second))
@@ -214,14 +449,14 @@ var _ = Describe("Container pool", func() {
 
 			container, err := pool.Create(api.ContainerSpec{
 				Properties: properties,
-			})
+			}, nil)
 			Ω(err).ShouldNot(HaveOccurred())
 
 			Ω(container.Properties()).Should(Equal(properties))
 		})
 
 		It("executes create.sh with the correct args and environment", func() {
-			container, err := pool.Create(api.ContainerSpec{})
+			container, err := pool.Create(api.ContainerSpec{}, nil)
 			Ω(err).ShouldNot(HaveOccurred())
 
 			Ω(fakeRunner).Should(HaveExecutedSerially(
@@ -234,6 +469,31 @@ var _ = Describe("Container pool", func() {
 						"user_uid=10000",
 						"network_host_ip=1.2.0.1",
 						"network_container_ip=1.2.0.2",
+						"network_prefix_length=30",
+						"disk_quota_type=user",
+						"drop_capabilities=2,9,11,12,14,15,16,17,19,20,21,22,23,24,25,26,28,30,32,33,34,35,36",
+						"read_only_rootfs=false",
+						"scratch_size=0",
+						"disable_snat=false",
+						"nested=false",
+						"cpu_quota_us=0",
+						"cpu_period_us=0",
+						"cpuset_cpus=",
+						"pids_max=0",
+						"blkio_read_bps=0",
+						"blkio_write_bps=0",
+						"blkio_read_iops=0",
+						"blkio_write_iops=0",
+						"dns_hosts=",
+						"tmpfs_mounts=",
+						"shm_size=0",
+						"core_dumps=quota",
+						"oom_score_adj=0",
+						"max_conntrack_entries=0",
+						"snat_ip=",
+						"dns_search=",
+						"dns_options=",
+						"container_iface_mtu=1500",
 
 						"PATH=" + os.Getenv("PATH"),
 					},
@@ -241,833 +501,3101 @@ var _ = Describe("Container pool", func() {
 			))
 		})
 
-		It("saves the determined rootfs provider to the depot", func() {
-			container, err := pool.Create(api.ContainerSpec{})
-			Ω(err).ShouldNot(HaveOccurred())
-
-			body, err := ioutil.ReadFile(path.Join(depotPath, container.ID(), "rootfs-provider"))
-			Ω(err).ShouldNot(HaveOccurred())
-
-			Ω(string(body)).Should(Equal(""))
-		})
+		Context("when project quotas are used", func() {
+			BeforeEach(func() {
+				fakeQuotaManager.TypeResult = quota_manager.ProjectQuotas
+			})
 
-		Context("when a rootfs is specified", func() {
-			It("is used to provide a rootfs", func() {
-				container, err := pool.Create(api.ContainerSpec{
-					RootFSPath: "fake:///path/to/custom-rootfs",
-				})
+			It("tells create.sh to set up the rootfs for them", func() {
+				_, err := pool.Create(api.ContainerSpec{}, nil)
 				Ω(err).ShouldNot(HaveOccurred())
 
-				_, id, uri := fakeRootFSProvider.ProvideRootFSArgsForCall(0)
-				Ω(id).Should(Equal(container.ID()))
-				Ω(uri).Should(Equal(&url.URL{
-					Scheme: "fake",
-					Host:   "",
-					Path:   "/path/to/custom-rootfs",
-				}))
+				Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("disk_quota_type=project"))
 			})
 
-			It("passes the provided rootfs as $rootfs_path to create.sh", func() {
-				fakeRootFSProvider.ProvideRootFSReturns("/var/some/mount/point", nil, nil)
-
-				container, err := pool.Create(api.ContainerSpec{
-					RootFSPath: "fake:///path/to/custom-rootfs",
+			Context("but quotas are disabled", func() {
+				BeforeEach(func() {
+					fakeQuotaManager.Disable()
 				})
-				Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(fakeRunner).Should(HaveExecutedSerially(
-					fake_command_runner.CommandSpec{
-						Path: "/root/path/create.sh",
-						Args: []string{path.Join(depotPath, container.ID())},
-						Env: []string{
-							"id=" + container.ID(),
-							"rootfs_path=/var/some/mount/point",
-							"user_uid=10000",
-							"network_host_ip=1.2.0.1",
-							"network_container_ip=1.2.0.2",
+				It("does not tell create.sh to set up the rootfs for them", func() {
+					_, err := pool.Create(api.ContainerSpec{}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
 
-							"PATH=" + os.Getenv("PATH"),
-						},
+					Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("disk_quota_type="))
+				})
+			})
+		})
+
+		Context("when capabilities are specified", func() {
+			It("passes the capabilities to drop to create.sh", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.CapabilitiesProperty: "chown,kill",
 					},
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement(
+					"drop_capabilities=1,2,3,4,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,21,22,23,24,25,26,27,28,29,30,31,32,33,34,35,36",
 				))
 			})
 
-			It("saves the determined rootfs provider to the depot", func() {
-				container, err := pool.Create(api.ContainerSpec{
-					RootFSPath: "fake:///path/to/custom-rootfs",
+			for _, retained := range []string{"all", "chown,sys_admin"} {
+				retained := retained
+
+				Context("and "+retained+" are beyond the defaults", func() {
+					It("returns a PrivilegedContainersNotAllowedError without acquiring resources", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								container_pool.CapabilitiesProperty: retained,
+							},
+						}, nil)
+						Ω(err).Should(Equal(container_pool.PrivilegedContainersNotAllowedError{
+							Property: container_pool.CapabilitiesProperty,
+						}))
+
+						Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+						Ω(defaultFakeRootFSProvider.ProvideRootFSCallCount()).Should(Equal(0))
+					})
 				})
-				Ω(err).ShouldNot(HaveOccurred())
+			}
 
-				body, err := ioutil.ReadFile(path.Join(depotPath, container.ID(), "rootfs-provider"))
-				Ω(err).ShouldNot(HaveOccurred())
+			Context("and privileged containers are allowed", func() {
+				BeforeEach(func() {
+					config := sysconfig.NewConfig("0")
+					config.AllowPrivilegedContainers = true
+
+					pool = container_pool.New(
+						lagertest.NewTestLogger("test"),
+						"/root/path",
+						depotPath,
+						config,
+						map[string]rootfs_provider.RootFSProvider{
+							"": defaultFakeRootFSProvider,
+						},
+						fakeUIDPool,
+						fakeNetworkPool,
+						fakePortPool,
+						allocation_journal.Disabled{},
+						nil,
+						nil,
+						nil,
+						nil,
+						fakeRunner,
+						fake_resolver.New(),
+						fakeQuotaManager,
+						process_tracker.OutputLimit{},
+						container_pool.Hooks{},
+					)
+				})
 
-				Ω(string(body)).Should(Equal("fake"))
-			})
+				It("lets containers retain every capability", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.CapabilitiesProperty: "all",
+						},
+					}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
 
-			It("merges the env vars associated with the rootfs with those in the spec", func() {
-				fakeRootFSProvider.ProvideRootFSReturns("/provided/rootfs/path", []string{
-					"var2=rootfs-value-2",
-					"var3=rootfs-value-3",
-				}, nil)
+					Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("drop_capabilities="))
+				})
+			})
 
+			It("gives the container the capabilities dropped, to report", func() {
 				container, err := pool.Create(api.ContainerSpec{
-					RootFSPath: "fake:///path/to/custom-rootfs",
-					Env: []string{
-						"var1=spec-value1",
-						"var2=spec-value2",
+					Properties: api.Properties{
+						container_pool.CapabilitiesProperty: "chown",
 					},
-				})
-
+				}, nil)
 				Ω(err).ShouldNot(HaveOccurred())
-				Ω(container.(*linux_backend.LinuxContainer).CurrentEnvVars()).Should(Equal([]string{
-					"var1=spec-value1",
-					"var2=spec-value2",
-					"var2=rootfs-value-2",
-					"var3=rootfs-value-3",
-				}))
-			})
 
-			Context("when the rootfs URL is not valid", func() {
-				var err error
+				security := container.(*linux_backend.LinuxContainer).Security()
+				Ω(security.Privileged).Should(BeFalse())
+				Ω(security.DroppedCapabilities).Should(ContainElement("CAP_SYS_ADMIN"))
+				Ω(security.DroppedCapabilities).ShouldNot(ContainElement("CAP_CHOWN"))
+			})
 
-				BeforeEach(func() {
-					_, err = pool.Create(api.ContainerSpec{
-						RootFSPath: "::::::",
-					})
-				})
+			Context("and one of them is unknown", func() {
+				It("returns an UnknownCapabilityError without acquiring resources", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.CapabilitiesProperty: "chown,bogus",
+						},
+					}, nil)
+					Ω(err).Should(Equal(capabilities.UnknownCapabilityError{Name: "CAP_BOGUS"}))
 
-				It("returns an error", func() {
-					Ω(err).Should(BeAssignableToTypeOf(&url.Error{}))
+					Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+					Ω(fakeUIDPool.Released).Should(BeEmpty())
 				})
-
-				itReleasesTheUserID()
-				itReleasesTheIPBlock()
 			})
+		})
 
-			Context("when its scheme is unknown", func() {
-				var err error
+		Context("when a read-only rootfs is requested", func() {
+			It("passes the read-only flag and scratch size to create.sh", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.ReadOnlyRootFSProperty: "true",
+						container_pool.ScratchSizeProperty:    "1048576",
+					},
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
 
-				BeforeEach(func() {
-					_, err = pool.Create(api.ContainerSpec{
-						RootFSPath: "unknown:///path/to/custom-rootfs",
-					})
-				})
+				env := fakeRunner.ExecutedCommands()[0].Env
+				Ω(env).Should(ContainElement("read_only_rootfs=true"))
+				Ω(env).Should(ContainElement("scratch_size=1048576"))
+			})
 
-				It("returns ErrUnknownRootFSProvider", func() {
-					Ω(err).Should(Equal(container_pool.ErrUnknownRootFSProvider))
+			Context("and the scratch size is not a number", func() {
+				It("returns an InvalidPropertyError", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.ReadOnlyRootFSProperty: "true",
+							container_pool.ScratchSizeProperty:    "lots",
+						},
+					}, nil)
+					Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+						Property: container_pool.ScratchSizeProperty,
+						Value:    "lots",
+					}))
 				})
-
-				itReleasesTheUserID()
-				itReleasesTheIPBlock()
 			})
+		})
 
-			Context("when providing the mount point fails", func() {
-				var err error
-				providerErr := errors.New("oh no!")
+		Context("when the net-in protocols are invalid", func() {
+			It("returns an InvalidPropertyError", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.NetInProtocolsProperty: "tcp,sctp",
+					},
+				}, nil)
+				Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+					Property: linux_backend.NetInProtocolsProperty,
+					Value:    "tcp,sctp",
+				}))
+			})
+		})
 
-				BeforeEach(func() {
-					fakeRootFSProvider.ProvideRootFSReturns("", nil, providerErr)
+		Context("when the net-in interface is invalid", func() {
+			It("returns an InvalidPropertyError", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.NetInInterfaceProperty: "eth0/../eth1",
+					},
+				}, nil)
+				Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+					Property: linux_backend.NetInInterfaceProperty,
+					Value:    "eth0/../eth1",
+				}))
+			})
+		})
 
-					_, err = pool.Create(api.ContainerSpec{
-						RootFSPath: "fake:///path/to/custom-rootfs",
-					})
-				})
+		Context("when the net-in address is invalid", func() {
+			It("returns an InvalidPropertyError", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.NetInAddressProperty: "::1",
+					},
+				}, nil)
+				Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+					Property: linux_backend.NetInAddressProperty,
+					Value:    "::1",
+				}))
+			})
+		})
 
-				It("returns the error", func() {
-					Ω(err).Should(Equal(providerErr))
-				})
+		Context("when SNAT is disabled", func() {
+			It("passes it to create.sh", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.DisableSNATProperty: "true",
+					},
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
 
-				itReleasesTheUserID()
-				itReleasesTheIPBlock()
+				Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("disable_snat=true"))
+			})
 
-				It("does not execute create.sh", func() {
-					Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
-						fake_command_runner.CommandSpec{
-							Path: "/root/path/create.sh",
+			Context("with an invalid value", func() {
+				It("returns an InvalidPropertyError", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.DisableSNATProperty: "sometimes",
 						},
-					))
+					}, nil)
+					Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+						Property: container_pool.DisableSNATProperty,
+						Value:    "sometimes",
+					}))
 				})
 			})
 		})
 
-		Context("when bind mounts are specified", func() {
-			It("appends mount commands to hook-child-before-pivot.sh", func() {
-				container, err := pool.Create(api.ContainerSpec{
-					BindMounts: []api.BindMount{
-						{
-							SrcPath: "/src/path-ro",
-							DstPath: "/dst/path-ro",
-							Mode:    api.BindMountModeRO,
-						},
-						{
-							SrcPath: "/src/path-rw",
-							DstPath: "/dst/path-rw",
-							Mode:    api.BindMountModeRW,
-						},
-						{
-							SrcPath: "/src/path-rw",
-							DstPath: "/dst/path-rw",
-							Mode:    api.BindMountModeRW,
-							Origin:  api.BindMountOriginContainer,
-						},
+		Context("when static DNS hosts are specified", func() {
+			It("passes them to create.sh", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.DNSHostsProperty: "db=10.0.0.5,cache.internal=10.0.0.6",
 					},
-				})
-
+				}, nil)
 				Ω(err).ShouldNot(HaveOccurred())
 
-				containerPath := path.Join(depotPath, container.ID())
-				rootfsPath := "/provided/rootfs/path"
+				Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("dns_hosts=db=10.0.0.5,cache.internal=10.0.0.6"))
+			})
 
-				Ω(fakeRunner).Should(HaveExecutedSerially(
-					fake_command_runner.CommandSpec{
-						Path: "bash",
-						Args: []string{
-							"-c",
-							"echo >> " + containerPath + "/lib/hook-child-before-pivot.sh",
-						},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "bash",
-						Args: []string{
-							"-c",
-							"echo mkdir -p " + rootfsPath + "/dst/path-ro" +
-								" >> " + containerPath + "/lib/hook-child-before-pivot.sh",
-						},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "bash",
-						Args: []string{
-							"-c",
-							"echo mount -n --bind /src/path-ro " + rootfsPath + "/dst/path-ro" +
-								" >> " + containerPath + "/lib/hook-child-before-pivot.sh",
-						},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "bash",
-						Args: []string{
-							"-c",
-							"echo mount -n --bind -o remount,ro /src/path-ro " + rootfsPath + "/dst/path-ro" +
-								" >> " + containerPath + "/lib/hook-child-before-pivot.sh",
-						},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "bash",
-						Args: []string{
-							"-c",
-							"echo >> " + containerPath + "/lib/hook-child-before-pivot.sh",
-						},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "bash",
-						Args: []string{
-							"-c",
-							"echo mkdir -p " + rootfsPath + "/dst/path-rw" +
-								" >> " + containerPath + "/lib/hook-child-before-pivot.sh",
-						},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "bash",
-						Args: []string{
-							"-c",
-							"echo mount -n --bind /src/path-rw " + rootfsPath + "/dst/path-rw" +
-								" >> " + containerPath + "/lib/hook-child-before-pivot.sh",
-						},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "bash",
-						Args: []string{
-							"-c",
-							"echo mount -n --bind -o remount,rw /src/path-rw " + rootfsPath + "/dst/path-rw" +
-								" >> " + containerPath + "/lib/hook-child-before-pivot.sh",
-						},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "bash",
-						Args: []string{
-							"-c",
-							"echo mkdir -p " + rootfsPath + "/dst/path-rw" +
-								" >> " + containerPath + "/lib/hook-child-before-pivot.sh",
-						},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "bash",
-						Args: []string{
-							"-c",
-							"echo mount -n --bind " + rootfsPath + "/src/path-rw " + rootfsPath + "/dst/path-rw" +
-								" >> " + containerPath + "/lib/hook-child-before-pivot.sh",
-						},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "bash",
-						Args: []string{
-							"-c",
-							"echo mount -n --bind -o remount,rw " + rootfsPath + "/src/path-rw " + rootfsPath + "/dst/path-rw" +
-								" >> " + containerPath + "/lib/hook-child-before-pivot.sh",
-						},
+			for _, value := range []string{"db", "db=not-an-ip", "db;reboot=10.0.0.5", "db=10.0.0.5,"} {
+				value := value
+
+				Context("and they are "+value, func() {
+					It("returns an InvalidPropertyError", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								container_pool.DNSHostsProperty: value,
+							},
+						}, nil)
+						Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+							Property: container_pool.DNSHostsProperty,
+							Value:    value,
+						}))
+					})
+				})
+			}
+		})
+
+		Context("when a nested container is requested", func() {
+			It("returns a PrivilegedContainersNotAllowedError without acquiring resources", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.NestedProperty: "true",
 					},
-				))
-			})
+				}, nil)
+				Ω(err).Should(Equal(container_pool.PrivilegedContainersNotAllowedError{
+					Property: container_pool.NestedProperty,
+				}))
 
-			Context("when appending to hook-child-before-pivot.sh fails", func() {
-				var err error
-				disaster := errors.New("oh no!")
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+				Ω(defaultFakeRootFSProvider.ProvideRootFSCallCount()).Should(Equal(0))
+			})
 
+			Context("and privileged containers are allowed", func() {
 				BeforeEach(func() {
-					fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
-						Path: "bash",
-					}, func(*exec.Cmd) error {
-						return disaster
-					})
+					config := sysconfig.NewConfig("0")
+					config.AllowPrivilegedContainers = true
+
+					pool = container_pool.New(
+						lagertest.NewTestLogger("test"),
+						"/root/path",
+						depotPath,
+						config,
+						map[string]rootfs_provider.RootFSProvider{
+							"": defaultFakeRootFSProvider,
+						},
+						fakeUIDPool,
+						fakeNetworkPool,
+						fakePortPool,
+						allocation_journal.Disabled{},
+						nil,
+						nil,
+						nil,
+						nil,
+						fakeRunner,
+						fake_resolver.New(),
+						fakeQuotaManager,
+						process_tracker.OutputLimit{},
+						container_pool.Hooks{},
+					)
+				})
 
-					_, err = pool.Create(api.ContainerSpec{
-						BindMounts: []api.BindMount{
-							{
-								SrcPath: "/src/path-ro",
-								DstPath: "/dst/path-ro",
-								Mode:    api.BindMountModeRO,
-							},
-							{
-								SrcPath: "/src/path-rw",
-								DstPath: "/dst/path-rw",
-								Mode:    api.BindMountModeRW,
-							},
+				It("tells create.sh to nest it, retaining every capability", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.NestedProperty:       "true",
+							container_pool.CapabilitiesProperty: "chown",
 						},
-					})
+					}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					env := fakeRunner.ExecutedCommands()[0].Env
+					Ω(env).Should(ContainElement("nested=true"))
+					Ω(env).Should(ContainElement("drop_capabilities="))
 				})
 
-				It("returns the error", func() {
-					Ω(err).Should(Equal(disaster))
+				It("gives the container a privileged security configuration, to report", func() {
+					container, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.NestedProperty: "true",
+						},
+					}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(container.(*linux_backend.LinuxContainer).Security()).Should(Equal(linux_backend.Security{
+						Privileged:          true,
+						DroppedCapabilities: []string{},
+					}))
 				})
 
-				itReleasesTheUserID()
-				itReleasesTheIPBlock()
-				itCleansUpTheRootfs()
-				itDeletesTheContainerDirectory()
+				Context("but the property is not a boolean", func() {
+					It("returns an InvalidPropertyError", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								container_pool.NestedProperty: "very",
+							},
+						}, nil)
+						Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+							Property: container_pool.NestedProperty,
+							Value:    "very",
+						}))
+					})
+				})
 			})
 		})
 
-		Context("when acquiring a UID fails", func() {
-			nastyError := errors.New("oh no!")
+		Context("when tmpfs mounts are requested", func() {
+			It("passes them to create.sh", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.TmpfsProperty:   "/var/lib/postgresql:1073741824,/cache",
+						container_pool.ShmSizeProperty: "268435456",
+					},
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
 
-			JustBeforeEach(func() {
-				fakeUIDPool.AcquireError = nastyError
+				env := fakeRunner.ExecutedCommands()[0].Env
+				Ω(env).Should(ContainElement("tmpfs_mounts=/var/lib/postgresql:1073741824,/cache"))
+				Ω(env).Should(ContainElement("shm_size=268435456"))
 			})
 
-			It("returns the error", func() {
-				_, err := pool.Create(api.ContainerSpec{})
-				Ω(err).Should(Equal(nastyError))
-			})
+			for property, value := range map[string]string{
+				container_pool.TmpfsProperty:   "/cache:big",
+				container_pool.ShmSizeProperty: "lots",
+			} {
+				property := property
+				value := value
+
+				Context("and "+property+" is invalid", func() {
+					It("returns an InvalidPropertyError", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								property: value,
+							},
+						}, nil)
+						Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+							Property: property,
+							Value:    value,
+						}))
+					})
+				})
+			}
+
+			for _, value := range []string{"relative/path", "/", "/cache/../../etc", "/cache;rm -rf /", "/cache,", "/proc", "/dev/pts", "/sys/fs/cgroup:1024"} {
+				value := value
+
+				Context("and a path is "+value, func() {
+					It("returns an InvalidPropertyError", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								container_pool.TmpfsProperty: value,
+							},
+						}, nil)
+						Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+							Property: container_pool.TmpfsProperty,
+							Value:    value,
+						}))
+					})
+				})
+			}
 		})
 
-		Context("when acquiring a network fails", func() {
-			nastyError := errors.New("oh no!")
+		Context("when a core dump policy is specified", func() {
+			It("returns a CoreDumpsNotCapturedError without acquiring resources", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.CoreDumpsProperty: container_pool.CoreDumpsCollect,
+					},
+				}, nil)
+				Ω(err).Should(Equal(container_pool.CoreDumpsNotCapturedError{
+					Policy: container_pool.CoreDumpsCollect,
+				}))
 
-			JustBeforeEach(func() {
-				fakeNetworkPool.AcquireError = nastyError
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
 			})
 
-			It("returns the error and releases the uid", func() {
-				_, err := pool.Create(api.ContainerSpec{})
-				Ω(err).Should(Equal(nastyError))
+			Context("and the server captures core dumps", func() {
+				BeforeEach(func() {
+					config := sysconfig.NewConfig("0")
+					config.CoreDumpsDirectory = "/var/cores"
+
+					pool = container_pool.New(
+						lagertest.NewTestLogger("test"),
+						"/root/path",
+						depotPath,
+						config,
+						map[string]rootfs_provider.RootFSProvider{
+							"": defaultFakeRootFSProvider,
+						},
+						fakeUIDPool,
+						fakeNetworkPool,
+						fakePortPool,
+						allocation_journal.Disabled{},
+						nil,
+						nil,
+						nil,
+						nil,
+						fakeRunner,
+						fake_resolver.New(),
+						fakeQuotaManager,
+						process_tracker.OutputLimit{},
+						container_pool.Hooks{},
+					)
+				})
 
-				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+				It("passes it to create.sh", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.CoreDumpsProperty: container_pool.CoreDumpsCollect,
+						},
+					}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("core_dumps=collect"))
+				})
+
+				Context("but the policy is unknown", func() {
+					It("returns an InvalidPropertyError", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								container_pool.CoreDumpsProperty: "upload",
+							},
+						}, nil)
+						Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+							Property: container_pool.CoreDumpsProperty,
+							Value:    "upload",
+						}))
+					})
+				})
 			})
 		})
 
-		Context("when executing create.sh fails", func() {
-			var containerPath string
-			nastyError := errors.New("oh no!")
-
-			BeforeEach(func() {
-				fakeRunner.WhenRunning(
-					fake_command_runner.CommandSpec{
-						Path: "/root/path/create.sh",
-					}, func(cmd *exec.Cmd) error {
-						containerPath = cmd.Args[1]
-						return nastyError
+		Context("when an MTU is specified", func() {
+			It("passes it to create.sh", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.MTUProperty: "9000",
 					},
-				)
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
 
-				pool.Create(api.ContainerSpec{})
+				Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("container_iface_mtu=9000"))
 			})
 
-			It("returns the error and releases the uid and network", func() {
-				_, err := pool.Create(api.ContainerSpec{})
-				Ω(err).Should(Equal(nastyError))
+			for _, value := range []string{"jumbo", "67"} {
+				value := value
 
-				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
-				Ω(fakeNetworkPool.Released).Should(ContainElement("1.2.0.0/30"))
-			})
+				Context("and it is "+value, func() {
+					It("returns an InvalidPropertyError", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								container_pool.MTUProperty: value,
+							},
+						}, nil)
+						Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+							Property: container_pool.MTUProperty,
+							Value:    value,
+						}))
+					})
+				})
+			}
 
-			itReleasesTheUserID()
-			itReleasesTheIPBlock()
-			itDeletesTheContainerDirectory()
-			itCleansUpTheRootfs()
-		})
+			Context("and the server knows the uplink's MTU", func() {
+				BeforeEach(func() {
+					config := sysconfig.NewConfig("0")
+					config.NetworkUplinkMTU = 1500
 
-		Context("when saving the rootfs provider fails", func() {
-			var err error
+					_, subnet, err := net.ParseCIDR("1.2.0.0/16")
+					Ω(err).ShouldNot(HaveOccurred())
 
-			BeforeEach(func() {
-				fakeRunner.WhenRunning(
-					fake_command_runner.CommandSpec{
-						Path: "/root/path/create.sh",
-					}, func(cmd *exec.Cmd) error {
-						containerPath := cmd.Args[1]
-						rootfsProviderPath := filepath.Join(containerPath, "rootfs-provider")
+					config.NetworkMTU = 1400
+					config.NetworkSubnetMTUs = []sysconfig.SubnetMTU{
+						{Network: subnet, MTU: 1450},
+					}
+
+					pool = container_pool.New(
+						lagertest.NewTestLogger("test"),
+						"/root/path",
+						depotPath,
+						config,
+						map[string]rootfs_provider.RootFSProvider{
+							"": defaultFakeRootFSProvider,
+						},
+						fakeUIDPool,
+						fakeNetworkPool,
+						fakePortPool,
+						allocation_journal.Disabled{},
+						nil,
+						nil,
+						nil,
+						nil,
+						fakeRunner,
+						fake_resolver.New(),
+						fakeQuotaManager,
+						process_tracker.OutputLimit{},
+						container_pool.Hooks{},
+					)
+				})
 
-						// creating a directory with this name will cause the write to the
-						// file to fail.
-						err := os.MkdirAll(rootfsProviderPath, 0755)
+				It("returns an MTUExceedsUplinkError without acquiring resources if it is larger", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.MTUProperty: "9000",
+						},
+					}, nil)
+					Ω(err).Should(Equal(container_pool.MTUExceedsUplinkError{
+						MTU:       9000,
+						UplinkMTU: 1500,
+					}))
+
+					Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+				})
+
+				It("overrides the MTU for the container's subnet", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.MTUProperty: "1300",
+						},
+					}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("container_iface_mtu=1300"))
+				})
+
+				Context("when no MTU is specified", func() {
+					It("uses the MTU for the container's subnet", func() {
+						_, err := pool.Create(api.ContainerSpec{}, nil)
 						Ω(err).ShouldNot(HaveOccurred())
 
-						return nil
+						Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("container_iface_mtu=1450"))
+					})
+				})
+			})
+		})
+
+		Context("when CPU limits are specified", func() {
+			It("passes them to create.sh", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.CPUQuotaProperty:  "50000",
+						container_pool.CPUPeriodProperty: "100000",
+						container_pool.CPUSetProperty:    "0-1,3",
 					},
-				)
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
 
-				_, err = pool.Create(api.ContainerSpec{})
+				env := fakeRunner.ExecutedCommands()[0].Env
+				Ω(env).Should(ContainElement("cpu_quota_us=50000"))
+				Ω(env).Should(ContainElement("cpu_period_us=100000"))
+				Ω(env).Should(ContainElement("cpuset_cpus=0-1,3"))
 			})
 
-			It("returns an error", func() {
-				Ω(err).Should(HaveOccurred())
-			})
+			for property, value := range map[string]string{
+				container_pool.CPUQuotaProperty:  "999",
+				container_pool.CPUPeriodProperty: "1000001",
+				container_pool.CPUSetProperty:    "0-1;rm -rf /",
+			} {
+				property := property
+				value := value
+
+				Context("and "+property+" is invalid", func() {
+					It("returns an InvalidPropertyError", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								property: value,
+							},
+						}, nil)
+						Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+							Property: property,
+							Value:    value,
+						}))
+					})
+				})
+			}
+		})
+
+		Context("when a maximum number of processes is specified", func() {
+			It("passes it to create.sh", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.PidsMaxProperty: "512",
+					},
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("pids_max=512"))
+			})
+
+			Context("and it is not a number", func() {
+				It("returns an InvalidPropertyError", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.PidsMaxProperty: "many",
+						},
+					}, nil)
+					Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+						Property: container_pool.PidsMaxProperty,
+						Value:    "many",
+					}))
+				})
+			})
+		})
+
+		Context("when an OOM score adjustment is specified", func() {
+			It("passes it to create.sh", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.OOMScoreAdjProperty: "500",
+					},
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("oom_score_adj=500"))
+			})
+
+			for _, value := range []string{"low", "-1001", "1001"} {
+				value := value
+
+				Context("and it is "+value, func() {
+					It("returns an InvalidPropertyError", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								container_pool.OOMScoreAdjProperty: value,
+							},
+						}, nil)
+						Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+							Property: container_pool.OOMScoreAdjProperty,
+							Value:    value,
+						}))
+					})
+				})
+			}
+
+			Context("and the server has a default", func() {
+				var config sysconfig.Config
+
+				BeforeEach(func() {
+					config = sysconfig.NewConfig("0")
+					config.ContainerOOMScoreAdj = 500
+				})
+
+				JustBeforeEach(func() {
+					pool = container_pool.New(
+						lagertest.NewTestLogger("test"),
+						"/root/path",
+						depotPath,
+						config,
+						map[string]rootfs_provider.RootFSProvider{
+							"": defaultFakeRootFSProvider,
+						},
+						fakeUIDPool,
+						fakeNetworkPool,
+						fakePortPool,
+						allocation_journal.Disabled{},
+						nil,
+						nil,
+						nil,
+						nil,
+						fakeRunner,
+						fake_resolver.New(),
+						fakeQuotaManager,
+						process_tracker.OutputLimit{},
+						container_pool.Hooks{},
+					)
+				})
+
+				It("gives containers the default unless they override it", func() {
+					_, err := pool.Create(api.ContainerSpec{}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("oom_score_adj=500"))
+				})
+
+				It("lets containers raise it", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.OOMScoreAdjProperty: "1000",
+						},
+					}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("oom_score_adj=1000"))
+				})
+
+				It("returns a PrivilegedContainersNotAllowedError without acquiring resources if it is lowered", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.OOMScoreAdjProperty: "0",
+						},
+					}, nil)
+					Ω(err).Should(Equal(container_pool.PrivilegedContainersNotAllowedError{
+						Property: container_pool.OOMScoreAdjProperty,
+					}))
+
+					Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+				})
+
+				Context("and privileged containers are allowed", func() {
+					BeforeEach(func() {
+						config.AllowPrivilegedContainers = true
+					})
+
+					It("lets containers lower it", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								container_pool.OOMScoreAdjProperty: "-1000",
+							},
+						}, nil)
+						Ω(err).ShouldNot(HaveOccurred())
+
+						Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("oom_score_adj=-1000"))
+					})
+				})
+			})
+		})
+
+		Context("when a conntrack entry limit is specified", func() {
+			It("passes it to create.sh", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.MaxConntrackEntriesProperty: "1000",
+					},
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("max_conntrack_entries=1000"))
+			})
+
+			Context("and it is invalid", func() {
+				It("returns an InvalidPropertyError", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.MaxConntrackEntriesProperty: "lots",
+						},
+					}, nil)
+					Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+						Property: container_pool.MaxConntrackEntriesProperty,
+						Value:    "lots",
+					}))
+				})
+			})
+
+			Context("and the server has a default", func() {
+				var config sysconfig.Config
+
+				BeforeEach(func() {
+					config = sysconfig.NewConfig("0")
+					config.ContainerMaxConntrackEntries = 1000
+				})
+
+				JustBeforeEach(func() {
+					pool = container_pool.New(
+						lagertest.NewTestLogger("test"),
+						"/root/path",
+						depotPath,
+						config,
+						map[string]rootfs_provider.RootFSProvider{
+							"": defaultFakeRootFSProvider,
+						},
+						fakeUIDPool,
+						fakeNetworkPool,
+						fakePortPool,
+						allocation_journal.Disabled{},
+						nil,
+						nil,
+						nil,
+						nil,
+						fakeRunner,
+						fake_resolver.New(),
+						fakeQuotaManager,
+						process_tracker.OutputLimit{},
+						container_pool.Hooks{},
+					)
+				})
+
+				It("gives containers the default unless they override it", func() {
+					_, err := pool.Create(api.ContainerSpec{}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("max_conntrack_entries=1000"))
+				})
+
+				It("lets containers lower it", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.MaxConntrackEntriesProperty: "100",
+						},
+					}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("max_conntrack_entries=100"))
+				})
+
+				for _, value := range []string{"1001", "0"} {
+					value := value
+
+					It("returns a PrivilegedContainersNotAllowedError without acquiring resources if it is raised to "+value, func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								container_pool.MaxConntrackEntriesProperty: value,
+							},
+						}, nil)
+						Ω(err).Should(Equal(container_pool.PrivilegedContainersNotAllowedError{
+							Property: container_pool.MaxConntrackEntriesProperty,
+						}))
+
+						Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+					})
+				}
+
+				Context("and privileged containers are allowed", func() {
+					BeforeEach(func() {
+						config.AllowPrivilegedContainers = true
+					})
+
+					It("lets containers lift it", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								container_pool.MaxConntrackEntriesProperty: "0",
+							},
+						}, nil)
+						Ω(err).ShouldNot(HaveOccurred())
+
+						Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("max_conntrack_entries=0"))
+					})
+				})
+			})
+		})
+
+		Context("when the server has external IPs", func() {
+			var config sysconfig.Config
+
+			BeforeEach(func() {
+				config = sysconfig.NewConfig("0")
+				config.ExternalIPs = []string{"203.0.113.1", "203.0.113.2"}
+			})
+
+			JustBeforeEach(func() {
+				pool = container_pool.New(
+					lagertest.NewTestLogger("test"),
+					"/root/path",
+					depotPath,
+					config,
+					map[string]rootfs_provider.RootFSProvider{
+						"": defaultFakeRootFSProvider,
+					},
+					fakeUIDPool,
+					fakeNetworkPool,
+					fakePortPool,
+					allocation_journal.Disabled{},
+					nil,
+					nil,
+					nil,
+					nil,
+					fakeRunner,
+					fake_resolver.New(),
+					fakeQuotaManager,
+					process_tracker.OutputLimit{},
+					container_pool.Hooks{},
+				)
+			})
+
+			It("gives containers each of them in turn", func() {
+				for _, ip := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.1"} {
+					_, err := pool.Create(api.ContainerSpec{}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					commands := fakeRunner.ExecutedCommands()
+					Ω(commands[len(commands)-1].Env).Should(ContainElement("snat_ip=" + ip))
+				}
+			})
+
+			It("gives a container the one it chooses", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.ExternalIPProperty: "203.0.113.2",
+					},
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("snat_ip=203.0.113.2"))
+			})
+
+			It("returns an ExternalIPNotConfiguredError without acquiring resources for any other", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.ExternalIPProperty: "203.0.113.3",
+					},
+				}, nil)
+				Ω(err).Should(Equal(container_pool.ExternalIPNotConfiguredError{
+					IP: "203.0.113.3",
+				}))
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+
+			It("gives containers with SNAT disabled none", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.DisableSNATProperty: "true",
+					},
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner.ExecutedCommands()[0].Env).Should(ContainElement("snat_ip="))
+			})
+
+			for _, properties := range []api.Properties{
+				{linux_backend.ExternalIPProperty: "somewhere"},
+				{linux_backend.ExternalIPProperty: "2001:db8::1"},
+				{linux_backend.ExternalIPProperty: "203.0.113.1", container_pool.DisableSNATProperty: "true"},
+			} {
+				properties := properties
+
+				Context(fmt.Sprintf("and the properties are %v", properties), func() {
+					It("returns an InvalidPropertyError", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: properties,
+						}, nil)
+						Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+							Property: linux_backend.ExternalIPProperty,
+							Value:    properties[linux_backend.ExternalIPProperty],
+						}))
+					})
+				})
+			}
+		})
+
+		Context("when a container chooses an external IP but the server has none", func() {
+			It("returns an ExternalIPNotConfiguredError", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.ExternalIPProperty: "203.0.113.1",
+					},
+				}, nil)
+				Ω(err).Should(Equal(container_pool.ExternalIPNotConfiguredError{
+					IP: "203.0.113.1",
+				}))
+			})
+		})
+
+		Context("when DNS search domains and options are specified", func() {
+			It("passes them to create.sh", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.DNSSearchProperty:  "service.internal,cluster.local",
+						container_pool.DNSOptionsProperty: "ndots:5,rotate",
+					},
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				env := fakeRunner.ExecutedCommands()[0].Env
+				Ω(env).Should(ContainElement("dns_search=service.internal,cluster.local"))
+				Ω(env).Should(ContainElement("dns_options=ndots:5,rotate"))
+			})
+
+			for property, value := range map[string]string{
+				container_pool.DNSSearchProperty:  "bad domain!",
+				container_pool.DNSOptionsProperty: "ndots=5",
+			} {
+				property, value := property, value
+
+				Context("and "+property+" is "+value, func() {
+					It("returns an InvalidPropertyError", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								property: value,
+							},
+						}, nil)
+						Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+							Property: property,
+							Value:    value,
+						}))
+					})
+				})
+			}
+
+			Context("and the server has defaults", func() {
+				BeforeEach(func() {
+					config := sysconfig.NewConfig("0")
+					config.DNSSearchDomains = []string{"default.internal"}
+					config.DNSOptions = []string{"ndots:2"}
+
+					pool = container_pool.New(
+						lagertest.NewTestLogger("test"),
+						"/root/path",
+						depotPath,
+						config,
+						map[string]rootfs_provider.RootFSProvider{
+							"": defaultFakeRootFSProvider,
+						},
+						fakeUIDPool,
+						fakeNetworkPool,
+						fakePortPool,
+						allocation_journal.Disabled{},
+						nil,
+						nil,
+						nil,
+						nil,
+						fakeRunner,
+						fake_resolver.New(),
+						fakeQuotaManager,
+						process_tracker.OutputLimit{},
+						container_pool.Hooks{},
+					)
+				})
+
+				It("gives containers the defaults unless they override them", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.DNSOptionsProperty: "ndots:5",
+						},
+					}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					env := fakeRunner.ExecutedCommands()[0].Env
+					Ω(env).Should(ContainElement("dns_search=default.internal"))
+					Ω(env).Should(ContainElement("dns_options=ndots:5"))
+				})
+			})
+		})
+
+		for _, value := range []string{"soon", "0s", "-1s"} {
+			value := value
+
+			Context("when the pre-stop timeout is "+value, func() {
+				It("returns an InvalidPropertyError", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							linux_backend.PreStopTimeoutProperty: value,
+						},
+					}, nil)
+					Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+						Property: linux_backend.PreStopTimeoutProperty,
+						Value:    value,
+					}))
+				})
+			})
+		}
+
+		Context("when the swap allowance is not a number", func() {
+			It("returns an InvalidPropertyError", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.MemorySwapProperty: "lots",
+					},
+				}, nil)
+				Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+					Property: linux_backend.MemorySwapProperty,
+					Value:    "lots",
+				}))
+			})
+		})
+
+		Context("when block IO limits are specified", func() {
+			It("passes them to create.sh", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						container_pool.BlkioReadBPSProperty:   "1048576",
+						container_pool.BlkioWriteBPSProperty:  "2097152",
+						container_pool.BlkioReadIOPSProperty:  "100",
+						container_pool.BlkioWriteIOPSProperty: "200",
+					},
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				env := fakeRunner.ExecutedCommands()[0].Env
+				Ω(env).Should(ContainElement("blkio_read_bps=1048576"))
+				Ω(env).Should(ContainElement("blkio_write_bps=2097152"))
+				Ω(env).Should(ContainElement("blkio_read_iops=100"))
+				Ω(env).Should(ContainElement("blkio_write_iops=200"))
+			})
+
+			Context("and one of them is not a number", func() {
+				It("returns an InvalidPropertyError", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							container_pool.BlkioWriteIOPSProperty: "-1",
+						},
+					}, nil)
+					Ω(err).Should(Equal(container_pool.InvalidPropertyError{
+						Property: container_pool.BlkioWriteIOPSProperty,
+						Value:    "-1",
+					}))
+				})
+			})
+		})
+
+		Context("when a user is specified", func() {
+			var rootfsPath string
+
+			BeforeEach(func() {
+				var err error
+
+				rootfsPath, err = ioutil.TempDir("", "rootfs-path")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = os.MkdirAll(path.Join(rootfsPath, "etc"), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(rootfsPath, "etc", "passwd"), []byte(
+					"root:x:0:0:root:/root:/bin/bash\n"+
+						"alice:x:1000:1000::/home/alice:/bin/sh\n",
+				), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				fakeRootFSProvider.ProvideRootFSReturns(rootfsPath, nil, nil)
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(rootfsPath)
+			})
+
+			Context("and the user exists in the rootfs", func() {
+				It("succeeds", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						RootFSPath: "fake:///path/to/custom-rootfs",
+						Properties: api.Properties{
+							linux_backend.UserProperty: "alice",
+						},
+					}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+			})
+
+			Context("and the user does not exist in the rootfs", func() {
+				var err error
+
+				BeforeEach(func() {
+					_, err = pool.Create(api.ContainerSpec{
+						RootFSPath: "fake:///path/to/custom-rootfs",
+						Properties: api.Properties{
+							linux_backend.UserProperty: "bob",
+						},
+					}, nil)
+				})
+
+				It("returns a UserNotFoundError", func() {
+					Ω(err).Should(Equal(container_pool.UserNotFoundError{User: "bob"}))
+				})
+
+				itReleasesTheUserID()
+				itReleasesTheIPBlock()
+				itDeletesTheContainerDirectory()
+			})
+		})
+
+		It("saves the determined rootfs provider to the depot", func() {
+			container, err := pool.Create(api.ContainerSpec{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			body, err := ioutil.ReadFile(path.Join(depotPath, container.ID(), "rootfs-provider"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(string(body)).Should(Equal(""))
+		})
+
+		Context("when a rootfs is specified", func() {
+			It("is used to provide a rootfs", func() {
+				container, err := pool.Create(api.ContainerSpec{
+					RootFSPath: "fake:///path/to/custom-rootfs",
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, id, uri := fakeRootFSProvider.ProvideRootFSArgsForCall(0)
+				Ω(id).Should(Equal(container.ID()))
+				Ω(uri).Should(Equal(&url.URL{
+					Scheme: "fake",
+					Host:   "",
+					Path:   "/path/to/custom-rootfs",
+				}))
+			})
+
+			It("passes the provided rootfs as $rootfs_path to create.sh", func() {
+				fakeRootFSProvider.ProvideRootFSReturns("/var/some/mount/point", nil, nil)
+
+				container, err := pool.Create(api.ContainerSpec{
+					RootFSPath: "fake:///path/to/custom-rootfs",
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/create.sh",
+						Args: []string{path.Join(depotPath, container.ID())},
+						Env: []string{
+							"id=" + container.ID(),
+							"rootfs_path=/var/some/mount/point",
+							"user_uid=10000",
+							"network_host_ip=1.2.0.1",
+							"network_container_ip=1.2.0.2",
+							"network_prefix_length=30",
+							"disk_quota_type=user",
+							"drop_capabilities=2,9,11,12,14,15,16,17,19,20,21,22,23,24,25,26,28,30,32,33,34,35,36",
+							"read_only_rootfs=false",
+							"scratch_size=0",
+							"disable_snat=false",
+							"nested=false",
+							"cpu_quota_us=0",
+							"cpu_period_us=0",
+							"cpuset_cpus=",
+							"pids_max=0",
+							"blkio_read_bps=0",
+							"blkio_write_bps=0",
+							"blkio_read_iops=0",
+							"blkio_write_iops=0",
+							"dns_hosts=",
+							"tmpfs_mounts=",
+							"shm_size=0",
+							"core_dumps=quota",
+							"oom_score_adj=0",
+							"max_conntrack_entries=0",
+							"snat_ip=",
+							"dns_search=",
+							"dns_options=",
+							"container_iface_mtu=1500",
+
+							"PATH=" + os.Getenv("PATH"),
+						},
+					},
+				))
+			})
+
+			It("saves the determined rootfs provider to the depot", func() {
+				container, err := pool.Create(api.ContainerSpec{
+					RootFSPath: "fake:///path/to/custom-rootfs",
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				body, err := ioutil.ReadFile(path.Join(depotPath, container.ID(), "rootfs-provider"))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(string(body)).Should(Equal("fake"))
+			})
+
+			It("merges the env vars associated with the rootfs with those in the spec", func() {
+				fakeRootFSProvider.ProvideRootFSReturns("/provided/rootfs/path", []string{
+					"var2=rootfs-value-2",
+					"var3=rootfs-value-3",
+				}, nil)
+
+				container, err := pool.Create(api.ContainerSpec{
+					RootFSPath: "fake:///path/to/custom-rootfs",
+					Env: []string{
+						"var1=spec-value1",
+						"var2=spec-value2",
+					},
+				}, nil)
+
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(container.(*linux_backend.LinuxContainer).CurrentEnvVars()).Should(Equal([]string{
+					"var1=spec-value1",
+					"var2=spec-value2",
+					"var2=rootfs-value-2",
+					"var3=rootfs-value-3",
+				}))
+			})
+
+			Context("when the server has a default environment", func() {
+				BeforeEach(func() {
+					pool = container_pool.New(
+						lagertest.NewTestLogger("test"),
+						"/root/path",
+						depotPath,
+						sysconfig.NewConfig("0"),
+						map[string]rootfs_provider.RootFSProvider{
+							"":     defaultFakeRootFSProvider,
+							"fake": fakeRootFSProvider,
+						},
+						fakeUIDPool,
+						fakeNetworkPool,
+						fakePortPool,
+						allocation_journal.Disabled{},
+						nil,
+						nil,
+						nil,
+						[]string{
+							"var0=default-value-0",
+							"var1=default-value-1",
+						},
+						fakeRunner,
+						fake_resolver.New(),
+						fakeQuotaManager,
+						process_tracker.OutputLimit{},
+						container_pool.Hooks{},
+					)
+				})
+
+				It("merges it beneath the env vars in the spec and the rootfs", func() {
+					fakeRootFSProvider.ProvideRootFSReturns("/provided/rootfs/path", []string{
+						"var2=rootfs-value-2",
+					}, nil)
+
+					container, err := pool.Create(api.ContainerSpec{
+						RootFSPath: "fake:///path/to/custom-rootfs",
+						Env: []string{
+							"var1=spec-value1",
+						},
+					}, nil)
+
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(container.(*linux_backend.LinuxContainer).CurrentEnvVars()).Should(Equal([]string{
+						"var0=default-value-0",
+						"var1=default-value-1",
+						"var1=spec-value1",
+						"var2=rootfs-value-2",
+					}))
+				})
+			})
+
+			Context("when the rootfs comes from an image", func() {
+				var imageProvider *imageRootFSProvider
+				var rootfsPath string
+
+				BeforeEach(func() {
+					var err error
+					rootfsPath, err = ioutil.TempDir("", "image-rootfs")
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = os.MkdirAll(path.Join(rootfsPath, "etc"), 0755)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = ioutil.WriteFile(path.Join(rootfsPath, "etc", "passwd"), []byte("image-user:x:1000:1000::/home/image-user:/bin/sh\n"), 0644)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					imageProvider = &imageRootFSProvider{
+						FakeRootFSProvider: new(fake_rootfs_provider.FakeRootFSProvider),
+
+						config: repository_fetcher.ImageConfig{
+							User:       "image-user",
+							WorkingDir: "/image/dir",
+							Entrypoint: []string{"/image/entrypoint"},
+							Cmd:        []string{"cmd-arg"},
+						},
+					}
+
+					imageProvider.ProvideRootFSReturns(rootfsPath, nil, nil)
+
+					pool = container_pool.New(
+						lagertest.NewTestLogger("test"),
+						"/root/path",
+						depotPath,
+						sysconfig.NewConfig("0"),
+						map[string]rootfs_provider.RootFSProvider{
+							"":       defaultFakeRootFSProvider,
+							"docker": imageProvider,
+						},
+						fakeUIDPool,
+						fakeNetworkPool,
+						fakePortPool,
+						allocation_journal.Disabled{},
+						nil,
+						nil,
+						nil,
+						nil,
+						fakeRunner,
+						fake_resolver.New(),
+						fakeQuotaManager,
+						process_tracker.OutputLimit{},
+						container_pool.Hooks{},
+					)
+				})
+
+				AfterEach(func() {
+					os.RemoveAll(rootfsPath)
+				})
+
+				processDefaults := func(container api.Container) linux_backend.ProcessDefaults {
+					out := new(bytes.Buffer)
+					err := container.(*linux_backend.LinuxContainer).Snapshot(out)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					var snapshot linux_backend.ContainerSnapshot
+					err = json.NewDecoder(out).Decode(&snapshot)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					return snapshot.ProcessDefaults
+				}
+
+				It("gives the container the image's process defaults", func() {
+					container, err := pool.Create(api.ContainerSpec{
+						RootFSPath: "docker:///some-image",
+					}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(processDefaults(container)).Should(Equal(linux_backend.ProcessDefaults{
+						User:       "image-user",
+						Dir:        "/image/dir",
+						Entrypoint: []string{"/image/entrypoint"},
+						Cmd:        []string{"cmd-arg"},
+					}))
+				})
+
+				Context("when the image's user is not in the rootfs", func() {
+					BeforeEach(func() {
+						imageProvider.config.User = "1000:1000"
+					})
+
+					It("leaves the user out of the defaults", func() {
+						container, err := pool.Create(api.ContainerSpec{
+							RootFSPath: "docker:///some-image",
+						}, nil)
+						Ω(err).ShouldNot(HaveOccurred())
+
+						Ω(processDefaults(container).User).Should(BeEmpty())
+						Ω(processDefaults(container).Dir).Should(Equal("/image/dir"))
+					})
+				})
+			})
+
+			Context("when the rootfs URL is not valid", func() {
+				var err error
+
+				BeforeEach(func() {
+					_, err = pool.Create(api.ContainerSpec{
+						RootFSPath: "::::::",
+					}, nil)
+				})
+
+				It("returns an error", func() {
+					Ω(err).Should(BeAssignableToTypeOf(&url.Error{}))
+				})
+
+				itReleasesTheUserID()
+				itReleasesTheIPBlock()
+			})
+
+			Context("when its scheme is unknown", func() {
+				var err error
+
+				BeforeEach(func() {
+					_, err = pool.Create(api.ContainerSpec{
+						RootFSPath: "unknown:///path/to/custom-rootfs",
+					}, nil)
+				})
+
+				It("returns ErrUnknownRootFSProvider", func() {
+					Ω(err).Should(Equal(container_pool.ErrUnknownRootFSProvider))
+				})
+
+				itReleasesTheUserID()
+				itReleasesTheIPBlock()
+			})
+
+			Context("when its scheme is only for explicitly given providers", func() {
+				var explicitProvider *fake_rootfs_provider.FakeRootFSProvider
+
+				BeforeEach(func() {
+					explicitProvider = new(fake_rootfs_provider.FakeRootFSProvider)
+					explicitProvider.ProvideRootFSReturns("/provided/rootfs/path", nil, nil)
+
+					pool.RegisterExplicitRootFSProvider("clone", explicitProvider)
+				})
+
+				It("returns ErrUnknownRootFSProvider from a spec alone", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						RootFSPath: "clone:///some-id",
+					}, nil)
+					Ω(err).Should(Equal(container_pool.ErrUnknownRootFSProvider))
+
+					Ω(explicitProvider.ProvideRootFSCallCount()).Should(Equal(0))
+				})
+
+				It("uses the provider when it is given explicitly", func() {
+					container, err := pool.CreateWithRootFS(api.ContainerSpec{
+						RootFSPath: "clone:///some-id",
+					}, explicitProvider, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(explicitProvider.ProvideRootFSCallCount()).Should(Equal(1))
+
+					body, err := ioutil.ReadFile(path.Join(depotPath, container.ID(), "rootfs-provider"))
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(string(body)).Should(Equal("clone"))
+
+					err = pool.Destroy(container)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(explicitProvider.CleanupRootFSCallCount()).Should(Equal(1))
+				})
+
+				It("refuses a provider given for a scheme it wasn't registered for", func() {
+					_, err := pool.CreateWithRootFS(api.ContainerSpec{
+						RootFSPath: "other:///some-id",
+					}, explicitProvider, nil)
+					Ω(err).Should(Equal(container_pool.ErrUnknownRootFSProvider))
+				})
+			})
+
+			Context("when providing the mount point fails", func() {
+				var err error
+				providerErr := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeRootFSProvider.ProvideRootFSReturns("", nil, providerErr)
+
+					_, err = pool.Create(api.ContainerSpec{
+						RootFSPath: "fake:///path/to/custom-rootfs",
+					}, nil)
+				})
+
+				It("returns the error", func() {
+					Ω(err).Should(Equal(container_pool.ProvideRootFSError{Err: providerErr}))
+					Ω(err.Error()).Should(Equal("oh no!"))
+				})
+
+				itReleasesTheUserID()
+				itReleasesTheIPBlock()
+
+				It("does not execute create.sh", func() {
+					Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: "/root/path/create.sh",
+						},
+					))
+				})
+			})
+		})
+
+		Context("when rootfses are restricted to a set of prefixes", func() {
+			BeforeEach(func() {
+				pool = container_pool.New(
+					lagertest.NewTestLogger("test"),
+					"/root/path",
+					depotPath,
+					sysconfig.NewConfig("0"),
+					map[string]rootfs_provider.RootFSProvider{
+						"":     defaultFakeRootFSProvider,
+						"fake": fakeRootFSProvider,
+					},
+					fakeUIDPool,
+					fakeNetworkPool,
+					fakePortPool,
+					allocation_journal.Disabled{},
+					nil,
+					nil,
+					[]string{"/allowed/rootfses", "fake://some.registry/"},
+					nil,
+					fakeRunner,
+					fake_resolver.New(),
+					fakeQuotaManager,
+					process_tracker.OutputLimit{},
+					container_pool.Hooks{},
+				)
+			})
+
+			It("allows the default rootfs", func() {
+				_, err := pool.Create(api.ContainerSpec{}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("allows rootfses beginning with an allowed prefix", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					RootFSPath: "/allowed/rootfses/some-rootfs",
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = pool.Create(api.ContainerSpec{
+					RootFSPath: "fake://some.registry/some-repository#some-tag",
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			for _, rootFSPath := range []string{
+				"/some/other/rootfs",
+				"/allowed/rootfses-not-really",
+				"/allowed/rootfses/../../etc",
+				"fake://some.registry.evil/some-repository",
+				"fake:///some-repository",
+			} {
+				rootFSPath := rootFSPath
+
+				Context("when the rootfs is "+rootFSPath, func() {
+					var err error
+
+					BeforeEach(func() {
+						_, err = pool.Create(api.ContainerSpec{
+							RootFSPath: rootFSPath,
+						}, nil)
+					})
+
+					It("returns a RootFSNotAllowedError", func() {
+						Ω(err).Should(Equal(container_pool.RootFSNotAllowedError{RootFSPath: rootFSPath}))
+					})
+
+					It("does not provide a rootfs", func() {
+						Ω(defaultFakeRootFSProvider.ProvideRootFSCallCount()).Should(Equal(0))
+						Ω(fakeRootFSProvider.ProvideRootFSCallCount()).Should(Equal(0))
+					})
+				})
+			}
+		})
+
+		Context("when bind mounts are specified", func() {
+			var sourcesPath string
+			var rootfsPath string
+
+			BeforeEach(func() {
+				var err error
+
+				sourcesPath, err = ioutil.TempDir("", "bind-mount-sources")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = os.MkdirAll(path.Join(sourcesPath, "src", "path-ro"), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = os.MkdirAll(path.Join(sourcesPath, "src", "path-rw"), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(sourcesPath, "src", "file"), []byte("hello"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				rootfsPath, err = ioutil.TempDir("", "bind-mount-rootfs")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = os.MkdirAll(path.Join(rootfsPath, "src", "path-rw"), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				defaultFakeRootFSProvider.ProvideRootFSReturns(rootfsPath, nil, nil)
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(sourcesPath)
+				os.RemoveAll(rootfsPath)
+			})
+
+			hookCommand := func(containerPath, command string) fake_command_runner.CommandSpec {
+				echo := "echo"
+				if command != "" {
+					echo += " " + command
+				}
+
+				return fake_command_runner.CommandSpec{
+					Path: "bash",
+					Args: []string{
+						"-c",
+						echo + " >> " + containerPath + "/lib/hook-child-before-pivot.sh",
+					},
+				}
+			}
+
+			It("appends mount commands to hook-child-before-pivot.sh", func() {
+				container, err := pool.Create(api.ContainerSpec{
+					BindMounts: []api.BindMount{
+						{
+							SrcPath: sourcesPath + "/src/path-ro",
+							DstPath: "/dst/path-ro",
+							Mode:    api.BindMountModeRO,
+						},
+						{
+							SrcPath: sourcesPath + "/src/path-rw",
+							DstPath: "/dst/path-rw",
+							Mode:    api.BindMountModeRW,
+						},
+						{
+							SrcPath: "/src/path-rw",
+							DstPath: "/dst/path-rw",
+							Mode:    api.BindMountModeRW,
+							Origin:  api.BindMountOriginContainer,
+						},
+					},
+				}, nil)
+
+				Ω(err).ShouldNot(HaveOccurred())
+
+				containerPath := path.Join(depotPath, container.ID())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					hookCommand(containerPath, ""),
+					hookCommand(containerPath, "mkdir -p "+rootfsPath+"/dst/path-ro"),
+					hookCommand(containerPath, "mount -n --bind "+sourcesPath+"/src/path-ro "+rootfsPath+"/dst/path-ro"),
+					hookCommand(containerPath, "mount -n -o remount,bind,ro "+rootfsPath+"/dst/path-ro"),
+					hookCommand(containerPath, ""),
+					hookCommand(containerPath, "mkdir -p "+rootfsPath+"/dst/path-rw"),
+					hookCommand(containerPath, "mount -n --bind "+sourcesPath+"/src/path-rw "+rootfsPath+"/dst/path-rw"),
+					hookCommand(containerPath, ""),
+					hookCommand(containerPath, "mkdir -p "+rootfsPath+"/dst/path-rw"),
+					hookCommand(containerPath, "mount -n --bind "+rootfsPath+"/src/path-rw "+rootfsPath+"/dst/path-rw"),
+				))
+
+				Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+					hookCommand(containerPath, "mount -n -o remount,bind,ro "+rootfsPath+"/dst/path-rw"),
+				))
+			})
+
+			Context("when no mode is given", func() {
+				It("mounts read-only", func() {
+					container, err := pool.Create(api.ContainerSpec{
+						BindMounts: []api.BindMount{
+							{
+								SrcPath: sourcesPath + "/src/path-ro",
+								DstPath: "/dst/path-ro",
+							},
+						},
+					}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					containerPath := path.Join(depotPath, container.ID())
+
+					Ω(fakeRunner).Should(HaveExecutedSerially(
+						hookCommand(containerPath, "mount -n -o remount,bind,ro "+rootfsPath+"/dst/path-ro"),
+					))
+				})
+			})
+
+			Context("when the source is a file", func() {
+				It("creates a file to mount it onto", func() {
+					container, err := pool.Create(api.ContainerSpec{
+						BindMounts: []api.BindMount{
+							{
+								SrcPath: sourcesPath + "/src/file",
+								DstPath: "/etc/some-file",
+							},
+						},
+					}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					containerPath := path.Join(depotPath, container.ID())
+
+					Ω(fakeRunner).Should(HaveExecutedSerially(
+						hookCommand(containerPath, "mkdir -p "+rootfsPath+"/etc"),
+						hookCommand(containerPath, "touch "+rootfsPath+"/etc/some-file"),
+						hookCommand(containerPath, "mount -n --bind "+sourcesPath+"/src/file "+rootfsPath+"/etc/some-file"),
+					))
+				})
+			})
+
+			Context("when the paths try to escape the rootfs", func() {
+				It("resolves them within the rootfs", func() {
+					container, err := pool.Create(api.ContainerSpec{
+						BindMounts: []api.BindMount{
+							{
+								SrcPath: "../../src/path-rw",
+								DstPath: "../../dst/path-rw",
+								Origin:  api.BindMountOriginContainer,
+							},
+						},
+					}, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					containerPath := path.Join(depotPath, container.ID())
+
+					Ω(fakeRunner).Should(HaveExecutedSerially(
+						hookCommand(containerPath, "mount -n --bind "+rootfsPath+"/src/path-rw "+rootfsPath+"/dst/path-rw"),
+					))
+				})
+
+				Context("through symlinks in the rootfs", func() {
+					BeforeEach(func() {
+						err := os.Symlink("/", path.Join(rootfsPath, "absolute"))
+						Ω(err).ShouldNot(HaveOccurred())
+
+						err = os.Symlink("../../../..", path.Join(rootfsPath, "src", "relative"))
+						Ω(err).ShouldNot(HaveOccurred())
+					})
+
+					It("follows them within the rootfs", func() {
+						container, err := pool.Create(api.ContainerSpec{
+							BindMounts: []api.BindMount{
+								{
+									SrcPath: "/src/relative/src/path-rw",
+									DstPath: "/absolute/../absolute/dst/path-rw",
+									Origin:  api.BindMountOriginContainer,
+								},
+							},
+						}, nil)
+						Ω(err).ShouldNot(HaveOccurred())
+
+						containerPath := path.Join(depotPath, container.ID())
+
+						Ω(fakeRunner).Should(HaveExecutedSerially(
+							hookCommand(containerPath, "mkdir -p "+rootfsPath+"/dst/path-rw"),
+							hookCommand(containerPath, "mount -n --bind "+rootfsPath+"/src/path-rw "+rootfsPath+"/dst/path-rw"),
+						))
+					})
+				})
+
+				Context("through a symlink loop", func() {
+					BeforeEach(func() {
+						err := os.Symlink("loop", path.Join(rootfsPath, "loop"))
+						Ω(err).ShouldNot(HaveOccurred())
+					})
+
+					It("returns a TooManySymlinksError", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							BindMounts: []api.BindMount{
+								{
+									SrcPath: sourcesPath + "/src/path-rw",
+									DstPath: "/loop/dst",
+								},
+							},
+						}, nil)
+						Ω(err).Should(Equal(container_pool.TooManySymlinksError{Path: "/loop/dst"}))
+					})
+				})
+			})
+
+			for _, origin := range []api.BindMountOrigin{api.BindMountOriginHost, api.BindMountOriginContainer} {
+				origin := origin
+
+				Context(fmt.Sprintf("when the source does not exist (origin %d)", origin), func() {
+					var err error
+
+					BeforeEach(func() {
+						_, err = pool.Create(api.ContainerSpec{
+							BindMounts: []api.BindMount{
+								{
+									SrcPath: "/does/not/exist",
+									DstPath: "/dst/path",
+									Origin:  origin,
+								},
+							},
+						}, nil)
+					})
+
+					It("returns a BindMountSourceNotFoundError", func() {
+						Ω(err).Should(Equal(container_pool.BindMountSourceNotFoundError{SrcPath: "/does/not/exist"}))
+					})
+
+					itReleasesTheUserID()
+					itReleasesTheIPBlock()
+					itCleansUpTheRootfs()
+					itDeletesTheContainerDirectory()
+				})
+			}
+
+			Context("when appending to hook-child-before-pivot.sh fails", func() {
+				var err error
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+						Path: "bash",
+					}, func(*exec.Cmd) error {
+						return disaster
+					})
+
+					_, err = pool.Create(api.ContainerSpec{
+						BindMounts: []api.BindMount{
+							{
+								SrcPath: sourcesPath + "/src/path-ro",
+								DstPath: "/dst/path-ro",
+								Mode:    api.BindMountModeRO,
+							},
+						},
+					}, nil)
+				})
+
+				It("returns the error", func() {
+					Ω(err).Should(Equal(disaster))
+				})
+
+				itReleasesTheUserID()
+				itReleasesTheIPBlock()
+				itCleansUpTheRootfs()
+				itDeletesTheContainerDirectory()
+			})
+		})
+
+		Context("when acquiring a UID fails", func() {
+			nastyError := errors.New("oh no!")
+
+			JustBeforeEach(func() {
+				fakeUIDPool.AcquireError = nastyError
+			})
+
+			It("returns the error", func() {
+				_, err := pool.Create(api.ContainerSpec{}, nil)
+				Ω(err).Should(Equal(nastyError))
+			})
+		})
+
+		Context("when acquiring a network fails", func() {
+			nastyError := errors.New("oh no!")
+
+			JustBeforeEach(func() {
+				fakeNetworkPool.AcquireError = nastyError
+			})
+
+			It("returns the error and releases the uid", func() {
+				_, err := pool.Create(api.ContainerSpec{}, nil)
+				Ω(err).Should(Equal(nastyError))
+
+				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+			})
+		})
+
+		Context("when executing create.sh fails", func() {
+			nastyError := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/create.sh",
+					}, func(cmd *exec.Cmd) error {
+						return nastyError
+					},
+				)
+
+				pool.Create(api.ContainerSpec{}, nil)
+			})
+
+			It("returns a retryable error and releases the uid and network", func() {
+				_, err := pool.Create(api.ContainerSpec{}, nil)
+				Ω(err).Should(Equal(container_pool.SetupFailedError{Err: nastyError}))
+
+				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+				Ω(fakeNetworkPool.Released).Should(ContainElement("1.2.0.0/30"))
+			})
+
+			itReleasesTheUserID()
+			itReleasesTheIPBlock()
+			itDeletesTheContainerDirectory()
+			itCleansUpTheRootfs()
+
+			Context("with a rootfs from a provider other than the default", func() {
+				BeforeEach(func() {
+					fakeRootFSProvider.ProvideRootFSReturns("/provided/rootfs/path", nil, nil)
+
+					pool.Create(api.ContainerSpec{RootFSPath: "fake:///path/to/custom-rootfs"}, nil)
+				})
+
+				It("cleans up the rootfs with that provider", func() {
+					Ω(fakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(1))
+					_, providedID, _ := fakeRootFSProvider.ProvideRootFSArgsForCall(0)
+					_, cleanedUpID := fakeRootFSProvider.CleanupRootFSArgsForCall(0)
+					Ω(cleanedUpID).Should(Equal(providedID))
+				})
+
+				It("runs destroy.sh", func() {
+					lastCommand := fakeRunner.ExecutedCommands()[len(fakeRunner.ExecutedCommands())-1]
+					Ω(lastCommand.Path).Should(Equal("/root/path/destroy.sh"))
+				})
+			})
+		})
+
+		Context("when the create is cancelled while providing the rootfs", func() {
+			var err error
+
+			BeforeEach(func() {
+				cancelled := make(chan struct{})
+
+				defaultFakeRootFSProvider.ProvideRootFSStub = func(lager.Logger, string, *url.URL) (string, []string, error) {
+					close(cancelled)
+					return "/provided/rootfs/path", nil, nil
+				}
+
+				_, err = pool.Create(api.ContainerSpec{Handle: "some-handle"}, cancelled)
+			})
+
+			It("returns an error without creating the container", func() {
+				Ω(err).Should(Equal(linux_backend.OperationCancelledError{Kind: "create", Handle: "some-handle"}))
+
+				for _, cmd := range fakeRunner.ExecutedCommands() {
+					Ω(cmd.Path).ShouldNot(Equal("/root/path/create.sh"))
+				}
+			})
+
+			itReleasesTheUserID()
+			itReleasesTheIPBlock()
+			itCleansUpTheRootfs()
+		})
+
+		Context("when saving the rootfs provider fails", func() {
+			var err error
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/create.sh",
+					}, func(cmd *exec.Cmd) error {
+						containerPath := cmd.Args[1]
+						rootfsProviderPath := filepath.Join(containerPath, "rootfs-provider")
+
+						// creating a directory with this name will cause the write to the
+						// file to fail.
+						err := os.MkdirAll(rootfsProviderPath, 0755)
+						Ω(err).ShouldNot(HaveOccurred())
+
+						return nil
+					},
+				)
+
+				_, err = pool.Create(api.ContainerSpec{}, nil)
+			})
+
+			It("returns an error", func() {
+				Ω(err).Should(HaveOccurred())
+			})
 
 			itReleasesTheUserID()
 			itReleasesTheIPBlock()
 			itCleansUpTheRootfs()
 			itDeletesTheContainerDirectory()
 		})
-	})
+	})
+
+	Describe("reserving", func() {
+		var reservedNetwork *network.Network
+
+		BeforeEach(func() {
+			_, ipNet, err := net.ParseCIDR("10.244.0.4/30")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			reservedNetwork = network.New(ipNet)
+
+			err = pool.Reserve("some-handle", linux_backend.ResourcesSnapshot{
+				UID:     10042,
+				Network: reservedNetwork,
+				Ports:   []uint32{61001, 61002},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("takes the resources out of the pools", func() {
+			Ω(fakeUIDPool.Removed).Should(Equal([]uint32{10042}))
+			Ω(fakeNetworkPool.Removed).Should(Equal([]string{"10.244.0.4/30"}))
+			Ω(fakePortPool.Removed).Should(Equal([]uint32{61001, 61002}))
+		})
+
+		It("gives them to the container created with the handle", func() {
+			container, err := pool.Create(api.ContainerSpec{Handle: "some-handle"}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			resources := container.(*linux_backend.LinuxContainer).Resources()
+			Ω(resources.UID).Should(Equal(uint32(10042)))
+			Ω(resources.Network).Should(Equal(reservedNetwork))
+			Ω(resources.Ports).Should(Equal([]uint32{61001, 61002}))
+
+			Ω(fakeUIDPool.Acquired).Should(BeEmpty())
+			Ω(fakeNetworkPool.Acquired).Should(BeEmpty())
+		})
+
+		It("gives them to only one container", func() {
+			_, err := pool.Create(api.ContainerSpec{Handle: "some-handle"}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(pool.Unreserve("some-handle")).Should(BeFalse())
+		})
+
+		It("leaves containers created with other handles to acquire their own", func() {
+			container, err := pool.Create(api.ContainerSpec{Handle: "some-other-handle"}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(container.(*linux_backend.LinuxContainer).Resources().UID).ShouldNot(Equal(uint32(10042)))
+		})
+
+		It("fails if the handle already has a reservation", func() {
+			err := pool.Reserve("some-handle", linux_backend.ResourcesSnapshot{
+				UID:     10043,
+				Network: reservedNetwork,
+			})
+			Ω(err).Should(Equal(container_pool.HandleReservedError{Handle: "some-handle"}))
+		})
+
+		Describe("unreserving", func() {
+			It("returns the resources to the pools", func() {
+				Ω(pool.Unreserve("some-handle")).Should(BeTrue())
+
+				Ω(fakeUIDPool.Released).Should(Equal([]uint32{10042}))
+				Ω(fakeNetworkPool.Released).Should(Equal([]string{"10.244.0.4/30"}))
+				Ω(fakePortPool.Released).Should(Equal([]uint32{61001, 61002}))
+			})
+
+			It("returns false if nothing is reserved for the handle", func() {
+				Ω(pool.Unreserve("bogus-handle")).Should(BeFalse())
+			})
+		})
+
+		Context("when a resource is taken", func() {
+			It("reserves none of them", func() {
+				fakePortPool.RemoveError = errors.New("taken")
+
+				err := pool.Reserve("some-other-handle", linux_backend.ResourcesSnapshot{
+					UID:     10043,
+					Network: reservedNetwork,
+					Ports:   []uint32{61003},
+				})
+				Ω(err).Should(MatchError("taken"))
+
+				Ω(fakeUIDPool.Released).Should(Equal([]uint32{10043}))
+				Ω(fakeNetworkPool.Released).Should(Equal([]string{"10.244.0.4/30"}))
+				Ω(pool.Unreserve("some-other-handle")).Should(BeFalse())
+			})
+		})
+	})
+
+	Describe("restoring", func() {
+		var snapshot io.Reader
+
+		var restoredNetwork *network.Network
+
+		BeforeEach(func() {
+			buf := new(bytes.Buffer)
+
+			snapshot = buf
+
+			_, ipNet, err := net.ParseCIDR("10.244.0.0/30")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			restoredNetwork = network.New(ipNet)
+
+			err = json.NewEncoder(buf).Encode(
+				linux_backend.ContainerSnapshot{
+					ID:     "some-restored-id",
+					Handle: "some-restored-handle",
+
+					GraceTime: 1 * time.Second,
+
+					State: "some-restored-state",
+					Events: []string{
+						"some-restored-event",
+						"some-other-restored-event",
+					},
+
+					Resources: linux_backend.ResourcesSnapshot{
+						UID:     10000,
+						Network: restoredNetwork,
+						Ports:   []uint32{61001, 61002, 61003},
+					},
+
+					Properties: map[string]string{
+						"foo": "bar",
+					},
+				},
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("constructs a container from the snapshot", func() {
+			container, err := pool.Restore(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(container.ID()).Should(Equal("some-restored-id"))
+			Ω(container.Handle()).Should(Equal("some-restored-handle"))
+			Ω(container.GraceTime()).Should(Equal(1 * time.Second))
+			Ω(container.Properties()).Should(Equal(api.Properties(map[string]string{
+				"foo": "bar",
+			})))
+
+			linuxContainer := container.(*linux_backend.LinuxContainer)
+
+			Ω(linuxContainer.State()).Should(Equal(linux_backend.State("some-restored-state")))
+			Ω(linuxContainer.Events()).Should(Equal([]string{
+				"some-restored-event",
+				"some-other-restored-event",
+			}))
+
+			// the properties give the default capabilities
+			Ω(linuxContainer.Security().Privileged).Should(BeFalse())
+			Ω(linuxContainer.Security().DroppedCapabilities).Should(ContainElement("CAP_SYS_ADMIN"))
+		})
+
+		It("removes its UID from the pool", func() {
+			_, err := pool.Restore(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeUIDPool.Removed).Should(ContainElement(uint32(10000)))
+		})
+
+		It("removes its network from the pool", func() {
+			_, err := pool.Restore(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeNetworkPool.Removed).Should(ContainElement(restoredNetwork.String()))
+		})
+
+		It("removes its ports from the pool", func() {
+			_, err := pool.Restore(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakePortPool.Removed).Should(ContainElement(uint32(61001)))
+			Ω(fakePortPool.Removed).Should(ContainElement(uint32(61002)))
+			Ω(fakePortPool.Removed).Should(ContainElement(uint32(61003)))
+		})
+
+		Context("when decoding the snapshot fails", func() {
+			BeforeEach(func() {
+				snapshot = new(bytes.Buffer)
+			})
+
+			It("fails", func() {
+				_, err := pool.Restore(snapshot)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+
+		Context("when removing the UID from the pool fails", func() {
+			disaster := errors.New("oh no!")
+
+			JustBeforeEach(func() {
+				fakeUIDPool.RemoveError = disaster
+			})
+
+			It("returns the error", func() {
+				_, err := pool.Restore(snapshot)
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
+		Context("when removing the network from the pool fails", func() {
+			disaster := errors.New("oh no!")
+
+			JustBeforeEach(func() {
+				fakeNetworkPool.RemoveError = disaster
+			})
+
+			It("returns the error and releases the uid", func() {
+				_, err := pool.Restore(snapshot)
+				Ω(err).Should(Equal(disaster))
+
+				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+			})
+		})
+
+		Context("when removing a port from the pool fails", func() {
+			disaster := errors.New("oh no!")
+
+			JustBeforeEach(func() {
+				fakePortPool.RemoveError = disaster
+			})
+
+			It("returns the error and releases the uid, network, and all ports", func() {
+				_, err := pool.Restore(snapshot)
+				Ω(err).Should(Equal(disaster))
+
+				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+				Ω(fakeNetworkPool.Released).Should(ContainElement(restoredNetwork.String()))
+				Ω(fakePortPool.Released).Should(ContainElement(uint32(61001)))
+				Ω(fakePortPool.Released).Should(ContainElement(uint32(61002)))
+				Ω(fakePortPool.Released).Should(ContainElement(uint32(61003)))
+			})
+		})
+
+		Context("when restoring the container fails", func() {
+			disaster := errors.New("oh no!")
+
+			JustBeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: path.Join(depotPath, "some-restored-id", "net.sh"),
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error and releases the uid, network, and all ports", func() {
+				_, err := pool.Restore(snapshot)
+				Ω(err).Should(Equal(disaster))
+
+				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+				Ω(fakeNetworkPool.Released).Should(ContainElement(restoredNetwork.String()))
+				Ω(fakePortPool.Released).Should(ContainElement(uint32(61001)))
+				Ω(fakePortPool.Released).Should(ContainElement(uint32(61002)))
+				Ω(fakePortPool.Released).Should(ContainElement(uint32(61003)))
+			})
+		})
+	})
+
+	Describe("pruning", func() {
+		Context("when containers are found in the depot", func() {
+			BeforeEach(func() {
+				err := os.MkdirAll(path.Join(depotPath, "container-1"), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = os.MkdirAll(path.Join(depotPath, "container-2"), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = os.MkdirAll(path.Join(depotPath, "container-3"), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = os.MkdirAll(path.Join(depotPath, "tmp"), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(depotPath, "container-1", "rootfs-provider"), []byte("fake"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(depotPath, "container-2", "rootfs-provider"), []byte("fake"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(depotPath, "container-3", "rootfs-provider"), []byte(""), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("destroys each container", func() {
+				err := pool.Prune(map[string]bool{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/destroy.sh",
+						Args: []string{path.Join(depotPath, "container-1")},
+					},
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/destroy.sh",
+						Args: []string{path.Join(depotPath, "container-2")},
+					},
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/destroy.sh",
+						Args: []string{path.Join(depotPath, "container-3")},
+					},
+				))
+
+			})
+
+			Context("after destroying it", func() {
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: "/root/path/destroy.sh",
+						}, func(cmd *exec.Cmd) error {
+							return os.RemoveAll(cmd.Args[0])
+						},
+					)
+				})
+
+				It("cleans up each container's rootfs after destroying it", func() {
+					err := pool.Prune(map[string]bool{})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(2))
+					_, id1 := fakeRootFSProvider.CleanupRootFSArgsForCall(0)
+					_, id2 := fakeRootFSProvider.CleanupRootFSArgsForCall(1)
+					Ω(id1).Should(Equal("container-1"))
+					Ω(id2).Should(Equal("container-2"))
+
+					Ω(defaultFakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(1))
+					_, id3 := defaultFakeRootFSProvider.CleanupRootFSArgsForCall(0)
+					Ω(id3).Should(Equal("container-3"))
+				})
+			})
+
+			Context("when a container does not declare a rootfs provider", func() {
+				BeforeEach(func() {
+					err := os.Remove(path.Join(depotPath, "container-2", "rootfs-provider"))
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("cleans it up using the default provider", func() {
+					err := pool.Prune(map[string]bool{})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(defaultFakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(2))
+					_, id1 := defaultFakeRootFSProvider.CleanupRootFSArgsForCall(0)
+					_, id2 := defaultFakeRootFSProvider.CleanupRootFSArgsForCall(1)
+					Ω(id1).Should(Equal("container-2"))
+					Ω(id2).Should(Equal("container-3"))
+				})
+
+				Context("when a container exists with an unknown rootfs provider", func() {
+					BeforeEach(func() {
+						err := ioutil.WriteFile(path.Join(depotPath, "container-2", "rootfs-provider"), []byte("unknown"), 0644)
+						Ω(err).ShouldNot(HaveOccurred())
+					})
+
+					It("returns ErrUnknownRootFSProvider", func() {
+						err := pool.Prune(map[string]bool{})
+						Ω(err).Should(Equal(container_pool.ErrUnknownRootFSProvider))
+					})
+				})
+			})
+
+			Context("when cleaning up the rootfs fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeRootFSProvider.CleanupRootFSReturns(disaster)
+				})
+
+				It("returns the error", func() {
+					err := pool.Prune(map[string]bool{})
+					Ω(err).Should(Equal(disaster))
+				})
+			})
+
+			Context("when a container to exclude is specified", func() {
+				It("is not destroyed", func() {
+					err := pool.Prune(map[string]bool{"container-2": true})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: "/root/path/destroy.sh",
+							Args: []string{path.Join(depotPath, "container-2")},
+						},
+					))
+
+				})
+
+				It("is not cleaned up", func() {
+					err := pool.Prune(map[string]bool{"container-2": true})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(1))
+					_, prunedId := fakeRootFSProvider.CleanupRootFSArgsForCall(0)
+					Ω(prunedId).ShouldNot(Equal("container-2"))
+				})
+			})
+
+			Context("when executing destroy.sh fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: "/root/path/destroy.sh",
+						}, func(cmd *exec.Cmd) error {
+							return disaster
+						},
+					)
+				})
+
+				It("returns the error", func() {
+					err := pool.Prune(map[string]bool{})
+					Ω(err).Should(Equal(disaster))
+				})
+
+				It("does not clean up the container's rootfs", func() {
+					err := pool.Prune(map[string]bool{})
+					Ω(err).Should(HaveOccurred())
+
+					Ω(fakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(0))
+				})
+			})
+		})
+	})
+
+	Describe("destroying", func() {
+		var createdContainer *linux_backend.LinuxContainer
+
+		BeforeEach(func() {
+			container, err := pool.Create(api.ContainerSpec{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			createdContainer = container.(*linux_backend.LinuxContainer)
+
+			createdContainer.Resources().AddPort(123)
+			createdContainer.Resources().AddPort(456)
+		})
+
+		It("executes destroy.sh with the correct args and environment", func() {
+			err := pool.Destroy(createdContainer)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/root/path/destroy.sh",
+					Args: []string{path.Join(depotPath, createdContainer.ID())},
+				},
+			))
+		})
 
-	Describe("restoring", func() {
-		var snapshot io.Reader
+		It("releases the container's ports, uid, and network", func() {
+			err := pool.Destroy(createdContainer)
+			Ω(err).ShouldNot(HaveOccurred())
 
-		var restoredNetwork *network.Network
+			Ω(fakePortPool.Released).Should(ContainElement(uint32(123)))
+			Ω(fakePortPool.Released).Should(ContainElement(uint32(456)))
 
-		BeforeEach(func() {
-			buf := new(bytes.Buffer)
+			Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
 
-			snapshot = buf
+			Ω(fakeNetworkPool.Released).Should(ContainElement("1.2.0.0/30"))
+		})
 
-			_, ipNet, err := net.ParseCIDR("10.244.0.0/30")
+		It("returns the host ports of the container's port mappings to the pool", func() {
+			hostPort, _, err := createdContainer.NetIn(0, 8080)
 			Ω(err).ShouldNot(HaveOccurred())
 
-			restoredNetwork = network.New(ipNet)
-
-			err = json.NewEncoder(buf).Encode(
-				linux_backend.ContainerSnapshot{
-					ID:     "some-restored-id",
-					Handle: "some-restored-handle",
+			err = pool.Destroy(createdContainer)
+			Ω(err).ShouldNot(HaveOccurred())
 
-					GraceTime: 1 * time.Second,
+			Ω(fakePortPool.Released).Should(ContainElement(hostPort))
 
-					State: "some-restored-state",
-					Events: []string{
-						"some-restored-event",
-						"some-other-restored-event",
-					},
+			// net.sh teardown removes the container's NAT chain, and with it
+			// the mappings' rules
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: path.Join(depotPath, createdContainer.ID(), "net.sh"),
+					Args: []string{"in"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "/root/path/destroy.sh",
+				},
+			))
+		})
 
-					Resources: linux_backend.ResourcesSnapshot{
-						UID:     10000,
-						Network: restoredNetwork,
-						Ports:   []uint32{61001, 61002, 61003},
+		Context("when the running container has a pre-stop command", func() {
+			BeforeEach(func() {
+				container, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.PreStopProperty: "flush-things",
 					},
+				}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
 
-					Properties: map[string]string{
-						"foo": "bar",
-					},
-				},
-			)
-			Ω(err).ShouldNot(HaveOccurred())
-		})
+				createdContainer = container.(*linux_backend.LinuxContainer)
 
-		It("constructs a container from the snapshot", func() {
-			container, err := pool.Restore(snapshot)
-			Ω(err).ShouldNot(HaveOccurred())
+				err = createdContainer.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+			})
 
-			Ω(container.ID()).Should(Equal("some-restored-id"))
-			Ω(container.Handle()).Should(Equal("some-restored-handle"))
-			Ω(container.GraceTime()).Should(Equal(1 * time.Second))
-			Ω(container.Properties()).Should(Equal(api.Properties(map[string]string{
-				"foo": "bar",
-			})))
+			It("runs it before executing destroy.sh", func() {
+				wshPath := path.Join(depotPath, createdContainer.ID(), "bin", "wsh")
 
-			linuxContainer := container.(*linux_backend.LinuxContainer)
+				var ran []string
 
-			Ω(linuxContainer.State()).Should(Equal(linux_backend.State("some-restored-state")))
-			Ω(linuxContainer.Events()).Should(Equal([]string{
-				"some-restored-event",
-				"some-other-restored-event",
-			}))
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: wshPath,
+				}, func(*exec.Cmd) error {
+					ran = append(ran, "pre-stop")
+					return nil
+				})
 
-		})
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: "/root/path/destroy.sh",
+				}, func(*exec.Cmd) error {
+					ran = append(ran, "destroy.sh")
+					return nil
+				})
 
-		It("removes its UID from the pool", func() {
-			_, err := pool.Restore(snapshot)
-			Ω(err).ShouldNot(HaveOccurred())
+				err := pool.Destroy(createdContainer)
+				Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(fakeUIDPool.Removed).Should(ContainElement(uint32(10000)))
+				Ω(ran).Should(Equal([]string{"pre-stop", "destroy.sh"}))
+				Ω(createdContainer.PreStopResult()).Should(Equal(linux_backend.PreStopSucceeded))
+			})
 		})
 
-		It("removes its network from the pool", func() {
-			_, err := pool.Restore(snapshot)
-			Ω(err).ShouldNot(HaveOccurred())
+		Context("when the container has a net.sh", func() {
+			var netSh string
 
-			Ω(fakeNetworkPool.Removed).Should(ContainElement(restoredNetwork.String()))
-		})
+			BeforeEach(func() {
+				err := os.MkdirAll(path.Join(depotPath, createdContainer.ID()), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
 
-		It("removes its ports from the pool", func() {
-			_, err := pool.Restore(snapshot)
-			Ω(err).ShouldNot(HaveOccurred())
+				netSh = path.Join(depotPath, createdContainer.ID(), "net.sh")
 
-			Ω(fakePortPool.Removed).Should(ContainElement(uint32(61001)))
-			Ω(fakePortPool.Removed).Should(ContainElement(uint32(61002)))
-			Ω(fakePortPool.Removed).Should(ContainElement(uint32(61003)))
-		})
+				err = ioutil.WriteFile(netSh, []byte{}, 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
 
-		Context("when decoding the snapshot fails", func() {
-			BeforeEach(func() {
-				snapshot = new(bytes.Buffer)
+			It("tears down the container's iptables rules before executing destroy.sh", func() {
+				err := pool.Destroy(createdContainer)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: netSh,
+						Args: []string{"teardown"},
+					},
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/destroy.sh",
+					},
+				))
 			})
 
-			It("fails", func() {
-				_, err := pool.Restore(snapshot)
-				Ω(err).Should(HaveOccurred())
+			Context("when tearing down the rules fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: netSh,
+							Args: []string{"teardown"},
+						},
+						func(*exec.Cmd) error {
+							return disaster
+						},
+					)
+				})
+
+				It("returns the error without executing destroy.sh", func() {
+					err := pool.Destroy(createdContainer)
+					Ω(err).Should(Equal(disaster))
+
+					Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: "/root/path/destroy.sh",
+						},
+					))
+				})
 			})
 		})
 
-		Context("when removing the UID from the pool fails", func() {
-			disaster := errors.New("oh no!")
+		Context("when the container has a rootfs provider defined", func() {
+			BeforeEach(func() {
+				err := os.MkdirAll(path.Join(depotPath, createdContainer.ID()), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
 
-			JustBeforeEach(func() {
-				fakeUIDPool.RemoveError = disaster
+				err = ioutil.WriteFile(path.Join(depotPath, createdContainer.ID(), "rootfs-provider"), []byte("fake"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
 			})
 
-			It("returns the error", func() {
-				_, err := pool.Restore(snapshot)
-				Ω(err).Should(Equal(disaster))
+			It("cleans up the container's rootfs", func() {
+				err := pool.Destroy(createdContainer)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(1))
+				_, id := fakeRootFSProvider.CleanupRootFSArgsForCall(0)
+				Ω(id).Should(Equal(createdContainer.ID()))
 			})
-		})
 
-		Context("when removing the network from the pool fails", func() {
-			disaster := errors.New("oh no!")
+			Context("when cleaning up the container's rootfs fails", func() {
+				disaster := errors.New("oh no!")
 
-			JustBeforeEach(func() {
-				fakeNetworkPool.RemoveError = disaster
-			})
+				BeforeEach(func() {
+					fakeRootFSProvider.CleanupRootFSReturns(disaster)
+				})
 
-			It("returns the error and releases the uid", func() {
-				_, err := pool.Restore(snapshot)
-				Ω(err).Should(Equal(disaster))
+				It("returns the error", func() {
+					err := pool.Destroy(createdContainer)
+					Ω(err).Should(Equal(disaster))
+				})
 
-				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+				It("does not release the container's ports, uid, and network", func() {
+					pool.Destroy(createdContainer)
+
+					Ω(fakePortPool.Released).ShouldNot(ContainElement(uint32(123)))
+					Ω(fakePortPool.Released).ShouldNot(ContainElement(uint32(456)))
+					Ω(fakeUIDPool.Released).ShouldNot(ContainElement(uint32(10000)))
+					Ω(fakeNetworkPool.Released).ShouldNot(ContainElement("1.2.0.0/30"))
+				})
 			})
 		})
 
-		Context("when removing a port from the pool fails", func() {
+		Context("when destroy.sh fails", func() {
 			disaster := errors.New("oh no!")
 
-			JustBeforeEach(func() {
-				fakePortPool.RemoveError = disaster
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/destroy.sh",
+						Args: []string{path.Join(depotPath, createdContainer.ID())},
+					},
+					func(*exec.Cmd) error {
+						return disaster
+					},
+				)
 			})
 
-			It("returns the error and releases the uid, network, and all ports", func() {
-				_, err := pool.Restore(snapshot)
+			It("returns the error", func() {
+				err := pool.Destroy(createdContainer)
 				Ω(err).Should(Equal(disaster))
+			})
 
-				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
-				Ω(fakeNetworkPool.Released).Should(ContainElement(restoredNetwork.String()))
-				Ω(fakePortPool.Released).Should(ContainElement(uint32(61001)))
-				Ω(fakePortPool.Released).Should(ContainElement(uint32(61002)))
-				Ω(fakePortPool.Released).Should(ContainElement(uint32(61003)))
+			It("does not clean up the container's rootfs", func() {
+				err := pool.Destroy(createdContainer)
+				Ω(err).Should(HaveOccurred())
+
+				Ω(fakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(0))
 			})
-		})
-	})
 
-	Describe("pruning", func() {
-		Context("when containers are found in the depot", func() {
-			BeforeEach(func() {
-				err := os.MkdirAll(path.Join(depotPath, "container-1"), 0755)
-				Ω(err).ShouldNot(HaveOccurred())
+			It("does not release the container's resources", func() {
+				err := pool.Destroy(createdContainer)
+				Ω(err).Should(HaveOccurred())
 
-				err = os.MkdirAll(path.Join(depotPath, "container-2"), 0755)
-				Ω(err).ShouldNot(HaveOccurred())
+				Ω(fakePortPool.Released).Should(BeEmpty())
+				Ω(fakePortPool.Released).Should(BeEmpty())
 
-				err = os.MkdirAll(path.Join(depotPath, "container-3"), 0755)
-				Ω(err).ShouldNot(HaveOccurred())
+				Ω(fakeUIDPool.Released).Should(BeEmpty())
 
-				err = os.MkdirAll(path.Join(depotPath, "tmp"), 0755)
-				Ω(err).ShouldNot(HaveOccurred())
+				Ω(fakeNetworkPool.Released).Should(BeEmpty())
+			})
+		})
+	})
 
-				err = ioutil.WriteFile(path.Join(depotPath, "container-1", "rootfs-provider"), []byte("fake"), 0644)
-				Ω(err).ShouldNot(HaveOccurred())
+	Describe("hooks", func() {
+		BeforeEach(func() {
+			pool = container_pool.New(
+				logger,
+				"/root/path",
+				depotPath,
+				sysconfig.NewConfig("0"),
+				map[string]rootfs_provider.RootFSProvider{
+					"": defaultFakeRootFSProvider,
+				},
+				fakeUIDPool,
+				fakeNetworkPool,
+				fakePortPool,
+				allocation_journal.Disabled{},
+				nil,
+				nil,
+				nil,
+				nil,
+				fakeRunner,
+				fake_resolver.New(),
+				fakeQuotaManager,
+				process_tracker.OutputLimit{},
+				container_pool.Hooks{
+					PreCreate:   "/hooks/pre-create",
+					PostCreate:  "/hooks/post-create",
+					PreDestroy:  "/hooks/pre-destroy",
+					PostDestroy: "/hooks/post-destroy",
+				},
+			)
+		})
 
-				err = ioutil.WriteFile(path.Join(depotPath, "container-2", "rootfs-provider"), []byte("fake"), 0644)
-				Ω(err).ShouldNot(HaveOccurred())
+		hookFails := func(hook string) {
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: hook,
+				}, func(*exec.Cmd) error {
+					return errors.New("oh no!")
+				},
+			)
+		}
 
-				err = ioutil.WriteFile(path.Join(depotPath, "container-3", "rootfs-provider"), []byte(""), 0644)
+		Describe("creating", func() {
+			It("runs the pre-create hook before create.sh", func() {
+				container, err := pool.Create(api.ContainerSpec{Handle: "some-handle"}, nil)
 				Ω(err).ShouldNot(HaveOccurred())
-			})
 
-			It("destroys each container", func() {
-				err := pool.Prune(map[string]bool{})
-				Ω(err).ShouldNot(HaveOccurred())
+				containerPath := path.Join(depotPath, container.ID())
 
-				Ω(fakeRunner).Should(HaveExecutedSerially(
-					fake_command_runner.CommandSpec{
-						Path: "/root/path/destroy.sh",
-						Args: []string{path.Join(depotPath, "container-1")},
-					},
+				Ω(fakeRunner).Should(HaveExecutedSerially(
 					fake_command_runner.CommandSpec{
-						Path: "/root/path/destroy.sh",
-						Args: []string{path.Join(depotPath, "container-2")},
+						Path: "/hooks/pre-create",
+						Args: []string{"some-handle", "1.2.0.2", containerPath},
 					},
 					fake_command_runner.CommandSpec{
-						Path: "/root/path/destroy.sh",
-						Args: []string{path.Join(depotPath, "container-3")},
+						Path: "/root/path/create.sh",
 					},
 				))
+			})
+
+			It("leaves the post-create hook until the container has been started", func() {
+				container, err := pool.Create(api.ContainerSpec{Handle: "some-handle"}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				postCreate := fake_command_runner.CommandSpec{
+					Path: "/hooks/post-create",
+					Args: []string{"some-handle", "1.2.0.2", path.Join(depotPath, container.ID())},
+				}
+
+				Ω(fakeRunner).ShouldNot(HaveExecutedSerially(postCreate))
+
+				pool.Started(container)
 
+				Ω(fakeRunner).Should(HaveExecutedSerially(postCreate))
 			})
 
-			Context("after destroying it", func() {
+			Context("when the pre-create hook fails", func() {
 				BeforeEach(func() {
-					fakeRunner.WhenRunning(
+					hookFails("/hooks/pre-create")
+				})
+
+				It("returns an error and does not create the container", func() {
+					_, err := pool.Create(api.ContainerSpec{}, nil)
+					Ω(err).Should(BeAssignableToTypeOf(container_pool.HookFailedError{}))
+
+					Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
 						fake_command_runner.CommandSpec{
-							Path: "/root/path/destroy.sh",
-						}, func(cmd *exec.Cmd) error {
-							return os.RemoveAll(cmd.Args[0])
+							Path: "/root/path/create.sh",
 						},
-					)
+					))
 				})
 
-				It("cleans up each container's rootfs after destroying it", func() {
-					err := pool.Prune(map[string]bool{})
-					Ω(err).ShouldNot(HaveOccurred())
+				It("releases the container's uid and network", func() {
+					pool.Create(api.ContainerSpec{}, nil)
 
-					Ω(fakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(2))
-					_, id1 := fakeRootFSProvider.CleanupRootFSArgsForCall(0)
-					_, id2 := fakeRootFSProvider.CleanupRootFSArgsForCall(1)
-					Ω(id1).Should(Equal("container-1"))
-					Ω(id2).Should(Equal("container-2"))
+					Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+					Ω(fakeNetworkPool.Released).Should(ContainElement("1.2.0.0/30"))
+				})
+
+				It("cleans up the rootfs provided meanwhile", func() {
+					pool.Create(api.ContainerSpec{}, nil)
 
+					Ω(defaultFakeRootFSProvider.ProvideRootFSCallCount()).Should(Equal(1))
 					Ω(defaultFakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(1))
-					_, id3 := defaultFakeRootFSProvider.CleanupRootFSArgsForCall(0)
-					Ω(id3).Should(Equal("container-3"))
-				})
-			})
 
-			Context("when a container does not declare a rootfs provider", func() {
-				BeforeEach(func() {
-					err := os.Remove(path.Join(depotPath, "container-2", "rootfs-provider"))
-					Ω(err).ShouldNot(HaveOccurred())
+					_, providedID, _ := defaultFakeRootFSProvider.ProvideRootFSArgsForCall(0)
+					_, cleanedUpID := defaultFakeRootFSProvider.CleanupRootFSArgsForCall(0)
+					Ω(cleanedUpID).Should(Equal(providedID))
 				})
+			})
 
-				It("cleans it up using the default provider", func() {
-					err := pool.Prune(map[string]bool{})
-					Ω(err).ShouldNot(HaveOccurred())
+			It("provides the rootfs while the pre-create hook runs", func() {
+				providing := make(chan struct{})
 
-					Ω(defaultFakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(2))
-					_, id1 := defaultFakeRootFSProvider.CleanupRootFSArgsForCall(0)
-					_, id2 := defaultFakeRootFSProvider.CleanupRootFSArgsForCall(1)
-					Ω(id1).Should(Equal("container-2"))
-					Ω(id2).Should(Equal("container-3"))
-				})
+				defaultFakeRootFSProvider.ProvideRootFSStub = func(lager.Logger, string, *url.URL) (string, []string, error) {
+					close(providing)
+					return "/provided/rootfs/path", nil, nil
+				}
 
-				Context("when a container exists with an unknown rootfs provider", func() {
-					BeforeEach(func() {
-						err := ioutil.WriteFile(path.Join(depotPath, "container-2", "rootfs-provider"), []byte("unknown"), 0644)
-						Ω(err).ShouldNot(HaveOccurred())
-					})
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/hooks/pre-create",
+					}, func(*exec.Cmd) error {
+						Eventually(providing).Should(BeClosed())
+						return nil
+					},
+				)
 
-					It("returns ErrUnknownRootFSProvider", func() {
-						err := pool.Prune(map[string]bool{})
-						Ω(err).Should(Equal(container_pool.ErrUnknownRootFSProvider))
-					})
-				})
+				_, err := pool.Create(api.ContainerSpec{}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
 			})
 
-			Context("when cleaning up the rootfs fails", func() {
-				disaster := errors.New("oh no!")
-
+			Context("when providing the rootfs fails", func() {
 				BeforeEach(func() {
-					fakeRootFSProvider.CleanupRootFSReturns(disaster)
-				})
-
-				It("returns the error", func() {
-					err := pool.Prune(map[string]bool{})
-					Ω(err).Should(Equal(disaster))
+					defaultFakeRootFSProvider.ProvideRootFSReturns("", nil, errors.New("oh no!"))
 				})
-			})
 
-			Context("when a container to exclude is specified", func() {
-				It("is not destroyed", func() {
-					err := pool.Prune(map[string]bool{"container-2": true})
-					Ω(err).ShouldNot(HaveOccurred())
+				It("returns the rootfs error, having still run the pre-create hook", func() {
+					_, err := pool.Create(api.ContainerSpec{}, nil)
+					Ω(err).Should(BeAssignableToTypeOf(container_pool.ProvideRootFSError{}))
 
-					Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+					Ω(fakeRunner).Should(HaveExecutedSerially(
 						fake_command_runner.CommandSpec{
-							Path: "/root/path/destroy.sh",
-							Args: []string{path.Join(depotPath, "container-2")},
+							Path: "/hooks/pre-create",
 						},
 					))
 
+					Ω(defaultFakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(0))
 				})
+			})
 
-				It("is not cleaned up", func() {
-					err := pool.Prune(map[string]bool{"container-2": true})
+			Context("when the post-create hook fails", func() {
+				BeforeEach(func() {
+					hookFails("/hooks/post-create")
+				})
+
+				It("only logs the failure", func() {
+					container, err := pool.Create(api.ContainerSpec{}, nil)
 					Ω(err).ShouldNot(HaveOccurred())
 
-					Ω(fakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(1))
-					_, prunedId := fakeRootFSProvider.CleanupRootFSArgsForCall(0)
-					Ω(prunedId).ShouldNot(Equal("container-2"))
+					pool.Started(container)
+
+					Ω(fakeUIDPool.Released).Should(BeEmpty())
+
+					messages := []string{}
+					for _, log := range logger.Logs() {
+						messages = append(messages, log.Message)
+					}
+
+					Ω(messages).Should(ContainElement("test.pool.started.post-create-hook-failed"))
 				})
 			})
+		})
 
-			Context("when executing destroy.sh fails", func() {
-				disaster := errors.New("oh no!")
+		Describe("destroying", func() {
+			var container linux_backend.Container
+
+			BeforeEach(func() {
+				var err error
+
+				container, err = pool.Create(api.ContainerSpec{Handle: "some-handle"}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("runs the pre-destroy hook before destroy.sh, and the post-destroy hook after", func() {
+				err := pool.Destroy(container)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				containerPath := path.Join(depotPath, container.ID())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/hooks/pre-destroy",
+						Args: []string{"some-handle", "1.2.0.2", containerPath},
+					},
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/destroy.sh",
+					},
+					fake_command_runner.CommandSpec{
+						Path: "/hooks/post-destroy",
+						Args: []string{"some-handle", "1.2.0.2", containerPath},
+					},
+				))
+			})
 
+			Context("when the pre-destroy hook fails", func() {
 				BeforeEach(func() {
-					fakeRunner.WhenRunning(
+					hookFails("/hooks/pre-destroy")
+				})
+
+				It("returns an error and does not destroy the container", func() {
+					err := pool.Destroy(container)
+					Ω(err).Should(BeAssignableToTypeOf(container_pool.HookFailedError{}))
+
+					Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
 						fake_command_runner.CommandSpec{
 							Path: "/root/path/destroy.sh",
-						}, func(cmd *exec.Cmd) error {
-							return disaster
 						},
-					)
+					))
+
+					Ω(fakeNetworkPool.Released).Should(BeEmpty())
 				})
+			})
 
-				It("returns the error", func() {
-					err := pool.Prune(map[string]bool{})
-					Ω(err).Should(Equal(disaster))
+			Context("when the post-destroy hook fails", func() {
+				BeforeEach(func() {
+					hookFails("/hooks/post-destroy")
 				})
 
-				It("does not clean up the container's rootfs", func() {
-					err := pool.Prune(map[string]bool{})
-					Ω(err).Should(HaveOccurred())
+				It("still destroys the container", func() {
+					err := pool.Destroy(container)
+					Ω(err).ShouldNot(HaveOccurred())
 
-					Ω(fakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(0))
+					Ω(fakeNetworkPool.Released).Should(ContainElement("1.2.0.0/30"))
 				})
 			})
 		})
 	})
 
-	Describe("destroying", func() {
-		var createdContainer *linux_backend.LinuxContainer
+	Describe("journaling allocations", func() {
+		var journalDir string
+		var journal *allocation_journal.FileJournal
 
 		BeforeEach(func() {
-			container, err := pool.Create(api.ContainerSpec{})
+			var err error
+
+			journalDir, err = ioutil.TempDir("", "journal")
 			Ω(err).ShouldNot(HaveOccurred())
 
-			createdContainer = container.(*linux_backend.LinuxContainer)
+			journal, err = allocation_journal.Open(path.Join(journalDir, "allocations.journal"))
+			Ω(err).ShouldNot(HaveOccurred())
 
-			createdContainer.Resources().AddPort(123)
-			createdContainer.Resources().AddPort(456)
+			pool = container_pool.New(
+				logger,
+				"/root/path",
+				depotPath,
+				sysconfig.NewConfig("0"),
+				map[string]rootfs_provider.RootFSProvider{
+					"": defaultFakeRootFSProvider,
+				},
+				fakeUIDPool,
+				fakeNetworkPool,
+				fakePortPool,
+				journal,
+				nil,
+				nil,
+				nil,
+				nil,
+				fakeRunner,
+				fake_resolver.New(),
+				fakeQuotaManager,
+				process_tracker.OutputLimit{},
+				container_pool.Hooks{},
+			)
 		})
 
-		It("executes destroy.sh with the correct args and environment", func() {
-			err := pool.Destroy(createdContainer)
+		AfterEach(func() {
+			os.RemoveAll(journalDir)
+		})
+
+		It("journals a created container's network", func() {
+			container, err := pool.Create(api.ContainerSpec{}, nil)
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(fakeRunner).Should(HaveExecutedSerially(
-				fake_command_runner.CommandSpec{
-					Path: "/root/path/destroy.sh",
-					Args: []string{path.Join(depotPath, createdContainer.ID())},
-				},
-			))
+			Ω(journal.Allocation(container.ID()).Network.String()).Should(Equal("1.2.0.0/30"))
 		})
 
-		It("releases the container's ports, uid, and network", func() {
-			err := pool.Destroy(createdContainer)
+		It("journals the ports a container acquires", func() {
+			container, err := pool.Create(api.ContainerSpec{}, nil)
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(fakePortPool.Released).Should(ContainElement(uint32(123)))
-			Ω(fakePortPool.Released).Should(ContainElement(uint32(456)))
-
-			Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+			hostPort, _, err := container.NetIn(0, 0)
+			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(fakeNetworkPool.Released).Should(ContainElement("1.2.0.0/30"))
+			Ω(journal.Allocation(container.ID()).Ports).Should(Equal([]uint32{hostPort}))
 		})
 
-		Context("when the container has a rootfs provider defined", func() {
-			BeforeEach(func() {
-				err := os.MkdirAll(path.Join(depotPath, createdContainer.ID()), 0755)
-				Ω(err).ShouldNot(HaveOccurred())
+		It("journals a destroyed container's resources as released", func() {
+			container, err := pool.Create(api.ContainerSpec{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
 
-				err = ioutil.WriteFile(path.Join(depotPath, createdContainer.ID(), "rootfs-provider"), []byte("fake"), 0644)
-				Ω(err).ShouldNot(HaveOccurred())
-			})
+			err = pool.Destroy(container)
+			Ω(err).ShouldNot(HaveOccurred())
 
-			It("cleans up the container's rootfs", func() {
-				err := pool.Destroy(createdContainer)
-				Ω(err).ShouldNot(HaveOccurred())
+			Ω(journal.Allocation(container.ID())).Should(Equal(allocation_journal.Allocation{}))
+		})
 
-				Ω(fakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(1))
-				_, id := fakeRootFSProvider.CleanupRootFSArgsForCall(0)
-				Ω(id).Should(Equal(createdContainer.ID()))
+		Context("when creating fails", func() {
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/create.sh",
+					}, func(*exec.Cmd) error {
+						return errors.New("oh no!")
+					},
+				)
 			})
 
-			Context("when cleaning up the container's rootfs fails", func() {
-				disaster := errors.New("oh no!")
-
-				BeforeEach(func() {
-					fakeRootFSProvider.CleanupRootFSReturns(disaster)
-				})
-
-				It("returns the error", func() {
-					err := pool.Destroy(createdContainer)
-					Ω(err).Should(Equal(disaster))
-				})
-
-				It("does not release the container's ports, uid, and network", func() {
-					pool.Destroy(createdContainer)
+			It("journals its resources as released", func() {
+				_, err := pool.Create(api.ContainerSpec{}, nil)
+				Ω(err).Should(HaveOccurred())
 
-					Ω(fakePortPool.Released).ShouldNot(ContainElement(uint32(123)))
-					Ω(fakePortPool.Released).ShouldNot(ContainElement(uint32(456)))
-					Ω(fakeUIDPool.Released).ShouldNot(ContainElement(uint32(10000)))
-					Ω(fakeNetworkPool.Released).ShouldNot(ContainElement("1.2.0.0/30"))
-				})
+				contents, err := ioutil.ReadFile(path.Join(journalDir, "allocations.journal"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(contents)).Should(ContainSubstring(`"release":true`))
 			})
 		})
 
-		Context("when destroy.sh fails", func() {
-			disaster := errors.New("oh no!")
+		Describe("restoring", func() {
+			var snapshot *bytes.Buffer
 
 			BeforeEach(func() {
-				fakeRunner.WhenRunning(
-					fake_command_runner.CommandSpec{
-						Path: "/root/path/destroy.sh",
-						Args: []string{path.Join(depotPath, createdContainer.ID())},
-					},
-					func(*exec.Cmd) error {
-						return disaster
+				_, ipNet, err := net.ParseCIDR("10.244.0.0/30")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				snapshot = new(bytes.Buffer)
+
+				err = json.NewEncoder(snapshot).Encode(
+					linux_backend.ContainerSnapshot{
+						ID: "some-restored-id",
+
+						Resources: linux_backend.ResourcesSnapshot{
+							UID:     10000,
+							Network: network.New(ipNet),
+							Ports:   []uint32{61001},
+						},
 					},
 				)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = journal.AcquirePort("some-restored-id", 61002)
+				Ω(err).ShouldNot(HaveOccurred())
 			})
 
-			It("returns the error", func() {
-				err := pool.Destroy(createdContainer)
-				Ω(err).Should(Equal(disaster))
+			It("removes ports acquired since the snapshot from the pool", func() {
+				container, err := pool.Restore(snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakePortPool.Removed).Should(Equal([]uint32{61001, 61002}))
+
+				linuxContainer := container.(*linux_backend.LinuxContainer)
+				Ω(linuxContainer.Resources().Ports).Should(Equal([]uint32{61001, 61002}))
 			})
 
-			It("does not clean up the container's rootfs", func() {
-				err := pool.Destroy(createdContainer)
-				Ω(err).Should(HaveOccurred())
+			It("journals the snapshot's resources", func() {
+				_, err := pool.Restore(snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(fakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(0))
+				allocation := journal.Allocation("some-restored-id")
+				Ω(allocation.Network.String()).Should(Equal("10.244.0.0/30"))
+				Ω(allocation.Ports).Should(Equal([]uint32{61002, 61001}))
 			})
+		})
 
-			It("does not release the container's resources", func() {
-				err := pool.Destroy(createdContainer)
-				Ω(err).Should(HaveOccurred())
+		It("drops containers that are not kept when pruning", func() {
+			kept, err := pool.Create(api.ContainerSpec{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(fakePortPool.Released).Should(BeEmpty())
-				Ω(fakePortPool.Released).Should(BeEmpty())
+			gone, err := pool.Create(api.ContainerSpec{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(fakeUIDPool.Released).Should(BeEmpty())
+			err = pool.Prune(map[string]bool{kept.ID(): true})
+			Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(fakeNetworkPool.Released).Should(BeEmpty())
-			})
+			Ω(journal.Allocation(kept.ID()).Network).ShouldNot(BeNil())
+			Ω(journal.Allocation(gone.ID())).Should(Equal(allocation_journal.Allocation{}))
 		})
 	})
 })
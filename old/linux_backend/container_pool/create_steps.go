@@ -0,0 +1,50 @@
+package container_pool
+
+import "sync"
+
+// createStep is a part of creating a container that does not depend on the
+// others run alongside it. undo, if set, reverses it after it succeeded.
+type createStep struct {
+	run  func() error
+	undo func()
+}
+
+// runConcurrently runs every step at once and waits for all of them. If any
+// fail, the steps that succeeded are undone and the error of the first
+// failed step, in the order given, is returned.
+func runConcurrently(steps ...createStep) error {
+	errs := make([]error, len(steps))
+
+	wg := new(sync.WaitGroup)
+
+	for i, step := range steps {
+		wg.Add(1)
+
+		go func(i int, step createStep) {
+			defer wg.Done()
+			errs[i] = step.run()
+		}(i, step)
+	}
+
+	wg.Wait()
+
+	var firstErr error
+	for _, err := range errs {
+		if err != nil {
+			firstErr = err
+			break
+		}
+	}
+
+	if firstErr == nil {
+		return nil
+	}
+
+	for i, step := range steps {
+		if errs[i] == nil && step.undo != nil {
+			step.undo()
+		}
+	}
+
+	return firstErr
+}
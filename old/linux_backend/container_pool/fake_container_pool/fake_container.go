@@ -1,6 +1,7 @@
 package fake_container_pool
 
 import (
+	"encoding/json"
 	"io"
 	"sync"
 	"time"
@@ -22,6 +23,8 @@ type FakeContainer struct {
 	Started    bool
 
 	CleanedUp bool
+
+	Changed func()
 }
 
 func NewFakeContainer(spec api.ContainerSpec) *FakeContainer {
@@ -55,6 +58,10 @@ func (c *FakeContainer) Cleanup() {
 	c.CleanedUp = true
 }
 
+func (c *FakeContainer) OnChange(changed func()) {
+	c.Changed = changed
+}
+
 func (c *FakeContainer) GraceTime() time.Duration {
 	return c.Spec.GraceTime
 }
@@ -69,5 +76,5 @@ func (c *FakeContainer) Snapshot(snapshot io.Writer) error {
 
 	c.SavedSnapshots = append(c.SavedSnapshots, snapshot)
 
-	return nil
+	return json.NewEncoder(snapshot).Encode(c.Spec.Handle)
 }
@@ -1,10 +1,12 @@
 package fake_container_pool
 
 import (
-	"fmt"
+	"encoding/json"
 	"io"
+	"sync"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider"
 	"github.com/cloudfoundry-incubator/garden/api"
 	"github.com/nu7hatch/gouuid"
 )
@@ -24,9 +26,22 @@ type FakeContainerPool struct {
 
 	ContainerSetup func(*FakeContainer)
 
+	// called as each container is created, e.g. to block it until it is
+	// cancelled
+	CreateHook func(spec api.ContainerSpec, cancelled <-chan struct{})
+
+	// called as each container is destroyed, e.g. to block it
+	DestroyHook func(linux_backend.Container)
+
+	// the provider each container was explicitly created with, by handle
+	CreatedWithRootFS map[string]rootfs_provider.RootFSProvider
+
 	CreatedContainers   []linux_backend.Container
+	StartedContainers   []linux_backend.Container
 	DestroyedContainers []linux_backend.Container
 	RestoredSnapshots   []io.Reader
+
+	mutex sync.Mutex
 }
 
 func New() *FakeContainerPool {
@@ -54,11 +69,19 @@ func (p *FakeContainerPool) Prune(keep map[string]bool) error {
 	return nil
 }
 
-func (p *FakeContainerPool) Create(spec api.ContainerSpec) (linux_backend.Container, error) {
+func (p *FakeContainerPool) Create(spec api.ContainerSpec, cancelled <-chan struct{}) (linux_backend.Container, error) {
+	return p.CreateWithRootFS(spec, nil, cancelled)
+}
+
+func (p *FakeContainerPool) CreateWithRootFS(spec api.ContainerSpec, provider rootfs_provider.RootFSProvider, cancelled <-chan struct{}) (linux_backend.Container, error) {
 	if p.CreateError != nil {
 		return nil, p.CreateError
 	}
 
+	if p.CreateHook != nil {
+		p.CreateHook(spec, cancelled)
+	}
+
 	idUUID, err := uuid.NewV4()
 	if err != nil {
 		panic("could not create uuid: " + err.Error())
@@ -76,8 +99,18 @@ func (p *FakeContainerPool) Create(spec api.ContainerSpec) (linux_backend.Contai
 		p.ContainerSetup(container)
 	}
 
+	p.mutex.Lock()
 	p.CreatedContainers = append(p.CreatedContainers, container)
 
+	if provider != nil {
+		if p.CreatedWithRootFS == nil {
+			p.CreatedWithRootFS = map[string]rootfs_provider.RootFSProvider{}
+		}
+
+		p.CreatedWithRootFS[spec.Handle] = provider
+	}
+	p.mutex.Unlock()
+
 	return container, nil
 }
 
@@ -88,8 +121,8 @@ func (p *FakeContainerPool) Restore(snapshot io.Reader) (linux_backend.Container
 
 	var handle string
 
-	_, err := fmt.Fscanf(snapshot, "%s", &handle)
-	if err != nil && err != io.EOF {
+	err := json.NewDecoder(snapshot).Decode(&handle)
+	if err != nil {
 		return nil, err
 	}
 
@@ -104,12 +137,24 @@ func (p *FakeContainerPool) Restore(snapshot io.Reader) (linux_backend.Container
 	return container, nil
 }
 
+func (p *FakeContainerPool) Started(container linux_backend.Container) {
+	p.mutex.Lock()
+	p.StartedContainers = append(p.StartedContainers, container)
+	p.mutex.Unlock()
+}
+
 func (p *FakeContainerPool) Destroy(container linux_backend.Container) error {
 	if p.DestroyError != nil {
 		return p.DestroyError
 	}
 
+	if p.DestroyHook != nil {
+		p.DestroyHook(container)
+	}
+
+	p.mutex.Lock()
 	p.DestroyedContainers = append(p.DestroyedContainers, container)
+	p.mutex.Unlock()
 
 	return nil
 }
@@ -0,0 +1,83 @@
+package fake_graph_cleaner
+
+import (
+	"sync"
+
+	"github.com/pivotal-golang/lager"
+)
+
+type FakeGraphCleaner struct {
+	AcquireError error
+	ReleaseError error
+	CleanError   error
+
+	acquired map[string]string
+	released []string
+	cleaned  int
+
+	mutex *sync.RWMutex
+}
+
+func New() *FakeGraphCleaner {
+	return &FakeGraphCleaner{
+		acquired: map[string]string{},
+
+		mutex: &sync.RWMutex{},
+	}
+}
+
+func (cleaner *FakeGraphCleaner) Acquire(logger lager.Logger, containerID, imageID string) error {
+	if cleaner.AcquireError != nil {
+		return cleaner.AcquireError
+	}
+
+	cleaner.mutex.Lock()
+	defer cleaner.mutex.Unlock()
+
+	cleaner.acquired[containerID] = imageID
+
+	return nil
+}
+
+func (cleaner *FakeGraphCleaner) Release(logger lager.Logger, containerID string) error {
+	if cleaner.ReleaseError != nil {
+		return cleaner.ReleaseError
+	}
+
+	cleaner.mutex.Lock()
+	defer cleaner.mutex.Unlock()
+
+	cleaner.released = append(cleaner.released, containerID)
+
+	return nil
+}
+
+func (cleaner *FakeGraphCleaner) Clean(logger lager.Logger) error {
+	cleaner.mutex.Lock()
+	defer cleaner.mutex.Unlock()
+
+	cleaner.cleaned++
+
+	return cleaner.CleanError
+}
+
+func (cleaner *FakeGraphCleaner) Acquired() map[string]string {
+	cleaner.mutex.RLock()
+	defer cleaner.mutex.RUnlock()
+
+	return cleaner.acquired
+}
+
+func (cleaner *FakeGraphCleaner) Released() []string {
+	cleaner.mutex.RLock()
+	defer cleaner.mutex.RUnlock()
+
+	return cleaner.released
+}
+
+func (cleaner *FakeGraphCleaner) Cleaned() int {
+	cleaner.mutex.RLock()
+	defer cleaner.mutex.RUnlock()
+
+	return cleaner.cleaned
+}
@@ -0,0 +1,291 @@
+package graph_cleaner
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/image"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/clock"
+)
+
+type GraphCleaner interface {
+	// Acquire records that the container's rootfs is based on the image.
+	Acquire(logger lager.Logger, containerID, imageID string) error
+
+	// Release records that the container no longer uses its image.
+	Release(logger lager.Logger, containerID string) error
+
+	// Clean deletes least-recently-used image layers that no container uses
+	// until the graph is within its thresholds.
+	Clean(logger lager.Logger) error
+}
+
+// apes docker's *graph.Graph
+type Graph interface {
+	Get(name string) (*image.Image, error)
+	Map() (map[string]*image.Image, error)
+	Delete(name string) error
+}
+
+type Thresholds struct {
+	// MaxSize is the total size of image layers above which layers are
+	// cleaned up; 0 means unlimited.
+	MaxSize uint64
+
+	// MinFree is the free space on the graph's filesystem below which layers
+	// are cleaned up; 0 means no minimum.
+	MinFree uint64
+}
+
+type state struct {
+	Containers map[string]string    `json:"containers"`
+	LastUsed   map[string]time.Time `json:"last_used"`
+}
+
+type graphCleaner struct {
+	graph      Graph
+	graphRoot  string
+	statePath  string
+	thresholds Thresholds
+	clock      clock.Clock
+
+	state state
+	mutex *sync.Mutex
+}
+
+// New returns a GraphCleaner for the graph stored in graphRoot, persisting
+// which containers use which images, and when each image was last used, in
+// statePath so that layers in use survive a restart.
+func New(graph Graph, graphRoot, statePath string, thresholds Thresholds, clock clock.Clock) (GraphCleaner, error) {
+	cleaner := &graphCleaner{
+		graph:      graph,
+		graphRoot:  graphRoot,
+		statePath:  statePath,
+		thresholds: thresholds,
+		clock:      clock,
+
+		state: state{
+			Containers: map[string]string{},
+			LastUsed:   map[string]time.Time{},
+		},
+		mutex: new(sync.Mutex),
+	}
+
+	stateFile, err := os.Open(statePath)
+	if os.IsNotExist(err) {
+		return cleaner, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer stateFile.Close()
+
+	err = json.NewDecoder(stateFile).Decode(&cleaner.state)
+	if err != nil {
+		return nil, err
+	}
+
+	if cleaner.state.Containers == nil {
+		cleaner.state.Containers = map[string]string{}
+	}
+
+	if cleaner.state.LastUsed == nil {
+		cleaner.state.LastUsed = map[string]time.Time{}
+	}
+
+	return cleaner, nil
+}
+
+func (cleaner *graphCleaner) Acquire(logger lager.Logger, containerID, imageID string) error {
+	cleaner.mutex.Lock()
+	defer cleaner.mutex.Unlock()
+
+	now := cleaner.clock.Now()
+
+	cleaner.state.Containers[containerID] = imageID
+
+	for id := imageID; id != ""; {
+		cleaner.state.LastUsed[id] = now
+
+		img, err := cleaner.graph.Get(id)
+		if err != nil {
+			return err
+		}
+
+		id = img.Parent
+	}
+
+	return cleaner.save()
+}
+
+func (cleaner *graphCleaner) Release(logger lager.Logger, containerID string) error {
+	cleaner.mutex.Lock()
+	defer cleaner.mutex.Unlock()
+
+	imageID, found := cleaner.state.Containers[containerID]
+	if !found {
+		return nil
+	}
+
+	delete(cleaner.state.Containers, containerID)
+	cleaner.state.LastUsed[imageID] = cleaner.clock.Now()
+
+	return cleaner.save()
+}
+
+func (cleaner *graphCleaner) Clean(logger lager.Logger) error {
+	cLog := logger.Session("clean")
+
+	cleaner.mutex.Lock()
+	defer cleaner.mutex.Unlock()
+
+	if cleaner.thresholds.MaxSize == 0 && cleaner.thresholds.MinFree == 0 {
+		return nil
+	}
+
+	images, err := cleaner.graph.Map()
+	if err != nil {
+		return err
+	}
+
+	inUse := map[string]bool{}
+	for _, imageID := range cleaner.state.Containers {
+		for id := imageID; id != "" && !inUse[id]; {
+			inUse[id] = true
+
+			img, found := images[id]
+			if !found {
+				break
+			}
+
+			id = img.Parent
+		}
+	}
+
+	children := map[string]int{}
+	var size uint64
+	for _, img := range images {
+		children[img.Parent]++
+
+		if img.Size > 0 {
+			size += uint64(img.Size)
+		}
+	}
+
+	for {
+		exceeded, err := cleaner.exceeded(size)
+		if err != nil {
+			return err
+		}
+
+		if !exceeded {
+			break
+		}
+
+		// only layers without children can be deleted, so that no remaining
+		// image is left without its parent
+		candidates := []string{}
+		for id := range images {
+			if !inUse[id] && children[id] == 0 {
+				candidates = append(candidates, id)
+			}
+		}
+
+		if len(candidates) == 0 {
+			cLog.Info("nothing-left-to-delete", lager.Data{
+				"size": size,
+			})
+
+			break
+		}
+
+		sort.Sort(byLastUsed{candidates, cleaner.state.LastUsed})
+
+		id := candidates[0]
+		img := images[id]
+
+		cLog.Info("deleting-layer", lager.Data{
+			"id":        id,
+			"size":      img.Size,
+			"last-used": cleaner.state.LastUsed[id],
+		})
+
+		err = cleaner.graph.Delete(id)
+		if err != nil {
+			cLog.Error("failed-to-delete-layer", err, lager.Data{
+				"id": id,
+			})
+
+			return err
+		}
+
+		delete(images, id)
+		delete(cleaner.state.LastUsed, id)
+		children[img.Parent]--
+
+		if img.Size > 0 {
+			size -= uint64(img.Size)
+		}
+	}
+
+	return cleaner.save()
+}
+
+func (cleaner *graphCleaner) exceeded(size uint64) (bool, error) {
+	if cleaner.thresholds.MaxSize != 0 && size > cleaner.thresholds.MaxSize {
+		return true, nil
+	}
+
+	if cleaner.thresholds.MinFree != 0 {
+		var stat syscall.Statfs_t
+
+		err := syscall.Statfs(cleaner.graphRoot, &stat)
+		if err != nil {
+			return false, err
+		}
+
+		if stat.Bavail*uint64(stat.Bsize) < cleaner.thresholds.MinFree {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (cleaner *graphCleaner) save() error {
+	stateJSON, err := json.Marshal(cleaner.state)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := cleaner.statePath + ".tmp"
+
+	err = ioutil.WriteFile(tmpPath, stateJSON, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, cleaner.statePath)
+}
+
+// layers that have never been used by a container (e.g. left over from a
+// failed fetch) sort first
+type byLastUsed struct {
+	ids      []string
+	lastUsed map[string]time.Time
+}
+
+func (s byLastUsed) Len() int      { return len(s.ids) }
+func (s byLastUsed) Swap(i, j int) { s.ids[i], s.ids[j] = s.ids[j], s.ids[i] }
+func (s byLastUsed) Less(i, j int) bool {
+	return s.lastUsed[s.ids[i]].Before(s.lastUsed[s.ids[j]])
+}
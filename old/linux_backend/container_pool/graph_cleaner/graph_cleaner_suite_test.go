@@ -0,0 +1,13 @@
+package graph_cleaner_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestGraphCleaner(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Graph Cleaner Suite")
+}
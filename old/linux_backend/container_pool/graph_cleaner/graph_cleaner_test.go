@@ -0,0 +1,291 @@
+package graph_cleaner_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/image"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/clock/fake_clock"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/graph_cleaner"
+)
+
+type fakeGraph struct {
+	images  map[string]*image.Image
+	deleted []string
+
+	DeleteError error
+
+	mutex sync.Mutex
+}
+
+func newFakeGraph(images ...*image.Image) *fakeGraph {
+	graph := &fakeGraph{
+		images: map[string]*image.Image{},
+	}
+
+	for _, img := range images {
+		graph.images[img.ID] = img
+	}
+
+	return graph
+}
+
+func (graph *fakeGraph) Get(name string) (*image.Image, error) {
+	graph.mutex.Lock()
+	defer graph.mutex.Unlock()
+
+	img, found := graph.images[name]
+	if !found {
+		return nil, errors.New("no such image: " + name)
+	}
+
+	return img, nil
+}
+
+func (graph *fakeGraph) Map() (map[string]*image.Image, error) {
+	graph.mutex.Lock()
+	defer graph.mutex.Unlock()
+
+	images := map[string]*image.Image{}
+	for id, img := range graph.images {
+		images[id] = img
+	}
+
+	return images, nil
+}
+
+func (graph *fakeGraph) Delete(name string) error {
+	if graph.DeleteError != nil {
+		return graph.DeleteError
+	}
+
+	graph.mutex.Lock()
+	defer graph.mutex.Unlock()
+
+	delete(graph.images, name)
+	graph.deleted = append(graph.deleted, name)
+
+	return nil
+}
+
+func (graph *fakeGraph) Deleted() []string {
+	graph.mutex.Lock()
+	defer graph.mutex.Unlock()
+
+	return graph.deleted
+}
+
+var _ = Describe("GraphCleaner", func() {
+	var (
+		graph      *fakeGraph
+		tmpdir     string
+		statePath  string
+		thresholds graph_cleaner.Thresholds
+		fakeClock  *fake_clock.FakeClock
+
+		cleaner graph_cleaner.GraphCleaner
+
+		logger *lagertest.TestLogger
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		tmpdir, err = ioutil.TempDir("", "graph-cleaner")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		statePath = filepath.Join(tmpdir, "state.json")
+
+		// base <- app1
+		//      <- app2
+		// other
+		graph = newFakeGraph(
+			&image.Image{ID: "base", Size: 100},
+			&image.Image{ID: "app1", Parent: "base", Size: 10},
+			&image.Image{ID: "app2", Parent: "base", Size: 20},
+			&image.Image{ID: "other", Size: 50},
+		)
+
+		thresholds = graph_cleaner.Thresholds{}
+
+		fakeClock = fake_clock.New(time.Unix(123, 456))
+
+		logger = lagertest.NewTestLogger("test")
+	})
+
+	JustBeforeEach(func() {
+		var err error
+
+		cleaner, err = graph_cleaner.New(graph, tmpdir, statePath, thresholds, fakeClock)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	Context("when the graph is within its thresholds", func() {
+		BeforeEach(func() {
+			thresholds.MaxSize = 180
+		})
+
+		It("deletes nothing", func() {
+			err := cleaner.Clean(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(graph.Deleted()).Should(BeEmpty())
+		})
+	})
+
+	Context("when the graph exceeds its maximum size", func() {
+		BeforeEach(func() {
+			thresholds.MaxSize = 120
+		})
+
+		It("deletes unused layers, least recently used first, until it is within it", func() {
+			err := cleaner.Acquire(logger, "container-1", "app1")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = cleaner.Acquire(logger, "container-2", "other")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = cleaner.Release(logger, "container-2")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = cleaner.Clean(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			// app2 was never used, so goes first; other is still too big
+			Ω(graph.Deleted()).Should(Equal([]string{"app2", "other"}))
+		})
+
+		It("deletes the layer released longest ago first", func() {
+			thresholds.MaxSize = 150
+
+			cleaner, err := graph_cleaner.New(graph, tmpdir, statePath, thresholds, fakeClock)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = cleaner.Acquire(logger, "container-1", "app1")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = cleaner.Acquire(logger, "container-2", "other")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = cleaner.Release(logger, "container-2")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeClock.Increment(time.Minute)
+
+			err = cleaner.Acquire(logger, "container-3", "app2")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = cleaner.Release(logger, "container-3")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = cleaner.Clean(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			// deleting other alone brings the graph within its maximum size
+			Ω(graph.Deleted()).Should(Equal([]string{"other"}))
+		})
+
+		It("never deletes layers used by a container, or with children", func() {
+			err := cleaner.Acquire(logger, "container-1", "app1")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = cleaner.Acquire(logger, "container-2", "app2")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = cleaner.Clean(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(graph.Deleted()).Should(Equal([]string{"other"}))
+		})
+
+		It("deletes parents once their children are deleted", func() {
+			thresholds.MaxSize = 1
+
+			cleaner, err := graph_cleaner.New(graph, tmpdir, statePath, thresholds, fakeClock)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = cleaner.Clean(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(graph.Deleted()).Should(ConsistOf("app1", "app2", "base", "other"))
+			Ω(graph.Deleted()[2:]).ShouldNot(ContainElement("app1"))
+			Ω(graph.Deleted()[2:]).ShouldNot(ContainElement("app2"))
+		})
+
+		Context("after a restart", func() {
+			It("still knows which layers are in use", func() {
+				err := cleaner.Acquire(logger, "container-1", "app1")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = cleaner.Acquire(logger, "container-2", "app2")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				restarted, err := graph_cleaner.New(graph, tmpdir, statePath, thresholds, fakeClock)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = restarted.Clean(logger)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(graph.Deleted()).Should(Equal([]string{"other"}))
+			})
+		})
+
+		Context("when deleting a layer fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				graph.DeleteError = disaster
+			})
+
+			It("returns the error", func() {
+				err := cleaner.Clean(logger)
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Context("when the graph's filesystem has less than the minimum free space", func() {
+		BeforeEach(func() {
+			thresholds.MinFree = 1 << 62
+		})
+
+		It("deletes every unused layer", func() {
+			err := cleaner.Acquire(logger, "container-1", "app1")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = cleaner.Clean(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(graph.Deleted()).Should(ConsistOf("app2", "other"))
+		})
+	})
+
+	Context("when acquiring an image that is not in the graph", func() {
+		It("returns an error", func() {
+			err := cleaner.Acquire(logger, "container-1", "bogus")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("when the state file is corrupt", func() {
+		It("fails to construct", func() {
+			err := ioutil.WriteFile(statePath, []byte("{"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = graph_cleaner.New(graph, tmpdir, statePath, thresholds, fakeClock)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,51 @@
+package container_pool
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
+)
+
+// Hooks are executables run on the host around creating and destroying a
+// container, with the container's handle, IP and depot path as arguments.
+// Unset hooks are skipped. The post-create hook runs once the container has
+// been started, so it sees the container running.
+//
+// A failing pre-create or pre-destroy hook aborts the operation; a failing
+// post-create or post-destroy hook is only logged, as by then it is done.
+type Hooks struct {
+	PreCreate   string
+	PostCreate  string
+	PreDestroy  string
+	PostDestroy string
+}
+
+type HookFailedError struct {
+	Hook string
+	Err  error
+}
+
+func (e HookFailedError) Error() string {
+	return fmt.Sprintf("hook %s failed: %s", e.Hook, e.Err)
+}
+
+func (p *LinuxContainerPool) runHook(logger lager.Logger, name, hook, handle, ip, containerPath string) error {
+	if hook == "" {
+		return nil
+	}
+
+	hRunner := logging.Runner{
+		CommandRunner: p.runner,
+		Logger:        logger.Session(name + "-hook"),
+	}
+
+	err := hRunner.Run(exec.Command(hook, handle, ip, containerPath))
+	if err != nil {
+		return HookFailedError{name, err}
+	}
+
+	return nil
+}
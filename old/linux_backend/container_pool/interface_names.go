@@ -0,0 +1,66 @@
+package container_pool
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// the longest name the kernel gives a network interface: IFNAMSIZ, less
+// the terminating NUL
+const maxInterfaceNameLength = 15
+
+// the length of the IDs generateContainerIDs generates, in base 32
+const containerIDLength = 11
+
+type InterfacePrefixError struct {
+	Prefix string
+	Reason string
+}
+
+func (e InterfacePrefixError) Error() string {
+	return fmt.Sprintf("invalid network interface prefix %q: %s", e.Prefix, e.Reason)
+}
+
+// ValidateInterfacePrefix checks that containers' interfaces can be named
+// with the prefix.
+//
+// setup.sh names a container's veth pair <prefix><id>-0 and <prefix><id>-1,
+// keeping only as many of the trailing characters of its ID as fit. IDs are
+// sequential, so the names are distinct so long as they keep enough
+// characters to count up to the number of containers the pool can hold.
+func ValidateInterfacePrefix(prefix string, maxContainers int) error {
+	if prefix == "" {
+		return InterfacePrefixError{prefix, "must not be empty"}
+	}
+
+	// as the kernel's dev_valid_name
+	if strings.ContainsAny(prefix, "/: \t\n") {
+		return InterfacePrefixError{prefix, "must not contain '/', ':' or whitespace"}
+	}
+
+	idLength := interfaceNameIDLength(prefix)
+	if idLength < 1 || math.Pow(32, float64(idLength)) < float64(maxContainers) {
+		return InterfacePrefixError{
+			prefix,
+			fmt.Sprintf(
+				"too long to name %d containers' interfaces distinctly within %d characters",
+				maxContainers,
+				maxInterfaceNameLength,
+			),
+		}
+	}
+
+	return nil
+}
+
+// interfaceNameIDLength is how many characters of a container's ID its
+// interfaces' names keep, after the prefix and before the "-0" or "-1"
+func interfaceNameIDLength(prefix string) int {
+	length := maxInterfaceNameLength - len(prefix) - 2
+	if length > containerIDLength {
+		return containerIDLength
+	}
+
+	return length
+}
@@ -0,0 +1,46 @@
+package container_pool_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool"
+)
+
+var _ = Describe("Validating the network interface prefix", func() {
+	It("allows a short prefix", func() {
+		err := container_pool.ValidateInterfacePrefix("w1", 256)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("allows a prefix leaving just enough of the ID to tell the containers apart", func() {
+		// 2 characters of base 32 ID
+		err := container_pool.ValidateInterfacePrefix("garden-net-", 1024)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("rejects a prefix leaving too little of the ID to tell the containers apart", func() {
+		err := container_pool.ValidateInterfacePrefix("garden-net-", 1025)
+		Ω(err).Should(BeAssignableToTypeOf(container_pool.InterfacePrefixError{}))
+	})
+
+	It("rejects a prefix leaving no room for the ID", func() {
+		err := container_pool.ValidateInterfacePrefix("garden-netwrk", 1)
+		Ω(err).Should(BeAssignableToTypeOf(container_pool.InterfacePrefixError{}))
+	})
+
+	It("rejects an empty prefix", func() {
+		err := container_pool.ValidateInterfacePrefix("", 256)
+		Ω(err).Should(BeAssignableToTypeOf(container_pool.InterfacePrefixError{}))
+	})
+
+	It("rejects a prefix the kernel would not allow in a name", func() {
+		for _, prefix := range []string{"w/1", "w:1", "w 1"} {
+			err := container_pool.ValidateInterfacePrefix(prefix, 256)
+			Ω(err).Should(Equal(container_pool.InterfacePrefixError{
+				Prefix: prefix,
+				Reason: "must not contain '/', ':' or whitespace",
+			}), prefix)
+		}
+	})
+})
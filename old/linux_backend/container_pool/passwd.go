@@ -0,0 +1,46 @@
+package container_pool
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+type UserNotFoundError struct {
+	User string
+}
+
+func (e UserNotFoundError) Error() string {
+	return fmt.Sprintf("user not found in container: %s", e.User)
+}
+
+// lookupUser checks that the given user is defined in the rootfs's
+// /etc/passwd, so that processes can be run as them
+func lookupUser(rootfsPath, user string) error {
+	passwd, err := os.Open(path.Join(rootfsPath, "etc", "passwd"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return UserNotFoundError{user}
+		}
+
+		return err
+	}
+
+	defer passwd.Close()
+
+	scanner := bufio.NewScanner(passwd)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) >= 7 && fields[0] == user {
+			return nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return UserNotFoundError{user}
+}
@@ -0,0 +1,508 @@
+package container_pool
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/capabilities"
+)
+
+// properties interpreted by the pool when creating a container
+const (
+	// comma-separated capabilities to retain in the container; see capabilities.Parse.
+	// Those beyond capabilities.Default need -allowPrivilegedContainers
+	CapabilitiesProperty = "garden.capabilities"
+
+	// "true" to mount the rootfs read-only, with tmpfs scratch space at /tmp and /run
+	ReadOnlyRootFSProperty = "garden.read-only-rootfs"
+
+	// size in bytes of each tmpfs scratch mount for a read-only rootfs
+	ScratchSizeProperty = "garden.scratch-size"
+
+	// limits on the container's reads and writes of the disk holding the
+	// depot, in bytes or operations per second; 0 or absent is unlimited
+	BlkioReadBPSProperty   = "garden.blkio.read-bps"
+	BlkioWriteBPSProperty  = "garden.blkio.write-bps"
+	BlkioReadIOPSProperty  = "garden.blkio.read-iops"
+	BlkioWriteIOPSProperty = "garden.blkio.write-iops"
+
+	// CFS bandwidth limit: the container may use up to quota microseconds of
+	// CPU time every period microseconds (default 100000) across all CPUs
+	CPUQuotaProperty  = "garden.cpu.quota-us"
+	CPUPeriodProperty = "garden.cpu.period-us"
+
+	// CPUs to pin the container to, e.g. "0-1,3"; defaults to all of them
+	CPUSetProperty = "garden.cpuset.cpus"
+
+	// maximum number of processes and threads in the container, enforced by
+	// the pids cgroup where the kernel has it; 0 or absent is unlimited
+	PidsMaxProperty = "garden.pids.max"
+
+	// "true" to send the container's outbound traffic with its own address
+	// rather than SNATing it to the host's, for networks that route to
+	// container addresses directly
+	DisableSNATProperty = "garden.network.disable-snat"
+
+	// comma-separated hostname=ip entries added to the container's /etc/hosts
+	// and, when the DNS forwarder is enabled, answered by it
+	DNSHostsProperty = "garden.dns.hosts"
+
+	// comma-separated domains to search for names with fewer dots than the
+	// resolver's ndots, and resolver options such as "ndots:5" or "rotate";
+	// each replaces the server's default and whatever the container's
+	// resolv.conf would have had, unless empty
+	DNSSearchProperty  = "garden.dns.search"
+	DNSOptionsProperty = "garden.dns.options"
+
+	// "true" to set the container up to run garden-linux itself: it retains
+	// every capability, may use loop devices, and has its own cgroups
+	// delegated to it at /sys/fs/cgroup; only allowed when the server allows
+	// privileged containers
+	NestedProperty = "garden.nested"
+
+	// comma-separated tmpfs mounts to make in the container, each an
+	// absolute path optionally followed by a size in bytes, e.g.
+	// "/var/lib/postgresql:1073741824,/cache"; unsized mounts may use up to
+	// half of the host's memory. Paths under /proc, /dev and /sys are not
+	// allowed; /dev/shm is sized with garden.shm-size instead
+	TmpfsProperty = "garden.tmpfs"
+
+	// size in bytes of the container's /dev/shm; 0 or absent leaves it at
+	// the kernel's default of half the host's memory
+	ShmSizeProperty = "garden.shm-size"
+
+	// what to do with the cores dumped by the container's processes; one of
+	// CoreDumpsQuota (the default), CoreDumpsDisabled or CoreDumpsCollect.
+	// Only applied when the server captures core dumps.
+	CoreDumpsProperty = "garden.core-dumps"
+
+	// MTU of the container's interface, overriding the server's default and
+	// any MTU for the container's subnet; at least MinMTU, and no more than
+	// the uplink can carry
+	MTUProperty = "garden.network.mtu"
+
+	// oom_score_adj of the container's processes, from MinOOMScoreAdj (never
+	// killed) to MaxOOMScoreAdj (killed first), overriding the server's
+	// default; one below the server's default makes the container less
+	// likely to be killed than the server wants, so is only allowed when the
+	// server allows privileged containers
+	OOMScoreAdjProperty = "garden.oom-score-adj"
+
+	// most connections the container may have tracked by the host's
+	// conntrack at once, beyond which its new connections are refused, so
+	// that it can't exhaust the table for every other container; 0 for no
+	// limit. Overrides the server's default; raising it above the default
+	// is only allowed when the server allows privileged containers
+	MaxConntrackEntriesProperty = "garden.network.max-conntrack-entries"
+)
+
+const (
+	// the smallest MTU an IPv4 host must accept
+	MinMTU = 68
+
+	// containers' MTU when neither the server nor the container gives one
+	DefaultMTU = 1500
+)
+
+const (
+	// the range of oom_score_adj the kernel accepts
+	MinOOMScoreAdj = -1000
+	MaxOOMScoreAdj = 1000
+)
+
+const (
+	// dump into the process's working directory as the container's user,
+	// counting towards and cut short by the container's disk quota
+	CoreDumpsQuota = "quota"
+
+	// discard them
+	CoreDumpsDisabled = "disabled"
+
+	// write them to the server's core dumps directory on the host
+	CoreDumpsCollect = "collect"
+)
+
+var cpuSetPattern = regexp.MustCompile(`^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`)
+
+var tmpfsPathPattern = regexp.MustCompile(`^/[a-zA-Z0-9._/-]*$`)
+
+// where the container's proc, dev and sys filesystems are mounted
+var kernelFilesystems = []string{"/proc", "/dev", "/sys"}
+
+func underKernelFilesystem(p string) bool {
+	for _, fs := range kernelFilesystems {
+		if p == fs || strings.HasPrefix(p, fs+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?$`)
+
+var dnsOptionPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*(:[0-9]+)?$`)
+
+// the configuration each blkio property is passed to create.sh as
+var blkioProperties = []struct {
+	property string
+	config   string
+}{
+	{BlkioReadBPSProperty, "blkio_read_bps"},
+	{BlkioWriteBPSProperty, "blkio_write_bps"},
+	{BlkioReadIOPSProperty, "blkio_read_iops"},
+	{BlkioWriteIOPSProperty, "blkio_write_iops"},
+}
+
+type InvalidPropertyError struct {
+	Property string
+	Value    string
+}
+
+func (e InvalidPropertyError) Error() string {
+	return fmt.Sprintf("invalid value for property %s: %q", e.Property, e.Value)
+}
+
+type CoreDumpsNotCapturedError struct {
+	Policy string
+}
+
+func (e CoreDumpsNotCapturedError) Error() string {
+	return fmt.Sprintf("core dump policy %q requires the server to capture core dumps", e.Policy)
+}
+
+type MTUExceedsUplinkError struct {
+	MTU       uint64
+	UplinkMTU int
+}
+
+func (e MTUExceedsUplinkError) Error() string {
+	return fmt.Sprintf("MTU %d exceeds the uplink's MTU of %d", e.MTU, e.UplinkMTU)
+}
+
+type ExternalIPNotConfiguredError struct {
+	IP string
+}
+
+func (e ExternalIPNotConfiguredError) Error() string {
+	return fmt.Sprintf("external IP is not one of the server's: %s", e.IP)
+}
+
+type PrivilegedContainersNotAllowedError struct {
+	Property string
+}
+
+func (e PrivilegedContainersNotAllowedError) Error() string {
+	return fmt.Sprintf("privileged containers are not allowed: %s", e.Property)
+}
+
+// containerConfig interprets the spec's properties, returning the
+// configuration to pass to create.sh
+func containerConfig(properties api.Properties) ([]string, error) {
+	retainedCapabilities, err := capabilities.Parse(properties[CapabilitiesProperty])
+	if err != nil {
+		return nil, err
+	}
+
+	readOnlyRootFS, err := boolProperty(properties, ReadOnlyRootFSProperty)
+	if err != nil {
+		return nil, err
+	}
+
+	scratchSize, err := uintProperty(properties, ScratchSizeProperty)
+	if err != nil {
+		return nil, err
+	}
+
+	disableSNAT, err := boolProperty(properties, DisableSNATProperty)
+	if err != nil {
+		return nil, err
+	}
+
+	nested, err := boolProperty(properties, NestedProperty)
+	if err != nil {
+		return nil, err
+	}
+
+	droppedCapabilities := capabilities.Dropped(retainedCapabilities)
+	if nested {
+		droppedCapabilities = nil
+	}
+
+	config := []string{
+		"drop_capabilities=" + formatCapabilities(droppedCapabilities),
+		fmt.Sprintf("read_only_rootfs=%v", readOnlyRootFS),
+		fmt.Sprintf("scratch_size=%d", scratchSize),
+		fmt.Sprintf("disable_snat=%v", disableSNAT),
+		fmt.Sprintf("nested=%v", nested),
+	}
+
+	cpuQuota, err := uintProperty(properties, CPUQuotaProperty)
+	if err != nil {
+		return nil, err
+	}
+
+	cpuPeriod, err := uintProperty(properties, CPUPeriodProperty)
+	if err != nil {
+		return nil, err
+	}
+
+	// the kernel rejects periods outside 1ms to 1s, and quotas below 1ms
+	if cpuPeriod != 0 && (cpuPeriod < 1000 || cpuPeriod > 1000000) {
+		return nil, InvalidPropertyError{CPUPeriodProperty, properties[CPUPeriodProperty]}
+	}
+
+	if cpuQuota != 0 && cpuQuota < 1000 {
+		return nil, InvalidPropertyError{CPUQuotaProperty, properties[CPUQuotaProperty]}
+	}
+
+	cpuSet := properties[CPUSetProperty]
+	if cpuSet != "" && !cpuSetPattern.MatchString(cpuSet) {
+		return nil, InvalidPropertyError{CPUSetProperty, cpuSet}
+	}
+
+	config = append(config,
+		fmt.Sprintf("cpu_quota_us=%d", cpuQuota),
+		fmt.Sprintf("cpu_period_us=%d", cpuPeriod),
+		"cpuset_cpus="+cpuSet,
+	)
+
+	pidsMax, err := uintProperty(properties, PidsMaxProperty)
+	if err != nil {
+		return nil, err
+	}
+
+	config = append(config, fmt.Sprintf("pids_max=%d", pidsMax))
+
+	_, err = uintProperty(properties, linux_backend.MemorySwapProperty)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = linux_backend.PreStopTimeout(properties)
+	if err != nil {
+		return nil, InvalidPropertyError{linux_backend.PreStopTimeoutProperty, properties[linux_backend.PreStopTimeoutProperty]}
+	}
+
+	_, err = linux_backend.NetInProtocols(properties)
+	if err != nil {
+		return nil, InvalidPropertyError{linux_backend.NetInProtocolsProperty, properties[linux_backend.NetInProtocolsProperty]}
+	}
+
+	_, err = linux_backend.NetInBindingOf(properties)
+	if err, ok := err.(linux_backend.InvalidNetInBindingError); ok {
+		return nil, InvalidPropertyError{err.Property, err.Value}
+	}
+
+	for _, blkio := range blkioProperties {
+		limit, err := uintProperty(properties, blkio.property)
+		if err != nil {
+			return nil, err
+		}
+
+		config = append(config, fmt.Sprintf("%s=%d", blkio.config, limit))
+	}
+
+	dnsHosts := properties[DNSHostsProperty]
+	if dnsHosts != "" {
+		for _, entry := range strings.Split(dnsHosts, ",") {
+			segs := strings.SplitN(entry, "=", 2)
+			if len(segs) != 2 || !hostnamePattern.MatchString(segs[0]) || net.ParseIP(segs[1]) == nil {
+				return nil, InvalidPropertyError{DNSHostsProperty, dnsHosts}
+			}
+		}
+	}
+
+	config = append(config, "dns_hosts="+dnsHosts)
+
+	if search, found := properties[DNSSearchProperty]; found && !ValidDNSSearchDomains(splitList(search)) {
+		return nil, InvalidPropertyError{DNSSearchProperty, search}
+	}
+
+	if options, found := properties[DNSOptionsProperty]; found && !ValidDNSOptions(splitList(options)) {
+		return nil, InvalidPropertyError{DNSOptionsProperty, options}
+	}
+
+	tmpfsMounts := properties[TmpfsProperty]
+	if tmpfsMounts != "" {
+		for _, mount := range strings.Split(tmpfsMounts, ",") {
+			segs := strings.SplitN(mount, ":", 2)
+
+			// the mounts are made after pivoting, so paths are the container's;
+			// mounting over the kernel's filesystems would hide them from it
+			if !tmpfsPathPattern.MatchString(segs[0]) || path.Clean(segs[0]) != segs[0] || segs[0] == "/" || underKernelFilesystem(segs[0]) {
+				return nil, InvalidPropertyError{TmpfsProperty, tmpfsMounts}
+			}
+
+			if len(segs) == 2 {
+				if _, err := strconv.ParseUint(segs[1], 10, 64); err != nil {
+					return nil, InvalidPropertyError{TmpfsProperty, tmpfsMounts}
+				}
+			}
+		}
+	}
+
+	shmSize, err := uintProperty(properties, ShmSizeProperty)
+	if err != nil {
+		return nil, err
+	}
+
+	config = append(config,
+		"tmpfs_mounts="+tmpfsMounts,
+		fmt.Sprintf("shm_size=%d", shmSize),
+	)
+
+	coreDumps := properties[CoreDumpsProperty]
+	switch coreDumps {
+	case "":
+		coreDumps = CoreDumpsQuota
+	case CoreDumpsQuota, CoreDumpsDisabled, CoreDumpsCollect:
+	default:
+		return nil, InvalidPropertyError{CoreDumpsProperty, coreDumps}
+	}
+
+	config = append(config, "core_dumps="+coreDumps)
+
+	mtu, err := uintProperty(properties, MTUProperty)
+	if err != nil {
+		return nil, err
+	}
+
+	if mtu != 0 && mtu < MinMTU {
+		return nil, InvalidPropertyError{MTUProperty, properties[MTUProperty]}
+	}
+
+	oomScoreAdj, err := intProperty(properties, OOMScoreAdjProperty)
+	if err != nil {
+		return nil, err
+	}
+
+	if oomScoreAdj < MinOOMScoreAdj || oomScoreAdj > MaxOOMScoreAdj {
+		return nil, InvalidPropertyError{OOMScoreAdjProperty, properties[OOMScoreAdjProperty]}
+	}
+
+	_, err = uintProperty(properties, MaxConntrackEntriesProperty)
+	if err != nil {
+		return nil, err
+	}
+
+	// the container's traffic keeps its own address with SNAT disabled, so
+	// there is nothing to choose
+	if externalIP, found := properties[linux_backend.ExternalIPProperty]; found {
+		ip := net.ParseIP(externalIP)
+		if ip == nil || ip.To4() == nil || disableSNAT {
+			return nil, InvalidPropertyError{linux_backend.ExternalIPProperty, externalIP}
+		}
+	}
+
+	return config, nil
+}
+
+// ValidDNSSearchDomains returns whether each of the domains may be searched.
+func ValidDNSSearchDomains(domains []string) bool {
+	for _, domain := range domains {
+		if !hostnamePattern.MatchString(domain) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidDNSOptions returns whether each of the options is well-formed, as a
+// name optionally followed by a colon and a number.
+func ValidDNSOptions(options []string) bool {
+	for _, option := range options {
+		if !dnsOptionPattern.MatchString(option) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containerSecurity is how the container's properties, validated when it
+// was created, have it confined
+func containerSecurity(properties api.Properties) linux_backend.Security {
+	nested, _ := boolProperty(properties, NestedProperty)
+	if nested {
+		return linux_backend.Security{
+			Privileged:          true,
+			DroppedCapabilities: []string{},
+		}
+	}
+
+	retained, _ := capabilities.Parse(properties[CapabilitiesProperty])
+
+	return linux_backend.Security{
+		DroppedCapabilities: capabilities.Names(capabilities.Dropped(retained)),
+	}
+}
+
+func boolProperty(properties api.Properties, name string) (bool, error) {
+	value, found := properties[name]
+	if !found {
+		return false, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, InvalidPropertyError{name, value}
+	}
+
+	return parsed, nil
+}
+
+func uintProperty(properties api.Properties, name string) (uint64, error) {
+	value, found := properties[name]
+	if !found {
+		return 0, nil
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, InvalidPropertyError{name, value}
+	}
+
+	return parsed, nil
+}
+
+func intProperty(properties api.Properties, name string) (int64, error) {
+	value, found := properties[name]
+	if !found {
+		return 0, nil
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, InvalidPropertyError{name, value}
+	}
+
+	return parsed, nil
+}
+
+// splitList splits a comma-separated property, giving nothing for an empty
+// one
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+
+	return strings.Split(list, ",")
+}
+
+func formatCapabilities(numbers []int) string {
+	formatted := make([]string, len(numbers))
+	for i, number := range numbers {
+		formatted[i] = strconv.Itoa(number)
+	}
+
+	return strings.Join(formatted, ",")
+}
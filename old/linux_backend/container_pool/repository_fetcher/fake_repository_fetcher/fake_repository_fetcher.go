@@ -1,9 +1,13 @@
 package fake_repository_fetcher
 
 import (
+	"net/url"
+	"strings"
 	"sync"
 
 	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher"
 )
 
 type FakeRepositoryFetcher struct {
@@ -11,10 +15,14 @@ type FakeRepositoryFetcher struct {
 	FetchResult string
 	FetchError  error
 
+	ImageConfigResult repository_fetcher.ImageConfig
+	ImageConfigError  error
+
 	mutex *sync.RWMutex
 }
 
 type FetchSpec struct {
+	Registry   string
 	Repository string
 	Tag        string
 }
@@ -25,18 +33,22 @@ func New() *FakeRepositoryFetcher {
 	}
 }
 
-func (fetcher *FakeRepositoryFetcher) Fetch(logger lager.Logger, repoName string, tag string) (string, []string, error) {
+func (fetcher *FakeRepositoryFetcher) Fetch(logger lager.Logger, repoURL *url.URL, tag string) (string, []string, error) {
 	if fetcher.FetchError != nil {
 		return "", nil, fetcher.FetchError
 	}
 
 	fetcher.mutex.Lock()
-	fetcher.fetched = append(fetcher.fetched, FetchSpec{repoName, tag})
+	fetcher.fetched = append(fetcher.fetched, FetchSpec{repoURL.Host, strings.TrimPrefix(repoURL.Path, "/"), tag})
 	fetcher.mutex.Unlock()
 	envvars := []string{"env1", "env1Value", "env2", "env2Value"}
 	return fetcher.FetchResult, envvars, nil
 }
 
+func (fetcher *FakeRepositoryFetcher) ImageConfig(imageID string) (repository_fetcher.ImageConfig, error) {
+	return fetcher.ImageConfigResult, fetcher.ImageConfigError
+}
+
 func (fetcher *FakeRepositoryFetcher) Fetched() []FetchSpec {
 	fetcher.mutex.RLock()
 	defer fetcher.mutex.RUnlock()
@@ -0,0 +1,63 @@
+package repository_fetcher
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/registry"
+	"github.com/docker/docker/utils"
+)
+
+type RegistryProvider interface {
+	ProvideRegistry(hostname string) (Registry, error)
+}
+
+type registryProvider struct {
+	defaultEndpoint    string
+	insecureRegistries []string
+	authConfig         *registry.AuthConfig
+}
+
+// NewRegistryProvider returns a provider of registry sessions, authenticating
+// with authConfig if given and anonymously otherwise.
+//
+// An empty hostname maps to defaultEndpoint. Registries listed in
+// insecureRegistries are spoken to over plain HTTP; all others use HTTPS,
+// trusting any certificates configured under /etc/docker/certs.d/<hostname>.
+func NewRegistryProvider(defaultEndpoint string, insecureRegistries []string, authConfig *registry.AuthConfig) RegistryProvider {
+	// the session dereferences its auth config, e.g. for standalone
+	// registries, so it can't be nil
+	if authConfig == nil {
+		authConfig = &registry.AuthConfig{}
+	}
+
+	return &registryProvider{
+		defaultEndpoint:    defaultEndpoint,
+		insecureRegistries: insecureRegistries,
+		authConfig:         authConfig,
+	}
+}
+
+func (provider *registryProvider) ProvideRegistry(hostname string) (Registry, error) {
+	endpoint := provider.defaultEndpoint
+
+	if hostname != "" {
+		scheme := "https"
+		if provider.isInsecure(hostname) {
+			scheme = "http"
+		}
+
+		endpoint = fmt.Sprintf("%s://%s/v1/", scheme, hostname)
+	}
+
+	return registry.NewSession(provider.authConfig, utils.NewHTTPRequestFactory(), endpoint, true)
+}
+
+func (provider *registryProvider) isInsecure(hostname string) bool {
+	for _, insecure := range provider.insecureRegistries {
+		if insecure == hostname {
+			return true
+		}
+	}
+
+	return false
+}
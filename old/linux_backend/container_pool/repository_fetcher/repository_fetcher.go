@@ -3,6 +3,7 @@ package repository_fetcher
 import (
 	"fmt"
 	"io"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -14,7 +15,17 @@ import (
 )
 
 type RepositoryFetcher interface {
-	Fetch(logger lager.Logger, repoName string, tag string) (imageID string, envvars []string, err error)
+	Fetch(logger lager.Logger, repoURL *url.URL, tag string) (imageID string, envvars []string, err error)
+	ImageConfig(imageID string) (ImageConfig, error)
+}
+
+// ImageConfig is how an image's author intended its processes to be run.
+// Its environment is returned by Fetch.
+type ImageConfig struct {
+	User       string
+	WorkingDir string
+	Entrypoint []string
+	Cmd        []string
 }
 
 // apes docker's *registry.Registry
@@ -35,36 +46,46 @@ type Graph interface {
 }
 
 type DockerRepositoryFetcher struct {
-	registry Registry
-	graph    Graph
+	registryProvider RegistryProvider
+	graph            Graph
 
 	fetchingLayers map[string]chan struct{}
 	fetchingMutex  *sync.Mutex
 }
 
-func New(registry Registry, graph Graph) RepositoryFetcher {
+func New(registryProvider RegistryProvider, graph Graph) RepositoryFetcher {
 	return &DockerRepositoryFetcher{
-		registry: registry,
-		graph:    graph,
-		fetchingLayers: map[string]chan struct{}{},
-		fetchingMutex:  new(sync.Mutex),
+		registryProvider: registryProvider,
+		graph:            graph,
+		fetchingLayers:   map[string]chan struct{}{},
+		fetchingMutex:    new(sync.Mutex),
 	}
 }
 
-func (fetcher *DockerRepositoryFetcher) Fetch(logger lager.Logger, repoName string, tag string) (string, []string, error) {
+// Fetch fetches the repository named by the URL's path from the registry
+// named by its host, or the default registry if it has none.
+func (fetcher *DockerRepositoryFetcher) Fetch(logger lager.Logger, repoURL *url.URL, tag string) (string, []string, error) {
+	repoName := strings.TrimPrefix(repoURL.Path, "/")
+
 	fLog := logger.Session("fetch", lager.Data{
-		"repo": repoName,
-		"tag":  tag,
+		"registry": repoURL.Host,
+		"repo":     repoName,
+		"tag":      tag,
 	})
 
 	fLog.Debug("fetching")
 
-	repoData, err := fetcher.registry.GetRepositoryData(repoName)
+	session, err := fetcher.registryProvider.ProvideRegistry(repoURL.Host)
+	if err != nil {
+		return "", nil, err
+	}
+
+	repoData, err := session.GetRepositoryData(repoName)
 	if err != nil {
 		return "", nil, err
 	}
 
-	tagsList, err := fetcher.registry.GetRemoteTags(repoData.Endpoints, repoName, repoData.Tokens)
+	tagsList, err := session.GetRemoteTags(repoData.Endpoints, repoName, repoData.Tokens)
 	if err != nil {
 		return "", nil, err
 	}
@@ -82,7 +103,7 @@ func (fetcher *DockerRepositoryFetcher) Fetch(logger lager.Logger, repoName stri
 			"image":    imgID,
 		})
 
-		env, err := fetcher.fetchFromEndpoint(fLog, endpoint, imgID, token)
+		env, err := fetcher.fetchFromEndpoint(fLog, session, endpoint, imgID, token)
 		if err == nil {
 			return imgID, filterEnv(env, logger), nil
 		}
@@ -91,15 +112,36 @@ func (fetcher *DockerRepositoryFetcher) Fetch(logger lager.Logger, repoName stri
 	return "", nil, fmt.Errorf("all endpoints failed: %s", err)
 }
 
-func (fetcher *DockerRepositoryFetcher) fetchFromEndpoint(logger lager.Logger, endpoint string, imgID string, token []string) ([]string, error) {
-	history, err := fetcher.registry.GetRemoteHistory(imgID, endpoint, token)
+// ImageConfig returns the config of a fetched image. An image's config is
+// that of the container it was committed from, so already includes what it
+// inherited from its parent layers.
+func (fetcher *DockerRepositoryFetcher) ImageConfig(imageID string) (ImageConfig, error) {
+	img, err := fetcher.graph.Get(imageID)
+	if err != nil {
+		return ImageConfig{}, err
+	}
+
+	if img.Config == nil {
+		return ImageConfig{}, nil
+	}
+
+	return ImageConfig{
+		User:       img.Config.User,
+		WorkingDir: img.Config.WorkingDir,
+		Entrypoint: img.Config.Entrypoint,
+		Cmd:        img.Config.Cmd,
+	}, nil
+}
+
+func (fetcher *DockerRepositoryFetcher) fetchFromEndpoint(logger lager.Logger, session Registry, endpoint string, imgID string, token []string) ([]string, error) {
+	history, err := session.GetRemoteHistory(imgID, endpoint, token)
 	if err != nil {
 		return nil, err
 	}
 
 	var allEnv []string
 	for i := len(history) - 1; i >= 0; i-- {
-		env, err := fetcher.fetchLayer(logger, endpoint, history[i], token)
+		env, err := fetcher.fetchLayer(logger, session, endpoint, history[i], token)
 		if err != nil {
 			return nil, err
 		}
@@ -110,7 +152,7 @@ func (fetcher *DockerRepositoryFetcher) fetchFromEndpoint(logger lager.Logger, e
 	return allEnv, nil
 }
 
-func (fetcher *DockerRepositoryFetcher) fetchLayer(logger lager.Logger, endpoint string, layerID string, token []string) ([]string, error) {
+func (fetcher *DockerRepositoryFetcher) fetchLayer(logger lager.Logger, session Registry, endpoint string, layerID string, token []string) ([]string, error) {
 	for acquired := false; !acquired; acquired = fetcher.fetching(layerID) {
 	}
 
@@ -125,7 +167,7 @@ func (fetcher *DockerRepositoryFetcher) fetchLayer(logger lager.Logger, endpoint
 		return imgEnv(img), nil
 	}
 
-	imgJSON, imgSize, err := fetcher.registry.GetRemoteImageJSON(layerID, endpoint, token)
+	imgJSON, imgSize, err := session.GetRemoteImageJSON(layerID, endpoint, token)
 	if err != nil {
 		return nil, err
 	}
@@ -135,7 +177,7 @@ func (fetcher *DockerRepositoryFetcher) fetchLayer(logger lager.Logger, endpoint
 		return nil, err
 	}
 
-	layer, err := fetcher.registry.GetRemoteImageLayer(img.ID, endpoint, token, int64(imgSize))
+	layer, err := session.GetRemoteImageLayer(img.ID, endpoint, token, int64(imgSize))
 	if err != nil {
 		return nil, err
 	}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 
 	"github.com/docker/docker/archive"
 	"github.com/docker/docker/image"
@@ -35,10 +36,7 @@ var _ = Describe("RepositoryFetcher", func() {
 		endpoint1 = ghttp.NewServer()
 		endpoint2 = ghttp.NewServer()
 
-		registry, err := registry.NewSession(nil, nil, server.URL()+"/v1/", true)
-		Ω(err).ShouldNot(HaveOccurred())
-
-		fetcher = New(registry, graph)
+		fetcher = New(NewRegistryProvider(server.URL()+"/v1/", nil, nil), graph)
 
 		logger = lagertest.NewTestLogger("test")
 	})
@@ -164,7 +162,7 @@ var _ = Describe("RepositoryFetcher", func() {
 					return nil
 				}
 
-				imageID, envvars, err := fetcher.Fetch(logger, "some-repo", "some-tag")
+				imageID, envvars, err := fetcher.Fetch(logger, &url.URL{Path: "/some-repo"}, "some-tag")
 
 				Ω(err).ShouldNot(HaveOccurred())
 				Ω(envvars).Should(ConsistOf([]string{"env1=env1Value", "env2=env2Value"}))
@@ -190,7 +188,7 @@ var _ = Describe("RepositoryFetcher", func() {
 				})
 
 				It("retries with the next endpoint", func() {
-					imageID, _, err := fetcher.Fetch(logger, "some-repo", "some-tag")
+					imageID, _, err := fetcher.Fetch(logger, &url.URL{Path: "/some-repo"}, "some-tag")
 					Ω(err).ShouldNot(HaveOccurred())
 
 					Ω(imageID).Should(Equal("id-1"))
@@ -204,7 +202,7 @@ var _ = Describe("RepositoryFetcher", func() {
 					})
 
 					It("returns an error", func() {
-						_, _, err := fetcher.Fetch(logger, "some-repo", "some-tag")
+						_, _, err := fetcher.Fetch(logger, &url.URL{Path: "/some-repo"}, "some-tag")
 						Ω(err).Should(HaveOccurred())
 					})
 				})
@@ -270,7 +268,7 @@ var _ = Describe("RepositoryFetcher", func() {
 					return nil
 				}
 
-				imageID, envVars, err := fetcher.Fetch(logger, "some-repo", "some-tag")
+				imageID, envVars, err := fetcher.Fetch(logger, &url.URL{Path: "/some-repo"}, "some-tag")
 				Ω(err).ShouldNot(HaveOccurred())
 				Ω(envVars).Should(ConsistOf([]string{"env2=env2Value"}))
 
@@ -286,7 +284,7 @@ var _ = Describe("RepositoryFetcher", func() {
 			})
 
 			It("returns an error", func() {
-				_, _, err := fetcher.Fetch(logger, "some-repo", "some-tag")
+				_, _, err := fetcher.Fetch(logger, &url.URL{Path: "/some-repo"}, "some-tag")
 				Ω(err).Should(HaveOccurred())
 			})
 		})
@@ -313,7 +311,7 @@ var _ = Describe("RepositoryFetcher", func() {
 			})
 
 			It("tries the next endpoint", func() {
-				_, _, err := fetcher.Fetch(logger, "some-repo", "some-tag")
+				_, _, err := fetcher.Fetch(logger, &url.URL{Path: "/some-repo"}, "some-tag")
 				Ω(err).ShouldNot(HaveOccurred())
 			})
 
@@ -325,10 +323,113 @@ var _ = Describe("RepositoryFetcher", func() {
 				})
 
 				It("returns an error", func() {
-					_, _, err := fetcher.Fetch(logger, "some-repo", "some-tag")
+					_, _, err := fetcher.Fetch(logger, &url.URL{Path: "/some-repo"}, "some-tag")
+					Ω(err).Should(HaveOccurred())
+				})
+			})
+		})
+
+		Context("when the URL names a registry", func() {
+			var privateRegistry *ghttp.Server
+			var registryHost string
+
+			BeforeEach(func() {
+				privateRegistry = ghttp.NewServer()
+				registryHost = privateRegistry.HTTPTestServer.Listener.Addr().String()
+
+				privateRegistry.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/v1/repositories/some-repo/images"),
+						ghttp.VerifyBasicAuth("some-user", "some-password"),
+						ghttp.RespondWith(500, ""),
+					),
+				)
+			})
+
+			AfterEach(func() {
+				privateRegistry.Close()
+			})
+
+			Context("and it is allowed to be insecure", func() {
+				BeforeEach(func() {
+					fetcher = New(NewRegistryProvider(
+						server.URL()+"/v1/",
+						[]string{registryHost},
+						&registry.AuthConfig{
+							Username: "some-user",
+							Password: "some-password",
+						},
+					), graph)
+				})
+
+				It("fetches from it over HTTP, with the configured credentials", func() {
+					_, _, err := fetcher.Fetch(logger, &url.URL{Host: registryHost, Path: "/some-repo"}, "some-tag")
 					Ω(err).Should(HaveOccurred())
+
+					Ω(privateRegistry.ReceivedRequests()).Should(HaveLen(1))
+					Ω(server.ReceivedRequests()).Should(BeEmpty())
 				})
 			})
+
+			Context("and it is not allowed to be insecure", func() {
+				BeforeEach(func() {
+					fetcher = New(NewRegistryProvider(server.URL()+"/v1/", nil, nil), graph)
+				})
+
+				It("does not fetch from it over HTTP", func() {
+					_, _, err := fetcher.Fetch(logger, &url.URL{Host: registryHost, Path: "/some-repo"}, "some-tag")
+					Ω(err).Should(HaveOccurred())
+
+					Ω(privateRegistry.ReceivedRequests()).Should(BeEmpty())
+				})
+			})
+		})
+	})
+
+	Describe("ImageConfig", func() {
+		Context("when the image is in the graph", func() {
+			BeforeEach(func() {
+				graph.SetExists("some-image", []byte(`{
+					"id": "some-image",
+					"config": {
+						"User": "some-user",
+						"WorkingDir": "/some/dir",
+						"Entrypoint": ["/some/entrypoint", "some-arg"],
+						"Cmd": ["some-cmd"]
+					}
+				}`))
+			})
+
+			It("returns its config", func() {
+				config, err := fetcher.ImageConfig("some-image")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(config).Should(Equal(ImageConfig{
+					User:       "some-user",
+					WorkingDir: "/some/dir",
+					Entrypoint: []string{"/some/entrypoint", "some-arg"},
+					Cmd:        []string{"some-cmd"},
+				}))
+			})
+		})
+
+		Context("when the image has no config", func() {
+			BeforeEach(func() {
+				graph.SetExists("some-image", []byte(`{"id": "some-image"}`))
+			})
+
+			It("returns an empty config", func() {
+				config, err := fetcher.ImageConfig("some-image")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(config).Should(BeZero())
+			})
+		})
+
+		Context("when the image is not in the graph", func() {
+			It("returns an error", func() {
+				_, err := fetcher.ImageConfig("some-image")
+				Ω(err).Should(HaveOccurred())
+			})
 		})
 	})
 })
@@ -1,6 +1,8 @@
 package repository_fetcher
 
 import (
+	"net/url"
+
 	"github.com/pivotal-golang/lager"
 )
 
@@ -8,13 +10,13 @@ type Retryable struct {
 	RepositoryFetcher
 }
 
-func (retryable Retryable) Fetch(logger lager.Logger, repoName string, tag string) (string, []string, error) {
+func (retryable Retryable) Fetch(logger lager.Logger, repoURL *url.URL, tag string) (string, []string, error) {
 	var res string
 	var err error
 	var envvars []string
 
 	for attempt := 1; attempt <= 3; attempt++ {
-		res, envvars, err = retryable.RepositoryFetcher.Fetch(logger, repoName, tag)
+		res, envvars, err = retryable.RepositoryFetcher.Fetch(logger, repoURL, tag)
 		if err == nil {
 			break
 		}
@@ -0,0 +1,93 @@
+package container_pool
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+type HandleReservedError struct {
+	Handle string
+}
+
+func (e HandleReservedError) Error() string {
+	return fmt.Sprintf("resources are already reserved for handle: %s", e.Handle)
+}
+
+// Reserve takes the given resources out of the pools for the container that
+// will be created with the handle, e.g. one migrating from another cell
+// that must keep its network identity; creating it is given them rather
+// than acquiring its own. Nothing is reserved if any of them is taken.
+//
+// Reservations are not saved, so don't outlive the server.
+func (p *LinuxContainerPool) Reserve(handle string, resources linux_backend.ResourcesSnapshot) error {
+	p.reservationsMutex.Lock()
+	defer p.reservationsMutex.Unlock()
+
+	if _, found := p.reservations[handle]; found {
+		return HandleReservedError{handle}
+	}
+
+	reserved := linux_backend.NewResources(0, nil, nil)
+
+	err := p.uidPool.Remove(resources.UID)
+	if err != nil {
+		return err
+	}
+
+	reserved.UID = resources.UID
+
+	err = p.networkPool.Remove(handle, resources.Network)
+	if err != nil {
+		p.releasePoolResources(handle, reserved)
+		return err
+	}
+
+	reserved.Network = resources.Network
+
+	for _, port := range resources.Ports {
+		err := p.portPool.Remove(port)
+		if err != nil {
+			p.releasePoolResources(handle, reserved)
+			return err
+		}
+
+		reserved.AddPort(port)
+	}
+
+	p.reservations[handle] = reserved
+
+	return nil
+}
+
+// Unreserve returns the resources reserved for the handle to the pools,
+// returning false if there are none.
+func (p *LinuxContainerPool) Unreserve(handle string) bool {
+	p.reservationsMutex.Lock()
+	defer p.reservationsMutex.Unlock()
+
+	reserved, found := p.reservations[handle]
+	if !found {
+		return false
+	}
+
+	delete(p.reservations, handle)
+
+	p.releasePoolResources(handle, reserved)
+
+	return true
+}
+
+// takeReservation hands the resources reserved for the handle, if any, to
+// the container being created with it
+func (p *LinuxContainerPool) takeReservation(handle string) (*linux_backend.Resources, bool) {
+	p.reservationsMutex.Lock()
+	defer p.reservationsMutex.Unlock()
+
+	reserved, found := p.reservations[handle]
+	if found {
+		delete(p.reservations, handle)
+	}
+
+	return reserved, found
+}
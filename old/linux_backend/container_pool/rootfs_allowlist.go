@@ -0,0 +1,49 @@
+package container_pool
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+type RootFSNotAllowedError struct {
+	RootFSPath string
+}
+
+func (e RootFSNotAllowedError) Error() string {
+	return fmt.Sprintf("rootfs not allowed: %s", e.RootFSPath)
+}
+
+// rootFSAllowed checks the rootfs against the allowed prefixes, e.g.
+// "/var/vcap/rootfses" or "docker://some.registry:5000". An empty rootfs
+// (the default) is always allowed, as is any rootfs if there are no prefixes.
+//
+// A prefix only matches whole path components, and paths are cleaned first,
+// so that e.g. "/allowed/../etc" is not allowed by "/allowed".
+func rootFSAllowed(rootFSPath string, allowed []string) bool {
+	if rootFSPath == "" || len(allowed) == 0 {
+		return true
+	}
+
+	rootfsURL, err := url.Parse(rootFSPath)
+	if err != nil {
+		return false
+	}
+
+	if rootfsURL.Path != "" {
+		rootfsURL.Path = path.Clean(rootfsURL.Path)
+	}
+
+	normalized := rootfsURL.String()
+
+	for _, prefix := range allowed {
+		prefix = strings.TrimSuffix(prefix, "/")
+
+		if normalized == prefix || strings.HasPrefix(normalized, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
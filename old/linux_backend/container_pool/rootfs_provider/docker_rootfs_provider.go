@@ -3,16 +3,27 @@ package rootfs_provider
 import (
 	"errors"
 	"net/url"
+	"sync"
 
 	"github.com/docker/docker/daemon/graphdriver"
 	"github.com/pivotal-golang/lager"
 
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/graph_cleaner"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher"
 )
 
 type dockerRootFSProvider struct {
-	repoFetcher repository_fetcher.RepositoryFetcher
-	graphDriver graphdriver.Driver
+	repoFetcher  repository_fetcher.RepositoryFetcher
+	graphDriver  graphdriver.Driver
+	graphCleaner graph_cleaner.GraphCleaner
+
+	// held for reading while providing a rootfs, so that layers which have
+	// been fetched but are not yet in use are not cleaned up
+	cleaning *sync.RWMutex
+
+	// the config of each container's image, by container id
+	imageConfigs      map[string]repository_fetcher.ImageConfig
+	imageConfigsMutex *sync.Mutex
 
 	fallback RootFSProvider
 }
@@ -22,10 +33,17 @@ var ErrInvalidDockerURL = errors.New("invalid docker url; must provide path")
 func NewDocker(
 	repoFetcher repository_fetcher.RepositoryFetcher,
 	graphDriver graphdriver.Driver,
+	graphCleaner graph_cleaner.GraphCleaner,
 ) RootFSProvider {
 	return &dockerRootFSProvider{
-		repoFetcher: repoFetcher,
-		graphDriver: graphDriver,
+		repoFetcher:  repoFetcher,
+		graphDriver:  graphDriver,
+		graphCleaner: graphCleaner,
+
+		cleaning: new(sync.RWMutex),
+
+		imageConfigs:      map[string]repository_fetcher.ImageConfig{},
+		imageConfigsMutex: new(sync.Mutex),
 	}
 }
 
@@ -34,14 +52,61 @@ func (provider *dockerRootFSProvider) ProvideRootFS(logger lager.Logger, id stri
 		return "", nil, ErrInvalidDockerURL
 	}
 
-	repoName := url.Path[1:]
-
 	tag := "latest"
 	if len(url.Fragment) > 0 {
 		tag = url.Fragment
 	}
 
-	imageID, envvars, err := provider.repoFetcher.Fetch(logger, repoName, tag)
+	provider.cleaning.RLock()
+	rootID, envvars, err := provider.provide(logger, id, url, tag)
+	provider.cleaning.RUnlock()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	provider.clean(logger)
+
+	return rootID, envvars, nil
+}
+
+func (provider *dockerRootFSProvider) ImageConfig(id string) (repository_fetcher.ImageConfig, bool) {
+	provider.imageConfigsMutex.Lock()
+	defer provider.imageConfigsMutex.Unlock()
+
+	config, found := provider.imageConfigs[id]
+	return config, found
+}
+
+func (provider *dockerRootFSProvider) CleanupRootFS(logger lager.Logger, id string) error {
+	provider.imageConfigsMutex.Lock()
+	delete(provider.imageConfigs, id)
+	provider.imageConfigsMutex.Unlock()
+
+	provider.graphDriver.Put(id)
+
+	err := provider.graphDriver.Remove(id)
+	if err != nil {
+		return err
+	}
+
+	err = provider.graphCleaner.Release(logger, id)
+	if err != nil {
+		return err
+	}
+
+	provider.clean(logger)
+
+	return nil
+}
+
+func (provider *dockerRootFSProvider) provide(logger lager.Logger, id string, url *url.URL, tag string) (string, []string, error) {
+	imageID, envvars, err := provider.repoFetcher.Fetch(logger, url, tag)
+	if err != nil {
+		return "", nil, err
+	}
+
+	imageConfig, err := provider.repoFetcher.ImageConfig(imageID)
 	if err != nil {
 		return "", nil, err
 	}
@@ -56,11 +121,26 @@ func (provider *dockerRootFSProvider) ProvideRootFS(logger lager.Logger, id stri
 		return "", nil, err
 	}
 
+	err = provider.graphCleaner.Acquire(logger, id, imageID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	provider.imageConfigsMutex.Lock()
+	provider.imageConfigs[id] = imageConfig
+	provider.imageConfigsMutex.Unlock()
+
 	return rootID, envvars, nil
 }
 
-func (provider *dockerRootFSProvider) CleanupRootFS(logger lager.Logger, id string) error {
-	provider.graphDriver.Put(id)
+// failing to clean up the graph does not affect the container, so is only
+// logged
+func (provider *dockerRootFSProvider) clean(logger lager.Logger) {
+	provider.cleaning.Lock()
+	defer provider.cleaning.Unlock()
 
-	return provider.graphDriver.Remove(id)
+	err := provider.graphCleaner.Clean(logger)
+	if err != nil {
+		logger.Error("failed-to-clean-graph", err)
+	}
 }
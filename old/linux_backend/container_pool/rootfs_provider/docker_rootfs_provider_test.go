@@ -4,6 +4,8 @@ import (
 	"errors"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/fake_graph_driver"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/graph_cleaner/fake_graph_cleaner"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher/fake_repository_fetcher"
 	. "github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider"
 	"github.com/pivotal-golang/lager/lagertest"
@@ -16,6 +18,7 @@ var _ = Describe("DockerRootFSProvider", func() {
 	var (
 		fakeRepositoryFetcher *fake_repository_fetcher.FakeRepositoryFetcher
 		fakeGraphDriver       *fake_graph_driver.FakeGraphDriver
+		fakeGraphCleaner      *fake_graph_cleaner.FakeGraphCleaner
 
 		provider RootFSProvider
 
@@ -25,8 +28,9 @@ var _ = Describe("DockerRootFSProvider", func() {
 	BeforeEach(func() {
 		fakeRepositoryFetcher = fake_repository_fetcher.New()
 		fakeGraphDriver = fake_graph_driver.New()
+		fakeGraphCleaner = fake_graph_cleaner.New()
 
-		provider = NewDocker(fakeRepositoryFetcher, fakeGraphDriver)
+		provider = NewDocker(fakeRepositoryFetcher, fakeGraphDriver, fakeGraphCleaner)
 
 		logger = lagertest.NewTestLogger("test")
 	})
@@ -57,6 +61,58 @@ var _ = Describe("DockerRootFSProvider", func() {
 			Ω(envvars).Should(Equal([]string{"env1", "env1Value", "env2", "env2Value"}))
 		})
 
+		It("records that the container uses the image, and then cleans up the graph", func() {
+			fakeRepositoryFetcher.FetchResult = "some-image-id"
+
+			_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeGraphCleaner.Acquired()).Should(Equal(map[string]string{
+				"some-id": "some-image-id",
+			}))
+
+			Ω(fakeGraphCleaner.Cleaned()).Should(Equal(1))
+		})
+
+		Context("when cleaning up the graph fails", func() {
+			BeforeEach(func() {
+				fakeGraphCleaner.CleanError = errors.New("oh no!")
+			})
+
+			It("still provides the rootfs", func() {
+				_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name"))
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("when recording the container's image fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeGraphCleaner.AcquireError = disaster
+			})
+
+			It("returns the error", func() {
+				_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name"))
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
+		Context("when the url names a registry", func() {
+			It("fetches the repository from it", func() {
+				_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker://some.registry:5000/some-repository-name"))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRepositoryFetcher.Fetched()).Should(ContainElement(
+					fake_repository_fetcher.FetchSpec{
+						Registry:   "some.registry:5000",
+						Repository: "some-repository-name",
+						Tag:        "latest",
+					},
+				))
+			})
+		})
+
 		Context("when the url is missing a path", func() {
 			It("returns an error", func() {
 				_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker://"))
@@ -78,6 +134,42 @@ var _ = Describe("DockerRootFSProvider", func() {
 			})
 		})
 
+		It("makes the image's config available until the rootfs is cleaned up", func() {
+			fakeRepositoryFetcher.ImageConfigResult = repository_fetcher.ImageConfig{
+				User:       "some-user",
+				WorkingDir: "/some/dir",
+			}
+
+			_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			config, found := provider.(ImageConfigProvider).ImageConfig("some-id")
+			Ω(found).Should(BeTrue())
+			Ω(config).Should(Equal(repository_fetcher.ImageConfig{
+				User:       "some-user",
+				WorkingDir: "/some/dir",
+			}))
+
+			err = provider.CleanupRootFS(logger, "some-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, found = provider.(ImageConfigProvider).ImageConfig("some-id")
+			Ω(found).Should(BeFalse())
+		})
+
+		Context("but reading the image's config fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRepositoryFetcher.ImageConfigError = disaster
+			})
+
+			It("returns the error", func() {
+				_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name"))
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
 		Context("but fetching it fails", func() {
 			disaster := errors.New("oh no!")
 
@@ -127,6 +219,14 @@ var _ = Describe("DockerRootFSProvider", func() {
 			Ω(fakeGraphDriver.Removed()).Should(ContainElement("some-id"))
 		})
 
+		It("releases the container's image, and then cleans up the graph", func() {
+			err := provider.CleanupRootFS(logger, "some-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeGraphCleaner.Released()).Should(ConsistOf("some-id"))
+			Ω(fakeGraphCleaner.Cleaned()).Should(Equal(1))
+		})
+
 		Context("when removing the container from the graph fails", func() {
 			disaster := errors.New("oh no!")
 
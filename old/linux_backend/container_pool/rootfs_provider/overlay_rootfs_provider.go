@@ -1,9 +1,13 @@
 package rootfs_provider
 
 import (
+	"bytes"
+	"fmt"
 	"net/url"
+	"os"
 	"os/exec"
 	"path"
+	"strings"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
 	"github.com/cloudfoundry/gunk/command_runner"
@@ -14,23 +18,59 @@ type overlayRootFSProvider struct {
 	binPath       string
 	overlaysPath  string
 	defaultRootFS string
+	backend       string
 	runner        command_runner.CommandRunner
 }
 
+// NewOverlay returns a provider layering a copy-on-write filesystem over the
+// rootfs, using the given backend: aufs, overlay, overlayfs, or bind (a
+// read-only bind mount with writable copies of select directories).
 func NewOverlay(
 	binPath string,
 	overlaysPath string,
 	defaultRootFS string,
+	backend string,
 	runner command_runner.CommandRunner,
 ) RootFSProvider {
 	return &overlayRootFSProvider{
 		binPath:       binPath,
 		overlaysPath:  overlaysPath,
 		defaultRootFS: defaultRootFS,
+		backend:       backend,
 		runner:        runner,
 	}
 }
 
+// DetectOverlayBackend determines the backend overlay.sh will use for
+// overlays under overlaysPath. If requested is "auto" the first of aufs,
+// overlay, overlayfs, and bind supported by the kernel is chosen; otherwise
+// it fails if the requested backend is not supported.
+func DetectOverlayBackend(
+	logger lager.Logger,
+	binPath string,
+	overlaysPath string,
+	requested string,
+	runner command_runner.CommandRunner,
+) (string, error) {
+	pRunner := logging.Runner{
+		CommandRunner: runner,
+		Logger:        logger,
+	}
+
+	stdout := new(bytes.Buffer)
+
+	detect := exec.Command(path.Join(binPath, "overlay.sh"), "detect", overlaysPath)
+	detect.Env = overlayEnv(requested)
+	detect.Stdout = stdout
+
+	err := pRunner.Run(detect)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
 func (provider *overlayRootFSProvider) ProvideRootFS(logger lager.Logger, id string, rootfs *url.URL) (string, []string, error) {
 	rootFSPath := provider.defaultRootFS
 	if rootfs.Path != "" {
@@ -46,6 +86,7 @@ func (provider *overlayRootFSProvider) ProvideRootFS(logger lager.Logger, id str
 		path.Join(provider.binPath, "overlay.sh"),
 		"create", path.Join(provider.overlaysPath, id), rootFSPath,
 	)
+	createOverlay.Env = overlayEnv(provider.backend)
 
 	err := pRunner.Run(createOverlay)
 	if err != nil {
@@ -68,3 +109,68 @@ func (provider *overlayRootFSProvider) CleanupRootFS(logger lager.Logger, id str
 
 	return pRunner.Run(destroyOverlay)
 }
+
+type InvalidCloneSourceError struct {
+	Source string
+}
+
+func (e InvalidCloneSourceError) Error() string {
+	return fmt.Sprintf("invalid container to clone: %q", e.Source)
+}
+
+type overlayCloneRootFSProvider struct {
+	*overlayRootFSProvider
+}
+
+// NewOverlayClone returns a provider for rootfses given as clone:///<id>,
+// layering a copy of the changes container <id> has made to its rootfs over
+// the same base, so that the new container starts from the other's current
+// filesystem. Only containers whose rootfs was provided by an overlay
+// provider can be cloned.
+func NewOverlayClone(
+	binPath string,
+	overlaysPath string,
+	backend string,
+	runner command_runner.CommandRunner,
+) RootFSProvider {
+	return &overlayCloneRootFSProvider{
+		overlayRootFSProvider: &overlayRootFSProvider{
+			binPath:      binPath,
+			overlaysPath: overlaysPath,
+			backend:      backend,
+			runner:       runner,
+		},
+	}
+}
+
+func (provider *overlayCloneRootFSProvider) ProvideRootFS(logger lager.Logger, id string, rootfs *url.URL) (string, []string, error) {
+	sourceID := strings.TrimPrefix(rootfs.Path, "/")
+	if sourceID == "" || sourceID == "." || sourceID == ".." || strings.Contains(sourceID, "/") {
+		return "", nil, InvalidCloneSourceError{rootfs.Path}
+	}
+
+	pRunner := logging.Runner{
+		CommandRunner: provider.runner,
+		Logger:        logger,
+	}
+
+	cloneOverlay := exec.Command(
+		path.Join(provider.binPath, "overlay.sh"),
+		"clone", path.Join(provider.overlaysPath, id), path.Join(provider.overlaysPath, sourceID),
+	)
+	cloneOverlay.Env = overlayEnv(provider.backend)
+
+	err := pRunner.Run(cloneOverlay)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return path.Join(provider.overlaysPath, id, "rootfs"), nil, nil
+}
+
+func overlayEnv(backend string) []string {
+	return []string{
+		"OVERLAY_BACKEND=" + backend,
+		"PATH=" + os.Getenv("PATH"),
+	}
+}
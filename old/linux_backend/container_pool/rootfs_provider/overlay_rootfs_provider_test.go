@@ -2,6 +2,7 @@ package rootfs_provider_test
 
 import (
 	"errors"
+	"os"
 	"os/exec"
 
 	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
@@ -25,7 +26,7 @@ var _ = Describe("OverlayRootfsProvider", func() {
 	BeforeEach(func() {
 		fakeRunner = fake_command_runner.New()
 
-		provider = NewOverlay("/some/bin/path", "/some/overlays/path", "/some/default/rootfs", fakeRunner)
+		provider = NewOverlay("/some/bin/path", "/some/overlays/path", "/some/default/rootfs", "overlay", fakeRunner)
 
 		logger = lagertest.NewTestLogger("test")
 	})
@@ -47,6 +48,21 @@ var _ = Describe("OverlayRootfsProvider", func() {
 			})
 		})
 
+		It("tells overlay.sh which backend to use", func() {
+			_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL(""))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/some/bin/path/overlay.sh",
+					Env: []string{
+						"OVERLAY_BACKEND=overlay",
+						"PATH=" + os.Getenv("PATH"),
+					},
+				},
+			))
+		})
+
 		Context("with a path given", func() {
 			It("executes overlay.sh create with the given rootfs", func() {
 				rootfs, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("/some/given/rootfs"))
@@ -119,4 +135,103 @@ var _ = Describe("OverlayRootfsProvider", func() {
 			})
 		})
 	})
+
+	Describe("DetectOverlayBackend", func() {
+		It("returns the backend overlay.sh detected for the requested one", func() {
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: "/some/bin/path/overlay.sh",
+					Args: []string{"detect", "/some/overlays/path"},
+				},
+				func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("aufs\n"))
+					return nil
+				},
+			)
+
+			backend, err := DetectOverlayBackend(logger, "/some/bin/path", "/some/overlays/path", "auto", fakeRunner)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(backend).Should(Equal("aufs"))
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/some/bin/path/overlay.sh",
+					Args: []string{"detect", "/some/overlays/path"},
+					Env: []string{
+						"OVERLAY_BACKEND=auto",
+						"PATH=" + os.Getenv("PATH"),
+					},
+				},
+			))
+		})
+
+		Context("when the requested backend is not supported", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/some/bin/path/overlay.sh",
+						Args: []string{"detect", "/some/overlays/path"},
+					},
+					func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				_, err := DetectOverlayBackend(logger, "/some/bin/path", "/some/overlays/path", "aufs", fakeRunner)
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("cloning", func() {
+		BeforeEach(func() {
+			provider = NewOverlayClone("/some/bin/path", "/some/overlays/path", "overlay", fakeRunner)
+		})
+
+		It("executes overlay.sh clone with the source container's overlay", func() {
+			rootfs, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("clone:///source-id"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rootfs).Should(Equal("/some/overlays/path/some-id/rootfs"))
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/some/bin/path/overlay.sh",
+					Args: []string{"clone", "/some/overlays/path/some-id", "/some/overlays/path/source-id"},
+					Env: []string{
+						"OVERLAY_BACKEND=overlay",
+						"PATH=" + os.Getenv("PATH"),
+					},
+				},
+			))
+		})
+
+		for _, source := range []string{"clone:///", "clone:///..", "clone:///some/../../etc"} {
+			source := source
+
+			Context("when the source is "+source, func() {
+				It("returns an InvalidCloneSourceError", func() {
+					_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL(source))
+					Ω(err).Should(BeAssignableToTypeOf(InvalidCloneSourceError{}))
+
+					Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+				})
+			})
+		}
+
+		It("cleans up like any other overlay", func() {
+			err := provider.CleanupRootFS(logger, "some-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/some/bin/path/overlay.sh",
+					Args: []string{"cleanup", "/some/overlays/path/some-id"},
+				},
+			))
+		})
+	})
 })
@@ -4,9 +4,24 @@ import (
 	"net/url"
 
 	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher"
 )
 
+// RootFSProvider provides each container's rootfs. Providers never copy or
+// chown a base rootfs, as containers do not use user namespaces: the overlay
+// provider mounts a copy-on-write layer over the base in place, and the docker
+// provider shares the layers in its graph, which is already a cache of images
+// with its own cleanup. There is therefore nothing to cache between creates.
 type RootFSProvider interface {
 	ProvideRootFS(logger lager.Logger, id string, rootfs *url.URL) (mountpoint string, envvar []string, err error)
 	CleanupRootFS(logger lager.Logger, id string) error
 }
+
+// ImageConfigProvider is implemented by providers whose rootfses come from
+// images that say how their processes should be run, i.e. docker images. A
+// container's image config is available from when its rootfs is provided
+// until it is cleaned up.
+type ImageConfigProvider interface {
+	ImageConfig(id string) (repository_fetcher.ImageConfig, bool)
+}
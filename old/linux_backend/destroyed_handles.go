@@ -0,0 +1,57 @@
+package linux_backend
+
+// maxDestroyedHandles bounds how many destroyed handles are remembered
+const maxDestroyedHandles = 1024
+
+// destroyedHandles remembers the handles of the containers destroyed most
+// recently, so that a destroy retried after it succeeded, e.g. because the
+// client lost the response, succeeds again rather than failing as unknown.
+//
+// It is guarded by the backend's containersMutex.
+type destroyedHandles struct {
+	handles map[string]struct{}
+
+	// oldest first
+	order []string
+}
+
+func newDestroyedHandles() *destroyedHandles {
+	return &destroyedHandles{
+		handles: make(map[string]struct{}),
+	}
+}
+
+func (d *destroyedHandles) add(handle string) {
+	if _, found := d.handles[handle]; found {
+		return
+	}
+
+	if len(d.order) == maxDestroyedHandles {
+		delete(d.handles, d.order[0])
+		d.order = d.order[1:]
+	}
+
+	d.handles[handle] = struct{}{}
+	d.order = append(d.order, handle)
+}
+
+// remove forgets a handle that has been created again
+func (d *destroyedHandles) remove(handle string) {
+	if _, found := d.handles[handle]; !found {
+		return
+	}
+
+	delete(d.handles, handle)
+
+	for i, destroyed := range d.order {
+		if destroyed == handle {
+			d.order = append(d.order[:i], d.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (d *destroyedHandles) contains(handle string) bool {
+	_, found := d.handles[handle]
+	return found
+}
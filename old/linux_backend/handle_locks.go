@@ -0,0 +1,53 @@
+package linux_backend
+
+import "sync"
+
+// handleLocks serializes operations on the same handle, e.g. a create and a
+// destroy racing each other, without serializing operations on different
+// handles. A handle's lock is only kept while it is held or waited for.
+type handleLocks struct {
+	mutex sync.Mutex
+	locks map[string]*handleLock
+}
+
+type handleLock struct {
+	sync.Mutex
+
+	// the number of holders and waiters
+	refs int
+}
+
+func newHandleLocks() *handleLocks {
+	return &handleLocks{
+		locks: make(map[string]*handleLock),
+	}
+}
+
+func (l *handleLocks) Lock(handle string) {
+	l.mutex.Lock()
+
+	lock, found := l.locks[handle]
+	if !found {
+		lock = new(handleLock)
+		l.locks[handle] = lock
+	}
+
+	lock.refs++
+
+	l.mutex.Unlock()
+
+	lock.Lock()
+}
+
+func (l *handleLocks) Unlock(handle string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	lock := l.locks[handle]
+	lock.Unlock()
+
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, handle)
+	}
+}
@@ -0,0 +1,111 @@
+package iptables_queue
+
+import (
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+)
+
+type priority int
+
+const (
+	normal priority = iota
+
+	// removing rules frees what they held, e.g. ports, and tends to be on
+	// the way to destroying a container
+	urgent
+)
+
+// the net.sh commands that read or change iptables, and whether they remove
+// rules; the others, e.g. dns, never wait behind them
+var netCommands = map[string]priority{
+	"setup":               normal,
+	"in":                  normal,
+	"out":                 normal,
+	"stats":               normal,
+	"sweep":               normal,
+	"chains":              normal,
+	"refresh_external_ip": normal,
+
+	"teardown":   urgent,
+	"remove_in":  urgent,
+	"remove_out": urgent,
+}
+
+// Runner runs the commands that read or change iptables one at a time,
+// rather than have many at once contend for the xtables lock as containers
+// churn, with those removing rules ahead of the rest. Any other command is
+// run straight away.
+//
+// Only Run is queued; commands started in the background are not waited
+// for, so are never queued.
+type Runner struct {
+	command_runner.CommandRunner
+
+	cond *sync.Cond
+
+	running bool
+	waiting map[priority]int
+}
+
+func New(runner command_runner.CommandRunner) *Runner {
+	return &Runner{
+		CommandRunner: runner,
+
+		cond:    sync.NewCond(new(sync.Mutex)),
+		waiting: make(map[priority]int),
+	}
+}
+
+func (r *Runner) Run(cmd *exec.Cmd) error {
+	priority, queued := commandPriority(cmd)
+	if !queued {
+		return r.CommandRunner.Run(cmd)
+	}
+
+	r.acquire(priority)
+	defer r.release()
+
+	return r.CommandRunner.Run(cmd)
+}
+
+func (r *Runner) acquire(priority priority) {
+	r.cond.L.Lock()
+	defer r.cond.L.Unlock()
+
+	r.waiting[priority]++
+
+	for r.running || (priority == normal && r.waiting[urgent] > 0) {
+		r.cond.Wait()
+	}
+
+	r.waiting[priority]--
+	r.running = true
+}
+
+func (r *Runner) release() {
+	r.cond.L.Lock()
+	defer r.cond.L.Unlock()
+
+	r.running = false
+	r.cond.Broadcast()
+}
+
+func commandPriority(cmd *exec.Cmd) (priority, bool) {
+	switch filepath.Base(cmd.Path) {
+	case "iptables", "iptables-restore":
+		return normal, true
+
+	case "net.sh":
+		if len(cmd.Args) < 2 {
+			return normal, false
+		}
+
+		priority, found := netCommands[cmd.Args[1]]
+		return priority, found
+	}
+
+	return normal, false
+}
@@ -0,0 +1,13 @@
+package iptables_queue_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestIptablesQueue(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "IPTables Queue Suite")
+}
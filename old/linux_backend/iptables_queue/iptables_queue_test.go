@@ -0,0 +1,111 @@
+package iptables_queue_test
+
+import (
+	"os/exec"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/iptables_queue"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+)
+
+var _ = Describe("IPTables queue", func() {
+	var fakeRunner *fake_command_runner.FakeCommandRunner
+	var runner *iptables_queue.Runner
+
+	// the net.sh commands run so far, which block until released
+	var running chan string
+	var release chan struct{}
+
+	BeforeEach(func() {
+		fakeRunner = fake_command_runner.New()
+		runner = iptables_queue.New(fakeRunner)
+
+		running = make(chan string, 10)
+		release = make(chan struct{})
+
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: "/depot/some-id/net.sh",
+		}, func(cmd *exec.Cmd) error {
+			running <- cmd.Args[1]
+			<-release
+			return nil
+		})
+	})
+
+	AfterEach(func() {
+		close(release)
+	})
+
+	runInBackground := func(command string) {
+		go runner.Run(exec.Command("/depot/some-id/net.sh", command))
+	}
+
+	It("runs the commands that change rules one at a time", func() {
+		runInBackground("in")
+		Eventually(running).Should(Receive(Equal("in")))
+
+		runInBackground("out")
+		Consistently(running).ShouldNot(Receive())
+
+		release <- struct{}{}
+		Eventually(running).Should(Receive(Equal("out")))
+	})
+
+	It("runs removals ahead of the rest", func() {
+		runInBackground("in")
+		Eventually(running).Should(Receive(Equal("in")))
+
+		runInBackground("out")
+		Consistently(running).ShouldNot(Receive())
+
+		runInBackground("teardown")
+		Consistently(running).ShouldNot(Receive())
+
+		release <- struct{}{}
+		Eventually(running).Should(Receive(Equal("teardown")))
+
+		release <- struct{}{}
+		Eventually(running).Should(Receive(Equal("out")))
+	})
+
+	It("runs commands that do not touch iptables straight away", func() {
+		runInBackground("in")
+		Eventually(running).Should(Receive(Equal("in")))
+
+		runInBackground("dns")
+		Eventually(running).Should(Receive(Equal("dns")))
+	})
+
+	It("queues iptables itself", func() {
+		iptablesRan := make(chan struct{})
+
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: "iptables",
+		}, func(*exec.Cmd) error {
+			close(iptablesRan)
+			return nil
+		})
+
+		runInBackground("in")
+		Eventually(running).Should(Receive(Equal("in")))
+
+		go runner.Run(exec.Command("iptables", "-w", "-F", "some-chain"))
+		Consistently(iptablesRan).ShouldNot(BeClosed())
+
+		release <- struct{}{}
+		Eventually(iptablesRan).Should(BeClosed())
+	})
+
+	It("returns the command's error", func() {
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: "iptables",
+		}, func(*exec.Cmd) error {
+			return exec.ErrNotFound
+		})
+
+		err := runner.Run(exec.Command("iptables", "-w", "-S"))
+		Ω(err).Should(Equal(exec.ErrNotFound))
+	})
+})
@@ -1,14 +1,20 @@
 package linux_backend
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/cloudfoundry-incubator/garden-linux/old/clock"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider"
 	"github.com/cloudfoundry-incubator/garden-linux/old/system_info"
 	"github.com/cloudfoundry-incubator/garden/api"
 	"github.com/pivotal-golang/lager"
@@ -24,13 +30,19 @@ type Container interface {
 	Snapshot(io.Writer) error
 	Cleanup()
 
+	// OnChange has the container call changed whenever its snapshot would
+	// differ other than in its processes, e.g. after NetIn; it is called
+	// before the container is used
+	OnChange(changed func())
+
 	api.Container
 }
 
 type ContainerPool interface {
 	Setup() error
-	Create(api.ContainerSpec) (Container, error)
+	CreateWithRootFS(spec api.ContainerSpec, provider rootfs_provider.RootFSProvider, cancelled <-chan struct{}) (Container, error)
 	Restore(io.Reader) (Container, error)
+	Started(Container)
 	Destroy(Container) error
 	Prune(keep map[string]bool) error
 	MaxContainers() int
@@ -45,6 +57,38 @@ type LinuxBackend struct {
 
 	containers      map[string]Container
 	containersMutex *sync.RWMutex
+
+	// the handles of the containers with each property
+	properties *propertyIndex
+
+	// the handles of the containers destroyed most recently
+	destroyed *destroyedHandles
+
+	// held for a handle while it is being created, destroyed or looked up,
+	// so that each sees the others either not yet started or finished
+	handleLocks *handleLocks
+
+	// creates in flight, which destroying their handle cancels
+	operations *operations
+
+	draining bool
+
+	// how often the snapshot is saved while running, if it changed; see
+	// SnapshotEvery
+	snapshotInterval   time.Duration
+	snapshotClock      clock.Clock
+	snapshotsDirty     chan struct{}
+	snapshotMutex      *sync.Mutex
+	stopSnapshotter    chan struct{}
+	snapshotterStopped chan struct{}
+}
+
+// operator is a container whose own operations, e.g. streaming in, can be
+// listed and cancelled
+type operator interface {
+	Operations() []Operation
+	CancelOperation(id string) bool
+	CancelOperations()
 }
 
 type UnknownHandleError struct {
@@ -55,6 +99,25 @@ func (e UnknownHandleError) Error() string {
 	return "unknown handle: " + e.Handle
 }
 
+type UnknownPropertyError struct {
+	Key   string
+	Value string
+}
+
+func (e UnknownPropertyError) Error() string {
+	return fmt.Sprintf("no container has property %s=%s", e.Key, e.Value)
+}
+
+type AmbiguousPropertyError struct {
+	Key     string
+	Value   string
+	Handles []string
+}
+
+func (e AmbiguousPropertyError) Error() string {
+	return fmt.Sprintf("%d containers have property %s=%s", len(e.Handles), e.Key, e.Value)
+}
+
 type HandleExistsError struct {
 	Handle string
 }
@@ -63,6 +126,32 @@ func (e HandleExistsError) Error() string {
 	return fmt.Sprintf("handle already exists: %s", e.Handle)
 }
 
+// StartFailedError is returned when a created container fails to start.
+// The container is destroyed before it is returned, so creating it again
+// may succeed.
+type StartFailedError struct {
+	Handle string
+	Err    error
+}
+
+func (e StartFailedError) Error() string {
+	return fmt.Sprintf("failed to start container %s: %s", e.Handle, e.Err)
+}
+
+// IdempotencyKeyReusedError is returned when a create gives the idempotency
+// key of an existing container but a different handle, i.e. the key was
+// reused rather than the create retried.
+type IdempotencyKeyReusedError struct {
+	Key    string
+	Handle string
+}
+
+func (e IdempotencyKeyReusedError) Error() string {
+	return fmt.Sprintf("idempotency key %s was used to create %s", e.Key, e.Handle)
+}
+
+var ErrDraining = errors.New("backend is draining; not accepting new containers")
+
 type FailedToSnapshotError struct {
 	OriginalError error
 }
@@ -71,6 +160,18 @@ func (e FailedToSnapshotError) Error() string {
 	return fmt.Sprintf("failed to save snapshot: %s", e.OriginalError)
 }
 
+type UnsupportedSnapshotVersionError struct {
+	Version int
+}
+
+func (e UnsupportedSnapshotVersionError) Error() string {
+	return fmt.Sprintf("unsupported snapshot version: %d (expected %d)", e.Version, SnapshotVersion)
+}
+
+// the backend's snapshot within the snapshots directory; anything else in it
+// is a snapshot of a single container, saved by older versions
+const backendSnapshotFile = "backend.json"
+
 func New(logger lager.Logger, containerPool ContainerPool, systemInfo system_info.Provider, snapshotsPath string) *LinuxBackend {
 	return &LinuxBackend{
 		logger: logger.Session("backend"),
@@ -80,7 +181,15 @@ func New(logger lager.Logger, containerPool ContainerPool, systemInfo system_inf
 		snapshotsPath: snapshotsPath,
 
 		containers:      make(map[string]Container),
+		properties:      newPropertyIndex(),
+		destroyed:       newDestroyedHandles(),
 		containersMutex: new(sync.RWMutex),
+
+		handleLocks: newHandleLocks(),
+
+		operations: newOperations(),
+
+		snapshotMutex: new(sync.Mutex),
 	}
 }
 
@@ -92,7 +201,11 @@ func (b *LinuxBackend) Start() error {
 	if b.snapshotsPath != "" {
 		_, err := os.Stat(b.snapshotsPath)
 		if err == nil {
-			b.restoreSnapshots()
+			err = b.restoreSnapshots()
+			if err != nil {
+				return err
+			}
+
 			os.RemoveAll(b.snapshotsPath)
 		}
 
@@ -100,6 +213,12 @@ func (b *LinuxBackend) Start() error {
 		if err != nil {
 			return err
 		}
+
+		// the snapshot just restored from is gone, so save it again rather
+		// than have nothing to restore after a crash until the next change
+		if b.snapshotInterval > 0 {
+			b.flushSnapshot()
+		}
 	}
 
 	keep := map[string]bool{}
@@ -112,7 +231,14 @@ func (b *LinuxBackend) Start() error {
 		keep[container.ID()] = true
 	}
 
-	return b.containerPool.Prune(keep)
+	err := b.containerPool.Prune(keep)
+	if err != nil {
+		return err
+	}
+
+	b.startSnapshotting()
+
+	return nil
 }
 
 func (b *LinuxBackend) Ping() error {
@@ -138,39 +264,163 @@ func (b *LinuxBackend) Capacity() (api.Capacity, error) {
 }
 
 func (b *LinuxBackend) Create(spec api.ContainerSpec) (api.Container, error) {
-	if spec.Handle != "" {
-		b.containersMutex.RLock()
-		_, exists := b.containers[spec.Handle]
-		b.containersMutex.RUnlock()
+	return b.CreateWithRootFS(spec, nil)
+}
 
-		if exists {
-			return nil, HandleExistsError{Handle: spec.Handle}
+// CreateWithRootFS creates a container like Create, but with its rootfs
+// provided by provider rather than the provider spec.RootFSPath names, for
+// rootfses the garden API mustn't be able to ask for; see
+// container_pool.LinuxContainerPool.CreateWithRootFS.
+func (b *LinuxBackend) CreateWithRootFS(spec api.ContainerSpec, provider rootfs_provider.RootFSProvider) (api.Container, error) {
+	// a retry waits for the create it retries, even one still in flight
+	key := spec.Properties[IdempotencyKeyProperty]
+	if key != "" {
+		b.handleLocks.Lock(idempotencyLock(key))
+		defer b.handleLocks.Unlock(idempotencyLock(key))
+
+		existing, found := b.createdWithKey(key)
+		if found {
+			if spec.Handle != "" && spec.Handle != existing.Handle() {
+				return nil, IdempotencyKeyReusedError{Key: key, Handle: existing.Handle()}
+			}
+
+			return existing, nil
 		}
 	}
 
-	container, err := b.containerPool.Create(spec)
+	op, err := b.operations.start("create", spec.Handle, spec.Properties[RequestIDProperty])
 	if err != nil {
 		return nil, err
 	}
 
-	err = container.Start()
+	defer b.operations.finish(op)
+
+	// containers without a handle are given their unique ID as one
+	if spec.Handle != "" {
+		b.handleLocks.Lock(spec.Handle)
+		defer b.handleLocks.Unlock(spec.Handle)
+	}
+
+	b.containersMutex.RLock()
+	draining := b.draining
+	_, exists := b.containers[spec.Handle]
+	b.containersMutex.RUnlock()
+
+	if draining {
+		return nil, ErrDraining
+	}
+
+	if spec.Handle != "" && exists {
+		return nil, HandleExistsError{Handle: spec.Handle}
+	}
+
+	started := time.Now()
+
+	container, err := b.containerPool.CreateWithRootFS(spec, provider, op.Cancelled())
 	if err != nil {
 		return nil, err
 	}
 
+	if !op.IsCancelled() {
+		err = container.Start()
+		if err != nil {
+			// the container isn't tracked yet, so nothing else would ever
+			// release what was acquired for it
+			destroyErr := b.containerPool.Destroy(container)
+			if destroyErr != nil {
+				b.logger.Error("failed-to-destroy-unstarted-container", destroyErr, lager.Data{
+					"handle": container.Handle(),
+				})
+			}
+
+			return nil, StartFailedError{Handle: container.Handle(), Err: err}
+		}
+	}
+
+	if op.IsCancelled() {
+		err := b.containerPool.Destroy(container)
+		if err != nil {
+			b.logger.Error("failed-to-destroy-cancelled-container", err, lager.Data{
+				"handle": container.Handle(),
+			})
+		}
+
+		return nil, OperationCancelledError{"create", container.Handle()}
+	}
+
+	ReportDuration(b.logger.Session("create", lager.Data{
+		"handle": container.Handle(),
+	}), CreateDuration, started)
+
+	b.containerPool.Started(container)
+
+	container.OnChange(b.snapshotChanged)
+
 	b.containersMutex.Lock()
 	b.containers[container.Handle()] = container
+	b.properties.add(container.Handle(), container.Properties())
+	b.destroyed.remove(container.Handle())
 	b.containersMutex.Unlock()
 
+	b.snapshotChanged()
+
 	return container, nil
 }
 
+// idempotencyLock is the handle lock held by creates with the key; keys and
+// handles are kept apart by a prefix that handles can't have
+func idempotencyLock(key string) string {
+	return "\x00idempotency-key:" + key
+}
+
+func (b *LinuxBackend) createdWithKey(key string) (Container, bool) {
+	b.containersMutex.RLock()
+	defer b.containersMutex.RUnlock()
+
+	handles := b.properties.lookup(api.Properties{IdempotencyKeyProperty: key})
+	if len(handles) == 0 {
+		return nil, false
+	}
+
+	return b.containers[handles[0]], true
+}
+
 func (b *LinuxBackend) Destroy(handle string) error {
+	// rather than waiting for a create of the handle to finish, or racing a
+	// stream in to the container, cancel them
+	cancelledCreate := b.operations.cancelHandle(handle)
+
 	b.containersMutex.RLock()
 	container, found := b.containers[handle]
 	b.containersMutex.RUnlock()
 
+	if found {
+		if operator, ok := container.(operator); ok {
+			operator.CancelOperations()
+		}
+	}
+
+	b.handleLocks.Lock(handle)
+	defer b.handleLocks.Unlock(handle)
+
+	b.containersMutex.RLock()
+	container, found = b.containers[handle]
+	b.containersMutex.RUnlock()
+
 	if !found {
+		if cancelledCreate {
+			// the create cleaned up after itself
+			return nil
+		}
+
+		b.containersMutex.RLock()
+		destroyed := b.destroyed.contains(handle)
+		b.containersMutex.RUnlock()
+
+		if destroyed {
+			return nil
+		}
+
 		return UnknownHandleError{handle}
 	}
 
@@ -181,8 +431,12 @@ func (b *LinuxBackend) Destroy(handle string) error {
 
 	b.containersMutex.Lock()
 	delete(b.containers, container.Handle())
+	b.properties.remove(container.Handle(), container.Properties())
+	b.destroyed.add(container.Handle())
 	b.containersMutex.Unlock()
 
+	b.snapshotChanged()
+
 	return nil
 }
 
@@ -190,16 +444,80 @@ func (b *LinuxBackend) Containers(filter api.Properties) (containers []api.Conta
 	b.containersMutex.RLock()
 	defer b.containersMutex.RUnlock()
 
-	for _, container := range b.containers {
-		if containerHasProperties(container, filter) {
+	if len(filter) == 0 {
+		for _, container := range b.containers {
 			containers = append(containers, container)
 		}
+
+		return containers, nil
+	}
+
+	for _, handle := range b.properties.lookup(filter) {
+		containers = append(containers, b.containers[handle])
 	}
 
 	return containers, nil
 }
 
+// LookupByProperty returns the only container with the property, e.g. an
+// orchestrator's identifier for it.
+func (b *LinuxBackend) LookupByProperty(key, value string) (api.Container, error) {
+	b.containersMutex.RLock()
+	defer b.containersMutex.RUnlock()
+
+	handles := b.properties.lookup(api.Properties{key: value})
+
+	switch len(handles) {
+	case 0:
+		return nil, UnknownPropertyError{key, value}
+	case 1:
+		return b.containers[handles[0]], nil
+	default:
+		sort.Strings(handles)
+		return nil, AmbiguousPropertyError{key, value, handles}
+	}
+}
+
+// Operations returns the creates in flight, and the operations in flight on
+// each container, oldest first.
+func (b *LinuxBackend) Operations() []Operation {
+	ops := b.operations.list()
+
+	b.containersMutex.RLock()
+	defer b.containersMutex.RUnlock()
+
+	for _, container := range b.containers {
+		if operator, ok := container.(operator); ok {
+			ops = append(ops, operator.Operations()...)
+		}
+	}
+
+	return sortOperations(ops)
+}
+
+// CancelOperation cancels the operation in flight with the given ID. A
+// cancelled create cleans up after itself, as if it had failed.
+func (b *LinuxBackend) CancelOperation(id string) error {
+	if b.operations.cancel(id) {
+		return nil
+	}
+
+	b.containersMutex.RLock()
+	defer b.containersMutex.RUnlock()
+
+	for _, container := range b.containers {
+		if operator, ok := container.(operator); ok && operator.CancelOperation(id) {
+			return nil
+		}
+	}
+
+	return UnknownOperationError{id}
+}
+
 func (b *LinuxBackend) Lookup(handle string) (api.Container, error) {
+	b.handleLocks.Lock(handle)
+	defer b.handleLocks.Unlock(handle)
+
 	b.containersMutex.RLock()
 	defer b.containersMutex.RUnlock()
 
@@ -215,33 +533,134 @@ func (b *LinuxBackend) GraceTime(container api.Container) time.Duration {
 	return container.(Container).GraceTime()
 }
 
-func (b *LinuxBackend) Stop() {
+// Drain stops the backend from creating any more containers, so that the
+// daemon can be stopped once in-flight requests finish without having to
+// destroy containers created in the meantime. Existing containers are
+// unaffected. If the snapshot is saved while running, changes waiting for
+// the next interval are saved straight away.
+func (b *LinuxBackend) Drain() {
+	b.containersMutex.Lock()
+	b.draining = true
+	b.containersMutex.Unlock()
+
+	b.logger.Info("draining")
+
+	if b.snapshotInterval > 0 {
+		b.flushSnapshot()
+	}
+}
+
+// Draining returns whether the backend has been told to drain.
+func (b *LinuxBackend) Draining() bool {
 	b.containersMutex.RLock()
 	defer b.containersMutex.RUnlock()
 
-	for _, container := range b.containers {
-		container.Cleanup()
-		err := b.saveSnapshot(container)
+	return b.draining
+}
+
+func (b *LinuxBackend) Stop() {
+	b.stopSnapshotting()
+
+	b.snapshotMutex.Lock()
+	defer b.snapshotMutex.Unlock()
+
+	err := b.saveSnapshot(b.currentSnapshot(true))
+	if err != nil {
+		b.logger.Error("failed-to-save-snapshot", err)
+	}
+}
+
+// restoreSnapshots restores every container in the snapshot, first
+// migrating it from the version that saved it. Failing to restore a single
+// container only loses that container, but if the snapshot as a whole cannot
+// be read or migrated, nothing is restored and an error is returned, so that
+// the containers are not pruned.
+func (b *LinuxBackend) restoreSnapshots() error {
+	sLog := b.logger.Session("restore")
+
+	snapshot, err := b.loadSnapshot(sLog)
+	if err != nil {
+		return err
+	}
+
+	if snapshot.Version != SnapshotVersion {
+		from := snapshot.Version
+
+		snapshot, err = migrateSnapshot(snapshot)
 		if err != nil {
-			b.logger.Error("failed-to-save-snapshot", err, lager.Data{
-				"container": container.ID(),
-			})
+			sLog.Error("failed-to-migrate", err)
+			return err
 		}
+
+		sLog.Info("migrated", lager.Data{
+			"from": from,
+			"to":   snapshot.Version,
+		})
 	}
+
+	for _, containerSnapshot := range snapshot.Containers {
+		_, err := b.restore(bytes.NewReader(containerSnapshot))
+		if err != nil {
+			sLog.Error("failed-to-restore", err)
+		}
+	}
+
+	b.containersMutex.Lock()
+	for _, handle := range snapshot.DestroyedHandles {
+		b.destroyed.add(handle)
+	}
+	b.containersMutex.Unlock()
+
+	return nil
 }
 
-func (b *LinuxBackend) restoreSnapshots() {
-	sLog := b.logger.Session("restore")
+// loadSnapshot reads the backend's snapshot, or the per-container snapshots
+// saved by versions before BackendSnapshot as a version 0 snapshot
+func (b *LinuxBackend) loadSnapshot(sLog lager.Logger) (BackendSnapshot, error) {
+	file, err := os.Open(path.Join(b.snapshotsPath, backendSnapshotFile))
+	if os.IsNotExist(err) {
+		return b.loadContainerSnapshots(sLog)
+	}
+
+	if err != nil {
+		sLog.Error("failed-to-open", err)
+		return BackendSnapshot{}, err
+	}
+
+	defer file.Close()
+
+	var snapshot BackendSnapshot
+
+	err = json.NewDecoder(file).Decode(&snapshot)
+	if err != nil {
+		sLog.Error("failed-to-decode", err)
+		return BackendSnapshot{}, err
+	}
+
+	return snapshot, nil
+}
+
+// loadContainerSnapshots reads the per-container snapshot files. Any that
+// cannot be read are reported together, rather than their containers being
+// silently lost.
+func (b *LinuxBackend) loadContainerSnapshots(sLog lager.Logger) (BackendSnapshot, error) {
+	snapshot := BackendSnapshot{Version: 0}
 
 	entries, err := ioutil.ReadDir(b.snapshotsPath)
 	if err != nil {
-		b.logger.Error("failed-to-read-snapshots", err, lager.Data{
+		sLog.Error("failed-to-read-snapshots", err, lager.Data{
 			"from": b.snapshotsPath,
 		})
+
+		return BackendSnapshot{}, err
 	}
 
+	problems := []string{}
+
 	for _, entry := range entries {
-		snapshot := path.Join(b.snapshotsPath, entry.Name())
+		if entry.Name() == backendSnapshotFile+".tmp" {
+			continue
+		}
 
 		lLog := sLog.Session("load", lager.Data{
 			"snapshot": entry.Name(),
@@ -249,40 +668,72 @@ func (b *LinuxBackend) restoreSnapshots() {
 
 		lLog.Debug("loading")
 
-		file, err := os.Open(snapshot)
-		if err != nil {
-			lLog.Error("failed-to-open", err)
+		containerSnapshot, err := ioutil.ReadFile(path.Join(b.snapshotsPath, entry.Name()))
+		if err == nil {
+			err = json.Unmarshal(containerSnapshot, new(json.RawMessage))
 		}
 
-		_, err = b.restore(file)
 		if err != nil {
-			lLog.Error("failed-to-restore", err)
+			lLog.Error("failed-to-load", err)
+			problems = append(problems, fmt.Sprintf("%s: %s", entry.Name(), err))
+			continue
+		}
+
+		snapshot.Containers = append(snapshot.Containers, containerSnapshot)
+	}
+
+	if len(problems) > 0 {
+		return BackendSnapshot{}, SnapshotMigrationError{
+			From:     0,
+			To:       1,
+			Problems: problems,
 		}
 	}
+
+	return snapshot, nil
 }
 
-func (b *LinuxBackend) saveSnapshot(container Container) error {
+// saveSnapshot writes the snapshot to a temporary file and renames it into
+// place, so that a partially written snapshot is never restored.
+func (b *LinuxBackend) saveSnapshot(snapshot BackendSnapshot) error {
 	if b.snapshotsPath == "" {
 		return nil
 	}
 
 	b.logger.Info("save-snapshot", lager.Data{
-		"container": container.ID(),
+		"containers": len(snapshot.Containers),
 	})
 
-	snapshotPath := path.Join(b.snapshotsPath, container.ID())
+	snapshotPath := path.Join(b.snapshotsPath, backendSnapshotFile)
+
+	file, err := os.Create(snapshotPath + ".tmp")
+	if err != nil {
+		return &FailedToSnapshotError{err}
+	}
+
+	err = json.NewEncoder(file).Encode(snapshot)
+	if err != nil {
+		file.Close()
+		return &FailedToSnapshotError{err}
+	}
 
-	snapshot, err := os.Create(snapshotPath)
+	err = file.Sync()
 	if err != nil {
+		file.Close()
 		return &FailedToSnapshotError{err}
 	}
 
-	err = container.Snapshot(snapshot)
+	err = file.Close()
 	if err != nil {
 		return &FailedToSnapshotError{err}
 	}
 
-	return snapshot.Close()
+	err = os.Rename(snapshotPath+".tmp", snapshotPath)
+	if err != nil {
+		return &FailedToSnapshotError{err}
+	}
+
+	return nil
 }
 
 func (b *LinuxBackend) restore(snapshot io.Reader) (api.Container, error) {
@@ -291,26 +742,12 @@ func (b *LinuxBackend) restore(snapshot io.Reader) (api.Container, error) {
 		return nil, err
 	}
 
+	container.OnChange(b.snapshotChanged)
+
 	b.containersMutex.Lock()
 	b.containers[container.Handle()] = container
+	b.properties.add(container.Handle(), container.Properties())
 	b.containersMutex.Unlock()
 
 	return container, nil
 }
-
-func containerHasProperties(container Container, properties api.Properties) bool {
-	containerProps := container.Properties()
-
-	for key, val := range properties {
-		cval, ok := containerProps[key]
-		if !ok {
-			return false
-		}
-
-		if cval != val {
-			return false
-		}
-	}
-
-	return true
-}
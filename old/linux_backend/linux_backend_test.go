@@ -1,6 +1,7 @@
 package linux_backend_test
 
 import (
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"os"
@@ -11,10 +12,13 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/pivotal-golang/lager/lagertest"
 
+	"github.com/cloudfoundry-incubator/garden-linux/old/clock/fake_clock"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/fake_container_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/system_info/fake_system_info"
 	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry/dropsonde/autowire/metrics"
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
 )
 
 var logger *lagertest.TestLogger
@@ -23,6 +27,15 @@ var _ = BeforeEach(func() {
 	logger = lagertest.NewTestLogger("test")
 })
 
+func logMessages() []string {
+	messages := []string{}
+	for _, log := range logger.Logs() {
+		messages = append(messages, log.Message)
+	}
+
+	return messages
+}
+
 var _ = Describe("Setup", func() {
 	var fakeContainerPool *fake_container_pool.FakeContainerPool
 	var fakeSystemInfo *fake_system_info.FakeProvider
@@ -99,7 +112,134 @@ var _ = Describe("Start", func() {
 		})
 	})
 
-	Describe("when snapshots are present", func() {
+	Describe("when a snapshot is present", func() {
+		var snapshotsPath string
+		var snapshot linux_backend.BackendSnapshot
+
+		BeforeEach(func() {
+			snapshotsPath = path.Join(tmpdir, "snapshots")
+
+			snapshot = linux_backend.BackendSnapshot{
+				Version: linux_backend.SnapshotVersion,
+				Containers: []json.RawMessage{
+					json.RawMessage(`"handle-a"`),
+					json.RawMessage(`"handle-b"`),
+				},
+			}
+		})
+
+		JustBeforeEach(func() {
+			err := os.MkdirAll(snapshotsPath, 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			file, err := os.Create(path.Join(snapshotsPath, "backend.json"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = json.NewEncoder(file).Encode(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			file.Close()
+		})
+
+		It("restores and registers each container, and keeps them when pruning", func() {
+			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath)
+
+			err := linuxBackend.Start()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeContainerPool.RestoredSnapshots).Should(HaveLen(2))
+
+			containers, err := linuxBackend.Containers(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(containers).Should(HaveLen(2))
+
+			Ω(fakeContainerPool.KeptContainers).Should(Equal(map[string]bool{
+				"handle-a": true,
+				"handle-b": true,
+			}))
+		})
+
+		Context("with the handles of destroyed containers", func() {
+			BeforeEach(func() {
+				snapshot.DestroyedHandles = []string{"handle-c"}
+			})
+
+			It("lets them be destroyed again", func() {
+				linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath)
+
+				err := linuxBackend.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = linuxBackend.Destroy("handle-c")
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		It("removes the snapshot", func() {
+			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath)
+
+			err := linuxBackend.Start()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = os.Stat(path.Join(snapshotsPath, "backend.json"))
+			Ω(err).Should(HaveOccurred())
+		})
+
+		Context("when the snapshot is of an unsupported version", func() {
+			BeforeEach(func() {
+				snapshot.Version = linux_backend.SnapshotVersion + 1
+			})
+
+			It("fails to start without restoring or pruning anything", func() {
+				linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath)
+
+				err := linuxBackend.Start()
+				Ω(err).Should(Equal(linux_backend.UnsupportedSnapshotVersionError{
+					Version: linux_backend.SnapshotVersion + 1,
+				}))
+
+				Ω(fakeContainerPool.RestoredSnapshots).Should(BeEmpty())
+				Ω(fakeContainerPool.Pruned).Should(BeFalse())
+
+				_, err = os.Stat(path.Join(snapshotsPath, "backend.json"))
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("when the snapshot is of an older version", func() {
+			BeforeEach(func() {
+				snapshot.Version = 0
+			})
+
+			It("migrates it before restoring each container", func() {
+				linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath)
+
+				err := linuxBackend.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeContainerPool.RestoredSnapshots).Should(HaveLen(2))
+
+				Ω(logMessages()).Should(ContainElement("test.backend.restore.migrated"))
+			})
+		})
+
+		Context("when restoring a container fails", func() {
+			BeforeEach(func() {
+				snapshot.Containers = append(snapshot.Containers, json.RawMessage(`{}`))
+			})
+
+			It("restores the rest", func() {
+				linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath)
+
+				err := linuxBackend.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeContainerPool.RestoredSnapshots).Should(HaveLen(2))
+			})
+		})
+	})
+
+	Describe("when per-container snapshots from an older version are present", func() {
 		var snapshotsPath string
 
 		BeforeEach(func() {
@@ -111,13 +251,13 @@ var _ = Describe("Start", func() {
 			file, err := os.Create(path.Join(snapshotsPath, "some-id"))
 			Ω(err).ShouldNot(HaveOccurred())
 
-			file.Write([]byte("handle-a"))
+			file.Write([]byte(`"handle-a"`))
 			file.Close()
 
 			file, err = os.Create(path.Join(snapshotsPath, "some-other-id"))
 			Ω(err).ShouldNot(HaveOccurred())
 
-			file.Write([]byte("handle-b"))
+			file.Write([]byte(`"handle-b"`))
 			file.Close()
 		})
 
@@ -172,6 +312,41 @@ var _ = Describe("Start", func() {
 			}))
 		})
 
+		It("migrates them to the current snapshot version", func() {
+			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath)
+
+			err := linuxBackend.Start()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(logMessages()).Should(ContainElement("test.backend.restore.migrated"))
+		})
+
+		Context("when one of them cannot be read", func() {
+			BeforeEach(func() {
+				err := ioutil.WriteFile(path.Join(snapshotsPath, "some-broken-id"), []byte(`{"Handle":`), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("fails to start with a report of it, without restoring or pruning anything", func() {
+				linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath)
+
+				err := linuxBackend.Start()
+				Ω(err).Should(BeAssignableToTypeOf(linux_backend.SnapshotMigrationError{}))
+
+				migrationErr := err.(linux_backend.SnapshotMigrationError)
+				Ω(migrationErr.From).Should(Equal(0))
+				Ω(migrationErr.To).Should(Equal(1))
+				Ω(migrationErr.Problems).Should(HaveLen(1))
+				Ω(migrationErr.Problems[0]).Should(HavePrefix("some-broken-id: "))
+
+				Ω(fakeContainerPool.RestoredSnapshots).Should(BeEmpty())
+				Ω(fakeContainerPool.Pruned).Should(BeFalse())
+
+				_, err = os.Stat(path.Join(snapshotsPath, "some-id"))
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+
 		Context("when restoring the container fails", func() {
 			disaster := errors.New("failed to restore")
 
@@ -219,16 +394,20 @@ var _ = Describe("Stop", func() {
 	var fakeSystemInfo *fake_system_info.FakeProvider
 	var linuxBackend *linux_backend.LinuxBackend
 
+	var snapshotsPath string
+
 	BeforeEach(func() {
 		tmpdir, err := ioutil.TempDir(os.TempDir(), "garden-server-test")
 		Ω(err).ShouldNot(HaveOccurred())
 
+		snapshotsPath = path.Join(tmpdir, "snapshots")
+
 		fakeContainerPool = fake_container_pool.New()
 		linuxBackend = linux_backend.New(
 			logger,
 			fakeContainerPool,
 			fakeSystemInfo,
-			path.Join(tmpdir, "snapshots"),
+			snapshotsPath,
 		)
 
 		err = linuxBackend.Start()
@@ -250,6 +429,47 @@ var _ = Describe("Stop", func() {
 		Ω(fakeContainer2.SavedSnapshots).Should(HaveLen(1))
 	})
 
+	It("saves the snapshots together in a versioned snapshot of the backend", func() {
+		_, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = linuxBackend.Create(api.ContainerSpec{Handle: "some-other-handle"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		linuxBackend.Stop()
+
+		file, err := os.Open(path.Join(snapshotsPath, "backend.json"))
+		Ω(err).ShouldNot(HaveOccurred())
+		defer file.Close()
+
+		var snapshot linux_backend.BackendSnapshot
+		err = json.NewDecoder(file).Decode(&snapshot)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(snapshot.Version).Should(Equal(linux_backend.SnapshotVersion))
+		Ω(snapshot.Containers).Should(HaveLen(2))
+	})
+
+	It("saves the handles of the containers destroyed most recently", func() {
+		_, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = linuxBackend.Destroy("some-handle")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		linuxBackend.Stop()
+
+		file, err := os.Open(path.Join(snapshotsPath, "backend.json"))
+		Ω(err).ShouldNot(HaveOccurred())
+		defer file.Close()
+
+		var snapshot linux_backend.BackendSnapshot
+		err = json.NewDecoder(file).Decode(&snapshot)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(snapshot.DestroyedHandles).Should(Equal([]string{"some-handle"}))
+	})
+
 	It("cleans up each container", func() {
 		container1, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
 		Ω(err).ShouldNot(HaveOccurred())
@@ -266,6 +486,166 @@ var _ = Describe("Stop", func() {
 	})
 })
 
+var _ = Describe("Snapshotting while running", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var fakeSystemInfo *fake_system_info.FakeProvider
+	var linuxBackend *linux_backend.LinuxBackend
+
+	var snapshotsPath string
+
+	savedSnapshot := func() linux_backend.BackendSnapshot {
+		var snapshot linux_backend.BackendSnapshot
+
+		file, err := os.Open(path.Join(snapshotsPath, "backend.json"))
+		if err != nil {
+			return snapshot
+		}
+
+		defer file.Close()
+
+		err = json.NewDecoder(file).Decode(&snapshot)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return snapshot
+	}
+
+	BeforeEach(func() {
+		tmpdir, err := ioutil.TempDir(os.TempDir(), "garden-server-test")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		snapshotsPath = path.Join(tmpdir, "snapshots")
+
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo = fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath)
+	})
+
+	AfterEach(func() {
+		linuxBackend.Stop()
+	})
+
+	Context("with an interval", func() {
+		var fakeClock *fake_clock.FakeClock
+
+		interval := time.Minute
+
+		// waits for the loop to wait on the clock, i.e. to finish saving
+		// the last interval's changes, then ends the interval
+		tick := func() {
+			Eventually(fakeClock.WatcherCount).Should(Equal(1))
+			fakeClock.Increment(interval)
+			Eventually(fakeClock.WatcherCount).Should(Equal(1))
+		}
+
+		BeforeEach(func() {
+			fakeClock = fake_clock.New(time.Unix(123, 456))
+
+			linuxBackend.SnapshotEvery(interval, fakeClock)
+
+			err := linuxBackend.Start()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("saves the snapshot straight away on start, as the one restored from is gone", func() {
+			_, err := os.Stat(path.Join(snapshotsPath, "backend.json"))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("saves the snapshot after creates and destroys, without waiting on them", func() {
+			_, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = linuxBackend.Create(api.ContainerSpec{Handle: "some-other-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(savedSnapshot().Containers).Should(BeEmpty())
+
+			tick()
+
+			Ω(savedSnapshot().Containers).Should(HaveLen(2))
+
+			err = linuxBackend.Destroy("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			tick()
+
+			Ω(savedSnapshot().DestroyedHandles).Should(Equal([]string{"some-handle"}))
+		})
+
+		It("saves each interval's changes once", func() {
+			container, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = linuxBackend.Create(api.ContainerSpec{Handle: "some-other-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeContainer := container.(*fake_container_pool.FakeContainer)
+
+			tick()
+			Ω(fakeContainer.SavedSnapshots).Should(HaveLen(1))
+
+			tick()
+			Ω(fakeContainer.SavedSnapshots).Should(HaveLen(1))
+		})
+
+		It("saves the snapshot after a container changes", func() {
+			container, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeContainer := container.(*fake_container_pool.FakeContainer)
+
+			tick()
+			Ω(fakeContainer.SavedSnapshots).Should(HaveLen(1))
+
+			fakeContainer.Changed()
+
+			tick()
+			Ω(fakeContainer.SavedSnapshots).Should(HaveLen(2))
+		})
+
+		It("doesn't clean up the containers", func() {
+			container, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			tick()
+
+			Ω(savedSnapshot().Containers).Should(HaveLen(1))
+
+			Ω(container.(*fake_container_pool.FakeContainer).CleanedUp).Should(BeFalse())
+		})
+
+		Context("when draining", func() {
+			It("saves changes straight away", func() {
+				_, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				linuxBackend.Drain()
+
+				Ω(savedSnapshot().Containers).Should(HaveLen(1))
+			})
+		})
+	})
+
+	Context("without an interval", func() {
+		BeforeEach(func() {
+			err := linuxBackend.Start()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("only saves the snapshot on stop", func() {
+			_, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			linuxBackend.Drain()
+
+			Consistently(func() error {
+				_, err := os.Stat(path.Join(snapshotsPath, "backend.json"))
+				return err
+			}, 100*time.Millisecond).Should(HaveOccurred())
+		})
+	})
+})
+
 var _ = Describe("Capacity", func() {
 	var fakeContainerPool *fake_container_pool.FakeContainerPool
 	var fakeSystemInfo *fake_system_info.FakeProvider
@@ -342,6 +722,26 @@ var _ = Describe("Create", func() {
 		Ω(container.(*fake_container_pool.FakeContainer).Started).Should(BeTrue())
 	})
 
+	It("tells the pool once the container has started, for its post-create hook", func() {
+		container, err := linuxBackend.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(fakeContainerPool.StartedContainers).Should(Equal([]linux_backend.Container{
+			container.(linux_backend.Container),
+		}))
+	})
+
+	It("reports how long it took to create and start the container", func() {
+		fakeMetricSender := fake.NewFakeMetricSender()
+		metrics.Initialize(fakeMetricSender)
+
+		_, err := linuxBackend.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(fakeMetricSender.GetValue(linux_backend.CreateDuration).Unit).Should(Equal("nanos"))
+		Ω(fakeMetricSender.GetValue(linux_backend.CreateDuration).Value).Should(BeNumerically(">", 0))
+	})
+
 	It("registers the container", func() {
 		container, err := linuxBackend.Create(api.ContainerSpec{})
 		Ω(err).ShouldNot(HaveOccurred())
@@ -368,6 +768,134 @@ var _ = Describe("Create", func() {
 		})
 	})
 
+	Context("when containers with the same handle are created concurrently", func() {
+		It("creates only one of them", func() {
+			creating := make(chan struct{})
+			release := make(chan struct{})
+
+			fakeContainerPool.ContainerSetup = func(*fake_container_pool.FakeContainer) {
+				creating <- struct{}{}
+				<-release
+			}
+
+			errs := make(chan error, 2)
+
+			go func() {
+				_, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+				errs <- err
+			}()
+
+			Eventually(creating).Should(Receive())
+
+			go func() {
+				_, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+				errs <- err
+			}()
+
+			Consistently(creating).ShouldNot(Receive())
+			close(release)
+
+			Eventually(errs).Should(Receive(BeNil()))
+			Eventually(errs).Should(Receive(Equal(linux_backend.HandleExistsError{Handle: "some-handle"})))
+
+			Ω(fakeContainerPool.CreatedContainers).Should(HaveLen(1))
+		})
+	})
+
+	Context("when created with an idempotency key", func() {
+		var spec api.ContainerSpec
+		var container api.Container
+
+		BeforeEach(func() {
+			spec = api.ContainerSpec{
+				Handle: "some-handle",
+				Properties: api.Properties{
+					linux_backend.IdempotencyKeyProperty: "some-key",
+				},
+			}
+
+			var err error
+			container, err = linuxBackend.Create(spec)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("returns the same container when retried", func() {
+			retried, err := linuxBackend.Create(spec)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(retried).Should(Equal(container))
+			Ω(fakeContainerPool.CreatedContainers).Should(HaveLen(1))
+		})
+
+		It("returns the same container when retried without a handle", func() {
+			spec.Handle = ""
+
+			retried, err := linuxBackend.Create(spec)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(retried).Should(Equal(container))
+		})
+
+		It("returns an error when the key is reused for another handle", func() {
+			spec.Handle = "some-other-handle"
+
+			_, err := linuxBackend.Create(spec)
+			Ω(err).Should(Equal(linux_backend.IdempotencyKeyReusedError{Key: "some-key", Handle: "some-handle"}))
+		})
+
+		It("creates a new container once the first is destroyed", func() {
+			err := linuxBackend.Destroy("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = linuxBackend.Create(spec)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeContainerPool.CreatedContainers).Should(HaveLen(2))
+		})
+	})
+
+	Context("when a create is retried while still in flight", func() {
+		It("waits for it and returns the container it created", func() {
+			creating := make(chan struct{}, 2)
+			release := make(chan struct{})
+
+			fakeContainerPool.CreateHook = func(api.ContainerSpec, <-chan struct{}) {
+				creating <- struct{}{}
+				<-release
+			}
+
+			spec := api.ContainerSpec{
+				Properties: api.Properties{
+					linux_backend.IdempotencyKeyProperty: "some-key",
+					linux_backend.RequestIDProperty:      "some-request",
+				},
+			}
+
+			containers := make(chan api.Container, 2)
+
+			for i := 0; i < 2; i++ {
+				go func() {
+					defer GinkgoRecover()
+
+					container, err := linuxBackend.Create(spec)
+					Ω(err).ShouldNot(HaveOccurred())
+					containers <- container
+				}()
+			}
+
+			Eventually(creating).Should(Receive())
+			Consistently(creating).ShouldNot(Receive())
+			close(release)
+
+			var first, second api.Container
+			Eventually(containers).Should(Receive(&first))
+			Eventually(containers).Should(Receive(&second))
+
+			Ω(first).Should(Equal(second))
+			Ω(fakeContainerPool.CreatedContainers).Should(HaveLen(1))
+		})
+	})
+
 	Context("when a container with the given handle already exists", func() {
 		It("returns a HandleExistsError", func() {
 			container, err := linuxBackend.Create(api.ContainerSpec{})
@@ -387,14 +915,20 @@ var _ = Describe("Create", func() {
 			}
 		})
 
-		It("returns the error", func() {
-			container, err := linuxBackend.Create(api.ContainerSpec{})
-			Ω(err).Should(HaveOccurred())
-			Ω(err).Should(Equal(disaster))
+		It("returns a retryable error", func() {
+			container, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+			Ω(err).Should(Equal(linux_backend.StartFailedError{Handle: "some-handle", Err: disaster}))
 
 			Ω(container).Should(BeNil())
 		})
 
+		It("doesn't tell the pool it started", func() {
+			_, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).Should(HaveOccurred())
+
+			Ω(fakeContainerPool.StartedContainers).Should(BeEmpty())
+		})
+
 		It("does not register the container", func() {
 			_, err := linuxBackend.Create(api.ContainerSpec{})
 			Ω(err).Should(HaveOccurred())
@@ -404,6 +938,171 @@ var _ = Describe("Create", func() {
 
 			Ω(containers).Should(BeEmpty())
 		})
+
+		It("destroys the container, releasing what was acquired for it", func() {
+			_, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+			Ω(err).Should(HaveOccurred())
+
+			Ω(fakeContainerPool.DestroyedContainers).Should(HaveLen(1))
+			Ω(fakeContainerPool.DestroyedContainers[0].Handle()).Should(Equal("some-handle"))
+		})
+
+		It("frees the handle to be created again", func() {
+			_, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+			Ω(err).Should(HaveOccurred())
+
+			fakeContainerPool.ContainerSetup = nil
+
+			_, err = linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("and destroying it fails too", func() {
+			BeforeEach(func() {
+				fakeContainerPool.DestroyError = errors.New("oh no!")
+			})
+
+			It("returns the error from starting it", func() {
+				_, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+				Ω(err).Should(Equal(linux_backend.StartFailedError{Handle: "some-handle", Err: disaster}))
+			})
+		})
+	})
+
+	Context("when the create is cancelled while in flight", func() {
+		var errs chan error
+
+		BeforeEach(func() {
+			creating := make(chan struct{})
+			errs = make(chan error, 1)
+
+			fakeContainerPool.CreateHook = func(spec api.ContainerSpec, cancelled <-chan struct{}) {
+				close(creating)
+				<-cancelled
+			}
+
+			go func() {
+				_, err := linuxBackend.Create(api.ContainerSpec{
+					Handle: "some-handle",
+					Properties: api.Properties{
+						linux_backend.RequestIDProperty: "some-request-id",
+					},
+				})
+
+				errs <- err
+			}()
+
+			Eventually(creating).Should(BeClosed())
+		})
+
+		It("lists it as in flight until then", func() {
+			operations := linuxBackend.Operations()
+			Ω(operations).Should(HaveLen(1))
+
+			Ω(operations[0].ID).Should(Equal("some-request-id"))
+			Ω(operations[0].Kind).Should(Equal("create"))
+			Ω(operations[0].Handle).Should(Equal("some-handle"))
+
+			err := linuxBackend.CancelOperation("some-request-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(errs).Should(Receive())
+			Ω(linuxBackend.Operations()).Should(BeEmpty())
+		})
+
+		It("destroys the container without starting or registering it, and returns an error", func() {
+			err := linuxBackend.CancelOperation("some-request-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(errs).Should(Receive(Equal(linux_backend.OperationCancelledError{
+				Kind:   "create",
+				Handle: "some-handle",
+			})))
+
+			Ω(fakeContainerPool.CreatedContainers).Should(HaveLen(1))
+			created := fakeContainerPool.CreatedContainers[0].(*fake_container_pool.FakeContainer)
+
+			Ω(created.Started).Should(BeFalse())
+			Ω(fakeContainerPool.DestroyedContainers).Should(ContainElement(created))
+
+			_, err = linuxBackend.Lookup("some-handle")
+			Ω(err).Should(Equal(linux_backend.UnknownHandleError{Handle: "some-handle"}))
+		})
+
+		Context("by destroying its handle", func() {
+			It("cancels it rather than waiting for it", func() {
+				err := linuxBackend.Destroy("some-handle")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Eventually(errs).Should(Receive(BeAssignableToTypeOf(linux_backend.OperationCancelledError{})))
+
+				_, err = linuxBackend.Lookup("some-handle")
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+
+		Context("when another create is given the same request id", func() {
+			It("returns an error", func() {
+				_, err := linuxBackend.Create(api.ContainerSpec{
+					Handle: "some-other-handle",
+					Properties: api.Properties{
+						linux_backend.RequestIDProperty: "some-request-id",
+					},
+				})
+				Ω(err).Should(Equal(linux_backend.OperationExistsError{ID: "some-request-id"}))
+
+				linuxBackend.CancelOperation("some-request-id")
+				Eventually(errs).Should(Receive())
+			})
+		})
+	})
+
+	Context("when cancelling an operation that is not in flight", func() {
+		It("returns UnknownOperationError", func() {
+			err := linuxBackend.CancelOperation("bogus-id")
+			Ω(err).Should(Equal(linux_backend.UnknownOperationError{ID: "bogus-id"}))
+		})
+	})
+})
+
+var _ = Describe("Drain", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "")
+	})
+
+	It("reports that it is draining", func() {
+		Ω(linuxBackend.Draining()).Should(BeFalse())
+
+		linuxBackend.Drain()
+
+		Ω(linuxBackend.Draining()).Should(BeTrue())
+	})
+
+	It("refuses to create any more containers", func() {
+		linuxBackend.Drain()
+
+		_, err := linuxBackend.Create(api.ContainerSpec{})
+		Ω(err).Should(Equal(linux_backend.ErrDraining))
+
+		Ω(fakeContainerPool.CreatedContainers).Should(BeEmpty())
+	})
+
+	It("keeps the existing containers", func() {
+		container, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		linuxBackend.Drain()
+
+		foundContainer, err := linuxBackend.Lookup("some-handle")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(foundContainer).Should(Equal(container))
+
+		Ω(fakeContainerPool.DestroyedContainers).Should(BeEmpty())
 	})
 })
 
@@ -442,6 +1141,58 @@ var _ = Describe("Destroy", func() {
 		Ω(err).Should(Equal(linux_backend.UnknownHandleError{container.Handle()}))
 	})
 
+	Context("when the container is destroyed concurrently", func() {
+		var destroying chan struct{}
+		var release chan struct{}
+		var errs chan error
+
+		BeforeEach(func() {
+			destroying = make(chan struct{}, 2)
+			release = make(chan struct{})
+			errs = make(chan error, 2)
+
+			fakeContainerPool.DestroyHook = func(linux_backend.Container) {
+				destroying <- struct{}{}
+				<-release
+			}
+
+			go func() {
+				errs <- linuxBackend.Destroy(container.Handle())
+			}()
+
+			Eventually(destroying).Should(Receive())
+		})
+
+		It("destroys it only once", func() {
+			go func() {
+				errs <- linuxBackend.Destroy(container.Handle())
+			}()
+
+			Consistently(destroying).ShouldNot(Receive())
+			close(release)
+
+			// the second destroy finds the container destroyed by the first
+			Eventually(errs).Should(Receive(BeNil()))
+			Eventually(errs).Should(Receive(BeNil()))
+
+			Ω(fakeContainerPool.DestroyedContainers).Should(HaveLen(1))
+		})
+
+		It("looks it up only once it has been destroyed", func() {
+			lookups := make(chan error, 1)
+
+			go func() {
+				_, err := linuxBackend.Lookup(container.Handle())
+				lookups <- err
+			}()
+
+			Consistently(lookups).ShouldNot(Receive())
+			close(release)
+
+			Eventually(lookups).Should(Receive(Equal(linux_backend.UnknownHandleError{Handle: container.Handle()})))
+		})
+	})
+
 	Context("when the container does not exist", func() {
 		It("returns UnknownHandleError", func() {
 			err := linuxBackend.Destroy("bogus-handle")
@@ -450,6 +1201,47 @@ var _ = Describe("Destroy", func() {
 		})
 	})
 
+	Context("when the container has already been destroyed", func() {
+		BeforeEach(func() {
+			err := linuxBackend.Destroy(container.Handle())
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("succeeds again, without destroying anything", func() {
+			err := linuxBackend.Destroy(container.Handle())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeContainerPool.DestroyedContainers).Should(HaveLen(1))
+		})
+
+		It("forgets it once enough other containers have been destroyed", func() {
+			for i := 0; i < 1024; i++ {
+				other, err := linuxBackend.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = linuxBackend.Destroy(other.Handle())
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			err := linuxBackend.Destroy(container.Handle())
+			Ω(err).Should(Equal(linux_backend.UnknownHandleError{Handle: container.Handle()}))
+		})
+
+		Context("and a container has been created with its handle again", func() {
+			BeforeEach(func() {
+				_, err := linuxBackend.Create(api.ContainerSpec{Handle: container.Handle()})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("destroys the new container", func() {
+				err := linuxBackend.Destroy(container.Handle())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeContainerPool.DestroyedContainers).Should(HaveLen(2))
+			})
+		})
+	})
+
 	Context("when destroying the container fails", func() {
 		disaster := errors.New("failed to destroy")
 
@@ -555,6 +1347,90 @@ var _ = Describe("Containers", func() {
 			Ω(containers).ShouldNot(ContainElement(container2))
 			Ω(containers).Should(ContainElement(container3))
 		})
+
+		It("does not return containers with a different value for a property", func() {
+			_, err := linuxBackend.Create(api.ContainerSpec{
+				Properties: api.Properties{"a": "b"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			containers, err := linuxBackend.Containers(api.Properties{"a": "c"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(containers).Should(BeEmpty())
+		})
+
+		It("does not return containers that have been destroyed", func() {
+			container, err := linuxBackend.Create(api.ContainerSpec{
+				Properties: api.Properties{"a": "b"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = linuxBackend.Destroy(container.Handle())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			containers, err := linuxBackend.Containers(api.Properties{"a": "b"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(containers).Should(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("LookupByProperty", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "")
+	})
+
+	It("returns the container with the property", func() {
+		container, err := linuxBackend.Create(api.ContainerSpec{
+			Properties: api.Properties{"guid": "some-guid"},
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = linuxBackend.Create(api.ContainerSpec{
+			Properties: api.Properties{"guid": "some-other-guid"},
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		foundContainer, err := linuxBackend.LookupByProperty("guid", "some-guid")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(foundContainer).Should(Equal(container))
+	})
+
+	Context("when no container has the property", func() {
+		It("returns UnknownPropertyError", func() {
+			_, err := linuxBackend.LookupByProperty("guid", "some-guid")
+			Ω(err).Should(Equal(linux_backend.UnknownPropertyError{
+				Key:   "guid",
+				Value: "some-guid",
+			}))
+		})
+	})
+
+	Context("when more than one container has the property", func() {
+		It("returns AmbiguousPropertyError", func() {
+			for _, handle := range []string{"handle-b", "handle-a"} {
+				_, err := linuxBackend.Create(api.ContainerSpec{
+					Handle:     handle,
+					Properties: api.Properties{"guid": "some-guid"},
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			_, err := linuxBackend.LookupByProperty("guid", "some-guid")
+			Ω(err).Should(Equal(linux_backend.AmbiguousPropertyError{
+				Key:     "guid",
+				Value:   "some-guid",
+				Handles: []string{"handle-a", "handle-b"},
+			}))
+		})
 	})
 })
 
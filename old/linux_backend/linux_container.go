@@ -2,13 +2,16 @@ package linux_backend
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -38,6 +41,9 @@ type LinuxContainer struct {
 	state      State
 	stateMutex sync.RWMutex
 
+	// guarded by stateMutex
+	preStopResult PreStopResult
+
 	events      []string
 	eventsMutex sync.RWMutex
 
@@ -74,7 +80,50 @@ type LinuxContainer struct {
 	netOuts      []NetOutSpec
 	netOutsMutex sync.RWMutex
 
+	resolver Resolver
+
+	// the networks allowed for each NetOut to a hostname, as last resolved
+	resolvedNetOuts map[NetOutSpec][]string
+
 	envvars []string
+
+	processDefaults ProcessDefaults
+
+	security Security
+
+	// streams in to the container that are in flight
+	operations *operations
+
+	// called after each change to what the container's snapshot would hold;
+	// see OnChange
+	onChange func()
+}
+
+// ProcessDefaults are how the container's image intended its processes to
+// be run, for what a process spec leaves unset.
+//
+// User applies to unprivileged processes when the garden.user property is
+// unset. Dir applies when the spec has no Dir. Entrypoint applies when the
+// spec has no Path, followed by the spec's Args, or Cmd if it has none, as
+// with docker run.
+//
+// The image's environment is already part of the container's, with the
+// process spec's own taking precedence.
+type ProcessDefaults struct {
+	User       string
+	Dir        string
+	Entrypoint []string
+	Cmd        []string
+}
+
+// Security is how the container's properties have it confined.
+type Security struct {
+	// whether it was created with properties weakening its isolation from
+	// the host
+	Privileged bool
+
+	// the capabilities removed from its processes' bounding set, sorted
+	DroppedCapabilities []string
 }
 
 type NetInSpec struct {
@@ -82,23 +131,258 @@ type NetInSpec struct {
 	ContainerPort uint32
 }
 
+type NetInNotFoundError struct {
+	HostPort      uint32
+	ContainerPort uint32
+}
+
+func (e NetInNotFoundError) Error() string {
+	return fmt.Sprintf("no port mapping from %d to %d", e.HostPort, e.ContainerPort)
+}
+
+type InvalidStateError struct {
+	State State
+}
+
+func (e InvalidStateError) Error() string {
+	return fmt.Sprintf("cannot do that to a container that is %s", e.State)
+}
+
+type NoAddressesError struct {
+	Hostname string
+}
+
+func (e NoAddressesError) Error() string {
+	return fmt.Sprintf("hostname %s has no IPv4 addresses", e.Hostname)
+}
+
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?$`)
+var letterPattern = regexp.MustCompile(`[a-zA-Z]`)
+
 type NetOutSpec struct {
 	Network string
 	Port    uint32
 }
 
+// ContainerNetworkStat is the container's network traffic since it was
+// created, from its point of view.
+type ContainerNetworkStat struct {
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxDropped uint64 `json:"rx_dropped"`
+
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxDropped uint64 `json:"tx_dropped"`
+
+	// sent off the host, rather than to the host or other containers
+	ForwardedBytes   uint64 `json:"forwarded_bytes"`
+	ForwardedPackets uint64 `json:"forwarded_packets"`
+
+	Bandwidth ContainerBandwidthStat `json:"bandwidth"`
+}
+
+// ContainerBandwidthStat is the container's rate limits, as applied, and the
+// traffic that has gone through them.
+type ContainerBandwidthStat struct {
+	Limits api.ContainerBandwidthStat                `json:"limits"`
+	Usage  bandwidth_manager.ContainerBandwidthUsage `json:"usage"`
+}
+
+// ContainerNetworkInterfaces is how the container is attached to the host's
+// network: its veth pair, and the shared bridge the host's end is attached
+// to, if any.
+type ContainerNetworkInterfaces struct {
+	HostIface      string `json:"host_iface"`
+	ContainerIface string `json:"container_iface"`
+	Bridge         string `json:"bridge,omitempty"`
+
+	HostIP      net.IP     `json:"host_ip"`
+	ContainerIP net.IP     `json:"container_ip"`
+	Subnet      *net.IPNet `json:"-"`
+}
+
+// Resolver looks up the addresses of hostnames given to NetOut.
+type Resolver interface {
+	LookupIP(host string) ([]net.IP, error)
+}
+
 type PortPool interface {
 	Acquire() (uint32, error)
 	Remove(uint32) error
 	Release(uint32)
 }
 
+// property naming the user to run unprivileged processes as; the user is
+// resolved from the container's /etc/passwd and defaults to vcap
+const UserProperty = "garden.user"
+
+// property allowing the container to swap up to the given number of bytes
+// beyond its memory limit; by default it may not swap at all
+const MemorySwapProperty = "garden.memory.swap"
+
+// property identifying the request that created the container, e.g. the
+// orchestrator's; every log line of the container is tagged with it, and the
+// create can be cancelled by it while in flight
+const RequestIDProperty = "garden.request-id"
+
+// property making a create idempotent: creating a container with a key that
+// an existing container was created with returns that container, so that a
+// client which lost the response, e.g. as the server restarted, can retry
+const IdempotencyKeyProperty = "garden.idempotency-key"
+
+// property listing the comma-separated protocols, "tcp" and/or "udp", whose
+// traffic NetIn maps into the container; defaults to "tcp"
+const NetInProtocolsProperty = "garden.net-in.protocols"
+
+// properties binding the port mappings NetIn makes to traffic arriving on
+// the given host interface and/or for the given host address, e.g. to keep
+// a management port off the host's public interface; by default mappings
+// take traffic for the host's external address
+const NetInInterfaceProperty = "garden.net-in.interface"
+const NetInAddressProperty = "garden.net-in.address"
+
+// property reported by Info, giving the path of the container's network
+// namespace for tools such as tcpdump wrappers to enter; it is not stored
+// with the container's own properties
+const NetworkNamespaceProperty = "garden.network.namespace"
+
+// property choosing which of the server's external IPs the container's
+// outbound traffic is SNATed to, rather than one in turn; Info reports the
+// one the container has, however it was chosen
+const ExternalIPProperty = "garden.network.external-ip"
+
+// properties reported by Info giving how the container is confined, for
+// auditing it without inspecting the host; they are not stored with the
+// container's own properties. Containers have no user namespace, so root in
+// them is root on the host and their user runs as the host uid given, and no
+// seccomp or AppArmor profile is applied to them.
+const SecurityPrivilegedProperty = "garden.security.privileged"
+const SecurityDroppedCapabilitiesProperty = "garden.security.dropped-capabilities"
+const SecurityUserNamespaceProperty = "garden.security.user-namespace"
+const SecurityUIDProperty = "garden.security.uid"
+const SecuritySeccompProperty = "garden.security.seccomp"
+const SecurityAppArmorProperty = "garden.security.apparmor"
+
+// the profile reported for confinement that isn't applied
+const UnconfinedProfile = "unconfined"
+
+// property giving a command to run in the container, with /bin/sh -c as the
+// container's user, before its processes are signalled on Stop or Destroy,
+// e.g. for a stateful workload to flush its data
+const PreStopProperty = "garden.pre-stop"
+
+// property limiting how long the pre-stop command may run for, as a
+// duration such as "30s"; defaults to DefaultPreStopTimeout
+const PreStopTimeoutProperty = "garden.pre-stop.timeout"
+
+const DefaultPreStopTimeout = 10 * time.Second
+
+// PreStopResult is the outcome of a container's pre-stop command.
+type PreStopResult string
+
+const (
+	// the container has no pre-stop command, or it has not been run
+	PreStopNotRun = PreStopResult("")
+
+	PreStopSucceeded = PreStopResult("succeeded")
+	PreStopFailed    = PreStopResult("failed")
+	PreStopTimedOut  = PreStopResult("timed-out")
+)
+
+// PreStopTimeout returns how long the pre-stop command of a container with
+// the given properties may run for.
+func PreStopTimeout(properties api.Properties) (time.Duration, error) {
+	value, found := properties[PreStopTimeoutProperty]
+	if !found {
+		return DefaultPreStopTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if timeout <= 0 {
+		return 0, fmt.Errorf("pre-stop timeout must be positive: %s", value)
+	}
+
+	return timeout, nil
+}
+
+type UnknownProtocolError struct {
+	Protocol string
+}
+
+func (e UnknownProtocolError) Error() string {
+	return fmt.Sprintf("unknown protocol: %q", e.Protocol)
+}
+
+// NetInProtocols returns the protocols NetIn maps for a container with the
+// given properties.
+func NetInProtocols(properties api.Properties) ([]string, error) {
+	value, found := properties[NetInProtocolsProperty]
+	if !found {
+		return []string{"tcp"}, nil
+	}
+
+	protocols := strings.Split(value, ",")
+	for _, protocol := range protocols {
+		if protocol != "tcp" && protocol != "udp" {
+			return nil, UnknownProtocolError{protocol}
+		}
+	}
+
+	return protocols, nil
+}
+
+// NetInBinding is the host interface and address a container's port
+// mappings are bound to; either may be empty.
+type NetInBinding struct {
+	Interface string `json:"interface,omitempty"`
+	Address   string `json:"address,omitempty"`
+}
+
+type InvalidNetInBindingError struct {
+	Property string
+	Value    string
+}
+
+func (e InvalidNetInBindingError) Error() string {
+	return fmt.Sprintf("invalid %s: %q", e.Property, e.Value)
+}
+
+// NetInBindingOf returns the binding of the port mappings NetIn makes for a
+// container with the given properties.
+func NetInBindingOf(properties api.Properties) (NetInBinding, error) {
+	iface, found := properties[NetInInterfaceProperty]
+
+	// as the kernel checks names
+	if found && (iface == "" || len(iface) > 15 || iface == "." || iface == ".." || strings.ContainsAny(iface, "/: \t\n")) {
+		return NetInBinding{}, InvalidNetInBindingError{NetInInterfaceProperty, iface}
+	}
+
+	address, found := properties[NetInAddressProperty]
+	if found && (net.ParseIP(address) == nil || net.ParseIP(address).To4() == nil) {
+		return NetInBinding{}, InvalidNetInBindingError{NetInAddressProperty, address}
+	}
+
+	return NetInBinding{
+		Interface: iface,
+		Address:   address,
+	}, nil
+}
+
 type State string
 
 const (
 	StateBorn    = State("born")
 	StateActive  = State("active")
 	StateStopped = State("stopped")
+
+	// the container's processes were dumped by Checkpoint, and are waiting
+	// to be brought back by RestoreCheckpoint
+	StateCheckpointed = State("checkpointed")
 )
 
 func NewLinuxContainer(
@@ -113,7 +397,10 @@ func NewLinuxContainer(
 	quotaManager quota_manager.QuotaManager,
 	bandwidthManager bandwidth_manager.BandwidthManager,
 	processTracker process_tracker.ProcessTracker,
+	resolver Resolver,
 	envvars []string,
+	processDefaults ProcessDefaults,
+	security Security,
 ) *LinuxContainer {
 	return &LinuxContainer{
 		logger: logger,
@@ -141,7 +428,16 @@ func NewLinuxContainer(
 
 		processTracker: processTracker,
 
+		resolver:        resolver,
+		resolvedNetOuts: map[NetOutSpec][]string{},
+
 		envvars: envvars,
+
+		processDefaults: processDefaults,
+
+		security: security,
+
+		operations: newOperations(),
 	}
 }
 
@@ -183,6 +479,10 @@ func (c *LinuxContainer) Resources() *Resources {
 	return c.resources
 }
 
+func (c *LinuxContainer) Security() Security {
+	return c.security
+}
+
 func (c *LinuxContainer) Snapshot(out io.Writer) error {
 	cLog := c.logger.Session("snapshot")
 
@@ -242,11 +542,15 @@ func (c *LinuxContainer) Snapshot(out io.Writer) error {
 		NetIns:  c.netIns,
 		NetOuts: c.netOuts,
 
+		ResolvedNetOuts: c.resolvedNetOutSnapshots(),
+
 		Processes: processSnapshots,
 
 		Properties: c.Properties(),
 
 		EnvVars: c.envvars,
+
+		ProcessDefaults: c.processDefaults,
 	}
 
 	err := json.NewEncoder(out).Encode(snapshot)
@@ -277,6 +581,7 @@ func (c *LinuxContainer) Restore(snapshot ContainerSnapshot) error {
 	c.setState(State(snapshot.State))
 
 	c.envvars = snapshot.EnvVars
+	c.processDefaults = snapshot.ProcessDefaults
 
 	for _, ev := range snapshot.Events {
 		c.registerEvent(ev)
@@ -306,6 +611,22 @@ func (c *LinuxContainer) Restore(snapshot ContainerSnapshot) error {
 		return err
 	}
 
+	// the rate limits are still on the host's end of the veth pair, unless
+	// it went while the server was down
+	c.bandwidthMutex.Lock()
+	c.currentBandwidthLimits = snapshot.Limits.Bandwidth
+	c.bandwidthMutex.Unlock()
+
+	// the veth pair may have been deleted, or the bridge recreated, while
+	// the server was down; the container is still worth restoring if it
+	// cannot be rewired, as that can be retried
+	if c.State() == StateActive {
+		err := c.repairNetwork(cLog)
+		if err != nil {
+			cLog.Error("failed-to-repair-network", err)
+		}
+	}
+
 	for _, in := range snapshot.NetIns {
 		_, _, err = c.NetIn(in.HostPort, in.ContainerPort)
 		if err != nil {
@@ -314,8 +635,18 @@ func (c *LinuxContainer) Restore(snapshot ContainerSnapshot) error {
 		}
 	}
 
+	resolved := map[NetOutSpec][]string{}
+	for _, out := range snapshot.ResolvedNetOuts {
+		resolved[out.Spec] = out.Networks
+	}
+
 	for _, out := range snapshot.NetOuts {
-		err = c.NetOut(out.Network, out.Port)
+		if isHostname(out.Network) {
+			err = c.restoreResolvedNetOut(cLog, out, resolved[out])
+		} else {
+			err = c.NetOut(out.Network, out.Port)
+		}
+
 		if err != nil {
 			cLog.Error("failed-to-reenforce-allowed-traffic", err)
 			return err
@@ -332,10 +663,11 @@ func (c *LinuxContainer) Start() error {
 
 	cLog.Debug("starting")
 
+	started := time.Now()
+
 	start := exec.Command(path.Join(c.path, "start.sh"))
 	start.Env = []string{
 		"id=" + c.id,
-		"container_iface_mtu=1500",
 		"PATH=" + os.Getenv("PATH"),
 	}
 
@@ -344,14 +676,35 @@ func (c *LinuxContainer) Start() error {
 		Logger:        cLog,
 	}
 
+	// the iptables rules don't depend on the container's interfaces or
+	// cgroups, which wshd's hooks set up, so install them meanwhile; they go
+	// through the runner rather than start.sh so that they can be queued
+	// behind other containers' rules
+	netSetup := make(chan error, 1)
+	go func() {
+		netSetup <- cRunner.Run(exec.Command(path.Join(c.path, "net.sh"), "setup"))
+	}()
+
 	err := cRunner.Run(start)
+
+	// let the rules finish being installed either way, so that tearing them
+	// down on destroy doesn't race with it
+	netErr := <-netSetup
+
 	if err != nil {
 		cLog.Error("failed-to-start", err)
 		return err
 	}
 
+	if netErr != nil {
+		cLog.Error("failed-to-set-up-network", netErr)
+		return netErr
+	}
+
 	c.setState(StateActive)
 
+	ReportDuration(cLog, CreateStartDuration, started)
+
 	cLog.Info("started")
 
 	return nil
@@ -367,6 +720,11 @@ func (c *LinuxContainer) Cleanup() {
 }
 
 func (c *LinuxContainer) Stop(kill bool) error {
+	// a kill is meant to be immediate, so doesn't wait for the hook
+	if !kill {
+		c.RunPreStop()
+	}
+
 	stop := exec.Command(path.Join(c.path, "stop.sh"))
 
 	if kill {
@@ -385,6 +743,175 @@ func (c *LinuxContainer) Stop(kill bool) error {
 	return nil
 }
 
+// RunPreStop runs the container's pre-stop command, if it has one and is
+// running, waiting for it for up to its timeout. Its processes are only
+// signalled afterwards, whatever its outcome, which is recorded as the
+// container's PreStopResult, and as an event unless it succeeded.
+func (c *LinuxContainer) RunPreStop() PreStopResult {
+	command, found := c.properties[PreStopProperty]
+	if !found || command == "" || c.State() != StateActive {
+		return PreStopNotRun
+	}
+
+	cLog := c.logger.Session("pre-stop")
+
+	// validated on create; a restored container may predate that
+	timeout, err := PreStopTimeout(c.properties)
+	if err != nil {
+		timeout = DefaultPreStopTimeout
+	}
+
+	preStop := exec.Command(
+		path.Join(c.path, "bin", "wsh"),
+		"--socket", path.Join(c.path, "run", "wshd.sock"),
+		"--user", c.unprivilegedUser(),
+		"/bin/sh", "-c", command,
+	)
+
+	cLog.Debug("running", lager.Data{
+		"timeout": timeout.String(),
+	})
+
+	result := c.runPreStop(cLog, preStop, timeout)
+
+	c.stateMutex.Lock()
+	c.preStopResult = result
+	c.stateMutex.Unlock()
+
+	if result != PreStopSucceeded {
+		c.registerEvent("pre-stop " + string(result))
+	}
+
+	cLog.Info("finished", lager.Data{
+		"result": result,
+	})
+
+	return result
+}
+
+func (c *LinuxContainer) runPreStop(cLog lager.Logger, preStop *exec.Cmd, timeout time.Duration) PreStopResult {
+	err := c.runner.Start(preStop)
+	if err != nil {
+		cLog.Error("failed-to-start", err)
+		return PreStopFailed
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- c.runner.Wait(preStop)
+	}()
+
+	select {
+	case err := <-exited:
+		if err != nil {
+			cLog.Error("failed", err)
+			return PreStopFailed
+		}
+
+		return PreStopSucceeded
+
+	case <-time.After(timeout):
+		// the command itself is stopped with the rest of the container's
+		// processes
+		c.runner.Kill(preStop)
+		return PreStopTimedOut
+	}
+}
+
+// OnChange has the container call changed after each change to what its
+// snapshot would hold other than its processes: port mappings, allowed
+// egress and limits. It is called before the container is used, so it is
+// not guarded.
+func (c *LinuxContainer) OnChange(changed func()) {
+	c.onChange = changed
+}
+
+func (c *LinuxContainer) changed() {
+	if c.onChange != nil {
+		c.onChange()
+	}
+}
+
+// PreStopResult is the outcome of the last run of the container's pre-stop
+// command.
+func (c *LinuxContainer) PreStopResult() PreStopResult {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+
+	return c.preStopResult
+}
+
+// Checkpoint dumps the container's process tree to its depot with CRIU,
+// stopping its processes. This is experimental: clients streaming from
+// processes lose them, though the processes themselves carry on once
+// restored.
+func (c *LinuxContainer) Checkpoint() error {
+	cLog := c.logger.Session("checkpoint")
+
+	if state := c.State(); state != StateActive {
+		return InvalidStateError{state}
+	}
+
+	cRunner := logging.Runner{
+		CommandRunner: c.runner,
+		Logger:        cLog,
+	}
+
+	err := cRunner.Run(exec.Command(path.Join(c.path, "checkpoint.sh"), "dump"))
+	if err != nil {
+		cLog.Error("failed-to-dump", err)
+		return err
+	}
+
+	c.setState(StateCheckpointed)
+
+	cLog.Info("checkpointed")
+
+	return nil
+}
+
+// RestoreCheckpoint brings back the processes dumped by Checkpoint,
+// reattaching the container to its network with its existing address. When
+// moving a container between hosts, its depot is copied over and it is
+// restored from its snapshot first, so that it has the same address there.
+func (c *LinuxContainer) RestoreCheckpoint() error {
+	cLog := c.logger.Session("restore-checkpoint")
+
+	if state := c.State(); state != StateCheckpointed {
+		return InvalidStateError{state}
+	}
+
+	restore := exec.Command(path.Join(c.path, "checkpoint.sh"), "restore")
+	restore.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+	}
+
+	cRunner := logging.Runner{
+		CommandRunner: c.runner,
+		Logger:        cLog,
+	}
+
+	err := cRunner.Run(restore)
+	if err != nil {
+		cLog.Error("failed-to-restore", err)
+		return err
+	}
+
+	// checkpoint.sh sets up the container's chains afresh, which drops the
+	// rules NetIn and NetOut added to them
+	err = c.reinstateNetRules()
+	if err != nil {
+		cLog.Error("failed-to-reenforce-network-rules", err)
+		return err
+	}
+
+	c.setState(StateActive)
+
+	cLog.Info("restored")
+
+	return nil
+}
+
 func (c *LinuxContainer) Info() (api.ContainerInfo, error) {
 	cLog := c.logger.Session("info")
 
@@ -431,10 +958,32 @@ func (c *LinuxContainer) Info() (api.ContainerInfo, error) {
 		processIDs = append(processIDs, process.ID())
 	}
 
+	properties := api.Properties{}
+	for key, value := range c.Properties() {
+		properties[key] = value
+	}
+
+	pid, err := c.wshdPID()
+	if err == nil {
+		properties[NetworkNamespaceProperty] = fmt.Sprintf("/proc/%d/ns/net", pid)
+	}
+
+	properties[SecurityPrivilegedProperty] = strconv.FormatBool(c.security.Privileged)
+	properties[SecurityDroppedCapabilitiesProperty] = strings.Join(c.security.DroppedCapabilities, ",")
+	properties[SecurityUserNamespaceProperty] = "false"
+	properties[SecurityUIDProperty] = strconv.FormatUint(uint64(c.resources.UID), 10)
+	properties[SecuritySeccompProperty] = UnconfinedProfile
+	properties[SecurityAppArmorProperty] = UnconfinedProfile
+
+	config, err := readConfig(path.Join(c.path, "etc", "config"))
+	if err == nil && config["snat_ip"] != "" {
+		properties[ExternalIPProperty] = config["snat_ip"]
+	}
+
 	return api.ContainerInfo{
 		State:         string(c.State()),
 		Events:        c.Events(),
-		Properties:    c.Properties(),
+		Properties:    properties,
 		HostIP:        c.resources.Network.HostIP().String(),
 		ContainerIP:   c.resources.Network.ContainerIP().String(),
 		ContainerPath: c.path,
@@ -448,16 +997,16 @@ func (c *LinuxContainer) Info() (api.ContainerInfo, error) {
 }
 
 func (c *LinuxContainer) StreamIn(dstPath string, tarStream io.Reader) error {
-	nsTarPath := path.Join(c.path, "bin", "nstar")
-	pidPath := path.Join(c.path, "run", "wshd.pid")
-
-	pidFile, err := os.Open(pidPath)
+	op, err := c.operations.start("stream-in", c.handle, "")
 	if err != nil {
 		return err
 	}
 
-	var pid int
-	_, err = fmt.Fscanf(pidFile, "%d", &pid)
+	defer c.operations.finish(op)
+
+	nsTarPath := path.Join(c.path, "bin", "nstar")
+
+	pid, err := c.wshdPID()
 	if err != nil {
 		return err
 	}
@@ -469,7 +1018,35 @@ func (c *LinuxContainer) StreamIn(dstPath string, tarStream io.Reader) error {
 		dstPath,
 	)
 
-	tar.Stdin = tarStream
+	// fed through a pipe, so that cancelling can cut the stream off without
+	// waiting on the client
+	stdin, stdinW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	defer stdin.Close()
+
+	tar.Stdin = stdin
+
+	copied := make(chan struct{})
+
+	go func() {
+		if tarStream != nil {
+			io.Copy(stdinW, tarStream)
+		}
+
+		close(copied)
+	}()
+
+	go func() {
+		select {
+		case <-copied:
+		case <-op.Cancelled():
+		}
+
+		stdinW.Close()
+	}()
 
 	cLog := c.logger.Session("stream-in")
 
@@ -478,7 +1055,30 @@ func (c *LinuxContainer) StreamIn(dstPath string, tarStream io.Reader) error {
 		Logger:        cLog,
 	}
 
-	return cRunner.Run(tar)
+	err = cRunner.Run(tar)
+
+	if op.IsCancelled() {
+		return OperationCancelledError{"stream-in", c.handle}
+	}
+
+	return err
+}
+
+// Operations returns the streams in to the container that are in flight.
+func (c *LinuxContainer) Operations() []Operation {
+	return c.operations.list()
+}
+
+// CancelOperation cancels the stream in to the container with the given ID,
+// returning whether it was in flight.
+func (c *LinuxContainer) CancelOperation(id string) bool {
+	return c.operations.cancel(id)
+}
+
+// CancelOperations cancels every stream in to the container in flight, as
+// when it is about to be destroyed.
+func (c *LinuxContainer) CancelOperations() {
+	c.operations.cancelHandle(c.handle)
 }
 
 func (c *LinuxContainer) StreamOut(srcPath string) (io.ReadCloser, error) {
@@ -490,15 +1090,8 @@ func (c *LinuxContainer) StreamOut(srcPath string) (io.ReadCloser, error) {
 	}
 
 	nsTarPath := path.Join(c.path, "bin", "nstar")
-	pidPath := path.Join(c.path, "run", "wshd.pid")
-
-	pidFile, err := os.Open(pidPath)
-	if err != nil {
-		return nil, err
-	}
 
-	var pid int
-	_, err = fmt.Fscanf(pidFile, "%d", &pid)
+	pid, err := c.wshdPID()
 	if err != nil {
 		return nil, err
 	}
@@ -531,6 +1124,23 @@ func (c *LinuxContainer) StreamOut(srcPath string) (io.ReadCloser, error) {
 	return tarRead, nil
 }
 
+func (c *LinuxContainer) wshdPID() (int, error) {
+	pidFile, err := os.Open(path.Join(c.path, "run", "wshd.pid"))
+	if err != nil {
+		return 0, err
+	}
+
+	defer pidFile.Close()
+
+	var pid int
+	_, err = fmt.Fscanf(pidFile, "%d", &pid)
+	if err != nil {
+		return 0, err
+	}
+
+	return pid, nil
+}
+
 func (c *LinuxContainer) LimitBandwidth(limits api.BandwidthLimits) error {
 	cLog := c.logger.Session("limit-bandwidth")
 
@@ -540,9 +1150,10 @@ func (c *LinuxContainer) LimitBandwidth(limits api.BandwidthLimits) error {
 	}
 
 	c.bandwidthMutex.Lock()
-	defer c.bandwidthMutex.Unlock()
-
 	c.currentBandwidthLimits = &limits
+	c.bandwidthMutex.Unlock()
+
+	c.changed()
 
 	return nil
 }
@@ -567,9 +1178,10 @@ func (c *LinuxContainer) LimitDisk(limits api.DiskLimits) error {
 	}
 
 	c.diskMutex.Lock()
-	defer c.diskMutex.Unlock()
-
 	c.currentDiskLimits = &limits
+	c.diskMutex.Unlock()
+
+	c.changed()
 
 	return nil
 }
@@ -587,14 +1199,22 @@ func (c *LinuxContainer) LimitMemory(limits api.MemoryLimits) error {
 
 	limit := fmt.Sprintf("%d", limits.LimitInBytes)
 
+	// validated when the container was created
+	swap, _ := strconv.ParseUint(c.properties[MemorySwapProperty], 10, 64)
+
+	swapLimit := fmt.Sprintf("%d", limits.LimitInBytes+swap)
+
 	// memory.memsw.limit_in_bytes must be >= memory.limit_in_bytes
 	//
 	// however, it must be set after memory.limit_in_bytes, and if we're
 	// increasing the limit, writing memory.limit_in_bytes first will fail.
 	//
 	// so, write memory.limit_in_bytes before and after
+	//
+	// memory.memsw.limit_in_bytes only exists when swap accounting is enabled,
+	// so failing to write it is ignored
 	c.cgroupsManager.Set("memory", "memory.limit_in_bytes", limit)
-	c.cgroupsManager.Set("memory", "memory.memsw.limit_in_bytes", limit)
+	c.cgroupsManager.Set("memory", "memory.memsw.limit_in_bytes", swapLimit)
 
 	err = c.cgroupsManager.Set("memory", "memory.limit_in_bytes", limit)
 	if err != nil {
@@ -602,9 +1222,10 @@ func (c *LinuxContainer) LimitMemory(limits api.MemoryLimits) error {
 	}
 
 	c.memoryMutex.Lock()
-	defer c.memoryMutex.Unlock()
-
 	c.currentMemoryLimits = &limits
+	c.memoryMutex.Unlock()
+
+	c.changed()
 
 	return nil
 }
@@ -632,9 +1253,10 @@ func (c *LinuxContainer) LimitCPU(limits api.CPULimits) error {
 	}
 
 	c.cpuMutex.Lock()
-	defer c.cpuMutex.Unlock()
-
 	c.currentCPULimits = &limits
+	c.cpuMutex.Unlock()
+
+	c.changed()
 
 	return nil
 }
@@ -657,7 +1279,8 @@ func (c *LinuxContainer) Run(spec api.ProcessSpec, processIO api.ProcessIO) (api
 	wshPath := path.Join(c.path, "bin", "wsh")
 	sockPath := path.Join(c.path, "run", "wshd.sock")
 
-	user := "vcap"
+	user := c.unprivilegedUser()
+
 	if spec.Privileged {
 		user = "root"
 	}
@@ -672,24 +1295,105 @@ func (c *LinuxContainer) Run(spec api.ProcessSpec, processIO api.ProcessIO) (api
 		args = append(args, "--env", envVar)
 	}
 
-	if spec.Dir != "" {
-		args = append(args, "--dir", spec.Dir)
+	dir := spec.Dir
+	if dir == "" {
+		dir = c.processDefaults.Dir
 	}
 
-	args = append(args, spec.Path)
+	if dir != "" {
+		args = append(args, "--dir", dir)
+	}
 
-	wsh := exec.Command(wshPath, append(args, spec.Args...)...)
+	processPath, processArgs := c.processCommand(spec)
 
-	setRLimitsEnv(wsh, spec.Limits)
+	args = append(args, processPath)
 
-	return c.processTracker.Run(wsh, processIO, spec.TTY)
+	wsh := exec.Command(wshPath, append(args, processArgs...)...)
+
+	setRLimitsEnv(wsh, spec.Limits)
+
+	// the environment is not logged, as it may carry credentials
+	cLog := c.logger.Session("run", lager.Data{
+		"path": processPath,
+		"user": user,
+		"dir":  dir,
+	})
+
+	cLog.Debug("spawning")
+
+	process, err := c.processTracker.Run(wsh, processIO, spec.TTY)
+	if err != nil {
+		cLog.Error("failed-to-spawn", err)
+		return nil, err
+	}
+
+	cLog.Info("spawned", lager.Data{
+		"process": process.ID(),
+	})
+
+	return process, nil
+}
+
+// unprivilegedUser is the user the container's unprivileged processes run as
+func (c *LinuxContainer) unprivilegedUser() string {
+	if name, found := c.properties[UserProperty]; found && name != "" {
+		return name
+	}
+
+	if c.processDefaults.User != "" {
+		return c.processDefaults.User
+	}
+
+	return "vcap"
+}
+
+// processCommand gives the path and args to run for the spec, falling back
+// on the image's entrypoint and cmd if it has no path
+func (c *LinuxContainer) processCommand(spec api.ProcessSpec) (string, []string) {
+	if spec.Path != "" || len(c.processDefaults.Entrypoint)+len(c.processDefaults.Cmd) == 0 {
+		return spec.Path, spec.Args
+	}
+
+	args := spec.Args
+	if len(args) == 0 {
+		args = c.processDefaults.Cmd
+	}
+
+	command := append(append([]string{}, c.processDefaults.Entrypoint...), args...)
+	if len(command) == 0 {
+		return spec.Path, spec.Args
+	}
+
+	return command[0], command[1:]
 }
 
 func (c *LinuxContainer) Attach(processID uint32, processIO api.ProcessIO) (api.Process, error) {
-	return c.processTracker.Attach(processID, processIO)
+	cLog := c.logger.Session("attach", lager.Data{
+		"process": processID,
+	})
+
+	process, err := c.processTracker.Attach(processID, processIO)
+	if err != nil {
+		cLog.Error("failed-to-attach", err)
+		return nil, err
+	}
+
+	cLog.Debug("attached")
+
+	return process, nil
 }
 
 func (c *LinuxContainer) NetIn(hostPort uint32, containerPort uint32) (uint32, uint32, error) {
+	if containerPort == 0 {
+		containerPort = hostPort
+	}
+
+	// mapping the same ports again is a no-op, so that a client that has lost
+	// track of its mappings can replay them all
+	if hostPort != 0 && c.hasNetIn(hostPort, containerPort) {
+		return hostPort, containerPort, nil
+	}
+
 	if hostPort == 0 {
 		randomPort, err := c.portPool.Acquire()
 		if err != nil {
@@ -705,28 +1409,384 @@ func (c *LinuxContainer) NetIn(hostPort uint32, containerPort uint32) (uint32, u
 		containerPort = hostPort
 	}
 
-	net := exec.Command(path.Join(c.path, "net.sh"), "in")
-	net.Env = []string{
+	protocols, err := NetInProtocols(c.properties)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	binding, err := NetInBindingOf(c.properties)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cRunner := logging.Runner{
+		CommandRunner: c.runner,
+		Logger: c.logger.Session("net-in", lager.Data{
+			"host-port":      hostPort,
+			"container-port": containerPort,
+			"protocols":      protocols,
+			"binding":        binding,
+		}),
+	}
+
+	for i, protocol := range protocols {
+		net := exec.Command(path.Join(c.path, "net.sh"), "in")
+		net.Env = netInEnv(hostPort, containerPort, protocol, binding)
+
+		err = cRunner.Run(net)
+		if err != nil {
+			// the mapping is not recorded, so nothing else would remove the
+			// rules already added for the other protocols
+			for _, mapped := range protocols[:i] {
+				remove := exec.Command(path.Join(c.path, "net.sh"), "remove_in")
+				remove.Env = netInEnv(hostPort, containerPort, mapped, binding)
+
+				cRunner.Run(remove)
+			}
+
+			return 0, 0, err
+		}
+	}
+
+	c.netInsMutex.Lock()
+	c.netIns = append(c.netIns, NetInSpec{hostPort, containerPort})
+	c.netInsMutex.Unlock()
+
+	c.changed()
+
+	return hostPort, containerPort, nil
+}
+
+// reinstateNetRules adds the rules for the container's NetIns and NetOuts
+// to its chains again, with hostnames' addresses as last resolved.
+func (c *LinuxContainer) reinstateNetRules() error {
+	protocols, err := NetInProtocols(c.properties)
+	if err != nil {
+		return err
+	}
+
+	binding, err := NetInBindingOf(c.properties)
+	if err != nil {
+		return err
+	}
+
+	c.netInsMutex.RLock()
+	netIns := append([]NetInSpec{}, c.netIns...)
+	c.netInsMutex.RUnlock()
+
+	cRunner := logging.Runner{
+		CommandRunner: c.runner,
+		Logger:        c.logger.Session("reinstate-net-rules"),
+	}
+
+	for _, spec := range netIns {
+		for _, protocol := range protocols {
+			net := exec.Command(path.Join(c.path, "net.sh"), "in")
+			net.Env = netInEnv(spec.HostPort, spec.ContainerPort, protocol, binding)
+
+			err := cRunner.Run(net)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	c.netOutsMutex.RLock()
+	defer c.netOutsMutex.RUnlock()
+
+	for _, spec := range c.netOuts {
+		network := spec.Network
+		if networks, found := c.resolvedNetOuts[spec]; found {
+			network = strings.Join(networks, ",")
+		}
+
+		err := c.runNetOut("out", network, spec.Port)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *LinuxContainer) hasNetIn(hostPort uint32, containerPort uint32) bool {
+	c.netInsMutex.RLock()
+	defer c.netInsMutex.RUnlock()
+
+	for _, spec := range c.netIns {
+		if spec.HostPort == hostPort && spec.ContainerPort == containerPort {
+			return true
+		}
+	}
+
+	return false
+}
+
+// netInEnv is net.sh's environment for one protocol of a mapping's rules.
+func netInEnv(hostPort, containerPort uint32, protocol string, binding NetInBinding) []string {
+	env := []string{
 		fmt.Sprintf("HOST_PORT=%d", hostPort),
 		fmt.Sprintf("CONTAINER_PORT=%d", containerPort),
+		"PROTOCOL=" + protocol,
 		"PATH=" + os.Getenv("PATH"),
 	}
 
-	err := c.runner.Run(net)
-	if err != nil {
-		return 0, 0, err
+	if binding.Interface != "" {
+		env = append(env, "HOST_INTERFACE="+binding.Interface)
 	}
 
+	if binding.Address != "" {
+		env = append(env, "HOST_ADDRESS="+binding.Address)
+	}
+
+	return env
+}
+
+// NetInRemove deletes a mapping made by NetIn, returning the host port to
+// the pool if it was acquired from it and no other mapping uses it.
+func (c *LinuxContainer) NetInRemove(hostPort uint32, containerPort uint32) error {
 	c.netInsMutex.Lock()
 	defer c.netInsMutex.Unlock()
 
-	c.netIns = append(c.netIns, NetInSpec{hostPort, containerPort})
+	index := -1
+	for i, spec := range c.netIns {
+		if spec.HostPort == hostPort && spec.ContainerPort == containerPort {
+			index = i
+			break
+		}
+	}
 
-	return hostPort, containerPort, nil
+	if index == -1 {
+		return NetInNotFoundError{hostPort, containerPort}
+	}
+
+	protocols, err := NetInProtocols(c.properties)
+	if err != nil {
+		return err
+	}
+
+	binding, err := NetInBindingOf(c.properties)
+	if err != nil {
+		return err
+	}
+
+	cRunner := logging.Runner{
+		CommandRunner: c.runner,
+		Logger: c.logger.Session("net-in-remove", lager.Data{
+			"host-port":      hostPort,
+			"container-port": containerPort,
+			"protocols":      protocols,
+			"binding":        binding,
+		}),
+	}
+
+	for _, protocol := range protocols {
+		net := exec.Command(path.Join(c.path, "net.sh"), "remove_in")
+		net.Env = netInEnv(hostPort, containerPort, protocol, binding)
+
+		err = cRunner.Run(net)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.netIns = append(c.netIns[:index], c.netIns[index+1:]...)
+
+	c.changed()
+
+	for _, spec := range c.netIns {
+		if spec.HostPort == hostPort {
+			return nil
+		}
+	}
+
+	if c.resources.RemovePort(hostPort) {
+		c.portPool.Release(hostPort)
+	}
+
+	return nil
 }
 
 func (c *LinuxContainer) NetOut(network string, port uint32) error {
-	net := exec.Command(path.Join(c.path, "net.sh"), "out")
+	if network == "" && port == 0 {
+		return fmt.Errorf("network and/or port must be provided")
+	}
+
+	spec := NetOutSpec{network, port}
+
+	networks := []string{network}
+
+	hostname := isHostname(network)
+	if hostname {
+		var err error
+		networks, err = c.resolveNetOut(network)
+		if err != nil {
+			return err
+		}
+	}
+
+	// iptables adds a rule per address given comma-separated, so a hostname's
+	// addresses take one trip through the queue rather than one each
+	err := c.runNetOut("out", strings.Join(networks, ","), port)
+	if err != nil {
+		return err
+	}
+
+	c.netOutsMutex.Lock()
+	c.netOuts = append(c.netOuts, spec)
+
+	if hostname {
+		c.resolvedNetOuts[spec] = networks
+	}
+	c.netOutsMutex.Unlock()
+
+	c.changed()
+
+	return nil
+}
+
+// RefreshNetOuts resolves the hostnames given to NetOut again, allowing
+// traffic to any new addresses and revoking it from addresses that are gone,
+// so that rules keep up with endpoints whose addresses change.
+//
+// A hostname that fails to resolve keeps its previous addresses.
+func (c *LinuxContainer) RefreshNetOuts() error {
+	c.netOutsMutex.Lock()
+	defer c.netOutsMutex.Unlock()
+
+	var firstErr error
+
+	for spec, current := range c.resolvedNetOuts {
+		networks, err := c.resolveNetOut(spec.Network)
+		if err != nil {
+			c.logger.Error("failed-to-resolve-net-out", err, lager.Data{
+				"hostname": spec.Network,
+			})
+
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			continue
+		}
+
+		added := []string{}
+		for _, network := range networks {
+			if !containsString(current, network) {
+				added = append(added, network)
+			}
+		}
+
+		removed := []string{}
+		for _, network := range current {
+			if !containsString(networks, network) {
+				removed = append(removed, network)
+			}
+		}
+
+		if len(added) > 0 {
+			err := c.runNetOut("out", strings.Join(added, ","), spec.Port)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(removed) > 0 {
+			err := c.runNetOut("remove_out", strings.Join(removed, ","), spec.Port)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.resolvedNetOuts[spec] = networks
+
+		// the addresses are in the snapshot
+		if len(added)+len(removed) > 0 {
+			c.changed()
+		}
+	}
+
+	return firstErr
+}
+
+// restoreResolvedNetOut allows traffic to the addresses a NetOut's hostname
+// resolved to when the snapshot was saved. Snapshots without them have it
+// resolved again, and if that fails the addresses are left for
+// RefreshNetOuts to add rather than failing the restore.
+func (c *LinuxContainer) restoreResolvedNetOut(cLog lager.Logger, spec NetOutSpec, networks []string) error {
+	if len(networks) == 0 {
+		var err error
+		networks, err = c.resolveNetOut(spec.Network)
+		if err != nil {
+			cLog.Error("failed-to-resolve-net-out", err, lager.Data{
+				"hostname": spec.Network,
+			})
+
+			networks = []string{}
+		}
+	}
+
+	if len(networks) > 0 {
+		err := c.runNetOut("out", strings.Join(networks, ","), spec.Port)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.netOutsMutex.Lock()
+	defer c.netOutsMutex.Unlock()
+
+	c.netOuts = append(c.netOuts, spec)
+	c.resolvedNetOuts[spec] = networks
+
+	return nil
+}
+
+// resolvedNetOutSnapshots gives the addresses of the NetOuts to hostnames in
+// the order they were made; netOutsMutex must be held
+func (c *LinuxContainer) resolvedNetOutSnapshots() []ResolvedNetOutSnapshot {
+	snapshots := []ResolvedNetOutSnapshot{}
+
+	for _, spec := range c.netOuts {
+		networks, found := c.resolvedNetOuts[spec]
+		if !found {
+			continue
+		}
+
+		snapshots = append(snapshots, ResolvedNetOutSnapshot{
+			Spec:     spec,
+			Networks: networks,
+		})
+	}
+
+	return snapshots
+}
+
+func (c *LinuxContainer) resolveNetOut(hostname string) ([]string, error) {
+	ips, err := c.resolver.LookupIP(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	networks := []string{}
+	for _, ip := range ips {
+		// the rules are only installed with iptables
+		if ip.To4() == nil {
+			continue
+		}
+
+		networks = append(networks, ip.String()+"/32")
+	}
+
+	if len(networks) == 0 {
+		return nil, NoAddressesError{hostname}
+	}
+
+	return networks, nil
+}
+
+func (c *LinuxContainer) runNetOut(command, network string, port uint32) error {
+	net := exec.Command(path.Join(c.path, "net.sh"), command)
 
 	if port != 0 {
 		net.Env = []string{
@@ -735,10 +1795,6 @@ func (c *LinuxContainer) NetOut(network string, port uint32) error {
 			"PATH=" + os.Getenv("PATH"),
 		}
 	} else {
-		if network == "" {
-			return fmt.Errorf("network and/or port must be provided")
-		}
-
 		net.Env = []string{
 			"NETWORK=" + network,
 			"PORT=",
@@ -746,19 +1802,177 @@ func (c *LinuxContainer) NetOut(network string, port uint32) error {
 		}
 	}
 
-	err := c.runner.Run(net)
+	cRunner := logging.Runner{
+		CommandRunner: c.runner,
+		Logger: c.logger.Session("net-out", lager.Data{
+			"network": network,
+			"port":    port,
+		}),
+	}
+
+	return cRunner.Run(net)
+}
+
+// isHostname returns whether a NetOut network names a host rather than
+// giving an address or CIDR block.
+func isHostname(network string) bool {
+	return hostnamePattern.MatchString(network) && letterPattern.MatchString(network)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NetworkInterfaces reads the names of the container's interfaces from the
+// configuration written when it was created.
+func (c *LinuxContainer) NetworkInterfaces() (ContainerNetworkInterfaces, error) {
+	config, err := readConfig(path.Join(c.path, "etc", "config"))
+	if err != nil {
+		return ContainerNetworkInterfaces{}, err
+	}
+
+	network := c.resources.Network
+
+	bits := 8 * net.IPv6len
+	if network.IP().To4() != nil {
+		bits = 8 * net.IPv4len
+	}
+
+	mask := net.CIDRMask(network.PrefixLength(), bits)
+
+	return ContainerNetworkInterfaces{
+		HostIface:      config["network_host_iface"],
+		ContainerIface: config["network_container_iface"],
+		Bridge:         config["network_bridge"],
+
+		HostIP:      network.HostIP(),
+		ContainerIP: network.ContainerIP(),
+		Subnet: &net.IPNet{
+			IP:   network.IP().Mask(mask),
+			Mask: mask,
+		},
+	}, nil
+}
+
+// RepairNetwork rewires a running container whose veth pair was deleted
+// from under it, as by a network restart, or whose interface was left
+// detached from a bridge that was recreated. The container's rate limits,
+// which went with its old interface, are applied again.
+func (c *LinuxContainer) RepairNetwork() error {
+	cLog := c.logger.Session("repair-network")
+
+	if state := c.State(); state != StateActive {
+		return InvalidStateError{state}
+	}
+
+	err := c.repairNetwork(cLog)
 	if err != nil {
 		return err
 	}
 
-	c.netOutsMutex.Lock()
-	defer c.netOutsMutex.Unlock()
+	cLog.Info("repaired")
+
+	return nil
+}
+
+func (c *LinuxContainer) repairNetwork(cLog lager.Logger) error {
+	cRunner := logging.Runner{
+		CommandRunner: c.runner,
+		Logger:        cLog,
+	}
+
+	err := cRunner.Run(exec.Command(path.Join(c.path, "net.sh"), "repair"))
+	if err != nil {
+		cLog.Error("failed-to-repair", err)
+		return err
+	}
+
+	c.bandwidthMutex.RLock()
+	limits := c.currentBandwidthLimits
+	c.bandwidthMutex.RUnlock()
 
-	c.netOuts = append(c.netOuts, NetOutSpec{network, port})
+	if limits != nil {
+		err := c.bandwidthManager.SetLimits(cLog, *limits)
+		if err != nil {
+			cLog.Error("failed-to-limit-bandwidth", err)
+			return err
+		}
+	}
 
 	return nil
 }
 
+// NetworkStat reads the counters of the container's veth pair, of its rules
+// in the forward chain, and of its rate limits.
+func (c *LinuxContainer) NetworkStat() (ContainerNetworkStat, error) {
+	cLog := c.logger.Session("network-stat")
+
+	cRunner := logging.Runner{
+		CommandRunner: c.runner,
+		Logger:        cLog,
+	}
+
+	statsOut := new(bytes.Buffer)
+
+	stats := exec.Command(path.Join(c.path, "net.sh"), "stats")
+	stats.Stdout = statsOut
+
+	err := cRunner.Run(stats)
+	if err != nil {
+		return ContainerNetworkStat{}, err
+	}
+
+	// net.sh reports the host's side of the veth pair, where what the
+	// container sends is received
+	stat := ContainerNetworkStat{}
+
+	fields := map[string]*uint64{
+		"rx_bytes":          &stat.TxBytes,
+		"rx_packets":        &stat.TxPackets,
+		"rx_dropped":        &stat.TxDropped,
+		"tx_bytes":          &stat.RxBytes,
+		"tx_packets":        &stat.RxPackets,
+		"tx_dropped":        &stat.RxDropped,
+		"forwarded_bytes":   &stat.ForwardedBytes,
+		"forwarded_packets": &stat.ForwardedPackets,
+	}
+
+	for _, line := range strings.Split(statsOut.String(), "\n") {
+		segs := strings.SplitN(line, "=", 2)
+		if len(segs) != 2 {
+			continue
+		}
+
+		field, found := fields[segs[0]]
+		if !found {
+			continue
+		}
+
+		*field, err = strconv.ParseUint(segs[1], 10, 64)
+		if err != nil {
+			return ContainerNetworkStat{}, err
+		}
+	}
+
+	stat.Bandwidth.Limits, err = c.bandwidthManager.GetLimits(cLog)
+	if err != nil {
+		return ContainerNetworkStat{}, err
+	}
+
+	stat.Bandwidth.Usage, err = c.bandwidthManager.GetUsage(cLog)
+	if err != nil {
+		return ContainerNetworkStat{}, err
+	}
+
+	return stat, nil
+}
+
 func (c *LinuxContainer) CurrentEnvVars() []string {
 	return c.envvars
 }
@@ -813,9 +2027,14 @@ func (c *LinuxContainer) watchForOom(oom *exec.Cmd) {
 	if err == nil {
 		c.registerEvent("out of memory")
 		c.Stop(false)
+		return
 	}
 
-	// TODO: handle case where oom notifier itself failed? kill container?
+	// the notifier also exits non-zero when it is stopped, or when the cgroup
+	// is removed as the container is destroyed
+	c.logger.Info("oom-notifier-exited", lager.Data{
+		"error": err.Error(),
+	})
 }
 
 func parseMemoryStat(contents string) (stat api.ContainerMemoryStat) {
@@ -12,7 +12,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
@@ -22,14 +21,18 @@ import (
 	"github.com/pivotal-golang/lager/lagertest"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/bandwidth_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/bandwidth_manager/fake_bandwidth_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/cgroups_manager/fake_cgroups_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool/fake_port_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/process_tracker/fake_process_tracker"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager/fake_quota_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/resolver/fake_resolver"
 	"github.com/cloudfoundry-incubator/garden/api"
 	wfakes "github.com/cloudfoundry-incubator/garden/api/fakes"
+	"github.com/cloudfoundry/dropsonde/autowire/metrics"
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
 	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
 	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
 )
@@ -42,6 +45,7 @@ var containerResources *linux_backend.Resources
 var container *linux_backend.LinuxContainer
 var fakePortPool *fake_port_pool.FakePortPool
 var fakeProcessTracker *fake_process_tracker.FakeProcessTracker
+var fakeResolver *fake_resolver.FakeResolver
 var containerDir string
 
 var _ = Describe("Linux containers", func() {
@@ -53,6 +57,7 @@ var _ = Describe("Linux containers", func() {
 		fakeQuotaManager = fake_quota_manager.New()
 		fakeBandwidthManager = fake_bandwidth_manager.New()
 		fakeProcessTracker = new(fake_process_tracker.FakeProcessTracker)
+		fakeResolver = fake_resolver.New()
 
 		_, ipNet, err := net.ParseCIDR("10.254.0.0/24")
 		Ω(err).ShouldNot(HaveOccurred())
@@ -61,7 +66,7 @@ var _ = Describe("Linux containers", func() {
 
 		networkPool := network_pool.New(ipNet)
 
-		network, err := networkPool.Acquire()
+		network, err := networkPool.Acquire("some-handle")
 		Ω(err).ShouldNot(HaveOccurred())
 
 		containerDir, err = ioutil.TempDir("", "depot")
@@ -94,7 +99,12 @@ var _ = Describe("Linux containers", func() {
 			fakeQuotaManager,
 			fakeBandwidthManager,
 			fakeProcessTracker,
+			fakeResolver,
 			[]string{"env1=env1Value", "env2=env2Value"},
+			linux_backend.ProcessDefaults{},
+			linux_backend.Security{
+				DroppedCapabilities: []string{"CAP_SYS_ADMIN", "CAP_SYS_MODULE"},
+			},
 		)
 	})
 
@@ -135,6 +145,9 @@ var _ = Describe("Linux containers", func() {
 			_, _, err = container.NetIn(3, 4)
 			Ω(err).ShouldNot(HaveOccurred())
 
+			fakeResolver.Resolves("network-a", "1.2.3.4")
+			fakeResolver.Resolves("network-b", "5.6.7.8")
+
 			err = container.NetOut("network-a", 1)
 			Ω(err).ShouldNot(HaveOccurred())
 
@@ -205,6 +218,19 @@ var _ = Describe("Linux containers", func() {
 				},
 			))
 
+			Ω(snapshot.ResolvedNetOuts).Should(Equal(
+				[]linux_backend.ResolvedNetOutSnapshot{
+					{
+						Spec:     linux_backend.NetOutSpec{Network: "network-a", Port: 1},
+						Networks: []string{"1.2.3.4/32"},
+					},
+					{
+						Spec:     linux_backend.NetOutSpec{Network: "network-b", Port: 2},
+						Networks: []string{"5.6.7.8/32"},
+					},
+				},
+			))
+
 			Ω(snapshot.Processes).Should(ContainElement(
 				linux_backend.ProcessSnapshot{
 					ID: 1,
@@ -300,6 +326,11 @@ var _ = Describe("Linux containers", func() {
 	})
 
 	Describe("Restoring", func() {
+		BeforeEach(func() {
+			fakeResolver.Resolves("somehost.example.com", "1.2.3.4")
+			fakeResolver.Resolves("someotherhost.example.com", "5.6.7.8")
+		})
+
 		It("sets the container's state and events", func() {
 			err := container.Restore(linux_backend.ContainerSnapshot{
 				State:  "active",
@@ -395,12 +426,183 @@ var _ = Describe("Linux containers", func() {
 				fake_command_runner.CommandSpec{
 					Path: containerDir + "/net.sh",
 					Args: []string{"out"},
+					Env: []string{
+						"NETWORK=1.2.3.4/32",
+						"PORT=80",
+						"PATH=" + os.Getenv("PATH"),
+					},
 				},
 				fake_command_runner.CommandSpec{
 					Path: containerDir + "/net.sh",
 					Args: []string{"out"},
+					Env: []string{
+						"NETWORK=5.6.7.8/32",
+						"PORT=8080",
+						"PATH=" + os.Getenv("PATH"),
+					},
+				},
+			))
+		})
+
+		Context("when the snapshot has the addresses hostnames were resolved to", func() {
+			BeforeEach(func() {
+				fakeResolver.Fails("somehost.example.com", errors.New("no such host"))
+			})
+
+			It("allows traffic to those addresses without resolving the hostnames again", func() {
+				err := container.Restore(linux_backend.ContainerSnapshot{
+					State:  "active",
+					Events: []string{},
+
+					NetOuts: []linux_backend.NetOutSpec{
+						{
+							Network: "somehost.example.com",
+							Port:    80,
+						},
+					},
+
+					ResolvedNetOuts: []linux_backend.ResolvedNetOutSnapshot{
+						{
+							Spec:     linux_backend.NetOutSpec{Network: "somehost.example.com", Port: 80},
+							Networks: []string{"9.8.7.6/32"},
+						},
+					},
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeResolver.LookedUp()).Should(BeEmpty())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"out"},
+						Env: []string{
+							"NETWORK=9.8.7.6/32",
+							"PORT=80",
+							"PATH=" + os.Getenv("PATH"),
+						},
+					},
+				))
+			})
+		})
+
+		Context("when a hostname can't be resolved", func() {
+			BeforeEach(func() {
+				fakeResolver.Fails("somehost.example.com", errors.New("no such host"))
+			})
+
+			It("restores the container, leaving the hostname to be resolved when the net outs are refreshed", func() {
+				err := container.Restore(linux_backend.ContainerSnapshot{
+					State:  "active",
+					Events: []string{},
+
+					NetOuts: []linux_backend.NetOutSpec{
+						{
+							Network: "somehost.example.com",
+							Port:    80,
+						},
+					},
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"out"},
+					},
+				))
+
+				fakeResolver.Resolves("somehost.example.com", "1.2.3.4")
+
+				err = container.RefreshNetOuts()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"out"},
+						Env: []string{
+							"NETWORK=1.2.3.4/32",
+							"PORT=80",
+							"PATH=" + os.Getenv("PATH"),
+						},
+					},
+				))
+			})
+		})
+
+		It("rewires an active container's network, applying its rate limits again", func() {
+			limits := api.BandwidthLimits{
+				RateInBytesPerSecond:      128,
+				BurstRateInBytesPerSecond: 256,
+			}
+
+			err := container.Restore(linux_backend.ContainerSnapshot{
+				State:  "active",
+				Events: []string{},
+
+				Limits: linux_backend.LimitsSnapshot{
+					Bandwidth: &limits,
+				},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/net.sh",
+					Args: []string{"setup"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/net.sh",
+					Args: []string{"repair"},
 				},
 			))
+
+			Ω(fakeBandwidthManager.EnforcedLimits).Should(Equal([]api.BandwidthLimits{limits}))
+
+			currentLimits, err := container.CurrentBandwidthLimits()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(currentLimits).Should(Equal(limits))
+		})
+
+		Context("when the container is not active", func() {
+			It("does not rewire its network", func() {
+				err := container.Restore(linux_backend.ContainerSnapshot{
+					State:  "stopped",
+					Events: []string{},
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"repair"},
+					},
+				))
+			})
+		})
+
+		Context("when rewiring the network fails", func() {
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"repair"},
+					}, func(*exec.Cmd) error {
+						return errors.New("bridge w-bridge does not exist")
+					},
+				)
+			})
+
+			It("restores the container anyway", func() {
+				err := container.Restore(linux_backend.ContainerSnapshot{
+					State:  "active",
+					Events: []string{},
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container.State()).Should(Equal(linux_backend.StateActive))
+			})
 		})
 
 		for _, cmd := range []string{"setup", "in", "out"} {
@@ -532,7 +734,6 @@ var _ = Describe("Linux containers", func() {
 					Path: containerDir + "/start.sh",
 					Env: []string{
 						"id=some-id",
-						"container_iface_mtu=1500",
 						"PATH=" + os.Getenv("PATH"),
 					},
 				},
@@ -540,6 +741,18 @@ var _ = Describe("Linux containers", func() {
 
 		})
 
+		It("sets up the container's iptables rules with its net.sh", func() {
+			err := container.Start()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/net.sh",
+					Args: []string{"setup"},
+				},
+			))
+		})
+
 		It("changes the container's state to active", func() {
 			Ω(container.State()).Should(Equal(linux_backend.StateBorn))
 
@@ -549,6 +762,16 @@ var _ = Describe("Linux containers", func() {
 			Ω(container.State()).Should(Equal(linux_backend.StateActive))
 		})
 
+		It("reports how long it took", func() {
+			fakeMetricSender := fake.NewFakeMetricSender()
+			metrics.Initialize(fakeMetricSender)
+
+			err := container.Start()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeMetricSender.GetValue(linux_backend.CreateStartDuration).Value).Should(BeNumerically(">", 0))
+		})
+
 		Context("when start.sh fails", func() {
 			nastyError := errors.New("oh no!")
 
@@ -576,6 +799,33 @@ var _ = Describe("Linux containers", func() {
 				Ω(container.State()).Should(Equal(linux_backend.StateBorn))
 			})
 		})
+
+		Context("when setting up the iptables rules fails", func() {
+			nastyError := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"setup"},
+					}, func(*exec.Cmd) error {
+						return nastyError
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				err := container.Start()
+				Ω(err).Should(Equal(nastyError))
+			})
+
+			It("does not change the container's state", func() {
+				err := container.Start()
+				Ω(err).Should(HaveOccurred())
+
+				Ω(container.State()).Should(Equal(linux_backend.StateBorn))
+			})
+		})
 	})
 
 	Describe("Stopping", func() {
@@ -616,6 +866,132 @@ var _ = Describe("Linux containers", func() {
 			})
 		})
 
+		Context("when the container has a pre-stop command", func() {
+			var wshSpec fake_command_runner.CommandSpec
+			var ran []string
+
+			BeforeEach(func() {
+				container = linux_backend.NewLinuxContainer(
+					lagertest.NewTestLogger("test"),
+					"some-id",
+					"some-handle",
+					containerDir,
+					api.Properties{
+						linux_backend.PreStopProperty:        "flush-things",
+						linux_backend.PreStopTimeoutProperty: "100ms",
+					},
+					1*time.Second,
+					containerResources,
+					fakePortPool,
+					fakeRunner,
+					fakeCgroups,
+					fakeQuotaManager,
+					fakeBandwidthManager,
+					fakeProcessTracker,
+					fakeResolver,
+					[]string{},
+					linux_backend.ProcessDefaults{},
+					linux_backend.Security{},
+				)
+
+				err := container.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				wshSpec = fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/wsh",
+					Args: []string{
+						"--socket", containerDir + "/run/wshd.sock",
+						"--user", "vcap",
+						"/bin/sh", "-c", "flush-things",
+					},
+				}
+
+				ran = []string{}
+
+				fakeRunner.WhenRunning(wshSpec, func(*exec.Cmd) error {
+					ran = append(ran, "pre-stop")
+					return nil
+				})
+
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: containerDir + "/stop.sh",
+				}, func(*exec.Cmd) error {
+					ran = append(ran, "stop.sh")
+					return nil
+				})
+			})
+
+			It("runs it in the container before stop.sh signals the processes", func() {
+				err := container.Stop(false)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(ran).Should(Equal([]string{"pre-stop", "stop.sh"}))
+				Ω(container.PreStopResult()).Should(Equal(linux_backend.PreStopSucceeded))
+				Ω(container.Events()).Should(BeEmpty())
+			})
+
+			It("does not run it when killing", func() {
+				err := container.Stop(true)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(ran).Should(Equal([]string{"stop.sh"}))
+				Ω(container.PreStopResult()).Should(Equal(linux_backend.PreStopNotRun))
+			})
+
+			It("does not run it once the container is stopped", func() {
+				err := container.Stop(false)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container.RunPreStop()).Should(Equal(linux_backend.PreStopNotRun))
+				Ω(ran).Should(Equal([]string{"pre-stop", "stop.sh"}))
+			})
+
+			Context("when it fails", func() {
+				BeforeEach(func() {
+					fakeRunner.WhenWaitingFor(wshSpec, func(*exec.Cmd) error {
+						return errors.New("exit status 1")
+					})
+				})
+
+				It("records the failure and stops the container anyway", func() {
+					err := container.Stop(false)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(ran).Should(Equal([]string{"pre-stop", "stop.sh"}))
+					Ω(container.PreStopResult()).Should(Equal(linux_backend.PreStopFailed))
+					Ω(container.Events()).Should(ContainElement("pre-stop failed"))
+				})
+			})
+
+			Context("when it outlasts its timeout", func() {
+				var release chan struct{}
+
+				BeforeEach(func() {
+					release = make(chan struct{})
+
+					fakeRunner.WhenWaitingFor(wshSpec, func(*exec.Cmd) error {
+						<-release
+						return nil
+					})
+				})
+
+				AfterEach(func() {
+					close(release)
+				})
+
+				It("kills it, records the timeout, and stops the container", func() {
+					err := container.Stop(false)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRunner).Should(HaveKilled(wshSpec))
+
+					Ω(ran).Should(Equal([]string{"pre-stop", "stop.sh"}))
+					Ω(container.PreStopResult()).Should(Equal(linux_backend.PreStopTimedOut))
+					Ω(container.Events()).Should(ContainElement("pre-stop timed-out"))
+				})
+			})
+		})
+
 		Context("when stop.sh fails", func() {
 			nastyError := errors.New("oh no!")
 
@@ -665,34 +1041,254 @@ var _ = Describe("Linux containers", func() {
 		})
 	})
 
-	Describe("Cleaning up", func() {
-		Context("when the container has an oom notifier running", func() {
+	Describe("Checkpointing", func() {
+		Context("when the container is active", func() {
 			BeforeEach(func() {
-				err := container.LimitMemory(api.MemoryLimits{
-					LimitInBytes: 42,
-				})
-
+				err := container.Start()
 				Ω(err).ShouldNot(HaveOccurred())
 			})
 
-			It("stops it", func() {
-				container.Cleanup()
-
-				Ω(fakeRunner).Should(HaveKilled(fake_command_runner.CommandSpec{
-					Path: containerDir + "/bin/oom",
-				}))
+			It("dumps it with the container's checkpoint.sh", func() {
+				err := container.Checkpoint()
+				Ω(err).ShouldNot(HaveOccurred())
 
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/checkpoint.sh",
+						Args: []string{"dump"},
+					},
+				))
+			})
+
+			It("sets the container's state to checkpointed", func() {
+				err := container.Checkpoint()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container.State()).Should(Equal(linux_backend.StateCheckpointed))
+			})
+
+			Context("when checkpoint.sh fails", func() {
+				nastyError := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/checkpoint.sh",
+						}, func(*exec.Cmd) error {
+							return nastyError
+						},
+					)
+				})
+
+				It("returns the error and leaves the container active", func() {
+					err := container.Checkpoint()
+					Ω(err).Should(Equal(nastyError))
+
+					Ω(container.State()).Should(Equal(linux_backend.StateActive))
+				})
+			})
+		})
+
+		Context("when the container is not active", func() {
+			It("returns an InvalidStateError", func() {
+				err := container.Checkpoint()
+				Ω(err).Should(Equal(linux_backend.InvalidStateError{State: linux_backend.StateBorn}))
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
 			})
 		})
 	})
 
-	Describe("Streaming data in", func() {
-		var source io.Reader
+	Describe("Restoring a checkpoint", func() {
+		Context("when the container is checkpointed", func() {
+			BeforeEach(func() {
+				err := container.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.Checkpoint()
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("restores it with the container's checkpoint.sh", func() {
+				err := container.RestoreCheckpoint()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/checkpoint.sh",
+						Args: []string{"restore"},
+					},
+				))
+			})
+
+			It("sets the container's state back to active", func() {
+				err := container.RestoreCheckpoint()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container.State()).Should(Equal(linux_backend.StateActive))
+			})
+
+			Context("when the container has net-ins and net-outs", func() {
+				BeforeEach(func() {
+					fakeResolver.Resolves("somehost.example.com", "1.2.3.4")
+
+					_, _, err := container.NetIn(1234, 5678)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = container.NetOut("somehost.example.com", 80)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = container.NetOut("5.6.7.0/24", 0)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("adds their rules again after checkpoint.sh has set up the chains afresh", func() {
+					err := container.RestoreCheckpoint()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRunner).Should(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/checkpoint.sh",
+							Args: []string{"restore"},
+						},
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/net.sh",
+							Args: []string{"in"},
+							Env: []string{
+								"HOST_PORT=1234",
+								"CONTAINER_PORT=5678",
+								"PROTOCOL=tcp",
+								"PATH=" + os.Getenv("PATH"),
+							},
+						},
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/net.sh",
+							Args: []string{"out"},
+							Env: []string{
+								"NETWORK=1.2.3.4/32",
+								"PORT=80",
+								"PATH=" + os.Getenv("PATH"),
+							},
+						},
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/net.sh",
+							Args: []string{"out"},
+							Env: []string{
+								"NETWORK=5.6.7.0/24",
+								"PORT=",
+								"PATH=" + os.Getenv("PATH"),
+							},
+						},
+					))
+				})
+			})
+
+			Context("when checkpoint.sh fails", func() {
+				nastyError := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/checkpoint.sh",
+							Args: []string{"restore"},
+						}, func(*exec.Cmd) error {
+							return nastyError
+						},
+					)
+				})
+
+				It("returns the error and leaves the container checkpointed", func() {
+					err := container.RestoreCheckpoint()
+					Ω(err).Should(Equal(nastyError))
+
+					Ω(container.State()).Should(Equal(linux_backend.StateCheckpointed))
+				})
+			})
+		})
+
+		Context("when the container is not checkpointed", func() {
+			It("returns an InvalidStateError", func() {
+				err := container.RestoreCheckpoint()
+				Ω(err).Should(Equal(linux_backend.InvalidStateError{State: linux_backend.StateBorn}))
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Notifying of changes", func() {
+		var changes int
 
 		BeforeEach(func() {
-			source = strings.NewReader("the-tar-content")
+			changes = 0
+
+			container.OnChange(func() {
+				changes++
+			})
+		})
+
+		It("notifies after each change to the port mappings, allowed egress and limits", func() {
+			_, _, err := container.NetIn(1234, 5678)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(changes).Should(Equal(1))
+
+			err = container.NetInRemove(1234, 5678)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(changes).Should(Equal(2))
+
+			err = container.NetOut("1.2.3.4/32", 80)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(changes).Should(Equal(3))
+
+			err = container.LimitBandwidth(api.BandwidthLimits{RateInBytesPerSecond: 128})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(changes).Should(Equal(4))
+
+			err = container.LimitMemory(api.MemoryLimits{LimitInBytes: 102400})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(changes).Should(Equal(5))
+
+			err = container.LimitCPU(api.CPULimits{LimitInShares: 512})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(changes).Should(Equal(6))
+
+			err = container.LimitDisk(api.DiskLimits{ByteHard: 1024})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(changes).Should(Equal(7))
+		})
+
+		It("doesn't notify when a change fails", func() {
+			fakeQuotaManager.SetLimitsError = errors.New("oh no!")
+
+			err := container.LimitDisk(api.DiskLimits{ByteHard: 1024})
+			Ω(err).Should(HaveOccurred())
+
+			Ω(changes).Should(Equal(0))
+		})
+	})
+
+	Describe("Cleaning up", func() {
+		Context("when the container has an oom notifier running", func() {
+			BeforeEach(func() {
+				err := container.LimitMemory(api.MemoryLimits{
+					LimitInBytes: 42,
+				})
+
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("stops it", func() {
+				container.Cleanup()
+
+				Ω(fakeRunner).Should(HaveKilled(fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/oom",
+				}))
+
+			})
 		})
+	})
 
+	Describe("Streaming data in", func() {
 		It("streams the input to tar xf in the container", func() {
 			fakeRunner.WhenRunning(
 				fake_command_runner.CommandSpec{
@@ -736,15 +1332,49 @@ var _ = Describe("Linux containers", func() {
 				Ω(err).Should(Equal(disaster))
 			})
 		})
-	})
 
-	Describe("Streaming out", func() {
-		var destination *bytes.Buffer
+		Context("when the stream in is cancelled while in flight", func() {
+			It("cuts the stream off and returns an error", func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/bin/nstar",
+					},
+					func(cmd *exec.Cmd) error {
+						_, err := ioutil.ReadAll(cmd.Stdin)
+						return err
+					},
+				)
 
-		BeforeEach(func() {
-			destination = new(bytes.Buffer)
+				// a client that never finishes sending
+				tarStream, tarStreamW := io.Pipe()
+				defer tarStreamW.Close()
+
+				errs := make(chan error, 1)
+
+				go func() {
+					errs <- container.StreamIn("/some/directory/dst", tarStream)
+				}()
+
+				Eventually(container.Operations).Should(HaveLen(1))
+
+				operation := container.Operations()[0]
+				Ω(operation.Kind).Should(Equal("stream-in"))
+				Ω(operation.Handle).Should(Equal(container.Handle()))
+
+				Ω(container.CancelOperation(operation.ID)).Should(BeTrue())
+
+				Eventually(errs).Should(Receive(Equal(linux_backend.OperationCancelledError{
+					Kind:   "stream-in",
+					Handle: container.Handle(),
+				})))
+
+				Ω(container.Operations()).Should(BeEmpty())
+				Ω(container.CancelOperation(operation.ID)).Should(BeFalse())
+			})
 		})
+	})
 
+	Describe("Streaming out", func() {
 		It("streams the output of tar cf to the destination", func() {
 			fakeRunner.WhenRunning(
 				fake_command_runner.CommandSpec{
@@ -840,6 +1470,10 @@ var _ = Describe("Linux containers", func() {
 	})
 
 	Describe("Running", func() {
+		BeforeEach(func() {
+			fakeProcessTracker.RunReturns(new(wfakes.FakeProcess), nil)
+		})
+
 		It("runs the /bin/bash via wsh with the given script as the input, and rlimits in env", func() {
 			_, err := container.Run(api.ProcessSpec{
 				Path: "/some/script",
@@ -939,69 +1573,258 @@ var _ = Describe("Linux containers", func() {
 			}))
 		})
 
-		It("runs the script with a TTY if present", func() {
-			ttySpec := &api.TTYSpec{
-				WindowSize: &api.WindowSize{
-					Columns: 123,
-					Rows:    456,
-				},
-			}
-
-			_, err := container.Run(api.ProcessSpec{
-				Path: "/some/script",
-				TTY:  ttySpec,
-			}, api.ProcessIO{})
+		Context("when the container specifies a user", func() {
+			BeforeEach(func() {
+				container = linux_backend.NewLinuxContainer(
+					lagertest.NewTestLogger("test"),
+					"some-id",
+					"some-handle",
+					containerDir,
+					map[string]string{
+						linux_backend.UserProperty: "alice",
+					},
+					1*time.Second,
+					containerResources,
+					fakePortPool,
+					fakeRunner,
+					fakeCgroups,
+					fakeQuotaManager,
+					fakeBandwidthManager,
+					fakeProcessTracker,
+					fakeResolver,
+					[]string{},
+					linux_backend.ProcessDefaults{},
+					linux_backend.Security{},
+				)
+			})
 
-			Ω(err).ShouldNot(HaveOccurred())
+			It("runs the script as that user", func() {
+				_, err := container.Run(api.ProcessSpec{
+					Path: "/some/script",
+				}, api.ProcessIO{})
 
-			_, _, tty := fakeProcessTracker.RunArgsForCall(0)
-			Ω(tty).Should(Equal(ttySpec))
-		})
+				Ω(err).ShouldNot(HaveOccurred())
 
-		Describe("streaming", func() {
-			BeforeEach(func() {
-				fakeProcessTracker.RunStub = func(cmd *exec.Cmd, io api.ProcessIO, tty *api.TTYSpec) (api.Process, error) {
-					writing := new(sync.WaitGroup)
-					writing.Add(1)
+				ranCmd, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Args).Should(Equal([]string{
+					containerDir + "/bin/wsh",
+					"--socket", containerDir + "/run/wshd.sock",
+					"--user", "alice",
+					"/some/script",
+				}))
+			})
 
-					go func() {
-						defer writing.Done()
-						defer GinkgoRecover()
+			It("still runs privileged scripts as root", func() {
+				_, err := container.Run(api.ProcessSpec{
+					Path:       "/some/script",
+					Privileged: true,
+				}, api.ProcessIO{})
 
-						_, err := fmt.Fprintf(io.Stdout, "hi out\n")
-						Ω(err).ShouldNot(HaveOccurred())
+				Ω(err).ShouldNot(HaveOccurred())
 
-						_, err = fmt.Fprintf(io.Stderr, "hi err\n")
-						Ω(err).ShouldNot(HaveOccurred())
-					}()
+				ranCmd, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Args).Should(Equal([]string{
+					containerDir + "/bin/wsh",
+					"--socket", containerDir + "/run/wshd.sock",
+					"--user", "root",
+					"/some/script",
+				}))
+			})
+		})
 
-					process := new(wfakes.FakeProcess)
+		Context("when the container's image has process defaults", func() {
+			var properties api.Properties
 
-					process.IDReturns(42)
+			BeforeEach(func() {
+				properties = api.Properties{}
+			})
+
+			JustBeforeEach(func() {
+				container = linux_backend.NewLinuxContainer(
+					lagertest.NewTestLogger("test"),
+					"some-id",
+					"some-handle",
+					containerDir,
+					properties,
+					1*time.Second,
+					containerResources,
+					fakePortPool,
+					fakeRunner,
+					fakeCgroups,
+					fakeQuotaManager,
+					fakeBandwidthManager,
+					fakeProcessTracker,
+					fakeResolver,
+					[]string{},
+					linux_backend.ProcessDefaults{
+						User:       "image-user",
+						Dir:        "/image/dir",
+						Entrypoint: []string{"/image/entrypoint", "entrypoint-arg"},
+						Cmd:        []string{"cmd-arg"},
+					},
+					linux_backend.Security{},
+				)
+			})
 
-					process.WaitStub = func() (int, error) {
-						writing.Wait()
-						return 123, nil
-					}
+			It("runs the image's entrypoint and cmd as its user, in its directory, when the spec leaves them unset", func() {
+				_, err := container.Run(api.ProcessSpec{}, api.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
 
-					return process, nil
-				}
+				ranCmd, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Args).Should(Equal([]string{
+					containerDir + "/bin/wsh",
+					"--socket", containerDir + "/run/wshd.sock",
+					"--user", "image-user",
+					"--dir", "/image/dir",
+					"/image/entrypoint",
+					"entrypoint-arg",
+					"cmd-arg",
+				}))
 			})
 
-			It("streams stderr and stdout and exit status", func() {
-				stdout := gbytes.NewBuffer()
-				stderr := gbytes.NewBuffer()
-
-				process, err := container.Run(api.ProcessSpec{
-					Path: "/some/script",
-				}, api.ProcessIO{
-					Stdout: stdout,
-					Stderr: stderr,
-				})
+			It("passes the spec's args to the entrypoint instead of the cmd", func() {
+				_, err := container.Run(api.ProcessSpec{
+					Args: []string{"spec-arg"},
+				}, api.ProcessIO{})
 				Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(process.ID()).Should(Equal(uint32(42)))
-
+				ranCmd, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Args[len(ranCmd.Args)-3:]).Should(Equal([]string{
+					"/image/entrypoint",
+					"entrypoint-arg",
+					"spec-arg",
+				}))
+			})
+
+			It("prefers the spec's path, args and dir", func() {
+				_, err := container.Run(api.ProcessSpec{
+					Path: "/some/script",
+					Args: []string{"arg1"},
+					Dir:  "/some/dir",
+				}, api.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				ranCmd, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Args).Should(Equal([]string{
+					containerDir + "/bin/wsh",
+					"--socket", containerDir + "/run/wshd.sock",
+					"--user", "image-user",
+					"--dir", "/some/dir",
+					"/some/script",
+					"arg1",
+				}))
+			})
+
+			It("still runs privileged processes as root", func() {
+				_, err := container.Run(api.ProcessSpec{
+					Path:       "/some/script",
+					Privileged: true,
+				}, api.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				ranCmd, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Args).Should(ContainElement("root"))
+				Ω(ranCmd.Args).ShouldNot(ContainElement("image-user"))
+			})
+
+			Context("and the container specifies a user", func() {
+				BeforeEach(func() {
+					properties[linux_backend.UserProperty] = "alice"
+				})
+
+				It("runs processes as the container's user", func() {
+					_, err := container.Run(api.ProcessSpec{
+						Path: "/some/script",
+					}, api.ProcessIO{})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					ranCmd, _, _ := fakeProcessTracker.RunArgsForCall(0)
+					Ω(ranCmd.Args).Should(ContainElement("alice"))
+					Ω(ranCmd.Args).ShouldNot(ContainElement("image-user"))
+				})
+			})
+
+			It("snapshots them", func() {
+				out := new(bytes.Buffer)
+				err := container.Snapshot(out)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				var snapshot linux_backend.ContainerSnapshot
+				err = json.NewDecoder(out).Decode(&snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(snapshot.ProcessDefaults).Should(Equal(linux_backend.ProcessDefaults{
+					User:       "image-user",
+					Dir:        "/image/dir",
+					Entrypoint: []string{"/image/entrypoint", "entrypoint-arg"},
+					Cmd:        []string{"cmd-arg"},
+				}))
+			})
+		})
+
+		It("runs the script with a TTY if present", func() {
+			ttySpec := &api.TTYSpec{
+				WindowSize: &api.WindowSize{
+					Columns: 123,
+					Rows:    456,
+				},
+			}
+
+			_, err := container.Run(api.ProcessSpec{
+				Path: "/some/script",
+				TTY:  ttySpec,
+			}, api.ProcessIO{})
+
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, tty := fakeProcessTracker.RunArgsForCall(0)
+			Ω(tty).Should(Equal(ttySpec))
+		})
+
+		Describe("streaming", func() {
+			BeforeEach(func() {
+				fakeProcessTracker.RunStub = func(cmd *exec.Cmd, io api.ProcessIO, tty *api.TTYSpec) (api.Process, error) {
+					writing := new(sync.WaitGroup)
+					writing.Add(1)
+
+					go func() {
+						defer writing.Done()
+						defer GinkgoRecover()
+
+						_, err := fmt.Fprintf(io.Stdout, "hi out\n")
+						Ω(err).ShouldNot(HaveOccurred())
+
+						_, err = fmt.Fprintf(io.Stderr, "hi err\n")
+						Ω(err).ShouldNot(HaveOccurred())
+					}()
+
+					process := new(wfakes.FakeProcess)
+
+					process.IDReturns(42)
+
+					process.WaitStub = func() (int, error) {
+						writing.Wait()
+						return 123, nil
+					}
+
+					return process, nil
+				}
+			})
+
+			It("streams stderr and stdout and exit status", func() {
+				stdout := gbytes.NewBuffer()
+				stderr := gbytes.NewBuffer()
+
+				process, err := container.Run(api.ProcessSpec{
+					Path: "/some/script",
+				}, api.ProcessIO{
+					Stdout: stdout,
+					Stderr: stderr,
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(process.ID()).Should(Equal(uint32(42)))
+
 				Eventually(stdout).Should(gbytes.Say("hi out\n"))
 				Eventually(stderr).Should(gbytes.Say("hi err\n"))
 
@@ -1273,6 +2096,45 @@ var _ = Describe("Linux containers", func() {
 
 		})
 
+		Context("when the container may swap", func() {
+			BeforeEach(func() {
+				container = linux_backend.NewLinuxContainer(
+					lagertest.NewTestLogger("test"),
+					"some-id",
+					"some-handle",
+					containerDir,
+					map[string]string{
+						linux_backend.MemorySwapProperty: "1024",
+					},
+					1*time.Second,
+					containerResources,
+					fakePortPool,
+					fakeRunner,
+					fakeCgroups,
+					fakeQuotaManager,
+					fakeBandwidthManager,
+					fakeProcessTracker,
+					fakeResolver,
+					[]string{},
+					linux_backend.ProcessDefaults{},
+					linux_backend.Security{},
+				)
+			})
+
+			It("sets memory.memsw.limit_in_bytes to allow that much swap beyond the limit", func() {
+				err := container.LimitMemory(api.MemoryLimits{
+					LimitInBytes: 102400,
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeCgroups.SetValues()).Should(ContainElement(fake_cgroups_manager.SetValue{
+					Subsystem: "memory",
+					Name:      "memory.memsw.limit_in_bytes",
+					Value:     "103424",
+				}))
+			})
+		})
+
 		Context("when the oom notifier is already running", func() {
 			It("does not start another", func() {
 				started := 0
@@ -1609,6 +2471,7 @@ var _ = Describe("Linux containers", func() {
 					Env: []string{
 						"HOST_PORT=123",
 						"CONTAINER_PORT=456",
+						"PROTOCOL=tcp",
 						"PATH=" + os.Getenv("PATH"),
 					},
 				},
@@ -1618,6 +2481,39 @@ var _ = Describe("Linux containers", func() {
 			Ω(containerPort).Should(Equal(uint32(456)))
 		})
 
+		Context("when the mapping already exists", func() {
+			It("does not map it again", func() {
+				_, _, err := container.NetIn(123, 456)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				hostPort, containerPort, err := container.NetIn(123, 456)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(hostPort).Should(Equal(uint32(123)))
+				Ω(containerPort).Should(Equal(uint32(456)))
+
+				Ω(fakeRunner.ExecutedCommands()).Should(HaveLen(1))
+
+				info, err := container.Info()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(info.MappedPorts).Should(Equal([]api.PortMapping{
+					{HostPort: 123, ContainerPort: 456},
+				}))
+			})
+
+			Context("with the container port defaulted", func() {
+				It("does not map it again", func() {
+					_, _, err := container.NetIn(123, 0)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					_, _, err = container.NetIn(123, 123)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRunner.ExecutedCommands()).Should(HaveLen(1))
+				})
+			})
+		})
+
 		Context("when a host port is not provided", func() {
 			It("acquires one from the port pool", func() {
 				hostPort, containerPort, err := container.NetIn(0, 456)
@@ -1660,6 +2556,7 @@ var _ = Describe("Linux containers", func() {
 						Env: []string{
 							"HOST_PORT=123",
 							"CONTAINER_PORT=123",
+							"PROTOCOL=tcp",
 							"PATH=" + os.Getenv("PATH"),
 						},
 					},
@@ -1681,6 +2578,7 @@ var _ = Describe("Linux containers", func() {
 							Env: []string{
 								"HOST_PORT=1000",
 								"CONTAINER_PORT=1000",
+								"PROTOCOL=tcp",
 								"PATH=" + os.Getenv("PATH"),
 							},
 						},
@@ -1692,92 +2590,859 @@ var _ = Describe("Linux containers", func() {
 			})
 		})
 
-		Context("when net.sh fails", func() {
-			disaster := errors.New("oh no!")
-
+		Context("when the container maps udp as well as tcp", func() {
 			BeforeEach(func() {
-				fakeRunner.WhenRunning(
-					fake_command_runner.CommandSpec{
-						Path: containerDir + "/net.sh",
-					}, func(*exec.Cmd) error {
-						return disaster
+				container = linux_backend.NewLinuxContainer(
+					lagertest.NewTestLogger("test"),
+					"some-id",
+					"some-handle",
+					containerDir,
+					map[string]string{
+						linux_backend.NetInProtocolsProperty: "tcp,udp",
 					},
+					1*time.Second,
+					containerResources,
+					fakePortPool,
+					fakeRunner,
+					fakeCgroups,
+					fakeQuotaManager,
+					fakeBandwidthManager,
+					fakeProcessTracker,
+					fakeResolver,
+					[]string{},
+					linux_backend.ProcessDefaults{},
+					linux_backend.Security{},
 				)
 			})
 
-			It("returns the error", func() {
+			It("executes net.sh in for each protocol", func() {
 				_, _, err := container.NetIn(123, 456)
-				Ω(err).Should(Equal(disaster))
-			})
-		})
-	})
-
-	Describe("Net out", func() {
-		It("executes net.sh out with NETWORK and PORT", func() {
-			err := container.NetOut("1.2.3.4/22", 567)
-			Ω(err).ShouldNot(HaveOccurred())
-
-			Ω(fakeRunner).Should(HaveExecutedSerially(
-				fake_command_runner.CommandSpec{
-					Path: containerDir + "/net.sh",
-					Args: []string{"out"},
-					Env: []string{
-						"NETWORK=1.2.3.4/22",
-						"PORT=567",
-						"PATH=" + os.Getenv("PATH"),
-					},
-				},
-			))
-
-		})
-
-		Context("when port 0 is given", func() {
-			It("executes with PORT as an empty string", func() {
-				err := container.NetOut("1.2.3.4/22", 0)
 				Ω(err).ShouldNot(HaveOccurred())
 
 				Ω(fakeRunner).Should(HaveExecutedSerially(
 					fake_command_runner.CommandSpec{
 						Path: containerDir + "/net.sh",
-						Args: []string{"out"},
+						Args: []string{"in"},
 						Env: []string{
-							"NETWORK=1.2.3.4/22",
-							"PORT=",
+							"HOST_PORT=123",
+							"CONTAINER_PORT=456",
+							"PROTOCOL=tcp",
+							"PATH=" + os.Getenv("PATH"),
+						},
+					},
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"in"},
+						Env: []string{
+							"HOST_PORT=123",
+							"CONTAINER_PORT=456",
+							"PROTOCOL=udp",
 							"PATH=" + os.Getenv("PATH"),
 						},
 					},
 				))
-
 			})
 
-			Context("and a network is not given", func() {
-				It("returns an error", func() {
-					err := container.NetOut("", 0)
-					Ω(err).Should(HaveOccurred())
+			Context("when mapping the second protocol fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/net.sh",
+							Args: []string{"in"},
+							Env: []string{
+								"HOST_PORT=123",
+								"CONTAINER_PORT=456",
+								"PROTOCOL=udp",
+								"PATH=" + os.Getenv("PATH"),
+							},
+						}, func(*exec.Cmd) error {
+							return disaster
+						},
+					)
+				})
+
+				It("returns the error", func() {
+					_, _, err := container.NetIn(123, 456)
+					Ω(err).Should(Equal(disaster))
+				})
+
+				It("removes the rules mapped for the first protocol", func() {
+					container.NetIn(123, 456)
+
+					Ω(fakeRunner).Should(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/net.sh",
+							Args: []string{"remove_in"},
+							Env: []string{
+								"HOST_PORT=123",
+								"CONTAINER_PORT=456",
+								"PROTOCOL=tcp",
+								"PATH=" + os.Getenv("PATH"),
+							},
+						},
+					))
+
+					Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/net.sh",
+							Args: []string{"remove_in"},
+							Env: []string{
+								"HOST_PORT=123",
+								"CONTAINER_PORT=456",
+								"PROTOCOL=udp",
+								"PATH=" + os.Getenv("PATH"),
+							},
+						},
+					))
+				})
+
+				It("does not record the mapping", func() {
+					container.NetIn(123, 456)
+
+					err := container.NetInRemove(123, 456)
+					Ω(err).Should(Equal(linux_backend.NetInNotFoundError{HostPort: 123, ContainerPort: 456}))
 				})
 			})
 		})
 
-		Context("when net.sh fails", func() {
-			disaster := errors.New("oh no!")
-
+		Context("when the container's mappings are bound to a host interface and address", func() {
 			BeforeEach(func() {
-				fakeRunner.WhenRunning(
-					fake_command_runner.CommandSpec{
-						Path: containerDir + "/net.sh",
-					}, func(*exec.Cmd) error {
-						return disaster
+				container = linux_backend.NewLinuxContainer(
+					lagertest.NewTestLogger("test"),
+					"some-id",
+					"some-handle",
+					containerDir,
+					map[string]string{
+						linux_backend.NetInInterfaceProperty: "eth1",
+						linux_backend.NetInAddressProperty:   "10.0.0.5",
 					},
+					1*time.Second,
+					containerResources,
+					fakePortPool,
+					fakeRunner,
+					fakeCgroups,
+					fakeQuotaManager,
+					fakeBandwidthManager,
+					fakeProcessTracker,
+					fakeResolver,
+					[]string{},
+					linux_backend.ProcessDefaults{},
+					linux_backend.Security{},
 				)
 			})
 
-			It("returns the error", func() {
-				err := container.NetOut("1.2.3.4/22", 567)
-				Ω(err).Should(Equal(disaster))
-			})
-		})
-	})
-
+			It("passes them to net.sh in", func() {
+				_, _, err := container.NetIn(123, 456)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"in"},
+						Env: []string{
+							"HOST_PORT=123",
+							"CONTAINER_PORT=456",
+							"PROTOCOL=tcp",
+							"PATH=" + os.Getenv("PATH"),
+							"HOST_INTERFACE=eth1",
+							"HOST_ADDRESS=10.0.0.5",
+						},
+					},
+				))
+			})
+
+			It("passes them to net.sh remove_in, so that the same rule is removed", func() {
+				_, _, err := container.NetIn(123, 456)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.NetInRemove(123, 456)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"remove_in"},
+						Env: []string{
+							"HOST_PORT=123",
+							"CONTAINER_PORT=456",
+							"PROTOCOL=tcp",
+							"PATH=" + os.Getenv("PATH"),
+							"HOST_INTERFACE=eth1",
+							"HOST_ADDRESS=10.0.0.5",
+						},
+					},
+				))
+			})
+		})
+
+		Context("when net.sh fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				_, _, err := container.NetIn(123, 456)
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("Removing a net in", func() {
+		It("executes net.sh remove_in with HOST_PORT and CONTAINER_PORT", func() {
+			_, _, err := container.NetIn(123, 456)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = container.NetInRemove(123, 456)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/net.sh",
+					Args: []string{"remove_in"},
+					Env: []string{
+						"HOST_PORT=123",
+						"CONTAINER_PORT=456",
+						"PROTOCOL=tcp",
+						"PATH=" + os.Getenv("PATH"),
+					},
+				},
+			))
+
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(info.MappedPorts).Should(BeEmpty())
+		})
+
+		It("does not release a host port it did not acquire", func() {
+			_, _, err := container.NetIn(123, 456)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = container.NetInRemove(123, 456)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakePortPool.Released).Should(BeEmpty())
+		})
+
+		Context("when the host port was acquired from the pool", func() {
+			It("releases it", func() {
+				hostPort, _, err := container.NetIn(0, 456)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.NetInRemove(hostPort, 456)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakePortPool.Released).Should(Equal([]uint32{hostPort}))
+				Ω(container.Resources().Ports).ShouldNot(ContainElement(hostPort))
+			})
+
+			Context("and another mapping still uses it", func() {
+				It("keeps it", func() {
+					hostPort, _, err := container.NetIn(0, 456)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					_, _, err = container.NetIn(hostPort, 789)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = container.NetInRemove(hostPort, 456)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakePortPool.Released).Should(BeEmpty())
+					Ω(container.Resources().Ports).Should(ContainElement(hostPort))
+				})
+			})
+		})
+
+		Context("when there is no such mapping", func() {
+			It("returns a NetInNotFoundError", func() {
+				err := container.NetInRemove(123, 456)
+				Ω(err).Should(Equal(linux_backend.NetInNotFoundError{HostPort: 123, ContainerPort: 456}))
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+		})
+
+		Context("when net.sh fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"remove_in"},
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error and keeps the mapping", func() {
+				_, _, err := container.NetIn(123, 456)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.NetInRemove(123, 456)
+				Ω(err).Should(Equal(disaster))
+
+				info, err := container.Info()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(info.MappedPorts).Should(HaveLen(1))
+			})
+		})
+	})
+
+	Describe("Net out", func() {
+		It("executes net.sh out with NETWORK and PORT", func() {
+			err := container.NetOut("1.2.3.4/22", 567)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/net.sh",
+					Args: []string{"out"},
+					Env: []string{
+						"NETWORK=1.2.3.4/22",
+						"PORT=567",
+						"PATH=" + os.Getenv("PATH"),
+					},
+				},
+			))
+
+		})
+
+		Context("when port 0 is given", func() {
+			It("executes with PORT as an empty string", func() {
+				err := container.NetOut("1.2.3.4/22", 0)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"out"},
+						Env: []string{
+							"NETWORK=1.2.3.4/22",
+							"PORT=",
+							"PATH=" + os.Getenv("PATH"),
+						},
+					},
+				))
+
+			})
+
+			Context("and a network is not given", func() {
+				It("returns an error", func() {
+					err := container.NetOut("", 0)
+					Ω(err).Should(HaveOccurred())
+				})
+			})
+		})
+
+		Context("when net.sh fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				err := container.NetOut("1.2.3.4/22", 567)
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
+		Context("when a hostname is given", func() {
+			BeforeEach(func() {
+				fakeResolver.Resolves("api.example.com", "1.2.3.4", "5.6.7.8", "2001:db8::1")
+			})
+
+			It("allows each of its IPv4 addresses at once", func() {
+				err := container.NetOut("api.example.com", 443)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"out"},
+						Env: []string{
+							"NETWORK=1.2.3.4/32,5.6.7.8/32",
+							"PORT=443",
+							"PATH=" + os.Getenv("PATH"),
+						},
+					},
+				))
+
+				Ω(fakeRunner.ExecutedCommands()).Should(HaveLen(1))
+			})
+
+			It("snapshots the hostname rather than its addresses", func() {
+				err := container.NetOut("api.example.com", 443)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				out := new(bytes.Buffer)
+				err = container.Snapshot(out)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				var snapshot linux_backend.ContainerSnapshot
+				err = json.NewDecoder(out).Decode(&snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(snapshot.NetOuts).Should(Equal([]linux_backend.NetOutSpec{
+					{Network: "api.example.com", Port: 443},
+				}))
+			})
+
+			Context("and it fails to resolve", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeResolver.Fails("api.example.com", disaster)
+				})
+
+				It("returns the error", func() {
+					err := container.NetOut("api.example.com", 443)
+					Ω(err).Should(Equal(disaster))
+
+					Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+				})
+			})
+
+			Context("and it has no IPv4 addresses", func() {
+				BeforeEach(func() {
+					fakeResolver.Resolves("api.example.com", "2001:db8::1")
+				})
+
+				It("returns a NoAddressesError", func() {
+					err := container.NetOut("api.example.com", 443)
+					Ω(err).Should(Equal(linux_backend.NoAddressesError{Hostname: "api.example.com"}))
+				})
+			})
+
+			Describe("refreshing", func() {
+				BeforeEach(func() {
+					err := container.NetOut("api.example.com", 443)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = container.NetOut("1.2.3.4/22", 567)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					fakeResolver.Resolves("api.example.com", "5.6.7.8", "9.9.9.9")
+				})
+
+				It("allows new addresses and revokes ones that are gone", func() {
+					err := container.RefreshNetOuts()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRunner.ExecutedCommands()).Should(HaveLen(4))
+
+					Ω(fakeRunner).Should(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/net.sh",
+							Args: []string{"out"},
+							Env: []string{
+								"NETWORK=9.9.9.9/32",
+								"PORT=443",
+								"PATH=" + os.Getenv("PATH"),
+							},
+						},
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/net.sh",
+							Args: []string{"remove_out"},
+							Env: []string{
+								"NETWORK=1.2.3.4/32",
+								"PORT=443",
+								"PATH=" + os.Getenv("PATH"),
+							},
+						},
+					))
+				})
+
+				It("does nothing when the addresses have not changed", func() {
+					err := container.RefreshNetOuts()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					commands := len(fakeRunner.ExecutedCommands())
+
+					err = container.RefreshNetOuts()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRunner.ExecutedCommands()).Should(HaveLen(commands))
+				})
+
+				Context("when the hostname fails to resolve", func() {
+					disaster := errors.New("oh no!")
+
+					BeforeEach(func() {
+						fakeResolver.Fails("api.example.com", disaster)
+					})
+
+					It("keeps the previous addresses and returns the error", func() {
+						err := container.RefreshNetOuts()
+						Ω(err).Should(Equal(disaster))
+
+						Ω(fakeRunner.ExecutedCommands()).Should(HaveLen(2))
+					})
+				})
+			})
+		})
+	})
+
+	Describe("Repairing the network", func() {
+		Context("when the container is active", func() {
+			BeforeEach(func() {
+				err := container.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("repairs it with the container's net.sh", func() {
+				err := container.RepairNetwork()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"repair"},
+					},
+				))
+			})
+
+			It("applies the container's bandwidth limits again", func() {
+				limits := api.BandwidthLimits{
+					RateInBytesPerSecond:      128,
+					BurstRateInBytesPerSecond: 256,
+				}
+
+				err := container.LimitBandwidth(limits)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.RepairNetwork()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeBandwidthManager.EnforcedLimits).Should(Equal([]api.BandwidthLimits{limits, limits}))
+			})
+
+			Context("when the container's bandwidth is not limited", func() {
+				It("does not limit it", func() {
+					err := container.RepairNetwork()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeBandwidthManager.EnforcedLimits).Should(BeEmpty())
+				})
+			})
+
+			Context("when net.sh fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/net.sh",
+							Args: []string{"repair"},
+						}, func(*exec.Cmd) error {
+							return disaster
+						},
+					)
+				})
+
+				It("returns the error", func() {
+					err := container.RepairNetwork()
+					Ω(err).Should(Equal(disaster))
+				})
+			})
+		})
+
+		Context("when the container is not active", func() {
+			It("returns an InvalidStateError", func() {
+				err := container.RepairNetwork()
+				Ω(err).Should(Equal(linux_backend.InvalidStateError{State: linux_backend.StateBorn}))
+			})
+		})
+	})
+
+	Describe("Network stats", func() {
+		var statsErr error
+
+		BeforeEach(func() {
+			statsErr = nil
+
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/net.sh",
+					Args: []string{"stats"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(`rx_bytes=100
+rx_packets=10
+rx_dropped=1
+tx_bytes=200
+tx_packets=20
+tx_dropped=2
+forwarded_packets=5
+forwarded_bytes=50
+`))
+					return statsErr
+				},
+			)
+		})
+
+		It("reports the traffic from the container's point of view", func() {
+			stat, err := container.NetworkStat()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(stat).Should(Equal(linux_backend.ContainerNetworkStat{
+				RxBytes:   200,
+				RxPackets: 20,
+				RxDropped: 2,
+
+				TxBytes:   100,
+				TxPackets: 10,
+				TxDropped: 1,
+
+				ForwardedBytes:   50,
+				ForwardedPackets: 5,
+			}))
+		})
+
+		It("reports the container's rate limits and the traffic through them", func() {
+			fakeBandwidthManager.GetLimitsResult = api.ContainerBandwidthStat{
+				InRate:   1,
+				InBurst:  2,
+				OutRate:  3,
+				OutBurst: 4,
+			}
+
+			fakeBandwidthManager.GetUsageResult = bandwidth_manager.ContainerBandwidthUsage{
+				InBytes:   100,
+				InDropped: 1,
+				OutBytes:  200,
+			}
+
+			stat, err := container.NetworkStat()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(stat.Bandwidth).Should(Equal(linux_backend.ContainerBandwidthStat{
+				Limits: fakeBandwidthManager.GetLimitsResult,
+				Usage:  fakeBandwidthManager.GetUsageResult,
+			}))
+		})
+
+		Context("when net.sh fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				statsErr = disaster
+			})
+
+			It("returns the error", func() {
+				_, err := container.NetworkStat()
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
+		Context("when getting the bandwidth limits fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeBandwidthManager.GetLimitsError = disaster
+			})
+
+			It("returns the error", func() {
+				_, err := container.NetworkStat()
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
+		Context("when getting the bandwidth usage fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeBandwidthManager.GetUsageError = disaster
+			})
+
+			It("returns the error", func() {
+				_, err := container.NetworkStat()
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("Network interfaces", func() {
+		BeforeEach(func() {
+			err := os.MkdirAll(filepath.Join(containerDir, "etc"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(containerDir, "etc", "config"), []byte(`id=some-id
+network_host_iface=w0some-id-0
+network_container_iface=w0some-id-1
+network_bridge=some-bridge
+`), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("reports the container's interfaces and network", func() {
+			interfaces, err := container.NetworkInterfaces()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(interfaces.HostIface).Should(Equal("w0some-id-0"))
+			Ω(interfaces.ContainerIface).Should(Equal("w0some-id-1"))
+			Ω(interfaces.Bridge).Should(Equal("some-bridge"))
+
+			Ω(interfaces.HostIP.String()).Should(Equal("10.254.0.1"))
+			Ω(interfaces.ContainerIP.String()).Should(Equal("10.254.0.2"))
+			Ω(interfaces.Subnet.String()).Should(Equal("10.254.0.0/30"))
+		})
+
+		Context("when the container has no config", func() {
+			BeforeEach(func() {
+				err := os.Remove(filepath.Join(containerDir, "etc", "config"))
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("returns an error", func() {
+				_, err := container.NetworkInterfaces()
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Bundle", func() {
+		BeforeEach(func() {
+			err := os.MkdirAll(filepath.Join(containerDir, "etc"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(containerDir, "etc", "config"), []byte(`id=some-id
+network_host_ip=10.254.0.1
+network_host_iface=w0some-id-0
+network_container_ip=10.254.0.2
+network_container_iface=w0some-id-1
+user_uid=10001
+drop_capabilities=2,9
+read_only_rootfs=true
+scratch_size=0
+disable_snat=false
+cpu_quota_us=50000
+cpu_period_us=100000
+cpuset_cpus=0-1
+pids_max=512
+blkio_read_bps=1048576
+blkio_write_bps=0
+rootfs_path=/some/rootfs
+tmpfs_mounts=/var/lib/db:1048576,/cache
+shm_size=67108864
+core_dumps=collect
+`), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = os.MkdirAll(filepath.Join(containerDir, "lib"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(containerDir, "lib", "hook-child-before-pivot.sh"), []byte(`#!/bin/bash
+cp bin/wshd $rootfs_path/sbin/wshd
+
+mkdir -p /some/rootfs/data
+mount -n --bind /var/data /some/rootfs/data
+
+mkdir -p /some/rootfs/etc/config
+mount -n --bind /etc/shared /some/rootfs/etc/config
+mount -n -o remount,bind,ro /some/rootfs/etc/config
+`), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("describes the container's rootfs, process and mounts", func() {
+			bundle, err := container.Bundle()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(bundle.OCIVersion).Should(Equal(linux_backend.BundleOCIVersion))
+			Ω(bundle.Root).Should(Equal(linux_backend.BundleRoot{Path: "/some/rootfs", Readonly: true}))
+			Ω(bundle.Hostname).Should(Equal("some-id"))
+			Ω(bundle.Process.User.UID).Should(Equal(uint32(10001)))
+			Ω(bundle.Process.Env).Should(Equal([]string{"env1=env1Value", "env2=env2Value"}))
+
+			Ω(bundle.Mounts).Should(Equal([]linux_backend.BundleMount{
+				{Destination: "/data", Type: "bind", Source: "/var/data", Options: []string{"bind", "rw"}},
+				{Destination: "/etc/config", Type: "bind", Source: "/etc/shared", Options: []string{"bind", "ro"}},
+				{Destination: "/var/lib/db", Type: "tmpfs", Source: "tmpfs", Options: []string{"mode=1777", "size=1048576"}},
+				{Destination: "/cache", Type: "tmpfs", Source: "tmpfs", Options: []string{"mode=1777"}},
+			}))
+		})
+
+		It("gives the paths of the container's namespaces", func() {
+			bundle, err := container.Bundle()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(bundle.Linux.Namespaces).Should(ContainElement(linux_backend.BundleNamespace{
+				Type: "network",
+				Path: "/proc/12345/ns/net",
+			}))
+			Ω(bundle.Linux.Namespaces).Should(HaveLen(5))
+		})
+
+		It("describes the container's limits", func() {
+			err := container.LimitMemory(api.MemoryLimits{LimitInBytes: 1024})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = container.LimitCPU(api.CPULimits{LimitInShares: 512})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			bundle, err := container.Bundle()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(bundle.Linux.Resources.Memory).Should(Equal(&linux_backend.BundleMemory{Limit: 1024, Swap: 1024}))
+			Ω(bundle.Linux.Resources.CPU).Should(Equal(&linux_backend.BundleCPU{
+				Shares: 512,
+				Quota:  50000,
+				Period: 100000,
+				Cpus:   "0-1",
+			}))
+			Ω(bundle.Linux.Resources.Pids).Should(Equal(&linux_backend.BundlePids{Limit: 512}))
+
+			Ω(bundle.Annotations).Should(HaveKeyWithValue("garden.blkio-read-bps", "1048576"))
+			Ω(bundle.Annotations).Should(HaveKeyWithValue("garden.shm-size", "67108864"))
+			Ω(bundle.Annotations).Should(HaveKeyWithValue("garden.core-dumps", "collect"))
+			Ω(bundle.Annotations).ShouldNot(HaveKey("garden.blkio-write-bps"))
+			Ω(bundle.Annotations).Should(HaveKeyWithValue("garden.drop-capabilities", "2,9"))
+		})
+
+		It("describes the container's network", func() {
+			_, _, err := container.NetIn(1234, 5678)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			bundle, err := container.Bundle()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(bundle.Annotations).Should(HaveKeyWithValue("garden.network.host-ip", "10.254.0.1"))
+			Ω(bundle.Annotations).Should(HaveKeyWithValue("garden.network.container-ip", "10.254.0.2"))
+			Ω(bundle.Annotations).Should(HaveKeyWithValue("garden.network.prefix-length", "30"))
+			Ω(bundle.Annotations).Should(HaveKeyWithValue("garden.network.host-iface", "w0some-id-0"))
+			Ω(bundle.Annotations).Should(HaveKeyWithValue("garden.net-in.1234", "5678"))
+		})
+
+		Context("when the container has no config", func() {
+			BeforeEach(func() {
+				err := os.Remove(filepath.Join(containerDir, "etc", "config"))
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("returns an error", func() {
+				_, err := container.Bundle()
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
 	Describe("Info", func() {
 		It("returns the container's state", func() {
 			info, err := container.Info()
@@ -1793,11 +3458,60 @@ var _ = Describe("Linux containers", func() {
 			Ω(info.Events).Should(Equal([]string{}))
 		})
 
-		It("returns the container's properties", func() {
+		It("returns the container's properties, along with its network namespace", func() {
 			info, err := container.Info()
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(info.Properties).Should(Equal(container.Properties()))
+			expected := api.Properties{
+				linux_backend.NetworkNamespaceProperty: "/proc/12345/ns/net",
+
+				linux_backend.SecurityPrivilegedProperty:          "false",
+				linux_backend.SecurityDroppedCapabilitiesProperty: "CAP_SYS_ADMIN,CAP_SYS_MODULE",
+				linux_backend.SecurityUserNamespaceProperty:       "false",
+				linux_backend.SecurityUIDProperty:                 "1234",
+				linux_backend.SecuritySeccompProperty:             "unconfined",
+				linux_backend.SecurityAppArmorProperty:            "unconfined",
+			}
+
+			for key, value := range container.Properties() {
+				expected[key] = value
+			}
+
+			Ω(info.Properties).Should(Equal(expected))
+			Ω(container.Properties()).ShouldNot(HaveKey(linux_backend.NetworkNamespaceProperty))
+			Ω(container.Properties()).ShouldNot(HaveKey(linux_backend.SecurityPrivilegedProperty))
+		})
+
+		Context("when the container was given an external IP", func() {
+			BeforeEach(func() {
+				err := os.MkdirAll(filepath.Join(containerDir, "etc"), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(filepath.Join(containerDir, "etc", "config"), []byte("id=some-id\nsnat_ip=203.0.113.1\n"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("reports it", func() {
+				info, err := container.Info()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(info.Properties[linux_backend.ExternalIPProperty]).Should(Equal("203.0.113.1"))
+				Ω(container.Properties()).ShouldNot(HaveKey(linux_backend.ExternalIPProperty))
+			})
+		})
+
+		Context("when the container has no wshd pid", func() {
+			BeforeEach(func() {
+				err := os.Remove(filepath.Join(containerDir, "run", "wshd.pid"))
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("does not report a network namespace", func() {
+				info, err := container.Info()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(info.Properties).ShouldNot(HaveKey(linux_backend.NetworkNamespaceProperty))
+			})
 		})
 
 		It("returns the container's network info", func() {
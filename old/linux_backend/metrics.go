@@ -0,0 +1,43 @@
+package linux_backend
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/dropsonde/autowire/metrics"
+	"github.com/pivotal-golang/lager"
+)
+
+// the duration of each stage of creating a container, in nanoseconds
+const (
+	// acquiring a uid and network from the pools
+	CreateAcquireDuration = "ContainerCreateAcquireDuration"
+
+	// fetching or locating the rootfs
+	CreateRootFSDuration = "ContainerCreateRootFSDuration"
+
+	// create.sh: copying the skeleton, mounting the rootfs, and configuring
+	// quotas and the container's files
+	CreateSetupDuration = "ContainerCreateSetupDuration"
+
+	// mounting the bind mounts
+	CreateBindMountsDuration = "ContainerCreateBindMountsDuration"
+
+	// start.sh: setting up the network and iptables, and starting wshd
+	CreateStartDuration = "ContainerCreateStartDuration"
+
+	// all of the above
+	CreateDuration = "ContainerCreateDuration"
+)
+
+// ReportDuration sends the time since started as the given metric, and logs it
+// so that a single slow create can be broken down too.
+func ReportDuration(logger lager.Logger, metric string, started time.Time) {
+	took := time.Since(started)
+
+	logger.Debug("duration", lager.Data{
+		"metric": metric,
+		"took":   took.String(),
+	})
+
+	metrics.SendValue(metric, float64(took), "nanos")
+}
@@ -0,0 +1,99 @@
+package linux_backend_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("net.sh", func() {
+	var containerDir string
+	var binDir string
+
+	fakeCommand := func(name, script string) {
+		err := ioutil.WriteFile(filepath.Join(binDir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		containerDir, err = ioutil.TempDir("", "container-dir")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		binDir = filepath.Join(containerDir, "fake-bin")
+
+		err = os.MkdirAll(filepath.Join(containerDir, "etc"), 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = os.MkdirAll(binDir, 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		netSh, err := ioutil.ReadFile(filepath.Join("skeleton", "net.sh"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = ioutil.WriteFile(filepath.Join(containerDir, "net.sh"), netSh, 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = ioutil.WriteFile(filepath.Join(containerDir, "etc", "config"), []byte(`id=some-id
+network_host_iface=w0some-id-0
+GARDEN_IPTABLES_FILTER_FORWARD_CHAIN=w--forward
+GARDEN_IPTABLES_FILTER_DEFAULT_CHAIN=w--default
+GARDEN_IPTABLES_FILTER_INSTANCE_PREFIX=w--instance-
+GARDEN_IPTABLES_NAT_PREROUTING_CHAIN=w--prerouting
+GARDEN_IPTABLES_NAT_POSTROUTING_CHAIN=w--postrouting
+GARDEN_IPTABLES_NAT_INSTANCE_PREFIX=w--instance-
+GARDEN_NETWORK_INTERFACE_PREFIX=w
+`), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		// there are no interfaces to look up the route or counters of; the
+		// iptables listings are fed through /bin/cat
+		fakeCommand("ip", "")
+		fakeCommand("cat", "echo 0")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(containerDir)
+	})
+
+	stats := func() string {
+		cmd := exec.Command(filepath.Join(containerDir, "net.sh"), "stats")
+		cmd.Env = []string{"PATH=" + binDir + ":" + os.Getenv("PATH")}
+
+		out, err := cmd.Output()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return string(out)
+	}
+
+	Describe("stats", func() {
+		It("reports what the container forwarded", func() {
+			fakeCommand("iptables", `/bin/cat <<EOF
+Chain w--forward (1 references)
+    pkts      bytes target     prot opt in     out     source               destination
+       1       10 w--instance-other-id  all  --  w0other-id-0 *       0.0.0.0/0            0.0.0.0/0           [goto]
+       5       50 w--instance-some-id  all  --  w0some-id-0 *       0.0.0.0/0            0.0.0.0/0           [goto]
+EOF`)
+
+			Ω(stats()).Should(ContainSubstring("forwarded_packets=5\nforwarded_bytes=50\n"))
+		})
+
+		Context("when the container is on a bridge", func() {
+			It("reports what the container forwarded through its bridge port", func() {
+				fakeCommand("iptables", `/bin/cat <<EOF
+Chain w--forward (1 references)
+    pkts      bytes target     prot opt in     out     source               destination
+       1       10 w--instance-other-id  all  --  *      *       0.0.0.0/0            0.0.0.0/0            PHYSDEV match --physdev-in w0other-id-0 [goto]
+       5       50 w--instance-some-id  all  --  *      *       0.0.0.0/0            0.0.0.0/0            PHYSDEV match --physdev-in w0some-id-0 [goto]
+EOF`)
+
+				Ω(stats()).Should(ContainSubstring("forwarded_packets=5\nforwarded_bytes=50\n"))
+			})
+		})
+	})
+})
@@ -0,0 +1,163 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// ContainerConfig describes the container's side of its network, as set up
+// from within the container's network namespace.
+type ContainerConfig struct {
+	// the container's end of its veth pair
+	Interface string
+
+	// the container's address, and the prefix length of its network
+	IP           net.IP
+	PrefixLength int
+
+	// the host's address, which is the container's default gateway
+	HostIP net.IP
+
+	// 0 leaves the interface's MTU as it is
+	MTU int
+
+	// the host's address is outside the container's network, as when it is
+	// given a /32, so is routed to directly over the interface
+	Routed bool
+
+	// resolve every other address in the container's network to the
+	// hardware address NeighbourMAC gives it, rather than with ARP; for
+	// containers sharing a bridge, whose MACs are all given this way
+	StaticNeighbours bool
+}
+
+type ConfigureError struct {
+	Step string
+	Err  error
+}
+
+func (e ConfigureError) Error() string {
+	return fmt.Sprintf("failed to %s: %s", e.Step, e.Err)
+}
+
+// Configurer sets up a container's network from within its network
+// namespace. It talks rtnetlink directly, so the container's rootfs need not
+// provide iproute2, and IPv4 and IPv6 addresses are handled alike.
+type Configurer struct{}
+
+func (Configurer) ConfigureContainer(config ContainerConfig) error {
+	nl, err := openNetlink()
+	if err != nil {
+		return ConfigureError{"open netlink socket", err}
+	}
+
+	defer nl.Close()
+
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		return ConfigureError{"find loopback interface", err}
+	}
+
+	err = nl.addAddress(lo.Index, net.IPv4(127, 0, 0, 1), 8)
+	if err != nil {
+		return ConfigureError{"add loopback address", err}
+	}
+
+	err = nl.setLinkUp(lo.Index, 0)
+	if err != nil {
+		return ConfigureError{"bring up loopback interface", err}
+	}
+
+	iface, err := net.InterfaceByName(config.Interface)
+	if err != nil {
+		return ConfigureError{"find container interface", err}
+	}
+
+	err = nl.addAddress(iface.Index, config.IP, config.PrefixLength)
+	if err != nil {
+		return ConfigureError{"add container address", err}
+	}
+
+	err = nl.setLinkUp(iface.Index, config.MTU)
+	if err != nil {
+		return ConfigureError{"bring up container interface", err}
+	}
+
+	if config.Routed {
+		bits := 8 * len(addressBytes(config.HostIP))
+
+		err = nl.addRoute(iface.Index, &net.IPNet{
+			IP:   config.HostIP,
+			Mask: net.CIDRMask(bits, bits),
+		}, nil)
+		if err != nil {
+			return ConfigureError{"add route to host", err}
+		}
+	}
+
+	err = nl.addRoute(iface.Index, nil, config.HostIP)
+	if err != nil {
+		return ConfigureError{"add default route", err}
+	}
+
+	if config.StaticNeighbours {
+		if config.IP.To4() == nil {
+			return ConfigureError{"add static neighbours", errors.New("only IPv4 networks are supported")}
+		}
+
+		bits := 8 * len(addressBytes(config.IP))
+
+		subnet := &net.IPNet{
+			IP:   config.IP.Mask(net.CIDRMask(config.PrefixLength, bits)),
+			Mask: net.CIDRMask(config.PrefixLength, bits),
+		}
+
+		for ip := nextIP(subnet.IP); subnet.Contains(ip); ip = nextIP(ip) {
+			if !subnet.Contains(nextIP(ip)) {
+				// broadcast address
+				break
+			}
+
+			// the host's MAC is the bridge's own, which is left to ARP
+			if ip.Equal(config.IP) || ip.Equal(config.HostIP) {
+				continue
+			}
+
+			err = nl.addNeighbour(iface.Index, ip, NeighbourMAC(ip))
+			if err != nil {
+				return ConfigureError{"add neighbour " + ip.String(), err}
+			}
+		}
+	}
+
+	return nil
+}
+
+// NeighbourMAC is the locally administered hardware address given to the
+// container with the IPv4 address ip when static neighbours are enabled,
+// 02:00 followed by the address's octets. It must match the address
+// setup.sh gives the container's interface.
+func NeighbourMAC(ip net.IP) net.HardwareAddr {
+	ip4 := ip.To4()
+	return net.HardwareAddr{0x02, 0x00, ip4[0], ip4[1], ip4[2], ip4[3]}
+}
+
+// family returns the address family of the IP, e.g. AF_INET
+func family(ip net.IP) uint8 {
+	if ip.To4() != nil {
+		return syscall.AF_INET
+	}
+
+	return syscall.AF_INET6
+}
+
+// addressBytes returns the IP as 4 bytes for IPv4, or 16 for IPv6
+func addressBytes(ip net.IP) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+
+	return ip.To16()
+}
@@ -0,0 +1,208 @@
+package network
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// netlinkSocket makes rtnetlink requests, each acknowledged before the next
+type netlinkSocket struct {
+	fd  int
+	seq uint32
+}
+
+func openNetlink() (*netlinkSocket, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	return &netlinkSocket{fd: fd}, nil
+}
+
+func (s *netlinkSocket) Close() error {
+	return syscall.Close(s.fd)
+}
+
+func (s *netlinkSocket) addAddress(index int, ip net.IP, prefixLength int) error {
+	msg := syscall.IfAddrmsg{
+		Family:    family(ip),
+		Prefixlen: uint8(prefixLength),
+		Index:     uint32(index),
+	}
+
+	payload := structBytes(unsafe.Pointer(&msg), syscall.SizeofIfAddrmsg)
+	payload = append(payload, routeAttr(syscall.IFA_LOCAL, addressBytes(ip))...)
+	payload = append(payload, routeAttr(syscall.IFA_ADDRESS, addressBytes(ip))...)
+
+	return s.request(syscall.RTM_NEWADDR, syscall.NLM_F_CREATE|syscall.NLM_F_REPLACE, payload)
+}
+
+func (s *netlinkSocket) setLinkUp(index int, mtu int) error {
+	msg := syscall.IfInfomsg{
+		Family: syscall.AF_UNSPEC,
+		Index:  int32(index),
+		Flags:  syscall.IFF_UP,
+		Change: syscall.IFF_UP,
+	}
+
+	payload := structBytes(unsafe.Pointer(&msg), syscall.SizeofIfInfomsg)
+	if mtu > 0 {
+		payload = append(payload, routeAttr(syscall.IFLA_MTU, uint32Bytes(uint32(mtu)))...)
+	}
+
+	return s.request(syscall.RTM_NEWLINK, 0, payload)
+}
+
+// from linux/neighbour.h, which the syscall package lacks
+const (
+	ndaDst    = 1
+	ndaLLAddr = 2
+
+	sizeofNdMsg = 12
+)
+
+type ndMsg struct {
+	Family  uint8
+	Pad1    uint8
+	Pad2    uint16
+	Ifindex int32
+	State   uint16
+	Flags   uint8
+	Type    uint8
+}
+
+// addNeighbour permanently resolves the IP to the hardware address on the
+// interface, so that it is never looked up with ARP
+func (s *netlinkSocket) addNeighbour(index int, ip net.IP, mac net.HardwareAddr) error {
+	msg := ndMsg{
+		Family:  family(ip),
+		Ifindex: int32(index),
+		State:   0x80, // NUD_PERMANENT
+	}
+
+	payload := structBytes(unsafe.Pointer(&msg), sizeofNdMsg)
+	payload = append(payload, routeAttr(ndaDst, addressBytes(ip))...)
+	payload = append(payload, routeAttr(ndaLLAddr, mac)...)
+
+	return s.request(syscall.RTM_NEWNEIGH, syscall.NLM_F_CREATE|syscall.NLM_F_REPLACE, payload)
+}
+
+// addRoute routes dst, or everything if nil, over the interface; via the
+// gateway if given, or else directly
+func (s *netlinkSocket) addRoute(index int, dst *net.IPNet, gateway net.IP) error {
+	msg := syscall.RtMsg{
+		Table:    syscall.RT_TABLE_MAIN,
+		Protocol: syscall.RTPROT_BOOT,
+		Scope:    syscall.RT_SCOPE_UNIVERSE,
+		Type:     syscall.RTN_UNICAST,
+	}
+
+	attrs := []byte{}
+
+	if dst != nil {
+		ones, _ := dst.Mask.Size()
+
+		msg.Family = family(dst.IP)
+		msg.Dst_len = uint8(ones)
+
+		attrs = append(attrs, routeAttr(syscall.RTA_DST, addressBytes(dst.IP))...)
+	}
+
+	if gateway != nil {
+		msg.Family = family(gateway)
+
+		attrs = append(attrs, routeAttr(syscall.RTA_GATEWAY, addressBytes(gateway))...)
+	} else {
+		msg.Scope = syscall.RT_SCOPE_LINK
+	}
+
+	attrs = append(attrs, routeAttr(syscall.RTA_OIF, uint32Bytes(uint32(index)))...)
+
+	payload := append(structBytes(unsafe.Pointer(&msg), syscall.SizeofRtMsg), attrs...)
+
+	return s.request(syscall.RTM_NEWROUTE, syscall.NLM_F_CREATE|syscall.NLM_F_REPLACE, payload)
+}
+
+// request sends a message and waits for the kernel's acknowledgement,
+// returning the error it carries
+func (s *netlinkSocket) request(msgType uint16, flags uint16, payload []byte) error {
+	s.seq++
+
+	header := syscall.NlMsghdr{
+		Len:   uint32(syscall.NLMSG_HDRLEN + len(payload)),
+		Type:  msgType,
+		Flags: flags | syscall.NLM_F_REQUEST | syscall.NLM_F_ACK,
+		Seq:   s.seq,
+	}
+
+	msg := append(structBytes(unsafe.Pointer(&header), syscall.SizeofNlMsghdr), payload...)
+
+	err := syscall.Sendto(s.fd, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, syscall.Getpagesize())
+
+	for {
+		n, _, err := syscall.Recvfrom(s.fd, buf, 0)
+		if err != nil {
+			return err
+		}
+
+		replies, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return err
+		}
+
+		for _, reply := range replies {
+			if reply.Header.Seq != s.seq || reply.Header.Type != syscall.NLMSG_ERROR {
+				continue
+			}
+
+			// the error is the negated errno, or 0 for success
+			errno := -*(*int32)(unsafe.Pointer(&reply.Data[0]))
+			if errno != 0 {
+				return syscall.Errno(errno)
+			}
+
+			return nil
+		}
+	}
+}
+
+// routeAttr encodes an rtnetlink attribute, padded to the netlink alignment
+func routeAttr(attrType uint16, value []byte) []byte {
+	attr := syscall.RtAttr{
+		Len:  uint16(syscall.SizeofRtAttr + len(value)),
+		Type: attrType,
+	}
+
+	encoded := append(structBytes(unsafe.Pointer(&attr), syscall.SizeofRtAttr), value...)
+
+	for len(encoded)%syscall.RTA_ALIGNTO != 0 {
+		encoded = append(encoded, 0)
+	}
+
+	return encoded
+}
+
+// uint32Bytes encodes the value in the host's byte order, as netlink expects
+func uint32Bytes(value uint32) []byte {
+	return structBytes(unsafe.Pointer(&value), 4)
+}
+
+// structBytes copies the size bytes at ptr
+func structBytes(ptr unsafe.Pointer, size int) []byte {
+	encoded := make([]byte, size)
+	copy(encoded, (*[1 << 16]byte)(ptr)[:size:size])
+	return encoded
+}
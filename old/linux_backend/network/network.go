@@ -20,6 +20,34 @@ func New(ipNet *net.IPNet) *Network {
 	}
 }
 
+// NewBridged returns a network for a container attached to a shared bridge
+// whose address is hostIP, in which the container is given containerIP out
+// of the bridge's network, ipNet.
+func NewBridged(ipNet *net.IPNet, hostIP, containerIP net.IP) *Network {
+	return &Network{
+		ipNet: &net.IPNet{
+			IP:   containerIP,
+			Mask: ipNet.Mask,
+		},
+		hostIP:      hostIP,
+		containerIP: containerIP,
+	}
+}
+
+// NewRouted returns a network for a container given just containerIP, which
+// reaches the host's address, hostIP, directly over its link rather than
+// through a shared subnet.
+func NewRouted(hostIP, containerIP net.IP) *Network {
+	return &Network{
+		ipNet: &net.IPNet{
+			IP:   containerIP,
+			Mask: net.CIDRMask(8*len(containerIP), 8*len(containerIP)),
+		},
+		hostIP:      hostIP,
+		containerIP: containerIP,
+	}
+}
+
 func (n Network) String() string {
 	return n.ipNet.String()
 }
@@ -28,6 +56,11 @@ func (n Network) IP() net.IP {
 	return n.ipNet.IP
 }
 
+func (n Network) PrefixLength() int {
+	ones, _ := n.ipNet.Mask.Size()
+	return ones
+}
+
 func (n Network) HostIP() net.IP {
 	return n.hostIP
 }
@@ -58,11 +91,19 @@ func (n *Network) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	_, ipNet, err := net.ParseCIDR(tmp.IPNet)
+	ip, ipNet, err := net.ParseCIDR(tmp.IPNet)
 	if err != nil {
 		return err
 	}
 
+	// bridged networks are identified by the container's address rather
+	// than the network's
+	if ip4 := ip.To4(); ip4 != nil {
+		ipNet.IP = ip4
+	} else {
+		ipNet.IP = ip
+	}
+
 	n.ipNet = ipNet
 	n.hostIP = tmp.HostIP
 	n.containerIP = tmp.ContainerIP
@@ -0,0 +1,143 @@
+package network_pool
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+	"github.com/pivotal-golang/lager"
+)
+
+// IPAMDriver allocates containers' networks from an external IPAM system,
+// which owns the addresses in the pool's network.
+type IPAMDriver interface {
+	Allocate(handle string) (*network.Network, error)
+	Release(handle string, network *network.Network) error
+}
+
+// ExternalNetworkPool is a NetworkPool that defers to an external IPAM
+// system through an IPAMDriver, so that containers' addresses can be managed
+// centrally rather than by each host.
+type ExternalNetworkPool struct {
+	logger lager.Logger
+
+	ipNet       *net.IPNet
+	initialSize int
+
+	driver IPAMDriver
+
+	allocated      map[string]*network.Network
+	allocatedMutex *sync.Mutex
+}
+
+type NetworkOutOfPoolError struct {
+	Handle  string
+	Network *network.Network
+	Pool    *net.IPNet
+}
+
+func (e NetworkOutOfPoolError) Error() string {
+	return fmt.Sprintf("network %s for %s is outside of the network pool %s", e.Network.String(), e.Handle, e.Pool.String())
+}
+
+// NewExternal returns a pool of initialSize networks in ipNet, allocated by
+// driver. The networks must be within ipNet, as that is what the host's
+// firewall and NAT rules are set up for.
+func NewExternal(logger lager.Logger, ipNet *net.IPNet, initialSize int, driver IPAMDriver) *ExternalNetworkPool {
+	return &ExternalNetworkPool{
+		logger: logger.Session("external-network-pool"),
+
+		ipNet:       ipNet,
+		initialSize: initialSize,
+
+		driver: driver,
+
+		allocated:      make(map[string]*network.Network),
+		allocatedMutex: new(sync.Mutex),
+	}
+}
+
+func (p *ExternalNetworkPool) Acquire(handle string) (*network.Network, error) {
+	acquired, err := p.driver.Allocate(handle)
+	if err != nil {
+		p.logger.Error("allocate-failed", err, lager.Data{"handle": handle})
+		return nil, err
+	}
+
+	if !p.ipNet.Contains(acquired.ContainerIP()) {
+		err := NetworkOutOfPoolError{handle, acquired, p.ipNet}
+		p.logger.Error("network-out-of-pool", err)
+		p.release(handle, acquired)
+		return nil, err
+	}
+
+	p.allocatedMutex.Lock()
+	p.allocated[handle] = acquired
+	p.allocatedMutex.Unlock()
+
+	return acquired, nil
+}
+
+// Remove records a restored container's network as allocated. The external
+// system is expected to still hold the allocation, so it is not consulted.
+func (p *ExternalNetworkPool) Remove(handle string, network *network.Network) error {
+	if !p.ipNet.Contains(network.ContainerIP()) {
+		return NetworkOutOfPoolError{handle, network, p.ipNet}
+	}
+
+	p.allocatedMutex.Lock()
+	defer p.allocatedMutex.Unlock()
+
+	for otherHandle, allocated := range p.allocated {
+		if otherHandle != handle && allocated.String() == network.String() {
+			return NetworkTakenError{network}
+		}
+	}
+
+	p.allocated[handle] = network
+
+	return nil
+}
+
+func (p *ExternalNetworkPool) Release(handle string, network *network.Network) {
+	p.allocatedMutex.Lock()
+	delete(p.allocated, handle)
+	p.allocatedMutex.Unlock()
+
+	p.release(handle, network)
+}
+
+func (p *ExternalNetworkPool) InitialSize() int {
+	return p.initialSize
+}
+
+// Available returns the number of networks that can still be acquired, as
+// far as this host knows; the external system may have handed out more of
+// them elsewhere.
+func (p *ExternalNetworkPool) Available() int {
+	p.allocatedMutex.Lock()
+	defer p.allocatedMutex.Unlock()
+
+	available := p.initialSize - len(p.allocated)
+	if available < 0 {
+		return 0
+	}
+
+	return available
+}
+
+func (p *ExternalNetworkPool) Network() *net.IPNet {
+	return p.ipNet
+}
+
+func (p *ExternalNetworkPool) release(handle string, network *network.Network) {
+	err := p.driver.Release(handle, network)
+	if err != nil {
+		// the external system will have to reclaim it itself
+		p.logger.Error("release-failed", err, lager.Data{
+			"handle":  handle,
+			"network": network.String(),
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package network_pool_test
+
+import (
+	"errors"
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
+)
+
+type fakeIPAMDriver struct {
+	allocations map[string]*network.Network
+
+	AllocateError error
+	ReleaseError  error
+
+	Released []string
+}
+
+func (d *fakeIPAMDriver) Allocate(handle string) (*network.Network, error) {
+	if d.AllocateError != nil {
+		return nil, d.AllocateError
+	}
+
+	return d.allocations[handle], nil
+}
+
+func (d *fakeIPAMDriver) Release(handle string, network *network.Network) error {
+	d.Released = append(d.Released, handle+"="+network.String())
+	return d.ReleaseError
+}
+
+var _ = Describe("External Network Pool", func() {
+	var driver *fakeIPAMDriver
+	var logger *lagertest.TestLogger
+	var pool *network_pool.ExternalNetworkPool
+
+	var ipNet *net.IPNet
+
+	networkAt := func(cidr string) *network.Network {
+		_, subnet, err := net.ParseCIDR(cidr)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return network.New(subnet)
+	}
+
+	BeforeEach(func() {
+		var err error
+		_, ipNet, err = net.ParseCIDR("10.254.0.0/22")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		driver = &fakeIPAMDriver{
+			allocations: map[string]*network.Network{
+				"handle-a":   networkAt("10.254.0.4/30"),
+				"handle-b":   networkAt("10.254.0.8/30"),
+				"handle-out": networkAt("10.99.0.4/30"),
+			},
+		}
+
+		logger = lagertest.NewTestLogger("test")
+
+		pool = network_pool.NewExternal(logger, ipNet, 256, driver)
+	})
+
+	Describe("acquiring", func() {
+		It("returns the network the driver allocates to the handle", func() {
+			acquired, err := pool.Acquire("handle-a")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(acquired.String()).Should(Equal("10.254.0.4/30"))
+
+			Ω(pool.Available()).Should(Equal(255))
+		})
+
+		Context("when the driver fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				driver.AllocateError = disaster
+			})
+
+			It("returns the error", func() {
+				_, err := pool.Acquire("handle-a")
+				Ω(err).Should(Equal(disaster))
+
+				Ω(pool.Available()).Should(Equal(256))
+			})
+		})
+
+		Context("when the driver allocates a network outside of the pool", func() {
+			It("releases it and returns an error", func() {
+				_, err := pool.Acquire("handle-out")
+				Ω(err).Should(MatchError(network_pool.NetworkOutOfPoolError{
+					Handle:  "handle-out",
+					Network: driver.allocations["handle-out"],
+					Pool:    ipNet,
+				}))
+
+				Ω(driver.Released).Should(Equal([]string{"handle-out=10.99.0.4/30"}))
+				Ω(pool.Available()).Should(Equal(256))
+			})
+		})
+	})
+
+	Describe("releasing", func() {
+		It("releases the network through the driver", func() {
+			acquired, err := pool.Acquire("handle-a")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool.Release("handle-a", acquired)
+
+			Ω(driver.Released).Should(Equal([]string{"handle-a=10.254.0.4/30"}))
+			Ω(pool.Available()).Should(Equal(256))
+		})
+
+		Context("when the driver fails", func() {
+			BeforeEach(func() {
+				driver.ReleaseError = errors.New("oh no!")
+			})
+
+			It("logs the error and forgets the network", func() {
+				acquired, err := pool.Acquire("handle-a")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				pool.Release("handle-a", acquired)
+
+				Ω(logger.Logs()).Should(HaveLen(1))
+				Ω(logger.Logs()[0].Message).Should(Equal("test.external-network-pool.release-failed"))
+
+				Ω(pool.Available()).Should(Equal(256))
+			})
+		})
+	})
+
+	Describe("removing", func() {
+		It("records the restored network as allocated without consulting the driver", func() {
+			err := pool.Remove("handle-a", networkAt("10.254.0.4/30"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(pool.Available()).Should(Equal(255))
+			Ω(driver.Released).Should(BeEmpty())
+		})
+
+		Context("when another container already has the network", func() {
+			It("returns an error", func() {
+				_, err := pool.Acquire("handle-a")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = pool.Remove("handle-c", networkAt("10.254.0.4/30"))
+				Ω(err).Should(MatchError(network_pool.NetworkTakenError{Network: networkAt("10.254.0.4/30")}))
+			})
+		})
+
+		Context("when the network is outside of the pool", func() {
+			It("returns an error", func() {
+				err := pool.Remove("handle-out", networkAt("10.99.0.4/30"))
+				Ω(err).Should(BeAssignableToTypeOf(network_pool.NetworkOutOfPoolError{}))
+			})
+		})
+	})
+
+	It("reports the pool's network and size", func() {
+		Ω(pool.Network()).Should(Equal(ipNet))
+		Ω(pool.InitialSize()).Should(Equal(256))
+	})
+})
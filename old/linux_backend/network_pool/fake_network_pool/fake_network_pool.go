@@ -15,6 +15,7 @@ type FakeNetworkPool struct {
 	AcquireError error
 	RemoveError  error
 
+	Acquired []string
 	Released []string
 	Removed  []string
 }
@@ -31,7 +32,7 @@ func (p *FakeNetworkPool) InitialSize() int {
 	return p.InitialPoolSize
 }
 
-func (p *FakeNetworkPool) Acquire() (*network.Network, error) {
+func (p *FakeNetworkPool) Acquire(handle string) (*network.Network, error) {
 	if p.AcquireError != nil {
 		return nil, p.AcquireError
 	}
@@ -46,10 +47,12 @@ func (p *FakeNetworkPool) Acquire() (*network.Network, error) {
 	inc(p.nextNetwork)
 	inc(p.nextNetwork)
 
+	p.Acquired = append(p.Acquired, ipNet.String())
+
 	return network.New(ipNet), nil
 }
 
-func (p *FakeNetworkPool) Remove(network *network.Network) error {
+func (p *FakeNetworkPool) Remove(handle string, network *network.Network) error {
 	if p.RemoveError != nil {
 		return p.RemoveError
 	}
@@ -59,7 +62,7 @@ func (p *FakeNetworkPool) Remove(network *network.Network) error {
 	return nil
 }
 
-func (p *FakeNetworkPool) Release(network *network.Network) {
+func (p *FakeNetworkPool) Release(handle string, network *network.Network) {
 	p.Released = append(p.Released, network.String())
 }
 
@@ -0,0 +1,59 @@
+package network_pool
+
+import (
+	"fmt"
+	"net"
+)
+
+// HostNetworks are the addresses the host needs to keep reaching, which
+// containers' networks must therefore stay clear of: each container's
+// network is routed to its host-side interface, so one that covered them
+// would take the host's traffic for them away from its uplink.
+type HostNetworks struct {
+	// the address the host's traffic leaves it from
+	ExternalIP net.IP
+
+	// the subnets on the host's primary interface
+	HostRoutes []*net.IPNet
+
+	// networks the host's platform relies on, e.g. for its control plane or
+	// storage, which may be beyond its own subnets
+	Infrastructure []*net.IPNet
+}
+
+type NetworkConflictError struct {
+	Network  *net.IPNet
+	Conflict string
+}
+
+func (e NetworkConflictError) Error() string {
+	return fmt.Sprintf("network %s covers %s, which would cut the host off from it", e.Network.String(), e.Conflict)
+}
+
+// Check returns a NetworkConflictError if ipNet contains the external IP or
+// overlaps any of the host's routes or infrastructure networks.
+func (h HostNetworks) Check(ipNet *net.IPNet) error {
+	if h.ExternalIP != nil && ipNet.Contains(h.ExternalIP) {
+		return NetworkConflictError{ipNet, "the host's external IP " + h.ExternalIP.String()}
+	}
+
+	for _, route := range h.HostRoutes {
+		if overlaps(ipNet, route) {
+			return NetworkConflictError{ipNet, "the host route to " + route.String()}
+		}
+	}
+
+	for _, infrastructure := range h.Infrastructure {
+		if overlaps(ipNet, infrastructure) {
+			return NetworkConflictError{ipNet, "the infrastructure network " + infrastructure.String()}
+		}
+	}
+
+	return nil
+}
+
+// CIDR blocks either nest or are disjoint, so they overlap if either
+// contains the other's first address
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
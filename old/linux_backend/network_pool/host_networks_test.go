@@ -0,0 +1,59 @@
+package network_pool_test
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
+)
+
+var _ = Describe("HostNetworks", func() {
+	var hostNetworks network_pool.HostNetworks
+
+	cidr := func(s string) *net.IPNet {
+		_, ipNet, err := net.ParseCIDR(s)
+		Ω(err).ShouldNot(HaveOccurred())
+		return ipNet
+	}
+
+	BeforeEach(func() {
+		hostNetworks = network_pool.HostNetworks{
+			ExternalIP:     net.ParseIP("192.168.1.10"),
+			HostRoutes:     []*net.IPNet{cidr("192.168.0.0/16")},
+			Infrastructure: []*net.IPNet{cidr("10.0.16.0/20")},
+		}
+	})
+
+	It("allows networks clear of all of them", func() {
+		Ω(hostNetworks.Check(cidr("10.254.0.0/22"))).ShouldNot(HaveOccurred())
+	})
+
+	It("rejects a network containing the external IP", func() {
+		hostNetworks.HostRoutes = nil
+
+		Ω(hostNetworks.Check(cidr("192.168.1.0/24"))).Should(Equal(network_pool.NetworkConflictError{
+			Network:  cidr("192.168.1.0/24"),
+			Conflict: "the host's external IP 192.168.1.10",
+		}))
+	})
+
+	It("rejects a network within a host route", func() {
+		Ω(hostNetworks.Check(cidr("192.168.200.0/24"))).Should(Equal(network_pool.NetworkConflictError{
+			Network:  cidr("192.168.200.0/24"),
+			Conflict: "the host route to 192.168.0.0/16",
+		}))
+	})
+
+	It("rejects a network covering an infrastructure network", func() {
+		Ω(hostNetworks.Check(cidr("10.0.0.0/16"))).Should(Equal(network_pool.NetworkConflictError{
+			Network:  cidr("10.0.0.0/16"),
+			Conflict: "the infrastructure network 10.0.16.0/20",
+		}))
+	})
+
+	It("rejects a network within an infrastructure network", func() {
+		Ω(hostNetworks.Check(cidr("10.0.20.0/22"))).Should(HaveOccurred())
+	})
+})
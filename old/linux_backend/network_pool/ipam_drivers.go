@@ -0,0 +1,187 @@
+package network_pool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+	"github.com/cloudfoundry/gunk/command_runner"
+)
+
+// Both drivers describe networks as JSON in the same form as containers'
+// snapshots, e.g.:
+//
+//   {"IPNet": "10.254.0.4/30", "HostIP": "10.254.0.5", "ContainerIP": "10.254.0.6"}
+//
+// for a container with its own subnet, or with the container's address and
+// the pool's prefix length as IPNet for a bridged one.
+
+// ExecIPAMDriver allocates networks by running an executable, with the
+// pool's network in POOL_NETWORK:
+//
+//	<path> allocate <handle>  prints the container's network
+//	<path> release <handle>   given the network on stdin
+type ExecIPAMDriver struct {
+	path        string
+	poolNetwork *net.IPNet
+
+	runner command_runner.CommandRunner
+}
+
+func NewExecIPAMDriver(path string, poolNetwork *net.IPNet, runner command_runner.CommandRunner) *ExecIPAMDriver {
+	return &ExecIPAMDriver{
+		path:        path,
+		poolNetwork: poolNetwork,
+
+		runner: runner,
+	}
+}
+
+func (d *ExecIPAMDriver) Allocate(handle string) (*network.Network, error) {
+	allocateOut := new(bytes.Buffer)
+
+	allocate := d.command("allocate", handle)
+	allocate.Stdout = allocateOut
+
+	err := d.runner.Run(allocate)
+	if err != nil {
+		return nil, err
+	}
+
+	allocated := new(network.Network)
+
+	err = json.Unmarshal(allocateOut.Bytes(), allocated)
+	if err != nil {
+		return nil, err
+	}
+
+	return allocated, nil
+}
+
+func (d *ExecIPAMDriver) Release(handle string, network *network.Network) error {
+	payload, err := json.Marshal(network)
+	if err != nil {
+		return err
+	}
+
+	release := d.command("release", handle)
+	release.Stdin = bytes.NewReader(payload)
+
+	return d.runner.Run(release)
+}
+
+func (d *ExecIPAMDriver) command(action, handle string) *exec.Cmd {
+	cmd := exec.Command(d.path, action, handle)
+	cmd.Env = []string{
+		"POOL_NETWORK=" + d.poolNetwork.String(),
+		"PATH=" + os.Getenv("PATH"),
+	}
+
+	return cmd
+}
+
+// HTTPIPAMDriver allocates networks from an IPAM service:
+//
+//	POST <url>/allocations  {"handle": ..., "pool_network": ...}
+//	                        responds with the container's network
+//	DELETE <url>/allocations/<handle>
+type HTTPIPAMDriver struct {
+	url         string
+	poolNetwork *net.IPNet
+
+	client *http.Client
+}
+
+type IPAMRequestError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Message    string
+}
+
+func (e IPAMRequestError) Error() string {
+	return fmt.Sprintf("ipam request %s %s failed with status %d: %s", e.Method, e.URL, e.StatusCode, e.Message)
+}
+
+func NewHTTPIPAMDriver(url string, poolNetwork *net.IPNet, client *http.Client) *HTTPIPAMDriver {
+	return &HTTPIPAMDriver{
+		url:         strings.TrimSuffix(url, "/"),
+		poolNetwork: poolNetwork,
+
+		client: client,
+	}
+}
+
+func (d *HTTPIPAMDriver) Allocate(handle string) (*network.Network, error) {
+	payload, err := json.Marshal(map[string]string{
+		"handle":       handle,
+		"pool_network": d.poolNetwork.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := d.do("POST", d.url+"/allocations", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	allocated := new(network.Network)
+
+	err = json.NewDecoder(response.Body).Decode(allocated)
+	if err != nil {
+		return nil, err
+	}
+
+	return allocated, nil
+}
+
+func (d *HTTPIPAMDriver) Release(handle string, network *network.Network) error {
+	response, err := d.do("DELETE", d.url+"/allocations/"+url.QueryEscape(handle), nil)
+	if err != nil {
+		return err
+	}
+
+	return response.Body.Close()
+}
+
+func (d *HTTPIPAMDriver) do(method, url string, body io.Reader) (*http.Response, error) {
+	request, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message := new(bytes.Buffer)
+		message.ReadFrom(response.Body)
+		response.Body.Close()
+
+		return nil, IPAMRequestError{
+			Method:     method,
+			URL:        url,
+			StatusCode: response.StatusCode,
+			Message:    strings.TrimSpace(message.String()),
+		}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,197 @@
+package network_pool_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+)
+
+var _ = Describe("IPAM drivers", func() {
+	var poolNetwork *net.IPNet
+	var allocated *network.Network
+
+	BeforeEach(func() {
+		var err error
+		_, poolNetwork, err = net.ParseCIDR("10.254.0.0/22")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, subnet, err := net.ParseCIDR("10.254.0.4/30")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		allocated = network.New(subnet)
+	})
+
+	Describe("ExecIPAMDriver", func() {
+		var fakeRunner *fake_command_runner.FakeCommandRunner
+		var driver *network_pool.ExecIPAMDriver
+
+		BeforeEach(func() {
+			fakeRunner = fake_command_runner.New()
+			driver = network_pool.NewExecIPAMDriver("/path/to/ipam", poolNetwork, fakeRunner)
+		})
+
+		Describe("allocating", func() {
+			It("runs the executable and parses the network it prints", func() {
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: "/path/to/ipam",
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(`{"IPNet":"10.254.0.4/30","HostIP":"10.254.0.5","ContainerIP":"10.254.0.6"}`))
+					return nil
+				})
+
+				network, err := driver.Allocate("some-handle")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(network).Should(Equal(allocated))
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(fake_command_runner.CommandSpec{
+					Path: "/path/to/ipam",
+					Args: []string{"allocate", "some-handle"},
+					Env: []string{
+						"POOL_NETWORK=10.254.0.0/22",
+						"PATH=" + os.Getenv("PATH"),
+					},
+				}))
+			})
+
+			Context("when the executable fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+						Path: "/path/to/ipam",
+					}, func(*exec.Cmd) error {
+						return disaster
+					})
+				})
+
+				It("returns the error", func() {
+					_, err := driver.Allocate("some-handle")
+					Ω(err).Should(Equal(disaster))
+				})
+			})
+
+			Context("when the executable prints garbage", func() {
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+						Path: "/path/to/ipam",
+					}, func(cmd *exec.Cmd) error {
+						cmd.Stdout.Write([]byte("no."))
+						return nil
+					})
+				})
+
+				It("returns an error", func() {
+					_, err := driver.Allocate("some-handle")
+					Ω(err).Should(HaveOccurred())
+				})
+			})
+		})
+
+		Describe("releasing", func() {
+			It("runs the executable with the network on stdin", func() {
+				var stdin []byte
+
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: "/path/to/ipam",
+				}, func(cmd *exec.Cmd) error {
+					var err error
+					stdin, err = ioutil.ReadAll(cmd.Stdin)
+					return err
+				})
+
+				err := driver.Release("some-handle", allocated)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(fake_command_runner.CommandSpec{
+					Path: "/path/to/ipam",
+					Args: []string{"release", "some-handle"},
+				}))
+
+				Ω(stdin).Should(MatchJSON(`{"IPNet":"10.254.0.4/30","HostIP":"10.254.0.5","ContainerIP":"10.254.0.6"}`))
+			})
+		})
+	})
+
+	Describe("HTTPIPAMDriver", func() {
+		var server *ghttp.Server
+		var driver *network_pool.HTTPIPAMDriver
+
+		BeforeEach(func() {
+			server = ghttp.NewServer()
+			driver = network_pool.NewHTTPIPAMDriver(server.URL()+"/", poolNetwork, http.DefaultClient)
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		Describe("allocating", func() {
+			It("posts the handle and parses the network in the response", func() {
+				server.AppendHandlers(ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/allocations"),
+					ghttp.VerifyJSON(`{"handle":"some-handle","pool_network":"10.254.0.0/22"}`),
+					ghttp.RespondWith(http.StatusCreated, `{"IPNet":"10.254.0.4/30","HostIP":"10.254.0.5","ContainerIP":"10.254.0.6"}`),
+				))
+
+				network, err := driver.Allocate("some-handle")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(network).Should(Equal(allocated))
+			})
+
+			Context("when the service responds with an error", func() {
+				BeforeEach(func() {
+					server.AppendHandlers(ghttp.RespondWith(http.StatusConflict, "pool exhausted\n"))
+				})
+
+				It("returns an error with the status and message", func() {
+					_, err := driver.Allocate("some-handle")
+					Ω(err).Should(Equal(network_pool.IPAMRequestError{
+						Method:     "POST",
+						URL:        server.URL() + "/allocations",
+						StatusCode: http.StatusConflict,
+						Message:    "pool exhausted",
+					}))
+				})
+			})
+		})
+
+		Describe("releasing", func() {
+			It("deletes the handle's allocation", func() {
+				server.AppendHandlers(ghttp.CombineHandlers(
+					ghttp.VerifyRequest("DELETE", "/allocations/some-handle"),
+					ghttp.RespondWith(http.StatusNoContent, ""),
+				))
+
+				err := driver.Release("some-handle", allocated)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(server.ReceivedRequests()).Should(HaveLen(1))
+			})
+
+			Context("when the service responds with an error", func() {
+				BeforeEach(func() {
+					server.AppendHandlers(ghttp.RespondWith(http.StatusInternalServerError, ""))
+				})
+
+				It("returns an error", func() {
+					err := driver.Release("some-handle", allocated)
+					Ω(err).Should(BeAssignableToTypeOf(network_pool.IPAMRequestError{}))
+				})
+			})
+		})
+	})
+})
@@ -3,15 +3,20 @@ package network_pool
 import (
 	"fmt"
 	"net"
+	"sort"
 	"sync"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
 )
 
+// NetworkPool is the IPAM for containers' networks: it allocates each
+// container a network out of Network() by its handle, and takes it back
+// when the container is destroyed. RealNetworkPool manages the addresses
+// itself; ExternalNetworkPool defers to an external IPAM system.
 type NetworkPool interface {
-	Acquire() (*network.Network, error)
-	Release(*network.Network)
-	Remove(*network.Network) error
+	Acquire(handle string) (*network.Network, error)
+	Release(handle string, network *network.Network)
+	Remove(handle string, network *network.Network) error
 	Network() *net.IPNet
 	InitialSize() int
 }
@@ -22,6 +27,28 @@ type RealNetworkPool struct {
 	pool            []*network.Network
 	poolMutex       *sync.Mutex
 	initialPoolSize int
+
+	// the most networks that may be acquired at once, or 0 for as many as
+	// there are; see LimitContainers
+	maxContainers int
+
+	// each network's position in the pool as it was created, by which
+	// free networks are contiguous
+	positions map[string]int
+}
+
+// Usage is how much of the pool is allocated, and how fragmented what is
+// left of it is. Free networks are in the same block if nothing is
+// allocated between them.
+type Usage struct {
+	Size      int `json:"size"`
+	Allocated int `json:"allocated"`
+	Available int `json:"available"`
+
+	FreeBlocks       int `json:"free_blocks"`
+	LargestFreeBlock int `json:"largest_free_block"`
+
+	MaxContainers int `json:"max_containers,omitempty"`
 }
 
 type PoolExhaustedError struct{}
@@ -30,6 +57,15 @@ func (e PoolExhaustedError) Error() string {
 	return "network pool is exhausted"
 }
 
+type InsufficientIPsError struct {
+	Network       *net.IPNet
+	MaxContainers int
+}
+
+func (e InsufficientIPsError) Error() string {
+	return fmt.Sprintf("insufficient IPs: %s is already shared by its maximum of %d containers", e.Network.String(), e.MaxContainers)
+}
+
 type NetworkTakenError struct {
 	Network *network.Network
 }
@@ -50,19 +86,74 @@ func New(ipNet *net.IPNet) *RealNetworkPool {
 		pool = append(pool, network.New(subnet))
 	}
 
+	return newRealNetworkPool(ipNet, pool)
+}
+
+// NewBridged returns a pool of single addresses in ipNet for containers
+// attached to a shared bridge whose address is bridgeIP. The network and
+// broadcast addresses and the bridge's own address are never handed out.
+func NewBridged(ipNet *net.IPNet, bridgeIP net.IP) *RealNetworkPool {
+	return newSingleAddressPool(ipNet, bridgeIP, func(ip net.IP) *network.Network {
+		return network.NewBridged(ipNet, bridgeIP, ip)
+	})
+}
+
+// NewRouted returns a pool of single addresses in ipNet for containers that
+// are routed to individually and reach the host at hostIP. As with
+// NewBridged, the network and broadcast addresses and hostIP are never
+// handed out.
+func NewRouted(ipNet *net.IPNet, hostIP net.IP) *RealNetworkPool {
+	return newSingleAddressPool(ipNet, hostIP, func(ip net.IP) *network.Network {
+		return network.NewRouted(hostIP, ip)
+	})
+}
+
+func newSingleAddressPool(ipNet *net.IPNet, hostIP net.IP, newNetwork func(net.IP) *network.Network) *RealNetworkPool {
+	pool := []*network.Network{}
+
+	network0 := ipNet.IP.Mask(ipNet.Mask)
+
+	for ip := nextIP(network0); ipNet.Contains(ip); ip = nextIP(ip) {
+		if !ipNet.Contains(nextIP(ip)) {
+			// broadcast address
+			break
+		}
+
+		if ip.Equal(hostIP) {
+			continue
+		}
+
+		pool = append(pool, newNetwork(ip))
+	}
+
+	return newRealNetworkPool(ipNet, pool)
+}
+
+func newRealNetworkPool(ipNet *net.IPNet, pool []*network.Network) *RealNetworkPool {
+	positions := map[string]int{}
+	for i, network := range pool {
+		positions[network.String()] = i
+	}
+
 	return &RealNetworkPool{
 		ipNet: ipNet,
 
 		pool:            pool,
 		poolMutex:       new(sync.Mutex),
 		initialPoolSize: len(pool),
+
+		positions: positions,
 	}
 }
 
-func (p *RealNetworkPool) Acquire() (*network.Network, error) {
+func (p *RealNetworkPool) Acquire(handle string) (*network.Network, error) {
 	p.poolMutex.Lock()
 	defer p.poolMutex.Unlock()
 
+	if p.maxContainers > 0 && p.initialPoolSize-len(p.pool) >= p.maxContainers {
+		return nil, InsufficientIPsError{p.ipNet, p.maxContainers}
+	}
+
 	if len(p.pool) == 0 {
 		return nil, PoolExhaustedError{}
 	}
@@ -73,7 +164,7 @@ func (p *RealNetworkPool) Acquire() (*network.Network, error) {
 	return acquired, nil
 }
 
-func (p *RealNetworkPool) Remove(network *network.Network) error {
+func (p *RealNetworkPool) Remove(handle string, network *network.Network) error {
 	idx := 0
 	found := false
 
@@ -97,7 +188,7 @@ func (p *RealNetworkPool) Remove(network *network.Network) error {
 	return nil
 }
 
-func (p *RealNetworkPool) Release(network *network.Network) {
+func (p *RealNetworkPool) Release(handle string, network *network.Network) {
 	if !p.ipNet.Contains(network.IP()) {
 		return
 	}
@@ -108,10 +199,90 @@ func (p *RealNetworkPool) Release(network *network.Network) {
 	p.pool = append(p.pool, network)
 }
 
+// LimitContainers caps how many networks may be acquired at once at max,
+// for a pool of single addresses in a subnet that containers share with the
+// host's gateway and other reserved addresses: those beyond the cap are left
+// for them, and once it is reached Acquire returns an InsufficientIPsError
+// rather than handing them out. Networks journaled before a restart are
+// still removed from the pool whatever the cap.
+//
+// It must be called before the pool is used.
+func (p *RealNetworkPool) LimitContainers(max int) {
+	p.maxContainers = max
+}
+
 func (p *RealNetworkPool) InitialSize() int {
+	if p.maxContainers > 0 && p.maxContainers < p.initialPoolSize {
+		return p.maxContainers
+	}
+
 	return p.initialPoolSize
 }
 
+// Available returns the number of networks that can still be acquired.
+func (p *RealNetworkPool) Available() int {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	return p.available(len(p.pool))
+}
+
+func (p *RealNetworkPool) available(free int) int {
+	if p.maxContainers == 0 {
+		return free
+	}
+
+	left := p.maxContainers - (p.initialPoolSize - free)
+	if left < 0 {
+		return 0
+	}
+
+	if left < free {
+		return left
+	}
+
+	return free
+}
+
+func (p *RealNetworkPool) Usage() Usage {
+	p.poolMutex.Lock()
+
+	free := make([]int, 0, len(p.pool))
+	for _, network := range p.pool {
+		if position, found := p.positions[network.String()]; found {
+			free = append(free, position)
+		}
+	}
+
+	p.poolMutex.Unlock()
+
+	sort.Ints(free)
+
+	usage := Usage{
+		Size:      p.initialPoolSize,
+		Allocated: p.initialPoolSize - len(free),
+		Available: p.available(len(free)),
+
+		MaxContainers: p.maxContainers,
+	}
+
+	block := 0
+	for i, position := range free {
+		if i == 0 || position != free[i-1]+1 {
+			usage.FreeBlocks++
+			block = 0
+		}
+
+		block++
+
+		if block > usage.LargestFreeBlock {
+			usage.LargestFreeBlock = block
+		}
+	}
+
+	return usage
+}
+
 func (p *RealNetworkPool) Network() *net.IPNet {
 	return p.ipNet
 }
@@ -132,6 +303,13 @@ func nextSubnet(ipNet *net.IPNet) *net.IPNet {
 	return nextNet
 }
 
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	inc(next)
+	return next
+}
+
 func inc(ip net.IP) {
 	for j := len(ip) - 1; j >= 0; j-- {
 		ip[j]++
@@ -1,6 +1,7 @@
 package network_pool_test
 
 import (
+	"encoding/json"
 	"net"
 
 	. "github.com/onsi/ginkgo"
@@ -22,12 +23,12 @@ var _ = Describe("Network Pool", func() {
 
 	Describe("acquiring", func() {
 		It("takes the next network in the pool", func() {
-			network1, err := pool.Acquire()
+			network1, err := pool.Acquire("some-handle")
 			Ω(err).ShouldNot(HaveOccurred())
 
 			Ω(network1.String()).Should(Equal("10.254.0.0/30"))
 
-			network2, err := pool.Acquire()
+			network2, err := pool.Acquire("some-handle")
 			Ω(err).ShouldNot(HaveOccurred())
 
 			Ω(network2.String()).Should(Equal("10.254.0.4/30"))
@@ -36,11 +37,11 @@ var _ = Describe("Network Pool", func() {
 		Context("when the pool is exhausted", func() {
 			It("returns an error", func() {
 				for i := 0; i < 256; i++ {
-					_, err := pool.Acquire()
+					_, err := pool.Acquire("some-handle")
 					Ω(err).ShouldNot(HaveOccurred())
 				}
 
-				_, err := pool.Acquire()
+				_, err := pool.Acquire("some-handle")
 				Ω(err).Should(HaveOccurred())
 			})
 		})
@@ -51,25 +52,25 @@ var _ = Describe("Network Pool", func() {
 			_, ipNet, err := net.ParseCIDR("10.254.0.0/30")
 			Ω(err).ShouldNot(HaveOccurred())
 
-			err = pool.Remove(network.New(ipNet))
+			err = pool.Remove("some-handle", network.New(ipNet))
 			Ω(err).ShouldNot(HaveOccurred())
 
 			for i := 0; i < (256 - 1); i++ {
-				network, err := pool.Acquire()
+				network, err := pool.Acquire("some-handle")
 				Ω(err).ShouldNot(HaveOccurred())
 				Ω(network.String()).ShouldNot(Equal("10.254.0.0/30"))
 			}
 
-			_, err = pool.Acquire()
+			_, err = pool.Acquire("some-handle")
 			Ω(err).Should(HaveOccurred())
 		})
 
 		Context("when the resource is already acquired", func() {
 			It("returns a PortTakenError", func() {
-				network, err := pool.Acquire()
+				network, err := pool.Acquire("some-handle")
 				Ω(err).ShouldNot(HaveOccurred())
 
-				err = pool.Remove(network)
+				err = pool.Remove("some-handle", network)
 				Ω(err).Should(Equal(network_pool.NetworkTakenError{network}))
 			})
 		})
@@ -77,17 +78,17 @@ var _ = Describe("Network Pool", func() {
 
 	Describe("releasing", func() {
 		It("places a network back and the end of the pool", func() {
-			first, err := pool.Acquire()
+			first, err := pool.Acquire("some-handle")
 			Ω(err).ShouldNot(HaveOccurred())
 
-			pool.Release(first)
+			pool.Release("some-handle", first)
 
 			for i := 0; i < 255; i++ {
-				_, err := pool.Acquire()
+				_, err := pool.Acquire("some-handle")
 				Ω(err).ShouldNot(HaveOccurred())
 			}
 
-			last, err := pool.Acquire()
+			last, err := pool.Acquire("some-handle")
 			Ω(err).ShouldNot(HaveOccurred())
 			Ω(last).Should(Equal(first))
 		})
@@ -99,18 +100,18 @@ var _ = Describe("Network Pool", func() {
 
 				kiddiePool := network_pool.New(smallIPNet)
 
-				_, err = kiddiePool.Acquire()
+				_, err = kiddiePool.Acquire("some-handle")
 				Ω(err).ShouldNot(HaveOccurred())
 
-				_, err = kiddiePool.Acquire()
+				_, err = kiddiePool.Acquire("some-handle")
 				Ω(err).Should(HaveOccurred())
 
-				outOfRangeNetwork, err := pool.Acquire()
+				outOfRangeNetwork, err := pool.Acquire("some-handle")
 				Ω(err).ShouldNot(HaveOccurred())
 
-				kiddiePool.Release(outOfRangeNetwork)
+				kiddiePool.Release("some-handle", outOfRangeNetwork)
 
-				_, err = kiddiePool.Acquire()
+				_, err = kiddiePool.Acquire("some-handle")
 				Ω(err).Should(HaveOccurred())
 			})
 		})
@@ -119,15 +120,267 @@ var _ = Describe("Network Pool", func() {
 	Describe("InitialSize", func() {
 		It("returns the count of maximum available networks", func() {
 			Ω(pool.InitialSize()).Should(Equal(256))
-			_, err := pool.Acquire()
+			_, err := pool.Acquire("some-handle")
 			Ω(err).ShouldNot(HaveOccurred())
 			Ω(pool.InitialSize()).Should(Equal(256))
 		})
 	})
 
+	Describe("Available", func() {
+		It("returns the count of networks that can still be acquired", func() {
+			Ω(pool.Available()).Should(Equal(256))
+
+			network, err := pool.Acquire("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pool.Available()).Should(Equal(255))
+
+			pool.Release("some-handle", network)
+			Ω(pool.Available()).Should(Equal(256))
+		})
+	})
+
+	Describe("Usage", func() {
+		It("reports a fresh pool as one free block", func() {
+			Ω(pool.Usage()).Should(Equal(network_pool.Usage{
+				Size:             256,
+				Available:        256,
+				FreeBlocks:       1,
+				LargestFreeBlock: 256,
+			}))
+		})
+
+		It("reports the blocks that are left between allocated networks", func() {
+			acquired := []*network.Network{}
+			for i := 0; i < 4; i++ {
+				network, err := pool.Acquire("some-handle")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				acquired = append(acquired, network)
+			}
+
+			// frees 10.254.0.0/30 and 10.254.0.8/30, either side of
+			// 10.254.0.4/30, and leaves 10.254.0.12/30 before the rest
+			pool.Release("some-handle", acquired[2])
+			pool.Release("some-handle", acquired[0])
+
+			Ω(pool.Usage()).Should(Equal(network_pool.Usage{
+				Size:             256,
+				Allocated:        2,
+				Available:        254,
+				FreeBlocks:       3,
+				LargestFreeBlock: 252,
+			}))
+		})
+
+		It("reports no blocks when the pool is exhausted", func() {
+			for i := 0; i < 256; i++ {
+				_, err := pool.Acquire("some-handle")
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			Ω(pool.Usage()).Should(Equal(network_pool.Usage{
+				Size:      256,
+				Allocated: 256,
+			}))
+		})
+
+		It("skips the host's address in a pool of single addresses", func() {
+			_, ipNet, err := net.ParseCIDR("10.0.16.0/29")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			bridgedPool := network_pool.NewBridged(ipNet, net.ParseIP("10.0.16.3"))
+
+			Ω(bridgedPool.Usage().FreeBlocks).Should(Equal(1))
+		})
+	})
+
 	Describe("getting the network", func() {
 		It("returns the network's *net.IPNet", func() {
 			Ω(pool.Network().String()).Should(Equal("10.254.0.0/22"))
 		})
 	})
+
+	Describe("a pool for a shared bridge", func() {
+		var bridgedPool *network_pool.RealNetworkPool
+
+		BeforeEach(func() {
+			_, ipNet, err := net.ParseCIDR("10.254.0.0/29")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			bridgedPool = network_pool.NewBridged(ipNet, net.ParseIP("10.254.0.1"))
+		})
+
+		It("hands out single addresses in the bridge's network, skipping the bridge's", func() {
+			var acquired []string
+
+			for i := 0; i < 5; i++ {
+				network, err := bridgedPool.Acquire("some-handle")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(network.HostIP().String()).Should(Equal("10.254.0.1"))
+				Ω(network.PrefixLength()).Should(Equal(29))
+
+				acquired = append(acquired, network.ContainerIP().String())
+			}
+
+			Ω(acquired).Should(Equal([]string{
+				"10.254.0.2",
+				"10.254.0.3",
+				"10.254.0.4",
+				"10.254.0.5",
+				"10.254.0.6",
+			}))
+
+			_, err := bridgedPool.Acquire("some-handle")
+			Ω(err).Should(Equal(network_pool.PoolExhaustedError{}))
+		})
+
+		It("identifies each network by its container's address", func() {
+			first, err := bridgedPool.Acquire("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			second, err := bridgedPool.Acquire("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(first.String()).Should(Equal("10.254.0.2/29"))
+			Ω(second.String()).Should(Equal("10.254.0.3/29"))
+		})
+
+		It("can remove a network that was journaled", func() {
+			acquired, err := bridgedPool.Acquire("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			bridgedPool.Release("some-handle", acquired)
+
+			encoded, err := json.Marshal(acquired)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var restored network.Network
+			err = json.Unmarshal(encoded, &restored)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(restored.String()).Should(Equal(acquired.String()))
+			Ω(restored.ContainerIP().String()).Should(Equal("10.254.0.2"))
+
+			err = bridgedPool.Remove("some-handle", &restored)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(bridgedPool.Available()).Should(Equal(4))
+		})
+
+		Context("when the containers sharing it are limited", func() {
+			BeforeEach(func() {
+				bridgedPool.LimitContainers(2)
+			})
+
+			It("returns InsufficientIPsError once the limit is reached, before the pool is exhausted", func() {
+				_, err := bridgedPool.Acquire("some-handle")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				second, err := bridgedPool.Acquire("some-handle")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = bridgedPool.Acquire("some-handle")
+				Ω(err).Should(Equal(network_pool.InsufficientIPsError{
+					Network:       bridgedPool.Network(),
+					MaxContainers: 2,
+				}))
+
+				bridgedPool.Release("some-handle", second)
+
+				_, err = bridgedPool.Acquire("some-handle")
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("reports the limit as its size and availability", func() {
+				Ω(bridgedPool.InitialSize()).Should(Equal(2))
+
+				_, err := bridgedPool.Acquire("some-handle")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(bridgedPool.Available()).Should(Equal(1))
+
+				usage := bridgedPool.Usage()
+				Ω(usage.Size).Should(Equal(5))
+				Ω(usage.Allocated).Should(Equal(1))
+				Ω(usage.Available).Should(Equal(1))
+				Ω(usage.MaxContainers).Should(Equal(2))
+			})
+
+			It("still removes networks journaled beyond the limit", func() {
+				for i := 0; i < 2; i++ {
+					_, err := bridgedPool.Acquire("some-handle")
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+
+				_, ipNet, err := net.ParseCIDR("10.254.0.0/29")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				journaled := network.NewBridged(ipNet, net.ParseIP("10.254.0.1"), net.ParseIP("10.254.0.6"))
+
+				err = bridgedPool.Remove("some-handle", journaled)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(bridgedPool.Available()).Should(Equal(0))
+			})
+		})
+	})
+
+	Describe("a pool for routed containers", func() {
+		var routedPool *network_pool.RealNetworkPool
+
+		BeforeEach(func() {
+			_, ipNet, err := net.ParseCIDR("10.0.16.0/29")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			routedPool = network_pool.NewRouted(ipNet, net.ParseIP("10.0.16.3"))
+		})
+
+		It("hands out single addresses, skipping the host's", func() {
+			var acquired []string
+
+			for i := 0; i < 5; i++ {
+				network, err := routedPool.Acquire("some-handle")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(network.HostIP().String()).Should(Equal("10.0.16.3"))
+				Ω(network.PrefixLength()).Should(Equal(32))
+
+				acquired = append(acquired, network.String())
+			}
+
+			Ω(acquired).Should(Equal([]string{
+				"10.0.16.1/32",
+				"10.0.16.2/32",
+				"10.0.16.4/32",
+				"10.0.16.5/32",
+				"10.0.16.6/32",
+			}))
+
+			_, err := routedPool.Acquire("some-handle")
+			Ω(err).Should(Equal(network_pool.PoolExhaustedError{}))
+		})
+
+		It("can remove a network that was journaled", func() {
+			acquired, err := routedPool.Acquire("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			routedPool.Release("some-handle", acquired)
+
+			encoded, err := json.Marshal(acquired)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var restored network.Network
+			err = json.Unmarshal(encoded, &restored)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(restored.String()).Should(Equal("10.0.16.1/32"))
+			Ω(restored.HostIP().String()).Should(Equal("10.0.16.3"))
+
+			err = routedPool.Remove("some-handle", &restored)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(routedPool.Available()).Should(Equal(4))
+		})
+	})
 })
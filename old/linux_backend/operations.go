@@ -0,0 +1,172 @@
+package linux_backend
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Operation is a long-running operation on a container that is in flight,
+// which can be cancelled by its ID.
+type Operation struct {
+	ID      string    `json:"id"`
+	Kind    string    `json:"kind"`
+	Handle  string    `json:"handle"`
+	Started time.Time `json:"started"`
+
+	cancelled  chan struct{}
+	cancelOnce *sync.Once
+}
+
+// Cancelled is closed once the operation is cancelled.
+func (o *Operation) Cancelled() <-chan struct{} {
+	return o.cancelled
+}
+
+func (o *Operation) IsCancelled() bool {
+	select {
+	case <-o.cancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+func (o *Operation) cancel() {
+	o.cancelOnce.Do(func() {
+		close(o.cancelled)
+	})
+}
+
+type OperationCancelledError struct {
+	Kind   string
+	Handle string
+}
+
+func (e OperationCancelledError) Error() string {
+	return fmt.Sprintf("%s of %s was cancelled", e.Kind, e.Handle)
+}
+
+type OperationExistsError struct {
+	ID string
+}
+
+func (e OperationExistsError) Error() string {
+	return fmt.Sprintf("operation already in flight: %s", e.ID)
+}
+
+type UnknownOperationError struct {
+	ID string
+}
+
+func (e UnknownOperationError) Error() string {
+	return fmt.Sprintf("unknown operation: %s", e.ID)
+}
+
+// operations generated without a request ID are numbered across every
+// container, so that their IDs are unique
+var lastOperationID uint64
+
+// operations tracks the operations in flight, of a backend or a container.
+type operations struct {
+	mutex    sync.Mutex
+	inFlight map[string]*Operation
+}
+
+func newOperations() *operations {
+	return &operations{
+		inFlight: make(map[string]*Operation),
+	}
+}
+
+func (o *operations) start(kind, handle, id string) (*Operation, error) {
+	if id == "" {
+		id = kind + "-" + strconv.FormatUint(atomic.AddUint64(&lastOperationID, 1), 10)
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if _, found := o.inFlight[id]; found {
+		return nil, OperationExistsError{id}
+	}
+
+	op := &Operation{
+		ID:      id,
+		Kind:    kind,
+		Handle:  handle,
+		Started: time.Now(),
+
+		cancelled:  make(chan struct{}),
+		cancelOnce: new(sync.Once),
+	}
+
+	o.inFlight[id] = op
+
+	return op, nil
+}
+
+func (o *operations) finish(op *Operation) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	delete(o.inFlight, op.ID)
+}
+
+func (o *operations) cancel(id string) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	op, found := o.inFlight[id]
+	if !found {
+		return false
+	}
+
+	op.cancel()
+
+	return true
+}
+
+// cancelHandle cancels every operation on the handle, returning whether
+// there were any
+func (o *operations) cancelHandle(handle string) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	cancelled := false
+
+	for _, op := range o.inFlight {
+		if op.Handle == handle {
+			op.cancel()
+			cancelled = true
+		}
+	}
+
+	return cancelled
+}
+
+func (o *operations) list() []Operation {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	list := []Operation{}
+	for _, op := range o.inFlight {
+		list = append(list, *op)
+	}
+
+	return list
+}
+
+type operationsByStart []Operation
+
+func (s operationsByStart) Len() int           { return len(s) }
+func (s operationsByStart) Less(i, j int) bool { return s[i].Started.Before(s[j].Started) }
+func (s operationsByStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func sortOperations(ops []Operation) []Operation {
+	sort.Sort(operationsByStart(ops))
+	return ops
+}
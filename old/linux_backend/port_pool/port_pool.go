@@ -97,3 +97,15 @@ func (p *PortPool) Release(port uint32) {
 
 	p.pool = append(p.pool, port)
 }
+
+func (p *PortPool) InitialSize() int {
+	return int(p.size)
+}
+
+// Available returns the number of ports that can still be acquired.
+func (p *PortPool) Available() int {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	return len(p.pool)
+}
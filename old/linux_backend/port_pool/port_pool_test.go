@@ -119,4 +119,29 @@ var _ = Describe("Port pool", func() {
 			})
 		})
 	})
+
+	Describe("InitialSize", func() {
+		It("returns the size of the pool, regardless of what is acquired", func() {
+			pool := port_pool.New(10000, 5)
+
+			_, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(pool.InitialSize()).Should(Equal(5))
+		})
+	})
+
+	Describe("Available", func() {
+		It("returns the count of ports that can still be acquired", func() {
+			pool := port_pool.New(10000, 5)
+			Ω(pool.Available()).Should(Equal(5))
+
+			port, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pool.Available()).Should(Equal(4))
+
+			pool.Release(port)
+			Ω(pool.Available()).Should(Equal(5))
+		})
+	})
 })
@@ -6,36 +6,176 @@ import (
 	"sync"
 )
 
+// how far output may get ahead of the slowest of its sinks before writing it
+// blocks
+const fanoutWindow = 64 * 1024
+
+// fanoutWriter copies a process's output to each of the sinks attached to
+// it. Each sink is written to from its own goroutine, from its own cursor
+// into the output, so that one slow sink does not hold up the others until
+// it falls a whole window behind. Then it holds up the writer, and so the
+// process, rather than have its output buffered without bound.
+//
+// A sink sees the output written from when it is added; one that fails to
+// be written to is dropped.
 type fanoutWriter struct {
-	sinks  []io.Writer
-	closed bool
-	sinksL sync.Mutex
+	sinks map[*fanoutSink]struct{}
+
+	// output from offset start that not every sink has been written yet
+	buffer []byte
+	start  int64
+
+	closed  bool
+	drained sync.WaitGroup
+
+	cond *sync.Cond
+}
+
+type fanoutSink struct {
+	w      io.Writer
+	cursor int64
+}
+
+func newFanoutWriter() *fanoutWriter {
+	return &fanoutWriter{
+		sinks: make(map[*fanoutSink]struct{}),
+		cond:  sync.NewCond(new(sync.Mutex)),
+	}
 }
 
 func (w *fanoutWriter) Write(data []byte) (int, error) {
-	w.sinksL.Lock()
+	w.cond.L.Lock()
+	defer w.cond.L.Unlock()
+
+	written := 0
+
+	for written < len(data) {
+		if w.closed {
+			return written, errors.New("write after close")
+		}
+
+		if len(w.sinks) == 0 {
+			// nothing to hold it for
+			w.start += int64(len(data) - written)
+			return len(data), nil
+		}
+
+		room := fanoutWindow - len(w.buffer)
+		if room <= 0 {
+			w.cond.Wait()
+			continue
+		}
+
+		chunk := data[written:]
+		if len(chunk) > room {
+			chunk = chunk[:room]
+		}
+
+		w.buffer = append(w.buffer, chunk...)
+		written += len(chunk)
+
+		w.cond.Broadcast()
+	}
+
+	return written, nil
+}
+
+func (w *fanoutWriter) AddSink(sink io.Writer) {
+	w.cond.L.Lock()
+	defer w.cond.L.Unlock()
 
 	if w.closed {
-		return 0, errors.New("write after close")
+		return
 	}
 
-	// the sinks should be nonblocking and never actually error;
-	// we can assume lossiness here, and do this all within the lock
-	for _, s := range w.sinks {
-		s.Write(data)
+	s := &fanoutSink{
+		w:      sink,
+		cursor: w.end(),
 	}
 
-	w.sinksL.Unlock()
+	w.sinks[s] = struct{}{}
 
-	return len(data), nil
+	w.drained.Add(1)
+	go w.drain(s)
 }
 
-func (w *fanoutWriter) AddSink(sink io.Writer) {
-	w.sinksL.Lock()
+// Close stops accepting output and waits for every sink to be written what
+// was written before it.
+func (w *fanoutWriter) Close() error {
+	w.cond.L.Lock()
+
+	if w.closed {
+		w.cond.L.Unlock()
+		return errors.New("closed twice")
+	}
+
+	w.closed = true
+	w.cond.Broadcast()
+
+	w.cond.L.Unlock()
+
+	w.drained.Wait()
+
+	return nil
+}
+
+func (w *fanoutWriter) drain(s *fanoutSink) {
+	defer w.drained.Done()
+
+	w.cond.L.Lock()
+	defer w.cond.L.Unlock()
+
+	for {
+		for s.cursor == w.end() && !w.closed {
+			w.cond.Wait()
+		}
+
+		if s.cursor == w.end() {
+			w.removeSink(s)
+			return
+		}
+
+		// copied, as the buffer may be appended to while unlocked
+		pending := w.buffer[s.cursor-w.start:]
+		chunk := make([]byte, len(pending))
+		copy(chunk, pending)
 
-	if !w.closed {
-		w.sinks = append(w.sinks, sink)
+		w.cond.L.Unlock()
+		_, err := s.w.Write(chunk)
+		w.cond.L.Lock()
+
+		if err != nil {
+			w.removeSink(s)
+			return
+		}
+
+		s.cursor += int64(len(chunk))
+
+		w.discardWritten()
 	}
+}
+
+func (w *fanoutWriter) removeSink(s *fanoutSink) {
+	delete(w.sinks, s)
+	w.discardWritten()
+}
+
+// discardWritten drops the output every sink has been written, and wakes a
+// writer waiting for room
+func (w *fanoutWriter) discardWritten() {
+	slowest := w.end()
+	for s := range w.sinks {
+		if s.cursor < slowest {
+			slowest = s.cursor
+		}
+	}
+
+	w.buffer = w.buffer[slowest-w.start:]
+	w.start = slowest
+
+	w.cond.Broadcast()
+}
 
-	w.sinksL.Unlock()
+func (w *fanoutWriter) end() int64 {
+	return w.start + int64(len(w.buffer))
 }
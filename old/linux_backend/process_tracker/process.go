@@ -3,8 +3,11 @@ package process_tracker
 import (
 	"bufio"
 	"fmt"
+	"io/ioutil"
 	"os/exec"
 	"path"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/cloudfoundry-incubator/garden/api"
@@ -18,6 +21,7 @@ type Process struct {
 
 	containerPath string
 	runner        command_runner.CommandRunner
+	outputLimit   OutputLimit
 
 	runningLink *sync.Once
 
@@ -37,12 +41,14 @@ func NewProcess(
 	id uint32,
 	containerPath string,
 	runner command_runner.CommandRunner,
+	outputLimit OutputLimit,
 ) *Process {
 	return &Process{
 		id: id,
 
 		containerPath: containerPath,
 		runner:        runner,
+		outputLimit:   outputLimit,
 
 		runningLink: &sync.Once{},
 
@@ -51,8 +57,8 @@ func NewProcess(
 		exited: make(chan struct{}),
 
 		stdin:  &faninWriter{hasSink: make(chan struct{})},
-		stdout: &fanoutWriter{},
-		stderr: &fanoutWriter{},
+		stdout: newFanoutWriter(),
+		stderr: newFanoutWriter(),
 	}
 }
 
@@ -66,7 +72,11 @@ func (p *Process) Wait() (int, error) {
 }
 
 func (p *Process) SetTTY(tty api.TTYSpec) error {
-	<-p.linked
+	select {
+	case <-p.linked:
+	case <-p.exited:
+		return nil
+	}
 
 	if tty.WindowSize != nil {
 		return p.link.SetWindowSize(tty.WindowSize.Columns, tty.WindowSize.Rows)
@@ -101,6 +111,14 @@ func (p *Process) Spawn(cmd *exec.Cmd, tty *api.TTYSpec) (ready, active chan err
 		}
 	}
 
+	if p.outputLimit.Bytes > 0 {
+		bashFlags = append(bashFlags, fmt.Sprintf("-outputLimit=%d", p.outputLimit.Bytes))
+
+		if p.outputLimit.Drop {
+			bashFlags = append(bashFlags, "-dropOutput")
+		}
+	}
+
 	bashFlags = append(bashFlags, "spawn", processSock)
 
 	spawn := exec.Command("bash", append(bashFlags, cmd.Args...)...)
@@ -166,6 +184,13 @@ func (p *Process) runLinker() {
 
 	link, err := link.Create(processSock, p.stdout, p.stderr)
 	if err != nil {
+		// the process may have exited while nothing was linked to it
+		exitStatus, statusErr := p.recordedExitStatus()
+		if statusErr == nil {
+			p.completed(exitStatus, nil)
+			return
+		}
+
 		p.completed(-1, err)
 		return
 	}
@@ -175,12 +200,32 @@ func (p *Process) runLinker() {
 	p.link = link
 	close(p.linked)
 
-	p.completed(p.link.Wait())
+	exitStatus, err := p.link.Wait()
+
+	// so that attachments are written all of the output before the exit
+	// status is reported
+	p.stdout.Close()
+	p.stderr.Close()
+
+	p.completed(exitStatus, err)
 
 	// don't leak stdin pipe
 	p.stdin.Close()
 }
 
+// recordedExitStatus reads the exit status persisted by the i/o daemon when
+// the process exited
+func (p *Process) recordedExitStatus() (int, error) {
+	statusPath := path.Join(p.containerPath, "processes", fmt.Sprintf("%d.sock.status", p.ID()))
+
+	status, err := ioutil.ReadFile(statusPath)
+	if err != nil {
+		return -1, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(status)))
+}
+
 func (p *Process) completed(exitStatus int, err error) {
 	p.exitStatus = exitStatus
 	p.exitErr = err
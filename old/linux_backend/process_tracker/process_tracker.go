@@ -16,9 +16,21 @@ type ProcessTracker interface {
 	ActiveProcesses() []api.Process
 }
 
+// OutputLimit bounds how much of each of a process's output streams the i/o
+// daemon buffers while nothing is reading it. A zero limit leaves only the
+// pipe's own capacity, blocking the process once it fills.
+type OutputLimit struct {
+	Bytes uint64
+
+	// drop output beyond the limit, marking the truncation, rather than
+	// blocking the process
+	Drop bool
+}
+
 type processTracker struct {
 	containerPath string
 	runner        command_runner.CommandRunner
+	outputLimit   OutputLimit
 
 	processes      map[uint32]*Process
 	nextProcessID  uint32
@@ -33,10 +45,11 @@ func (e UnknownProcessError) Error() string {
 	return fmt.Sprintf("unknown process: %d", e.ProcessID)
 }
 
-func New(containerPath string, runner command_runner.CommandRunner) ProcessTracker {
+func New(containerPath string, runner command_runner.CommandRunner, outputLimit OutputLimit) ProcessTracker {
 	return &processTracker{
 		containerPath: containerPath,
 		runner:        runner,
+		outputLimit:   outputLimit,
 
 		processes:      make(map[uint32]*Process),
 		processesMutex: new(sync.RWMutex),
@@ -51,7 +64,7 @@ func (t *processTracker) Run(cmd *exec.Cmd, processIO api.ProcessIO, tty *api.TT
 	processID := t.nextProcessID
 	t.nextProcessID++
 
-	process := NewProcess(processID, t.containerPath, t.runner)
+	process := NewProcess(processID, t.containerPath, t.runner, t.outputLimit)
 
 	t.processes[processID] = process
 
@@ -82,7 +95,7 @@ func (t *processTracker) Attach(processID uint32, processIO api.ProcessIO) (api.
 	t.processesMutex.RUnlock()
 
 	if !ok {
-		return nil, UnknownProcessError{processID}
+		return t.exitedProcess(processID)
 	}
 
 	process.Attach(processIO)
@@ -95,7 +108,7 @@ func (t *processTracker) Attach(processID uint32, processIO api.ProcessIO) (api.
 func (t *processTracker) Restore(processID uint32) {
 	t.processesMutex.Lock()
 
-	process := NewProcess(processID, t.containerPath, t.runner)
+	process := NewProcess(processID, t.containerPath, t.runner, t.outputLimit)
 
 	t.processes[processID] = process
 
@@ -123,6 +136,21 @@ func (t *processTracker) ActiveProcesses() []api.Process {
 	return processes
 }
 
+// exitedProcess returns a completed process for one that exited without
+// being tracked, e.g. across a restart, as long as its exit status was recorded
+func (t *processTracker) exitedProcess(processID uint32) (api.Process, error) {
+	process := NewProcess(processID, t.containerPath, t.runner, t.outputLimit)
+
+	exitStatus, err := process.recordedExitStatus()
+	if err != nil {
+		return nil, UnknownProcessError{processID}
+	}
+
+	process.completed(exitStatus, nil)
+
+	return process, nil
+}
+
 func (t *processTracker) link(processID uint32) {
 	t.processesMutex.RLock()
 	process, ok := t.processes[processID]
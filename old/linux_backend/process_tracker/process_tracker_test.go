@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -44,7 +45,7 @@ var _ = AfterEach(func() {
 
 var _ = Describe("Running processes", func() {
 	BeforeEach(func() {
-		processTracker = process_tracker.New(tmpdir, linux_command_runner.New())
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), process_tracker.OutputLimit{})
 	})
 
 	It("runs the process and returns its exit code", func() {
@@ -189,7 +190,7 @@ var _ = Describe("Running processes", func() {
 
 var _ = Describe("Restoring processes", func() {
 	BeforeEach(func() {
-		processTracker = process_tracker.New(tmpdir, linux_command_runner.New())
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), process_tracker.OutputLimit{})
 	})
 
 	It("makes the next process ID be higher than the highest restored ID", func() {
@@ -206,6 +207,26 @@ var _ = Describe("Restoring processes", func() {
 		Ω(process.ID()).Should(Equal(uint32(6)))
 	})
 
+	Context("when the process exited while it was not being tracked", func() {
+		It("can be attached to and reports its exit status", func() {
+			process, err := process_tracker.New(tmpdir, linux_command_runner.New(), process_tracker.OutputLimit{}).Run(
+				exec.Command("bash", "-c", "exit 42"),
+				api.ProcessIO{},
+				nil,
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(process.Wait()).Should(Equal(42))
+
+			processTracker.Restore(process.ID())
+			Eventually(processTracker.ActiveProcesses).Should(BeEmpty())
+
+			restored, err := processTracker.Attach(process.ID(), api.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(restored.ID()).Should(Equal(process.ID()))
+			Ω(restored.Wait()).Should(Equal(42))
+		})
+	})
+
 	It("tracks the restored process", func() {
 		processTracker.Restore(2)
 
@@ -217,7 +238,7 @@ var _ = Describe("Restoring processes", func() {
 
 var _ = Describe("Attaching to running processes", func() {
 	BeforeEach(func() {
-		processTracker = process_tracker.New(tmpdir, linux_command_runner.New())
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), process_tracker.OutputLimit{})
 	})
 
 	It("streams stdout, stdin, and stderr", func() {
@@ -245,9 +266,98 @@ var _ = Describe("Attaching to running processes", func() {
 	})
 })
 
+var _ = Describe("Streaming output to slow attachments", func() {
+	BeforeEach(func() {
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), process_tracker.OutputLimit{})
+	})
+
+	It("streams to each attachment at its own pace", func() {
+		stdin, stdinWriter := io.Pipe()
+		slow := newBlockingWriter()
+
+		process, err := processTracker.Run(exec.Command("cat"), api.ProcessIO{
+			Stdin:  stdin,
+			Stdout: slow,
+		}, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fast := gbytes.NewBuffer()
+
+		_, err = processTracker.Attach(process.ID(), api.ProcessIO{
+			Stdout: fast,
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		stdinWriter.Write([]byte("hello\n"))
+		Eventually(fast).Should(gbytes.Say("hello\n"))
+
+		Ω(slow.Written()).Should(BeZero())
+
+		slow.Release()
+		Eventually(slow.Written).Should(Equal(len("hello\n")))
+
+		stdinWriter.Close()
+		Ω(process.Wait()).Should(Equal(0))
+	})
+
+	It("holds the process back until an attachment that has fallen behind catches up", func() {
+		slow := newBlockingWriter()
+
+		process, err := processTracker.Run(exec.Command("head", "-c", "4194304", "/dev/zero"), api.ProcessIO{
+			Stdout: slow,
+		}, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		exited := make(chan struct{})
+		go func() {
+			process.Wait()
+			close(exited)
+		}()
+
+		Consistently(exited, 0.5).ShouldNot(BeClosed())
+
+		slow.Release()
+
+		Eventually(exited, 5).Should(BeClosed())
+		Ω(slow.Written()).Should(Equal(4194304))
+	})
+})
+
+type blockingWriter struct {
+	released chan struct{}
+
+	written  int
+	writtenL sync.Mutex
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{released: make(chan struct{})}
+}
+
+func (w *blockingWriter) Write(data []byte) (int, error) {
+	<-w.released
+
+	w.writtenL.Lock()
+	w.written += len(data)
+	w.writtenL.Unlock()
+
+	return len(data), nil
+}
+
+func (w *blockingWriter) Release() {
+	close(w.released)
+}
+
+func (w *blockingWriter) Written() int {
+	w.writtenL.Lock()
+	defer w.writtenL.Unlock()
+
+	return w.written
+}
+
 var _ = Describe("Listing active process IDs", func() {
 	BeforeEach(func() {
-		processTracker = process_tracker.New(tmpdir, linux_command_runner.New())
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), process_tracker.OutputLimit{})
 	})
 
 	It("includes running process IDs", func() {
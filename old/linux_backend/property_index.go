@@ -0,0 +1,90 @@
+package linux_backend
+
+import "github.com/cloudfoundry-incubator/garden/api"
+
+type property struct {
+	key   string
+	value string
+}
+
+// propertyIndex maps each property, key and value, to the handles of the
+// containers that have it, so that containers can be filtered by their
+// properties without looking at every one.
+//
+// Containers' properties never change, so it is only kept up to date as
+// containers come and go. It is guarded by the backend's containersMutex.
+type propertyIndex struct {
+	handles map[property]map[string]struct{}
+}
+
+func newPropertyIndex() *propertyIndex {
+	return &propertyIndex{
+		handles: make(map[property]map[string]struct{}),
+	}
+}
+
+func (i *propertyIndex) add(handle string, properties api.Properties) {
+	for key, value := range properties {
+		prop := property{key, value}
+
+		handles, found := i.handles[prop]
+		if !found {
+			handles = make(map[string]struct{})
+			i.handles[prop] = handles
+		}
+
+		handles[handle] = struct{}{}
+	}
+}
+
+func (i *propertyIndex) remove(handle string, properties api.Properties) {
+	for key, value := range properties {
+		prop := property{key, value}
+
+		handles := i.handles[prop]
+
+		delete(handles, handle)
+
+		if len(handles) == 0 {
+			delete(i.handles, prop)
+		}
+	}
+}
+
+// lookup returns the handles of the containers that have every property in
+// filter, which must not be empty
+func (i *propertyIndex) lookup(filter api.Properties) []string {
+	// the fewest handles to check the other properties of
+	var candidates map[string]struct{}
+
+	for key, value := range filter {
+		handles := i.handles[property{key, value}]
+		if len(handles) == 0 {
+			return nil
+		}
+
+		if candidates == nil || len(handles) < len(candidates) {
+			candidates = handles
+		}
+	}
+
+	matches := []string{}
+
+	for handle := range candidates {
+		if i.hasProperties(handle, filter) {
+			matches = append(matches, handle)
+		}
+	}
+
+	return matches
+}
+
+func (i *propertyIndex) hasProperties(handle string, properties api.Properties) bool {
+	for key, value := range properties {
+		if _, found := i.handles[property{key, value}][handle]; !found {
+			return false
+		}
+	}
+
+	return true
+}
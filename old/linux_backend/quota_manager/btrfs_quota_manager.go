@@ -0,0 +1,209 @@
+package quota_manager
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/pivotal-golang/lager"
+)
+
+// BtrfsQuotaManager enforces disk limits with btrfs qgroups.
+//
+// Each container's rootfs subvolume is assigned to a level-1 qgroup named
+// after the container's uid (1/<uid>) when it is set up, so limits and usage
+// only count the data the container has written itself, not the image layers
+// it shares with other containers.
+//
+// Only subvolumes are given a qgroup, so containers whose rootfs is not one,
+// e.g. one not provided by the btrfs graph driver, can't be limited.
+//
+// Btrfs has no soft or inode limits; only the hard byte limit is applied.
+type BtrfsQuotaManager struct {
+	enabled bool
+
+	runner command_runner.CommandRunner
+
+	mountPoint string
+}
+
+// NotSubvolumeError is returned when limiting a container that has no qgroup
+// as its rootfs is not a btrfs subvolume.
+type NotSubvolumeError struct {
+	UID uint32
+}
+
+func (e NotSubvolumeError) Error() string {
+	return fmt.Sprintf("rootfs of container with uid %d is not a btrfs subvolume, so its disk cannot be limited", e.UID)
+}
+
+func NewBtrfs(runner command_runner.CommandRunner, mountPoint string) *BtrfsQuotaManager {
+	return &BtrfsQuotaManager{
+		enabled: true,
+
+		runner: runner,
+
+		mountPoint: mountPoint,
+	}
+}
+
+// Setup enables quota accounting on the btrfs filesystem.
+func (m *BtrfsQuotaManager) Setup(logger lager.Logger) error {
+	if !m.enabled {
+		return nil
+	}
+
+	runner := logging.Runner{
+		Logger:        logger,
+		CommandRunner: m.runner,
+	}
+
+	return runner.Run(exec.Command("btrfs", "quota", "enable", m.mountPoint))
+}
+
+func (m *BtrfsQuotaManager) Disable() {
+	m.enabled = false
+}
+
+func (m *BtrfsQuotaManager) SetLimits(logger lager.Logger, uid uint32, limits api.DiskLimits) error {
+	if !m.enabled {
+		return nil
+	}
+
+	_, found, err := m.showQgroup(logger, uid)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return NotSubvolumeError{UID: uid}
+	}
+
+	size := "none"
+	if limits.ByteHard != 0 {
+		size = fmt.Sprintf("%d", limits.ByteHard)
+	} else if limits.BlockHard != 0 {
+		size = fmt.Sprintf("%d", limits.BlockHard*QUOTA_BLOCK_SIZE)
+	}
+
+	runner := logging.Runner{
+		Logger:        logger,
+		CommandRunner: m.runner,
+	}
+
+	return runner.Run(
+		exec.Command(
+			"btrfs", "qgroup", "limit",
+			"-e", size,
+			qgroupID(uid),
+			m.mountPoint,
+		),
+	)
+}
+
+func (m *BtrfsQuotaManager) GetLimits(logger lager.Logger, uid uint32) (api.DiskLimits, error) {
+	if !m.enabled {
+		return api.DiskLimits{}, nil
+	}
+
+	qgroup, _, err := m.showQgroup(logger, uid)
+	if err != nil {
+		return api.DiskLimits{}, err
+	}
+
+	return api.DiskLimits{
+		ByteHard:  qgroup.maxExclusive,
+		BlockHard: qgroup.maxExclusive / QUOTA_BLOCK_SIZE,
+	}, nil
+}
+
+func (m *BtrfsQuotaManager) GetUsage(logger lager.Logger, uid uint32) (api.ContainerDiskStat, error) {
+	if !m.enabled {
+		return api.ContainerDiskStat{}, nil
+	}
+
+	qgroup, _, err := m.showQgroup(logger, uid)
+	if err != nil {
+		return api.ContainerDiskStat{}, err
+	}
+
+	return api.ContainerDiskStat{
+		BytesUsed: qgroup.exclusive,
+	}, nil
+}
+
+func (m *BtrfsQuotaManager) MountPoint() string {
+	return m.mountPoint
+}
+
+func (m *BtrfsQuotaManager) Type() QuotaType {
+	return BtrfsQuotas
+}
+
+func (m *BtrfsQuotaManager) IsEnabled() bool {
+	return m.enabled
+}
+
+type qgroupInfo struct {
+	exclusive    uint64
+	maxExclusive uint64
+}
+
+// showQgroup reports the container's qgroup, and whether it has one;
+// containers whose rootfs is not a subvolume don't, and so use nothing and
+// have no limit.
+func (m *BtrfsQuotaManager) showQgroup(logger lager.Logger, uid uint32) (qgroupInfo, bool, error) {
+	show := exec.Command("btrfs", "qgroup", "show", "-re", "--raw", m.mountPoint)
+
+	out := new(bytes.Buffer)
+	show.Stdout = out
+
+	runner := logging.Runner{
+		Logger:        logger,
+		CommandRunner: m.runner,
+	}
+
+	err := runner.Run(show)
+	if err != nil {
+		return qgroupInfo{}, false, err
+	}
+
+	id := qgroupID(uid)
+
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		// qgroupid rfer excl max_rfer max_excl
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != id {
+			continue
+		}
+
+		info := qgroupInfo{}
+
+		info.exclusive, err = strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return qgroupInfo{}, false, err
+		}
+
+		if fields[4] != "none" {
+			info.maxExclusive, err = strconv.ParseUint(fields[4], 10, 64)
+			if err != nil {
+				return qgroupInfo{}, false, err
+			}
+		}
+
+		return info, true, nil
+	}
+
+	return qgroupInfo{}, false, scanner.Err()
+}
+
+func qgroupID(uid uint32) string {
+	return fmt.Sprintf("1/%d", uid)
+}
@@ -0,0 +1,254 @@
+package quota_manager_test
+
+import (
+	"errors"
+	"os/exec"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+)
+
+var _ = Describe("Btrfs Quota manager", func() {
+	var fakeRunner *fake_command_runner.FakeCommandRunner
+	var logger *lagertest.TestLogger
+	var quotaManager *quota_manager.BtrfsQuotaManager
+
+	qgroupShow := fake_command_runner.CommandSpec{
+		Path: "btrfs",
+		Args: []string{"qgroup", "show", "-re", "--raw", "/some/graph"},
+	}
+
+	qgroupShowOutput := `qgroupid         rfer         excl     max_rfer     max_excl
+--------         ----         ----     --------     --------
+0/5             16384        16384         none         none
+0/257       104857600         8192         none         none
+1/1234      104873984      2097152         none      5242880
+1/4321      104873984         4096         none         none
+`
+
+	BeforeEach(func() {
+		fakeRunner = fake_command_runner.New()
+		logger = lagertest.NewTestLogger("test")
+		quotaManager = quota_manager.NewBtrfs(fakeRunner, "/some/graph")
+	})
+
+	Describe("setting up", func() {
+		It("enables quotas on the filesystem", func() {
+			err := quotaManager.Setup(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "btrfs",
+					Args: []string{"quota", "enable", "/some/graph"},
+				},
+			))
+		})
+
+		Context("when quotas are disabled", func() {
+			It("runs nothing", func() {
+				quotaManager.Disable()
+
+				err := quotaManager.Setup(logger)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("setting quotas", func() {
+		var showError error
+
+		BeforeEach(func() {
+			showError = nil
+
+			fakeRunner.WhenRunning(qgroupShow, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(qgroupShowOutput))
+				return showError
+			})
+		})
+
+		It("limits the exclusive usage of the container's qgroup", func() {
+			err := quotaManager.SetLimits(logger, 1234, api.DiskLimits{
+				ByteSoft: 1024,
+				ByteHard: 2048,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "btrfs",
+					Args: []string{"qgroup", "limit", "-e", "2048", "1/1234", "/some/graph"},
+				},
+			))
+		})
+
+		Context("when only blocks are given", func() {
+			It("converts them to bytes", func() {
+				err := quotaManager.SetLimits(logger, 1234, api.DiskLimits{
+					BlockHard: 3,
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "btrfs",
+						Args: []string{"qgroup", "limit", "-e", "3072", "1/1234", "/some/graph"},
+					},
+				))
+			})
+		})
+
+		Context("when no hard limit is given", func() {
+			It("removes the limit", func() {
+				err := quotaManager.SetLimits(logger, 1234, api.DiskLimits{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "btrfs",
+						Args: []string{"qgroup", "limit", "-e", "none", "1/1234", "/some/graph"},
+					},
+				))
+			})
+		})
+
+		Context("when the container has no qgroup, as its rootfs is not a subvolume", func() {
+			It("returns a NotSubvolumeError without limiting anything", func() {
+				err := quotaManager.SetLimits(logger, 9999, api.DiskLimits{ByteHard: 2048})
+				Ω(err).Should(Equal(quota_manager.NotSubvolumeError{UID: 9999}))
+
+				Ω(fakeRunner.ExecutedCommands()).Should(HaveLen(1))
+			})
+		})
+
+		Context("when showing the qgroups fails", func() {
+			nastyError := errors.New("oh no!")
+
+			BeforeEach(func() {
+				showError = nastyError
+			})
+
+			It("returns the error", func() {
+				err := quotaManager.SetLimits(logger, 1234, api.DiskLimits{ByteHard: 2048})
+				Ω(err).Should(Equal(nastyError))
+			})
+		})
+
+		Context("when limiting fails", func() {
+			nastyError := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "btrfs",
+						Args: []string{"qgroup", "limit", "-e", "2048", "1/1234", "/some/graph"},
+					}, func(*exec.Cmd) error {
+						return nastyError
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				err := quotaManager.SetLimits(logger, 1234, api.DiskLimits{ByteHard: 2048})
+				Ω(err).Should(Equal(nastyError))
+			})
+		})
+
+		Context("when quotas are disabled", func() {
+			It("runs nothing", func() {
+				quotaManager.Disable()
+
+				err := quotaManager.SetLimits(logger, 1234, api.DiskLimits{ByteHard: 2048})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("getting quota limits", func() {
+		BeforeEach(func() {
+			fakeRunner.WhenRunning(qgroupShow, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(qgroupShowOutput))
+				return nil
+			})
+		})
+
+		It("returns the exclusive limit of the container's qgroup", func() {
+			limits, err := quotaManager.GetLimits(logger, 1234)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(limits).Should(Equal(api.DiskLimits{
+				ByteHard:  5242880,
+				BlockHard: 5120,
+			}))
+		})
+
+		Context("when the qgroup has no limit", func() {
+			It("returns no limits", func() {
+				limits, err := quotaManager.GetLimits(logger, 4321)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(limits).Should(BeZero())
+			})
+		})
+
+		Context("when the container has no qgroup", func() {
+			It("returns no limits", func() {
+				limits, err := quotaManager.GetLimits(logger, 9999)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(limits).Should(BeZero())
+			})
+		})
+	})
+
+	Describe("getting usage", func() {
+		It("returns the exclusive usage of the container's qgroup", func() {
+			fakeRunner.WhenRunning(qgroupShow, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(qgroupShowOutput))
+				return nil
+			})
+
+			usage, err := quotaManager.GetUsage(logger, 1234)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(usage).Should(Equal(api.ContainerDiskStat{
+				BytesUsed: 2097152,
+			}))
+		})
+
+		Context("when showing the qgroups fails", func() {
+			nastyError := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(qgroupShow, func(*exec.Cmd) error {
+					return nastyError
+				})
+			})
+
+			It("returns the error", func() {
+				_, err := quotaManager.GetUsage(logger, 1234)
+				Ω(err).Should(Equal(nastyError))
+			})
+		})
+
+		Context("when quotas are disabled", func() {
+			It("runs nothing", func() {
+				quotaManager.Disable()
+
+				usage, err := quotaManager.GetUsage(logger, 1234)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(usage).Should(BeZero())
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+		})
+	})
+})
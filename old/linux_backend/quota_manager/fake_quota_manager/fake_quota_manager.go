@@ -3,6 +3,7 @@ package fake_quota_manager
 import (
 	"sync"
 
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager"
 	"github.com/cloudfoundry-incubator/garden/api"
 	"github.com/pivotal-golang/lager"
 )
@@ -16,6 +17,7 @@ type FakeQuotaManager struct {
 	GetUsageResult  api.ContainerDiskStat
 
 	MountPointResult string
+	TypeResult       quota_manager.QuotaType
 
 	Limited map[uint32]api.DiskLimits
 
@@ -28,6 +30,8 @@ func New() *FakeQuotaManager {
 	return &FakeQuotaManager{
 		Limited: make(map[uint32]api.DiskLimits),
 
+		TypeResult: quota_manager.UserQuotas,
+
 		enabled: true,
 	}
 }
@@ -71,6 +75,10 @@ func (m *FakeQuotaManager) MountPoint() string {
 	return m.MountPointResult
 }
 
+func (m *FakeQuotaManager) Type() quota_manager.QuotaType {
+	return m.TypeResult
+}
+
 func (m *FakeQuotaManager) Disable() {
 	m.enabled = false
 }
@@ -19,12 +19,30 @@ type QuotaManager interface {
 	GetUsage(logger lager.Logger, uid uint32) (api.ContainerDiskStat, error)
 
 	MountPoint() string
+	Type() QuotaType
 	Disable()
 	IsEnabled() bool
 }
 
+type QuotaType string
+
+const (
+	// quotas on the container's uid, which do not account for files written
+	// by other users, e.g. root
+	UserQuotas QuotaType = "user"
+
+	// quotas on a project named after the container's uid, which its rootfs
+	// is assigned to when it is set up, so that all files written to the
+	// rootfs are accounted for
+	ProjectQuotas QuotaType = "project"
+
+	// see BtrfsQuotaManager
+	BtrfsQuotas QuotaType = "btrfs"
+)
+
 type LinuxQuotaManager struct {
-	enabled bool
+	enabled   bool
+	quotaType QuotaType
 
 	binPath string
 	runner  command_runner.CommandRunner
@@ -36,7 +54,8 @@ const QUOTA_BLOCK_SIZE = 1024
 
 func New(runner command_runner.CommandRunner, mountPoint, binPath string) *LinuxQuotaManager {
 	return &LinuxQuotaManager{
-		enabled: true,
+		enabled:   true,
+		quotaType: UserQuotas,
 
 		binPath: binPath,
 		runner:  runner,
@@ -45,6 +64,15 @@ func New(runner command_runner.CommandRunner, mountPoint, binPath string) *Linux
 	}
 }
 
+// NewProject returns a quota manager using project quotas (supported by xfs,
+// and ext4 formatted with the project feature) rather than user quotas; the
+// filesystem must be mounted with project quotas enabled.
+func NewProject(runner command_runner.CommandRunner, mountPoint, binPath string) *LinuxQuotaManager {
+	manager := New(runner, mountPoint, binPath)
+	manager.quotaType = ProjectQuotas
+	return manager
+}
+
 func (m *LinuxQuotaManager) Disable() {
 	m.enabled = false
 }
@@ -70,7 +98,7 @@ func (m *LinuxQuotaManager) SetLimits(logger lager.Logger, uid uint32, limits ap
 	return runner.Run(
 		exec.Command(
 			"setquota",
-			"-u",
+			m.setquotaFlag(),
 			fmt.Sprintf("%d", uid),
 			fmt.Sprintf("%d", limits.BlockSoft),
 			fmt.Sprintf("%d", limits.BlockHard),
@@ -86,7 +114,7 @@ func (m *LinuxQuotaManager) GetLimits(logger lager.Logger, uid uint32) (api.Disk
 		return api.DiskLimits{}, nil
 	}
 
-	repquota := exec.Command(path.Join(m.binPath, "repquota"), m.mountPoint, fmt.Sprintf("%d", uid))
+	repquota := exec.Command(path.Join(m.binPath, "repquota"), m.repquotaArgs(uid)...)
 
 	limits := api.DiskLimits{}
 
@@ -135,7 +163,7 @@ func (m *LinuxQuotaManager) GetUsage(logger lager.Logger, uid uint32) (api.Conta
 		return api.ContainerDiskStat{}, nil
 	}
 
-	repquota := exec.Command(path.Join(m.binPath, "repquota"), m.mountPoint, fmt.Sprintf("%d", uid))
+	repquota := exec.Command(path.Join(m.binPath, "repquota"), m.repquotaArgs(uid)...)
 
 	usage := api.ContainerDiskStat{}
 
@@ -175,6 +203,28 @@ func (m *LinuxQuotaManager) MountPoint() string {
 	return m.mountPoint
 }
 
+func (m *LinuxQuotaManager) Type() QuotaType {
+	return m.quotaType
+}
+
 func (m *LinuxQuotaManager) IsEnabled() bool {
 	return m.enabled
 }
+
+func (m *LinuxQuotaManager) setquotaFlag() string {
+	if m.quotaType == ProjectQuotas {
+		return "-P"
+	}
+
+	return "-u"
+}
+
+func (m *LinuxQuotaManager) repquotaArgs(uid uint32) []string {
+	args := []string{m.mountPoint, fmt.Sprintf("%d", uid)}
+
+	if m.quotaType == ProjectQuotas {
+		args = append([]string{"-p"}, args...)
+	}
+
+	return args
+}
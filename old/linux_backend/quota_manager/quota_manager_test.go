@@ -280,4 +280,60 @@ var _ = Describe("Linux Quota manager", func() {
 			Ω(quotaManager.MountPoint()).Should(Equal("/some/mount/point"))
 		})
 	})
+
+	Describe("getting the type", func() {
+		It("uses user quotas", func() {
+			Ω(quotaManager.Type()).Should(Equal(quota_manager.UserQuotas))
+		})
+	})
+
+	Context("with project quotas", func() {
+		BeforeEach(func() {
+			quotaManager = quota_manager.NewProject(fakeRunner, "/some/mount/point", "/root/path")
+		})
+
+		It("uses project quotas", func() {
+			Ω(quotaManager.Type()).Should(Equal(quota_manager.ProjectQuotas))
+		})
+
+		It("sets the quota of the project named after the uid", func() {
+			err := quotaManager.SetLimits(logger, 1234, api.DiskLimits{
+				BlockSoft: 1,
+				BlockHard: 2,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "setquota",
+					Args: []string{
+						"-P", "1234",
+						"1", "2", "0", "0",
+						"/some/mount/point",
+					},
+				},
+			))
+		})
+
+		It("reports the limits and usage of the project named after the uid", func() {
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: "/root/path/repquota",
+					Args: []string{"-p", "/some/mount/point", "1234"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("1234 111 222 333 444 555 666 777 888\n"))
+
+					return nil
+				},
+			)
+
+			limits, err := quotaManager.GetLimits(logger, 1234)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(limits.BlockHard).Should(Equal(uint64(333)))
+
+			usage, err := quotaManager.GetUsage(logger, 1234)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(usage.BytesUsed).Should(Equal(uint64(111)))
+		})
+	})
 })
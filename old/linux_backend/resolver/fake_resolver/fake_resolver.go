@@ -0,0 +1,64 @@
+package fake_resolver
+
+import (
+	"net"
+	"sync"
+)
+
+type FakeResolver struct {
+	addresses map[string][]net.IP
+	errors    map[string]error
+
+	lookedUp []string
+
+	mutex *sync.Mutex
+}
+
+func New() *FakeResolver {
+	return &FakeResolver{
+		addresses: map[string][]net.IP{},
+		errors:    map[string]error{},
+
+		mutex: new(sync.Mutex),
+	}
+}
+
+func (r *FakeResolver) LookupIP(host string) ([]net.IP, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.lookedUp = append(r.lookedUp, host)
+
+	if err, found := r.errors[host]; found {
+		return nil, err
+	}
+
+	return r.addresses[host], nil
+}
+
+func (r *FakeResolver) Resolves(host string, addresses ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ips := []net.IP{}
+	for _, address := range addresses {
+		ips = append(ips, net.ParseIP(address))
+	}
+
+	r.addresses[host] = ips
+	delete(r.errors, host)
+}
+
+func (r *FakeResolver) Fails(host string, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.errors[host] = err
+}
+
+func (r *FakeResolver) LookedUp() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string{}, r.lookedUp...)
+}
@@ -0,0 +1,14 @@
+package resolver
+
+import "net"
+
+type Resolver struct{}
+
+// New returns a resolver that looks hostnames up as the host does.
+func New() Resolver {
+	return Resolver{}
+}
+
+func (Resolver) LookupIP(host string) ([]net.IP, error) {
+	return net.LookupIP(host)
+}
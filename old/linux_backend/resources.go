@@ -34,3 +34,19 @@ func (r *Resources) AddPort(port uint32) {
 
 	r.Ports = append(r.Ports, port)
 }
+
+// RemovePort removes the port from the resources, returning whether they
+// held it.
+func (r *Resources) RemovePort(port uint32) bool {
+	r.portsLock.Lock()
+	defer r.portsLock.Unlock()
+
+	for i, existing := range r.Ports {
+		if existing == port {
+			r.Ports = append(r.Ports[:i], r.Ports[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,84 @@
+#!/bin/bash
+
+[ -n "$DEBUG" ] && set -o xtrace
+set -o nounset
+set -o errexit
+shopt -s nullglob
+
+cd $(dirname $0)
+
+source ./etc/config
+
+images=$PWD/checkpoint
+
+# The container's processes are the tree under wshd, in their own
+# namespaces, cgroups and rootfs
+criu_opts="--images-dir $images --manage-cgroups --tcp-established --ext-unix-sk --file-locks"
+
+case "${1}" in
+  "dump")
+    if [ ! -f ./run/wshd.pid ]
+    then
+      echo "wshd is not running..."
+      exit 1
+    fi
+
+    rm -rf $images
+    mkdir -p $images
+
+    criu dump $criu_opts \
+      --tree $(cat ./run/wshd.pid) \
+      --log-file $images/dump.log
+
+    # Dumping kills the tree, and its veth pair with its network namespace
+    rm -f ./run/wshd.pid
+
+    # The cgroups are in the images, and recreated on restore; remove them
+    # now, as destroy.sh only does so while wshd is running
+    cgroup_parent=${GARDEN_CGROUP_PARENT:+/$GARDEN_CGROUP_PARENT}
+
+    for system_path in ${GARDEN_CGROUP_PATH}/*
+    do
+      path=$system_path$cgroup_parent/instance-$id
+
+      if [ -d $path ]
+      then
+        find $path -type d -delete
+      fi
+    done
+
+    ;;
+
+  "restore")
+    if [ ! -d $images ]
+    then
+      echo "no checkpoint to restore..."
+      exit 1
+    fi
+
+    criu restore $criu_opts \
+      --root $rootfs_path \
+      --veth-pair ${network_container_iface}=${network_host_iface} \
+      --restore-detached \
+      --pidfile $PWD/run/wshd.pid \
+      --log-file $images/restore.log
+
+    # The same rules are needed when restoring on another host
+    ./net.sh setup
+    ./net.sh host_iface
+
+    if [ "${GARDEN_DNS_FORWARDER:-false}" == "true" ]
+    then
+      ./net.sh dns
+    fi
+
+    rm -rf $images
+
+    ;;
+
+  *)
+    echo "Unknown command: ${1}" 1>&2
+    exit 1
+
+    ;;
+esac
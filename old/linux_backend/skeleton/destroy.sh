@@ -9,16 +9,25 @@ cd $(dirname $0)
 
 source ./etc/config
 
-./net.sh teardown
+# Release the qgroup set up for a btrfs subvolume rootfs, if any
+rootfs_path=${rootfs_path:-}
+if [ -n "$rootfs_path" ] && command -v btrfs > /dev/null && btrfs subvolume show $rootfs_path > /dev/null 2>&1
+then
+  subvolume_id=$(btrfs inspect-internal rootid $rootfs_path)
+
+  btrfs qgroup remove 0/$subvolume_id 1/$user_uid $rootfs_path > /dev/null 2>&1 || true
+  btrfs qgroup destroy 1/$user_uid $rootfs_path > /dev/null 2>&1 || true
+fi
 
 cgroup_path="${GARDEN_CGROUP_PATH}"
+cgroup_parent=${GARDEN_CGROUP_PARENT:+/$GARDEN_CGROUP_PARENT}
 
 if [ -f ./run/wshd.pid ]
 then
   pid=$(cat ./run/wshd.pid)
 
   # Arbitrarily pick the cpu substem to check for live tasks.
-  path=${cgroup_path}/cpu/instance-$id
+  path=${cgroup_path}/cpu$cgroup_parent/instance-$id
   tasks=$path/tasks
 
   if [ -d $path ]
@@ -41,7 +50,7 @@ then
   # Remove cgroups
   for system_path in ${cgroup_path}/*
   do
-    path=$system_path/instance-$id
+    path=$system_path$cgroup_parent/instance-$id
 
     if [ -d $path ]
     then
@@ -16,18 +16,43 @@ mkdir -p /proc
 mount -t proc none /proc
 
 mkdir -p /dev/shm
-mount -t tmpfs tmpfs /dev/shm
+if [ "${shm_size:-0}" != "0" ]; then
+  mount -t tmpfs -o size=$shm_size tmpfs /dev/shm
+else
+  mount -t tmpfs tmpfs /dev/shm
+fi
 
-hostname $id
+# Requested tmpfs mounts, as path[:size]; made after pivoting so that
+# symlinks in the rootfs resolve within it
+for tmpfs_mount in $(echo ${tmpfs_mounts:-} | tr , ' '); do
+  tmpfs_path=${tmpfs_mount%%:*}
+  tmpfs_opts="mode=1777"
+
+  if [ "$tmpfs_path" != "$tmpfs_mount" ]; then
+    tmpfs_opts="${tmpfs_opts},size=${tmpfs_mount#*:}"
+  fi
 
-ip address add 127.0.0.1/8 dev lo
-ip link set lo up
+  mkdir -p $tmpfs_path
+  mount -n -t tmpfs -o $tmpfs_opts tmpfs $tmpfs_path
+done
 
-ip address add $network_container_ip/30 dev $network_container_iface
-ip link set $network_container_iface mtu $container_iface_mtu up
+hostname $id
 
-ip route add default via $network_host_ip dev $network_container_iface
+# Configured by a static helper from the depot rather than with ip(8), so
+# that the rootfs need not provide iproute2
+bin/netconfig \
+  -interface $network_container_iface \
+  -containerIP $network_container_ip \
+  -prefixLength ${network_prefix_length:-30} \
+  -hostIP $network_host_ip \
+  -mtu ${container_iface_mtu:-1500} \
+  -routed=${network_routed:-false} \
+  -staticNeighbours=${network_static_neighbours:-false}
 
 if [ -e /etc/seed ]; then
   . /etc/seed
 fi
+
+if [ "${read_only_rootfs:-false}" = "true" ]; then
+  mount -n -o remount,bind,ro /
+fi
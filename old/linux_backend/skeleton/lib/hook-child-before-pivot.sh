@@ -8,4 +8,37 @@ cd $(dirname $0)/../
 
 . etc/config
 
-# Placeholder
+# Writable scratch space for a read-only rootfs; /tmp must be mounted before
+# pivoting, as the old root is parked under it
+if [ "${read_only_rootfs:-false}" = "true" ]; then
+  scratch_opts="mode=1777"
+  if [ "${scratch_size:-0}" != "0" ]; then
+    scratch_opts="${scratch_opts},size=${scratch_size}"
+  fi
+
+  for scratch in tmp run; do
+    mkdir -p $rootfs_path/$scratch
+    mount -n -t tmpfs -o $scratch_opts tmpfs $rootfs_path/$scratch
+  done
+fi
+
+# Delegate the container's own cgroups to it, so that a garden nested inside
+# it can create its containers' cgroups beneath them; the marker tells the
+# nested garden's setup.sh to use them
+if [ "${nested:-false}" = "true" ]; then
+  cgroup_parent=${GARDEN_CGROUP_PARENT:+/$GARDEN_CGROUP_PARENT}
+
+  mkdir -p $rootfs_path/sys/fs/cgroup
+  mount -n -t tmpfs -o mode=0755 cgroup $rootfs_path/sys/fs/cgroup
+
+  for system_path in ${GARDEN_CGROUP_PATH}/*; do
+    instance_path=$system_path$cgroup_parent/instance-$id
+
+    if [ -d $instance_path ]; then
+      mkdir -p $rootfs_path/sys/fs/cgroup/$(basename $system_path)
+      mount -n --bind $instance_path $rootfs_path/sys/fs/cgroup/$(basename $system_path)
+    fi
+  done
+
+  touch $rootfs_path/sys/fs/cgroup/garden-delegated
+fi
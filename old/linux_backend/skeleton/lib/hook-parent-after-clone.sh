@@ -9,23 +9,47 @@ cd $(dirname $0)/../
 
 source etc/config
 
+# e.g. /system.slice/garden, or empty to create cgroups at the root
+cgroup_parent=${GARDEN_CGROUP_PARENT:+/$GARDEN_CGROUP_PARENT}
+
 # Add new group for every subsystem
 
 # cpuset must be set up first, so that cpuset.cpus and cpuset.mems is assigned
 # otherwise adding the process to the subsystem's tasks will fail with ENOSPC
-for system_path in ${GARDEN_CGROUP_PATH}/{cpuset,cpu,cpuacct,devices,memory}
+for subsystem in cpuset cpu cpuacct devices memory
 do
+  system_path=${GARDEN_CGROUP_PATH}/$subsystem$cgroup_parent
   instance_path=$system_path/instance-$id
 
   mkdir -p $instance_path
 
-  if [ $(basename $system_path) == "cpuset" ]
+  if [ $subsystem == "cpuset" ]
   then
-    cat $system_path/cpuset.cpus > $instance_path/cpuset.cpus
+    if [ -n "${cpuset_cpus:-}" ]
+    then
+      echo $cpuset_cpus > $instance_path/cpuset.cpus
+    else
+      cat $system_path/cpuset.cpus > $instance_path/cpuset.cpus
+    fi
+
     cat $system_path/cpuset.mems > $instance_path/cpuset.mems
   fi
 
-  if [ $(basename $system_path) == "devices" ]
+  if [ $subsystem == "cpu" ]
+  then
+    # the period must be set first, as the quota is validated against it
+    if [ ${cpu_period_us:-0} -gt 0 ]
+    then
+      echo $cpu_period_us > $instance_path/cpu.cfs_period_us
+    fi
+
+    if [ ${cpu_quota_us:-0} -gt 0 ]
+    then
+      echo $cpu_quota_us > $instance_path/cpu.cfs_quota_us
+    fi
+  fi
+
+  if [ $subsystem == "devices" ]
   then
     # Deny everything, allow explicitly
     echo a > $instance_path/devices.deny
@@ -60,18 +84,76 @@ do
     echo "c 10:200 rwm" > $instance_path/devices.allow
     # /dev/fuse
     echo "c 10:229 rwm" > $instance_path/devices.allow
+
+    if [ "${nested:-false}" = "true" ]
+    then
+      # /dev/loop*, for the graph and quotas of a nested garden
+      echo "b 7:* rwm" > $instance_path/devices.allow
+      # /dev/loop-control
+      echo "c 10:237 rwm" > $instance_path/devices.allow
+    fi
   fi
 
   echo $PID > $instance_path/tasks
 done
 
+# Limit the number of processes, if limited and supported
+pids_path=${GARDEN_CGROUP_PATH}/pids$cgroup_parent
+
+if [ -d ${GARDEN_CGROUP_PATH}/pids ]
+then
+  instance_path=$pids_path/instance-$id
+
+  mkdir -p $instance_path
+
+  if [ ${pids_max:-0} -gt 0 ]
+  then
+    echo $pids_max > $instance_path/pids.max
+  fi
+
+  echo $PID > $instance_path/tasks
+fi
+
+# Throttle block IO on the disk holding the depot, if limited and supported
+blkio_path=${GARDEN_CGROUP_PATH}/blkio$cgroup_parent
+
+if [ -d ${GARDEN_CGROUP_PATH}/blkio ]
+then
+  instance_path=$blkio_path/instance-$id
+
+  mkdir -p $instance_path
+
+  device=$(mountpoint -d $(df -P . | tail -1 | awk '{print $NF}'))
+
+  # throttling applies to whole disks, not their partitions
+  if [ -f /sys/dev/block/$device/partition ]
+  then
+    device=$(cat /sys/dev/block/$device/../dev)
+  fi
+
+  for limit in read_bps:${blkio_read_bps:-0} write_bps:${blkio_write_bps:-0} read_iops:${blkio_read_iops:-0} write_iops:${blkio_write_iops:-0}
+  do
+    if [ ${limit#*:} -gt 0 ]
+    then
+      echo "$device ${limit#*:}" > $instance_path/blkio.throttle.${limit%:*}_device
+    fi
+  done
+
+  echo $PID > $instance_path/tasks
+fi
+
+# Processes wshd spawns inherit its oom_score_adj
+if [ "${oom_score_adj:-0}" != "0" ]
+then
+  echo $oom_score_adj > /proc/$PID/oom_score_adj
+fi
+
 echo $PID > ./run/wshd.pid
 
-ip link add name $network_host_iface type veth peer name $network_container_iface
+ip link add name $network_host_iface type veth peer name $network_container_iface ${network_container_mac:+address $network_container_mac}
 ip link set $network_host_iface netns 1
 ip link set $network_container_iface netns $PID
 
-ip address add $network_host_ip/30 dev $network_host_iface
-ip link set $network_host_iface up
+./net.sh host_iface
 
 exit 0
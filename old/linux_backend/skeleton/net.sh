@@ -16,16 +16,29 @@ nat_prerouting_chain="${GARDEN_IPTABLES_NAT_PREROUTING_CHAIN}"
 nat_postrouting_chain="${GARDEN_IPTABLES_NAT_POSTROUTING_CHAIN}"
 nat_instance_prefix="${GARDEN_IPTABLES_NAT_INSTANCE_PREFIX}"
 interface_name_prefix="${GARDEN_NETWORK_INTERFACE_PREFIX}"
+route_table="${GARDEN_NETWORK_ROUTE_TABLE:-}"
 
 filter_instance_chain="${filter_instance_prefix}${id}"
 nat_instance_chain="${filter_instance_prefix}${id}"
 
-external_ip=$(ip route get 8.8.8.8 | sed 's/.*src\s\(.*\)\s/\1/;tx;d;:x')
+external_ip=$(ip route get 8.8.8.8 | sed -n 's/.*\ssrc\s\+\([^ ]*\).*/\1/p' | head -n 1)
+
+# The traffic the container sends; traffic from containers on a shared
+# bridge enters through the bridge, so match the bridge port
+function container_traffic() {
+  if [ -n "${network_bridge:-}" ]
+  then
+    echo "-m physdev --physdev-in ${network_host_iface}"
+  else
+    echo "--in-interface ${network_host_iface}"
+  fi
+}
 
 function teardown_filter() {
-  # Prune forward chain
+  # Prune forward chain, of the jump to the instance chain and the rules
+  # marked as the container's
   iptables -w -S ${filter_forward_chain} 2> /dev/null |
-    grep "\-g ${filter_instance_chain}\b" |
+    grep -e "\-g ${filter_instance_chain}\b" -e "\-\-comment ${filter_instance_chain}\b" |
     sed -e "s/-A/-D/" |
     xargs --no-run-if-empty --max-lines=1 iptables -w
 
@@ -44,8 +57,38 @@ function setup_filter() {
 
   # Bind instance chain to forward chain
   iptables -w -I ${filter_forward_chain} 2 \
-    --in-interface ${network_host_iface} \
+    $(container_traffic) \
     --goto ${filter_instance_chain}
+
+  # Refuse the container's new connections once it has as many tracked as
+  # it may, ahead of the instance chain, whose net-out rules would accept
+  # them; marked as the container's, as it is outside its chain
+  if [ "${max_conntrack_entries:-0}" -gt 0 ]
+  then
+    iptables -w -I ${filter_forward_chain} 2 \
+      $(container_traffic) \
+      -m conntrack --ctstate NEW \
+      -m connlimit --connlimit-above ${max_conntrack_entries} --connlimit-mask 32 --connlimit-saddr \
+      -m comment --comment ${filter_instance_chain} \
+      --jump REJECT
+  fi
+}
+
+# The traffic a port mapping takes: that to the external address, unless the
+# mapping is bound to a host interface and/or address
+function net_in_destination() {
+  if [ -n "${HOST_INTERFACE:-}" ]
+  then
+    echo "--in-interface ${HOST_INTERFACE}"
+  fi
+
+  if [ -n "${HOST_ADDRESS:-}" ]
+  then
+    echo "--destination ${HOST_ADDRESS}"
+  elif [ -z "${HOST_INTERFACE:-}" ]
+  then
+    echo "--destination ${external_ip}"
+  fi
 }
 
 function teardown_nat() {
@@ -55,6 +98,12 @@ function teardown_nat() {
     sed -e "s/-A/-D/" |
     xargs --no-run-if-empty --max-lines=1 iptables -w -t nat
 
+  # Prune postrouting chain of the rules marked as the container's
+  iptables -w -t nat -S ${nat_postrouting_chain} 2> /dev/null |
+    grep "\-\-comment ${nat_instance_chain}\b" |
+    sed -e "s/-A/-D/" -e "s/\s\+\$//" |
+    xargs --no-run-if-empty --max-lines=1 iptables -w -t nat
+
   # Flush and delete instance chain
   iptables -w -t nat -F ${nat_instance_chain} 2> /dev/null || true
   iptables -w -t nat -X ${nat_instance_chain} 2> /dev/null || true
@@ -69,6 +118,115 @@ function setup_nat() {
   # Bind instance chain to prerouting chain
   iptables -w -t nat -A ${nat_prerouting_chain} \
     --jump ${nat_instance_chain}
+
+  # Skip the pool-wide SNAT rule so that the container's traffic keeps its
+  # own address, for networks that route to containers directly; marked as
+  # the container's, as it is outside its chain
+  if [ "${disable_snat:-false}" == "true" ]
+  then
+    iptables -w -t nat -I ${nat_postrouting_chain} 1 \
+      --source ${network_container_ip} \
+      -m comment --comment ${nat_instance_chain} \
+      --jump RETURN
+  fi
+
+  # SNAT the container's traffic to the external IP it was given rather
+  # than the host's, ahead of the pool-wide rule
+  if [ -n "${snat_ip:-}" ]
+  then
+    iptables -w -t nat -I ${nat_postrouting_chain} 1 \
+      --source ${network_container_ip} \
+      -m comment --comment ${nat_instance_chain} \
+      --jump SNAT \
+      --to ${snat_ip}
+  fi
+}
+
+function teardown_dns() {
+  if [ -f ./run/dnsmasq.pid ]
+  then
+    kill $(cat ./run/dnsmasq.pid) 2> /dev/null || true
+    rm -f ./run/dnsmasq.pid
+  fi
+}
+
+function setup_dns() {
+  teardown_dns
+
+  # Answer the container's own and static names, and forward everything
+  # else to the host's resolvers, which may only listen on localhost
+  dnsmasq \
+    --conf-file=/dev/null \
+    --pid-file=$PWD/run/dnsmasq.pid \
+    --listen-address=${network_host_ip} \
+    --bind-interfaces \
+    --except-interface=lo \
+    --no-hosts \
+    --addn-hosts=$PWD/etc/dns_hosts \
+    --resolv-file=/etc/resolv.conf
+}
+
+# Print the address of the network of an address with a prefix length,
+# e.g. 10.0.0.0 for 10.0.0.1 and 30
+function network_address() {
+  local a b c d
+  IFS=. read a b c d <<< "${1}"
+
+  local mask=$(( (0xffffffff << (32 - ${2})) & 0xffffffff ))
+  local address=$(( ((a << 24) | (b << 16) | (c << 8) | d) & mask ))
+
+  echo "$(( (address >> 24) & 255 )).$(( (address >> 16) & 255 )).$(( (address >> 8) & 255 )).$(( address & 255 ))"
+}
+
+# Route the container's subnet, or its address if it has no subnet of its
+# own, through the given table too, for services on the host that route by
+# it rather than by main
+function setup_route() {
+  if [ -n "${network_bridge:-}" ]
+  then
+    ip route replace $network_container_ip/32 dev $network_bridge table $route_table
+  elif [ "${network_routed:-false}" = "true" ]
+  then
+    ip route replace $network_container_ip/32 dev $network_host_iface table $route_table
+  else
+    local subnet=$(network_address $network_host_ip ${network_prefix_length:-30})
+
+    ip route replace $subnet/${network_prefix_length:-30} dev $network_host_iface \
+      src $network_host_ip table $route_table
+  fi
+}
+
+# Configure the host side of the container's veth pair, once it exists
+function setup_host_iface() {
+  if [ -n "${network_bridge:-}" ]
+  then
+    # the bridge already has the host's address
+    ip link set $network_host_iface master $network_bridge
+  elif [ "${network_routed:-false}" != "true" ]
+  then
+    ip address replace $network_host_ip/${network_prefix_length:-30} dev $network_host_iface
+  fi
+
+  # both ends of the pair carry the same frames
+  ip link set $network_host_iface mtu ${container_iface_mtu:-1500} up
+
+  if [ "${network_static_neighbours:-false}" = "true" ]
+  then
+    ip neigh replace $network_container_ip lladdr $network_container_mac \
+      dev $network_bridge nud permanent
+  fi
+
+  if [ "${network_routed:-false}" = "true" ]
+  then
+    # the host's address is on its uplink, which answers ARP on the
+    # container's behalf; route the container's address to it directly
+    ip route replace $network_container_ip/32 dev $network_host_iface
+  fi
+
+  if [ -n "${route_table}" ]
+  then
+    setup_route
+  fi
 }
 
 case "${1}" in
@@ -81,6 +239,69 @@ case "${1}" in
   "teardown")
     teardown_filter
     teardown_nat
+    teardown_dns
+
+    if [ "${network_static_neighbours:-false}" = "true" ]
+    then
+      ip neigh del $network_container_ip dev $network_bridge 2> /dev/null || true
+    fi
+
+    # routes through the host side of the pair go with it, but the bridge
+    # outlives the container
+    if [ -n "${route_table}" ] && [ -n "${network_bridge:-}" ]
+    then
+      ip route del $network_container_ip/32 dev $network_bridge table $route_table 2> /dev/null || true
+    fi
+
+    ;;
+
+  "dns")
+    # The host side of the veth pair only exists once wshd has started
+    setup_dns
+
+    ;;
+
+  "host_iface")
+    setup_host_iface
+
+    ;;
+
+  "repair")
+    # Rewire a running container whose veth pair, or the bridge it was
+    # attached to, was deleted from under it; its namespace lives on
+    if [ -n "${network_bridge:-}" ] && ! ip link show $network_bridge > /dev/null 2>&1
+    then
+      echo "bridge ${network_bridge} does not exist" 1>&2
+      exit 1
+    fi
+
+    if ! ip link show $network_host_iface > /dev/null 2>&1
+    then
+      # a veth pair goes with either of its ends, so the container's end is
+      # gone too
+      pid=$(cat ./run/wshd.pid)
+
+      ip link add name $network_host_iface type veth peer name $network_container_iface ${network_container_mac:+address $network_container_mac}
+      ip link set $network_container_iface netns $pid
+
+      bin/netconfig \
+        -netns /proc/$pid/ns/net \
+        -interface $network_container_iface \
+        -containerIP $network_container_ip \
+        -prefixLength ${network_prefix_length:-30} \
+        -hostIP $network_host_ip \
+        -mtu ${container_iface_mtu:-1500} \
+        -routed=${network_routed:-false} \
+        -staticNeighbours=${network_static_neighbours:-false}
+    fi
+
+    setup_host_iface
+
+    # the forwarder was bound to the host's address on the old interface
+    if [ -f ./run/dnsmasq.pid ]
+    then
+      setup_dns
+    fi
 
     ;;
 
@@ -96,8 +317,28 @@ case "${1}" in
     fi
 
     iptables -w -t nat -A ${nat_instance_chain} \
-      --protocol tcp \
-      --destination "${external_ip}" \
+      --protocol "${PROTOCOL:-tcp}" \
+      $(net_in_destination) \
+      --destination-port "${HOST_PORT}" \
+      --jump DNAT \
+      --to-destination "${network_container_ip}:${CONTAINER_PORT}"
+
+    ;;
+
+  "remove_in")
+    if [ -z "${HOST_PORT:-}" ]; then
+      echo "Please specify HOST_PORT..." 1>&2
+      exit 1
+    fi
+
+    if [ -z "${CONTAINER_PORT:-}" ]; then
+      echo "Please specify CONTAINER_PORT..." 1>&2
+      exit 1
+    fi
+
+    iptables -w -t nat -D ${nat_instance_chain} \
+      --protocol "${PROTOCOL:-tcp}" \
+      $(net_in_destination) \
       --destination-port "${HOST_PORT}" \
       --jump DNAT \
       --to-destination "${network_container_ip}:${CONTAINER_PORT}"
@@ -124,13 +365,34 @@ case "${1}" in
 
     iptables -w -I ${filter_instance_chain} 1 ${opts} --jump RETURN
 
+    ;;
+
+  "remove_out")
+    if [ -z "${NETWORK:-}" ] && [ -z "${PORT:-}" ]; then
+      echo "Please specify NETWORK and/or PORT..." 1>&2
+      exit 1
+    fi
+
+    opts=""
+
+    if [ -n "${NETWORK:-}" ]; then
+      opts="${opts} --destination ${NETWORK}"
+    fi
+
+    if [ -n "${PORT:-}" ]; then
+      opts="${opts} --protocol tcp"
+      opts="${opts} --destination-port ${PORT}"
+    fi
+
+    iptables -w -D ${filter_instance_chain} ${opts} --jump RETURN
+
     ;;
   "get_ingress_info")
     if [ -z "${ID:-}" ]; then
       echo "Please specify container ID..." 1>&2
       exit 1
     fi
-    tc filter show dev ${network_host_iface} parent ffff:
+    tc -s filter show dev ${network_host_iface} parent ffff:
 
     ;;
   "get_egress_info")
@@ -138,7 +400,32 @@ case "${1}" in
       echo "Please specify container ID..." 1>&2
       exit 1
     fi
-    tc qdisc show dev ${network_host_iface}
+    tc -s qdisc show dev ${network_host_iface}
+
+    ;;
+  "stats")
+    # counters of the host side of the veth pair, so rx is what the container
+    # sent and tx is what it received
+    for stat in rx_bytes rx_packets rx_dropped tx_bytes tx_packets tx_dropped
+    do
+      echo "${stat}=$(cat /sys/class/net/${network_host_iface}/statistics/${stat})"
+    done
+
+    # what the container sent through the forward chain, i.e. off the host;
+    # the jump matches the interface, or the bridge port if on a bridge (see
+    # container_traffic)
+    iptables -w -L ${filter_forward_chain} -v -x -n |
+      awk -v chain=${filter_instance_chain} -v iface=${network_host_iface} '
+        $3 != chain { next }
+        {
+          bridged = 0
+          for (i = 1; i < NF; i++) {
+            if ($i == "--physdev-in" && $(i + 1) == iface) {
+              bridged = 1
+            }
+          }
+        }
+        $6 == iface || bridged { print "forwarded_packets=" $1; print "forwarded_bytes=" $2 }'
 
     ;;
   *)
@@ -16,9 +16,46 @@ network_host_ip=${network_host_ip:-10.0.0.1}
 network_host_iface="${iface_name_prefix}${iface_name}-0"
 network_container_ip=${network_container_ip:-10.0.0.2}
 network_container_iface="${iface_name_prefix}${iface_name}-1"
+network_prefix_length=${network_prefix_length:-30}
+container_iface_mtu=${container_iface_mtu:-1500}
+network_bridge="${GARDEN_NETWORK_BRIDGE:-}"
+network_routed=$([ -n "${GARDEN_NETWORK_PROXY_ARP_INTERFACE:-}" ] && echo true || echo false)
+network_static_neighbours="${GARDEN_NETWORK_STATIC_NEIGHBOURS:-false}"
 user_uid=${user_uid:-10000}
+drop_capabilities=${drop_capabilities:-}
+read_only_rootfs=${read_only_rootfs:-false}
+scratch_size=${scratch_size:-0}
+disable_snat=${disable_snat:-false}
+cpu_quota_us=${cpu_quota_us:-0}
+cpu_period_us=${cpu_period_us:-0}
+cpuset_cpus=${cpuset_cpus:-}
+pids_max=${pids_max:-0}
+blkio_read_bps=${blkio_read_bps:-0}
+blkio_write_bps=${blkio_write_bps:-0}
+blkio_read_iops=${blkio_read_iops:-0}
+blkio_write_iops=${blkio_write_iops:-0}
+disk_quota_type=${disk_quota_type:-}
+dns_hosts=${dns_hosts:-}
+dns_search=${dns_search:-}
+dns_options=${dns_options:-}
+nested=${nested:-false}
+tmpfs_mounts=${tmpfs_mounts:-}
+shm_size=${shm_size:-0}
+core_dumps=${core_dumps:-quota}
+oom_score_adj=${oom_score_adj:-0}
+max_conntrack_entries=${max_conntrack_entries:-0}
+snat_ip=${snat_ip:-}
 rootfs_path=$(readlink -f $rootfs_path)
 
+# Containers on a shared bridge with static neighbours have MACs derived
+# from their addresses, so that their peers can be resolved without ARP;
+# see network.NeighbourMAC
+network_container_mac=
+if [ "$network_static_neighbours" = "true" ]
+then
+  network_container_mac=$(printf '02:00:%02x:%02x:%02x:%02x' $(tr . ' ' <<< $network_container_ip))
+fi
+
 # Write configuration
 cat > etc/config <<-EOS
 id=$id
@@ -26,8 +63,34 @@ network_host_ip=$network_host_ip
 network_host_iface=$network_host_iface
 network_container_ip=$network_container_ip
 network_container_iface=$network_container_iface
+network_prefix_length=$network_prefix_length
+container_iface_mtu=$container_iface_mtu
+network_bridge=$network_bridge
+network_routed=$network_routed
+network_static_neighbours=$network_static_neighbours
+network_container_mac=$network_container_mac
 user_uid=$user_uid
+drop_capabilities=$drop_capabilities
+read_only_rootfs=$read_only_rootfs
+scratch_size=$scratch_size
+disable_snat=$disable_snat
+cpu_quota_us=$cpu_quota_us
+cpu_period_us=$cpu_period_us
+cpuset_cpus=$cpuset_cpus
+pids_max=$pids_max
+blkio_read_bps=$blkio_read_bps
+blkio_write_bps=$blkio_write_bps
+blkio_read_iops=$blkio_read_iops
+blkio_write_iops=$blkio_write_iops
 rootfs_path=$rootfs_path
+disk_quota_type=$disk_quota_type
+nested=$nested
+tmpfs_mounts=$tmpfs_mounts
+shm_size=$shm_size
+core_dumps=$core_dumps
+oom_score_adj=$oom_score_adj
+max_conntrack_entries=$max_conntrack_entries
+snat_ip=$snat_ip
 EOS
 
 # Strip /dev down to the bare minimum
@@ -66,18 +129,31 @@ cat > $rootfs_path/etc/hostname <<-EOS
 $id
 EOS
 
+# The container's own name and its static entries, served by the DNS
+# forwarder when it is enabled
+cat > etc/dns_hosts <<-EOS
+$network_container_ip $id
+EOS
+
+for entry in ${dns_hosts//,/ }
+do
+  echo "${entry#*=} ${entry%%=*}" >> etc/dns_hosts
+done
+
 cat > $rootfs_path/etc/hosts <<-EOS
 127.0.0.1 localhost
-$network_container_ip $id
 EOS
 
+cat etc/dns_hosts >> $rootfs_path/etc/hosts
+
 # By default, inherit the nameserver from the host container.
 #
 # Exception: When the host's nameserver is set to localhost (127.0.0.1), it is
 # assumed to be running its own DNS server and listening on all interfaces.
 # In this case, the container must use the network_host_ip address
-# as the nameserver.
-if [[ "$(cat /etc/resolv.conf)" == "nameserver 127.0.0.1" ]]
+# as the nameserver. The same goes when the DNS forwarder is enabled, which
+# listens there.
+if [ "${GARDEN_DNS_FORWARDER:-false}" == "true" ] || [[ "$(cat /etc/resolv.conf)" == "nameserver 127.0.0.1" ]]
 then
   cat > $rootfs_path/etc/resolv.conf <<-EOS
 nameserver $network_host_ip
@@ -90,6 +166,20 @@ else
   cp /etc/resolv.conf $rootfs_path/etc/
 fi
 
+# Search domains and resolver options given for the container replace any
+# inherited
+if [ -n "$dns_search" ]
+then
+  sed -i '/^\(search\|domain\)\b/d' $rootfs_path/etc/resolv.conf
+  echo "search ${dns_search//,/ }" >> $rootfs_path/etc/resolv.conf
+fi
+
+if [ -n "$dns_options" ]
+then
+  sed -i '/^options\b/d' $rootfs_path/etc/resolv.conf
+  echo "options ${dns_options//,/ }" >> $rootfs_path/etc/resolv.conf
+fi
+
 # Add vcap user if not already present
 if ! chroot $rootfs_path id vcap >/dev/null 2>&1; then
   mkdir -p $rootfs_path/home
@@ -101,3 +191,51 @@ if ! chroot $rootfs_path id vcap >/dev/null 2>&1; then
 
   useradd -R $rootfs_path -mU -u $user_uid -s $shell vcap
 fi
+
+# Account the container's writes to its own qgroup when its rootfs is a btrfs
+# subvolume (e.g. provided by the btrfs graph driver) and quotas are enabled.
+if command -v btrfs > /dev/null && btrfs subvolume show $rootfs_path > /dev/null 2>&1
+then
+  subvolume_id=$(btrfs inspect-internal rootid $rootfs_path)
+
+  # a stale qgroup may remain from a container that previously had this uid
+  btrfs qgroup destroy 1/$user_uid $rootfs_path > /dev/null 2>&1 || true
+
+  if btrfs qgroup create 1/$user_uid $rootfs_path > /dev/null 2>&1
+  then
+    btrfs qgroup assign 0/$subvolume_id 1/$user_uid $rootfs_path
+  fi
+fi
+
+# the directory that writes to the rootfs end up in
+function rootfs_upper_path() {
+  # the super options of the mount are the last field in mountinfo
+  local options=$(awk -v mp=$rootfs_path '$5 == mp { print $NF }' /proc/self/mountinfo | tail -1)
+
+  case ",$options," in
+    *,upperdir=*)
+      tr , '\n' <<< "$options" | sed -n 's/^upperdir=//p'
+      ;;
+    *,si=*)
+      local si=$(tr , '\n' <<< "$options" | sed -n 's/^si=//p')
+      sed -n 's/=rw$//p' /sys/fs/aufs/si_$si/br0
+      ;;
+    *)
+      # either the rootfs itself, or the directories bind-mounted into it by
+      # overlay.sh when there is no copy-on-write filesystem
+      if [ -d $(dirname $rootfs_path)/overlay ]
+      then
+        echo $(dirname $rootfs_path)/overlay
+      else
+        echo $rootfs_path
+      fi
+      ;;
+  esac
+}
+
+# Account everything written to the rootfs to the project named after the
+# container's uid. Scratch space is tmpfs, and so is bounded by its size.
+if [ "$disk_quota_type" = "project" ]
+then
+  chattr -R -p $user_uid +P $(rootfs_upper_path)
+fi
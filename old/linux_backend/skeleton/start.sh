@@ -15,6 +15,10 @@ then
   exit 1
 fi
 
-./net.sh setup
+./bin/wshd --run ./run --lib ./lib --root $rootfs_path --title "wshd: $id" \
+  --drop-capabilities "${drop_capabilities:-}"
 
-./bin/wshd --run ./run --lib ./lib --root $rootfs_path --title "wshd: $id"
+if [ "${GARDEN_DNS_FORWARDER:-false}" == "true" ]
+then
+  ./net.sh dns
+fi
@@ -47,9 +47,14 @@ ms_start=$(ms)
 ms_end=$(($ms_start + ($WAIT * 1000)))
 
 pid=$(cat ./run/wshd.pid)
-path=${GARDEN_CGROUP_PATH}/cpu/instance-$id
+path=${GARDEN_CGROUP_PATH}/cpu${GARDEN_CGROUP_PARENT:+/$GARDEN_CGROUP_PARENT}/instance-$id
 tasks=$path/tasks
 
+if [ $WAIT -gt 0 ]; then
+  # ask wshd to forward SIGTERM to each process group it spawned
+  kill -TERM $pid 2> /dev/null || true
+fi
+
 while true
 do
   if ! pgrep -c -P $pid; then
@@ -1,6 +1,7 @@
 package linux_backend
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/cloudfoundry-incubator/garden/api"
@@ -8,6 +9,24 @@ import (
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
 )
 
+// SnapshotVersion is the version of BackendSnapshot written by this backend;
+// it must be bumped whenever the format changes incompatibly, so that an older
+// backend refuses to restore (and so prune) containers it does not understand.
+const SnapshotVersion = 1
+
+// BackendSnapshot is the state of every container, saved as a single file so
+// that it is either saved or restored as a whole.
+type BackendSnapshot struct {
+	Version int
+
+	// each container's own snapshot, as written by Container.Snapshot
+	Containers []json.RawMessage
+
+	// the handles of the containers destroyed most recently, oldest first, so
+	// that destroys retried across a restart still succeed
+	DestroyedHandles []string `json:",omitempty"`
+}
+
 type ContainerSnapshot struct {
 	ID     string
 	Handle string
@@ -26,9 +45,15 @@ type ContainerSnapshot struct {
 	NetIns  []NetInSpec
 	NetOuts []NetOutSpec
 
+	// the addresses the NetOuts to hostnames were last resolved to, so that
+	// restoring them doesn't depend on DNS
+	ResolvedNetOuts []ResolvedNetOutSnapshot
+
 	Properties api.Properties
 
 	EnvVars []string
+
+	ProcessDefaults ProcessDefaults
 }
 
 type LimitsSnapshot struct {
@@ -48,3 +73,8 @@ type ProcessSnapshot struct {
 	ID  uint32
 	TTY bool
 }
+
+type ResolvedNetOutSnapshot struct {
+	Spec     NetOutSpec
+	Networks []string
+}
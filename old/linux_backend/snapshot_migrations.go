@@ -0,0 +1,68 @@
+package linux_backend
+
+import (
+	"fmt"
+	"strings"
+)
+
+// snapshotMigration upgrades a snapshot by a single version, returning every
+// problem that prevents it from doing so rather than only the first.
+type snapshotMigration func(BackendSnapshot) (BackendSnapshot, []string)
+
+// snapshotMigrations[v] upgrades a snapshot from version v to v+1; bumping
+// SnapshotVersion requires appending the migration from the previous one.
+//
+// Version 0 is the per-container snapshot files saved before BackendSnapshot,
+// loaded as they are by loadContainerSnapshots.
+var snapshotMigrations = []snapshotMigration{
+	0: migrateContainerSnapshots,
+}
+
+type SnapshotMigrationError struct {
+	From     int
+	To       int
+	Problems []string
+}
+
+func (e SnapshotMigrationError) Error() string {
+	return fmt.Sprintf(
+		"cannot migrate snapshot from version %d to %d: %s",
+		e.From,
+		e.To,
+		strings.Join(e.Problems, "; "),
+	)
+}
+
+// migrateSnapshot upgrades the snapshot to SnapshotVersion one version at a
+// time. A snapshot that cannot be upgraded as a whole is refused, so that the
+// containers it describes are neither restored nor pruned.
+func migrateSnapshot(snapshot BackendSnapshot) (BackendSnapshot, error) {
+	if snapshot.Version < 0 || snapshot.Version > SnapshotVersion {
+		return BackendSnapshot{}, UnsupportedSnapshotVersionError{snapshot.Version}
+	}
+
+	for snapshot.Version < SnapshotVersion {
+		migrated, problems := snapshotMigrations[snapshot.Version](snapshot)
+		if len(problems) > 0 {
+			return BackendSnapshot{}, SnapshotMigrationError{
+				From:     snapshot.Version,
+				To:       snapshot.Version + 1,
+				Problems: problems,
+			}
+		}
+
+		snapshot = migrated
+	}
+
+	return snapshot, nil
+}
+
+// migrateContainerSnapshots gathers the per-container snapshot files into a
+// version 1 snapshot; their contents are already the version 1 container
+// snapshots.
+func migrateContainerSnapshots(snapshot BackendSnapshot) (BackendSnapshot, []string) {
+	return BackendSnapshot{
+		Version:    1,
+		Containers: snapshot.Containers,
+	}, nil
+}
@@ -0,0 +1,132 @@
+package linux_backend
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/clock"
+)
+
+// SnapshotEvery has the backend save its snapshot while it runs, behind the
+// changes to its containers rather than in them, so that containers survive
+// the server crashing as well as stopping. Creates, destroys, port mappings,
+// allowed egress and limits all count as changes. They are coalesced:
+// however many are made within an interval, the snapshot is saved, and
+// synced to disk, at most once, and never while the change waits. Networks
+// and ports allocated since the last save are recovered from the allocation
+// journal.
+//
+// It must be called before Start; without it the snapshot is only saved
+// when the backend stops.
+func (b *LinuxBackend) SnapshotEvery(interval time.Duration, clock clock.Clock) {
+	b.snapshotInterval = interval
+	b.snapshotClock = clock
+	b.snapshotsDirty = make(chan struct{}, 1)
+}
+
+func (b *LinuxBackend) startSnapshotting() {
+	if b.snapshotInterval <= 0 || b.snapshotsPath == "" {
+		return
+	}
+
+	b.stopSnapshotter = make(chan struct{})
+	b.snapshotterStopped = make(chan struct{})
+
+	go b.snapshotLoop()
+}
+
+// stopSnapshotting waits for a save in progress, if any, so that it can't
+// overwrite the snapshot saved on stop
+func (b *LinuxBackend) stopSnapshotting() {
+	if b.stopSnapshotter == nil {
+		return
+	}
+
+	close(b.stopSnapshotter)
+	<-b.snapshotterStopped
+}
+
+func (b *LinuxBackend) snapshotLoop() {
+	defer close(b.snapshotterStopped)
+
+	for {
+		select {
+		case <-b.stopSnapshotter:
+			return
+
+		case <-b.snapshotClock.After(b.snapshotInterval):
+			select {
+			case <-b.snapshotsDirty:
+				b.flushSnapshot()
+			default:
+			}
+		}
+	}
+}
+
+// snapshotChanged marks the snapshot as needing saving; it is a no-op
+// unless snapshotting every interval. Containers call it through OnChange.
+func (b *LinuxBackend) snapshotChanged() {
+	select {
+	case b.snapshotsDirty <- struct{}{}:
+	default:
+	}
+}
+
+// flushSnapshot saves the snapshot of the running containers now, along
+// with any changes waiting for the next interval.
+func (b *LinuxBackend) flushSnapshot() {
+	if b.snapshotsPath == "" {
+		return
+	}
+
+	b.snapshotMutex.Lock()
+	defer b.snapshotMutex.Unlock()
+
+	// whatever changed until now is in this save
+	select {
+	case <-b.snapshotsDirty:
+	default:
+	}
+
+	err := b.saveSnapshot(b.currentSnapshot(false))
+	if err != nil {
+		b.logger.Error("failed-to-save-snapshot", err)
+	}
+}
+
+// currentSnapshot snapshots every container, first cleaning them up if the
+// backend is stopping
+func (b *LinuxBackend) currentSnapshot(cleanup bool) BackendSnapshot {
+	b.containersMutex.RLock()
+	defer b.containersMutex.RUnlock()
+
+	snapshot := BackendSnapshot{
+		Version: SnapshotVersion,
+
+		DestroyedHandles: append([]string{}, b.destroyed.order...),
+	}
+
+	for _, container := range b.containers {
+		if cleanup {
+			container.Cleanup()
+		}
+
+		containerSnapshot := new(bytes.Buffer)
+
+		err := container.Snapshot(containerSnapshot)
+		if err != nil {
+			b.logger.Error("failed-to-save-snapshot", &FailedToSnapshotError{err}, lager.Data{
+				"container": container.ID(),
+			})
+
+			continue
+		}
+
+		snapshot.Containers = append(snapshot.Containers, containerSnapshot.Bytes())
+	}
+
+	return snapshot
+}
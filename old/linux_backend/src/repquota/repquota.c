@@ -9,6 +9,10 @@
 #include <string.h>
 #include <sys/quota.h>
 
+#ifndef PRJQUOTA
+#define PRJQUOTA 2
+#endif
+
 /**
  * Attempts to look up the device name associated with supplied mount point.
  *
@@ -94,11 +98,12 @@ static void print_quotactl_error(const char* msg) {
  * On failure, will attempt to print a helpful error messge to stderr.
  *
  * @param filesystem  Filesystem to report quota information for
+ * @param type        USRQUOTA, or PRJQUOTA to treat the uid as a project id
  * @param uid         Uid to report quota information for
  *
  * @return            -1 on error, 0 otherwise
  */
-static int print_quota_usage(const char* filesystem, int uid) {
+static int print_quota_usage(const char* filesystem, int type, int uid) {
   assert(NULL != filesystem);
 
   char emsg[1024];
@@ -106,7 +111,7 @@ static int print_quota_usage(const char* filesystem, int uid) {
 
   memset(&quota_info, 0, sizeof(quota_info));
 
-  if (quotactl(QCMD(Q_GETQUOTA, USRQUOTA), filesystem, uid, (caddr_t) &quota_info) < 0) {
+  if (quotactl(QCMD(Q_GETQUOTA, type), filesystem, uid, (caddr_t) &quota_info) < 0) {
     sprintf(emsg, "Failed retrieving quota for uid=%d", uid);
     print_quotactl_error(emsg);
     return -1;
@@ -137,11 +142,19 @@ int main(int argc, char* argv[]) {
   char** uid_strs   = NULL;
   int* uids         = NULL;
   int num_uids      = 0;
+  int type          = USRQUOTA;
   int ii            = 0;
 
+  if (argc > 1 && !strcmp(argv[1], "-p")) {
+    type = PRJQUOTA;
+    argc--;
+    argv++;
+  }
+
   if (argc < 3) {
-    printf("Usage: report_quota [filesystem] [uid]+\n");
+    printf("Usage: report_quota [-p] [filesystem] [uid]+\n");
     printf("Reports quota information for the supplied uids on the given filesystem\n");
+    printf("With -p, the uids are project ids, and project quotas are reported\n");
     printf("Format is: <uid> <bytes used> <soft> <hard> <grace> <inodes used> <soft> <hard> <grace>\n");
     exit(1);
   }
@@ -164,7 +177,7 @@ int main(int argc, char* argv[]) {
   }
 
   for (ii = 0; ii < num_uids; ii++) {
-    if (print_quota_usage(device_name, uids[ii]) < 0) {
+    if (print_quota_usage(device_name, type, uids[ii]) < 0) {
       exit(1);
     }
   }
@@ -97,7 +97,16 @@ int msg_rlimit_import(msg__rlimit_t *r) {
         if (rv == 1) {
           rlim.rlim_max = rlim.rlim_cur;
         }
+
+        /* A soft limit above the hard limit would be rejected by setrlimit
+         * inside the container; refuse it up front instead. */
+        if (rlim.rlim_cur > rlim.rlim_max) {
+          fprintf(stderr, "%s: soft limit exceeds hard limit\n", rlimits[i].name);
+          errno = EINVAL;
+          return -1;
+        }
       } else {
+        fprintf(stderr, "%s: invalid value: %s\n", rlimits[i].name, value);
         errno = EINVAL;
         return -1;
       }
@@ -111,6 +120,18 @@ int msg_rlimit_import(msg__rlimit_t *r) {
   return 0;
 }
 
+static const char *msg_rlimit_name(int id) {
+  int i;
+
+  for (i = 0; i < (sizeof(rlimits)/sizeof(rlimits[0])); i++) {
+    if (rlimits[i].id == id) {
+      return rlimits[i].name;
+    }
+  }
+
+  return "RLIMIT_UNKNOWN";
+}
+
 int msg_rlimit_export(msg__rlimit_t *r) {
   int i;
   int rv;
@@ -118,7 +139,9 @@ int msg_rlimit_export(msg__rlimit_t *r) {
   for (i = 0; i < r->count; i++) {
     rv = setrlimit(r->rlim[i].id, &r->rlim[i].rlim);
     if (rv == -1) {
-      fprintf(stderr, "%d\n", r->rlim[i].id);
+      int err = errno;
+      fprintf(stderr, "setrlimit %s: %s\n", msg_rlimit_name(r->rlim[i].id), strerror(err));
+      errno = err;
       return rv;
     }
   }
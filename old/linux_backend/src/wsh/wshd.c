@@ -12,6 +12,7 @@
 #include <sys/ipc.h>
 #include <sys/mount.h>
 #include <sys/param.h>
+#include <sys/prctl.h>
 #include <sys/shm.h>
 #include <sys/signalfd.h>
 #include <sys/socket.h>
@@ -43,6 +44,9 @@ struct wshd_s {
   /* Process title */
   char title[32];
 
+  /* Comma-separated capability numbers to drop from the bounding set */
+  char drop_capabilities[256];
+
   /* File descriptor of listening socket */
   int fd;
 
@@ -77,6 +81,10 @@ int wshd__usage(wshd_t *w, int argc, char **argv) {
     "Process title"
     "\n");
 
+  fprintf(stderr, "  --drop-capabilities LIST "
+    "Comma-separated capability numbers to drop from the bounding set"
+    "\n");
+
   return 0;
 }
 
@@ -107,6 +115,11 @@ int wshd__getopt(wshd_t *w, int argc, char **argv) {
         if (rv >= sizeof(w->title)) {
           goto toolong;
         }
+      } else if (strcmp("--drop-capabilities", argv[i]) == 0) {
+        rv = snprintf(w->drop_capabilities, sizeof(w->drop_capabilities), "%s", argv[i+1]);
+        if (rv >= sizeof(w->drop_capabilities)) {
+          goto toolong;
+        }
       } else {
         goto invalid;
       }
@@ -272,6 +285,13 @@ int child_fork(msg_request_t *req, int in, int out, int err) {
     char **argv = default_argv;
     char **envp = default_envp;
     char **extra_env_vars = NULL;
+    sigset_t mask;
+
+    /* The daemon blocks the signals it handles through its signalfd; don't
+     * let the child inherit that mask, or it will never see them. */
+    sigemptyset(&mask);
+    rv = sigprocmask(SIG_SETMASK, &mask, NULL);
+    assert(rv != -1);
 
     rv = dup2(in, STDIN_FILENO);
     assert(rv != -1);
@@ -290,9 +310,15 @@ int child_fork(msg_request_t *req, int in, int out, int err) {
       user = "root";
     }
 
+    errno = 0;
     pw = getpwnam(user);
     if (pw == NULL) {
-      perror("getpwnam");
+      if (errno == 0) {
+        fprintf(stderr, "getpwnam: user not found: %s\n", user);
+      } else {
+        perror("getpwnam");
+      }
+
       goto error;
     }
 
@@ -547,6 +573,15 @@ void child_handle_sigchld(wshd_t *w) {
   }
 }
 
+void child_handle_sigterm(wshd_t *w, int signo) {
+  int i;
+
+  /* Every process is spawned as a session leader, so signal its whole group */
+  for (i = 0; i < w->pid_to_fd_len; i++) {
+    kill(-w->pid_to_fd[i].pid, signo);
+  }
+}
+
 int child_signalfd(void) {
   sigset_t mask;
   int rv;
@@ -554,6 +589,8 @@ int child_signalfd(void) {
 
   sigemptyset(&mask);
   sigaddset(&mask, SIGCHLD);
+  sigaddset(&mask, SIGTERM);
+  sigaddset(&mask, SIGINT);
 
   rv = sigprocmask(SIG_BLOCK, &mask, NULL);
   if (rv == -1) {
@@ -606,14 +643,37 @@ int child_loop(wshd_t *w) {
       rv = read(sfd, &fdsi, sizeof(fdsi));
       assert(rv == sizeof(fdsi));
 
-      /* Ignore siginfo and loop waitpid to catch all children */
-      child_handle_sigchld(w);
+      if (fdsi.ssi_signo == SIGCHLD) {
+        /* Loop waitpid to catch all children, including reparented orphans */
+        child_handle_sigchld(w);
+      } else {
+        /* Forward termination requests to the running processes */
+        child_handle_sigterm(w, fdsi.ssi_signo);
+      }
     }
   }
 
   return 1;
 }
 
+void child_drop_capabilities(wshd_t *w) {
+  char buf[sizeof(w->drop_capabilities)];
+  char *tok, *saveptr;
+  int rv;
+
+  strcpy(buf, w->drop_capabilities);
+
+  for (tok = strtok_r(buf, ",", &saveptr); tok != NULL; tok = strtok_r(NULL, ",", &saveptr)) {
+    rv = prctl(PR_CAPBSET_DROP, atoi(tok), 0, 0, 0);
+
+    /* Older kernels do not know about every capability */
+    if (rv == -1 && errno != EINVAL) {
+      perror("prctl");
+      abort();
+    }
+  }
+}
+
 /* No header defines this */
 extern int pivot_root(const char *new_root, const char *put_old);
 
@@ -770,6 +830,9 @@ int child_continue(int argc, char **argv) {
     exit(1);
   }
 
+  /* Inherited by every process spawned in the container from here on */
+  child_drop_capabilities(w);
+
   /* Detach this process from its original group */
   rv = setsid();
   assert(rv > 0 && rv == getpid());
@@ -98,3 +98,11 @@ func (p *UnixUIDPool) Release(uid uint32) {
 
 	p.pool = append(p.pool, uid)
 }
+
+// Available returns the number of uids that can still be acquired.
+func (p *UnixUIDPool) Available() int {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	return len(p.pool)
+}
@@ -95,4 +95,18 @@ var _ = Describe("Unix UID pool", func() {
 			})
 		})
 	})
+
+	Describe("Available", func() {
+		It("returns the count of uids that can still be acquired", func() {
+			pool := uid_pool.New(10000, 5)
+			Ω(pool.Available()).Should(Equal(5))
+
+			uid, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pool.Available()).Should(Equal(4))
+
+			pool.Release(uid)
+			Ω(pool.Available()).Should(Equal(5))
+		})
+	})
 })
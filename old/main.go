@@ -3,13 +3,18 @@ package old
 import (
 	"bytes"
 	"flag"
+	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/docker/docker/daemon/graphdriver"
 	_ "github.com/docker/docker/daemon/graphdriver/aufs"
@@ -20,14 +25,42 @@ import (
 
 	"github.com/cloudfoundry-incubator/cf-debug-server"
 	"github.com/cloudfoundry-incubator/cf-lager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/admin"
+	"github.com/cloudfoundry-incubator/garden-linux/old/audit"
+	"github.com/cloudfoundry-incubator/garden-linux/old/bundles"
+	"github.com/cloudfoundry-incubator/garden-linux/old/checkpoints"
+	"github.com/cloudfoundry-incubator/garden-linux/old/clock"
+	"github.com/cloudfoundry-incubator/garden-linux/old/clones"
+	"github.com/cloudfoundry-incubator/garden-linux/old/consistency"
+	"github.com/cloudfoundry-incubator/garden-linux/old/egress_rules"
+	"github.com/cloudfoundry-incubator/garden-linux/old/error_codes"
+	"github.com/cloudfoundry-incubator/garden-linux/old/gateways"
+	"github.com/cloudfoundry-incubator/garden-linux/old/handover"
+	"github.com/cloudfoundry-incubator/garden-linux/old/health"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/allocation_journal"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/graph_cleaner"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/iptables_queue"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/process_tracker"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/resolver"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/net_out_refresher"
+	"github.com/cloudfoundry-incubator/garden-linux/old/network_repairs"
+	"github.com/cloudfoundry-incubator/garden-linux/old/network_stats"
+	"github.com/cloudfoundry-incubator/garden-linux/old/operations"
+	"github.com/cloudfoundry-incubator/garden-linux/old/packet_captures"
+	"github.com/cloudfoundry-incubator/garden-linux/old/periodic"
+	"github.com/cloudfoundry-incubator/garden-linux/old/pool_monitor"
+	"github.com/cloudfoundry-incubator/garden-linux/old/port_mappings"
+	"github.com/cloudfoundry-incubator/garden-linux/old/read_only"
+	"github.com/cloudfoundry-incubator/garden-linux/old/reaper"
+	"github.com/cloudfoundry-incubator/garden-linux/old/resource_maps"
 	"github.com/cloudfoundry-incubator/garden-linux/old/sysconfig"
 	"github.com/cloudfoundry-incubator/garden-linux/old/system_info"
 	"github.com/cloudfoundry-incubator/garden/server"
@@ -47,12 +80,42 @@ var listenAddr = flag.String(
 	"address to listen on",
 )
 
+var readOnlyListenNetwork = flag.String(
+	"readOnlyListenNetwork",
+	"unix",
+	"how to listen on the read-only address (unix, tcp, etc.)",
+)
+
+var readOnlyListenAddr = flag.String(
+	"readOnlyListenAddr",
+	"",
+	"address to serve a read-only API on, which only pings, reports capacity, lists containers and reads their info and limits, for monitoring agents that mustn't change anything",
+)
+
 var snapshotsPath = flag.String(
 	"snapshots",
 	"",
 	"directory in which to store container state to persist through restarts",
 )
 
+var snapshotInterval = flag.Duration(
+	"snapshotInterval",
+	0,
+	"how often to save the snapshot while running, if containers were created, destroyed or changed since, so that they survive a crash; 0 to only save it on stop; requires -snapshots",
+)
+
+var allowUpgrades = flag.Bool(
+	"allowUpgrades",
+	false,
+	"on SIGUSR1, finish in-flight requests, snapshot containers and re-execute the server's binary, handing the new one the listening socket so that clients aren't refused while it starts; requires -snapshots",
+)
+
+var allocationJournal = flag.String(
+	"allocationJournal",
+	"",
+	"file in which to journal network and port allocations, so that ones made since the last periodic snapshot (see -snapshotInterval) survive a crash",
+)
+
 var binPath = flag.String(
 	"bin",
 	"",
@@ -71,6 +134,12 @@ var overlaysPath = flag.String(
 	"directory in which to store containers mount points",
 )
 
+var overlayBackend = flag.String(
+	"overlayBackend",
+	"auto",
+	"copy-on-write backend for rootfs overlays: aufs, overlay, overlayfs, bind, or auto to use the first supported",
+)
+
 var rootFSPath = flag.String(
 	"rootfs",
 	"",
@@ -83,16 +152,98 @@ var disableQuotas = flag.Bool(
 	"disable disk quotas",
 )
 
+var diskQuotaType = flag.String(
+	"diskQuotaType",
+	"user",
+	"type of disk quotas to limit containers with: user, or project to also account for files written by other users (requires project quotas enabled on the depot's filesystem); btrfs qgroups are used instead with the btrfs graph driver",
+)
+
 var containerGraceTime = flag.Duration(
 	"containerGraceTime",
 	0,
 	"time after which to destroy idle containers",
 )
 
+var containerReapBatchSize = flag.Int(
+	"containerReapBatchSize",
+	8,
+	"number of containers whose grace time has expired to destroy at once",
+)
+
+var containerReapJitter = flag.Duration(
+	"containerReapJitter",
+	5*time.Second,
+	"maximum random delay before destroying each container whose grace time has expired, to spread out a burst of them",
+)
+
+var processOutputLimit = flag.Uint64(
+	"processOutputLimit",
+	0,
+	"bytes of each process output stream to buffer while no client is reading (0 = pipe capacity only)",
+)
+
+var dropProcessOutput = flag.Bool(
+	"dropProcessOutput",
+	false,
+	"drop process output beyond processOutputLimit instead of blocking the process",
+)
+
 var networkPool = flag.String(
 	"networkPool",
 	"10.254.0.0/22",
-	"network pool CIDR for containers; each container will get a /30",
+	"IPv4 network pool CIDR for containers; each container will get a /30, or a single address if -networkBridge or -proxyARPInterface is set",
+)
+
+var infrastructureNetworks = flag.String(
+	"infrastructureNetworks",
+	"",
+	"comma-separated CIDRs the host relies on, e.g. for its control plane or storage, which the network pool must not overlap",
+)
+
+var networkBridge = flag.String(
+	"networkBridge",
+	"",
+	"existing bridge to attach every container to, with an address in -networkPool that containers route through; containers get single addresses from the pool instead of their own subnets",
+)
+
+var ipamDriver = flag.String(
+	"ipamDriver",
+	"",
+	"external IPAM to allocate containers' networks in -networkPool from, instead of garden: an http(s):// URL to POST /allocations and DELETE /allocations/<handle> on, or the path of an executable to run with allocate <handle> or release <handle>; either responds with the network as {\"IPNet\", \"HostIP\", \"ContainerIP\"}",
+)
+
+var networkRouteTable = flag.String(
+	"networkRouteTable",
+	"",
+	"routing table, by number or name, to also route each container's subnet (or address, with -networkBridge or -proxyARPInterface) through, so that host services and VPN daemons routing by it can reach containers; empty for just the main table",
+)
+
+var networkStaticNeighbours = flag.Bool(
+	"networkStaticNeighbours",
+	false,
+	"with -networkBridge, resolve containers' addresses to each other and the host with permanent neighbour entries rather than ARP, to avoid ARP storms as containers churn; -networkPool must be IPv4 and at most a /20",
+)
+
+// the largest pool, in addresses, that each container can hold a static
+// neighbour entry for every peer in
+const maxStaticNeighboursPoolSize = 4096
+
+var networkMaxContainers = flag.Int(
+	"networkMaxContainers",
+	0,
+	"with -networkBridge or -proxyARPInterface, the most containers that may share -networkPool's subnet at once, leaving its other addresses for gateways and reserved IPs; creating more fails up front with insufficient IPs (0 = one per address in the pool)",
+)
+
+var networkMTU = flag.Int(
+	"networkMTU",
+	container_pool.DefaultMTU,
+	"MTU of containers' interfaces, which may not exceed the uplink's; containers may override it with the garden.network.mtu property",
+)
+
+var networkSubnetMTUs = flag.String(
+	"networkSubnetMTUs",
+	"",
+	"comma-separated CIDR=MTU overrides of -networkMTU for containers whose addresses are in each network, e.g. 10.254.0.0/24=9000",
 )
 
 var portPoolStart = flag.Uint(
@@ -107,6 +258,18 @@ var portPoolSize = flag.Uint(
 	"size of port pool used for mapped container ports",
 )
 
+var networkPoolWarnThreshold = flag.Uint(
+	"networkPoolWarnThreshold",
+	0,
+	"percentage of the network pool free at or below which to log a warning (0 = never)",
+)
+
+var portPoolWarnThreshold = flag.Uint(
+	"portPoolWarnThreshold",
+	0,
+	"percentage of the port pool free at or below which to log a warning (0 = never)",
+)
+
 var uidPoolStart = flag.Uint(
 	"uidPoolStart",
 	10000,
@@ -131,33 +294,272 @@ var allowNetworks = flag.String(
 	"CIDR blocks representing IPs to whitelist",
 )
 
+var prefixErrorCodes = flag.Bool(
+	"prefixErrorCodes",
+	false,
+	"prefix the messages of API errors with a stable code, e.g. \"[pool_exhausted] network pool is exhausted\", for clients to branch on",
+)
+
+var allowHostAccess = flag.Bool(
+	"allowHostAccess",
+	false,
+	"let containers reach every port on the host's addresses and link-local metadata services (169.254.0.0/16)",
+)
+
+var hostAllowedPorts = flag.String(
+	"hostAllowedPorts",
+	"53",
+	"comma-separated ports on the host's addresses that containers may reach when host access is not allowed",
+)
+
+var egressRulesFile = flag.String(
+	"egressRulesFile",
+	"",
+	"JSON file of egress rules (network, ports, protocol, log) allowing traffic from every container; reloaded on SIGHUP",
+)
+
+var netOutRefreshInterval = flag.Duration(
+	"netOutRefreshInterval",
+	time.Minute,
+	"how often to re-resolve hostnames given to NetOut, updating the rules for their addresses (0 to never)",
+)
+
+var externalIPRefreshInterval = flag.Duration(
+	"externalIPRefreshInterval",
+	time.Minute,
+	"how often to check the host's external address, rewriting containers' SNAT and port mapping rules if it has changed (0 to never)",
+)
+
+var ruleSweepInterval = flag.Duration(
+	"ruleSweepInterval",
+	5*time.Minute,
+	"how often to remove the iptables rules of containers that are gone, such as those that failed to be destroyed (0 to never)",
+)
+
+var allowedRootFSs = flag.String(
+	"allowedRootFSs",
+	"",
+	"comma-separated prefixes that container rootfses must begin with, e.g. /var/vcap/rootfses,docker://some.registry:5000 (all are allowed if empty)",
+)
+
 var graphRoot = flag.String(
 	"graph",
 	"/var/lib/garden-docker-graph",
 	"docker image graph",
 )
 
+var graphCleanupMaxSize = flag.Uint64(
+	"graphCleanupMaxSize",
+	0,
+	"total size in bytes of docker image layers above which unused layers are deleted, least recently used first (0 for unlimited)",
+)
+
+var graphCleanupMinFree = flag.Uint64(
+	"graphCleanupMinFree",
+	0,
+	"free space in bytes on the graph's filesystem below which unused docker image layers are deleted, least recently used first (0 for no minimum)",
+)
+
+var graphDriverName = flag.String(
+	"graphDriver",
+	"",
+	"docker graph driver to use (e.g. aufs, btrfs, vfs); detected if empty. btrfs also enforces disk limits with qgroups, and requires building with the btrfs tag",
+)
+
 var dockerRegistry = flag.String(
 	"registry",
 	registry.IndexServerAddress(),
 	"docker registry API endpoint",
 )
 
+var insecureRegistries = flag.String(
+	"insecureDockerRegistryList",
+	"",
+	"comma-separated list of docker registry hosts to fetch from over plain HTTP",
+)
+
+var registryUsername = flag.String(
+	"registryUsername",
+	"",
+	"username to authenticate to docker registries with",
+)
+
+var registryPasswordFile = flag.String(
+	"registryPasswordFile",
+	"",
+	"file holding the password to authenticate to docker registries with, so that it isn't visible in the process list",
+)
+
+var healthAddr = flag.String(
+	"healthAddr",
+	"",
+	"address to serve GET /health (readiness, pool headroom, and how allocated and fragmented the network pool is), GET /network-stats (each container's traffic, rate limits and the traffic through them), GET /gateways (the containers and traffic on each bridge or veth) and GET /consistency (containers cross-checked against the depot, iptables rules, host interfaces and resource pools) on as JSON (e.g. 127.0.0.1:7778)",
+)
+
+var adminListenNetwork = flag.String(
+	"adminListenNetwork",
+	"unix",
+	"how to listen on the admin address (unix, tcp, etc.)",
+)
+
+var adminListenAddr = flag.String(
+	"adminListenAddr",
+	"",
+	"address to serve the admin API on, for operators only: DELETE /net-in to remove port mappings, POST /checkpoint to checkpoint or restore a container with CRIU (experimental), GET /bundle to export a container's configuration as an OCI-style bundle, POST /clone to create a container from another's current rootfs, POST /repair-network to rewire a container whose veth pair was deleted, GET or DELETE /operations to list or cancel creates and streams-in in flight, and, with -resourceMapKeyFile, GET, POST or DELETE /resource-map to export, reserve or release containers' uids, networks and ports for migrating them between cells, and, with -allowPacketCaptures, POST /packet-capture to capture the packets on a container's host-side veth; requests that change anything are refused while draining, and recorded in the audit log (e.g. /var/vcap/data/garden/admin.sock)",
+)
+
+var auditLog = flag.String(
+	"auditLog",
+	"",
+	"file to append a record of every create, destroy, net-in, net-out and privileged run to",
+)
+
+var preCreateHook = flag.String(
+	"preCreateHook",
+	"",
+	"executable to run before creating a container, with its handle, IP and depot path; failing aborts the create",
+)
+
+var postCreateHook = flag.String(
+	"postCreateHook",
+	"",
+	"executable to run once a container has been created and started, with its handle, IP and depot path",
+)
+
+var preDestroyHook = flag.String(
+	"preDestroyHook",
+	"",
+	"executable to run before destroying a container, with its handle, IP and depot path; failing aborts the destroy",
+)
+
+var postDestroyHook = flag.String(
+	"postDestroyHook",
+	"",
+	"executable to run after destroying a container, with its handle, IP and depot path",
+)
+
 var tag = flag.String(
 	"tag",
 	"",
 	"server-wide identifier used for 'global' configuration",
 )
 
+var networkInterfacePrefix = flag.String(
+	"networkInterfacePrefix",
+	"",
+	"prefix of the names of containers' network interfaces, distinct for each server on the host; defaults to 'w' followed by the tag",
+)
+
+var cgroupParent = flag.String(
+	"cgroupParent",
+	"",
+	"path under the root of each cgroup hierarchy to create container cgroups in (e.g. system.slice/garden)",
+)
+
+var proxyARPInterface = flag.String(
+	"proxyARPInterface",
+	"",
+	"uplink to answer ARP on for containers' addresses, each of which is routed to its container as a /32 via the uplink's address; for when bridges are not allowed",
+)
+
+var dnsForwarder = flag.Bool(
+	"dnsForwarder",
+	false,
+	"run dnsmasq on each container's host-side address, forwarding to the host's resolvers, and use it as the container's nameserver",
+)
+
+var dnsSearchDomains = flag.String(
+	"dnsSearchDomains",
+	"",
+	"comma-separated domains for containers' resolvers to search, unless overridden by the garden.dns.search property",
+)
+
+var dnsOptions = flag.String(
+	"dnsOptions",
+	"",
+	"comma-separated resolver options, such as ndots:5, for containers' resolv.conf, unless overridden by the garden.dns.options property",
+)
+
+var coreDumpsDirectory = flag.String(
+	"coreDumpsDirectory",
+	"",
+	"directory to collect core dumps into for containers with the garden.core-dumps=collect policy; setting it pipes every core dump on the host through garden to apply containers' policies",
+)
+
+var allowPrivilegedContainers = flag.Bool(
+	"allowPrivilegedContainers",
+	false,
+	"allow containers to be created with properties that weaken their isolation from the host, e.g. garden.nested to run garden-linux inside them, or garden.capabilities beyond the defaults",
+)
+
+var allowPacketCaptures = flag.Bool(
+	"allowPacketCaptures",
+	false,
+	"serve /packet-capture, which runs tcpdump on a container's host-side veth, streaming the pcap or saving it into -packetCaptureDirectory",
+)
+
+var packetCaptureDirectory = flag.String(
+	"packetCaptureDirectory",
+	"",
+	"directory packet captures may be saved into rather than streamed",
+)
+
+var packetCaptureMaxDuration = flag.Duration(
+	"packetCaptureMaxDuration",
+	time.Minute,
+	"longest a packet capture may run for",
+)
+
+var packetCaptureMaxBytes = flag.Int64(
+	"packetCaptureMaxBytes",
+	64*1024*1024,
+	"most pcap a packet capture may write",
+)
+
+var resourceMapKeyFile = flag.String(
+	"resourceMapKeyFile",
+	"",
+	"file holding the key, shared by the cells containers migrate between, that resource maps are signed with; /resource-map is only served when given",
+)
+
+var externalIPs = flag.String(
+	"externalIPs",
+	"",
+	"comma-separated addresses of the host's to SNAT containers' outbound traffic to, each container being given one in turn unless its garden.network.external-ip property chooses one; by default it is SNATed to the host's external address",
+)
+
+var containerMaxConntrackEntries = flag.Int(
+	"containerMaxConntrackEntries",
+	0,
+	"most connections each container may have tracked by conntrack at once, beyond which its new connections are refused, unless overridden by its garden.network.max-conntrack-entries property; 0 for no limit",
+)
+
+var containerOOMScoreAdj = flag.Int(
+	"containerOOMScoreAdj",
+	0,
+	"oom_score_adj of containers' processes, from -1000 to 1000, unless overridden by their garden.oom-score-adj property; a positive value has the OOM killer prefer them to garden and the host's agents",
+)
+
 func Main() {
 	flag.Parse()
 
+	var configErr error
+	if *configFile != "" {
+		configErr = loadConfigFile(*configFile)
+	}
+
 	cf_debug_server.Run()
 
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
 	logger := cf_lager.New("garden-linux")
 
+	if configErr != nil {
+		logger.Fatal("failed-to-load-config-file", configErr, lager.Data{
+			"path": *configFile,
+		})
+	}
+
 	if *binPath == "" {
 		missing("-bin")
 	}
@@ -177,45 +579,323 @@ func Main() {
 		logger.Fatal("malformed-network-pool", err)
 	}
 
-	networkPool := network_pool.New(ipNet)
+	// containers' filter and NAT rules are iptables', which are IPv4 only, so
+	// setting them up would fail; so would routing IPv6 containers, which
+	// needs the uplink to proxy NDP for them
+	if ipNet.IP.To4() == nil {
+		logger.Fatal("ipv6-network-pool-not-supported", nil, lager.Data{
+			"network-pool": ipNet.String(),
+		})
+	}
+
+	err = getHostNetworks(logger, *networkBridge == "" && *proxyARPInterface == "").Check(ipNet)
+	if err != nil {
+		logger.Fatal("network-pool-conflicts-with-host", err)
+	}
+
+	var realNetworkPool *network_pool.RealNetworkPool
+	switch {
+	case *networkBridge != "" && *proxyARPInterface != "":
+		logger.Fatal("network-bridge-and-proxy-arp-interface-are-exclusive", nil)
+
+	case *networkStaticNeighbours && *networkBridge == "":
+		logger.Fatal("static-neighbours-require-network-bridge", nil)
+
+	case *networkBridge != "":
+		if *dnsForwarder {
+			logger.Fatal("dns-forwarder-not-supported-with-network-bridge", nil)
+		}
+
+		realNetworkPool = network_pool.NewBridged(ipNet, getInterfaceIP(logger, *networkBridge, ipNet.Contains))
+
+		if *networkStaticNeighbours {
+			ones, bits := ipNet.Mask.Size()
+			if bits != 8*net.IPv4len || 1<<uint(bits-ones) > maxStaticNeighboursPoolSize {
+				logger.Fatal("static-neighbours-network-pool-unsupported", nil, lager.Data{
+					"network-pool": ipNet.String(),
+					"max-size":     maxStaticNeighboursPoolSize,
+				})
+			}
+		}
+
+	case *proxyARPInterface != "":
+		if *dnsForwarder {
+			logger.Fatal("dns-forwarder-not-supported-with-proxy-arp-interface", nil)
+		}
+
+		realNetworkPool = network_pool.NewRouted(ipNet, getInterfaceIP(logger, *proxyARPInterface, func(ip net.IP) bool {
+			return ip.To4() != nil
+		}))
+
+	default:
+		realNetworkPool = network_pool.New(ipNet)
+	}
+
+	if *networkMaxContainers != 0 {
+		if *networkBridge == "" && *proxyARPInterface == "" {
+			logger.Fatal("network-max-containers-requires-shared-subnet", nil)
+		}
+
+		if *networkMaxContainers < 0 || *networkMaxContainers > realNetworkPool.InitialSize() {
+			logger.Fatal("invalid-network-max-containers", nil, lager.Data{
+				"max-containers": *networkMaxContainers,
+				"addresses":      realNetworkPool.InitialSize(),
+			})
+		}
+
+		realNetworkPool.LimitContainers(*networkMaxContainers)
+	}
+
+	var networkPool interface {
+		network_pool.NetworkPool
+		Available() int
+	} = realNetworkPool
+
+	if *ipamDriver != "" {
+		var driver network_pool.IPAMDriver
+		if strings.HasPrefix(*ipamDriver, "http://") || strings.HasPrefix(*ipamDriver, "https://") {
+			driver = network_pool.NewHTTPIPAMDriver(*ipamDriver, ipNet, &http.Client{Timeout: 30 * time.Second})
+		} else {
+			driver = network_pool.NewExecIPAMDriver(*ipamDriver, ipNet, linux_command_runner.New())
+		}
+
+		// the built-in pool still says how many containers the network fits
+		networkPool = network_pool.NewExternal(logger, ipNet, realNetworkPool.InitialSize(), driver)
+	}
 
 	// TODO: use /proc/sys/net/ipv4/ip_local_port_range by default (end + 1)
 	portPool := port_pool.New(uint32(*portPoolStart), uint32(*portPoolSize))
 
 	config := sysconfig.NewConfig(*tag)
 
-	runner := sysconfig.NewRunner(config, linux_command_runner.New())
+	if *networkInterfacePrefix != "" {
+		config.NetworkInterfacePrefix = *networkInterfacePrefix
+	}
+
+	err = container_pool.ValidateInterfacePrefix(config.NetworkInterfacePrefix, realNetworkPool.InitialSize())
+	if err != nil {
+		logger.Fatal("invalid-network-interface-prefix", err)
+	}
+
+	config.CgroupParent = strings.TrimPrefix(filepath.Clean("/"+*cgroupParent), "/")
+	config.DNSForwarder = *dnsForwarder
+	config.AllowHostAccess = *allowHostAccess
+	config.AllowPrivilegedContainers = *allowPrivilegedContainers
+	config.CoreDumpsDirectory = *coreDumpsDirectory
+
+	if *containerOOMScoreAdj < container_pool.MinOOMScoreAdj || *containerOOMScoreAdj > container_pool.MaxOOMScoreAdj {
+		logger.Fatal("invalid-container-oom-score-adj", nil, lager.Data{
+			"oom-score-adj": *containerOOMScoreAdj,
+		})
+	}
+
+	config.ContainerOOMScoreAdj = *containerOOMScoreAdj
 
-	quotaManager := quota_manager.New(runner, getMountPoint(logger, *depotPath), *binPath)
+	if *containerMaxConntrackEntries < 0 {
+		logger.Fatal("invalid-container-max-conntrack-entries", nil, lager.Data{
+			"max-conntrack-entries": *containerMaxConntrackEntries,
+		})
+	}
+
+	config.ContainerMaxConntrackEntries = *containerMaxConntrackEntries
+
+	for _, ip := range splitList(*externalIPs) {
+		parsed := net.ParseIP(ip)
+		if parsed == nil || parsed.To4() == nil {
+			logger.Fatal("invalid-external-ip", nil, lager.Data{
+				"external-ip": ip,
+			})
+		}
+
+		config.ExternalIPs = append(config.ExternalIPs, parsed.String())
+	}
+
+	config.DNSSearchDomains = splitList(*dnsSearchDomains)
+	if !container_pool.ValidDNSSearchDomains(config.DNSSearchDomains) {
+		logger.Fatal("invalid-dns-search-domains", nil, lager.Data{
+			"dns-search-domains": *dnsSearchDomains,
+		})
+	}
 
-	if *disableQuotas {
-		quotaManager.Disable()
+	config.DNSOptions = splitList(*dnsOptions)
+	if !container_pool.ValidDNSOptions(config.DNSOptions) {
+		logger.Fatal("invalid-dns-options", nil, lager.Data{
+			"dns-options": *dnsOptions,
+		})
 	}
 
+	config.NetworkBridge = *networkBridge
+	config.NetworkStaticNeighbours = *networkStaticNeighbours
+	config.NetworkRouteTable = *networkRouteTable
+	config.NetworkMTU = *networkMTU
+	config.NetworkUplinkMTU = getUplinkMTU(logger, *networkBridge, *proxyARPInterface)
+
+	if *networkSubnetMTUs != "" {
+		for _, override := range strings.Split(*networkSubnetMTUs, ",") {
+			segs := strings.SplitN(override, "=", 2)
+			if len(segs) != 2 {
+				logger.Fatal("malformed-network-subnet-mtu", nil, lager.Data{"override": override})
+			}
+
+			_, subnet, err := net.ParseCIDR(segs[0])
+			if err != nil {
+				logger.Fatal("malformed-network-subnet-mtu", err, lager.Data{"override": override})
+			}
+
+			mtu, err := strconv.Atoi(segs[1])
+			if err != nil {
+				logger.Fatal("malformed-network-subnet-mtu", err, lager.Data{"override": override})
+			}
+
+			config.NetworkSubnetMTUs = append(config.NetworkSubnetMTUs, sysconfig.SubnetMTU{
+				Network: subnet,
+				MTU:     mtu,
+			})
+		}
+	}
+
+	for _, mtu := range append([]sysconfig.SubnetMTU{{MTU: config.NetworkMTU}}, config.NetworkSubnetMTUs...) {
+		if mtu.MTU < container_pool.MinMTU || (config.NetworkUplinkMTU != 0 && mtu.MTU > config.NetworkUplinkMTU) {
+			logger.Fatal("invalid-network-mtu", nil, lager.Data{
+				"mtu":        mtu.MTU,
+				"uplink-mtu": config.NetworkUplinkMTU,
+			})
+		}
+	}
+	config.NetworkProxyARPInterface = *proxyARPInterface
+
+	if *hostAllowedPorts != "" {
+		for _, port := range strings.Split(*hostAllowedPorts, ",") {
+			parsed, err := strconv.ParseUint(port, 10, 16)
+			if err != nil {
+				logger.Fatal("malformed-host-allowed-port", err)
+			}
+
+			config.HostAllowedPorts = append(config.HostAllowedPorts, uint32(parsed))
+		}
+	}
+
+	runner := iptables_queue.New(sysconfig.NewRunner(config, linux_command_runner.New()))
+
 	if err := os.MkdirAll(*graphRoot, 0755); err != nil {
 		logger.Fatal("failed-to-create-graph-directory", err)
 	}
 
+	graphdriver.DefaultDriver = *graphDriverName
+
 	graphDriver, err := graphdriver.New(*graphRoot, nil)
 	if err != nil {
 		logger.Fatal("failed-to-construct-graph-driver", err)
 	}
 
+	var quotaManager quota_manager.QuotaManager
+	if graphDriver.String() == "btrfs" {
+		btrfsQuotaManager := quota_manager.NewBtrfs(runner, *graphRoot)
+
+		if *disableQuotas {
+			btrfsQuotaManager.Disable()
+		}
+
+		err := btrfsQuotaManager.Setup(logger.Session("btrfs-quota-manager"))
+		if err != nil {
+			logger.Fatal("failed-to-enable-btrfs-quotas", err)
+		}
+
+		quotaManager = btrfsQuotaManager
+	} else {
+		var linuxQuotaManager *quota_manager.LinuxQuotaManager
+
+		switch quota_manager.QuotaType(*diskQuotaType) {
+		case quota_manager.UserQuotas:
+			linuxQuotaManager = quota_manager.New(runner, getMountPoint(logger, *depotPath), *binPath)
+		case quota_manager.ProjectQuotas:
+			linuxQuotaManager = quota_manager.NewProject(runner, getMountPoint(logger, *depotPath), *binPath)
+		default:
+			logger.Fatal("unknown-disk-quota-type", nil, lager.Data{
+				"type": *diskQuotaType,
+			})
+		}
+
+		if *disableQuotas {
+			linuxQuotaManager.Disable()
+		}
+
+		quotaManager = linuxQuotaManager
+	}
+
 	graph, err := graph.NewGraph(*graphRoot, graphDriver)
 	if err != nil {
 		logger.Fatal("failed-to-construct-graph", err)
 	}
 
-	reg, err := registry.NewSession(nil, nil, *dockerRegistry, true)
+	graphCleaner, err := graph_cleaner.New(
+		graph,
+		*graphRoot,
+		filepath.Join(*graphRoot, "garden-layer-usage.json"),
+		graph_cleaner.Thresholds{
+			MaxSize: *graphCleanupMaxSize,
+			MinFree: *graphCleanupMinFree,
+		},
+		clock.New(),
+	)
+	if err != nil {
+		logger.Fatal("failed-to-construct-graph-cleaner", err)
+	}
+
+	registryAuth := &registry.AuthConfig{
+		Username: *registryUsername,
+	}
+
+	if *registryPasswordFile != "" {
+		registryPassword, err := ioutil.ReadFile(*registryPasswordFile)
+		if err != nil {
+			logger.Fatal("failed-to-read-registry-password", err)
+		}
+
+		registryAuth.Password = strings.TrimRight(string(registryPassword), "\r\n")
+	}
+
+	registryProvider := repository_fetcher.NewRegistryProvider(
+		*dockerRegistry,
+		splitList(*insecureRegistries),
+		registryAuth,
+	)
+
+	repoFetcher := repository_fetcher.Retryable{repository_fetcher.New(registryProvider, graph)}
+
+	detectedOverlayBackend, err := rootfs_provider.DetectOverlayBackend(logger, *binPath, *overlaysPath, *overlayBackend, runner)
 	if err != nil {
-		logger.Fatal("failed-to-construct-registry", err)
+		logger.Fatal("failed-to-detect-overlay-backend", err)
 	}
 
-	repoFetcher := repository_fetcher.Retryable{repository_fetcher.New(reg, graph)}
+	logger.Info("overlay-backend", lager.Data{
+		"requested": *overlayBackend,
+		"using":     detectedOverlayBackend,
+	})
 
 	rootFSProviders := map[string]rootfs_provider.RootFSProvider{
-		"":       rootfs_provider.NewOverlay(*binPath, *overlaysPath, *rootFSPath, runner),
-		"docker": rootfs_provider.NewDocker(repoFetcher, graphDriver),
+		"":       rootfs_provider.NewOverlay(*binPath, *overlaysPath, *rootFSPath, detectedOverlayBackend, runner),
+		"docker": rootfs_provider.NewDocker(repoFetcher, graphDriver, graphCleaner),
+	}
+
+	// only /clone is given it, so that garden clients can't copy another
+	// container's rootfs by naming it in a spec
+	cloneProvider := rootfs_provider.NewOverlayClone(*binPath, *overlaysPath, detectedOverlayBackend, runner)
+
+	var journal allocation_journal.Journal = allocation_journal.Disabled{}
+	if *allocationJournal != "" {
+		journal, err = allocation_journal.Open(*allocationJournal)
+		if err != nil {
+			logger.Fatal("failed-to-open-allocation-journal", err)
+		}
+	}
+
+	var defaultContainerEnv []string
+	if *defaultContainerEnvFile != "" {
+		defaultContainerEnv, err = loadEnvFile(*defaultContainerEnvFile)
+		if err != nil {
+			logger.Fatal("failed-to-load-default-container-env", err)
+		}
 	}
 
 	pool := container_pool.New(
@@ -227,30 +907,258 @@ func Main() {
 		uidPool,
 		networkPool,
 		portPool,
+		journal,
 		strings.Split(*denyNetworks, ","),
 		strings.Split(*allowNetworks, ","),
+		splitList(*allowedRootFSs),
+		defaultContainerEnv,
 		runner,
+		resolver.New(),
 		quotaManager,
+		process_tracker.OutputLimit{
+			Bytes: *processOutputLimit,
+			Drop:  *dropProcessOutput,
+		},
+		container_pool.Hooks{
+			PreCreate:   *preCreateHook,
+			PostCreate:  *postCreateHook,
+			PreDestroy:  *preDestroyHook,
+			PostDestroy: *postDestroyHook,
+		},
 	)
 
+	pool.RegisterExplicitRootFSProvider("clone", cloneProvider)
+
 	systemInfo := system_info.NewProvider(*depotPath)
 
 	backend := linux_backend.New(logger, pool, systemInfo, *snapshotsPath)
 
+	if *snapshotInterval > 0 && *snapshotsPath == "" {
+		logger.Fatal("snapshot-interval-requires-snapshots", nil)
+	}
+
+	backend.SnapshotEvery(*snapshotInterval, clock.New())
+
 	err = backend.Setup()
 	if err != nil {
 		logger.Fatal("failed-to-set-up-backend", err)
 	}
 
+	var egressRules *egress_rules.Loader
+	if *egressRulesFile != "" {
+		egressRules = egress_rules.New(logger, *egressRulesFile, config.IPTables.Filter.EgressChain, runner)
+
+		err := egressRules.Reload()
+		if err != nil {
+			logger.Fatal("failed-to-load-egress-rules", err)
+		}
+	}
+
 	graceTime := *containerGraceTime
 
-	gardenServer := server.New(*listenNetwork, *listenAddr, graceTime, backend, logger)
+	gardenBackend := error_codes.NewBackend(backend, *prefixErrorCodes)
+
+	var auditLogger lager.Logger
+	if *auditLog != "" {
+		auditLogger, err = audit.NewLogger(*auditLog)
+		if err != nil {
+			logger.Fatal("failed-to-open-audit-log", err, lager.Data{
+				"path": *auditLog,
+			})
+		}
+
+		gardenBackend = audit.NewBackend(gardenBackend, auditLogger)
+	}
+
+	serverNetwork, serverAddr := *listenNetwork, *listenAddr
+
+	// with upgrades allowed the server serves on a socket of its own, behind
+	// a proxy on a listener that can be handed to the upgraded server
+	var apiListener net.Listener
+	if *allowUpgrades {
+		if *snapshotsPath == "" {
+			logger.Fatal("upgrades-require-snapshots", nil)
+		}
+
+		apiListener, err = handover.Listen(*listenNetwork, *listenAddr)
+		if err != nil {
+			logger.Fatal("failed-to-listen", err)
+		}
+
+		serverNetwork = "unix"
+		serverAddr = filepath.Join(os.TempDir(), "garden-linux-"+strconv.Itoa(os.Getpid())+".sock")
+	}
+
+	if *containerReapBatchSize < 1 {
+		logger.Fatal("invalid-reap-batch-size", nil, lager.Data{
+			"batch-size": *containerReapBatchSize,
+		})
+	}
+
+	// reaping is left to the backend, so that a burst of expired containers
+	// is destroyed in batches; the read-only server below neither reaps nor
+	// keeps containers from being reaped
+	reapingBackend := reaper.NewBackend(
+		logger,
+		gardenBackend,
+		clock.New(),
+		time.Second,
+		*containerReapBatchSize,
+		*containerReapJitter,
+	)
+
+	gardenServer := server.New(serverNetwork, serverAddr, graceTime, reapingBackend, logger)
+
+	healthHandler := health.New(
+		logger,
+		*graphRoot,
+		config.IPTables.Filter.DefaultChain,
+		runner,
+		networkPool,
+		uidPool,
+		portPool,
+	)
+
+	var resourceMapKey []byte
+	if *resourceMapKeyFile != "" {
+		resourceMapKey, err = ioutil.ReadFile(*resourceMapKeyFile)
+		if err != nil {
+			logger.Fatal("failed-to-read-resource-map-key", err)
+		}
+
+		// so that a trailing newline doesn't make the key differ between cells
+		resourceMapKey = bytes.TrimSpace(resourceMapKey)
+	}
+
+	if *healthAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/health", healthHandler)
+			mux.Handle("/network-stats", network_stats.New(logger, backend))
+			mux.Handle("/gateways", gateways.New(logger, backend, networkPool))
+			mux.Handle("/consistency", consistency.New(logger, consistency.NewChecker(
+				logger,
+				backend,
+				pool,
+				consistency.Pools{
+					Network: networkPool,
+					Port:    portPool,
+					UID:     uidPool,
+				},
+				consistency.HostInterfaces,
+				config.NetworkInterfacePrefix,
+			)))
+
+			err := http.ListenAndServe(*healthAddr, mux)
+			if err != nil {
+				logger.Fatal("failed-to-serve-health", err)
+			}
+		}()
+	}
+
+	if *adminListenAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/net-in", port_mappings.New(logger, gardenBackend))
+		mux.Handle("/checkpoint", checkpoints.New(logger, gardenBackend))
+		mux.Handle("/bundle", bundles.New(logger, gardenBackend))
+		mux.Handle("/clone", clones.New(logger, gardenBackend, backend, cloneProvider))
+		mux.Handle("/repair-network", network_repairs.New(logger, gardenBackend))
+		mux.Handle("/operations", operations.New(logger, backend))
+		if resourceMapKey != nil {
+			mux.Handle("/resource-map", resource_maps.New(logger, gardenBackend, pool, resourceMapKey))
+		}
+
+		if *allowPacketCaptures {
+			mux.Handle("/packet-capture", packet_captures.New(logger, gardenBackend, linux_command_runner.New(), *packetCaptureDirectory, packet_captures.Limits{
+				MaxDuration: *packetCaptureMaxDuration,
+				MaxBytes:    *packetCaptureMaxBytes,
+			}))
+		}
+
+		adminHandler := admin.New(mux, backend)
+		if auditLogger != nil {
+			adminHandler = audit.NewHandler(adminHandler, auditLogger)
+		}
+
+		if *adminListenNetwork == "unix" {
+			os.Remove(*adminListenAddr)
+		}
+
+		adminListener, err := net.Listen(*adminListenNetwork, *adminListenAddr)
+		if err != nil {
+			logger.Fatal("failed-to-listen-for-admin", err)
+		}
+
+		// unlike the garden API's, the admin socket is only for root
+		if *adminListenNetwork == "unix" {
+			os.Chmod(*adminListenAddr, 0700)
+		}
+
+		go func() {
+			err := http.Serve(adminListener, adminHandler)
+			if err != nil {
+				logger.Fatal("failed-to-serve-admin", err)
+			}
+		}()
+	}
 
 	err = gardenServer.Start()
 	if err != nil {
 		logger.Fatal("failed-to-start-server", err)
 	}
 
+	// the backend is started by the server above, and only read through
+	// this one
+	if *readOnlyListenAddr != "" {
+		readOnlyServer := server.New(
+			*readOnlyListenNetwork,
+			*readOnlyListenAddr,
+			graceTime,
+			read_only.NewBackend(gardenBackend),
+			logger.Session("read-only"),
+		)
+
+		err = readOnlyServer.Start()
+		if err != nil {
+			logger.Fatal("failed-to-start-read-only-server", err)
+		}
+	}
+
+	var proxy *handover.Proxy
+	if apiListener != nil {
+		proxy = handover.NewProxy(logger, apiListener, serverNetwork, serverAddr)
+		go proxy.Serve()
+	}
+
+	healthHandler.Started()
+
+	go pool_monitor.New(logger, backend, []pool_monitor.MonitoredPool{
+		{
+			Name:      "network",
+			Metric:    "NetworkPoolFreePercent",
+			Pool:      networkPool,
+			Threshold: int(*networkPoolWarnThreshold),
+		},
+		{
+			Name:      "port",
+			Metric:    "PortPoolFreePercent",
+			Pool:      portPool,
+			Threshold: int(*portPoolWarnThreshold),
+		},
+	}, clock.New()).Run(30 * time.Second)
+
+	if *netOutRefreshInterval > 0 {
+		go net_out_refresher.New(logger, backend, clock.New()).Run(*netOutRefreshInterval)
+	}
+
+	if *externalIPRefreshInterval > 0 {
+		go periodic.New(logger, "external-ip-refresher", clock.New(), pool.RefreshExternalIP).Run(*externalIPRefreshInterval)
+	}
+
+	if *ruleSweepInterval > 0 {
+		go periodic.New(logger, "rule-sweeper", clock.New(), pool.SweepRules).Run(*ruleSweepInterval)
+	}
+
 	logger.Info("started", lager.Data{
 		"network": *listenNetwork,
 		"addr":    *listenAddr,
@@ -259,12 +1167,53 @@ func Main() {
 	signals := make(chan os.Signal, 1)
 
 	go func() {
-		<-signals
+		switch <-signals {
+		// SIGUSR1 upgrades: connections wait on the listener while in-flight
+		// requests finish and containers are snapshotted, after which the
+		// server's binary is executed again and restores them. Streams from
+		// run and attach are cut, as with any other stop.
+		case syscall.SIGUSR1:
+			proxy.Pause()
+			gardenServer.Stop()
+
+			logger.Info("upgrading")
+
+			err := handover.Exec(apiListener)
+			logger.Fatal("failed-to-upgrade", err)
+
+		// SIGUSR2 drains: no more containers are created while in-flight
+		// requests finish, after which containers are snapshotted and left
+		// running, as with any other stop
+		case syscall.SIGUSR2:
+			backend.Drain()
+		}
+
 		gardenServer.Stop()
 		os.Exit(0)
 	}()
 
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	stopSignals := []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR2}
+	if *allowUpgrades {
+		stopSignals = append(stopSignals, syscall.SIGUSR1)
+	}
+
+	// SIGHUP reloads the egress rules if there are any; otherwise it stops
+	// the server like any other signal
+	if egressRules != nil {
+		reloads := make(chan os.Signal, 1)
+
+		go func() {
+			for _ = range reloads {
+				egressRules.Reload()
+			}
+		}()
+
+		signal.Notify(reloads, syscall.SIGHUP)
+	} else {
+		stopSignals = append(stopSignals, syscall.SIGHUP)
+	}
+
+	signal.Notify(signals, stopSignals...)
 
 	select {}
 }
@@ -286,8 +1235,178 @@ func getMountPoint(logger lager.Logger, depotPath string) string {
 	return strings.Trim(dfOutputWords[len(dfOutputWords)-1], "\n")
 }
 
+// getInterfaceIP returns the first of the interface's addresses that matches
+func getInterfaceIP(logger lager.Logger, name string, matches func(net.IP) bool) net.IP {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		logger.Fatal("failed-to-find-interface", err, lager.Data{
+			"interface": name,
+		})
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		logger.Fatal("failed-to-get-interface-addresses", err, lager.Data{
+			"interface": name,
+		})
+	}
+
+	for _, addr := range addrs {
+		ip, _, err := net.ParseCIDR(addr.String())
+		if err == nil && matches(ip) {
+			return ip
+		}
+	}
+
+	logger.Fatal("no-suitable-interface-address", nil, lager.Data{
+		"interface": name,
+	})
+
+	return nil
+}
+
+// getUplinkMTU returns the MTU of the interface containers' traffic leaves
+// the host through: the bridge or proxy ARP interface if there is one, or
+// else the interface with the host's external address. It returns 0 if that
+// cannot be found.
+func getUplinkMTU(logger lager.Logger, bridge, proxyARPInterface string) int {
+	for _, name := range []string{bridge, proxyARPInterface} {
+		if name == "" {
+			continue
+		}
+
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			logger.Fatal("failed-to-find-interface", err, lager.Data{
+				"interface": name,
+			})
+		}
+
+		return iface.MTU
+	}
+
+	externalIP, err := getExternalIP()
+	if err != nil {
+		logger.Info("unknown-uplink-mtu", lager.Data{"error": err.Error()})
+		return 0
+	}
+
+	iface, _, err := getExternalInterface(externalIP)
+	if err != nil {
+		logger.Info("unknown-uplink-mtu", lager.Data{"error": err.Error()})
+		return 0
+	}
+
+	if iface == nil {
+		logger.Info("unknown-uplink-mtu", lager.Data{"external-ip": externalIP.String()})
+		return 0
+	}
+
+	return iface.MTU
+}
+
+// getHostNetworks returns what the network pool must stay clear of. The
+// external IP and the subnets on its interface are only included if
+// hostRoutes is set, as a bridged or proxy ARP pool shares the uplink's
+// subnet by design.
+func getHostNetworks(logger lager.Logger, hostRoutes bool) network_pool.HostNetworks {
+	var hostNetworks network_pool.HostNetworks
+
+	for _, cidr := range splitList(*infrastructureNetworks) {
+		_, infrastructure, err := net.ParseCIDR(cidr)
+		if err != nil {
+			logger.Fatal("malformed-infrastructure-network", err, lager.Data{"network": cidr})
+		}
+
+		hostNetworks.Infrastructure = append(hostNetworks.Infrastructure, infrastructure)
+	}
+
+	if !hostRoutes {
+		return hostNetworks
+	}
+
+	externalIP, err := getExternalIP()
+	if err != nil {
+		logger.Info("unknown-external-ip", lager.Data{"error": err.Error()})
+		return hostNetworks
+	}
+
+	hostNetworks.ExternalIP = externalIP
+
+	_, subnets, err := getExternalInterface(externalIP)
+	if err != nil {
+		logger.Info("unknown-host-routes", lager.Data{"error": err.Error()})
+		return hostNetworks
+	}
+
+	hostNetworks.HostRoutes = subnets
+
+	return hostNetworks
+}
+
+// getExternalIP returns the address the host's traffic leaves it from
+func getExternalIP() (net.IP, error) {
+	// no packets are sent; this just picks the route
+	conn, err := net.Dial("udp", "8.8.8.8:53")
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// getExternalInterface returns the interface with the external IP, if any,
+// and the subnets of its IPv4 addresses
+func getExternalInterface(externalIP net.IP) (*net.Interface, []*net.IPNet, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		var subnets []*net.IPNet
+		external := false
+
+		for _, addr := range addrs {
+			ip, subnet, err := net.ParseCIDR(addr.String())
+			if err != nil {
+				continue
+			}
+
+			if ip.Equal(externalIP) {
+				external = true
+			}
+
+			if ip.To4() != nil {
+				subnets = append(subnets, subnet)
+			}
+		}
+
+		if external {
+			return &ifaces[i], subnets, nil
+		}
+	}
+
+	return nil, nil, nil
+}
+
 func missing(flagName string) {
 	println("missing " + flagName)
 	println()
 	flag.Usage()
 }
+
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+
+	return strings.Split(list, ",")
+}
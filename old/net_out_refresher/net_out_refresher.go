@@ -0,0 +1,61 @@
+package net_out_refresher
+
+import (
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/clock"
+)
+
+type Container interface {
+	RefreshNetOuts() error
+}
+
+// Refresher periodically re-resolves the hostnames containers were allowed
+// to reach with NetOut, so that their rules follow endpoints whose addresses
+// change.
+type Refresher struct {
+	logger  lager.Logger
+	backend api.Client
+	clock   clock.Clock
+}
+
+func New(logger lager.Logger, backend api.Client, clock clock.Clock) *Refresher {
+	return &Refresher{
+		logger:  logger.Session("net-out-refresher"),
+		backend: backend,
+		clock:   clock,
+	}
+}
+
+func (r *Refresher) Run(interval time.Duration) {
+	for {
+		r.clock.Sleep(interval)
+		r.Refresh()
+	}
+}
+
+func (r *Refresher) Refresh() {
+	containers, err := r.backend.Containers(nil)
+	if err != nil {
+		r.logger.Error("failed-to-list-containers", err)
+		return
+	}
+
+	for _, container := range containers {
+		refresher, ok := container.(Container)
+		if !ok {
+			continue
+		}
+
+		// the container logs which hostnames failed; carry on with the rest
+		err := refresher.RefreshNetOuts()
+		if err != nil {
+			r.logger.Error("failed-to-refresh", err, lager.Data{
+				"handle": container.Handle(),
+			})
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package net_out_refresher_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestNetOutRefresher(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Net Out Refresher Suite")
+}
@@ -0,0 +1,109 @@
+package net_out_refresher_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/clock/fake_clock"
+	"github.com/cloudfoundry-incubator/garden-linux/old/net_out_refresher"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+type refreshableContainer struct {
+	*fakes.FakeContainer
+
+	refreshes int32
+	err       error
+}
+
+func (c *refreshableContainer) RefreshNetOuts() error {
+	atomic.AddInt32(&c.refreshes, 1)
+	return c.err
+}
+
+func (c *refreshableContainer) Refreshes() int32 {
+	return atomic.LoadInt32(&c.refreshes)
+}
+
+var _ = Describe("Net out refresher", func() {
+	var logger *lagertest.TestLogger
+	var fakeBackend *fakes.FakeBackend
+	var fakeClock *fake_clock.FakeClock
+	var refresher *net_out_refresher.Refresher
+
+	var containerA, containerB *refreshableContainer
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeBackend = new(fakes.FakeBackend)
+		fakeClock = fake_clock.New(time.Unix(123, 456))
+
+		containerA = &refreshableContainer{FakeContainer: new(fakes.FakeContainer)}
+		containerB = &refreshableContainer{FakeContainer: new(fakes.FakeContainer)}
+
+		fakeBackend.ContainersReturns([]api.Container{
+			containerA,
+			new(fakes.FakeContainer),
+			containerB,
+		}, nil)
+
+		refresher = net_out_refresher.New(logger, fakeBackend, fakeClock)
+	})
+
+	It("refreshes every container that can be", func() {
+		refresher.Refresh()
+
+		Ω(containerA.Refreshes()).Should(Equal(int32(1)))
+		Ω(containerB.Refreshes()).Should(Equal(int32(1)))
+	})
+
+	Context("when refreshing a container fails", func() {
+		BeforeEach(func() {
+			containerA.err = errors.New("oh no!")
+		})
+
+		It("logs the error and carries on", func() {
+			refresher.Refresh()
+
+			Ω(containerB.Refreshes()).Should(Equal(int32(1)))
+			Ω(logger.Logs()).Should(HaveLen(1))
+			Ω(logger.Logs()[0].Message).Should(Equal("test.net-out-refresher.failed-to-refresh"))
+			Ω(logger.Logs()[0].Data["error"]).Should(Equal("oh no!"))
+		})
+	})
+
+	Context("when listing the containers fails", func() {
+		BeforeEach(func() {
+			fakeBackend.ContainersReturns(nil, errors.New("oh no!"))
+		})
+
+		It("logs the error", func() {
+			refresher.Refresh()
+
+			Ω(logger.Logs()).Should(HaveLen(1))
+			Ω(logger.Logs()[0].Message).Should(Equal("test.net-out-refresher.failed-to-list-containers"))
+		})
+	})
+
+	Describe("running periodically", func() {
+		It("refreshes every interval", func() {
+			go refresher.Run(time.Minute)
+
+			Eventually(fakeClock.WatcherCount).Should(Equal(1))
+			Ω(containerA.Refreshes()).Should(Equal(int32(0)))
+
+			fakeClock.Increment(time.Minute)
+			Eventually(containerA.Refreshes).Should(Equal(int32(1)))
+
+			Eventually(fakeClock.WatcherCount).Should(Equal(1))
+			fakeClock.Increment(time.Minute)
+			Eventually(containerA.Refreshes).Should(Equal(int32(2)))
+		})
+	})
+})
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+)
+
+// netconfig sets up a container's network from within its network namespace,
+// run by the container's hook-child-after-pivot.sh, or from the host with
+// -netns by net.sh repair
+
+func init() {
+	// namespaces are per thread; keep main on the one that enters it
+	runtime.LockOSThread()
+}
+
+var netns = flag.String(
+	"netns",
+	"",
+	"network namespace to enter before configuring, e.g. /proc/<pid>/ns/net (default: the current one)",
+)
+
+var iface = flag.String(
+	"interface",
+	"",
+	"the container's end of its veth pair",
+)
+
+var containerIP = flag.String(
+	"containerIP",
+	"",
+	"the container's address",
+)
+
+var prefixLength = flag.Int(
+	"prefixLength",
+	30,
+	"the prefix length of the container's network",
+)
+
+var hostIP = flag.String(
+	"hostIP",
+	"",
+	"the host's address, used as the container's default gateway",
+)
+
+var mtu = flag.Int(
+	"mtu",
+	0,
+	"MTU of the container's interface (0 = leave as is)",
+)
+
+var routed = flag.Bool(
+	"routed",
+	false,
+	"route to the host's address directly over the interface, as it is outside the container's network",
+)
+
+var staticNeighbours = flag.Bool(
+	"staticNeighbours",
+	false,
+	"resolve every other address in the container's network without ARP, for containers on a shared bridge",
+)
+
+func main() {
+	flag.Parse()
+
+	parsedContainerIP := net.ParseIP(*containerIP)
+	parsedHostIP := net.ParseIP(*hostIP)
+
+	if *iface == "" || parsedContainerIP == nil || parsedHostIP == nil {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *netns != "" {
+		err := enterNetns(*netns)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "netconfig:", err)
+			os.Exit(1)
+		}
+	}
+
+	err := network.Configurer{}.ConfigureContainer(network.ContainerConfig{
+		Interface:    *iface,
+		IP:           parsedContainerIP,
+		PrefixLength: *prefixLength,
+		HostIP:       parsedHostIP,
+		MTU:          *mtu,
+		Routed:       *routed,
+
+		StaticNeighbours: *staticNeighbours,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "netconfig:", err)
+		os.Exit(1)
+	}
+}
+
+func enterNetns(path string) error {
+	ns, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer ns.Close()
+
+	_, _, errno := syscall.RawSyscall(sysSetns, ns.Fd(), syscall.CLONE_NEWNET, 0)
+	if errno != 0 {
+		return fmt.Errorf("entering %s: %s", path, errno)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package network_repairs
+
+import (
+	"net/http"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/admin"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+type Container interface {
+	RepairNetwork() error
+}
+
+// Handler rewires a running container's network on POST ?handle=..., for
+// when its veth pair has been deleted from under it, as by a network
+// restart, rather than having to recreate the container.
+type Handler struct {
+	logger  lager.Logger
+	backend api.Client
+}
+
+func New(logger lager.Logger, backend api.Client) *Handler {
+	return &Handler{
+		logger:  logger.Session("network-repairs"),
+		backend: backend,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var repairer Container
+	if !admin.LookupContainer(w, r, h.backend, "POST", &repairer) {
+		return
+	}
+
+	rLog := h.logger.Session("repair", lager.Data{
+		"handle": r.URL.Query().Get("handle"),
+	})
+
+	err := repairer.RepairNetwork()
+
+	switch err.(type) {
+	case nil:
+	case linux_backend.InvalidStateError:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		rLog.Error("failed", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rLog.Info("done")
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,13 @@
+package network_repairs_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestNetworkRepairs(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Network Repairs Suite")
+}
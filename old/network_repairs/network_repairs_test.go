@@ -0,0 +1,113 @@
+package network_repairs_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/network_repairs"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+type repairableContainer struct {
+	*fakes.FakeContainer
+
+	repaired int
+	err      error
+}
+
+func (c *repairableContainer) RepairNetwork() error {
+	c.repaired++
+	return c.err
+}
+
+var _ = Describe("Network repairs", func() {
+	var fakeBackend *fakes.FakeBackend
+	var container *repairableContainer
+	var handler *network_repairs.Handler
+
+	BeforeEach(func() {
+		container = &repairableContainer{FakeContainer: new(fakes.FakeContainer)}
+
+		fakeBackend = new(fakes.FakeBackend)
+		fakeBackend.LookupReturns(container, nil)
+
+		handler = network_repairs.New(lagertest.NewTestLogger("test"), fakeBackend)
+	})
+
+	request := func(method, query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+
+		request, err := http.NewRequest(method, "/repair-network?"+query, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	It("repairs the container's network", func() {
+		response := request("POST", "handle=some-handle")
+		Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+		Ω(fakeBackend.LookupArgsForCall(0)).Should(Equal("some-handle"))
+		Ω(container.repaired).Should(Equal(1))
+	})
+
+	It("only allows POST", func() {
+		response := request("GET", "handle=some-handle")
+		Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+
+		Ω(container.repaired).Should(BeZero())
+	})
+
+	Context("when the container does not exist", func() {
+		BeforeEach(func() {
+			fakeBackend.LookupReturns(nil, linux_backend.UnknownHandleError{Handle: "some-handle"})
+		})
+
+		It("responds with 404", func() {
+			response := request("POST", "handle=some-handle")
+			Ω(response.Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("when the container is not running", func() {
+		BeforeEach(func() {
+			container.err = linux_backend.InvalidStateError{State: linux_backend.StateStopped}
+		})
+
+		It("responds with 409", func() {
+			response := request("POST", "handle=some-handle")
+			Ω(response.Code).Should(Equal(http.StatusConflict))
+		})
+	})
+
+	Context("when repairing fails", func() {
+		BeforeEach(func() {
+			container.err = errors.New("oh no!")
+		})
+
+		It("responds with 500 and the error", func() {
+			response := request("POST", "handle=some-handle")
+			Ω(response.Code).Should(Equal(http.StatusInternalServerError))
+			Ω(response.Body.String()).Should(ContainSubstring("oh no!"))
+		})
+	})
+
+	Context("when the container's network cannot be repaired", func() {
+		BeforeEach(func() {
+			fakeBackend.LookupReturns(new(fakes.FakeContainer), nil)
+		})
+
+		It("responds with 501", func() {
+			response := request("POST", "handle=some-handle")
+			Ω(response.Code).Should(Equal(http.StatusNotImplemented))
+		})
+	})
+})
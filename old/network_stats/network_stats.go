@@ -0,0 +1,62 @@
+package network_stats
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+)
+
+type Container interface {
+	NetworkStat() (linux_backend.ContainerNetworkStat, error)
+}
+
+// Handler serves the network stats of every container, by handle, as JSON;
+// the garden API has no room for them in a container's info.
+type Handler struct {
+	logger  lager.Logger
+	backend api.Client
+}
+
+func New(logger lager.Logger, backend api.Client) *Handler {
+	return &Handler{
+		logger:  logger.Session("network-stats"),
+		backend: backend,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	containers, err := h.backend.Containers(nil)
+	if err != nil {
+		h.logger.Error("failed-to-list-containers", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stats := map[string]linux_backend.ContainerNetworkStat{}
+
+	for _, container := range containers {
+		statter, ok := container.(Container)
+		if !ok {
+			continue
+		}
+
+		// the container may have been destroyed since it was listed
+		stat, err := statter.NetworkStat()
+		if err != nil {
+			h.logger.Error("failed-to-get-stats", err, lager.Data{
+				"handle": container.Handle(),
+			})
+
+			continue
+		}
+
+		stats[container.Handle()] = stat
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,13 @@
+package network_stats_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestNetworkStats(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Network Stats Suite")
+}
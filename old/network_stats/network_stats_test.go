@@ -0,0 +1,110 @@
+package network_stats_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/network_stats"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+type statContainer struct {
+	*fakes.FakeContainer
+
+	stat linux_backend.ContainerNetworkStat
+	err  error
+}
+
+func (c *statContainer) NetworkStat() (linux_backend.ContainerNetworkStat, error) {
+	return c.stat, c.err
+}
+
+var _ = Describe("Network stats", func() {
+	var fakeBackend *fakes.FakeBackend
+	var handler *network_stats.Handler
+
+	BeforeEach(func() {
+		fakeBackend = new(fakes.FakeBackend)
+		handler = network_stats.New(lagertest.NewTestLogger("test"), fakeBackend)
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+
+		request, err := http.NewRequest("GET", "/network-stats", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	newContainer := func(handle string, stat linux_backend.ContainerNetworkStat, err error) api.Container {
+		fakeContainer := new(fakes.FakeContainer)
+		fakeContainer.HandleReturns(handle)
+
+		return &statContainer{
+			FakeContainer: fakeContainer,
+			stat:          stat,
+			err:           err,
+		}
+	}
+
+	It("serves each container's stats by handle", func() {
+		fakeBackend.ContainersReturns([]api.Container{
+			newContainer("handle-a", linux_backend.ContainerNetworkStat{RxBytes: 1, TxBytes: 2}, nil),
+			newContainer("handle-b", linux_backend.ContainerNetworkStat{ForwardedBytes: 3}, nil),
+		}, nil)
+
+		response := get()
+		Ω(response.Code).Should(Equal(http.StatusOK))
+
+		var stats map[string]linux_backend.ContainerNetworkStat
+		err := json.NewDecoder(response.Body).Decode(&stats)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(stats).Should(Equal(map[string]linux_backend.ContainerNetworkStat{
+			"handle-a": {RxBytes: 1, TxBytes: 2},
+			"handle-b": {ForwardedBytes: 3},
+		}))
+	})
+
+	It("lists every container", func() {
+		get()
+
+		Ω(fakeBackend.ContainersArgsForCall(0)).Should(BeNil())
+	})
+
+	Context("when a container's stats cannot be read", func() {
+		It("leaves it out", func() {
+			fakeBackend.ContainersReturns([]api.Container{
+				newContainer("handle-a", linux_backend.ContainerNetworkStat{}, errors.New("oh no!")),
+				newContainer("handle-b", linux_backend.ContainerNetworkStat{RxPackets: 4}, nil),
+			}, nil)
+
+			var stats map[string]linux_backend.ContainerNetworkStat
+			err := json.NewDecoder(get().Body).Decode(&stats)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(stats).Should(Equal(map[string]linux_backend.ContainerNetworkStat{
+				"handle-b": {RxPackets: 4},
+			}))
+		})
+	})
+
+	Context("when the containers cannot be listed", func() {
+		It("fails", func() {
+			fakeBackend.ContainersReturns(nil, errors.New("oh no!"))
+
+			Ω(get().Code).Should(Equal(http.StatusInternalServerError))
+		})
+	})
+})
@@ -0,0 +1,63 @@
+package operations
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+type Backend interface {
+	Operations() []linux_backend.Operation
+	CancelOperation(id string) error
+}
+
+// Handler lists the long-running operations in flight, creates and
+// streams-in, on GET, and cancels one on DELETE ?id=...
+//
+// A create can be given its ID with the garden.request-id property, so that
+// it can be cancelled, which the garden API has no way to do.
+type Handler struct {
+	logger  lager.Logger
+	backend Backend
+}
+
+func New(logger lager.Logger, backend Backend) *Handler {
+	return &Handler{
+		logger:  logger.Session("operations"),
+		backend: backend,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.backend.Operations())
+
+	case "DELETE":
+		id := r.URL.Query().Get("id")
+
+		err := h.backend.CancelOperation(id)
+		switch err.(type) {
+		case nil:
+		case linux_backend.UnknownOperationError:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		default:
+			h.logger.Error("failed-to-cancel", err, lager.Data{"id": id})
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Info("cancelled", lager.Data{"id": id})
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
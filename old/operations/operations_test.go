@@ -0,0 +1,101 @@
+package operations_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/operations"
+)
+
+type fakeBackend struct {
+	operations []linux_backend.Operation
+
+	cancelled []string
+}
+
+func (b *fakeBackend) Operations() []linux_backend.Operation {
+	return b.operations
+}
+
+func (b *fakeBackend) CancelOperation(id string) error {
+	for _, op := range b.operations {
+		if op.ID == id {
+			b.cancelled = append(b.cancelled, id)
+			return nil
+		}
+	}
+
+	return linux_backend.UnknownOperationError{ID: id}
+}
+
+var _ = Describe("Operations", func() {
+	var backend *fakeBackend
+	var handler *operations.Handler
+
+	BeforeEach(func() {
+		backend = &fakeBackend{
+			operations: []linux_backend.Operation{
+				{
+					ID:      "some-request-id",
+					Kind:    "create",
+					Handle:  "some-handle",
+					Started: time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC),
+				},
+			},
+		}
+
+		handler = operations.New(lagertest.NewTestLogger("test"), backend)
+	})
+
+	request := func(method, query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+
+		request, err := http.NewRequest(method, "/operations?"+query, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	It("lists the operations in flight", func() {
+		response := request("GET", "")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+
+		Ω(response.Body.String()).Should(MatchJSON(`[
+			{
+				"id": "some-request-id",
+				"kind": "create",
+				"handle": "some-handle",
+				"started": "2015-01-02T03:04:05Z"
+			}
+		]`))
+	})
+
+	It("cancels an operation by its id", func() {
+		response := request("DELETE", "id=some-request-id")
+		Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+		Ω(backend.cancelled).Should(Equal([]string{"some-request-id"}))
+	})
+
+	Context("when the operation is not in flight", func() {
+		It("responds with 404", func() {
+			response := request("DELETE", "id=bogus-id")
+			Ω(response.Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+
+	It("only allows GET and DELETE", func() {
+		response := request("POST", "id=some-request-id")
+		Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+
+		Ω(backend.cancelled).Should(BeEmpty())
+	})
+})
@@ -0,0 +1,271 @@
+package packet_captures
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/admin"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+type Container interface {
+	NetworkInterfaces() (linux_backend.ContainerNetworkInterfaces, error)
+}
+
+// Limits bound every capture, however it is asked for.
+type Limits struct {
+	MaxDuration time.Duration
+	MaxBytes    int64
+}
+
+// Capture is where a capture written to the captures directory was saved.
+type Capture struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Handler captures the packets on a container's host-side veth with tcpdump
+// on POST ?handle=..., so that its network can be diagnosed without root on
+// the cell. A capture lasts for ?duration= and stops after ?max_bytes= of
+// pcap, each defaulting to and capped by the handler's Limits; ?filter= is a
+// pcap filter expression, and ?promiscuous=true puts the veth into
+// promiscuous mode for the capture. The pcap is streamed in the response,
+// or with ?file=name saved into the captures directory, if there is one.
+// Only one capture of a veth runs at a time.
+type Handler struct {
+	logger    lager.Logger
+	backend   api.Client
+	runner    command_runner.CommandRunner
+	directory string
+	limits    Limits
+
+	capturing      map[string]bool
+	capturingMutex *sync.Mutex
+}
+
+func New(logger lager.Logger, backend api.Client, runner command_runner.CommandRunner, directory string, limits Limits) *Handler {
+	return &Handler{
+		logger:    logger.Session("packet-captures"),
+		backend:   backend,
+		runner:    runner,
+		directory: directory,
+		limits:    limits,
+
+		capturing:      make(map[string]bool),
+		capturingMutex: new(sync.Mutex),
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var attached Container
+	if !admin.LookupContainer(w, r, h.backend, "POST", &attached) {
+		return
+	}
+
+	query := r.URL.Query()
+
+	duration := h.limits.MaxDuration
+	if query.Get("duration") != "" {
+		parsed, err := time.ParseDuration(query.Get("duration"))
+		if err != nil || parsed <= 0 || parsed > h.limits.MaxDuration {
+			http.Error(w, "duration must be positive and at most "+h.limits.MaxDuration.String(), http.StatusBadRequest)
+			return
+		}
+
+		duration = parsed
+	}
+
+	maxBytes := h.limits.MaxBytes
+	if query.Get("max_bytes") != "" {
+		parsed, err := strconv.ParseInt(query.Get("max_bytes"), 10, 64)
+		if err != nil || parsed <= 0 || parsed > h.limits.MaxBytes {
+			http.Error(w, fmt.Sprintf("max_bytes must be positive and at most %d", h.limits.MaxBytes), http.StatusBadRequest)
+			return
+		}
+
+		maxBytes = parsed
+	}
+
+	file := query.Get("file")
+	if file != "" {
+		if h.directory == "" {
+			http.Error(w, "no captures directory is configured", http.StatusBadRequest)
+			return
+		}
+
+		if strings.Contains(file, "/") || strings.HasPrefix(file, ".") {
+			http.Error(w, "file must be a name within the captures directory", http.StatusBadRequest)
+			return
+		}
+	}
+
+	interfaces, err := attached.NetworkInterfaces()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if interfaces.HostIface == "" {
+		http.Error(w, "container has no host-side interface", http.StatusConflict)
+		return
+	}
+
+	if !h.claim(interfaces.HostIface) {
+		http.Error(w, "interface is already being captured: "+interfaces.HostIface, http.StatusConflict)
+		return
+	}
+
+	defer h.release(interfaces.HostIface)
+
+	cLog := h.logger.Session("capture", lager.Data{
+		"handle":    query.Get("handle"),
+		"interface": interfaces.HostIface,
+		"duration":  duration.String(),
+		"max-bytes": maxBytes,
+	})
+
+	args := []string{"-i", interfaces.HostIface, "-U", "-w", "-"}
+	if query.Get("promiscuous") != "true" {
+		args = append(args, "-p")
+	}
+
+	if filter := query.Get("filter"); filter != "" {
+		// the filter is the client's, so make sure tcpdump can't take it for
+		// an option such as -z
+		args = append(args, "--", filter)
+	}
+
+	tcpdump := exec.Command("tcpdump", args...)
+
+	if file == "" {
+		w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+
+		written, err := h.capture(tcpdump, w, duration, maxBytes)
+		if err != nil {
+			// the pcap may already be partly written, so the status can't
+			// be changed
+			cLog.Error("failed", err)
+			return
+		}
+
+		cLog.Info("done", lager.Data{"bytes": written})
+
+		return
+	}
+
+	capturePath := filepath.Join(h.directory, file)
+
+	out, err := os.OpenFile(capturePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	written, err := h.capture(tcpdump, out, duration, maxBytes)
+
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		cLog.Error("failed", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	cLog.Info("done", lager.Data{
+		"bytes": written,
+		"path":  capturePath,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	json.NewEncoder(w).Encode(Capture{
+		Path:  capturePath,
+		Bytes: written,
+	})
+}
+
+// capture copies tcpdump's pcap to out until it has run for the duration,
+// written maxBytes, or out can't be written to; tcpdump is interrupted
+// rather than killed, so that it flushes what it has captured.
+func (h *Handler) capture(tcpdump *exec.Cmd, out io.Writer, duration time.Duration, maxBytes int64) (int64, error) {
+	pcap, pcapWriter := io.Pipe()
+	tcpdump.Stdout = pcapWriter
+
+	err := h.runner.Start(tcpdump)
+	if err != nil {
+		return 0, err
+	}
+
+	exited := make(chan struct{})
+
+	go func() {
+		pcapWriter.CloseWithError(h.runner.Wait(tcpdump))
+		close(exited)
+	}()
+
+	timer := time.AfterFunc(duration, func() {
+		h.runner.Signal(tcpdump, syscall.SIGINT)
+	})
+
+	written, err := io.Copy(out, io.LimitReader(pcap, maxBytes))
+
+	timer.Stop()
+	h.runner.Signal(tcpdump, syscall.SIGINT)
+
+	// whatever else tcpdump flushes is dropped, so that it doesn't block
+	// on writing it
+	io.Copy(ioutil.Discard, pcap)
+	<-exited
+
+	return written, interrupted(err)
+}
+
+// interrupted is nil for tcpdump exiting because it was interrupted, which
+// is how every capture ends
+func interrupted(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() && status.Signal() == syscall.SIGINT {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func (h *Handler) claim(iface string) bool {
+	h.capturingMutex.Lock()
+	defer h.capturingMutex.Unlock()
+
+	if h.capturing[iface] {
+		return false
+	}
+
+	h.capturing[iface] = true
+
+	return true
+}
+
+func (h *Handler) release(iface string) {
+	h.capturingMutex.Lock()
+	delete(h.capturing, iface)
+	h.capturingMutex.Unlock()
+}
@@ -0,0 +1,13 @@
+package packet_captures_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPacketCaptures(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Packet Captures Suite")
+}
@@ -0,0 +1,247 @@
+package packet_captures_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/packet_captures"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+type attachedContainer struct {
+	*fakes.FakeContainer
+
+	interfaces linux_backend.ContainerNetworkInterfaces
+}
+
+func (c *attachedContainer) NetworkInterfaces() (linux_backend.ContainerNetworkInterfaces, error) {
+	return c.interfaces, nil
+}
+
+var _ = Describe("Packet captures", func() {
+	var fakeBackend *fakes.FakeBackend
+	var fakeRunner *fake_command_runner.FakeCommandRunner
+	var directory string
+	var handler *packet_captures.Handler
+
+	tcpdump := fake_command_runner.CommandSpec{Path: "tcpdump"}
+
+	BeforeEach(func() {
+		fakeBackend = new(fakes.FakeBackend)
+		fakeBackend.LookupReturns(&attachedContainer{
+			FakeContainer: new(fakes.FakeContainer),
+			interfaces: linux_backend.ContainerNetworkInterfaces{
+				HostIface: "w-some-id-0",
+			},
+		}, nil)
+
+		fakeRunner = fake_command_runner.New()
+
+		fakeRunner.WhenRunning(tcpdump, func(cmd *exec.Cmd) error {
+			go cmd.Stdout.Write([]byte("some-pcap"))
+			return nil
+		})
+
+		// tcpdump runs until it is interrupted
+		fakeRunner.WhenWaitingFor(tcpdump, func(cmd *exec.Cmd) error {
+			for fakeRunner.SignalledCommands()[cmd] != syscall.SIGINT {
+				time.Sleep(time.Millisecond)
+			}
+
+			return nil
+		})
+
+		var err error
+		directory, err = ioutil.TempDir("", "packet-captures")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		handler = packet_captures.New(lagertest.NewTestLogger("test"), fakeBackend, fakeRunner, directory, packet_captures.Limits{
+			MaxDuration: time.Second,
+			MaxBytes:    1024,
+		})
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(directory)
+	})
+
+	request := func(method, query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+
+		request, err := http.NewRequest(method, "/packet-capture?"+query, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	It("streams a capture of the container's host-side veth for the duration", func() {
+		started := time.Now()
+
+		response := request("POST", "handle=some-handle&duration=50ms&filter=tcp+port+80")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get("Content-Type")).Should(Equal("application/vnd.tcpdump.pcap"))
+		Ω(response.Body.String()).Should(Equal("some-pcap"))
+
+		Ω(time.Since(started)).Should(BeNumerically(">=", 50*time.Millisecond))
+
+		Ω(fakeBackend.LookupArgsForCall(0)).Should(Equal("some-handle"))
+
+		Ω(fakeRunner.StartedCommands()).Should(HaveLen(1))
+		Ω(fakeRunner.StartedCommands()[0].Args).Should(Equal([]string{
+			"tcpdump", "-i", "w-some-id-0", "-U", "-w", "-", "-p", "--", "tcp port 80",
+		}))
+	})
+
+	It("doesn't let a filter be taken for an option", func() {
+		response := request("POST", "handle=some-handle&duration=1ms&filter=-z+/bin/sh")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+
+		Ω(fakeRunner.StartedCommands()[0].Args).Should(Equal([]string{
+			"tcpdump", "-i", "w-some-id-0", "-U", "-w", "-", "-p", "--", "-z /bin/sh",
+		}))
+	})
+
+	It("puts the veth into promiscuous mode if asked to", func() {
+		response := request("POST", "handle=some-handle&duration=1ms&promiscuous=true")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+
+		Ω(fakeRunner.StartedCommands()[0].Args).Should(Equal([]string{
+			"tcpdump", "-i", "w-some-id-0", "-U", "-w", "-",
+		}))
+	})
+
+	It("stops the capture once it reaches max_bytes", func() {
+		response := request("POST", "handle=some-handle&max_bytes=4")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Body.String()).Should(Equal("some"))
+
+		Ω(fakeRunner.SignalledCommands()).Should(HaveLen(1))
+	})
+
+	for _, query := range []string{"duration=2s", "duration=0s", "duration=soon", "max_bytes=2048", "max_bytes=0"} {
+		query := query
+
+		Context("when "+query, func() {
+			It("returns 400 without capturing", func() {
+				response := request("POST", "handle=some-handle&"+query)
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+
+				Ω(fakeRunner.StartedCommands()).Should(BeEmpty())
+			})
+		})
+	}
+
+	Context("when a file is given", func() {
+		It("saves the capture into the captures directory", func() {
+			response := request("POST", "handle=some-handle&duration=1ms&file=some.pcap")
+			Ω(response.Code).Should(Equal(http.StatusCreated))
+
+			var capture packet_captures.Capture
+			err := json.NewDecoder(response.Body).Decode(&capture)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(capture).Should(Equal(packet_captures.Capture{
+				Path:  filepath.Join(directory, "some.pcap"),
+				Bytes: 9,
+			}))
+
+			Ω(ioutil.ReadFile(capture.Path)).Should(Equal([]byte("some-pcap")))
+		})
+
+		It("doesn't overwrite an existing capture", func() {
+			err := ioutil.WriteFile(filepath.Join(directory, "some.pcap"), []byte("old"), 0600)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			response := request("POST", "handle=some-handle&file=some.pcap")
+			Ω(response.Code).Should(Equal(http.StatusConflict))
+
+			Ω(fakeRunner.StartedCommands()).Should(BeEmpty())
+		})
+
+		for _, file := range []string{"../some.pcap", "sub/some.pcap", ".hidden"} {
+			file := file
+
+			It("refuses "+file, func() {
+				response := request("POST", "handle=some-handle&file="+file)
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+			})
+		}
+
+		Context("when there is no captures directory", func() {
+			BeforeEach(func() {
+				directory = ""
+			})
+
+			It("returns 400", func() {
+				response := request("POST", "handle=some-handle&file=some.pcap")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
+	Context("when the veth is already being captured", func() {
+		It("returns 409", func() {
+			done := make(chan struct{})
+
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+
+				response := request("POST", "handle=some-handle&duration=500ms")
+				Ω(response.Code).Should(Equal(http.StatusOK))
+			}()
+
+			Eventually(fakeRunner.StartedCommands).Should(HaveLen(1))
+
+			response := request("POST", "handle=some-handle")
+			Ω(response.Code).Should(Equal(http.StatusConflict))
+
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	Context("when the container can't be found", func() {
+		BeforeEach(func() {
+			fakeBackend.LookupReturns(nil, errors.New("oh no!"))
+		})
+
+		It("returns 404", func() {
+			response := request("POST", "handle=some-handle")
+			Ω(response.Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("when the container has no veth", func() {
+		BeforeEach(func() {
+			fakeBackend.LookupReturns(new(fakes.FakeContainer), nil)
+		})
+
+		It("returns 501", func() {
+			response := request("POST", "handle=some-handle")
+			Ω(response.Code).Should(Equal(http.StatusNotImplemented))
+		})
+	})
+
+	It("only allows POST", func() {
+		response := request("GET", "handle=some-handle")
+		Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+	})
+})
@@ -0,0 +1,41 @@
+package periodic
+
+import (
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/clock"
+)
+
+// Job runs a function periodically, e.g. to have the container pool follow
+// changes to the host's external address or sweep the rules of containers
+// that are gone. Failures are logged under the job's session, and the job
+// carries on.
+type Job struct {
+	logger lager.Logger
+	clock  clock.Clock
+	run    func() error
+}
+
+func New(logger lager.Logger, session string, clock clock.Clock, run func() error) *Job {
+	return &Job{
+		logger: logger.Session(session),
+		clock:  clock,
+		run:    run,
+	}
+}
+
+func (j *Job) Run(interval time.Duration) {
+	for {
+		j.clock.Sleep(interval)
+		j.RunOnce()
+	}
+}
+
+func (j *Job) RunOnce() {
+	err := j.run()
+	if err != nil {
+		j.logger.Error("failed", err)
+	}
+}
@@ -0,0 +1,13 @@
+package periodic_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPeriodic(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Periodic Suite")
+}
@@ -0,0 +1,78 @@
+package periodic_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/clock/fake_clock"
+	"github.com/cloudfoundry-incubator/garden-linux/old/periodic"
+)
+
+var _ = Describe("Periodic jobs", func() {
+	var logger *lagertest.TestLogger
+	var fakeClock *fake_clock.FakeClock
+
+	var runs int32
+	var runErr error
+
+	var job *periodic.Job
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeClock = fake_clock.New(time.Unix(123, 456))
+
+		atomic.StoreInt32(&runs, 0)
+		runErr = nil
+
+		job = periodic.New(logger, "some-job", fakeClock, func() error {
+			atomic.AddInt32(&runs, 1)
+			return runErr
+		})
+	})
+
+	Runs := func() int32 {
+		return atomic.LoadInt32(&runs)
+	}
+
+	It("runs the function", func() {
+		job.RunOnce()
+
+		Ω(Runs()).Should(Equal(int32(1)))
+		Ω(logger.Logs()).Should(BeEmpty())
+	})
+
+	Context("when the function fails", func() {
+		BeforeEach(func() {
+			runErr = errors.New("oh no!")
+		})
+
+		It("logs the error under the job's session", func() {
+			job.RunOnce()
+
+			Ω(logger.Logs()).Should(HaveLen(1))
+			Ω(logger.Logs()[0].Message).Should(Equal("test.some-job.failed"))
+			Ω(logger.Logs()[0].Data["error"]).Should(Equal("oh no!"))
+		})
+	})
+
+	Describe("running periodically", func() {
+		It("runs the function every interval", func() {
+			go job.Run(time.Minute)
+
+			Eventually(fakeClock.WatcherCount).Should(Equal(1))
+			Ω(Runs()).Should(Equal(int32(0)))
+
+			fakeClock.Increment(time.Minute)
+			Eventually(Runs).Should(Equal(int32(1)))
+
+			Eventually(fakeClock.WatcherCount).Should(Equal(1))
+			fakeClock.Increment(time.Minute)
+			Eventually(Runs).Should(Equal(int32(2)))
+		})
+	})
+})
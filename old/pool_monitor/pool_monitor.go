@@ -0,0 +1,149 @@
+package pool_monitor
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry/dropsonde/autowire/metrics"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/clock"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+var ErrPoolNearlyExhausted = errors.New("pool nearly exhausted")
+
+// how many of the containers holding the most reservations to log
+const topHolders = 5
+
+type Pool interface {
+	Available() int
+	InitialSize() int
+}
+
+type MonitoredPool struct {
+	Name   string
+	Metric string
+	Pool   Pool
+
+	// the percentage free at or below which to warn; 0 disables warning
+	Threshold int
+}
+
+// Monitor sends how much of each pool is free as a metric, and logs an
+// error when it falls to its threshold, naming the containers holding the
+// most reservations, so that operators are warned before creates fail.
+type Monitor struct {
+	logger  lager.Logger
+	backend api.Client
+	pools   []MonitoredPool
+	clock   clock.Clock
+
+	exhausted map[string]bool
+}
+
+func New(logger lager.Logger, backend api.Client, pools []MonitoredPool, clock clock.Clock) *Monitor {
+	return &Monitor{
+		logger:  logger.Session("pool-monitor"),
+		backend: backend,
+		pools:   pools,
+		clock:   clock,
+
+		exhausted: map[string]bool{},
+	}
+}
+
+func (m *Monitor) Run(interval time.Duration) {
+	for {
+		m.Check()
+		m.clock.Sleep(interval)
+	}
+}
+
+func (m *Monitor) Check() {
+	for _, pool := range m.pools {
+		size := pool.Pool.InitialSize()
+		if size == 0 {
+			continue
+		}
+
+		free := pool.Pool.Available() * 100 / size
+
+		metrics.SendValue(pool.Metric, float64(free), "Percent")
+
+		nearlyExhausted := pool.Threshold > 0 && free <= pool.Threshold
+
+		// only log when the threshold is crossed, not on every check
+		if nearlyExhausted == m.exhausted[pool.Name] {
+			continue
+		}
+
+		m.exhausted[pool.Name] = nearlyExhausted
+
+		data := lager.Data{
+			"pool":      pool.Name,
+			"free":      free,
+			"threshold": pool.Threshold,
+		}
+
+		if nearlyExhausted {
+			data["top-holders"] = m.topHolders()
+			m.logger.Error("pool-nearly-exhausted", ErrPoolNearlyExhausted, data)
+		} else {
+			m.logger.Info("pool-recovered", data)
+		}
+	}
+}
+
+type Holder struct {
+	Handle       string `json:"handle"`
+	Reservations int    `json:"reservations"`
+}
+
+type holders []Holder
+
+func (h holders) Len() int           { return len(h) }
+func (h holders) Less(i, j int) bool { return h[i].Reservations > h[j].Reservations }
+func (h holders) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+// topHolders lists the containers holding the most networks and ports
+func (m *Monitor) topHolders() []Holder {
+	containers, err := m.backend.Containers(nil)
+	if err != nil {
+		m.logger.Error("failed-to-list-containers", err)
+		return nil
+	}
+
+	all := holders{}
+
+	for _, container := range containers {
+		linuxContainer, ok := container.(interface {
+			Resources() *linux_backend.Resources
+		})
+		if !ok {
+			continue
+		}
+
+		resources := linuxContainer.Resources()
+
+		reservations := len(resources.Ports)
+		if resources.Network != nil {
+			reservations++
+		}
+
+		all = append(all, Holder{
+			Handle:       container.Handle(),
+			Reservations: reservations,
+		})
+	}
+
+	sort.Stable(all)
+
+	if len(all) > topHolders {
+		all = all[:topHolders]
+	}
+
+	return all
+}
@@ -0,0 +1,13 @@
+package pool_monitor_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPoolMonitor(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Pool Monitor Suite")
+}
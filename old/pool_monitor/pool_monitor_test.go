@@ -0,0 +1,185 @@
+package pool_monitor_test
+
+import (
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/clock/fake_clock"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+	"github.com/cloudfoundry-incubator/garden-linux/old/pool_monitor"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+	"github.com/cloudfoundry/dropsonde/autowire/metrics"
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
+)
+
+type fakePool struct {
+	available int
+	size      int
+}
+
+func (p *fakePool) Available() int   { return p.available }
+func (p *fakePool) InitialSize() int { return p.size }
+
+type resourcefulContainer struct {
+	*fakes.FakeContainer
+
+	resources *linux_backend.Resources
+}
+
+func (c *resourcefulContainer) Resources() *linux_backend.Resources {
+	return c.resources
+}
+
+var _ = Describe("Pool monitor", func() {
+	var logger *lagertest.TestLogger
+	var fakeBackend *fakes.FakeBackend
+	var fakeMetricSender *fake.FakeMetricSender
+	var networkPool *fakePool
+	var portPool *fakePool
+	var fakeClock *fake_clock.FakeClock
+	var monitor *pool_monitor.Monitor
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeBackend = new(fakes.FakeBackend)
+
+		fakeMetricSender = fake.NewFakeMetricSender()
+		metrics.Initialize(fakeMetricSender)
+
+		networkPool = &fakePool{available: 50, size: 100}
+		portPool = &fakePool{available: 1000, size: 1000}
+
+		fakeClock = fake_clock.New(time.Unix(123, 456))
+
+		monitor = pool_monitor.New(logger, fakeBackend, []pool_monitor.MonitoredPool{
+			{Name: "network", Metric: "NetworkPoolFreePercent", Pool: networkPool, Threshold: 10},
+			{Name: "port", Metric: "PortPoolFreePercent", Pool: portPool, Threshold: 20},
+		}, fakeClock)
+	})
+
+	newContainer := func(handle string, ports ...uint32) api.Container {
+		_, ipNet, err := net.ParseCIDR("10.254.0.0/30")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fakeContainer := new(fakes.FakeContainer)
+		fakeContainer.HandleReturns(handle)
+
+		return &resourcefulContainer{
+			FakeContainer: fakeContainer,
+			resources:     linux_backend.NewResources(10000, network.New(ipNet), ports),
+		}
+	}
+
+	errorLogs := func() []lager.LogFormat {
+		logs := []lager.LogFormat{}
+		for _, log := range logger.Logs() {
+			if log.LogLevel == lager.ERROR {
+				logs = append(logs, log)
+			}
+		}
+
+		return logs
+	}
+
+	It("sends how much of each pool is free", func() {
+		monitor.Check()
+
+		Ω(fakeMetricSender.GetValue("NetworkPoolFreePercent").Value).Should(Equal(float64(50)))
+		Ω(fakeMetricSender.GetValue("NetworkPoolFreePercent").Unit).Should(Equal("Percent"))
+		Ω(fakeMetricSender.GetValue("PortPoolFreePercent").Value).Should(Equal(float64(100)))
+	})
+
+	It("does not warn while the pools are above their thresholds", func() {
+		monitor.Check()
+
+		Ω(errorLogs()).Should(BeEmpty())
+	})
+
+	Context("when a pool falls to its threshold", func() {
+		BeforeEach(func() {
+			fakeBackend.ContainersReturns([]api.Container{
+				newContainer("few-ports", 61000),
+				newContainer("many-ports", 61001, 61002, 61003),
+				newContainer("no-ports"),
+			}, nil)
+
+			portPool.available = 200
+		})
+
+		It("warns, naming the containers holding the most reservations first", func() {
+			monitor.Check()
+
+			logs := errorLogs()
+			Ω(logs).Should(HaveLen(1))
+
+			Ω(logs[0].Message).Should(Equal("test.pool-monitor.pool-nearly-exhausted"))
+			Ω(logs[0].Data).Should(HaveKeyWithValue("pool", "port"))
+			Ω(logs[0].Data).Should(HaveKeyWithValue("free", float64(20)))
+			Ω(logs[0].Data).Should(HaveKeyWithValue("top-holders", []interface{}{
+				map[string]interface{}{"handle": "many-ports", "reservations": float64(4)},
+				map[string]interface{}{"handle": "few-ports", "reservations": float64(2)},
+				map[string]interface{}{"handle": "no-ports", "reservations": float64(1)},
+			}))
+		})
+
+		It("only warns once until it recovers", func() {
+			monitor.Check()
+			monitor.Check()
+
+			Ω(errorLogs()).Should(HaveLen(1))
+
+			portPool.available = 500
+			monitor.Check()
+
+			Ω(logger.Logs()[len(logger.Logs())-1].Message).Should(Equal("test.pool-monitor.pool-recovered"))
+
+			portPool.available = 100
+			monitor.Check()
+
+			Ω(errorLogs()).Should(HaveLen(2))
+		})
+	})
+
+	Context("when a pool's threshold is 0", func() {
+		BeforeEach(func() {
+			monitor = pool_monitor.New(logger, fakeBackend, []pool_monitor.MonitoredPool{
+				{Name: "network", Metric: "NetworkPoolFreePercent", Pool: networkPool},
+			}, fakeClock)
+
+			networkPool.available = 0
+		})
+
+		It("never warns", func() {
+			monitor.Check()
+
+			Ω(errorLogs()).Should(BeEmpty())
+			Ω(fakeMetricSender.GetValue("NetworkPoolFreePercent").Value).Should(Equal(float64(0)))
+		})
+	})
+
+	Describe("running periodically", func() {
+		It("checks the pools every interval", func() {
+			go monitor.Run(time.Minute)
+
+			Eventually(func() float64 {
+				return fakeMetricSender.GetValue("NetworkPoolFreePercent").Value
+			}).Should(Equal(float64(50)))
+
+			Eventually(fakeClock.WatcherCount).Should(Equal(1))
+
+			networkPool.available = 20
+			fakeClock.Increment(time.Minute)
+
+			Eventually(func() float64 {
+				return fakeMetricSender.GetValue("NetworkPoolFreePercent").Value
+			}).Should(Equal(float64(20)))
+		})
+	})
+})
@@ -0,0 +1,72 @@
+package port_mappings
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/admin"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+type Container interface {
+	NetInRemove(hostPort, containerPort uint32) error
+}
+
+// Handler removes a container's port mapping on
+// DELETE ?handle=...&hostPort=...&containerPort=..., which the garden API
+// can only add.
+type Handler struct {
+	logger  lager.Logger
+	backend api.Client
+}
+
+func New(logger lager.Logger, backend api.Client) *Handler {
+	return &Handler{
+		logger:  logger.Session("port-mappings"),
+		backend: backend,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var remover Container
+	if !admin.LookupContainer(w, r, h.backend, "DELETE", &remover) {
+		return
+	}
+
+	hostPort, err := strconv.ParseUint(r.URL.Query().Get("hostPort"), 10, 32)
+	if err != nil {
+		http.Error(w, "invalid hostPort", http.StatusBadRequest)
+		return
+	}
+
+	containerPort, err := strconv.ParseUint(r.URL.Query().Get("containerPort"), 10, 32)
+	if err != nil {
+		http.Error(w, "invalid containerPort", http.StatusBadRequest)
+		return
+	}
+
+	rLog := h.logger.Session("remove", lager.Data{
+		"handle":         r.URL.Query().Get("handle"),
+		"host-port":      hostPort,
+		"container-port": containerPort,
+	})
+
+	err = remover.NetInRemove(uint32(hostPort), uint32(containerPort))
+	switch err.(type) {
+	case nil:
+	case linux_backend.NetInNotFoundError:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	default:
+		rLog.Error("failed", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rLog.Info("removed")
+
+	w.WriteHeader(http.StatusNoContent)
+}
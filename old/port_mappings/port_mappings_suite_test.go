@@ -0,0 +1,13 @@
+package port_mappings_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPortMappings(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Port Mappings Suite")
+}
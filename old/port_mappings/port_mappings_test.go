@@ -0,0 +1,120 @@
+package port_mappings_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/port_mappings"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+type mappedContainer struct {
+	*fakes.FakeContainer
+
+	removed [][2]uint32
+	err     error
+}
+
+func (c *mappedContainer) NetInRemove(hostPort, containerPort uint32) error {
+	c.removed = append(c.removed, [2]uint32{hostPort, containerPort})
+	return c.err
+}
+
+var _ = Describe("Port mappings", func() {
+	var fakeBackend *fakes.FakeBackend
+	var container *mappedContainer
+	var handler *port_mappings.Handler
+
+	BeforeEach(func() {
+		container = &mappedContainer{FakeContainer: new(fakes.FakeContainer)}
+
+		fakeBackend = new(fakes.FakeBackend)
+		fakeBackend.LookupReturns(container, nil)
+
+		handler = port_mappings.New(lagertest.NewTestLogger("test"), fakeBackend)
+	})
+
+	request := func(method, query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+
+		request, err := http.NewRequest(method, "/net-in?"+query, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	It("removes the container's mapping", func() {
+		response := request("DELETE", "handle=some-handle&hostPort=61001&containerPort=8080")
+		Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+		Ω(fakeBackend.LookupArgsForCall(0)).Should(Equal("some-handle"))
+		Ω(container.removed).Should(Equal([][2]uint32{{61001, 8080}}))
+	})
+
+	It("only allows DELETE", func() {
+		response := request("GET", "handle=some-handle&hostPort=61001&containerPort=8080")
+		Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+
+		Ω(container.removed).Should(BeEmpty())
+	})
+
+	It("rejects invalid ports", func() {
+		Ω(request("DELETE", "handle=some-handle&hostPort=lots&containerPort=8080").Code).Should(Equal(http.StatusBadRequest))
+		Ω(request("DELETE", "handle=some-handle&hostPort=61001").Code).Should(Equal(http.StatusBadRequest))
+
+		Ω(container.removed).Should(BeEmpty())
+	})
+
+	Context("when the container does not exist", func() {
+		BeforeEach(func() {
+			fakeBackend.LookupReturns(nil, linux_backend.UnknownHandleError{Handle: "some-handle"})
+		})
+
+		It("responds with 404", func() {
+			response := request("DELETE", "handle=some-handle&hostPort=61001&containerPort=8080")
+			Ω(response.Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("when the container has no such mapping", func() {
+		BeforeEach(func() {
+			container.err = linux_backend.NetInNotFoundError{HostPort: 61001, ContainerPort: 8080}
+		})
+
+		It("responds with 404", func() {
+			response := request("DELETE", "handle=some-handle&hostPort=61001&containerPort=8080")
+			Ω(response.Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("when removing the mapping fails", func() {
+		BeforeEach(func() {
+			container.err = errors.New("oh no!")
+		})
+
+		It("responds with 500 and the error", func() {
+			response := request("DELETE", "handle=some-handle&hostPort=61001&containerPort=8080")
+			Ω(response.Code).Should(Equal(http.StatusInternalServerError))
+			Ω(response.Body.String()).Should(ContainSubstring("oh no!"))
+		})
+	})
+
+	Context("when the container cannot remove mappings", func() {
+		BeforeEach(func() {
+			fakeBackend.LookupReturns(new(fakes.FakeContainer), nil)
+		})
+
+		It("responds with 501", func() {
+			response := request("DELETE", "handle=some-handle&hostPort=61001&containerPort=8080")
+			Ω(response.Code).Should(Equal(http.StatusNotImplemented))
+		})
+	})
+})
@@ -0,0 +1,160 @@
+package read_only
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+)
+
+type ReadOnlyError struct {
+	Operation string
+}
+
+func (e ReadOnlyError) Error() string {
+	return fmt.Sprintf("%s is not permitted: the API is read-only", e.Operation)
+}
+
+// NewBackend lets Ping, Capacity, listing containers, and reading their
+// info and limits through to the backend, and rejects everything else, so
+// that it can be served to monitoring agents which mustn't change anything.
+//
+// Streaming files out and attaching to processes are rejected too, as
+// they expose what is inside the containers rather than their state.
+//
+// The backend is started and stopped by the server that serves it in full,
+// so Start and Stop do nothing. Requests to the read-only server don't keep
+// containers from being reaped.
+func NewBackend(backend api.Backend) api.Backend {
+	return &readOnlyBackend{
+		backend: backend,
+	}
+}
+
+type readOnlyBackend struct {
+	backend api.Backend
+}
+
+func (b *readOnlyBackend) Start() error {
+	return nil
+}
+
+func (b *readOnlyBackend) Stop() {}
+
+// GraceTime is only used to reap containers, which is left to the server
+// that serves the backend in full
+func (b *readOnlyBackend) GraceTime(api.Container) time.Duration {
+	return 0
+}
+
+func (b *readOnlyBackend) Ping() error {
+	return b.backend.Ping()
+}
+
+func (b *readOnlyBackend) Capacity() (api.Capacity, error) {
+	return b.backend.Capacity()
+}
+
+func (b *readOnlyBackend) Create(api.ContainerSpec) (api.Container, error) {
+	return nil, ReadOnlyError{"create"}
+}
+
+func (b *readOnlyBackend) Destroy(string) error {
+	return ReadOnlyError{"destroy"}
+}
+
+func (b *readOnlyBackend) Containers(filter api.Properties) ([]api.Container, error) {
+	containers, err := b.backend.Containers(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	readOnly := []api.Container{}
+	for _, container := range containers {
+		readOnly = append(readOnly, &readOnlyContainer{container})
+	}
+
+	return readOnly, nil
+}
+
+func (b *readOnlyBackend) Lookup(handle string) (api.Container, error) {
+	container, err := b.backend.Lookup(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	return &readOnlyContainer{container}, nil
+}
+
+type readOnlyContainer struct {
+	container api.Container
+}
+
+func (c *readOnlyContainer) Handle() string {
+	return c.container.Handle()
+}
+
+func (c *readOnlyContainer) Info() (api.ContainerInfo, error) {
+	return c.container.Info()
+}
+
+func (c *readOnlyContainer) CurrentBandwidthLimits() (api.BandwidthLimits, error) {
+	return c.container.CurrentBandwidthLimits()
+}
+
+func (c *readOnlyContainer) CurrentCPULimits() (api.CPULimits, error) {
+	return c.container.CurrentCPULimits()
+}
+
+func (c *readOnlyContainer) CurrentDiskLimits() (api.DiskLimits, error) {
+	return c.container.CurrentDiskLimits()
+}
+
+func (c *readOnlyContainer) CurrentMemoryLimits() (api.MemoryLimits, error) {
+	return c.container.CurrentMemoryLimits()
+}
+
+func (c *readOnlyContainer) Stop(bool) error {
+	return ReadOnlyError{"stop"}
+}
+
+func (c *readOnlyContainer) StreamIn(string, io.Reader) error {
+	return ReadOnlyError{"stream-in"}
+}
+
+func (c *readOnlyContainer) StreamOut(string) (io.ReadCloser, error) {
+	return nil, ReadOnlyError{"stream-out"}
+}
+
+func (c *readOnlyContainer) LimitBandwidth(api.BandwidthLimits) error {
+	return ReadOnlyError{"limit-bandwidth"}
+}
+
+func (c *readOnlyContainer) LimitCPU(api.CPULimits) error {
+	return ReadOnlyError{"limit-cpu"}
+}
+
+func (c *readOnlyContainer) LimitDisk(api.DiskLimits) error {
+	return ReadOnlyError{"limit-disk"}
+}
+
+func (c *readOnlyContainer) LimitMemory(api.MemoryLimits) error {
+	return ReadOnlyError{"limit-memory"}
+}
+
+func (c *readOnlyContainer) NetIn(uint32, uint32) (uint32, uint32, error) {
+	return 0, 0, ReadOnlyError{"net-in"}
+}
+
+func (c *readOnlyContainer) NetOut(string, uint32) error {
+	return ReadOnlyError{"net-out"}
+}
+
+func (c *readOnlyContainer) Run(api.ProcessSpec, api.ProcessIO) (api.Process, error) {
+	return nil, ReadOnlyError{"run"}
+}
+
+func (c *readOnlyContainer) Attach(uint32, api.ProcessIO) (api.Process, error) {
+	return nil, ReadOnlyError{"attach"}
+}
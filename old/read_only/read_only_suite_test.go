@@ -0,0 +1,13 @@
+package read_only_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Read Only Suite")
+}
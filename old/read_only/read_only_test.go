@@ -0,0 +1,167 @@
+package read_only_test
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/read_only"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+var _ = Describe("Read-only backend", func() {
+	var fakeBackend *fakes.FakeBackend
+	var fakeContainer *fakes.FakeContainer
+	var backend api.Backend
+
+	BeforeEach(func() {
+		fakeBackend = new(fakes.FakeBackend)
+		fakeContainer = new(fakes.FakeContainer)
+		fakeContainer.HandleReturns("some-handle")
+
+		fakeBackend.LookupReturns(fakeContainer, nil)
+		fakeBackend.ContainersReturns([]api.Container{fakeContainer}, nil)
+
+		backend = read_only.NewBackend(fakeBackend)
+	})
+
+	It("doesn't start or stop the backend", func() {
+		Ω(backend.Start()).Should(BeNil())
+		backend.Stop()
+
+		Ω(fakeBackend.StartCallCount()).Should(Equal(0))
+		Ω(fakeBackend.StopCallCount()).Should(Equal(0))
+	})
+
+	It("lets pings and capacity through", func() {
+		fakeBackend.PingReturns(errors.New("oh no!"))
+		fakeBackend.CapacityReturns(api.Capacity{MaxContainers: 42}, nil)
+
+		Ω(backend.Ping()).Should(MatchError("oh no!"))
+
+		capacity, err := backend.Capacity()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(capacity.MaxContainers).Should(Equal(uint64(42)))
+	})
+
+	It("rejects creates", func() {
+		_, err := backend.Create(api.ContainerSpec{})
+		Ω(err).Should(Equal(read_only.ReadOnlyError{Operation: "create"}))
+
+		Ω(fakeBackend.CreateCallCount()).Should(Equal(0))
+	})
+
+	It("rejects destroys", func() {
+		err := backend.Destroy("some-handle")
+		Ω(err).Should(Equal(read_only.ReadOnlyError{Operation: "destroy"}))
+
+		Ω(fakeBackend.DestroyCallCount()).Should(Equal(0))
+	})
+
+	It("never reaps containers", func() {
+		fakeBackend.GraceTimeReturns(time.Minute)
+
+		container, err := backend.Lookup("some-handle")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(backend.GraceTime(container)).Should(BeZero())
+	})
+
+	Context("when the container can't be found", func() {
+		BeforeEach(func() {
+			fakeBackend.LookupReturns(nil, errors.New("oh no!"))
+		})
+
+		It("returns the error", func() {
+			_, err := backend.Lookup("some-handle")
+			Ω(err).Should(MatchError("oh no!"))
+		})
+	})
+
+	for _, lookup := range []struct {
+		description string
+		lookup      func() api.Container
+	}{
+		{"looked up", func() api.Container {
+			container, err := backend.Lookup("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+			return container
+		}},
+		{"listed", func() api.Container {
+			containers, err := backend.Containers(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(containers).Should(HaveLen(1))
+			return containers[0]
+		}},
+	} {
+		lookup := lookup
+
+		Describe("containers "+lookup.description, func() {
+			var container api.Container
+
+			BeforeEach(func() {
+				container = lookup.lookup()
+			})
+
+			It("lets their info and limits through", func() {
+				fakeContainer.InfoReturns(api.ContainerInfo{State: "active"}, nil)
+				fakeContainer.CurrentMemoryLimitsReturns(api.MemoryLimits{LimitInBytes: 1024}, nil)
+
+				Ω(container.Handle()).Should(Equal("some-handle"))
+
+				info, err := container.Info()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(info.State).Should(Equal("active"))
+
+				limits, err := container.CurrentMemoryLimits()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(limits.LimitInBytes).Should(Equal(uint64(1024)))
+
+				container.CurrentBandwidthLimits()
+				container.CurrentCPULimits()
+				container.CurrentDiskLimits()
+
+				Ω(fakeContainer.CurrentBandwidthLimitsCallCount()).Should(Equal(1))
+				Ω(fakeContainer.CurrentCPULimitsCallCount()).Should(Equal(1))
+				Ω(fakeContainer.CurrentDiskLimitsCallCount()).Should(Equal(1))
+			})
+
+			It("rejects everything else", func() {
+				Ω(container.Stop(false)).Should(Equal(read_only.ReadOnlyError{Operation: "stop"}))
+				Ω(container.StreamIn("/", new(bytes.Buffer))).Should(Equal(read_only.ReadOnlyError{Operation: "stream-in"}))
+
+				_, err := container.StreamOut("/")
+				Ω(err).Should(Equal(read_only.ReadOnlyError{Operation: "stream-out"}))
+
+				Ω(container.LimitBandwidth(api.BandwidthLimits{})).Should(Equal(read_only.ReadOnlyError{Operation: "limit-bandwidth"}))
+				Ω(container.LimitCPU(api.CPULimits{})).Should(Equal(read_only.ReadOnlyError{Operation: "limit-cpu"}))
+				Ω(container.LimitDisk(api.DiskLimits{})).Should(Equal(read_only.ReadOnlyError{Operation: "limit-disk"}))
+				Ω(container.LimitMemory(api.MemoryLimits{})).Should(Equal(read_only.ReadOnlyError{Operation: "limit-memory"}))
+
+				_, _, err = container.NetIn(1, 2)
+				Ω(err).Should(Equal(read_only.ReadOnlyError{Operation: "net-in"}))
+
+				Ω(container.NetOut("1.2.3.4", 80)).Should(Equal(read_only.ReadOnlyError{Operation: "net-out"}))
+
+				_, err = container.Run(api.ProcessSpec{Path: "ls"}, api.ProcessIO{})
+				Ω(err).Should(Equal(read_only.ReadOnlyError{Operation: "run"}))
+
+				_, err = container.Attach(1, api.ProcessIO{})
+				Ω(err).Should(Equal(read_only.ReadOnlyError{Operation: "attach"}))
+
+				Ω(fakeContainer.StopCallCount()).Should(Equal(0))
+				Ω(fakeContainer.StreamInCallCount()).Should(Equal(0))
+				Ω(fakeContainer.StreamOutCallCount()).Should(Equal(0))
+				Ω(fakeContainer.LimitMemoryCallCount()).Should(Equal(0))
+				Ω(fakeContainer.NetInCallCount()).Should(Equal(0))
+				Ω(fakeContainer.NetOutCallCount()).Should(Equal(0))
+				Ω(fakeContainer.RunCallCount()).Should(Equal(0))
+				Ω(fakeContainer.AttachCallCount()).Should(Equal(0))
+			})
+		})
+	}
+})
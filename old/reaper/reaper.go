@@ -0,0 +1,473 @@
+package reaper
+
+import (
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/clock"
+)
+
+// Backend takes destroying containers whose grace time has expired over from
+// the garden server. The server gives every container a timer of its own, so
+// a burst of containers expiring together are all destroyed at once, which on
+// big cells ties the backend up for minutes. Expired containers are instead
+// destroyed at most batchSize at a time, each after a random delay of up to
+// jitter so that a batch doesn't hit the same locks and iptables chains at
+// the same instant.
+//
+// A container counts as active while any call is made on it, and while a
+// process run or attached to in it is running, as with the server's own
+// timers; its grace time counts down from when it was last active. The
+// server's timers are disarmed by reporting no grace time to it.
+type Backend struct {
+	api.Backend
+
+	logger    lager.Logger
+	clock     clock.Clock
+	interval  time.Duration
+	batchSize int
+	jitter    time.Duration
+
+	containers map[string]*activity
+	mutex      *sync.Mutex
+
+	stopping chan struct{}
+	stopped  chan struct{}
+}
+
+type activity struct {
+	graceTime  time.Duration
+	lastActive time.Time
+	busy       int
+}
+
+// NewBackend returns a backend which looks for expired containers every
+// interval.
+func NewBackend(
+	logger lager.Logger,
+	backend api.Backend,
+	clock clock.Clock,
+	interval time.Duration,
+	batchSize int,
+	jitter time.Duration,
+) *Backend {
+	return &Backend{
+		Backend: backend,
+
+		logger:    logger.Session("reaper"),
+		clock:     clock,
+		interval:  interval,
+		batchSize: batchSize,
+		jitter:    jitter,
+
+		containers: make(map[string]*activity),
+		mutex:      new(sync.Mutex),
+
+		stopping: make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+func (b *Backend) Start() error {
+	err := b.Backend.Start()
+	if err != nil {
+		return err
+	}
+
+	// containers restored from a snapshot start their grace time afresh
+	containers, err := b.Backend.Containers(nil)
+	if err != nil {
+		return err
+	}
+
+	for _, container := range containers {
+		b.track(container)
+	}
+
+	go b.run()
+
+	return nil
+}
+
+// Stop waits for the batch being reaped, if any, before stopping the
+// backend, so that its containers aren't snapshotted half destroyed.
+func (b *Backend) Stop() {
+	close(b.stopping)
+	<-b.stopped
+
+	b.Backend.Stop()
+}
+
+func (b *Backend) Create(spec api.ContainerSpec) (api.Container, error) {
+	container, err := b.Backend.Create(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	b.track(container)
+
+	return b.wrap(container), nil
+}
+
+func (b *Backend) Destroy(handle string) error {
+	err := b.Backend.Destroy(handle)
+	if err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	delete(b.containers, handle)
+	b.mutex.Unlock()
+
+	return nil
+}
+
+func (b *Backend) Lookup(handle string) (api.Container, error) {
+	container, err := b.Backend.Lookup(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.wrap(container), nil
+}
+
+// GraceTime is zero for every container, so that the server leaves reaping
+// them to the backend.
+func (b *Backend) GraceTime(api.Container) time.Duration {
+	return 0
+}
+
+// Reap destroys every container whose grace time has expired, in batches,
+// returning once they have all been destroyed or the backend is stopping.
+func (b *Backend) Reap() {
+	expired := b.expired()
+
+	for len(expired) > 0 {
+		select {
+		case <-b.stopping:
+			return
+		default:
+		}
+
+		size := b.batchSize
+		if size > len(expired) {
+			size = len(expired)
+		}
+
+		batch := expired[:size]
+		expired = expired[size:]
+
+		wg := new(sync.WaitGroup)
+
+		for _, handle := range batch {
+			wg.Add(1)
+
+			go func(handle string, delay time.Duration) {
+				defer wg.Done()
+
+				b.clock.Sleep(delay)
+				b.reap(handle)
+			}(handle, b.delay())
+		}
+
+		wg.Wait()
+	}
+}
+
+func (b *Backend) run() {
+	defer close(b.stopped)
+
+	for {
+		select {
+		case <-b.stopping:
+			return
+		case <-b.clock.After(b.interval):
+			b.Reap()
+		}
+	}
+}
+
+func (b *Backend) reap(handle string) {
+	b.mutex.Lock()
+
+	// the container may have been used or destroyed while waiting its turn
+	a, found := b.containers[handle]
+	if !found || !b.hasExpired(a) {
+		b.mutex.Unlock()
+		return
+	}
+
+	delete(b.containers, handle)
+
+	b.mutex.Unlock()
+
+	rLog := b.logger.Session("reap", lager.Data{
+		"handle":     handle,
+		"grace-time": a.graceTime.String(),
+	})
+
+	rLog.Info("reaping")
+
+	err := b.Backend.Destroy(handle)
+	if err != nil {
+		rLog.Error("failed-to-reap", err)
+
+		// try again once another grace time has passed, rather than on
+		// every interval
+		b.mutex.Lock()
+		a.lastActive = b.clock.Now()
+		b.containers[handle] = a
+		b.mutex.Unlock()
+
+		return
+	}
+
+	rLog.Info("reaped")
+}
+
+func (b *Backend) expired() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	handles := []string{}
+	for handle, a := range b.containers {
+		if b.hasExpired(a) {
+			handles = append(handles, handle)
+		}
+	}
+
+	return handles
+}
+
+func (b *Backend) hasExpired(a *activity) bool {
+	return a.busy == 0 && b.clock.Now().Sub(a.lastActive) >= a.graceTime
+}
+
+func (b *Backend) delay() time.Duration {
+	if b.jitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(b.jitter)))
+}
+
+func (b *Backend) track(container api.Container) {
+	graceTime := b.Backend.GraceTime(container)
+	if graceTime == 0 {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.containers[container.Handle()] = &activity{
+		graceTime:  graceTime,
+		lastActive: b.clock.Now(),
+	}
+}
+
+func (b *Backend) begin(handle string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if a, found := b.containers[handle]; found {
+		a.busy++
+	}
+}
+
+func (b *Backend) end(handle string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if a, found := b.containers[handle]; found {
+		a.busy--
+		a.lastActive = b.clock.Now()
+	}
+}
+
+func (b *Backend) touch(handle string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if a, found := b.containers[handle]; found {
+		a.lastActive = b.clock.Now()
+	}
+}
+
+func (b *Backend) wrap(container api.Container) api.Container {
+	return &reapableContainer{
+		Container: container,
+		backend:   b,
+	}
+}
+
+type reapableContainer struct {
+	api.Container
+
+	backend *Backend
+}
+
+func (c *reapableContainer) begin() {
+	c.backend.begin(c.Handle())
+}
+
+func (c *reapableContainer) end() {
+	c.backend.end(c.Handle())
+}
+
+func (c *reapableContainer) Stop(kill bool) error {
+	c.begin()
+	defer c.end()
+
+	return c.Container.Stop(kill)
+}
+
+func (c *reapableContainer) Info() (api.ContainerInfo, error) {
+	c.begin()
+	defer c.end()
+
+	return c.Container.Info()
+}
+
+func (c *reapableContainer) StreamIn(dstPath string, tarStream io.Reader) error {
+	c.begin()
+	defer c.end()
+
+	return c.Container.StreamIn(dstPath, tarStream)
+}
+
+// the stream is read once StreamOut has returned, so reading it counts as
+// activity too
+func (c *reapableContainer) StreamOut(srcPath string) (io.ReadCloser, error) {
+	c.begin()
+	defer c.end()
+
+	reader, err := c.Container.StreamOut(srcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reapableReader{
+		ReadCloser: reader,
+		container:  c,
+	}, nil
+}
+
+func (c *reapableContainer) LimitBandwidth(limits api.BandwidthLimits) error {
+	c.begin()
+	defer c.end()
+
+	return c.Container.LimitBandwidth(limits)
+}
+
+func (c *reapableContainer) CurrentBandwidthLimits() (api.BandwidthLimits, error) {
+	c.begin()
+	defer c.end()
+
+	return c.Container.CurrentBandwidthLimits()
+}
+
+func (c *reapableContainer) LimitCPU(limits api.CPULimits) error {
+	c.begin()
+	defer c.end()
+
+	return c.Container.LimitCPU(limits)
+}
+
+func (c *reapableContainer) CurrentCPULimits() (api.CPULimits, error) {
+	c.begin()
+	defer c.end()
+
+	return c.Container.CurrentCPULimits()
+}
+
+func (c *reapableContainer) LimitDisk(limits api.DiskLimits) error {
+	c.begin()
+	defer c.end()
+
+	return c.Container.LimitDisk(limits)
+}
+
+func (c *reapableContainer) CurrentDiskLimits() (api.DiskLimits, error) {
+	c.begin()
+	defer c.end()
+
+	return c.Container.CurrentDiskLimits()
+}
+
+func (c *reapableContainer) LimitMemory(limits api.MemoryLimits) error {
+	c.begin()
+	defer c.end()
+
+	return c.Container.LimitMemory(limits)
+}
+
+func (c *reapableContainer) CurrentMemoryLimits() (api.MemoryLimits, error) {
+	c.begin()
+	defer c.end()
+
+	return c.Container.CurrentMemoryLimits()
+}
+
+func (c *reapableContainer) NetIn(hostPort, containerPort uint32) (uint32, uint32, error) {
+	c.begin()
+	defer c.end()
+
+	return c.Container.NetIn(hostPort, containerPort)
+}
+
+func (c *reapableContainer) NetOut(network string, port uint32) error {
+	c.begin()
+	defer c.end()
+
+	return c.Container.NetOut(network, port)
+}
+
+func (c *reapableContainer) Run(spec api.ProcessSpec, io api.ProcessIO) (api.Process, error) {
+	c.begin()
+
+	process, err := c.Container.Run(spec, io)
+	if err != nil {
+		c.end()
+		return nil, err
+	}
+
+	go c.endOnExit(process)
+
+	return process, nil
+}
+
+func (c *reapableContainer) Attach(processID uint32, io api.ProcessIO) (api.Process, error) {
+	c.begin()
+
+	process, err := c.Container.Attach(processID, io)
+	if err != nil {
+		c.end()
+		return nil, err
+	}
+
+	go c.endOnExit(process)
+
+	return process, nil
+}
+
+func (c *reapableContainer) endOnExit(process api.Process) {
+	process.Wait()
+	c.end()
+}
+
+type reapableReader struct {
+	io.ReadCloser
+
+	container *reapableContainer
+}
+
+func (r *reapableReader) Read(p []byte) (int, error) {
+	r.container.backend.touch(r.container.Handle())
+	return r.ReadCloser.Read(p)
+}
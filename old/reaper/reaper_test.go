@@ -0,0 +1,283 @@
+package reaper_test
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/clock/fake_clock"
+	"github.com/cloudfoundry-incubator/garden-linux/old/reaper"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+var _ = Describe("Reaper", func() {
+	var fakeBackend *fakes.FakeBackend
+	var fakeClock *fake_clock.FakeClock
+	var backend *reaper.Backend
+
+	newContainer := func(handle string) *fakes.FakeContainer {
+		container := new(fakes.FakeContainer)
+		container.HandleReturns(handle)
+		return container
+	}
+
+	destroyed := func() []string {
+		handles := []string{}
+		for i := 0; i < fakeBackend.DestroyCallCount(); i++ {
+			handles = append(handles, fakeBackend.DestroyArgsForCall(i))
+		}
+
+		return handles
+	}
+
+	BeforeEach(func() {
+		fakeBackend = new(fakes.FakeBackend)
+		fakeBackend.GraceTimeReturns(time.Minute)
+
+		fakeClock = fake_clock.New(time.Now())
+
+		backend = reaper.NewBackend(
+			lagertest.NewTestLogger("test"),
+			fakeBackend,
+			fakeClock,
+			time.Hour,
+			2,
+			0,
+		)
+	})
+
+	It("reports no grace time to the server", func() {
+		Ω(backend.GraceTime(newContainer("some-handle"))).Should(BeZero())
+	})
+
+	It("starts and stops the backend", func() {
+		Ω(backend.Start()).ShouldNot(HaveOccurred())
+		Ω(fakeBackend.StartCallCount()).Should(Equal(1))
+
+		backend.Stop()
+		Ω(fakeBackend.StopCallCount()).Should(Equal(1))
+	})
+
+	Describe("containers present when started", func() {
+		BeforeEach(func() {
+			fakeBackend.ContainersReturns([]api.Container{
+				newContainer("handle-a"),
+				newContainer("handle-b"),
+			}, nil)
+
+			Ω(backend.Start()).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			backend.Stop()
+		})
+
+		It("are reaped once their grace time has expired", func() {
+			fakeClock.Increment(59 * time.Second)
+			backend.Reap()
+			Ω(fakeBackend.DestroyCallCount()).Should(Equal(0))
+
+			fakeClock.Increment(time.Second)
+			backend.Reap()
+			Ω(destroyed()).Should(ConsistOf("handle-a", "handle-b"))
+		})
+
+		It("are reaped by the backend's own loop", func() {
+			Eventually(fakeClock.WatcherCount).Should(Equal(1))
+			fakeClock.Increment(time.Hour)
+
+			Eventually(fakeBackend.DestroyCallCount).Should(Equal(2))
+		})
+
+		It("are reaped only once", func() {
+			fakeClock.Increment(time.Minute)
+			backend.Reap()
+			backend.Reap()
+
+			Ω(fakeBackend.DestroyCallCount()).Should(Equal(2))
+		})
+
+		It("are not reaped once destroyed through the backend", func() {
+			Ω(backend.Destroy("handle-a")).ShouldNot(HaveOccurred())
+
+			fakeClock.Increment(time.Minute)
+			backend.Reap()
+
+			Ω(destroyed()).Should(Equal([]string{"handle-a", "handle-b"}))
+		})
+
+		Context("when reaping a container fails", func() {
+			BeforeEach(func() {
+				fakeBackend.DestroyStub = func(handle string) error {
+					if handle == "handle-a" {
+						return errors.New("oh no!")
+					}
+
+					return nil
+				}
+			})
+
+			It("tries again once another grace time has passed", func() {
+				fakeClock.Increment(time.Minute)
+				backend.Reap()
+				Ω(fakeBackend.DestroyCallCount()).Should(Equal(2))
+
+				fakeClock.Increment(30 * time.Second)
+				backend.Reap()
+				Ω(fakeBackend.DestroyCallCount()).Should(Equal(2))
+
+				fakeClock.Increment(30 * time.Second)
+				backend.Reap()
+				Ω(destroyed()).Should(HaveLen(3))
+				Ω(destroyed()[2]).Should(Equal("handle-a"))
+			})
+		})
+	})
+
+	Describe("containers with no grace time", func() {
+		BeforeEach(func() {
+			fakeBackend.GraceTimeReturns(0)
+			fakeBackend.CreateReturns(newContainer("some-handle"), nil)
+		})
+
+		It("are never reaped", func() {
+			_, err := backend.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeClock.Increment(time.Hour)
+			backend.Reap()
+
+			Ω(fakeBackend.DestroyCallCount()).Should(Equal(0))
+		})
+	})
+
+	Describe("reaping a burst of expired containers", func() {
+		var mutex *sync.Mutex
+		var destroying, mostDestroying int
+		var release chan struct{}
+
+		BeforeEach(func() {
+			mutex = new(sync.Mutex)
+			destroying, mostDestroying = 0, 0
+			release = make(chan struct{})
+
+			fakeBackend.DestroyStub = func(string) error {
+				mutex.Lock()
+				destroying++
+				if destroying > mostDestroying {
+					mostDestroying = destroying
+				}
+				mutex.Unlock()
+
+				<-release
+
+				mutex.Lock()
+				destroying--
+				mutex.Unlock()
+
+				return nil
+			}
+
+			for _, handle := range []string{"a", "b", "c", "d", "e"} {
+				fakeBackend.CreateReturns(newContainer(handle), nil)
+
+				_, err := backend.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			fakeClock.Increment(time.Minute)
+		})
+
+		It("destroys them a batch at a time", func() {
+			reaped := make(chan struct{})
+			go func() {
+				backend.Reap()
+				close(reaped)
+			}()
+
+			inFlight := func() int {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				return destroying
+			}
+
+			Eventually(inFlight).Should(Equal(2))
+			Consistently(inFlight).Should(Equal(2))
+
+			close(release)
+
+			Eventually(reaped).Should(BeClosed())
+
+			Ω(fakeBackend.DestroyCallCount()).Should(Equal(5))
+			Ω(mostDestroying).Should(Equal(2))
+		})
+	})
+
+	Describe("activity on a container", func() {
+		var container *fakes.FakeContainer
+
+		BeforeEach(func() {
+			container = newContainer("some-handle")
+
+			fakeBackend.CreateReturns(container, nil)
+			fakeBackend.LookupReturns(container, nil)
+
+			_, err := backend.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("restarts its grace time", func() {
+			fakeClock.Increment(50 * time.Second)
+
+			looked, err := backend.Lookup("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = looked.Info()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeClock.Increment(50 * time.Second)
+			backend.Reap()
+			Ω(fakeBackend.DestroyCallCount()).Should(Equal(0))
+
+			fakeClock.Increment(10 * time.Second)
+			backend.Reap()
+			Ω(fakeBackend.DestroyCallCount()).Should(Equal(1))
+		})
+
+		It("keeps it from being reaped while a process runs in it", func() {
+			exited := make(chan struct{})
+
+			process := new(fakes.FakeProcess)
+			process.WaitStub = func() (int, error) {
+				<-exited
+				return 0, nil
+			}
+
+			container.RunReturns(process, nil)
+
+			looked, err := backend.Lookup("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = looked.Run(api.ProcessSpec{}, api.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeClock.Increment(time.Hour)
+			backend.Reap()
+			Ω(fakeBackend.DestroyCallCount()).Should(Equal(0))
+
+			close(exited)
+
+			Eventually(func() int {
+				fakeClock.Increment(time.Minute)
+				backend.Reap()
+				return fakeBackend.DestroyCallCount()
+			}).Should(Equal(1))
+		})
+	})
+})
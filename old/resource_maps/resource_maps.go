@@ -0,0 +1,223 @@
+package resource_maps
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/admin"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+var ErrBadSignature = errors.New("resource map signature does not match")
+
+type Container interface {
+	Resources() *linux_backend.Resources
+}
+
+type Pool interface {
+	Reserve(handle string, resources linux_backend.ResourcesSnapshot) error
+	Unreserve(handle string) bool
+}
+
+// Map is the resources of every container on a cell, by handle, sorted so
+// that the same containers always give the same map.
+type Map struct {
+	Containers []Entry `json:"containers"`
+
+	// hex HMAC-SHA256 of the JSON encoding of Containers under the key shared
+	// by the cells
+	Signature string `json:"signature"`
+}
+
+type Entry struct {
+	Handle    string                          `json:"handle"`
+	Resources linux_backend.ResourcesSnapshot `json:"resources"`
+}
+
+// Handler exports the cell's containers' handles with their UIDs, networks
+// and ports as a signed Map on GET, and reserves a Map's resources on POST,
+// so that containers migrated from another cell during planned host
+// replacement can be created with the same network identities. A handle's
+// reservation is released on DELETE ?handle=...; it is otherwise used by
+// the create with the handle, or dropped when the server restarts.
+//
+// A Map is only imported if it was signed with the same key, and either all
+// of it is reserved or none of it is.
+type Handler struct {
+	logger  lager.Logger
+	backend api.Client
+	pool    Pool
+	key     []byte
+}
+
+func New(logger lager.Logger, backend api.Client, pool Pool, key []byte) *Handler {
+	return &Handler{
+		logger:  logger.Session("resource-maps"),
+		backend: backend,
+		pool:    pool,
+		key:     key,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		h.export(w)
+	case "POST":
+		h.reserve(w, r)
+	case "DELETE":
+		h.unreserve(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) export(w http.ResponseWriter) {
+	containers, err := h.backend.Containers(nil)
+	if err != nil {
+		h.logger.Error("failed-to-list-containers", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entries := []Entry{}
+
+	for _, container := range containers {
+		var resourceful Container
+		if !admin.As(container, &resourceful) {
+			continue
+		}
+
+		resources := resourceful.Resources()
+
+		ports := append([]uint32{}, resources.Ports...)
+		sort.Sort(byPort(ports))
+
+		entries = append(entries, Entry{
+			Handle: container.Handle(),
+			Resources: linux_backend.ResourcesSnapshot{
+				UID:     resources.UID,
+				Network: resources.Network,
+				Ports:   ports,
+			},
+		})
+	}
+
+	sort.Sort(byHandle(entries))
+
+	signature, err := h.sign(entries)
+	if err != nil {
+		h.logger.Error("failed-to-sign", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(Map{
+		Containers: entries,
+		Signature:  signature,
+	})
+}
+
+func (h *Handler) reserve(w http.ResponseWriter, r *http.Request) {
+	var resourceMap Map
+	err := json.NewDecoder(r.Body).Decode(&resourceMap)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	signature, err := h.sign(resourceMap.Containers)
+	if err != nil {
+		h.logger.Error("failed-to-sign", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(resourceMap.Signature)) {
+		h.logger.Error("bad-signature", ErrBadSignature)
+		http.Error(w, ErrBadSignature.Error(), http.StatusForbidden)
+		return
+	}
+
+	for i, entry := range resourceMap.Containers {
+		if entry.Resources.Network == nil {
+			h.undo(resourceMap.Containers[:i])
+			http.Error(w, "no network for handle: "+entry.Handle, http.StatusBadRequest)
+			return
+		}
+
+		err := h.pool.Reserve(entry.Handle, entry.Resources)
+		if err != nil {
+			h.logger.Error("failed-to-reserve", err, lager.Data{
+				"handle": entry.Handle,
+			})
+
+			h.undo(resourceMap.Containers[:i])
+
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+	}
+
+	h.logger.Info("reserved", lager.Data{
+		"containers": len(resourceMap.Containers),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) unreserve(w http.ResponseWriter, r *http.Request) {
+	handle := r.URL.Query().Get("handle")
+
+	if !h.pool.Unreserve(handle) {
+		http.Error(w, "nothing reserved for handle: "+handle, http.StatusNotFound)
+		return
+	}
+
+	h.logger.Info("unreserved", lager.Data{
+		"handle": handle,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) undo(reserved []Entry) {
+	for _, entry := range reserved {
+		h.pool.Unreserve(entry.Handle)
+	}
+}
+
+func (h *Handler) sign(entries []Entry) (string, error) {
+	payload, err := json.Marshal(entries)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write(payload)
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+type byHandle []Entry
+
+func (s byHandle) Len() int           { return len(s) }
+func (s byHandle) Less(i, j int) bool { return s[i].Handle < s[j].Handle }
+func (s byHandle) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type byPort []uint32
+
+func (s byPort) Len() int           { return len(s) }
+func (s byPort) Less(i, j int) bool { return s[i] < s[j] }
+func (s byPort) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
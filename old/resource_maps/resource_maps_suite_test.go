@@ -0,0 +1,13 @@
+package resource_maps_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestResourceMaps(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Resource Maps Suite")
+}
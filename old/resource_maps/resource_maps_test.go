@@ -0,0 +1,237 @@
+package resource_maps_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+	"github.com/cloudfoundry-incubator/garden-linux/old/resource_maps"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+)
+
+type resourcefulContainer struct {
+	*fakes.FakeContainer
+
+	resources *linux_backend.Resources
+}
+
+func (c *resourcefulContainer) Resources() *linux_backend.Resources {
+	return c.resources
+}
+
+type fakePool struct {
+	reserved   map[string]linux_backend.ResourcesSnapshot
+	reserveErr map[string]error
+}
+
+func (p *fakePool) Reserve(handle string, resources linux_backend.ResourcesSnapshot) error {
+	if err := p.reserveErr[handle]; err != nil {
+		return err
+	}
+
+	p.reserved[handle] = resources
+	return nil
+}
+
+func (p *fakePool) Unreserve(handle string) bool {
+	_, found := p.reserved[handle]
+	delete(p.reserved, handle)
+	return found
+}
+
+var _ = Describe("Resource maps", func() {
+	var fakeBackend *fakes.FakeBackend
+	var pool *fakePool
+	var handler *resource_maps.Handler
+
+	newContainer := func(handle string, uid uint32, subnet string, ports ...uint32) api.Container {
+		_, ipNet, err := net.ParseCIDR(subnet)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fakeContainer := new(fakes.FakeContainer)
+		fakeContainer.HandleReturns(handle)
+
+		return &resourcefulContainer{
+			FakeContainer: fakeContainer,
+			resources:     linux_backend.NewResources(uid, network.New(ipNet), ports),
+		}
+	}
+
+	BeforeEach(func() {
+		fakeBackend = new(fakes.FakeBackend)
+		fakeBackend.ContainersReturns([]api.Container{
+			newContainer("handle-b", 10001, "10.254.0.4/30", 61002, 61001),
+			newContainer("handle-a", 10000, "10.254.0.0/30"),
+			new(fakes.FakeContainer),
+		}, nil)
+
+		pool = &fakePool{
+			reserved:   map[string]linux_backend.ResourcesSnapshot{},
+			reserveErr: map[string]error{},
+		}
+
+		handler = resource_maps.New(lagertest.NewTestLogger("test"), fakeBackend, pool, []byte("some-key"))
+	})
+
+	request := func(method, query string, body io.Reader) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+
+		request, err := http.NewRequest(method, "/resource-map?"+query, body)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	export := func() []byte {
+		response := request("GET", "", nil)
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+		return response.Body.Bytes()
+	}
+
+	decode := func(exported []byte) resource_maps.Map {
+		var resourceMap resource_maps.Map
+		err := json.Unmarshal(exported, &resourceMap)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return resourceMap
+	}
+
+	encode := func(resourceMap resource_maps.Map) io.Reader {
+		payload, err := json.Marshal(resourceMap)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return bytes.NewReader(payload)
+	}
+
+	Describe("exporting", func() {
+		It("lists each container's resources, sorted by handle, with their ports sorted", func() {
+			resourceMap := decode(export())
+
+			Ω(resourceMap.Containers).Should(HaveLen(2))
+
+			Ω(resourceMap.Containers[0].Handle).Should(Equal("handle-a"))
+			Ω(resourceMap.Containers[0].Resources.UID).Should(Equal(uint32(10000)))
+			Ω(resourceMap.Containers[0].Resources.Network.String()).Should(Equal("10.254.0.0/30"))
+			Ω(resourceMap.Containers[0].Resources.Ports).Should(BeEmpty())
+
+			Ω(resourceMap.Containers[1].Handle).Should(Equal("handle-b"))
+			Ω(resourceMap.Containers[1].Resources.UID).Should(Equal(uint32(10001)))
+			Ω(resourceMap.Containers[1].Resources.Network.String()).Should(Equal("10.254.0.4/30"))
+			Ω(resourceMap.Containers[1].Resources.Ports).Should(Equal([]uint32{61001, 61002}))
+
+			Ω(resourceMap.Signature).ShouldNot(BeEmpty())
+		})
+
+		It("exports the same map for the same containers", func() {
+			first := export()
+
+			fakeBackend.ContainersReturns([]api.Container{
+				newContainer("handle-a", 10000, "10.254.0.0/30"),
+				newContainer("handle-b", 10001, "10.254.0.4/30", 61001, 61002),
+			}, nil)
+
+			Ω(export()).Should(Equal(first))
+		})
+
+		Context("when listing the containers fails", func() {
+			BeforeEach(func() {
+				fakeBackend.ContainersReturns(nil, errors.New("oh no!"))
+			})
+
+			It("responds with 500", func() {
+				Ω(request("GET", "", nil).Code).Should(Equal(http.StatusInternalServerError))
+			})
+		})
+	})
+
+	Describe("importing", func() {
+		It("reserves the resources of every container in a map signed with the same key", func() {
+			response := request("POST", "", bytes.NewReader(export()))
+			Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+			Ω(pool.reserved).Should(HaveLen(2))
+			Ω(pool.reserved["handle-a"].UID).Should(Equal(uint32(10000)))
+			Ω(pool.reserved["handle-a"].Network.String()).Should(Equal("10.254.0.0/30"))
+			Ω(pool.reserved["handle-b"].Ports).Should(Equal([]uint32{61001, 61002}))
+		})
+
+		It("rejects a map signed with a different key", func() {
+			other := resource_maps.New(lagertest.NewTestLogger("test"), fakeBackend, pool, []byte("some-other-key"))
+
+			recorder := httptest.NewRecorder()
+			get, err := http.NewRequest("GET", "/resource-map", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			other.ServeHTTP(recorder, get)
+
+			response := request("POST", "", recorder.Body)
+			Ω(response.Code).Should(Equal(http.StatusForbidden))
+			Ω(pool.reserved).Should(BeEmpty())
+		})
+
+		It("rejects a map that has been changed since it was signed", func() {
+			resourceMap := decode(export())
+			resourceMap.Containers[1].Resources.Ports = []uint32{22}
+
+			response := request("POST", "", encode(resourceMap))
+			Ω(response.Code).Should(Equal(http.StatusForbidden))
+			Ω(pool.reserved).Should(BeEmpty())
+		})
+
+		It("rejects a malformed map", func() {
+			response := request("POST", "", bytes.NewBufferString("{"))
+			Ω(response.Code).Should(Equal(http.StatusBadRequest))
+		})
+
+		Context("when a container's resources cannot be reserved", func() {
+			BeforeEach(func() {
+				pool.reserveErr["handle-b"] = errors.New("taken")
+			})
+
+			It("responds with 409 and reserves none of them", func() {
+				response := request("POST", "", bytes.NewReader(export()))
+				Ω(response.Code).Should(Equal(http.StatusConflict))
+
+				Ω(pool.reserved).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("releasing a reservation", func() {
+		BeforeEach(func() {
+			pool.reserved["some-handle"] = linux_backend.ResourcesSnapshot{}
+		})
+
+		It("returns the handle's resources to the pool", func() {
+			response := request("DELETE", "handle=some-handle", nil)
+			Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+			Ω(pool.reserved).Should(BeEmpty())
+		})
+
+		It("responds with 404 if nothing is reserved for the handle", func() {
+			response := request("DELETE", "handle=bogus-handle", nil)
+			Ω(response.Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+
+	It("only allows GET, POST and DELETE", func() {
+		response := request("PUT", "", nil)
+		Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+		Ω(response.Header().Get("Allow")).Should(Equal("GET, POST, DELETE"))
+	})
+})
@@ -1,11 +1,95 @@
 package sysconfig
 
-import "fmt"
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
 
 type Config struct {
-	CgroupPath             string
+	CgroupPath string
+
+	// path under the root of each cgroup hierarchy in which containers'
+	// cgroups are created, e.g. "system.slice/garden"; empty for the root
+	CgroupParent string
+
 	NetworkInterfacePrefix string
 	IPTables               IPTablesConfig
+
+	// attach every container to this existing bridge rather than giving
+	// each its own subnet; empty for a subnet per container
+	NetworkBridge string
+
+	// give containers on NetworkBridge MACs derived from their addresses,
+	// and resolve them to each other and the host with permanent neighbour
+	// entries rather than ARP
+	NetworkStaticNeighbours bool
+
+	// MTU of containers' interfaces, unless overridden for their subnet or
+	// by their properties; 0 for 1500. Only read by the pool.
+	NetworkMTU        int
+	NetworkSubnetMTUs []SubnetMTU
+
+	// the largest MTU that the uplink containers' traffic leaves the host
+	// through can carry, which no container may exceed; 0 if unknown
+	NetworkUplinkMTU int
+
+	// route each container's single address to it and answer ARP for those
+	// addresses on this interface, rather than giving each a subnet; empty
+	// unless containers are routed
+	NetworkProxyARPInterface string
+
+	// also route each container's subnet, or address, through this routing
+	// table, e.g. one a VPN daemon or host service routes by; empty for
+	// just the main table
+	NetworkRouteTable string
+
+	// let containers reach every port on the host's addresses and link-local
+	// metadata services; otherwise they may only reach HostAllowedPorts
+	AllowHostAccess  bool
+	HostAllowedPorts []uint32
+
+	// run a DNS forwarder on each container's host-side address and point
+	// the container's resolv.conf at it
+	DNSForwarder bool
+
+	// domains to search and resolver options to set in containers'
+	// resolv.conf unless overridden by their properties; empty to leave
+	// whatever they inherit. Only read by the pool.
+	DNSSearchDomains []string
+	DNSOptions       []string
+
+	// let containers be created with properties that weaken their
+	// isolation from the host, such as running garden nested inside them
+	AllowPrivilegedContainers bool
+
+	// pipe every core dump to a handler applying the crashing container's
+	// core dump policy, collecting cores into this directory for containers
+	// that ask for it; empty to leave the host's core_pattern alone
+	CoreDumpsDirectory string
+
+	// oom_score_adj given to containers' processes unless overridden by their
+	// properties, so that the OOM killer prefers them to the server and the
+	// host's agents; 0 leaves them as likely to be killed as any other
+	// process. Only read by the pool.
+	ContainerOOMScoreAdj int
+
+	// most connections each container may have tracked at once unless
+	// overridden by its properties; 0 for no limit. Only read by the pool.
+	ContainerMaxConntrackEntries int
+
+	// addresses of the host's that containers' outbound traffic is SNATed
+	// to, each container being given one in turn unless it chooses its own,
+	// so that upstream firewalls can tell tenants apart; empty to SNAT it
+	// all to the host's external address. Only read by the pool.
+	ExternalIPs []string
+}
+
+// SubnetMTU overrides the MTU of containers whose addresses are in Network.
+type SubnetMTU struct {
+	Network *net.IPNet
+	MTU     int
 }
 
 type IPTablesConfig struct {
@@ -16,6 +100,8 @@ type IPTablesConfig struct {
 type IPTablesFilterConfig struct {
 	ForwardChain   string
 	DefaultChain   string
+	InputChain     string
+	EgressChain    string
 	InstancePrefix string
 }
 
@@ -35,6 +121,8 @@ func NewConfig(tag string) Config {
 			Filter: IPTablesFilterConfig{
 				ForwardChain:   fmt.Sprintf("w-%s-forward", tag),
 				DefaultChain:   fmt.Sprintf("w-%s-default", tag),
+				InputChain:     fmt.Sprintf("w-%s-input", tag),
+				EgressChain:    fmt.Sprintf("w-%s-egress", tag),
 				InstancePrefix: fmt.Sprintf("w-%s-instance-", tag),
 			},
 			NAT: IPTablesNATConfig{
@@ -49,15 +137,40 @@ func NewConfig(tag string) Config {
 func (config Config) Environ() []string {
 	return []string{
 		"GARDEN_CGROUP_PATH=" + config.CgroupPath,
+		"GARDEN_CGROUP_PARENT=" + config.CgroupParent,
 
 		"GARDEN_NETWORK_INTERFACE_PREFIX=" + config.NetworkInterfacePrefix,
+		"GARDEN_NETWORK_BRIDGE=" + config.NetworkBridge,
+		"GARDEN_NETWORK_PROXY_ARP_INTERFACE=" + config.NetworkProxyARPInterface,
+		"GARDEN_NETWORK_STATIC_NEIGHBOURS=" + strconv.FormatBool(config.NetworkStaticNeighbours),
+		"GARDEN_NETWORK_ROUTE_TABLE=" + config.NetworkRouteTable,
 
 		"GARDEN_IPTABLES_FILTER_FORWARD_CHAIN=" + config.IPTables.Filter.ForwardChain,
 		"GARDEN_IPTABLES_FILTER_DEFAULT_CHAIN=" + config.IPTables.Filter.DefaultChain,
+		"GARDEN_IPTABLES_FILTER_INPUT_CHAIN=" + config.IPTables.Filter.InputChain,
+		"GARDEN_IPTABLES_FILTER_EGRESS_CHAIN=" + config.IPTables.Filter.EgressChain,
 		"GARDEN_IPTABLES_FILTER_INSTANCE_PREFIX=" + config.IPTables.Filter.InstancePrefix,
 
 		"GARDEN_IPTABLES_NAT_PREROUTING_CHAIN=" + config.IPTables.NAT.PreroutingChain,
 		"GARDEN_IPTABLES_NAT_POSTROUTING_CHAIN=" + config.IPTables.NAT.PostroutingChain,
 		"GARDEN_IPTABLES_NAT_INSTANCE_PREFIX=" + config.IPTables.NAT.InstancePrefix,
+
+		"GARDEN_ALLOW_HOST_ACCESS=" + strconv.FormatBool(config.AllowHostAccess),
+		"GARDEN_HOST_ALLOWED_PORTS=" + formatPorts(config.HostAllowedPorts),
+
+		"GARDEN_DNS_FORWARDER=" + strconv.FormatBool(config.DNSForwarder),
+
+		"GARDEN_ALLOW_PRIVILEGED_CONTAINERS=" + strconv.FormatBool(config.AllowPrivilegedContainers),
+
+		"GARDEN_CORE_DUMPS_DIRECTORY=" + config.CoreDumpsDirectory,
+	}
+}
+
+func formatPorts(ports []uint32) string {
+	formatted := make([]string, len(ports))
+	for i, port := range ports {
+		formatted[i] = strconv.FormatUint(uint64(port), 10)
 	}
+
+	return strings.Join(formatted, ",")
 }